@@ -10,6 +10,7 @@ import (
 	"mailman/internal/database"
 	"mailman/internal/models"
 	"mailman/internal/repository"
+	"mailman/internal/secrets"
 )
 
 func main() {
@@ -17,6 +18,9 @@ func main() {
 
 	// 初始化配置和数据库
 	cfg := config.Load()
+	if err := secrets.Configure(cfg.Secrets.MasterKey, cfg.Secrets.MasterKeyFile); err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
 	err := database.Initialize(database.Config{
 		Driver:   cfg.Database.Driver,
 		Host:     cfg.Database.Host,
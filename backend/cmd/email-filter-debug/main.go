@@ -9,12 +9,16 @@ import (
 	"mailman/internal/database"
 	"mailman/internal/models"
 	"mailman/internal/repository"
+	"mailman/internal/secrets"
 	"mailman/internal/services"
 )
 
 func main() {
 	// 加载配置
 	cfg := config.Load()
+	if err := secrets.Configure(cfg.Secrets.MasterKey, cfg.Secrets.MasterKeyFile); err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
 
 	// 初始化数据库
 	err := database.Initialize(database.Config{
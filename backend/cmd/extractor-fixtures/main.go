@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"mailman/internal/services"
+)
+
+// 运行内置提取器的样例邮件语料，任何样例失败时以非零状态退出。样例同样由
+// go test ./internal/services 检查，本命令逐个列出结果，便于调整规则时查看：
+//
+//	go run ./cmd/extractor-fixtures [-v] [-only otp]
+func main() {
+	verbose := flag.Bool("v", false, "显示通过的样例")
+	only := flag.String("only", "", "只运行指定提取器的样例，例如 otp")
+	flag.Parse()
+
+	results, err := services.RunBuiltinExtractorFixtures()
+	if err != nil {
+		log.Fatalf("运行样例失败: %v", err)
+	}
+
+	passed, failed := 0, 0
+	for _, result := range results {
+		name := strings.SplitN(result.Extractor, "@", 2)[0]
+		if *only != "" && name != *only {
+			continue
+		}
+		if result.Passed {
+			passed++
+			if *verbose {
+				fmt.Printf("PASS %-20s %s\n", result.Extractor, result.Fixture)
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %-20s %s\n     expected: %q\n     got:      %q\n", result.Extractor, result.Fixture, result.Expected, result.Got)
+		if result.Error != "" {
+			fmt.Printf("     error:    %s\n", result.Error)
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
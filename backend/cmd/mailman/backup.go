@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"mailman/internal/backup"
+	"mailman/internal/config"
+	"mailman/internal/database"
+
+	"golang.org/x/term"
+)
+
+// backupPassphraseEnv 提供快照口令的环境变量，适合脚本和定时任务
+const backupPassphraseEnv = "MAILMAN_BACKUP_PASSPHRASE"
+
+// runBackup 实现 mailman backup 子命令
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	var (
+		output      = fs.String("o", "", "输出文件，默认 mailman-backup-<时间>.jsonl.gz，- 表示标准输出")
+		emails      = fs.Bool("emails", false, "包含邮件")
+		attachments = fs.Bool("attachments", false, "包含附件内容（需要 -emails）")
+		encrypt     = fs.Bool("encrypt", false, "用口令加密快照，口令取自 "+backupPassphraseEnv+" 或交互输入")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使用方法: mailman backup [-o 文件] [-emails [-attachments]] [-encrypt]")
+		fmt.Fprintln(fs.Output(), "快照包含账户、配置、模板、触发器和同步状态；不加 -encrypt 时其中的凭据为明文")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *attachments && !*emails {
+		return fmt.Errorf("-attachments requires -emails")
+	}
+
+	opts := backup.Options{IncludeEmails: *emails, IncludeAttachments: *attachments}
+	if *encrypt {
+		passphrase, err := backupPassphrase(true)
+		if err != nil {
+			return err
+		}
+		opts.Passphrase = passphrase
+	}
+
+	if err := openDatabase(config.Load()); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	path := *output
+	if path == "" {
+		path = "mailman-backup-" + time.Now().Format("20060102-150405") + ".jsonl.gz"
+		if *encrypt {
+			path += ".enc"
+		}
+	}
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	manifest, err := backup.Create(ctx, database.GetDB(), buffered, opts)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		if path != "-" {
+			os.Remove(path)
+		}
+		return err
+	}
+
+	if path != "-" {
+		fmt.Fprintf(os.Stderr, "备份已写入 %s\n", path)
+	}
+	if !*encrypt {
+		fmt.Fprintln(os.Stderr, "注意：快照未加密，其中包含邮箱密码等凭据，请妥善保管")
+	}
+	printCounts(manifest.Counts)
+	return nil
+}
+
+// runRestore 实现 mailman restore 子命令
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	replace := fs.Bool("replace", false, "清空现有数据后再恢复（包括快照中不包含的邮件）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使用方法: mailman restore [-replace] <快照文件|->")
+		fmt.Fprintln(fs.Output(), "恢复到 DB_DRIVER 等环境变量指定的数据库，可以与创建快照时的数据库类型不同。")
+		fmt.Fprintln(fs.Output(), "加密快照的口令取自 "+backupPassphraseEnv+" 或交互输入")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("missing snapshot file")
+	}
+	path := fs.Arg(0)
+
+	cfg := config.Load()
+	if err := openDatabase(cfg); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := backup.RestoreOptions{
+		Passphrase:           os.Getenv(backupPassphraseEnv),
+		Replace:              *replace,
+		IndexAttachmentNames: cfg.Search.IndexAttachmentNames,
+	}
+	manifest, err := restoreFile(ctx, path, opts)
+	if errors.Is(err, backup.ErrPassphraseRequired) && path != "-" && term.IsTerminal(int(os.Stdin.Fd())) {
+		if opts.Passphrase, err = backupPassphrase(false); err != nil {
+			return err
+		}
+		manifest, err = restoreFile(ctx, path, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "已恢复 %s 创建的快照（%s，schema 版本 %d）\n",
+		manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), manifest.Driver, manifest.SchemaVersion)
+	printCounts(manifest.Counts)
+	return nil
+}
+
+func restoreFile(ctx context.Context, path string, opts backup.RestoreOptions) (*backup.Manifest, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+	}
+	return backup.Restore(ctx, database.GetDB(), in, opts)
+}
+
+// backupPassphrase 读取快照口令；创建快照时交互输入需要确认一次
+func backupPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(backupPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("set %s to provide the passphrase", backupPassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "快照口令: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("passphrase must not be empty")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "确认口令: ")
+		again, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(passphrase) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return string(passphrase), nil
+}
+
+func printCounts(counts map[string]int64) {
+	tables := make([]string, 0, len(counts))
+	for table := range counts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Fprintf(os.Stderr, "  %-30s %d\n", table, counts[table])
+	}
+}
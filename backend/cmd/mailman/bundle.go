@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"mailman/internal/bundle"
+	"mailman/internal/config"
+	"mailman/internal/database"
+)
+
+// runBundle 实现 mailman bundle 子命令
+func runBundle(args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "使用方法: mailman bundle <export|import> [选项]")
+		fmt.Fprintln(os.Stderr, "  export  把提取模板、触发器、AI 提示词模板和同步配置导出为一个 JSON/YAML 文件")
+		fmt.Fprintln(os.Stderr, "  import  导入配置包，对象之间按名称引用")
+	}
+	if len(args) == 0 {
+		usage()
+		return fmt.Errorf("missing action")
+	}
+	switch args[0] {
+	case "export":
+		return runBundleExport(args[1:])
+	case "import":
+		return runBundleImport(args[1:])
+	default:
+		usage()
+		return fmt.Errorf("unknown action %q", args[0])
+	}
+}
+
+func runBundleExport(args []string) error {
+	fs := flag.NewFlagSet("bundle export", flag.ContinueOnError)
+	var (
+		output = fs.String("o", "-", "输出文件，- 表示标准输出")
+		format = fs.String("format", "", "json 或 yaml，默认按输出文件扩展名，标准输出为 json")
+		kinds  = fs.String("kinds", "", "只导出这些类型，逗号分隔：extractor_template,trigger,prompt_template,sync_config")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使用方法: mailman bundle export [-o 文件] [-format json|yaml] [-kinds 类型,...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	selected, err := bundle.ParseKinds(*kinds)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = bundle.FormatJSON
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".yaml" || ext == ".yml" {
+			*format = bundle.FormatYAML
+		}
+	}
+	if *format != bundle.FormatJSON && *format != bundle.FormatYAML {
+		return fmt.Errorf("-format must be json or yaml")
+	}
+
+	if err := openDatabase(config.Load()); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	b, err := bundle.Export(database.GetDB(), bundle.ExportOptions{Kinds: selected})
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+	if err := bundle.Encode(buffered, b, *format); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "已导出 %d 个提取模板、%d 个触发器、%d 个提示词模板、%d 个同步配置\n",
+		len(b.ExtractorTemplates), len(b.Triggers), len(b.PromptTemplates), len(b.SyncConfigs))
+	return nil
+}
+
+func runBundleImport(args []string) error {
+	fs := flag.NewFlagSet("bundle import", flag.ContinueOnError)
+	var (
+		mode    = fs.String("mode", bundle.ConflictSkip, "目标中已有且内容不同的对象：skip 保留、overwrite 覆盖、rename 以新名称导入")
+		dryRun  = fs.Bool("dry-run", false, "只列出变更和字段差异，不写入")
+		force   = fs.Bool("force", false, "覆盖提取模板时即使测试用例回归也照样写入")
+		asJSON  = fs.Bool("json", false, "以 JSON 输出变更")
+		verbose = fs.Bool("v", false, "列出每个字段的新旧值")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使用方法: mailman bundle import [-mode skip|overwrite|rename] [-dry-run] [-force] <配置包|->")
+		fmt.Fprintln(fs.Output(), "配置包可以是 JSON 或 YAML；导入到正在运行的服务的数据库后，需要重启服务才能生效")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("missing bundle file")
+	}
+
+	var in io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	b, err := bundle.Decode(in)
+	if err != nil {
+		return err
+	}
+
+	if err := openDatabase(config.Load()); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	result, err := bundle.Import(database.GetDB(), b, bundle.ImportOptions{Mode: *mode, DryRun: *dryRun, Force: *force})
+	if result != nil {
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(result)
+		} else {
+			printImportResult(result, *verbose)
+		}
+	}
+	if errors.Is(err, bundle.ErrUnresolved) {
+		return fmt.Errorf("%w, nothing was imported", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case result.DryRun:
+		fmt.Fprintln(os.Stderr, "试运行，未写入任何内容")
+	case len(result.Triggers) > 0 || len(result.SyncAccounts) > 0:
+		fmt.Fprintln(os.Stderr, "已导入；正在运行的服务需要重启才能加载导入的触发器和同步配置")
+	default:
+		fmt.Fprintln(os.Stderr, "已导入")
+	}
+	return nil
+}
+
+// printImportResult prints one line per change, followed by its diff
+func printImportResult(result *bundle.ImportResult, verbose bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tKIND\tNAME\tDETAILS")
+	for _, change := range result.Changes {
+		action, details := change.Action, change.Reason
+		switch {
+		case change.Error != "":
+			action, details = "error", change.Error
+		case change.NewName != "":
+			details = "as " + change.NewName
+		}
+		if len(change.Diff) > 0 {
+			fields := make([]string, len(change.Diff))
+			for i, diff := range change.Diff {
+				fields[i] = diff.Field
+			}
+			details = strings.TrimSpace(details + " (" + strings.Join(fields, ", ") + " differ)")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", action, change.Kind, change.Name, details)
+		for _, warning := range change.Warnings {
+			fmt.Fprintf(w, "\t\t\twarning: %s\n", warning)
+		}
+		if verbose {
+			for _, diff := range change.Diff {
+				fmt.Fprintf(w, "\t\t\t%s: %s -> %s\n", diff.Field, compactJSON(diff.Current), compactJSON(diff.Incoming))
+			}
+		}
+	}
+	w.Flush()
+}
+
+func compactJSON(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"mailman/internal/config"
+	"mailman/internal/database"
+	"mailman/internal/secrets"
+)
+
+// command 是 mailman 的命令行子命令
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands 按名称注册的子命令；不带子命令时启动 API 服务
+var commands = map[string]command{
+	"backup":  {usage: "write a snapshot of accounts, configs and optionally emails", run: runBackup},
+	"bundle":  {usage: "export or import templates, triggers and sync configs as a bundle", run: runBundle},
+	"export":  {usage: "export emails as mbox, EML zip or JSONL", run: runExport},
+	"migrate": {usage: "apply, roll back or list schema migrations", run: runMigrate},
+	"restore": {usage: "restore a snapshot, also into another database driver", run: runRestore},
+	"secrets": {usage: "rotate the master key that encrypts stored credentials", run: runSecrets},
+}
+
+// databaseConfig 由应用配置生成数据库连接配置
+func databaseConfig(cfg *config.Config) database.Config {
+	return database.Config{
+		Driver:      cfg.Database.Driver,
+		Host:        cfg.Database.Host,
+		Port:        cfg.Database.Port,
+		User:        cfg.Database.User,
+		Password:    cfg.Database.Password,
+		DBName:      cfg.Database.DBName,
+		SSLMode:     cfg.Database.SSLMode,
+		AutoMigrate: cfg.Database.AutoMigrate,
+	}
+}
+
+// configureSecrets 加载加密数据库中凭据的主密钥，必须在连接数据库之前调用
+func configureSecrets(cfg *config.Config) error {
+	if err := secrets.Configure(cfg.Secrets.MasterKey, cfg.Secrets.MasterKeyFile); err != nil {
+		return fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	return nil
+}
+
+// openDatabase 按环境变量配置连接数据库
+func openDatabase(cfg *config.Config) error {
+	if err := configureSecrets(cfg); err != nil {
+		return err
+	}
+	dbConfig := databaseConfig(cfg)
+	dbConfig.Quiet = true
+	if err := database.Initialize(dbConfig); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	return nil
+}
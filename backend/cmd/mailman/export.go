@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"mailman/internal/config"
+	"mailman/internal/database"
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/services"
+)
+
+// runExport 实现 mailman export 子命令
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var (
+		format      = fs.String("format", "mbox", "导出格式：mbox、eml（zip）或 jsonl")
+		output      = fs.String("o", "", "输出文件，默认写到标准输出")
+		query       = fs.String("q", "", "Gmail 风格的搜索语句，例如 from:github newer_than:30d")
+		keyword     = fs.String("keyword", "", "全文搜索关键词")
+		accountID   = fs.Uint("account", 0, "账户ID")
+		mailbox     = fs.String("mailbox", "", "邮箱文件夹")
+		startDate   = fs.String("start", "", "开始日期（RFC3339 或 2006-01-02）")
+		endDate     = fs.String("end", "", "结束日期（RFC3339 或 2006-01-02）")
+		extractorID = fs.Uint("extractor-template", 0, "JSONL 导出时附带该提取器模板的提取结果")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使用方法: mailman export -format=<mbox|eml|jsonl> [-o 文件] [过滤条件]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	exportFormat := models.ExportFormat(*format)
+	if !services.IsValidExportFormat(exportFormat) {
+		return fmt.Errorf("unsupported format %q, expected mbox, eml or jsonl", *format)
+	}
+
+	filter := models.ExportFilter{
+		AccountID:   *accountID,
+		MailboxName: *mailbox,
+		Query:       *query,
+		Keyword:     *keyword,
+	}
+	var err error
+	if filter.StartDate, err = parseCLIDate(*startDate); err != nil {
+		return err
+	}
+	if filter.EndDate, err = parseCLIDate(*endDate); err != nil {
+		return err
+	}
+	if *extractorID > 0 {
+		id := *extractorID
+		filter.ExtractorTemplateID = &id
+	}
+
+	if err := openDatabase(config.Load()); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	db := database.GetDB()
+	exporter := services.NewEmailExporter(repository.NewEmailRepository(db), repository.NewExtractorTemplateRepository(db))
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	count, err := exporter.Export(ctx, buffered, exportFormat, filter, func(n int64) {
+		fmt.Fprintf(os.Stderr, "\r已导出 %d 封邮件", n)
+	})
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "\r导出完成：%d 封邮件\n", count)
+	return nil
+}
+
+// parseCLIDate 解析命令行中的日期，空字符串返回 nil
+func parseCLIDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid date %q, expected RFC3339 or 2006-01-02", value)
+}
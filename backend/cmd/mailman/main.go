@@ -34,6 +34,17 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
+	// 子命令（mailman export ...）在启动服务之前处理
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "mailman %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// Initialize logger with configured log level
 	logLevel := os.Getenv("LOG_LEVEL")
 	if logLevel == "" {
@@ -47,17 +58,11 @@ func main() {
 	cfg := config.Load()
 
 	// Initialize database
-	dbConfig := database.Config{
-		Driver:   cfg.Database.Driver,
-		Host:     cfg.Database.Host,
-		Port:     cfg.Database.Port,
-		User:     cfg.Database.User,
-		Password: cfg.Database.Password,
-		DBName:   cfg.Database.DBName,
-		SSLMode:  cfg.Database.SSLMode,
+	if err := configureSecrets(cfg); err != nil {
+		mainLogger.Error("%v", err)
+		log.Fatalf("%v", err)
 	}
-
-	if err := database.Initialize(dbConfig); err != nil {
+	if err := database.Initialize(databaseConfig(cfg)); err != nil {
 		mainLogger.Error("Failed to initialize database: %v", err)
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -65,10 +70,18 @@ func main() {
 
 	db := database.GetDB()
 
+	// 提取器和触发条件的 JavaScript 共用一个受限的脚本运行时
+	services.ConfigureScriptRuntime(services.ScriptLimits{
+		WallTime:         time.Duration(cfg.Scripts.WallTimeMillis) * time.Millisecond,
+		HeapCeilingBytes: uint64(cfg.Scripts.HeapCeilingMB) << 20,
+		OutputBytes:      cfg.Scripts.OutputKB << 10,
+	}, cfg.Scripts.PoolSize)
+
 	// Initialize repositories
 	mailProviderRepo := repository.NewMailProviderRepository(db)
 	emailAccountRepo := repository.NewEmailAccountRepository(db)
 	emailRepo := repository.NewEmailRepository(db)
+	emailRepo.SearchIndex().SetIncludeAttachmentNames(cfg.Search.IndexAttachmentNames)
 	incrementalSyncRepo := repository.NewIncrementalSyncRepository(db)
 	extractorTemplateRepo := repository.NewExtractorTemplateRepository(db)
 	openAIConfigRepo := repository.NewOpenAIConfigRepository(db)
@@ -81,6 +94,12 @@ func main() {
 	triggerLogRepo := repository.NewTriggerExecutionLogRepository(db)
 	oauth2GlobalConfigRepo := repository.NewOAuth2GlobalConfigRepository(db)
 	oauth2AuthSessionRepo := repository.NewOAuth2AuthSessionRepository(db)
+	savedSearchRepo := repository.NewSavedSearchRepository(db)
+	retentionPolicyRepo := repository.NewRetentionPolicyRepository(db)
+	exportJobRepo := repository.NewExportJobRepository(db)
+	tagRepo := repository.NewTagRepository(db)
+	contactRepo := repository.NewContactRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
 
 	// Seed default mail providers
 	if err := mailProviderRepo.SeedDefaultProviders(); err != nil {
@@ -88,6 +107,38 @@ func main() {
 	}
 
 	// Initialize services with repositories
+	// 为尚未建立索引的历史邮件补建全文索引
+	go func() {
+		indexed, err := emailRepo.SearchIndex().Backfill(cfg.Search.BackfillBatchSize)
+		if err != nil {
+			mainLogger.Warn("Failed to backfill search index: %v", err)
+			return
+		}
+		if indexed > 0 {
+			mainLogger.Info("Search index backfilled with %d emails", indexed)
+		}
+	}()
+
+	// 为通讯录补建历史邮件中出现过的联系人
+	go func() {
+		created, err := contactRepo.Backfill(500)
+		if err != nil {
+			mainLogger.Warn("Failed to backfill contacts: %v", err)
+			return
+		}
+		if created > 0 {
+			mainLogger.Info("Contacts backfilled with %d addresses", created)
+		}
+	}()
+
+	// 内置提取器版本变化后重新运行提取模板的回归测试用例
+	go func() {
+		suiteService := services.NewExtractorSuiteService(repository.NewExtractorFixtureRepository(db), extractorTemplateRepo, emailRepo)
+		if err := suiteService.RunAfterBuiltinUpgrade(); err != nil {
+			mainLogger.Warn("Failed to rerun extractor suites: %v", err)
+		}
+	}()
+
 	fetcherService := services.NewFetcherService(emailAccountRepo, emailRepo)
 	parserService := services.NewParserService()
 	authService := services.NewAuthService(userRepo, userSessionRepo)
@@ -121,11 +172,41 @@ func main() {
 
 	// Initialize trigger service
 	mainLogger.Info("正在初始化触发器服务...")
-	triggerService := services.NewTriggerService(triggerRepo, triggerLogRepo, emailRepo, subscriptionManager)
+	extractedValueService := services.NewExtractedValueService(repository.NewExtractedValueRepository(db), extractorTemplateRepo, emailRepo)
+	triggerLedgerRepo := repository.NewTriggerLedgerRepository(db)
+	triggerService := services.NewTriggerService(triggerRepo, triggerLogRepo, triggerLedgerRepo, emailRepo, tagRepo, extractedValueService, subscriptionManager)
 	if err := triggerService.Start(); err != nil {
 		mainLogger.Error("Failed to start trigger service: %v", err)
 		log.Fatalf("Failed to start trigger service: %v", err)
 	}
+	repository.OnEmailsStored(triggerService.Wake)
+
+	// Initialize retention service
+	retentionService := services.NewRetentionService(retentionPolicyRepo, emailRepo, triggerLogRepo, time.Duration(cfg.Retention.CheckIntervalMinutes)*time.Minute)
+	if cfg.Retention.Enabled {
+		retentionService.Start()
+	}
+
+	// Initialize attachment text extraction
+	attachmentTextService := services.NewAttachmentTextService(attachmentRepo, emailRepo,
+		time.Duration(cfg.Attachments.TextIntervalSeconds)*time.Second, cfg.Attachments.TextBatchSize, cfg.Attachments.TextMaxBytes)
+	if cfg.Attachments.TextExtraction {
+		repository.OnAttachmentsStored(attachmentTextService.Wake)
+		attachmentTextService.Start()
+	}
+
+	// Initialize extraction pipelines
+	extractionPipelineRepo := repository.NewExtractionPipelineRepository(db)
+	extractionPipelineService := services.NewExtractionPipelineService(extractionPipelineRepo, extractedValueService, emailRepo)
+	repository.OnEmailsStored(extractionPipelineService.Wake)
+	extractionPipelineService.Start()
+
+	// Initialize export service
+	exporter := services.NewEmailExporter(emailRepo, extractorTemplateRepo)
+	exportService := services.NewExportService(exportJobRepo, exporter, cfg.Export.Dir, time.Duration(cfg.Export.FileTTLHours)*time.Hour)
+	if err := exportService.Start(); err != nil {
+		mainLogger.Warn("Failed to start export service: %v", err)
+	}
 
 	// Initialize API handler
 	apiHandler := api.NewAPIHandler(fetcherService, parserService, emailAccountRepo, mailProviderRepo, emailRepo, incrementalSyncRepo, emailFetchScheduler)
@@ -143,7 +224,16 @@ func main() {
 	sessionHandler := api.NewSessionHandler(authService)
 
 	// Initialize Trigger handler
-	triggerHandler := api.NewTriggerAPIHandler(triggerService, triggerRepo, triggerLogRepo)
+	triggerHandler := api.NewTriggerAPIHandler(triggerService, triggerRepo, triggerLogRepo, triggerLedgerRepo)
+	savedSearchHandler := api.NewSavedSearchHandler(savedSearchRepo, emailRepo)
+	retentionHandler := api.NewRetentionHandler(retentionPolicyRepo, retentionService)
+	exportHandler := api.NewExportHandler(exportService, exportJobRepo, cfg.Export.SyncLimit)
+	tagHandler := api.NewTagHandler(tagRepo, emailRepo)
+	contactHandler := api.NewContactHandler(contactRepo)
+	attachmentHandler := api.NewAttachmentHandler(attachmentRepo, attachmentTextService)
+	backupHandler := api.NewBackupHandler(db, cfg.Search.IndexAttachmentNames)
+	bundleHandler := api.NewBundleHandler(db, triggerService, incrementalSyncManager)
+	extractionPipelineHandler := api.NewExtractionPipelineHandler(extractionPipelineRepo, extractorTemplateRepo, extractionPipelineService)
 
 	// Initialize OAuth2 handler
 	oauth2Handler := api.NewOAuth2Handler(oauth2ConfigService, oauth2Service, oauth2AuthSessionService)
@@ -154,7 +244,7 @@ func main() {
 	}
 
 	// Create router with authentication
-	router := api.NewRouterWithAuth(apiHandler, openAIHandler, authHandler, syncHandlers, sessionHandler, triggerHandler, oauth2Handler, authService)
+	router := api.NewRouterWithAuth(apiHandler, openAIHandler, authHandler, syncHandlers, sessionHandler, triggerHandler, savedSearchHandler, retentionHandler, exportHandler, tagHandler, contactHandler, attachmentHandler, backupHandler, bundleHandler, extractionPipelineHandler, oauth2Handler, authService)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -185,6 +275,26 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Stop retention job
+	if cfg.Retention.Enabled {
+		mainLogger.Info("Stopping retention job...")
+		retentionService.Stop()
+	}
+
+	// Stop attachment text extraction
+	if cfg.Attachments.TextExtraction {
+		mainLogger.Info("Stopping attachment text extraction...")
+		attachmentTextService.Stop()
+	}
+
+	// Stop extraction pipelines
+	mainLogger.Info("Stopping extraction pipelines...")
+	extractionPipelineService.Stop()
+
+	// Stop export jobs
+	mainLogger.Info("Stopping export service...")
+	exportService.Stop()
+
 	// Stop activity logger
 	mainLogger.Info("Stopping activity logger...")
 	activityLogger.Stop()
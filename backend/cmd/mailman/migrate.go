@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"mailman/internal/config"
+	"mailman/internal/database"
+)
+
+// runMigrate 实现 mailman migrate 子命令
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "down 时回滚的迁移数")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使用方法: mailman migrate <up|down|status> [-steps N]")
+		fmt.Fprintln(fs.Output(), "  up      执行所有未执行的迁移")
+		fmt.Fprintln(fs.Output(), "  down    回滚最近执行的迁移")
+		fmt.Fprintln(fs.Output(), "  status  列出迁移及其执行状态")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing action")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg := config.Load()
+	if err := configureSecrets(cfg); err != nil {
+		return err
+	}
+	dbConfig := databaseConfig(cfg)
+	dbConfig.Quiet = true
+	dbConfig.SkipMigrations = true
+	if err := database.Initialize(dbConfig); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer database.Close()
+
+	migrator := database.NewMigrator(database.GetDB())
+	switch action {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied  %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return nil
+
+	case "down":
+		if *steps <= 0 {
+			return fmt.Errorf("-steps must be positive")
+		}
+		rolledBack, err := migrator.Down(*steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("no migrations to roll back")
+		}
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown action %q", action)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"mailman/internal/config"
+	"mailman/internal/database"
+	"mailman/internal/secrets"
+)
+
+// runSecrets 实现 mailman secrets 子命令。轮换主密钥的步骤：
+//  1. mailman secrets generate-key 生成新密钥
+//  2. 把新密钥放在 SECRETS_MASTER_KEY（或密钥文件）的第一项，保留旧密钥
+//  3. mailman secrets rotate 用新密钥重新包装所有数据密钥
+//  4. mailman secrets status 确认没有值再使用旧密钥后，删除旧密钥
+func runSecrets(args []string) error {
+	fs := flag.NewFlagSet("secrets", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使用方法: mailman secrets <generate-key|status|rotate>")
+		fmt.Fprintln(fs.Output(), "  generate-key  生成新的主密钥")
+		fmt.Fprintln(fs.Output(), "  status        按主密钥统计已加密的凭据")
+		fmt.Fprintln(fs.Output(), "  rotate        用当前主密钥（第一项）重新加密所有凭据")
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing action")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch action {
+	case "generate-key":
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+
+	case "status", "rotate":
+		if err := openDatabase(config.Load()); err != nil {
+			return err
+		}
+		defer database.Close()
+
+		if action == "rotate" {
+			rotated, err := database.RotateSecrets()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("re-encrypted %d values with master key %s\n", rotated, secrets.Default().ActiveKeyID())
+		}
+
+		usage, err := database.SecretKeyUsage()
+		if err != nil {
+			return err
+		}
+		keyIDs := make([]string, 0, len(usage))
+		for keyID := range usage {
+			keyIDs = append(keyIDs, keyID)
+		}
+		sort.Strings(keyIDs)
+		fmt.Printf("active master key: %s\n", secrets.Default().ActiveKeyID())
+		for _, keyID := range keyIDs {
+			label := keyID
+			if label == "" {
+				label = "(plaintext)"
+			}
+			fmt.Printf("  %-12s %d values\n", label, usage[keyID])
+		}
+		return nil
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown action %q", action)
+}
@@ -13,6 +13,7 @@ import (
 	"mailman/internal/database"
 	"mailman/internal/models"
 	"mailman/internal/repository"
+	"mailman/internal/secrets"
 
 	"golang.org/x/term"
 )
@@ -48,6 +49,9 @@ func main() {
 
 	// 加载配置
 	cfg := config.Load()
+	if err := secrets.Configure(cfg.Secrets.MasterKey, cfg.Secrets.MasterKeyFile); err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
 
 	// 初始化数据库
 	dbConfig := database.Config{
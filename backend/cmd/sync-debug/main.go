@@ -7,6 +7,7 @@ import (
 	"mailman/internal/config"
 	"mailman/internal/database"
 	"mailman/internal/repository"
+	"mailman/internal/secrets"
 )
 
 func main() {
@@ -14,6 +15,9 @@ func main() {
 
 	// 初始化配置和数据库
 	cfg := config.Load()
+	if err := secrets.Configure(cfg.Secrets.MasterKey, cfg.Secrets.MasterKeyFile); err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
 	err := database.Initialize(database.Config{
 		Driver:   cfg.Database.Driver,
 		Host:     cfg.Database.Host,
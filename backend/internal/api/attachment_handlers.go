@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mailman/internal/repository"
+	"mailman/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// AttachmentHandler handles attachment text extraction API requests
+type AttachmentHandler struct {
+	attachmentRepo *repository.AttachmentRepository
+	textService    *services.AttachmentTextService
+}
+
+// NewAttachmentHandler creates a new attachment handler
+func NewAttachmentHandler(attachmentRepo *repository.AttachmentRepository, textService *services.AttachmentTextService) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentRepo: attachmentRepo,
+		textService:    textService,
+	}
+}
+
+// AttachmentTextResponse is the extracted text of an attachment
+type AttachmentTextResponse struct {
+	ID          uint       `json:"id"`
+	EmailID     uint       `json:"email_id"`
+	Filename    string     `json:"filename"`
+	MIMEType    string     `json:"mime_type"`
+	Status      string     `json:"status" example:"done"` // 空表示尚未处理，done、unsupported 或 failed
+	Error       string     `json:"error,omitempty"`
+	Text        string     `json:"text"`
+	ExtractedAt *time.Time `json:"extracted_at,omitempty"`
+}
+
+// GetAttachmentTextHandler returns the extracted text of an attachment
+// @Summary Get attachment text
+// @Description Get the text extracted from a PDF, CSV, DOCX, XLSX or text attachment
+// @Tags attachments
+// @Produce json
+// @Param id path int true "Attachment ID"
+// @Success 200 {object} AttachmentTextResponse
+// @Failure 404 {string} string "Attachment not found"
+// @Router /api/attachments/{id}/text [get]
+func (h *AttachmentHandler) GetAttachmentTextHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+	attachment, err := h.attachmentRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AttachmentTextResponse{
+		ID:          attachment.ID,
+		EmailID:     attachment.EmailID,
+		Filename:    attachment.Filename,
+		MIMEType:    attachment.MIMEType,
+		Status:      attachment.TextStatus,
+		Error:       attachment.TextError,
+		Text:        attachment.Text,
+		ExtractedAt: attachment.TextExtractedAt,
+	})
+}
+
+// GetAttachmentTextStatsHandler counts attachments by extraction state
+// @Summary Attachment text extraction progress
+// @Description Count attachments that are pending, extracted, unsupported or failed
+// @Tags attachments
+// @Produce json
+// @Success 200 {object} repository.AttachmentTextStats
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /api/attachments/text/stats [get]
+func (h *AttachmentHandler) GetAttachmentTextStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.textService.Stats()
+	if err != nil {
+		http.Error(w, "Failed to count attachments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// RetryAttachmentTextHandler queues failed attachments for extraction again
+// @Summary Retry failed attachment text extraction
+// @Description Mark attachments whose text extraction failed as pending, they are processed in the background
+// @Tags attachments
+// @Produce json
+// @Success 200 {object} map[string]int64
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /api/attachments/text/retry [post]
+func (h *AttachmentHandler) RetryAttachmentTextHandler(w http.ResponseWriter, r *http.Request) {
+	reset, err := h.textService.Retry()
+	if err != nil {
+		http.Error(w, "Failed to retry attachments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"queued": reset})
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"mailman/internal/backup"
+
+	"gorm.io/gorm"
+)
+
+// BackupHandler handles the backup and restore admin API
+type BackupHandler struct {
+	db                   *gorm.DB
+	indexAttachmentNames bool
+}
+
+// NewBackupHandler creates a new backup handler. indexAttachmentNames follows
+// SEARCH_INDEX_ATTACHMENT_NAMES and is used to rebuild the search index after a restore.
+func NewBackupHandler(db *gorm.DB, indexAttachmentNames bool) *BackupHandler {
+	return &BackupHandler{db: db, indexAttachmentNames: indexAttachmentNames}
+}
+
+// RestoreResponse describes a completed restore
+type RestoreResponse struct {
+	Manifest *backup.Manifest `json:"manifest"`
+	Message  string           `json:"message"`
+}
+
+// CreateBackupHandler streams a snapshot of the database
+// @Summary Create a backup
+// @Description Stream a consistent, gzip compressed snapshot of accounts, configs, templates, triggers and sync state, optionally with emails and attachments. Without a passphrase the snapshot contains stored credentials in plain text.
+// @Tags admin
+// @Accept json
+// @Produce application/gzip
+// @Param request body backup.Options false "Snapshot options"
+// @Success 200 {file} file "Snapshot"
+// @Failure 400 {object} ErrorResponse
+// @Router /api/admin/backup [post]
+func (h *BackupHandler) CreateBackupHandler(w http.ResponseWriter, r *http.Request) {
+	var opts backup.Options
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	filename := "mailman-backup-" + time.Now().Format("20060102-150405") + ".jsonl.gz"
+	if opts.Passphrase != "" {
+		filename += ".enc"
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// 响应头已经发出，失败时只能中断下载；快照末尾的计数可以让恢复时发现不完整的文件
+	if _, err := backup.Create(r.Context(), h.db, w, opts); err != nil {
+		log.Printf("[Backup] Failed to write snapshot: %v", err)
+	}
+}
+
+// RestoreBackupHandler restores a snapshot uploaded as the request body
+// @Summary Restore a backup
+// @Description Restore a snapshot created by mailman backup or POST /api/admin/backup, also from another database driver. Unless replace is set the database must be empty. Restart the service afterwards so that schedulers and caches pick up the restored data.
+// @Tags admin
+// @Accept application/octet-stream
+// @Produce json
+// @Param replace query bool false "Delete the existing data, including emails not in the snapshot, before restoring"
+// @Param X-Backup-Passphrase header string false "Passphrase of an encrypted snapshot"
+// @Success 200 {object} RestoreResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The database is not empty"
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/restore [post]
+func (h *BackupHandler) RestoreBackupHandler(w http.ResponseWriter, r *http.Request) {
+	opts := backup.RestoreOptions{
+		Passphrase:           r.Header.Get("X-Backup-Passphrase"),
+		Replace:              r.URL.Query().Get("replace") == "true",
+		IndexAttachmentNames: h.indexAttachmentNames,
+	}
+
+	manifest, err := backup.Restore(r.Context(), h.db, r.Body, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, backup.ErrNotEmpty):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, backup.ErrPassphraseRequired), errors.Is(err, backup.ErrWrongPassphrase), errors.Is(err, backup.ErrTruncated):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to restore backup: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RestoreResponse{
+		Manifest: manifest,
+		Message:  "Backup restored, restart the service to reload schedulers and caches",
+	})
+}
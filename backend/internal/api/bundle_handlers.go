@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"mailman/internal/bundle"
+	"mailman/internal/repository"
+	"mailman/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// BundleHandler handles the export and import of configuration bundles
+type BundleHandler struct {
+	db             *gorm.DB
+	triggerService *services.TriggerService
+	syncManager    services.SyncManager
+	syncConfigRepo *repository.SyncConfigRepository
+}
+
+// NewBundleHandler creates a new bundle handler. Imported triggers and sync
+// configs are handed to the trigger service and the sync manager, so that
+// they take effect without a restart.
+func NewBundleHandler(db *gorm.DB, triggerService *services.TriggerService, syncManager services.SyncManager) *BundleHandler {
+	return &BundleHandler{
+		db:             db,
+		triggerService: triggerService,
+		syncManager:    syncManager,
+		syncConfigRepo: repository.NewSyncConfigRepository(db),
+	}
+}
+
+// BundleImportErrorResponse is returned when entries of a bundle cannot be imported
+type BundleImportErrorResponse struct {
+	Error  string               `json:"error"`
+	Result *bundle.ImportResult `json:"result"`
+}
+
+// ExportBundleHandler exports the configuration as a bundle
+// @Summary Export a configuration bundle
+// @Description Export extractor templates, triggers, AI prompt templates and sync configs as one JSON or YAML document. Objects refer to each other by name, so the bundle can be imported into another installation.
+// @Tags admin
+// @Produce json
+// @Produce application/yaml
+// @Param format query string false "json (default) or yaml"
+// @Param kinds query string false "Comma separated kinds to export: extractor_template, trigger, prompt_template, sync_config"
+// @Success 200 {object} bundle.Bundle
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/bundle [get]
+func (h *BundleHandler) ExportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = bundle.FormatJSON
+	}
+	if format != bundle.FormatJSON && format != bundle.FormatYAML {
+		http.Error(w, "format must be json or yaml", http.StatusBadRequest)
+		return
+	}
+	kinds, err := bundle.ParseKinds(r.URL.Query().Get("kinds"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := bundle.Export(h.db, bundle.ExportOptions{Kinds: kinds})
+	if err != nil {
+		http.Error(w, "Failed to export bundle: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := "mailman-bundle-" + time.Now().Format("20060102-150405") + "." + format
+	if format == bundle.FormatYAML {
+		w.Header().Set("Content-Type", "application/yaml")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := bundle.Encode(w, b, format); err != nil {
+		log.Printf("[Bundle] Failed to write bundle: %v", err)
+	}
+}
+
+// ImportBundleHandler imports a bundle uploaded as the request body
+// @Summary Import a configuration bundle
+// @Description Import a bundle written by GET /api/admin/bundle or mailman bundle export, as JSON or YAML. References are resolved by name in this installation. Objects that exist with different content are skipped, overwritten or imported under a new name depending on mode. With dry_run the changes, including a field diff, are returned without writing anything.
+// @Tags admin
+// @Accept json
+// @Accept application/yaml
+// @Produce json
+// @Param mode query string false "Conflict mode: skip (default), overwrite or rename"
+// @Param dry_run query bool false "Only report the changes"
+// @Param force query bool false "Overwrite extractor templates even when their fixtures regress"
+// @Param resume query string false "Triggers enabled by the import: skip (default) starts after the newest email, backfill evaluates the emails stored since their cursor"
+// @Success 200 {object} bundle.ImportResult
+// @Failure 400 {object} BundleImportErrorResponse "Entries of the bundle cannot be imported"
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/bundle/import [post]
+func (h *BundleHandler) ImportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := bundle.Decode(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resume, err := services.ParseTriggerResume(r.URL.Query().Get("resume"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := bundle.ImportOptions{
+		Mode:   r.URL.Query().Get("mode"),
+		DryRun: r.URL.Query().Get("dry_run") == "true",
+		Force:  r.URL.Query().Get("force") == "true",
+	}
+	result, err := bundle.Import(h.db, b, opts)
+	switch {
+	case errors.Is(err, bundle.ErrUnresolved):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BundleImportErrorResponse{Error: err.Error(), Result: result})
+		return
+	case err != nil && result == nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to import bundle: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.reload(result, resume)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// reload hands imported triggers and sync configs to the running services
+func (h *BundleHandler) reload(result *bundle.ImportResult, resume services.TriggerResume) {
+	for _, id := range result.Triggers {
+		if err := h.triggerService.ReloadTrigger(id, resume); err != nil {
+			log.Printf("[Bundle] Failed to reload trigger %d: %v", id, err)
+		}
+	}
+	for _, accountID := range result.SyncAccounts {
+		config, err := h.syncConfigRepo.GetByAccountID(accountID)
+		if err == nil {
+			err = h.syncManager.UpdateSubscription(accountID, config)
+		}
+		if err != nil {
+			log.Printf("[Bundle] Failed to update sync subscription of account %d: %v", accountID, err)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/vcard"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxContactPageSize limits the contacts returned by one list request
+	maxContactPageSize = 500
+	// maxVCardUpload limits the size of an imported vCard file
+	maxVCardUpload = 10 << 20
+)
+
+// ContactHandler handles contacts directory API requests
+type ContactHandler struct {
+	contactRepo *repository.ContactRepository
+}
+
+// NewContactHandler creates a new contact handler
+func NewContactHandler(contactRepo *repository.ContactRepository) *ContactHandler {
+	return &ContactHandler{contactRepo: contactRepo}
+}
+
+// ContactListResponse is a page of contacts
+type ContactListResponse struct {
+	Contacts []models.Contact `json:"contacts"`
+	Total    int64            `json:"total"`
+	Limit    int              `json:"limit"`
+	Offset   int              `json:"offset"`
+}
+
+// MergeContactsRequest merges contacts into a target contact
+type MergeContactsRequest struct {
+	TargetID  uint   `json:"target_id"`
+	SourceIDs []uint `json:"source_ids"`
+}
+
+// RebuildContactsResponse reports a rebuild of the contacts directory
+type RebuildContactsResponse struct {
+	Contacts int `json:"contacts"`
+}
+
+// ListContactsHandler lists contacts
+// @Summary List contacts
+// @Description List the contacts derived from the From, To and Cc addresses of stored emails and imported vCards. Use sort=messages for the top correspondents; with account_id the statistics and order are those of one account.
+// @Tags contacts
+// @Produce json
+// @Param q query string false "Substring of an address, name or organization"
+// @Param account_id query int false "Only contacts that exchanged email with this account"
+// @Param sort query string false "messages, from, to, last_seen (default), first_seen or name"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Offset"
+// @Success 200 {object} ContactListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/contacts [get]
+func (h *ContactHandler) ListContactsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseContactFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = 50
+	filter.Offset = 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit > maxContactPageSize {
+			limit = maxContactPageSize
+		}
+		filter.Limit = limit
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	contacts, total, err := h.contactRepo.List(filter)
+	if err != nil {
+		http.Error(w, "Failed to retrieve contacts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if contacts == nil {
+		contacts = []models.Contact{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ContactListResponse{
+		Contacts: contacts,
+		Total:    total,
+		Limit:    filter.Limit,
+		Offset:   filter.Offset,
+	})
+}
+
+// GetContactHandler returns a contact
+// @Summary Get a contact
+// @Description Get a contact with all its addresses and per-account statistics
+// @Tags contacts
+// @Produce json
+// @Param id path int true "Contact ID"
+// @Success 200 {object} models.Contact
+// @Failure 404 {object} ErrorResponse
+// @Router /api/contacts/{id} [get]
+func (h *ContactHandler) GetContactHandler(w http.ResponseWriter, r *http.Request) {
+	contact, ok := h.loadContact(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contact)
+}
+
+// UpdateContactHandler edits a contact
+// @Summary Update a contact
+// @Description Set the name, organization, phone numbers or notes of a contact. An empty name restores the display name used most in emails.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path int true "Contact ID"
+// @Param request body repository.ContactUpdate true "Changed fields"
+// @Success 200 {object} models.Contact
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/contacts/{id} [put]
+func (h *ContactHandler) UpdateContactHandler(w http.ResponseWriter, r *http.Request) {
+	contact, ok := h.loadContact(w, r)
+	if !ok {
+		return
+	}
+
+	var req repository.ContactUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.contactRepo.Update(contact.ID, req)
+	if err != nil {
+		http.Error(w, "Failed to update contact: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// MergeContactsHandler merges contacts
+// @Summary Merge contacts
+// @Description Move the addresses of the source contacts to the target contact, for people writing from several addresses. The source contacts are deleted and the statistics recomputed.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body MergeContactsRequest true "Target and source contacts"
+// @Success 200 {object} models.Contact
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/contacts/merge [post]
+func (h *ContactHandler) MergeContactsHandler(w http.ResponseWriter, r *http.Request) {
+	var req MergeContactsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.TargetID == 0 || len(req.SourceIDs) == 0 {
+		http.Error(w, "target_id and source_ids are required", http.StatusBadRequest)
+		return
+	}
+
+	contact, err := h.contactRepo.Merge(req.TargetID, req.SourceIDs)
+	if err != nil {
+		if err.Error() == "contact not found" {
+			http.Error(w, "Contact not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to merge contacts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contact)
+}
+
+// CorrespondentsHandler lists who has emailed an address
+// @Summary Correspondents of an address
+// @Description List the contacts that sent email to an address, for example an alias, or to any address of a domain given as @example.com, with the number of such emails
+// @Tags contacts
+// @Produce json
+// @Param address query string true "Recipient address or @domain"
+// @Param account_id query int false "Only emails of this account"
+// @Param limit query int false "Maximum number of contacts (default 50, max 500)"
+// @Success 200 {array} repository.Correspondent
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/contacts/correspondents [get]
+func (h *ContactHandler) CorrespondentsHandler(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimSpace(r.URL.Query().Get("address"))
+	if address == "" {
+		http.Error(w, "address is required", http.StatusBadRequest)
+		return
+	}
+	var accountID uint
+	if value := r.URL.Query().Get("account_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid account_id", http.StatusBadRequest)
+			return
+		}
+		accountID = uint(id)
+	}
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if parsed > maxContactPageSize {
+			parsed = maxContactPageSize
+		}
+		limit = parsed
+	}
+
+	kind, _ := models.ClassifyAddressPattern(address)
+	if kind == models.AddressPatternSubstring {
+		http.Error(w, "address must be an email address or @domain", http.StatusBadRequest)
+		return
+	}
+
+	correspondents, err := h.contactRepo.Correspondents(address, accountID, limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve correspondents: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(correspondents)
+}
+
+// ExportContactsHandler downloads the contacts directory
+// @Summary Export contacts
+// @Description Download the contacts matching the filter as a vCard 3.0 file or as CSV
+// @Tags contacts
+// @Produce text/vcard,text/csv
+// @Param format query string false "vcard (default) or csv"
+// @Param q query string false "Substring of an address, name or organization"
+// @Param account_id query int false "Only contacts that exchanged email with this account"
+// @Success 200 {file} file "Contacts"
+// @Failure 400 {object} ErrorResponse
+// @Router /api/contacts/export [get]
+func (h *ContactHandler) ExportContactsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseContactFilter(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "vcard"
+	}
+	if format != "vcard" && format != "csv" {
+		http.Error(w, "format must be vcard or csv", http.StatusBadRequest)
+		return
+	}
+
+	filename := "contacts-" + time.Now().Format("20060102") + ".vcf"
+	contentType := "text/vcard; charset=utf-8"
+	if format == "csv" {
+		filename = strings.TrimSuffix(filename, ".vcf") + ".csv"
+		contentType = "text/csv; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var err error
+	if format == "csv" {
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"name", "email", "other_emails", "organization", "phones", "notes", "from_count", "to_count", "message_count", "first_seen_at", "last_seen_at"})
+		err = h.contactRepo.Each(filter, func(contacts []models.Contact) error {
+			for _, contact := range contacts {
+				writer.Write(contactCSVRecord(contact))
+			}
+			writer.Flush()
+			return writer.Error()
+		})
+	} else {
+		err = h.contactRepo.Each(filter, func(contacts []models.Contact) error {
+			cards := make([]vcard.Card, len(contacts))
+			for i, contact := range contacts {
+				cards[i] = contactCard(contact)
+			}
+			return vcard.Write(w, cards)
+		})
+	}
+	// 响应已经开始发送，失败时只能中断下载
+	if err != nil {
+		log.Printf("[Contacts] Failed to export contacts: %v", err)
+	}
+}
+
+// ImportContactsHandler imports a vCard file
+// @Summary Import contacts
+// @Description Import the contacts of a vCard file sent as the request body. Cards are merged into the contact owning one of their addresses.
+// @Tags contacts
+// @Accept text/vcard
+// @Produce json
+// @Success 200 {object} repository.ContactImportResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/contacts/import [post]
+func (h *ContactHandler) ImportContactsHandler(w http.ResponseWriter, r *http.Request) {
+	cards, err := vcard.Parse(http.MaxBytesReader(w, r.Body, maxVCardUpload))
+	if err != nil {
+		http.Error(w, "Invalid vCard file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.contactRepo.ImportCards(cards)
+	if err != nil {
+		http.Error(w, "Failed to import contacts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ImportAttachmentContactsHandler imports the vCards attached to stored emails
+// @Summary Import contacts from attachments
+// @Description Import the vCard attachments of all stored emails. New emails are imported automatically; this covers emails stored before.
+// @Tags contacts
+// @Produce json
+// @Success 200 {object} repository.ContactImportResult
+// @Failure 500 {object} ErrorResponse
+// @Router /api/contacts/import/attachments [post]
+func (h *ContactHandler) ImportAttachmentContactsHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := h.contactRepo.ImportAttachments()
+	if err != nil {
+		http.Error(w, "Failed to import contacts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RebuildContactsHandler recomputes the contacts directory
+// @Summary Rebuild contacts
+// @Description Recompute the statistics of all contacts from the stored emails and create missing contacts. Names, merges and imported details are kept.
+// @Tags contacts
+// @Produce json
+// @Success 200 {object} RebuildContactsResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/contacts/rebuild [post]
+func (h *ContactHandler) RebuildContactsHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := h.contactRepo.Rebuild()
+	if err != nil {
+		http.Error(w, "Failed to rebuild contacts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RebuildContactsResponse{Contacts: count})
+}
+
+// loadContact parses the {id} path parameter and loads the contact, writing an error response on failure
+func (h *ContactHandler) loadContact(w http.ResponseWriter, r *http.Request) (*models.Contact, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid contact ID", http.StatusBadRequest)
+		return nil, false
+	}
+	contact, err := h.contactRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Contact not found", http.StatusNotFound)
+		return nil, false
+	}
+	return contact, true
+}
+
+// parseContactFilter reads the q, account_id and sort query parameters
+func parseContactFilter(w http.ResponseWriter, r *http.Request) (repository.ContactFilter, bool) {
+	query := r.URL.Query()
+	filter := repository.ContactFilter{
+		Query: query.Get("q"),
+		Sort:  query.Get("sort"),
+	}
+	if value := query.Get("account_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid account_id", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.AccountID = uint(id)
+	}
+	if !repository.IsValidContactSort(filter.Sort) {
+		http.Error(w, "sort must be messages, from, to, last_seen, first_seen or name", http.StatusBadRequest)
+		return filter, false
+	}
+	return filter, true
+}
+
+// contactCard converts a contact for vCard export
+func contactCard(contact models.Contact) vcard.Card {
+	return vcard.Card{
+		Name:         contact.Name,
+		Emails:       contactEmails(contact),
+		Phones:       contact.Phones,
+		Organization: contact.Organization,
+		Note:         contact.Notes,
+	}
+}
+
+// contactEmails returns the primary address followed by the other addresses of a contact
+func contactEmails(contact models.Contact) []string {
+	emails := []string{contact.Address}
+	for _, address := range contact.Addresses {
+		if address.Address != contact.Address {
+			emails = append(emails, address.Address)
+		}
+	}
+	return emails
+}
+
+func contactCSVRecord(contact models.Contact) []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	emails := contactEmails(contact)
+	return []string{
+		contact.Name,
+		emails[0],
+		strings.Join(emails[1:], ";"),
+		contact.Organization,
+		strings.Join(contact.Phones, ";"),
+		contact.Notes,
+		strconv.FormatInt(contact.FromCount, 10),
+		strconv.FormatInt(contact.ToCount, 10),
+		strconv.FormatInt(contact.MessageCount, 10),
+		formatTime(contact.FirstSeenAt),
+		formatTime(contact.LastSeenAt),
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/searchquery"
+	"mailman/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ExportHandler handles email export API requests
+type ExportHandler struct {
+	exportService *services.ExportService
+	jobRepo       *repository.ExportJobRepository
+	syncLimit     int
+}
+
+// NewExportHandler creates a new export handler. Exports matching more than
+// syncLimit emails are rejected by the streaming endpoint and must use a job.
+func NewExportHandler(exportService *services.ExportService, jobRepo *repository.ExportJobRepository, syncLimit int) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		jobRepo:       jobRepo,
+		syncLimit:     syncLimit,
+	}
+}
+
+// ExportRequest is the body for creating an export job
+type ExportRequest struct {
+	Format models.ExportFormat `json:"format" example:"mbox"`
+	models.ExportFilter
+}
+
+// validateExport checks the format and the search query of an export
+func validateExport(w http.ResponseWriter, format models.ExportFormat, filter models.ExportFilter) bool {
+	if !services.IsValidExportFormat(format) {
+		http.Error(w, "Invalid format, expected mbox, eml or jsonl", http.StatusBadRequest)
+		return false
+	}
+	if filter.ExtractorTemplateID != nil && format != models.ExportFormatJSONL {
+		http.Error(w, "extractor_template_id only applies to the jsonl format", http.StatusBadRequest)
+		return false
+	}
+	if _, err := searchquery.Parse(filter.Query); err != nil {
+		respondWithQueryError(w, err)
+		return false
+	}
+	return true
+}
+
+// ExportEmailsHandler streams matching emails as a file
+// @Summary Export emails
+// @Description Stream matching emails as mbox, a zip of .eml files or JSONL. Exports larger than EXPORT_SYNC_LIMIT must use POST /api/exports.
+// @Tags exports
+// @Produce application/mbox
+// @Produce application/zip
+// @Produce application/x-ndjson
+// @Param format query string true "Export format: mbox, eml or jsonl"
+// @Param q query string false "Gmail-style search query"
+// @Param keyword query string false "Full-text search keyword"
+// @Param account_id query int false "Account ID"
+// @Param mailbox query string false "Mailbox name"
+// @Param start_date query string false "Start date (RFC3339 format)"
+// @Param end_date query string false "End date (RFC3339 format)"
+// @Param extractor_template_id query int false "Extractor template whose results are added to JSONL records"
+// @Success 200 {file} file "Export file"
+// @Failure 400 {object} SearchQueryErrorResponse
+// @Failure 413 {object} ErrorResponse "Too many emails, use an export job"
+// @Router /api/emails/export [get]
+func (h *ExportHandler) ExportEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	format := models.ExportFormat(r.URL.Query().Get("format"))
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validateExport(w, format, filter) {
+		return
+	}
+
+	exporter := h.exportService.Exporter()
+	total, err := exporter.Count(filter)
+	if err != nil {
+		http.Error(w, "Failed to count emails: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.syncLimit > 0 && total > int64(h.syncLimit) {
+		http.Error(w, fmt.Sprintf("Export matches %d emails, more than the limit of %d; create an export job with POST /api/exports instead", total, h.syncLimit), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	fileName := fmt.Sprintf("mailman-export-%s%s", time.Now().Format("20060102-150405"), services.ExportFileExtension(format))
+	w.Header().Set("Content-Type", services.ExportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+
+	// 响应头已发送，之后的错误只能记录日志
+	if _, err := exporter.Export(r.Context(), w, format, filter, nil); err != nil {
+		log.Printf("[ExportHandler] Streaming export failed: %v", err)
+	}
+}
+
+// CreateExportJobHandler creates a background export job
+// @Summary Create an export job
+// @Description Export matching emails in the background; download the file from download_url once the job is completed
+// @Tags exports
+// @Accept json
+// @Produce json
+// @Param request body ExportRequest true "Export format and filter"
+// @Success 202 {object} models.ExportJob
+// @Failure 400 {object} SearchQueryErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/exports [post]
+func (h *ExportHandler) CreateExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validateExport(w, req.Format, req.ExportFilter) {
+		return
+	}
+
+	job, err := h.exportService.CreateJob(req.Format, req.ExportFilter)
+	if err != nil {
+		http.Error(w, "Failed to create export job: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(withDownloadURL(job))
+}
+
+// ListExportJobsHandler lists recent export jobs
+// @Summary List export jobs
+// @Tags exports
+// @Produce json
+// @Success 200 {array} models.ExportJob
+// @Failure 500 {object} ErrorResponse
+// @Router /api/exports [get]
+func (h *ExportHandler) ListExportJobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.jobRepo.List(100)
+	if err != nil {
+		http.Error(w, "Failed to retrieve export jobs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range jobs {
+		withDownloadURL(&jobs[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// GetExportJobHandler returns an export job
+// @Summary Get an export job
+// @Tags exports
+// @Produce json
+// @Param id path int true "Export job ID"
+// @Success 200 {object} models.ExportJob
+// @Failure 404 {object} ErrorResponse
+// @Router /api/exports/{id} [get]
+func (h *ExportHandler) GetExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withDownloadURL(job))
+}
+
+// DownloadExportHandler downloads the file of a completed export job
+// @Summary Download an export
+// @Tags exports
+// @Produce application/octet-stream
+// @Param id path int true "Export job ID"
+// @Success 200 {file} file "Export file"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Job not completed"
+// @Failure 410 {object} ErrorResponse "Export file expired"
+// @Router /api/exports/{id}/download [get]
+func (h *ExportHandler) DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	path, err := h.exportService.FilePath(job)
+	if err != nil {
+		status := http.StatusConflict
+		if job.Status == models.ExportJobCompleted {
+			status = http.StatusGone
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Export file is no longer available", http.StatusGone)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", services.ExportContentType(job.Format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.FileName))
+	http.ServeContent(w, r, job.FileName, *job.CompletedAt, file)
+}
+
+// DeleteExportJobHandler deletes an export job and its file
+// @Summary Delete an export job
+// @Tags exports
+// @Param id path int true "Export job ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Job is still running"
+// @Router /api/exports/{id} [delete]
+func (h *ExportHandler) DeleteExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.loadJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status == models.ExportJobPending || job.Status == models.ExportJobRunning {
+		http.Error(w, "Export job is still running", http.StatusConflict)
+		return
+	}
+
+	if err := h.exportService.DeleteJob(job); err != nil {
+		http.Error(w, "Failed to delete export job: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadJob resolves the {id} path variable, writing the error response on failure
+func (h *ExportHandler) loadJob(w http.ResponseWriter, r *http.Request) (*models.ExportJob, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid export job ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err := h.jobRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Export job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// withDownloadURL sets the download link of completed jobs
+func withDownloadURL(job *models.ExportJob) *models.ExportJob {
+	if job.Status == models.ExportJobCompleted {
+		job.DownloadURL = fmt.Sprintf("/api/exports/%d/download", job.ID)
+	}
+	return job
+}
+
+// parseExportFilter reads the export filter from the query parameters
+func parseExportFilter(r *http.Request) (models.ExportFilter, error) {
+	query := r.URL.Query()
+	filter := models.ExportFilter{
+		MailboxName: query.Get("mailbox"),
+		Query:       query.Get("q"),
+		Keyword:     query.Get("keyword"),
+	}
+
+	if v := query.Get("account_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid account_id %q", v)
+		}
+		filter.AccountID = uint(id)
+	}
+	if v := query.Get("extractor_template_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid extractor_template_id %q", v)
+		}
+		templateID := uint(id)
+		filter.ExtractorTemplateID = &templateID
+	}
+	for name, target := range map[string]**time.Time{"start_date": &filter.StartDate, "end_date": &filter.EndDate} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %q, expected RFC3339", name, v)
+			}
+			*target = &parsed
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mailman/internal/database"
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/services"
+)
+
+// newExtractedValueService creates the service storing extraction results
+func newExtractedValueService() *services.ExtractedValueService {
+	db := database.GetDB()
+	return services.NewExtractedValueService(
+		repository.NewExtractedValueRepository(db),
+		repository.NewExtractorTemplateRepository(db),
+		repository.NewEmailRepository(db),
+	)
+}
+
+// GetExtractedValuesHandler lists stored extraction results
+// @Summary List extracted values
+// @Description List the stored named outputs of extractor templates, most recently extracted first. Values are stored by the save_values option of /api/emails/extract and by extract_values trigger actions.
+// @Tags extracted-values
+// @Produce json
+// @Param template_id query int false "Extractor template ID"
+// @Param field query string false "Output name"
+// @Param email_id query int false "Email ID"
+// @Param account_id query int false "Account ID"
+// @Param value query string false "Exact value"
+// @Param since query string false "Extracted at or after (RFC3339)"
+// @Param until query string false "Extracted before (RFC3339)"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Items per page (default: 50, max: 500)"
+// @Success 200 {object} PaginatedExtractedValuesResponse
+// @Failure 400 {string} string "Invalid filter"
+// @Router /api/extracted-values [get]
+func (h *APIHandler) GetExtractedValuesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExtractedValueFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	limit := 50
+	if p := r.URL.Query().Get("page"); p != "" {
+		if val, err := strconv.Atoi(p); err == nil && val > 0 {
+			page = val
+		}
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil && val > 0 && val <= 500 {
+			limit = val
+		}
+	}
+
+	valueRepo := repository.NewExtractedValueRepository(database.GetDB())
+	values, total, err := valueRepo.List(filter, limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve extracted values: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+	response := PaginatedExtractedValuesResponse{
+		Data:       make([]ExtractedValueResponse, 0, len(values)),
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: totalPages,
+	}
+	for i := range values {
+		response.Data = append(response.Data, extractedValueResponse(&values[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AggregateExtractedValuesHandler aggregates stored extraction results
+// @Summary Aggregate extracted values
+// @Description Count stored values, optionally grouped by field, value, template or day (of extraction). Sum, avg, min and max cover number values.
+// @Tags extracted-values
+// @Produce json
+// @Param group_by query string false "field, value, template or day (default: no grouping)"
+// @Param template_id query int false "Extractor template ID"
+// @Param field query string false "Output name"
+// @Param email_id query int false "Email ID"
+// @Param account_id query int false "Account ID"
+// @Param value query string false "Exact value"
+// @Param since query string false "Extracted at or after (RFC3339)"
+// @Param until query string false "Extracted before (RFC3339)"
+// @Param limit query int false "Maximum number of groups (default: 100, max: 1000)"
+// @Success 200 {object} ExtractedValueAggregateResponse
+// @Failure 400 {string} string "Invalid filter or grouping"
+// @Router /api/extracted-values/aggregate [get]
+func (h *APIHandler) AggregateExtractedValuesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExtractedValueFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil && val > 0 && val <= 1000 {
+			limit = val
+		}
+	}
+
+	valueRepo := repository.NewExtractedValueRepository(database.GetDB())
+	groups, err := valueRepo.Aggregate(filter, groupBy, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ExtractedValueAggregateResponse{GroupBy: groupBy, Groups: groups})
+}
+
+// parseExtractedValueFilter reads the filter query parameters shared by the extracted value endpoints
+func parseExtractedValueFilter(r *http.Request) (repository.ExtractedValueFilter, error) {
+	query := r.URL.Query()
+	filter := repository.ExtractedValueFilter{
+		Field: query.Get("field"),
+		Value: query.Get("value"),
+	}
+
+	ids := map[string]*uint{
+		"template_id": &filter.TemplateID,
+		"email_id":    &filter.EmailID,
+		"account_id":  &filter.AccountID,
+	}
+	for name, target := range ids {
+		if raw := query.Get(name); raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s", name)
+			}
+			*target = uint(id)
+		}
+	}
+
+	times := map[string]**time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	}
+	for name, target := range times {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected RFC3339", name)
+			}
+			*target = &parsed
+		}
+	}
+	return filter, nil
+}
+
+func extractedValueResponse(value *models.ExtractedValue) ExtractedValueResponse {
+	return ExtractedValueResponse{
+		ID:          value.ID,
+		EmailID:     value.EmailID,
+		TemplateID:  value.TemplateID,
+		Revision:    value.Revision,
+		Field:       value.Field,
+		Type:        value.Type,
+		Value:       value.Typed(),
+		ExtractedAt: value.ExtractedAt,
+	}
+}
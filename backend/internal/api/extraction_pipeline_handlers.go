@@ -0,0 +1,351 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/searchquery"
+	"mailman/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ExtractionPipelineHandler handles extraction pipeline API requests
+type ExtractionPipelineHandler struct {
+	pipelineRepo    *repository.ExtractionPipelineRepository
+	templateRepo    *repository.ExtractorTemplateRepository
+	pipelineService *services.ExtractionPipelineService
+}
+
+// NewExtractionPipelineHandler creates a new extraction pipeline handler
+func NewExtractionPipelineHandler(pipelineRepo *repository.ExtractionPipelineRepository, templateRepo *repository.ExtractorTemplateRepository, pipelineService *services.ExtractionPipelineService) *ExtractionPipelineHandler {
+	return &ExtractionPipelineHandler{
+		pipelineRepo:    pipelineRepo,
+		templateRepo:    templateRepo,
+		pipelineService: pipelineService,
+	}
+}
+
+// ExtractionPipelineRequest is the body for creating or updating an extraction pipeline
+type ExtractionPipelineRequest struct {
+	Name          string   `json:"name" example:"Login codes"`
+	Description   string   `json:"description,omitempty"`
+	TemplateID    uint     `json:"template_id" example:"1"`
+	Enabled       *bool    `json:"enabled,omitempty"`
+	AccountIDs    []uint   `json:"account_ids,omitempty"`
+	AliasPatterns []string `json:"alias_patterns,omitempty" example:"*@example.com"`
+	SenderDomains []string `json:"sender_domains,omitempty" example:"github.com"`
+	Mailboxes     []string `json:"mailboxes,omitempty" example:"INBOX"`
+	Query         string   `json:"query,omitempty" example:"subject:code newer_than:1d"`
+	WebhookURL    string   `json:"webhook_url,omitempty" example:"https://example.com/hooks/otp"`
+	WebhookSecret *string  `json:"webhook_secret,omitempty"`
+}
+
+// validate checks the template, scope and webhook of the request
+func (h *ExtractionPipelineHandler) validate(w http.ResponseWriter, req *ExtractionPipelineRequest) bool {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return false
+	}
+	if req.TemplateID == 0 {
+		http.Error(w, "template_id is required", http.StatusBadRequest)
+		return false
+	}
+	if _, err := h.templateRepo.GetByID(req.TemplateID); err != nil {
+		http.Error(w, "Extractor template not found", http.StatusBadRequest)
+		return false
+	}
+	for _, pattern := range req.AliasPatterns {
+		if !validAliasPattern(pattern) {
+			http.Error(w, "Invalid alias pattern "+strconv.Quote(pattern)+", use an address or *@domain", http.StatusBadRequest)
+			return false
+		}
+	}
+	if strings.TrimSpace(req.Query) != "" {
+		if _, err := searchquery.Parse(req.Query); err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+	}
+	if req.WebhookURL != "" {
+		parsed, err := url.Parse(req.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			http.Error(w, "webhook_url must be an http or https URL", http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// apply copies the request onto a pipeline. The webhook secret is kept when
+// the request does not set it.
+func (req *ExtractionPipelineRequest) apply(pipeline *models.ExtractionPipeline) {
+	pipeline.Name = req.Name
+	pipeline.Description = req.Description
+	pipeline.TemplateID = req.TemplateID
+	pipeline.AccountIDs = req.AccountIDs
+	pipeline.AliasPatterns = trimmedList(req.AliasPatterns)
+	pipeline.SenderDomains = trimmedList(req.SenderDomains)
+	pipeline.Mailboxes = trimmedList(req.Mailboxes)
+	pipeline.Query = strings.TrimSpace(req.Query)
+	pipeline.WebhookURL = req.WebhookURL
+	if req.WebhookSecret != nil {
+		pipeline.WebhookSecret = *req.WebhookSecret
+	}
+	if req.Enabled != nil {
+		pipeline.Enabled = *req.Enabled
+	}
+}
+
+// validAliasPattern reports whether a recipient pattern is an address or
+// *@domain, the alias forms triggers and subscriptions accept
+func validAliasPattern(pattern string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return true
+	}
+	if domain, ok := strings.CutPrefix(pattern, "*@"); ok {
+		return domain != "" && !strings.ContainsAny(domain, "@*")
+	}
+	kind, _ := models.ClassifyAddressPattern(pattern)
+	return kind == models.AddressPatternExact
+}
+
+// trimmedList drops empty entries of a list
+func trimmedList(values []string) models.StringSlice {
+	var list models.StringSlice
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// ListExtractionPipelinesHandler lists the extraction pipelines
+// @Summary List extraction pipelines
+// @Tags extraction-pipelines
+// @Produce json
+// @Param template_id query int false "Only pipelines of this extractor template"
+// @Success 200 {array} models.ExtractionPipeline
+// @Failure 500 {object} ErrorResponse
+// @Router /api/extraction-pipelines [get]
+func (h *ExtractionPipelineHandler) ListExtractionPipelinesHandler(w http.ResponseWriter, r *http.Request) {
+	var templateID uint
+	if value := r.URL.Query().Get("template_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid template_id", http.StatusBadRequest)
+			return
+		}
+		templateID = uint(id)
+	}
+
+	pipelines, err := h.pipelineRepo.GetAll(templateID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve extraction pipelines: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pipelines)
+}
+
+// CreateExtractionPipelineHandler creates an extraction pipeline
+// @Summary Create an extraction pipeline
+// @Description Bind an extractor template to a scope. Emails stored after the pipeline is created that match every non-empty scope field (accounts, recipient alias patterns, sender domains, mailboxes and the search query) are extracted automatically. The values are stored as extracted values and pushed to /api/ws/extractions and to the webhook.
+// @Tags extraction-pipelines
+// @Accept json
+// @Produce json
+// @Param request body ExtractionPipelineRequest true "Extraction pipeline"
+// @Success 201 {object} models.ExtractionPipeline
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/extraction-pipelines [post]
+func (h *ExtractionPipelineHandler) CreateExtractionPipelineHandler(w http.ResponseWriter, r *http.Request) {
+	var req ExtractionPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.validate(w, &req) {
+		return
+	}
+	if _, err := h.pipelineRepo.GetByName(req.Name); err == nil {
+		http.Error(w, "An extraction pipeline with this name already exists", http.StatusConflict)
+		return
+	}
+
+	pipeline := &models.ExtractionPipeline{Enabled: true}
+	req.apply(pipeline)
+	if err := h.pipelineRepo.Create(pipeline); err != nil {
+		http.Error(w, "Failed to create extraction pipeline: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.pipelineService.Wake()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pipeline)
+}
+
+// GetExtractionPipelineHandler returns an extraction pipeline
+// @Summary Get an extraction pipeline
+// @Tags extraction-pipelines
+// @Produce json
+// @Param id path int true "Extraction pipeline ID"
+// @Success 200 {object} models.ExtractionPipeline
+// @Failure 404 {object} ErrorResponse
+// @Router /api/extraction-pipelines/{id} [get]
+func (h *ExtractionPipelineHandler) GetExtractionPipelineHandler(w http.ResponseWriter, r *http.Request) {
+	pipeline, ok := h.loadPipeline(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pipeline)
+}
+
+// UpdateExtractionPipelineHandler updates an extraction pipeline
+// @Summary Update an extraction pipeline
+// @Description The pipeline keeps its progress, changes apply to emails stored afterwards. Omit webhook_secret to keep the current secret.
+// @Tags extraction-pipelines
+// @Accept json
+// @Produce json
+// @Param id path int true "Extraction pipeline ID"
+// @Param request body ExtractionPipelineRequest true "Extraction pipeline"
+// @Success 200 {object} models.ExtractionPipeline
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/extraction-pipelines/{id} [put]
+func (h *ExtractionPipelineHandler) UpdateExtractionPipelineHandler(w http.ResponseWriter, r *http.Request) {
+	pipeline, ok := h.loadPipeline(w, r)
+	if !ok {
+		return
+	}
+
+	var req ExtractionPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.validate(w, &req) {
+		return
+	}
+	if existing, err := h.pipelineRepo.GetByName(req.Name); err == nil && existing.ID != pipeline.ID {
+		http.Error(w, "An extraction pipeline with this name already exists", http.StatusConflict)
+		return
+	}
+
+	req.apply(pipeline)
+	if err := h.pipelineRepo.Update(pipeline); err != nil {
+		http.Error(w, "Failed to update extraction pipeline: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.pipelineService.Wake()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pipeline)
+}
+
+// DeleteExtractionPipelineHandler deletes an extraction pipeline
+// @Summary Delete an extraction pipeline
+// @Description The values extracted by the pipeline are kept
+// @Tags extraction-pipelines
+// @Param id path int true "Extraction pipeline ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/extraction-pipelines/{id} [delete]
+func (h *ExtractionPipelineHandler) DeleteExtractionPipelineHandler(w http.ResponseWriter, r *http.Request) {
+	pipeline, ok := h.loadPipeline(w, r)
+	if !ok {
+		return
+	}
+	if err := h.pipelineRepo.Delete(pipeline.ID); err != nil {
+		http.Error(w, "Failed to delete extraction pipeline: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExtractionWebSocketHandler streams the values extracted by pipelines
+// @Summary Stream extraction results
+// @Description WebSocket that sends a message of type "extraction" with an ExtractionEvent whenever a pipeline extracts values from a new email
+// @Tags extraction-pipelines
+// @Param pipeline_id query int false "Only events of this pipeline"
+// @Router /api/ws/extractions [get]
+func (h *ExtractionPipelineHandler) ExtractionWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	var pipelineID uint
+	if value := r.URL.Query().Get("pipeline_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid pipeline_id", http.StatusBadRequest)
+			return
+		}
+		pipelineID = uint(id)
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	events, cancel := h.pipelineService.Listen(pipelineID)
+	defer cancel()
+
+	// 客户端断开时读取会失败
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.WriteJSON(WebSocketMessage{
+		Type:    "connected",
+		Message: "Connected to extraction pipelines",
+	})
+
+	for {
+		select {
+		case event := <-events:
+			if err := conn.WriteJSON(WebSocketMessage{Type: "extraction", Data: event}); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// loadPipeline loads the pipeline named by the id path parameter
+func (h *ExtractionPipelineHandler) loadPipeline(w http.ResponseWriter, r *http.Request) (*models.ExtractionPipeline, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid extraction pipeline ID", http.StatusBadRequest)
+		return nil, false
+	}
+	pipeline, err := h.pipelineRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return pipeline, true
+}
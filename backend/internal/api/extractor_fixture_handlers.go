@@ -0,0 +1,341 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mailman/internal/database"
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// maxFixtureUpload limits uploaded .eml fixtures
+const maxFixtureUpload = 25 << 20
+
+// newExtractorSuiteService creates the service running template fixtures
+func newExtractorSuiteService() *services.ExtractorSuiteService {
+	db := database.GetDB()
+	return services.NewExtractorSuiteService(
+		repository.NewExtractorFixtureRepository(db),
+		repository.NewExtractorTemplateRepository(db),
+		repository.NewEmailRepository(db),
+	)
+}
+
+// checkExtractorSuite runs the fixtures of a template against proposed
+// extractors. It writes a 409 response and returns false when fixtures
+// regress and the change is not forced.
+func checkExtractorSuite(w http.ResponseWriter, r *http.Request, template *models.ExtractorTemplate, proposed models.ExtractorTemplateConfigs) (*services.ExtractorSuiteResult, bool) {
+	suite, err := newExtractorSuiteService().Check(template.ID,
+		services.TemplateExtractorConfigs(template.Extractors),
+		services.TemplateExtractorConfigs(proposed))
+	if err != nil {
+		http.Error(w, "Failed to run extractor fixtures: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if suite.Regressions > 0 && r.URL.Query().Get("force") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ExtractorSuiteRegressionResponse{
+			Error: strconv.Itoa(suite.Regressions) + " fixture(s) regressed, retry with force=true to save anyway",
+			Suite: suite,
+		})
+		return nil, false
+	}
+	return suite, true
+}
+
+// GetExtractorFixturesHandler lists the fixtures of an extractor template
+// @Summary List extractor template fixtures
+// @Description List the regression fixtures of an extractor template with the result of their last run
+// @Tags extractor-templates
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Success 200 {array} models.ExtractorFixture
+// @Failure 400 {string} string "Invalid template ID"
+// @Failure 404 {string} string "Extractor template not found"
+// @Router /api/extractor-templates/{id}/fixtures [get]
+func (h *APIHandler) GetExtractorFixturesHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := loadExtractorTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	fixtures, err := repository.NewExtractorFixtureRepository(database.GetDB()).ListByTemplate(template.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve fixtures: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fixtures)
+}
+
+// CreateExtractorFixtureHandler adds a stored email as a fixture
+// @Summary Add an extractor template fixture
+// @Description Add a stored email as a regression fixture of an extractor template. Without expected, the current output of the template is recorded as the expected output.
+// @Tags extractor-templates
+// @Accept json
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Param request body CreateExtractorFixtureRequest true "Fixture"
+// @Success 201 {object} models.ExtractorFixture
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Extractor template or email not found"
+// @Router /api/extractor-templates/{id}/fixtures [post]
+func (h *APIHandler) CreateExtractorFixtureHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := loadExtractorTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateExtractorFixtureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.EmailID == nil {
+		http.Error(w, "email_id is required, upload .eml files to /fixtures/eml", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.EmailRepo.GetByID(*req.EmailID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	fixture := &models.ExtractorFixture{
+		TemplateID: template.ID,
+		Name:       strings.TrimSpace(req.Name),
+		Source:     models.ExtractorFixtureSourceEmail,
+		EmailID:    req.EmailID,
+	}
+	if fixture.Name == "" {
+		fixture.Name = "email #" + strconv.FormatUint(uint64(*req.EmailID), 10)
+	}
+	createExtractorFixture(w, template, fixture, req.Expected)
+}
+
+// UploadExtractorFixtureHandler adds an uploaded .eml file as a fixture
+// @Summary Upload an extractor template fixture
+// @Description Add an .eml file (request body) as a regression fixture of an extractor template. The current output of the template is recorded as the expected output; change it with PUT if needed.
+// @Tags extractor-templates
+// @Accept message/rfc822
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Param name query string false "Fixture name"
+// @Success 201 {object} models.ExtractorFixture
+// @Failure 400 {string} string "Invalid message"
+// @Failure 404 {string} string "Extractor template not found"
+// @Router /api/extractor-templates/{id}/fixtures/eml [post]
+func (h *APIHandler) UploadExtractorFixtureHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := loadExtractorTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFixtureUpload))
+	if err != nil {
+		http.Error(w, "Failed to read message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	email, err := services.NewParserService().ParseEmail(raw)
+	if err != nil {
+		http.Error(w, "Invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fixture := &models.ExtractorFixture{
+		TemplateID: template.ID,
+		Name:       strings.TrimSpace(r.URL.Query().Get("name")),
+		Source:     models.ExtractorFixtureSourceEML,
+		RawMessage: raw,
+	}
+	if fixture.Name == "" {
+		fixture.Name = email.Subject
+	}
+	createExtractorFixture(w, template, fixture, nil)
+}
+
+// createExtractorFixture records the expected output of a new fixture and saves it
+func createExtractorFixture(w http.ResponseWriter, template *models.ExtractorTemplate, fixture *models.ExtractorFixture, expected *models.ExtractorFixtureOutput) {
+	suite := newExtractorSuiteService()
+	if expected != nil {
+		fixture.Expected = *expected
+	} else {
+		output, err := suite.Output(fixture, services.TemplateExtractorConfigs(template.Extractors))
+		if err != nil {
+			http.Error(w, "Failed to run the template on the fixture: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		fixture.Expected = *output
+	}
+
+	fixtureRepo := repository.NewExtractorFixtureRepository(database.GetDB())
+	if err := fixtureRepo.Create(fixture); err != nil {
+		http.Error(w, "Failed to create fixture: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fixture)
+}
+
+// UpdateExtractorFixtureHandler updates the name or expected output of a fixture
+// @Summary Update an extractor template fixture
+// @Description Rename a fixture, replace its expected output, or set record to take the current output of the template as the expected output
+// @Tags extractor-templates
+// @Accept json
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Param fixtureId path int true "Fixture ID"
+// @Param request body UpdateExtractorFixtureRequest true "Changes"
+// @Success 200 {object} models.ExtractorFixture
+// @Failure 400 {string} string "Invalid request"
+// @Failure 404 {string} string "Extractor template or fixture not found"
+// @Router /api/extractor-templates/{id}/fixtures/{fixtureId} [put]
+func (h *APIHandler) UpdateExtractorFixtureHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := loadExtractorTemplate(w, r)
+	if !ok {
+		return
+	}
+	fixtureRepo := repository.NewExtractorFixtureRepository(database.GetDB())
+	fixture, ok := loadExtractorFixture(w, r, fixtureRepo, template.ID)
+	if !ok {
+		return
+	}
+
+	var req UpdateExtractorFixtureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		fixture.Name = name
+	}
+	switch {
+	case req.Record:
+		output, err := newExtractorSuiteService().Output(fixture, services.TemplateExtractorConfigs(template.Extractors))
+		if err != nil {
+			http.Error(w, "Failed to run the template on the fixture: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		fixture.Expected = *output
+	case req.Expected != nil:
+		fixture.Expected = *req.Expected
+	}
+
+	if err := fixtureRepo.Update(fixture); err != nil {
+		http.Error(w, "Failed to update fixture: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fixture)
+}
+
+// DeleteExtractorFixtureHandler removes a fixture
+// @Summary Delete an extractor template fixture
+// @Description Remove a regression fixture from an extractor template
+// @Tags extractor-templates
+// @Param id path int true "Extractor Template ID"
+// @Param fixtureId path int true "Fixture ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {string} string "Invalid ID"
+// @Failure 404 {string} string "Fixture not found"
+// @Router /api/extractor-templates/{id}/fixtures/{fixtureId} [delete]
+func (h *APIHandler) DeleteExtractorFixtureHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := loadExtractorTemplate(w, r)
+	if !ok {
+		return
+	}
+	fixtureID, err := strconv.ParseUint(mux.Vars(r)["fixtureId"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid fixture ID", http.StatusBadRequest)
+		return
+	}
+
+	err = repository.NewExtractorFixtureRepository(database.GetDB()).Delete(template.ID, uint(fixtureID))
+	if err != nil {
+		if errors.Is(err, repository.ErrExtractorFixtureNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete fixture: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunExtractorSuiteHandler runs the fixtures of an extractor template
+// @Summary Run an extractor template suite
+// @Description Run every fixture of an extractor template and report pass/fail with the differences between expected and actual output
+// @Tags extractor-templates
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Success 200 {object} services.ExtractorSuiteResult
+// @Failure 400 {string} string "Invalid template ID"
+// @Failure 404 {string} string "Extractor template not found"
+// @Router /api/extractor-templates/{id}/fixtures/run [post]
+func (h *APIHandler) RunExtractorSuiteHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := loadExtractorTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	suiteService := newExtractorSuiteService()
+	suite, err := suiteService.Run(template.ID, services.TemplateExtractorConfigs(template.Extractors))
+	if err != nil {
+		http.Error(w, "Failed to run extractor fixtures: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := suiteService.Record(suite); err != nil {
+		http.Error(w, "Failed to record fixture results: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suite)
+}
+
+// loadExtractorTemplate parses the {id} path parameter and loads the template, writing an error response on failure
+func loadExtractorTemplate(w http.ResponseWriter, r *http.Request) (*models.ExtractorTemplate, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return nil, false
+	}
+	template, err := repository.NewExtractorTemplateRepository(database.GetDB()).GetByID(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return template, true
+}
+
+// loadExtractorFixture parses the {fixtureId} path parameter and loads the fixture
+func loadExtractorFixture(w http.ResponseWriter, r *http.Request, fixtureRepo *repository.ExtractorFixtureRepository, templateID uint) (*models.ExtractorFixture, bool) {
+	fixtureID, err := strconv.ParseUint(mux.Vars(r)["fixtureId"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid fixture ID", http.StatusBadRequest)
+		return nil, false
+	}
+	fixture, err := fixtureRepo.Get(templateID, uint(fixtureID))
+	if err != nil {
+		if errors.Is(err, repository.ErrExtractorFixtureNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Failed to retrieve fixture: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return fixture, true
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"mailman/internal/database"
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// GetExtractorTemplateRevisionsHandler lists the revisions of an extractor template
+// @Summary List extractor template revisions
+// @Description List the revisions of an extractor template, newest first. Every save creates an immutable revision; each entry includes its author and the changes compared to the previous revision.
+// @Tags extractor-templates
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Success 200 {array} ExtractorTemplateRevisionResponse
+// @Failure 400 {string} string "Invalid template ID"
+// @Failure 404 {string} string "Extractor template not found"
+// @Router /api/extractor-templates/{id}/revisions [get]
+func (h *APIHandler) GetExtractorTemplateRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	templateRepo := repository.NewExtractorTemplateRepository(database.GetDB())
+	template, err := templateRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	revisions, err := templateRepo.ListRevisions(template.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve revisions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]ExtractorTemplateRevisionResponse, 0, len(revisions))
+	for i := range revisions {
+		// 按修订号倒序排列，下一项即上一个修订
+		var previous *models.ExtractorTemplateRevision
+		if i+1 < len(revisions) {
+			previous = &revisions[i+1]
+		}
+		response = append(response, revisionResponse(template, &revisions[i], previous))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetExtractorTemplateRevisionHandler returns one revision of an extractor template
+// @Summary Get an extractor template revision
+// @Description Get one revision of an extractor template with the changes compared to the previous revision
+// @Tags extractor-templates
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Param revision path int true "Revision number"
+// @Success 200 {object} ExtractorTemplateRevisionResponse
+// @Failure 400 {string} string "Invalid template ID or revision"
+// @Failure 404 {string} string "Extractor template or revision not found"
+// @Router /api/extractor-templates/{id}/revisions/{revision} [get]
+func (h *APIHandler) GetExtractorTemplateRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, revision, ok := parseRevisionPath(w, r)
+	if !ok {
+		return
+	}
+
+	templateRepo := repository.NewExtractorTemplateRepository(database.GetDB())
+	template, err := templateRepo.GetByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	current, err := templateRepo.GetRevision(id, revision)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	previous, err := templateRepo.GetRevision(id, revision-1)
+	if err != nil && !errors.Is(err, repository.ErrExtractorRevisionNotFound) {
+		writeRevisionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisionResponse(template, current, previous))
+}
+
+// DiffExtractorTemplateRevisionsHandler compares two revisions of an extractor template
+// @Summary Diff extractor template revisions
+// @Description List the changes between two revisions of an extractor template. to defaults to the current revision and from to the revision before to.
+// @Tags extractor-templates
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Param from query int false "Old revision"
+// @Param to query int false "New revision"
+// @Success 200 {object} ExtractorTemplateDiffResponse
+// @Failure 400 {string} string "Invalid template ID or revision"
+// @Failure 404 {string} string "Extractor template or revision not found"
+// @Router /api/extractor-templates/{id}/revisions/diff [get]
+func (h *APIHandler) DiffExtractorTemplateRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	templateRepo := repository.NewExtractorTemplateRepository(database.GetDB())
+	template, err := templateRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	to := template.Revision
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid to revision", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to - 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid from revision", http.StatusBadRequest)
+			return
+		}
+	}
+
+	newRevision, err := templateRepo.GetRevision(template.ID, to)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	// from 为 0 时与空模板比较，即修订 1 之前的状态
+	var oldRevision *models.ExtractorTemplateRevision
+	if from > 0 {
+		if oldRevision, err = templateRepo.GetRevision(template.ID, from); err != nil {
+			writeRevisionError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ExtractorTemplateDiffResponse{
+		TemplateID: template.ID,
+		From:       from,
+		To:         to,
+		Changes:    services.DiffExtractorRevisions(oldRevision, newRevision),
+	})
+}
+
+// RestoreExtractorTemplateRevisionHandler restores an earlier revision of an extractor template
+// @Summary Restore an extractor template revision
+// @Description Make the content of an earlier revision current again. The restore is saved as a new revision, so it can be undone like any other edit. Like updates, it is rejected when fixtures regress unless force is true.
+// @Tags extractor-templates
+// @Produce json
+// @Param id path int true "Extractor Template ID"
+// @Param revision path int true "Revision number to restore"
+// @Param force query bool false "Restore even when fixtures regress"
+// @Success 200 {object} ExtractorTemplateResponse
+// @Failure 400 {string} string "Invalid template ID or revision"
+// @Failure 404 {string} string "Extractor template or revision not found"
+// @Failure 409 {object} ExtractorSuiteRegressionResponse "Fixtures regressed"
+// @Failure 500 {string} string "Failed to restore revision"
+// @Router /api/extractor-templates/{id}/revisions/{revision}/restore [post]
+func (h *APIHandler) RestoreExtractorTemplateRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, revision, ok := parseRevisionPath(w, r)
+	if !ok {
+		return
+	}
+
+	templateRepo := repository.NewExtractorTemplateRepository(database.GetDB())
+	current, err := templateRepo.GetByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	source, err := templateRepo.GetRevision(id, revision)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	suite, ok := checkExtractorSuite(w, r, current, source.Extractors)
+	if !ok {
+		return
+	}
+
+	template, err := templateRepo.Restore(id, revision, getUserFromContext(r))
+	if err != nil {
+		if errors.Is(err, repository.ErrExtractorRevisionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to restore revision: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := newExtractorSuiteService().Record(suite); err != nil {
+		log.Printf("Failed to record fixture results of template %d: %v", template.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ExtractorTemplateResponse{
+		ID:          template.ID,
+		Name:        template.Name,
+		Description: template.Description,
+		Extractors:  toAPIExtractors(template.Extractors),
+		Revision:    template.Revision,
+		CreatedAt:   template.CreatedAt,
+		UpdatedAt:   template.UpdatedAt,
+		Suite:       suite,
+	})
+}
+
+// parseRevisionPath reads the template ID and revision number from the URL
+func parseRevisionPath(w http.ResponseWriter, r *http.Request) (uint, int, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	revision, err := strconv.Atoi(vars["revision"])
+	if err != nil || revision <= 0 {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return uint(id), revision, true
+}
+
+func writeRevisionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrExtractorRevisionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to retrieve revision: "+err.Error(), http.StatusInternalServerError)
+}
+
+// revisionResponse converts a revision, previous may be nil for the first revision
+func revisionResponse(template *models.ExtractorTemplate, revision, previous *models.ExtractorTemplateRevision) ExtractorTemplateRevisionResponse {
+	return ExtractorTemplateRevisionResponse{
+		TemplateID:  revision.TemplateID,
+		Revision:    revision.Revision,
+		Name:        revision.Name,
+		Description: revision.Description,
+		Extractors:  toAPIExtractors(revision.Extractors),
+		AuthorID:    revision.AuthorID,
+		Author:      revision.Author,
+		Message:     revision.Message,
+		CreatedAt:   revision.CreatedAt,
+		Current:     revision.Revision == template.Revision,
+		Changes:     services.DiffExtractorRevisions(previous, revision),
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"mailman/internal/database"
 	"mailman/internal/models"
 	"mailman/internal/repository"
+	"mailman/internal/searchquery"
+	"mailman/internal/secrets"
 	"mailman/internal/services"
 	"math/big"
 	"net/http"
@@ -28,6 +30,15 @@ func getUserIDFromContext(r *http.Request) *uint {
 	return &user.ID
 }
 
+// getUserFromContext returns the authenticated user, nil when authentication is disabled
+func getUserFromContext(r *http.Request) *models.User {
+	user, ok := r.Context().Value(UserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
 // HealthCheck godoc
 // @Summary Show the status of server.
 // @Description get the status of server.
@@ -253,6 +264,7 @@ func (h *APIHandler) CreateAccountHandler(w http.ResponseWriter, r *http.Request
 		IsDomainMail:     request.IsDomainMail,
 		Domain:           request.Domain,
 		CustomSettings:   request.CustomSettings,
+		Tags:             models.StringSlice(request.Tags),
 	}
 
 	if err := h.EmailAccountRepo.Create(&account); err != nil {
@@ -435,6 +447,16 @@ func (h *APIHandler) CreateSubscriptionHandler(w http.ResponseWriter, r *http.Re
 		req.PollingInterval = 30 // Minimum 30 seconds
 	}
 
+	// Validate the search query
+	query := ""
+	if req.Filters != nil {
+		query = req.Filters.Query
+	}
+	if _, err := searchquery.Parse(query); err != nil {
+		respondWithQueryError(w, err)
+		return
+	}
+
 	// Create subscription
 	subscriptionID, err := h.EmailScheduler.SubscribeSimple(
 		account.ID,
@@ -443,6 +465,7 @@ func (h *APIHandler) CreateSubscriptionHandler(w http.ResponseWriter, r *http.Re
 		time.Duration(req.PollingInterval)*time.Second,
 		req.IncludeBody,
 		req.Filters,
+		query,
 	)
 	if err != nil {
 		http.Error(w, "Failed to create subscription: "+err.Error(), http.StatusInternalServerError)
@@ -957,13 +980,17 @@ func (h *APIHandler) TestExtractorTemplateHandler(w http.ResponseWriter, r *http
 				Type:  ext.Type,
 				Match: ext.Match,
 
-				Extract: ext.Extract,
+				Extract:    ext.Extract,
+				Name:       ext.Name,
+				OutputType: ext.OutputType,
+				Required:   ext.Required,
 			})
 		}
 	}
 
 	// Get email content
 	var emailContent map[string]string
+	var attachments []models.Attachment
 	if req.EmailID != nil {
 		// Fetch email from database
 		emailRepo := repository.NewEmailRepository(database.GetDB())
@@ -980,6 +1007,7 @@ func (h *APIHandler) TestExtractorTemplateHandler(w http.ResponseWriter, r *http
 			"body":      email.Body,
 			"html_body": email.HTMLBody,
 		}
+		attachments = email.Attachments
 	} else if req.CustomEmail != nil {
 		// Use custom email content
 		emailContent = map[string]string{
@@ -990,6 +1018,13 @@ func (h *APIHandler) TestExtractorTemplateHandler(w http.ResponseWriter, r *http
 			"body":      req.CustomEmail.Body,
 			"html_body": req.CustomEmail.HTMLBody,
 		}
+		for _, attachment := range req.CustomEmail.Attachments {
+			attachments = append(attachments, models.Attachment{
+				Filename: attachment.Filename,
+				MIMEType: attachment.MIMEType,
+				Content:  []byte(attachment.Content),
+			})
+		}
 	} else {
 		http.Error(w, "Either email_id or custom_email must be provided", http.StatusBadRequest)
 		return
@@ -1003,6 +1038,7 @@ func (h *APIHandler) TestExtractorTemplateHandler(w http.ResponseWriter, r *http
 		result := TestExtractorResult{
 			Field: extractor.Field,
 			Type:  extractor.Type,
+			Name:  extractor.Name,
 		}
 
 		// Get the content to extract from
@@ -1043,6 +1079,10 @@ func (h *APIHandler) TestExtractorTemplateHandler(w http.ResponseWriter, r *http
 			tempEmail.Body = content
 		case "html_body":
 			tempEmail.HTMLBody = content
+		default:
+			// attachment:<glob> 字段从附件中读取内容
+			tempEmail.From = models.StringSlice{}
+			tempEmail.Attachments = attachments
 		}
 
 		// Extract using the service
@@ -1052,13 +1092,22 @@ func (h *APIHandler) TestExtractorTemplateHandler(w http.ResponseWriter, r *http
 				Type:  services.ExtractorType(extractor.Type),
 				Match: extractor.Match,
 
-				Extract: extractor.Extract,
+				Extract:    extractor.Extract,
+				Name:       extractor.Name,
+				OutputType: extractor.OutputType,
+				Required:   extractor.Required,
 			},
 		})
 		if err != nil {
 			result.Error = err.Error()
 		} else if extractResult != nil && len(extractResult.Matches) > 0 {
 			result.Result = &extractResult.Matches[0]
+			result.Value = extractResult.Values[extractor.Name]
+			if len(extractResult.Errors) > 0 {
+				result.ValidationError = extractResult.Errors[0].Message
+			}
+		} else if extractor.Name != "" && extractor.Required {
+			result.ValidationError = "required value is missing"
 		}
 
 		results = append(results, result)
@@ -1087,6 +1136,10 @@ func (h *APIHandler) CreateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 	}
 
 	// Validate extractors
+	if err := validateExtractorOutputs(req.Extractors); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	for i, extractor := range req.Extractors {
 		if extractor.Field == "" || extractor.Type == "" || extractor.Extract == "" {
 			http.Error(w, fmt.Sprintf("Extractor %d is missing required fields", i), http.StatusBadRequest)
@@ -1094,18 +1147,13 @@ func (h *APIHandler) CreateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 		}
 
 		// Validate field values
-		validFields := map[string]bool{
-			"ALL": true, "from": true, "to": true, "cc": true,
-			"subject": true, "body": true, "html_body": true, "headers": true,
-		}
-		if !validFields[extractor.Field] {
+		if !services.IsValidExtractorField(extractor.Field) {
 			http.Error(w, fmt.Sprintf("Invalid field '%s' in extractor %d", extractor.Field, i), http.StatusBadRequest)
 			return
 		}
 
 		// Validate type values
-		validTypes := map[string]bool{"regex": true, "js": true, "gotemplate": true}
-		if !validTypes[extractor.Type] {
+		if !services.IsValidExtractorType(extractor.Type) {
 			http.Error(w, fmt.Sprintf("Invalid type '%s' in extractor %d", extractor.Type, i), http.StatusBadRequest)
 			return
 		}
@@ -1119,7 +1167,10 @@ func (h *APIHandler) CreateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 			Type:  apiExtractor.Type,
 			Match: apiExtractor.Match,
 
-			Extract: apiExtractor.Extract,
+			Extract:    apiExtractor.Extract,
+			Name:       apiExtractor.Name,
+			OutputType: apiExtractor.OutputType,
+			Required:   apiExtractor.Required,
 		})
 	}
 
@@ -1131,7 +1182,7 @@ func (h *APIHandler) CreateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 	}
 
 	templateRepo := repository.NewExtractorTemplateRepository(database.GetDB())
-	if err := templateRepo.Create(template); err != nil {
+	if err := templateRepo.Create(template, getUserFromContext(r)); err != nil {
 		http.Error(w, "Failed to create extractor template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -1142,6 +1193,7 @@ func (h *APIHandler) CreateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 		Name:        template.Name,
 		Description: template.Description,
 		Extractors:  req.Extractors,
+		Revision:    template.Revision,
 		CreatedAt:   template.CreatedAt,
 		UpdatedAt:   template.UpdatedAt,
 	}
@@ -1151,6 +1203,18 @@ func (h *APIHandler) CreateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetBuiltinExtractorsHandler lists the builtin extractors
+// @Summary List builtin extractors
+// @Description List the builtin extractors usable with extractor type "builtin", e.g. otp or verify_link@1
+// @Tags extractor-templates
+// @Produce json
+// @Success 200 {array} services.BuiltinExtractor
+// @Router /api/extractors/builtin [get]
+func (h *APIHandler) GetBuiltinExtractorsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services.BuiltinExtractors())
+}
+
 // GetExtractorTemplatesHandler retrieves all extractor templates
 // @Summary Get all extractor templates
 // @Description Get all extractor templates
@@ -1178,7 +1242,10 @@ func (h *APIHandler) GetExtractorTemplatesHandler(w http.ResponseWriter, r *http
 				Type:  extractor.Type,
 				Match: extractor.Match,
 
-				Extract: extractor.Extract,
+				Extract:    extractor.Extract,
+				Name:       extractor.Name,
+				OutputType: extractor.OutputType,
+				Required:   extractor.Required,
 			})
 		}
 
@@ -1187,6 +1254,7 @@ func (h *APIHandler) GetExtractorTemplatesHandler(w http.ResponseWriter, r *http
 			Name:        template.Name,
 			Description: template.Description,
 			Extractors:  extractors,
+			Revision:    template.Revision,
 			CreatedAt:   template.CreatedAt,
 			UpdatedAt:   template.UpdatedAt,
 		})
@@ -1230,7 +1298,10 @@ func (h *APIHandler) GetExtractorTemplateHandler(w http.ResponseWriter, r *http.
 			Type:  extractor.Type,
 			Match: extractor.Match,
 
-			Extract: extractor.Extract,
+			Extract:    extractor.Extract,
+			Name:       extractor.Name,
+			OutputType: extractor.OutputType,
+			Required:   extractor.Required,
 		})
 	}
 
@@ -1239,6 +1310,7 @@ func (h *APIHandler) GetExtractorTemplateHandler(w http.ResponseWriter, r *http.
 		Name:        template.Name,
 		Description: template.Description,
 		Extractors:  extractors,
+		Revision:    template.Revision,
 		CreatedAt:   template.CreatedAt,
 		UpdatedAt:   template.UpdatedAt,
 	}
@@ -1249,15 +1321,17 @@ func (h *APIHandler) GetExtractorTemplateHandler(w http.ResponseWriter, r *http.
 
 // UpdateExtractorTemplateHandler updates an existing extractor template
 // @Summary Update an extractor template
-// @Description Update an existing extractor template
+// @Description Update an existing extractor template. New extractors are run against the fixtures of the template first; the update is rejected when a fixture that passed before fails, unless force is true.
 // @Tags extractor-templates
 // @Accept json
 // @Produce json
 // @Param id path int true "Extractor Template ID"
+// @Param force query bool false "Save even when fixtures regress"
 // @Param request body UpdateExtractorTemplateRequest true "Update extractor template request"
 // @Success 200 {object} ExtractorTemplateResponse
 // @Failure 400 {string} string "Invalid request"
 // @Failure 404 {string} string "Extractor template not found"
+// @Failure 409 {object} ExtractorSuiteRegressionResponse "Fixtures regressed"
 // @Failure 500 {string} string "Failed to update extractor template"
 // @Router /api/extractor-templates/{id} [put]
 func (h *APIHandler) UpdateExtractorTemplateHandler(w http.ResponseWriter, r *http.Request) {
@@ -1280,6 +1354,7 @@ func (h *APIHandler) UpdateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	var suite *services.ExtractorSuiteResult
 
 	// Update fields if provided
 	if req.Name != "" {
@@ -1290,6 +1365,10 @@ func (h *APIHandler) UpdateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 	}
 	if len(req.Extractors) > 0 {
 		// Validate extractors
+		if err := validateExtractorOutputs(req.Extractors); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		for i, extractor := range req.Extractors {
 			if extractor.Field == "" || extractor.Type == "" || extractor.Extract == "" {
 				http.Error(w, fmt.Sprintf("Extractor %d is missing required fields", i), http.StatusBadRequest)
@@ -1297,18 +1376,13 @@ func (h *APIHandler) UpdateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 			}
 
 			// Validate field values
-			validFields := map[string]bool{
-				"ALL": true, "from": true, "to": true, "cc": true,
-				"subject": true, "body": true, "html_body": true, "headers": true,
-			}
-			if !validFields[extractor.Field] {
+			if !services.IsValidExtractorField(extractor.Field) {
 				http.Error(w, fmt.Sprintf("Invalid field '%s' in extractor %d", extractor.Field, i), http.StatusBadRequest)
 				return
 			}
 
 			// Validate type values
-			validTypes := map[string]bool{"regex": true, "js": true, "gotemplate": true}
-			if !validTypes[extractor.Type] {
+			if !services.IsValidExtractorType(extractor.Type) {
 				http.Error(w, fmt.Sprintf("Invalid type '%s' in extractor %d", extractor.Type, i), http.StatusBadRequest)
 				return
 			}
@@ -1322,16 +1396,30 @@ func (h *APIHandler) UpdateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 				Type:  apiExtractor.Type,
 				Match: apiExtractor.Match,
 
-				Extract: apiExtractor.Extract,
+				Extract:    apiExtractor.Extract,
+				Name:       apiExtractor.Name,
+				OutputType: apiExtractor.OutputType,
+				Required:   apiExtractor.Required,
 			})
 		}
+
+		// 运行模板的测试用例，原本通过的用例失败时拒绝更新，除非指定 force=true
+		var ok bool
+		if suite, ok = checkExtractorSuite(w, r, template, modelExtractors); !ok {
+			return
+		}
 		template.Extractors = modelExtractors
 	}
 
-	if err := templateRepo.Update(template); err != nil {
+	if err := templateRepo.Update(template, getUserFromContext(r)); err != nil {
 		http.Error(w, "Failed to update extractor template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if suite != nil {
+		if err := newExtractorSuiteService().Record(suite); err != nil {
+			log.Printf("Failed to record fixture results of template %d: %v", template.ID, err)
+		}
+	}
 
 	// Convert to response
 	var extractors []ExtractorConfig
@@ -1341,7 +1429,10 @@ func (h *APIHandler) UpdateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 			Type:  extractor.Type,
 			Match: extractor.Match,
 
-			Extract: extractor.Extract,
+			Extract:    extractor.Extract,
+			Name:       extractor.Name,
+			OutputType: extractor.OutputType,
+			Required:   extractor.Required,
 		})
 	}
 
@@ -1350,8 +1441,10 @@ func (h *APIHandler) UpdateExtractorTemplateHandler(w http.ResponseWriter, r *ht
 		Name:        template.Name,
 		Description: template.Description,
 		Extractors:  extractors,
+		Revision:    template.Revision,
 		CreatedAt:   template.CreatedAt,
 		UpdatedAt:   template.UpdatedAt,
+		Suite:       suite,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1456,7 +1549,10 @@ func (h *APIHandler) GetExtractorTemplatesPaginatedHandler(w http.ResponseWriter
 				Type:  ec.Type,
 				Match: ec.Match,
 
-				Extract: ec.Extract,
+				Extract:    ec.Extract,
+				Name:       ec.Name,
+				OutputType: ec.OutputType,
+				Required:   ec.Required,
 			})
 		}
 
@@ -1465,6 +1561,7 @@ func (h *APIHandler) GetExtractorTemplatesPaginatedHandler(w http.ResponseWriter
 			Name:        template.Name,
 			Description: template.Description,
 			Extractors:  extractors,
+			Revision:    template.Revision,
 			CreatedAt:   template.CreatedAt,
 			UpdatedAt:   template.UpdatedAt,
 		})
@@ -1548,10 +1645,11 @@ func (h *APIHandler) UpdateAccountHandler(w http.ResponseWriter, r *http.Request
 	if request.AuthType != nil {
 		existingAccount.AuthType = *request.AuthType
 	}
-	if request.Password != nil {
+	// 客户端回传的脱敏占位符表示凭据未修改
+	if request.Password != nil && !secrets.IsRedacted(*request.Password) {
 		existingAccount.Password = *request.Password
 	}
-	if request.Token != nil {
+	if request.Token != nil && !secrets.IsRedacted(*request.Token) {
 		existingAccount.Token = *request.Token
 	}
 	if request.MailProviderID != nil {
@@ -1567,7 +1665,10 @@ func (h *APIHandler) UpdateAccountHandler(w http.ResponseWriter, r *http.Request
 		existingAccount.Domain = *request.Domain
 	}
 	if request.CustomSettings != nil {
-		existingAccount.CustomSettings = *request.CustomSettings
+		existingAccount.CustomSettings = secrets.MergeSettings(existingAccount.CustomSettings, *request.CustomSettings)
+	}
+	if request.Tags != nil {
+		existingAccount.Tags = models.StringSlice(request.Tags)
 	}
 	if request.LastSyncAt != nil {
 		existingAccount.LastSyncAt = request.LastSyncAt
@@ -1854,11 +1955,28 @@ func (h *APIHandler) WaitEmailHandler(w http.ResponseWriter, r *http.Request) {
 		filterStartTime = time.Now() // Default to current time
 	}
 
+	// Template extractors, optionally pinned to a revision, run before the request extractors
+	if request.ExtractorID != nil {
+		templateExtractors, err := loadTemplateExtractors(*request.ExtractorID, request.ExtractorRevision)
+		if err != nil {
+			http.Error(w, "Invalid extractor template ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Extract = append(templateExtractors, request.Extract...)
+	} else if request.ExtractorRevision != nil {
+		http.Error(w, "extractor_revision requires extractor_id", http.StatusBadRequest)
+		return
+	}
+
 	// Validate extractors if provided
 	var extractorService *services.ExtractorService
 	var serviceExtractors []services.ExtractorConfig
 	if len(request.Extract) > 0 {
 		extractorService = services.NewExtractorService()
+		if err := validateExtractorOutputs(request.Extract); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		for i, extractor := range request.Extract {
 			if extractor.Field == "" || extractor.Type == "" || extractor.Extract == "" {
 				http.Error(w, fmt.Sprintf("Extractor %d is missing required fields", i), http.StatusBadRequest)
@@ -1866,18 +1984,13 @@ func (h *APIHandler) WaitEmailHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Validate field values
-			validFields := map[string]bool{
-				"ALL": true, "from": true, "to": true, "cc": true,
-				"subject": true, "body": true, "html_body": true, "headers": true,
-			}
-			if !validFields[extractor.Field] {
+			if !services.IsValidExtractorField(extractor.Field) {
 				http.Error(w, fmt.Sprintf("Invalid field '%s' in extractor %d", extractor.Field, i), http.StatusBadRequest)
 				return
 			}
 
 			// Validate type values
-			validTypes := map[string]bool{"regex": true, "js": true, "gotemplate": true}
-			if !validTypes[extractor.Type] {
+			if !services.IsValidExtractorType(extractor.Type) {
 				http.Error(w, fmt.Sprintf("Invalid type '%s' in extractor %d", extractor.Type, i), http.StatusBadRequest)
 				return
 			}
@@ -1887,7 +2000,10 @@ func (h *APIHandler) WaitEmailHandler(w http.ResponseWriter, r *http.Request) {
 				Type:  services.ExtractorType(extractor.Type),
 				Match: extractor.Match,
 
-				Extract: extractor.Extract,
+				Extract:    extractor.Extract,
+				Name:       extractor.Name,
+				OutputType: extractor.OutputType,
+				Required:   extractor.Required,
 			})
 		}
 	}
@@ -1951,6 +2067,8 @@ func (h *APIHandler) WaitEmailHandler(w http.ResponseWriter, r *http.Request) {
 							Found:           true,
 							Email:           &email,
 							Matches:         result.Matches,
+							Values:          result.Values,
+							Errors:          result.Errors,
 							ElapsedTime:     elapsed,
 							ChecksPerformed: checksPerformed,
 							Message:         "Email found matching extraction criteria",
@@ -2067,10 +2185,13 @@ func (h *APIHandler) PollEmailHandler(w http.ResponseWriter, r *http.Request) {
 		extractorService = services.NewExtractorService()
 		for _, extractor := range request.Extract {
 			serviceExtractors = append(serviceExtractors, services.ExtractorConfig{
-				Field:   services.ExtractorField(extractor.Field),
-				Type:    services.ExtractorType(extractor.Type),
-				Match:   extractor.Match,
-				Extract: extractor.Extract,
+				Field:      services.ExtractorField(extractor.Field),
+				Type:       services.ExtractorType(extractor.Type),
+				Match:      extractor.Match,
+				Extract:    extractor.Extract,
+				Name:       extractor.Name,
+				OutputType: extractor.OutputType,
+				Required:   extractor.Required,
 			})
 		}
 	}
@@ -2118,6 +2239,8 @@ func (h *APIHandler) PollEmailHandler(w http.ResponseWriter, r *http.Request) {
 		Found        bool          `json:"found"`
 		Email        *models.Email `json:"email,omitempty"`
 		Matches      interface{}   `json:"matches,omitempty"`
+		Values       interface{}   `json:"values,omitempty"`
+		Errors       interface{}   `json:"errors,omitempty"`
 		ProcessedIds []string      `json:"processedIds"`
 		ElapsedTime  float64       `json:"elapsedTime"`
 		Message      string        `json:"message"`
@@ -2188,6 +2311,8 @@ func (h *APIHandler) PollEmailHandler(w http.ResponseWriter, r *http.Request) {
 				Found:        true,
 				Email:        &email,
 				Matches:      result.Matches,
+				Values:       result.Values,
+				Errors:       result.Errors,
 				ProcessedIds: append(newProcessedIDs, getMapKeys(processedMessageIDs)...),
 				ElapsedTime:  time.Since(startTime).Seconds(),
 				Message:      "Email found matching extraction criteria",
@@ -2219,6 +2344,56 @@ func getMapKeys(m map[string]bool) []string {
 	return keys
 }
 
+// loadTemplateExtractors returns the extractors of a template, or of one of
+// its revisions when revision is set
+func loadTemplateExtractors(templateID uint, revision *int) ([]ExtractorConfig, error) {
+	templateRepo := repository.NewExtractorTemplateRepository(database.GetDB())
+	template, err := templateRepo.GetByID(templateID)
+	if err != nil {
+		return nil, err
+	}
+	configs := template.Extractors
+	if revision != nil && *revision != template.Revision {
+		pinned, err := templateRepo.GetRevision(templateID, *revision)
+		if err != nil {
+			return nil, err
+		}
+		configs = pinned.Extractors
+	}
+	return toAPIExtractors(configs), nil
+}
+
+// toAPIExtractors converts stored extractor configurations to API extractors
+func toAPIExtractors(configs models.ExtractorTemplateConfigs) []ExtractorConfig {
+	extractors := make([]ExtractorConfig, 0, len(configs))
+	for _, extractor := range configs {
+		extractors = append(extractors, ExtractorConfig{
+			Field: extractor.Field,
+			Type:  extractor.Type,
+			Match: extractor.Match,
+
+			Extract:    extractor.Extract,
+			Name:       extractor.Name,
+			OutputType: extractor.OutputType,
+			Required:   extractor.Required,
+		})
+	}
+	return extractors
+}
+
+// validateExtractorOutputs checks the name, output_type and required settings of extractors
+func validateExtractorOutputs(extractors []ExtractorConfig) error {
+	configs := make([]services.ExtractorConfig, 0, len(extractors))
+	for _, extractor := range extractors {
+		configs = append(configs, services.ExtractorConfig{
+			Name:       extractor.Name,
+			OutputType: extractor.OutputType,
+			Required:   extractor.Required,
+		})
+	}
+	return services.ValidateExtractorOutputs(configs)
+}
+
 // RandomEmailHandler godoc
 // @Summary Get a random email account
 // @Description Get a random email account from existing accounts. Supports generating random Gmail aliases and selecting domain email accounts based on parameters.
@@ -2815,6 +2990,7 @@ func (h *APIHandler) GetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 			"body_query":    options.BodyQuery,
 			"html_query":    options.HTMLQuery,
 			"keyword":       options.Keyword,
+			"q":             options.Query,
 			"mailbox":       options.MailboxName,
 			"sort_by":       options.SortBy,
 		},
@@ -2835,15 +3011,22 @@ func (h *APIHandler) GetEmailsHandler(w http.ResponseWriter, r *http.Request) {
 // @Param from_query query string false "Filter by sender email"
 // @Param limit query int false "Limit results (default 50, max 100)"
 // @Param offset query int false "Offset for pagination"
-// @Param sort_by query string false "Sort order (date_desc, date_asc, etc.)"
+// @Param sort_by query string false "Sort order (date_desc, date_asc, subject_asc, subject_desc, relevance)"
 // @Param start_date query string false "Start date (RFC3339 format)"
 // @Param end_date query string false "End date (RFC3339 format)"
 // @Param subject_query query string false "Filter by subject"
 // @Param body_query query string false "Filter by email body"
 // @Param html_query query string false "Filter by HTML body"
-// @Param keyword query string false "Global search across all fields"
+// @Param keyword query string false "Full-text search across subject, addresses and body"
+// @Param q query string false "Gmail-style query, e.g. from:github subject:(verify OR confirm) has:attachment newer_than:2d -in:spam"
+// @Param highlight query bool false "Return highlighted snippets for full-text hits (default true)"
 // @Param mailbox query string false "Filter by mailbox name"
-// @Success 200 {object} map[string]interface{} "Response with emails array and pagination info"
+// @Param tag query string false "Comma separated user tags, emails must carry all of them"
+// @Param facets query string false "Comma separated facets: account, mailbox, sender_domain, date, has_attachment, read_state"
+// @Param facet_interval query string false "Date facet bucket size: day (default), week or month"
+// @Param facet_limit query int false "Maximum buckets per facet (default 20, max 100)"
+// @Success 200 {object} map[string]interface{} "Response with emails array, pagination info, keyword highlights and facets"
+// @Failure 400 {object} SearchQueryErrorResponse
 // @Router /api/emails/search [get]
 func (h *APIHandler) SearchEmailsHandler(w http.ResponseWriter, r *http.Request) {
 	// Create search options
@@ -2884,6 +3067,7 @@ func (h *APIHandler) SearchEmailsHandler(w http.ResponseWriter, r *http.Request)
 			"date_asc":     "date ASC",
 			"subject_asc":  "subject ASC",
 			"subject_desc": "subject DESC",
+			"relevance":    repository.SortByRelevance,
 		}
 		if validSort, exists := validSortOptions[sortBy]; exists {
 			options.SortBy = validSort
@@ -2910,14 +3094,30 @@ func (h *APIHandler) SearchEmailsHandler(w http.ResponseWriter, r *http.Request)
 	options.BodyQuery = r.URL.Query().Get("body_query")
 	options.HTMLQuery = r.URL.Query().Get("html_query")
 	options.Keyword = r.URL.Query().Get("keyword")
+	options.Query = r.URL.Query().Get("q")
 	options.MailboxName = r.URL.Query().Get("mailbox")
+	if tags := r.URL.Query().Get("tag"); tags != "" {
+		options.Tags = strings.Split(tags, ",")
+	}
+
+	// Full-text hits come with highlighted snippets unless explicitly disabled
+	options.Highlight = r.URL.Query().Get("highlight") != "false"
+
+	// Optional facet counts over all matches
+	if err := parseFacetParams(r, &options); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Perform search
-	emails, totalCount, err := h.EmailRepo.SearchEmails(options)
+	result, err := h.EmailRepo.SearchEmailsDetailed(options)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !respondWithQueryError(w, err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
+	emails, totalCount := result.Emails, result.Total
 
 	// Calculate pagination info
 	totalPages := int((totalCount + int64(options.Limit) - 1) / int64(options.Limit))
@@ -2947,15 +3147,45 @@ func (h *APIHandler) SearchEmailsHandler(w http.ResponseWriter, r *http.Request)
 			"body_query":    options.BodyQuery,
 			"html_query":    options.HTMLQuery,
 			"keyword":       options.Keyword,
+			"q":             options.Query,
 			"mailbox":       options.MailboxName,
 			"sort_by":       options.SortBy,
 		},
 	}
+	if result.Highlights != nil {
+		response["highlights"] = result.Highlights
+	}
+	if result.Facets != nil {
+		response["facets"] = result.Facets
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// ReindexSearchHandler rebuilds the full-text search index
+// @Summary Rebuild search index
+// @Description Drop and rebuild the full-text search index for all stored emails
+// @Tags emails
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Number of indexed emails"
+// @Failure 500 {object} ErrorResponse
+// @Router /api/emails/search/reindex [post]
+func (h *APIHandler) ReindexSearchHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	indexed, err := h.EmailRepo.SearchIndex().Rebuild(500)
+	if err != nil {
+		http.Error(w, "Failed to rebuild search index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"indexed":  indexed,
+		"duration": time.Since(startTime).String(),
+	})
+}
+
 // GetEmailHandler retrieves a specific email
 // @Summary Get an email by ID
 // @Description Get an email by ID
@@ -3019,25 +3249,35 @@ func (h *APIHandler) ExtractEmailsHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get extractors from template if ExtractorID is provided
+	// Get extractors from template if ExtractorID is provided, optionally pinned to a revision
 	var templateExtractors []ExtractorConfig
 	if req.ExtractorID != nil {
-		templateRepo := repository.NewExtractorTemplateRepository(database.GetDB())
-		template, err := templateRepo.GetByID(*req.ExtractorID)
+		var err error
+		templateExtractors, err = loadTemplateExtractors(*req.ExtractorID, req.ExtractorRevision)
 		if err != nil {
 			http.Error(w, "Invalid extractor template ID: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+	} else if req.ExtractorRevision != nil {
+		http.Error(w, "extractor_revision requires extractor_id", http.StatusBadRequest)
+		return
+	}
 
-		// Convert template extractors to API extractors
-		for _, extractor := range template.Extractors {
-			templateExtractors = append(templateExtractors, ExtractorConfig{
-				Field: extractor.Field,
-				Type:  extractor.Type,
-				Match: extractor.Match,
-
-				Extract: extractor.Extract,
-			})
+	// 保存提取结果时只保留模板提取器的命名输出，并记录实际使用的修订
+	var valueService *services.ExtractedValueService
+	var valueExtractors []services.ExtractorConfig
+	var valueRevision int
+	if req.SaveValues {
+		if req.ExtractorID == nil {
+			http.Error(w, "save_values requires extractor_id", http.StatusBadRequest)
+			return
+		}
+		valueService = newExtractedValueService()
+		var err error
+		valueExtractors, valueRevision, err = valueService.TemplateExtractors(*req.ExtractorID, req.ExtractorRevision)
+		if err != nil {
+			http.Error(w, "Invalid extractor template ID: "+err.Error(), http.StatusBadRequest)
+			return
 		}
 	}
 
@@ -3051,6 +3291,10 @@ func (h *APIHandler) ExtractEmailsHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Validate extractor configurations
+	if err := validateExtractorOutputs(allExtractors); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	for i, extractor := range allExtractors {
 		if extractor.Field == "" || extractor.Type == "" || extractor.Extract == "" {
 			http.Error(w, fmt.Sprintf("Extractor %d is missing required fields", i), http.StatusBadRequest)
@@ -3058,18 +3302,13 @@ func (h *APIHandler) ExtractEmailsHandler(w http.ResponseWriter, r *http.Request
 		}
 
 		// Validate field values
-		validFields := map[string]bool{
-			"ALL": true, "from": true, "to": true, "cc": true,
-			"subject": true, "body": true, "html_body": true, "headers": true,
-		}
-		if !validFields[extractor.Field] {
+		if !services.IsValidExtractorField(extractor.Field) {
 			http.Error(w, fmt.Sprintf("Invalid field '%s' in extractor %d", extractor.Field, i), http.StatusBadRequest)
 			return
 		}
 
 		// Validate type values
-		validTypes := map[string]bool{"regex": true, "js": true, "gotemplate": true}
-		if !validTypes[extractor.Type] {
+		if !services.IsValidExtractorType(extractor.Type) {
 			http.Error(w, fmt.Sprintf("Invalid type '%s' in extractor %d", extractor.Type, i), http.StatusBadRequest)
 			return
 		}
@@ -3120,7 +3359,10 @@ func (h *APIHandler) ExtractEmailsHandler(w http.ResponseWriter, r *http.Request
 			Type:  services.ExtractorType(apiExtractor.Type),
 			Match: apiExtractor.Match,
 
-			Extract: apiExtractor.Extract,
+			Extract:    apiExtractor.Extract,
+			Name:       apiExtractor.Name,
+			OutputType: apiExtractor.OutputType,
+			Required:   apiExtractor.Required,
 		})
 	}
 
@@ -3160,6 +3402,14 @@ func (h *APIHandler) ExtractEmailsHandler(w http.ResponseWriter, r *http.Request
 		batchesProcessed++
 		totalProcessed += len(emails)
 
+		// 附件字段的提取器需要附件内容，游标不会预加载
+		if services.ExtractorsUseAttachments(serviceExtractors) {
+			if err := h.EmailRepo.LoadAttachments(emails); err != nil {
+				http.Error(w, "Error loading attachments: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// Process each email in the batch
 		for _, email := range emails {
 			result, err := extractorService.ExtractFromEmail(email, serviceExtractors)
@@ -3167,11 +3417,18 @@ func (h *APIHandler) ExtractEmailsHandler(w http.ResponseWriter, r *http.Request
 				log.Printf("Error extracting from email ID %d: %v", email.ID, err)
 				continue
 			}
+			if valueService != nil {
+				if err := valueService.Store(email.ID, *req.ExtractorID, valueRevision, valueExtractors, result); err != nil {
+					log.Printf("Error saving values of email ID %d: %v", email.ID, err)
+				}
+			}
 
 			if result != nil {
 				results = append(results, ExtractorResult{
 					Email:   result.Email,
 					Matches: result.Matches,
+					Values:  result.Values,
+					Errors:  result.Errors,
 				})
 				totalMatched++
 
@@ -3283,6 +3540,18 @@ func (h *APIHandler) CheckEmailHandler(w http.ResponseWriter, r *http.Request) {
 	var serviceExtractors []services.ExtractorConfig
 	if len(request.Extract) > 0 {
 		extractorService = services.NewExtractorService()
+		if err := validateExtractorOutputs(request.Extract); err != nil {
+			response := CheckEmailResponse{
+				Status:  "error",
+				Found:   false,
+				Error:   err.Error(),
+				Message: "Invalid extractor output configuration",
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
 		for i, extractor := range request.Extract {
 			if extractor.Field == "" || extractor.Type == "" || extractor.Extract == "" {
 				response := CheckEmailResponse{
@@ -3298,11 +3567,7 @@ func (h *APIHandler) CheckEmailHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Validate field values
-			validFields := map[string]bool{
-				"ALL": true, "from": true, "to": true, "cc": true,
-				"subject": true, "body": true, "html_body": true, "headers": true,
-			}
-			if !validFields[extractor.Field] {
+			if !services.IsValidExtractorField(extractor.Field) {
 				response := CheckEmailResponse{
 					Status:  "error",
 					Found:   false,
@@ -3316,8 +3581,7 @@ func (h *APIHandler) CheckEmailHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Validate type values
-			validTypes := map[string]bool{"regex": true, "js": true, "gotemplate": true}
-			if !validTypes[extractor.Type] {
+			if !services.IsValidExtractorType(extractor.Type) {
 				response := CheckEmailResponse{
 					Status:  "error",
 					Found:   false,
@@ -3331,10 +3595,13 @@ func (h *APIHandler) CheckEmailHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			serviceExtractors = append(serviceExtractors, services.ExtractorConfig{
-				Field:   services.ExtractorField(extractor.Field),
-				Type:    services.ExtractorType(extractor.Type),
-				Match:   extractor.Match,
-				Extract: extractor.Extract,
+				Field:      services.ExtractorField(extractor.Field),
+				Type:       services.ExtractorType(extractor.Type),
+				Match:      extractor.Match,
+				Extract:    extractor.Extract,
+				Name:       extractor.Name,
+				OutputType: extractor.OutputType,
+				Required:   extractor.Required,
 			})
 		}
 	}
@@ -3400,6 +3667,8 @@ func (h *APIHandler) CheckEmailHandler(w http.ResponseWriter, r *http.Request) {
 				Found:   true,
 				Email:   &email,
 				Matches: result.Matches,
+				Values:  result.Values,
+				Errors:  result.Errors,
 				Message: "Email found with matching extractors",
 				ResolvedAccount: &AccountInfo{
 					ID:           account.ID,
@@ -3626,6 +3895,7 @@ func (h *APIHandler) GetAllEmailsHandler(w http.ResponseWriter, r *http.Request)
 			"body_query":    options.BodyQuery,
 			"html_query":    options.HTMLQuery,
 			"keyword":       options.Keyword,
+			"q":             options.Query,
 			"mailbox":       options.MailboxName,
 			"sort_by":       options.SortBy,
 		},
@@ -3,8 +3,10 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"mailman/internal/models"
 	"mailman/internal/repository"
+	"mailman/internal/secrets"
 	"mailman/internal/services"
 	"net/http"
 	"strconv"
@@ -166,7 +168,9 @@ func (h *OpenAIHandler) UpdateOpenAIConfig(w http.ResponseWriter, r *http.Reques
 	config.Name = req.Name
 	config.ChannelType = models.AIChannelType(req.ChannelType)
 	config.BaseURL = req.BaseURL
-	config.APIKey = req.APIKey
+	if !secrets.IsRedacted(req.APIKey) {
+		config.APIKey = req.APIKey
+	}
 	config.Model = req.Model
 	config.Headers = models.JSONMap(req.Headers)
 	config.IsActive = req.IsActive
@@ -390,13 +394,15 @@ func (h *OpenAIHandler) DeleteAIPromptTemplate(w http.ResponseWriter, r *http.Re
 
 // GenerateEmailTemplate godoc
 // @Summary Generate an email template using AI
-// @Description Generate an email extraction template using OpenAI based on user input
+// @Description Generate an email extraction template using OpenAI based on user input. With template_id the extractors of that template are replaced, rejected with 409 when its fixtures regress unless force is true.
 // @Tags openai
 // @Accept json
 // @Produce json
 // @Param request body GenerateEmailTemplateRequest true "Generation request"
+// @Param force query bool false "Replace the template even when fixtures regress"
 // @Success 200 {object} GenerateEmailTemplateResponse
 // @Failure 400 {string} string "Bad Request"
+// @Failure 409 {object} ExtractorSuiteRegressionResponse "Fixtures regressed"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /api/openai/generate-template [post]
 func (h *OpenAIHandler) GenerateEmailTemplate(w http.ResponseWriter, r *http.Request) {
@@ -457,16 +463,42 @@ func (h *OpenAIHandler) GenerateEmailTemplate(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Create the extractor template
-	extractorTemplate := &models.ExtractorTemplate{
-		Name:        req.TemplateName,
-		Description: req.Description,
-		Extractors:  extractorConfig,
-	}
+	var extractorTemplate *models.ExtractorTemplate
+	var suite *services.ExtractorSuiteResult
+	if req.TemplateID != nil {
+		// 替换已有模板的提取器，与手动更新一样先运行模板的测试用例
+		extractorTemplate, err = h.ExtractorTemplateRepo.GetByID(*req.TemplateID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		var ok bool
+		if suite, ok = checkExtractorSuite(w, r, extractorTemplate, extractorConfig); !ok {
+			return
+		}
+		extractorTemplate.Extractors = extractorConfig
+		if req.Description != "" {
+			extractorTemplate.Description = req.Description
+		}
+		if err := h.ExtractorTemplateRepo.Update(extractorTemplate, getUserFromContext(r)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save template: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := newExtractorSuiteService().Record(suite); err != nil {
+			log.Printf("Failed to record fixture results of template %d: %v", extractorTemplate.ID, err)
+		}
+	} else {
+		// Create the extractor template
+		extractorTemplate = &models.ExtractorTemplate{
+			Name:        req.TemplateName,
+			Description: req.Description,
+			Extractors:  extractorConfig,
+		}
 
-	if err := h.ExtractorTemplateRepo.Create(extractorTemplate); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to save template: %v", err), http.StatusInternalServerError)
-		return
+		if err := h.ExtractorTemplateRepo.Create(extractorTemplate, getUserFromContext(r)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save template: %v", err), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// Save the generation record (commented out for now - need to create repository)
@@ -493,6 +525,7 @@ func (h *OpenAIHandler) GenerateEmailTemplate(w http.ResponseWriter, r *http.Req
 		Model:            response.Model,
 		TokensUsed:       response.Usage.TotalTokens,
 		CreatedAt:        extractorTemplate.CreatedAt,
+		Suite:            suite,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
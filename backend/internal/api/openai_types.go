@@ -2,6 +2,8 @@ package api
 
 import (
 	"mailman/internal/models"
+	"mailman/internal/secrets"
+	"mailman/internal/services"
 	"time"
 )
 
@@ -71,6 +73,8 @@ type GenerateEmailTemplateRequest struct {
 	Scenario     string `json:"scenario"`
 	TemplateName string `json:"template_name" binding:"required"`
 	Description  string `json:"description,omitempty"`
+	// Replace the extractors of an existing template instead of creating one
+	TemplateID *uint `json:"template_id,omitempty"`
 }
 
 // GenerateEmailTemplateResponse represents the response for AI-generated email template
@@ -84,6 +88,8 @@ type GenerateEmailTemplateResponse struct {
 	Model            string                          `json:"model"`
 	TokensUsed       int                             `json:"tokens_used"`
 	CreatedAt        time.Time                       `json:"created_at"`
+	// Fixture results when an existing template was replaced
+	Suite *services.ExtractorSuiteResult `json:"suite,omitempty"`
 }
 
 // CallOpenAIRequest represents the request to call OpenAI API directly
@@ -140,7 +146,7 @@ func ConvertOpenAIConfigToResponse(config *models.OpenAIConfig) OpenAIConfigResp
 		Name:        config.Name,
 		ChannelType: string(config.ChannelType),
 		BaseURL:     config.BaseURL,
-		APIKey:      config.APIKey, // 不再脱敏，直接返回原始API密钥
+		APIKey:      secrets.Redact(config.APIKey),
 		Model:       config.Model,
 		Headers:     headers,
 		IsActive:    config.IsActive,
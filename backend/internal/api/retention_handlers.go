@@ -0,0 +1,306 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// RetentionHandler handles retention policy API requests
+type RetentionHandler struct {
+	policyRepo       *repository.RetentionPolicyRepository
+	retentionService *services.RetentionService
+}
+
+// NewRetentionHandler creates a new retention handler
+func NewRetentionHandler(policyRepo *repository.RetentionPolicyRepository, retentionService *services.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		policyRepo:       policyRepo,
+		retentionService: retentionService,
+	}
+}
+
+// RetentionPolicyRequest is the body for creating or updating a retention policy
+type RetentionPolicyRequest struct {
+	Name                  string                 `json:"name" example:"Trim promotions"`
+	Description           string                 `json:"description,omitempty"`
+	Target                models.RetentionTarget `json:"target" example:"emails"`
+	Scope                 models.RetentionScope  `json:"scope" example:"mailbox"`
+	AccountID             *uint                  `json:"account_id,omitempty"`
+	MailboxName           string                 `json:"mailbox_name,omitempty" example:"Promotions"`
+	DeleteAfterDays       int                    `json:"delete_after_days" example:"90"`
+	StripContentAfterDays int                    `json:"strip_content_after_days" example:"30"`
+	MaxMessages           int                    `json:"max_messages" example:"0"`
+	Enabled               *bool                  `json:"enabled,omitempty"`
+}
+
+// validate checks the scope, target and rules of the request
+func (req *RetentionPolicyRequest) validate(w http.ResponseWriter) bool {
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return false
+	}
+	if req.Target == "" {
+		req.Target = models.RetentionTargetEmails
+	}
+	if req.Scope == "" {
+		req.Scope = models.RetentionScopeGlobal
+	}
+
+	switch req.Target {
+	case models.RetentionTargetEmails:
+	case models.RetentionTargetTriggerLogs, models.RetentionTargetActivityLogs:
+		if req.Scope != models.RetentionScopeGlobal {
+			http.Error(w, "Log retention policies must use the global scope", http.StatusBadRequest)
+			return false
+		}
+		if req.StripContentAfterDays != 0 {
+			http.Error(w, "strip_content_after_days only applies to emails", http.StatusBadRequest)
+			return false
+		}
+	default:
+		http.Error(w, "Invalid target, expected emails, trigger_execution_logs or activity_logs", http.StatusBadRequest)
+		return false
+	}
+
+	switch req.Scope {
+	case models.RetentionScopeGlobal:
+		req.AccountID = nil
+		req.MailboxName = ""
+	case models.RetentionScopeAccount:
+		if req.AccountID == nil {
+			http.Error(w, "account_id is required for the account scope", http.StatusBadRequest)
+			return false
+		}
+		req.MailboxName = ""
+	case models.RetentionScopeMailbox:
+		if req.MailboxName == "" {
+			http.Error(w, "mailbox_name is required for the mailbox scope", http.StatusBadRequest)
+			return false
+		}
+	default:
+		http.Error(w, "Invalid scope, expected global, account or mailbox", http.StatusBadRequest)
+		return false
+	}
+
+	if req.DeleteAfterDays < 0 || req.StripContentAfterDays < 0 || req.MaxMessages < 0 {
+		http.Error(w, "Retention rules must not be negative", http.StatusBadRequest)
+		return false
+	}
+	if req.DeleteAfterDays == 0 && req.StripContentAfterDays == 0 && req.MaxMessages == 0 {
+		http.Error(w, "At least one of delete_after_days, strip_content_after_days or max_messages is required", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// apply copies the request onto a policy
+func (req *RetentionPolicyRequest) apply(policy *models.RetentionPolicy) {
+	policy.Name = req.Name
+	policy.Description = req.Description
+	policy.Target = req.Target
+	policy.Scope = req.Scope
+	policy.AccountID = req.AccountID
+	policy.MailboxName = req.MailboxName
+	policy.DeleteAfterDays = req.DeleteAfterDays
+	policy.StripContentAfterDays = req.StripContentAfterDays
+	policy.MaxMessages = req.MaxMessages
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+}
+
+// ListRetentionPoliciesHandler lists all retention policies
+// @Summary List retention policies
+// @Tags retention
+// @Produce json
+// @Success 200 {array} models.RetentionPolicy
+// @Failure 500 {object} ErrorResponse
+// @Router /api/retention-policies [get]
+func (h *RetentionHandler) ListRetentionPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.policyRepo.List()
+	if err != nil {
+		http.Error(w, "Failed to retrieve retention policies: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// CreateRetentionPolicyHandler creates a retention policy
+// @Summary Create a retention policy
+// @Description Rules set to 0 are disabled. For emails the most specific policy wins: mailbox > account > global
+// @Tags retention
+// @Accept json
+// @Produce json
+// @Param request body RetentionPolicyRequest true "Retention policy"
+// @Success 201 {object} models.RetentionPolicy
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/retention-policies [post]
+func (h *RetentionHandler) CreateRetentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var req RetentionPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.validate(w) {
+		return
+	}
+
+	policy := &models.RetentionPolicy{Enabled: true}
+	req.apply(policy)
+	if err := h.policyRepo.Create(policy); err != nil {
+		http.Error(w, "Failed to create retention policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !policy.Enabled {
+		// gorm 在创建时会用 default:true 覆盖零值
+		if err := h.policyRepo.Update(policy); err != nil {
+			http.Error(w, "Failed to create retention policy: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(policy)
+}
+
+// GetRetentionPolicyHandler returns a retention policy
+// @Summary Get a retention policy
+// @Tags retention
+// @Produce json
+// @Param id path int true "Retention policy ID"
+// @Success 200 {object} models.RetentionPolicy
+// @Failure 404 {object} ErrorResponse
+// @Router /api/retention-policies/{id} [get]
+func (h *RetentionHandler) GetRetentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.loadPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// UpdateRetentionPolicyHandler updates a retention policy
+// @Summary Update a retention policy
+// @Tags retention
+// @Accept json
+// @Produce json
+// @Param id path int true "Retention policy ID"
+// @Param request body RetentionPolicyRequest true "Retention policy"
+// @Success 200 {object} models.RetentionPolicy
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/retention-policies/{id} [put]
+func (h *RetentionHandler) UpdateRetentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.loadPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	var req RetentionPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.validate(w) {
+		return
+	}
+
+	req.apply(policy)
+	if err := h.policyRepo.Update(policy); err != nil {
+		http.Error(w, "Failed to update retention policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// DeleteRetentionPolicyHandler deletes a retention policy
+// @Summary Delete a retention policy
+// @Tags retention
+// @Param id path int true "Retention policy ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/retention-policies/{id} [delete]
+func (h *RetentionHandler) DeleteRetentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.loadPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.policyRepo.Delete(policy.ID); err != nil {
+		http.Error(w, "Failed to delete retention policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewRetentionHandler shows what the enabled policies would purge
+// @Summary Preview retention purge
+// @Description Dry run of all enabled retention policies, nothing is deleted
+// @Tags retention
+// @Produce json
+// @Success 200 {object} services.RetentionReport
+// @Failure 500 {object} ErrorResponse
+// @Router /api/retention/preview [get]
+func (h *RetentionHandler) PreviewRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := h.retentionService.Preview()
+	if err != nil {
+		http.Error(w, "Failed to preview retention: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RunRetentionHandler enforces the enabled policies immediately
+// @Summary Run retention purge
+// @Description Enforce all enabled retention policies now instead of waiting for the background job
+// @Tags retention
+// @Produce json
+// @Success 200 {object} services.RetentionReport
+// @Failure 500 {object} ErrorResponse
+// @Router /api/retention/run [post]
+func (h *RetentionHandler) RunRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := h.retentionService.Run(false)
+	if err != nil {
+		http.Error(w, "Failed to run retention: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// loadPolicy resolves the {id} path variable, writing the error response on failure
+func (h *RetentionHandler) loadPolicy(w http.ResponseWriter, r *http.Request) (*models.RetentionPolicy, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid retention policy ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	policy, err := h.policyRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Retention policy not found", http.StatusNotFound)
+		return nil, false
+	}
+	return policy, true
+}
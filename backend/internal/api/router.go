@@ -77,6 +77,22 @@ func NewRouter(handler *APIHandler, openAIHandler *OpenAIHandler) http.Handler {
 	apiRouter.HandleFunc("/extractor-templates/{id}", handler.UpdateExtractorTemplateHandler).Methods("PUT")
 	apiRouter.HandleFunc("/extractor-templates/{id}", handler.DeleteExtractorTemplateHandler).Methods("DELETE")
 	apiRouter.HandleFunc("/extractor-templates/{id}/test", handler.TestExtractorTemplateHandler).Methods("POST")
+	apiRouter.HandleFunc("/extractor-templates/{id}/revisions", handler.GetExtractorTemplateRevisionsHandler).Methods("GET")
+	apiRouter.HandleFunc("/extractor-templates/{id}/revisions/diff", handler.DiffExtractorTemplateRevisionsHandler).Methods("GET")
+	apiRouter.HandleFunc("/extractor-templates/{id}/revisions/{revision:[0-9]+}", handler.GetExtractorTemplateRevisionHandler).Methods("GET")
+	apiRouter.HandleFunc("/extractor-templates/{id}/revisions/{revision:[0-9]+}/restore", handler.RestoreExtractorTemplateRevisionHandler).Methods("POST")
+	apiRouter.HandleFunc("/extractor-templates/{id}/fixtures", handler.GetExtractorFixturesHandler).Methods("GET")
+	apiRouter.HandleFunc("/extractor-templates/{id}/fixtures", handler.CreateExtractorFixtureHandler).Methods("POST")
+	apiRouter.HandleFunc("/extractor-templates/{id}/fixtures/eml", handler.UploadExtractorFixtureHandler).Methods("POST")
+	apiRouter.HandleFunc("/extractor-templates/{id}/fixtures/run", handler.RunExtractorSuiteHandler).Methods("POST")
+	apiRouter.HandleFunc("/extractor-templates/{id}/fixtures/{fixtureId:[0-9]+}", handler.UpdateExtractorFixtureHandler).Methods("PUT")
+	apiRouter.HandleFunc("/extractor-templates/{id}/fixtures/{fixtureId:[0-9]+}", handler.DeleteExtractorFixtureHandler).Methods("DELETE")
+
+	apiRouter.HandleFunc("/extractors/builtin", handler.GetBuiltinExtractorsHandler).Methods("GET")
+
+	// Extracted values
+	apiRouter.HandleFunc("/extracted-values", handler.GetExtractedValuesHandler).Methods("GET")
+	apiRouter.HandleFunc("/extracted-values/aggregate", handler.AggregateExtractedValuesHandler).Methods("GET")
 
 	// OpenAI Configuration endpoints
 	apiRouter.HandleFunc("/openai/configs", openAIHandler.ListOpenAIConfigs).Methods("GET")
@@ -131,7 +147,7 @@ func NewRouter(handler *APIHandler, openAIHandler *OpenAIHandler) http.Handler {
 func enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
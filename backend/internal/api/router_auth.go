@@ -10,7 +10,7 @@ import (
 )
 
 // NewRouterWithAuth creates a new router with authentication middleware
-func NewRouterWithAuth(handler *APIHandler, openAIHandler *OpenAIHandler, authHandler *AuthHandler, syncHandlers *SyncHandlers, sessionHandler *SessionHandler, triggerHandler *TriggerAPIHandler, oauth2Handler *OAuth2Handler, authService *services.AuthService) http.Handler {
+func NewRouterWithAuth(handler *APIHandler, openAIHandler *OpenAIHandler, authHandler *AuthHandler, syncHandlers *SyncHandlers, sessionHandler *SessionHandler, triggerHandler *TriggerAPIHandler, savedSearchHandler *SavedSearchHandler, retentionHandler *RetentionHandler, exportHandler *ExportHandler, tagHandler *TagHandler, contactHandler *ContactHandler, attachmentHandler *AttachmentHandler, backupHandler *BackupHandler, bundleHandler *BundleHandler, extractionPipelineHandler *ExtractionPipelineHandler, oauth2Handler *OAuth2Handler, authService *services.AuthService) http.Handler {
 	router := mux.NewRouter()
 
 	// Create logger for HTTP logging
@@ -76,7 +76,15 @@ func NewRouterWithAuth(handler *APIHandler, openAIHandler *OpenAIHandler, authHa
 	// General email operations (protected)
 	authRouter.HandleFunc("/emails/extract", handler.ExtractEmailsHandler).Methods("POST")
 	authRouter.HandleFunc("/emails/search", handler.SearchEmailsHandler).Methods("GET") // 添加搜索路由
+	authRouter.HandleFunc("/emails/search/reindex", handler.ReindexSearchHandler).Methods("POST")
+	authRouter.HandleFunc("/emails/search/parse", handler.ParseSearchQueryHandler).Methods("GET")
+	authRouter.HandleFunc("/emails/export", exportHandler.ExportEmailsHandler).Methods("GET")
+	authRouter.HandleFunc("/emails/bulk/tag", tagHandler.BulkTagEmailsHandler).Methods("POST")
+	authRouter.HandleFunc("/emails/bulk/untag", tagHandler.BulkUntagEmailsHandler).Methods("POST")
+	authRouter.HandleFunc("/emails/bulk/state", tagHandler.BulkUpdateEmailStateHandler).Methods("POST")
 	authRouter.HandleFunc("/emails/{id}", handler.GetEmailHandler).Methods("GET")
+	authRouter.HandleFunc("/emails/{id}/tags", tagHandler.SetEmailTagsHandler).Methods("PUT")
+	authRouter.HandleFunc("/emails/{id}/state", tagHandler.UpdateEmailStateHandler).Methods("PATCH")
 
 	// Legacy endpoint (protected)
 	authRouter.HandleFunc("/fetch-emails", handler.FetchEmailsHandler).Methods("POST")
@@ -111,6 +119,30 @@ func NewRouterWithAuth(handler *APIHandler, openAIHandler *OpenAIHandler, authHa
 	authRouter.HandleFunc("/extractor-templates/{id}", handler.UpdateExtractorTemplateHandler).Methods("PUT")
 	authRouter.HandleFunc("/extractor-templates/{id}", handler.DeleteExtractorTemplateHandler).Methods("DELETE")
 	authRouter.HandleFunc("/extractor-templates/{id}/test", handler.TestExtractorTemplateHandler).Methods("POST")
+	authRouter.HandleFunc("/extractor-templates/{id}/revisions", handler.GetExtractorTemplateRevisionsHandler).Methods("GET")
+	authRouter.HandleFunc("/extractor-templates/{id}/revisions/diff", handler.DiffExtractorTemplateRevisionsHandler).Methods("GET")
+	authRouter.HandleFunc("/extractor-templates/{id}/revisions/{revision:[0-9]+}", handler.GetExtractorTemplateRevisionHandler).Methods("GET")
+	authRouter.HandleFunc("/extractor-templates/{id}/revisions/{revision:[0-9]+}/restore", handler.RestoreExtractorTemplateRevisionHandler).Methods("POST")
+	authRouter.HandleFunc("/extractor-templates/{id}/fixtures", handler.GetExtractorFixturesHandler).Methods("GET")
+	authRouter.HandleFunc("/extractor-templates/{id}/fixtures", handler.CreateExtractorFixtureHandler).Methods("POST")
+	authRouter.HandleFunc("/extractor-templates/{id}/fixtures/eml", handler.UploadExtractorFixtureHandler).Methods("POST")
+	authRouter.HandleFunc("/extractor-templates/{id}/fixtures/run", handler.RunExtractorSuiteHandler).Methods("POST")
+	authRouter.HandleFunc("/extractor-templates/{id}/fixtures/{fixtureId:[0-9]+}", handler.UpdateExtractorFixtureHandler).Methods("PUT")
+	authRouter.HandleFunc("/extractor-templates/{id}/fixtures/{fixtureId:[0-9]+}", handler.DeleteExtractorFixtureHandler).Methods("DELETE")
+
+	authRouter.HandleFunc("/extractors/builtin", handler.GetBuiltinExtractorsHandler).Methods("GET")
+
+	// Extracted values
+	authRouter.HandleFunc("/extracted-values", handler.GetExtractedValuesHandler).Methods("GET")
+	authRouter.HandleFunc("/extracted-values/aggregate", handler.AggregateExtractedValuesHandler).Methods("GET")
+
+	// Extraction pipelines
+	authRouter.HandleFunc("/extraction-pipelines", extractionPipelineHandler.ListExtractionPipelinesHandler).Methods("GET")
+	authRouter.HandleFunc("/extraction-pipelines", extractionPipelineHandler.CreateExtractionPipelineHandler).Methods("POST")
+	authRouter.HandleFunc("/extraction-pipelines/{id}", extractionPipelineHandler.GetExtractionPipelineHandler).Methods("GET")
+	authRouter.HandleFunc("/extraction-pipelines/{id}", extractionPipelineHandler.UpdateExtractionPipelineHandler).Methods("PUT")
+	authRouter.HandleFunc("/extraction-pipelines/{id}", extractionPipelineHandler.DeleteExtractionPipelineHandler).Methods("DELETE")
+	authRouter.HandleFunc("/ws/extractions", extractionPipelineHandler.ExtractionWebSocketHandler).Methods("GET")
 
 	// OpenAI Configuration endpoints (protected)
 	authRouter.HandleFunc("/openai/configs", openAIHandler.ListOpenAIConfigs).Methods("GET")
@@ -168,9 +200,66 @@ func NewRouterWithAuth(handler *APIHandler, openAIHandler *OpenAIHandler, authHa
 	authRouter.HandleFunc("/triggers/{id}", triggerHandler.DeleteTriggerHandler).Methods("DELETE")
 	authRouter.HandleFunc("/triggers/{id}/enable", triggerHandler.EnableTriggerHandler).Methods("POST")
 	authRouter.HandleFunc("/triggers/{id}/disable", triggerHandler.DisableTriggerHandler).Methods("POST")
+	authRouter.HandleFunc("/triggers/{id}/rerun", triggerHandler.RerunTriggerHandler).Methods("POST")
+	authRouter.HandleFunc("/triggers/{id}/ledger", triggerHandler.GetTriggerLedgerHandler).Methods("GET")
 	authRouter.HandleFunc("/trigger-logs", triggerHandler.GetTriggerExecutionLogsHandler).Methods("GET")
 	authRouter.HandleFunc("/trigger-stats", triggerHandler.GetTriggerStatsHandler).Methods("GET")
 
+	// Saved search endpoints (protected)
+	authRouter.HandleFunc("/saved-searches", savedSearchHandler.ListSavedSearchesHandler).Methods("GET")
+	authRouter.HandleFunc("/saved-searches", savedSearchHandler.CreateSavedSearchHandler).Methods("POST")
+	authRouter.HandleFunc("/saved-searches/{id}", savedSearchHandler.GetSavedSearchHandler).Methods("GET")
+	authRouter.HandleFunc("/saved-searches/{id}", savedSearchHandler.UpdateSavedSearchHandler).Methods("PUT")
+	authRouter.HandleFunc("/saved-searches/{id}", savedSearchHandler.DeleteSavedSearchHandler).Methods("DELETE")
+	authRouter.HandleFunc("/saved-searches/{id}/emails", savedSearchHandler.RunSavedSearchHandler).Methods("GET")
+
+	// Retention policy routes
+	authRouter.HandleFunc("/retention-policies", retentionHandler.ListRetentionPoliciesHandler).Methods("GET")
+	authRouter.HandleFunc("/retention-policies", retentionHandler.CreateRetentionPolicyHandler).Methods("POST")
+	authRouter.HandleFunc("/retention-policies/{id}", retentionHandler.GetRetentionPolicyHandler).Methods("GET")
+	authRouter.HandleFunc("/retention-policies/{id}", retentionHandler.UpdateRetentionPolicyHandler).Methods("PUT")
+	authRouter.HandleFunc("/retention-policies/{id}", retentionHandler.DeleteRetentionPolicyHandler).Methods("DELETE")
+	authRouter.HandleFunc("/retention/preview", retentionHandler.PreviewRetentionHandler).Methods("GET")
+	authRouter.HandleFunc("/retention/run", retentionHandler.RunRetentionHandler).Methods("POST")
+
+	// Backup and restore routes
+	authRouter.HandleFunc("/admin/backup", backupHandler.CreateBackupHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/restore", backupHandler.RestoreBackupHandler).Methods("POST")
+
+	// Configuration bundle routes
+	authRouter.HandleFunc("/admin/bundle", bundleHandler.ExportBundleHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/bundle/import", bundleHandler.ImportBundleHandler).Methods("POST")
+
+	// Tag routes
+	authRouter.HandleFunc("/tags", tagHandler.ListTagsHandler).Methods("GET")
+	authRouter.HandleFunc("/tags", tagHandler.CreateTagHandler).Methods("POST")
+	authRouter.HandleFunc("/tags/{id}", tagHandler.GetTagHandler).Methods("GET")
+	authRouter.HandleFunc("/tags/{id}", tagHandler.UpdateTagHandler).Methods("PUT")
+	authRouter.HandleFunc("/tags/{id}", tagHandler.DeleteTagHandler).Methods("DELETE")
+
+	// Contact routes
+	authRouter.HandleFunc("/contacts", contactHandler.ListContactsHandler).Methods("GET")
+	authRouter.HandleFunc("/contacts/export", contactHandler.ExportContactsHandler).Methods("GET")
+	authRouter.HandleFunc("/contacts/correspondents", contactHandler.CorrespondentsHandler).Methods("GET")
+	authRouter.HandleFunc("/contacts/merge", contactHandler.MergeContactsHandler).Methods("POST")
+	authRouter.HandleFunc("/contacts/import", contactHandler.ImportContactsHandler).Methods("POST")
+	authRouter.HandleFunc("/contacts/import/attachments", contactHandler.ImportAttachmentContactsHandler).Methods("POST")
+	authRouter.HandleFunc("/contacts/rebuild", contactHandler.RebuildContactsHandler).Methods("POST")
+	authRouter.HandleFunc("/contacts/{id}", contactHandler.GetContactHandler).Methods("GET")
+	authRouter.HandleFunc("/contacts/{id}", contactHandler.UpdateContactHandler).Methods("PUT")
+
+	// Attachment text routes
+	authRouter.HandleFunc("/attachments/text/stats", attachmentHandler.GetAttachmentTextStatsHandler).Methods("GET")
+	authRouter.HandleFunc("/attachments/text/retry", attachmentHandler.RetryAttachmentTextHandler).Methods("POST")
+	authRouter.HandleFunc("/attachments/{id}/text", attachmentHandler.GetAttachmentTextHandler).Methods("GET")
+
+	// Export job routes
+	authRouter.HandleFunc("/exports", exportHandler.ListExportJobsHandler).Methods("GET")
+	authRouter.HandleFunc("/exports", exportHandler.CreateExportJobHandler).Methods("POST")
+	authRouter.HandleFunc("/exports/{id}", exportHandler.GetExportJobHandler).Methods("GET")
+	authRouter.HandleFunc("/exports/{id}", exportHandler.DeleteExportJobHandler).Methods("DELETE")
+	authRouter.HandleFunc("/exports/{id}/download", exportHandler.DownloadExportHandler).Methods("GET")
+
 	// Activity log endpoints (protected)
 	authRouter.HandleFunc("/activities/recent", GetRecentActivities).Methods("GET")
 	authRouter.HandleFunc("/activities/stats", GetActivityStats).Methods("GET")
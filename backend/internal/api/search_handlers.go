@@ -0,0 +1,361 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/searchquery"
+
+	"github.com/gorilla/mux"
+)
+
+// SearchQueryErrorResponse describes an invalid search query
+type SearchQueryErrorResponse struct {
+	Error    string `json:"error" example:"invalid search query at position 8: unterminated quoted string"`
+	Position int    `json:"position" example:"8"`
+	Message  string `json:"message" example:"unterminated quoted string"`
+}
+
+// respondWithQueryError writes a 400 response when err is a search query error
+// and reports whether it did so
+func respondWithQueryError(w http.ResponseWriter, err error) bool {
+	var parseErr *searchquery.ParseError
+	if !errors.As(err, &parseErr) {
+		return false
+	}
+	RespondWithJSON(w, http.StatusBadRequest, SearchQueryErrorResponse{
+		Error:    parseErr.Error(),
+		Position: parseErr.Position,
+		Message:  parseErr.Message,
+	})
+	return true
+}
+
+// parseFacetParams reads the facets, facet_interval and facet_limit query parameters
+func parseFacetParams(r *http.Request, options *repository.EmailSearchOptions) error {
+	if raw := r.URL.Query().Get("facets"); raw != "" {
+		for _, facet := range strings.Split(raw, ",") {
+			facet = strings.TrimSpace(facet)
+			if facet == "" {
+				continue
+			}
+			if !repository.IsValidFacet(facet) {
+				return fmt.Errorf("unknown facet %q, expected one of %s", facet, strings.Join(repository.ValidFacets, ", "))
+			}
+			options.Facets = append(options.Facets, facet)
+		}
+	}
+
+	options.FacetInterval = r.URL.Query().Get("facet_interval")
+	if !repository.IsValidFacetInterval(options.FacetInterval) {
+		return fmt.Errorf("invalid facet_interval %q, expected day, week or month", options.FacetInterval)
+	}
+
+	if l := r.URL.Query().Get("facet_limit"); l != "" {
+		if limit, err := strconv.Atoi(l); err == nil && limit > 0 {
+			if limit > 100 {
+				limit = 100
+			}
+			options.FacetLimit = limit
+		}
+	}
+	return nil
+}
+
+// ParseSearchQueryHandler validates a search query and returns its syntax tree
+// @Summary Parse a search query
+// @Description Validate a Gmail-style search query and return its canonical form and syntax tree
+// @Tags emails
+// @Produce json
+// @Param q query string true "Search query, e.g. from:github subject:(verify OR confirm) newer_than:2d"
+// @Success 200 {object} map[string]interface{} "Canonical query and AST"
+// @Failure 400 {object} SearchQueryErrorResponse
+// @Router /api/emails/search/parse [get]
+func (h *APIHandler) ParseSearchQueryHandler(w http.ResponseWriter, r *http.Request) {
+	node, err := searchquery.Parse(r.URL.Query().Get("q"))
+	if err != nil {
+		if !respondWithQueryError(w, err) {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"query": "",
+		"ast":   node,
+	}
+	if node != nil {
+		response["query"] = node.String()
+	}
+	RespondWithJSON(w, http.StatusOK, response)
+}
+
+// SavedSearchHandler handles saved search API requests
+type SavedSearchHandler struct {
+	savedSearchRepo *repository.SavedSearchRepository
+	emailRepo       *repository.EmailRepository
+}
+
+// NewSavedSearchHandler creates a new saved search handler
+func NewSavedSearchHandler(savedSearchRepo *repository.SavedSearchRepository, emailRepo *repository.EmailRepository) *SavedSearchHandler {
+	return &SavedSearchHandler{
+		savedSearchRepo: savedSearchRepo,
+		emailRepo:       emailRepo,
+	}
+}
+
+// SavedSearchRequest is the body for creating or updating a saved search
+type SavedSearchRequest struct {
+	Name        string `json:"name" example:"GitHub verification"`
+	Description string `json:"description,omitempty"`
+	Query       string `json:"query" example:"from:github subject:(verify OR confirm) newer_than:2d"`
+}
+
+// validate checks the request and the query syntax
+func (req *SavedSearchRequest) validate(w http.ResponseWriter) bool {
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return false
+	}
+	if req.Query == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return false
+	}
+	if _, err := searchquery.Parse(req.Query); err != nil {
+		respondWithQueryError(w, err)
+		return false
+	}
+	return true
+}
+
+// ListSavedSearchesHandler lists all saved searches
+// @Summary List saved searches
+// @Tags saved-searches
+// @Produce json
+// @Success 200 {array} models.SavedSearch
+// @Failure 500 {object} ErrorResponse
+// @Router /api/saved-searches [get]
+func (h *SavedSearchHandler) ListSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	searches, err := h.savedSearchRepo.List()
+	if err != nil {
+		http.Error(w, "Failed to retrieve saved searches: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(searches)
+}
+
+// CreateSavedSearchHandler creates a saved search
+// @Summary Create a saved search
+// @Tags saved-searches
+// @Accept json
+// @Produce json
+// @Param request body SavedSearchRequest true "Saved search"
+// @Success 201 {object} models.SavedSearch
+// @Failure 400 {object} SearchQueryErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/saved-searches [post]
+func (h *SavedSearchHandler) CreateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var req SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.validate(w) {
+		return
+	}
+
+	search := &models.SavedSearch{
+		Name:        req.Name,
+		Description: req.Description,
+		Query:       req.Query,
+	}
+	if err := h.savedSearchRepo.Create(search); err != nil {
+		http.Error(w, "Failed to create saved search: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(search)
+}
+
+// GetSavedSearchHandler returns a saved search
+// @Summary Get a saved search
+// @Tags saved-searches
+// @Produce json
+// @Param id path int true "Saved search ID"
+// @Success 200 {object} models.SavedSearch
+// @Failure 404 {object} ErrorResponse
+// @Router /api/saved-searches/{id} [get]
+func (h *SavedSearchHandler) GetSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := h.loadSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(search)
+}
+
+// UpdateSavedSearchHandler updates a saved search
+// @Summary Update a saved search
+// @Tags saved-searches
+// @Accept json
+// @Produce json
+// @Param id path int true "Saved search ID"
+// @Param request body SavedSearchRequest true "Saved search"
+// @Success 200 {object} models.SavedSearch
+// @Failure 400 {object} SearchQueryErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/saved-searches/{id} [put]
+func (h *SavedSearchHandler) UpdateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := h.loadSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	var req SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.validate(w) {
+		return
+	}
+
+	search.Name = req.Name
+	search.Description = req.Description
+	search.Query = req.Query
+	if err := h.savedSearchRepo.Update(search); err != nil {
+		http.Error(w, "Failed to update saved search: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(search)
+}
+
+// DeleteSavedSearchHandler deletes a saved search
+// @Summary Delete a saved search
+// @Tags saved-searches
+// @Param id path int true "Saved search ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/saved-searches/{id} [delete]
+func (h *SavedSearchHandler) DeleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := h.loadSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.savedSearchRepo.Delete(search.ID); err != nil {
+		http.Error(w, "Failed to delete saved search: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunSavedSearchHandler runs a saved search
+// @Summary Run a saved search
+// @Description Return the emails matching a saved search
+// @Tags saved-searches
+// @Produce json
+// @Param id path int true "Saved search ID"
+// @Param limit query int false "Number of emails to return (default 20, max 100)"
+// @Param offset query int false "Offset for pagination"
+// @Param sort_by query string false "Sort order (date_desc, date_asc, relevance)"
+// @Param facets query string false "Comma separated facets: account, mailbox, sender_domain, date, has_attachment, read_state"
+// @Param facet_interval query string false "Date facet bucket size: day (default), week or month"
+// @Param facet_limit query int false "Maximum buckets per facet (default 20, max 100)"
+// @Success 200 {object} map[string]interface{} "Emails, pagination info, highlights and facets"
+// @Failure 400 {object} SearchQueryErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/saved-searches/{id}/emails [get]
+func (h *SavedSearchHandler) RunSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := h.loadSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	offset := 0
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	sortBy := "date DESC"
+	switch r.URL.Query().Get("sort_by") {
+	case "date_asc":
+		sortBy = "date ASC"
+	case "relevance":
+		sortBy = repository.SortByRelevance
+	}
+
+	options := repository.EmailSearchOptions{
+		Query:     search.Query,
+		Limit:     limit,
+		Offset:    offset,
+		SortBy:    sortBy,
+		Highlight: true,
+	}
+	if err := parseFacetParams(r, &options); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.emailRepo.SearchEmailsDetailed(options)
+	if err != nil {
+		if !respondWithQueryError(w, err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"saved_search": search,
+		"emails":       result.Emails,
+		"total":        result.Total,
+		"limit":        limit,
+		"offset":       offset,
+		"has_more":     int64(offset+limit) < result.Total,
+	}
+	if result.Highlights != nil {
+		response["highlights"] = result.Highlights
+	}
+	if result.Facets != nil {
+		response["facets"] = result.Facets
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadSavedSearch resolves the {id} path variable, writing the error response on failure
+func (h *SavedSearchHandler) loadSavedSearch(w http.ResponseWriter, r *http.Request) (*models.SavedSearch, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid saved search ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	search, err := h.savedSearchRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return nil, false
+	}
+	return search, true
+}
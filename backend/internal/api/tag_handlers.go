@@ -0,0 +1,485 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// maxBulkEmails limits the number of emails changed by one bulk request
+const maxBulkEmails = 5000
+
+// TagHandler handles user tag and local email state API requests
+type TagHandler struct {
+	tagRepo   *repository.TagRepository
+	emailRepo *repository.EmailRepository
+}
+
+// NewTagHandler creates a new tag handler
+func NewTagHandler(tagRepo *repository.TagRepository, emailRepo *repository.EmailRepository) *TagHandler {
+	return &TagHandler{
+		tagRepo:   tagRepo,
+		emailRepo: emailRepo,
+	}
+}
+
+// TagRequest is the body for creating or updating a tag
+type TagRequest struct {
+	Name        string `json:"name" example:"invoices"`
+	Color       string `json:"color,omitempty" example:"#ff9900"`
+	Description string `json:"description,omitempty"`
+}
+
+// BulkTagRequest tags or untags many emails at once. Tags can be given by ID
+// or by name; tagging with an unknown name creates the tag.
+type BulkTagRequest struct {
+	EmailIDs []uint   `json:"email_ids"`
+	TagIDs   []uint   `json:"tag_ids,omitempty"`
+	Tags     []string `json:"tags,omitempty" example:"invoices"`
+}
+
+// BulkTagResponse reports the outcome of a bulk tag request
+type BulkTagResponse struct {
+	Tags    []models.Tag `json:"tags"`
+	Changed int64        `json:"changed"` // Number of added or removed email/tag associations
+}
+
+// SetEmailTagsRequest replaces the tags of one email
+type SetEmailTagsRequest struct {
+	Tags []string `json:"tags" example:"invoices"`
+}
+
+// BulkStateRequest changes the local state of many emails at once
+type BulkStateRequest struct {
+	EmailIDs []uint `json:"email_ids"`
+	repository.EmailStateUpdate
+}
+
+// ListTagsHandler lists all tags
+// @Summary List tags
+// @Description List user tags with the number of emails carrying each tag
+// @Tags tags
+// @Produce json
+// @Success 200 {array} models.Tag
+// @Failure 500 {object} ErrorResponse
+// @Router /api/tags [get]
+func (h *TagHandler) ListTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.tagRepo.List()
+	if err != nil {
+		http.Error(w, "Failed to retrieve tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// CreateTagHandler creates a tag
+// @Summary Create a tag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param request body TagRequest true "Tag"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/tags [post]
+func (h *TagHandler) CreateTagHandler(w http.ResponseWriter, r *http.Request) {
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.tagRepo.GetByName(req.Name); err == nil {
+		http.Error(w, "Tag already exists", http.StatusConflict)
+		return
+	}
+
+	tag := &models.Tag{Name: req.Name, Color: req.Color, Description: req.Description}
+	if err := h.tagRepo.Create(tag); err != nil {
+		http.Error(w, "Failed to create tag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// GetTagHandler returns a tag
+// @Summary Get a tag
+// @Tags tags
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 200 {object} models.Tag
+// @Failure 404 {object} ErrorResponse
+// @Router /api/tags/{id} [get]
+func (h *TagHandler) GetTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// UpdateTagHandler renames or recolors a tag
+// @Summary Update a tag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param request body TagRequest true "Tag"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/tags/{id} [put]
+func (h *TagHandler) UpdateTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if existing, err := h.tagRepo.GetByName(req.Name); err == nil && existing.ID != tag.ID {
+		http.Error(w, "Tag already exists", http.StatusConflict)
+		return
+	}
+
+	tag.Name = req.Name
+	tag.Color = req.Color
+	tag.Description = req.Description
+	if err := h.tagRepo.Update(tag); err != nil {
+		http.Error(w, "Failed to update tag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTagHandler deletes a tag and removes it from all emails
+// @Summary Delete a tag
+// @Tags tags
+// @Param id path int true "Tag ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/tags/{id} [delete]
+func (h *TagHandler) DeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.tagRepo.Delete(tag.ID); err != nil {
+		http.Error(w, "Failed to delete tag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BulkTagEmailsHandler adds tags to many emails
+// @Summary Tag emails
+// @Description Add tags to many emails; tags given by name are created when missing
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param request body BulkTagRequest true "Emails and tags"
+// @Success 200 {object} BulkTagResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/emails/bulk/tag [post]
+func (h *TagHandler) BulkTagEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	h.bulkTag(w, r, true)
+}
+
+// BulkUntagEmailsHandler removes tags from many emails
+// @Summary Untag emails
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param request body BulkTagRequest true "Emails and tags"
+// @Success 200 {object} BulkTagResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/emails/bulk/untag [post]
+func (h *TagHandler) BulkUntagEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	h.bulkTag(w, r, false)
+}
+
+func (h *TagHandler) bulkTag(w http.ResponseWriter, r *http.Request, add bool) {
+	var req BulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validateBulkEmailIDs(w, req.EmailIDs) {
+		return
+	}
+	if len(req.TagIDs) == 0 && len(req.Tags) == 0 {
+		http.Error(w, "tag_ids or tags is required", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := h.tagRepo.GetByIDs(req.TagIDs)
+	if err != nil {
+		http.Error(w, "Failed to resolve tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(tags) != len(uniqueIDs(req.TagIDs)) {
+		http.Error(w, "Unknown tag ID", http.StatusBadRequest)
+		return
+	}
+
+	if add {
+		named, err := h.tagRepo.FindOrCreate(req.Tags)
+		if err != nil {
+			http.Error(w, "Failed to resolve tags: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, named...)
+	} else {
+		for _, name := range req.Tags {
+			if tag, err := h.tagRepo.GetByName(name); err == nil {
+				tags = append(tags, *tag)
+			}
+		}
+	}
+
+	ids := make([]uint, 0, len(tags))
+	for _, tag := range tags {
+		ids = append(ids, tag.ID)
+	}
+
+	var changed int64
+	if add {
+		changed, err = h.tagRepo.AddToEmails(req.EmailIDs, uniqueIDs(ids))
+	} else {
+		changed, err = h.tagRepo.RemoveFromEmails(req.EmailIDs, uniqueIDs(ids))
+	}
+	if err != nil {
+		http.Error(w, "Failed to update tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BulkTagResponse{Tags: tags, Changed: changed})
+}
+
+// SetEmailTagsHandler replaces the tags of an email
+// @Summary Set email tags
+// @Description Replace the tags of an email; unknown tag names are created
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Email ID"
+// @Param request body SetEmailTagsRequest true "Tag names"
+// @Success 200 {array} models.Tag
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/emails/{id}/tags [put]
+func (h *TagHandler) SetEmailTagsHandler(w http.ResponseWriter, r *http.Request) {
+	email, ok := h.loadEmail(w, r)
+	if !ok {
+		return
+	}
+
+	var req SetEmailTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tags, err := h.tagRepo.FindOrCreate(req.Tags)
+	if err != nil {
+		http.Error(w, "Failed to resolve tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	keep := make(map[uint]bool, len(tags))
+	var add []uint
+	for _, tag := range tags {
+		keep[tag.ID] = true
+		add = append(add, tag.ID)
+	}
+	var remove []uint
+	for _, tag := range email.Tags {
+		if !keep[tag.ID] {
+			remove = append(remove, tag.ID)
+		}
+	}
+
+	if _, err := h.tagRepo.RemoveFromEmails([]uint{email.ID}, remove); err != nil {
+		http.Error(w, "Failed to update tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.tagRepo.AddToEmails([]uint{email.ID}, add); err != nil {
+		http.Error(w, "Failed to update tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// UpdateEmailStateHandler changes the local state of an email
+// @Summary Update email state
+// @Description Set the local read, starred or archived state of an email; omitted fields are unchanged
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Email ID"
+// @Param request body repository.EmailStateUpdate true "State"
+// @Success 200 {object} models.Email
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/emails/{id}/state [patch]
+func (h *TagHandler) UpdateEmailStateHandler(w http.ResponseWriter, r *http.Request) {
+	email, ok := h.loadEmail(w, r)
+	if !ok {
+		return
+	}
+
+	var update repository.EmailStateUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if update.IsEmpty() {
+		http.Error(w, "At least one of read, starred or archived is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.emailRepo.UpdateLocalState([]uint{email.ID}, update); err != nil {
+		http.Error(w, "Failed to update email state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	email, err := h.emailRepo.GetByID(email.ID)
+	if err != nil {
+		http.Error(w, "Failed to reload email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(email)
+}
+
+// BulkUpdateEmailStateHandler changes the local state of many emails
+// @Summary Update state of emails
+// @Description Set the local read, starred or archived state of many emails; omitted fields are unchanged
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param request body BulkStateRequest true "Emails and state"
+// @Success 200 {object} map[string]int64 "Number of updated emails"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/emails/bulk/state [post]
+func (h *TagHandler) BulkUpdateEmailStateHandler(w http.ResponseWriter, r *http.Request) {
+	var req BulkStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validateBulkEmailIDs(w, req.EmailIDs) {
+		return
+	}
+	if req.IsEmpty() {
+		http.Error(w, "At least one of read, starred or archived is required", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.emailRepo.UpdateLocalState(req.EmailIDs, req.EmailStateUpdate)
+	if err != nil {
+		http.Error(w, "Failed to update email state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"updated": updated})
+}
+
+// loadTag resolves the {id} path variable, writing the error response on failure
+func (h *TagHandler) loadTag(w http.ResponseWriter, r *http.Request) (*models.Tag, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	tag, err := h.tagRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return nil, false
+	}
+	return tag, true
+}
+
+// loadEmail resolves the {id} path variable of an email route
+func (h *TagHandler) loadEmail(w http.ResponseWriter, r *http.Request) (*models.Email, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	email, err := h.emailRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return nil, false
+	}
+	return email, true
+}
+
+// validateBulkEmailIDs checks the email IDs of a bulk request
+func validateBulkEmailIDs(w http.ResponseWriter, ids []uint) bool {
+	if len(ids) == 0 {
+		http.Error(w, "email_ids is required", http.StatusBadRequest)
+		return false
+	}
+	if len(ids) > maxBulkEmails {
+		http.Error(w, "Too many emails in one request, the limit is "+strconv.Itoa(maxBulkEmails), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// uniqueIDs removes duplicate IDs, keeping the first occurrence
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
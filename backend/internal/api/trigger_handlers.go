@@ -2,12 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mailman/internal/models"
 	"mailman/internal/repository"
+	"mailman/internal/searchquery"
 	"mailman/internal/services"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -18,6 +21,7 @@ type TriggerAPIHandler struct {
 	triggerService *services.TriggerService
 	triggerRepo    *repository.TriggerRepository
 	logRepo        *repository.TriggerExecutionLogRepository
+	ledgerRepo     *repository.TriggerLedgerRepository
 	activityLogger *services.ActivityLogger
 }
 
@@ -26,11 +30,13 @@ func NewTriggerAPIHandler(
 	triggerService *services.TriggerService,
 	triggerRepo *repository.TriggerRepository,
 	logRepo *repository.TriggerExecutionLogRepository,
+	ledgerRepo *repository.TriggerLedgerRepository,
 ) *TriggerAPIHandler {
 	return &TriggerAPIHandler{
 		triggerService: triggerService,
 		triggerRepo:    triggerRepo,
 		logRepo:        logRepo,
+		ledgerRepo:     ledgerRepo,
 		activityLogger: services.GetActivityLogger(),
 	}
 }
@@ -40,6 +46,8 @@ type CreateTriggerRequest struct {
 	Name          string                        `json:"name"`
 	Description   string                        `json:"description,omitempty"`
 	CheckInterval int                           `json:"check_interval"`
+	AccountIDs    []uint                        `json:"account_ids,omitempty"`
+	AccountTags   []string                      `json:"account_tags,omitempty"`
 	EmailAddress  string                        `json:"email_address,omitempty"`
 	Subject       string                        `json:"subject,omitempty"`
 	From          string                        `json:"from,omitempty"`
@@ -49,6 +57,7 @@ type CreateTriggerRequest struct {
 	Labels        []string                      `json:"labels,omitempty"`
 	Folders       []string                      `json:"folders,omitempty"`
 	CustomFilters map[string]string             `json:"custom_filters,omitempty"`
+	Query         string                        `json:"query,omitempty"`
 	Condition     models.TriggerConditionConfig `json:"condition"`
 	Actions       []models.TriggerActionConfig  `json:"actions"`
 	EnableLogging bool                          `json:"enable_logging"`
@@ -60,6 +69,8 @@ type UpdateTriggerRequest struct {
 	Name          *string                        `json:"name,omitempty"`
 	Description   *string                        `json:"description,omitempty"`
 	CheckInterval *int                           `json:"check_interval,omitempty"`
+	AccountIDs    []uint                         `json:"account_ids,omitempty"`
+	AccountTags   []string                       `json:"account_tags,omitempty"`
 	EmailAddress  *string                        `json:"email_address,omitempty"`
 	Subject       *string                        `json:"subject,omitempty"`
 	From          *string                        `json:"from,omitempty"`
@@ -69,6 +80,7 @@ type UpdateTriggerRequest struct {
 	Labels        []string                       `json:"labels,omitempty"`
 	Folders       []string                       `json:"folders,omitempty"`
 	CustomFilters map[string]string              `json:"custom_filters,omitempty"`
+	Query         *string                        `json:"query,omitempty"`
 	Condition     *models.TriggerConditionConfig `json:"condition,omitempty"`
 	Actions       []models.TriggerActionConfig   `json:"actions,omitempty"`
 	EnableLogging *bool                          `json:"enable_logging,omitempty"`
@@ -120,6 +132,17 @@ func (h *TriggerAPIHandler) CreateTriggerHandler(w http.ResponseWriter, r *http.
 		http.Error(w, "At least one action is required", http.StatusBadRequest)
 		return
 	}
+	if !validateTriggerActions(w, req.Actions) {
+		return
+	}
+	if _, err := searchquery.Parse(req.Query); err != nil {
+		respondWithQueryError(w, err)
+		return
+	}
+	if _, err := services.ParseCustomFilters(req.CustomFilters); err != nil {
+		http.Error(w, "Invalid custom filters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// 创建触发器模型
 	trigger := &models.EmailTrigger{
@@ -127,6 +150,8 @@ func (h *TriggerAPIHandler) CreateTriggerHandler(w http.ResponseWriter, r *http.
 		Description:   req.Description,
 		Status:        req.Status,
 		CheckInterval: req.CheckInterval,
+		AccountIDs:    req.AccountIDs,
+		AccountTags:   models.StringSlice(req.AccountTags),
 		EmailAddress:  req.EmailAddress,
 		Subject:       req.Subject,
 		From:          req.From,
@@ -136,6 +161,7 @@ func (h *TriggerAPIHandler) CreateTriggerHandler(w http.ResponseWriter, r *http.
 		Labels:        models.StringSlice(req.Labels),
 		Folders:       models.StringSlice(req.Folders),
 		CustomFilters: req.CustomFilters,
+		Query:         req.Query,
 		Condition:     req.Condition,
 		Actions:       models.TriggerActions(req.Actions),
 		EnableLogging: req.EnableLogging,
@@ -299,12 +325,13 @@ func (h *TriggerAPIHandler) GetTriggerHandler(w http.ResponseWriter, r *http.Req
 
 // UpdateTriggerHandler 更新触发器
 // @Summary Update a trigger
-// @Description Update a trigger (supports partial updates)
+// @Description Update a trigger (supports partial updates). Enabling a disabled trigger handles the emails stored while it was disabled according to resume.
 // @Tags triggers
 // @Accept json
 // @Produce json
 // @Param id path int true "Trigger ID"
 // @Param request body UpdateTriggerRequest true "Update trigger request"
+// @Param resume query string false "When the trigger goes from disabled to enabled: skip (default) starts after the newest email and never evaluates emails stored while it was disabled, backfill continues from its cursor and evaluates them"
 // @Success 200 {object} TriggerResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
@@ -317,6 +344,11 @@ func (h *TriggerAPIHandler) UpdateTriggerHandler(w http.ResponseWriter, r *http.
 		http.Error(w, "Invalid trigger ID", http.StatusBadRequest)
 		return
 	}
+	resume, err := services.ParseTriggerResume(r.URL.Query().Get("resume"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// 获取现有触发器
 	existingTrigger, err := h.triggerRepo.GetByID(uint(id))
@@ -341,6 +373,12 @@ func (h *TriggerAPIHandler) UpdateTriggerHandler(w http.ResponseWriter, r *http.
 	if req.CheckInterval != nil {
 		existingTrigger.CheckInterval = *req.CheckInterval
 	}
+	if req.AccountIDs != nil {
+		existingTrigger.AccountIDs = req.AccountIDs
+	}
+	if req.AccountTags != nil {
+		existingTrigger.AccountTags = models.StringSlice(req.AccountTags)
+	}
 	if req.EmailAddress != nil {
 		existingTrigger.EmailAddress = *req.EmailAddress
 	}
@@ -366,12 +404,26 @@ func (h *TriggerAPIHandler) UpdateTriggerHandler(w http.ResponseWriter, r *http.
 		existingTrigger.Folders = models.StringSlice(req.Folders)
 	}
 	if req.CustomFilters != nil {
+		if _, err := services.ParseCustomFilters(req.CustomFilters); err != nil {
+			http.Error(w, "Invalid custom filters: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 		existingTrigger.CustomFilters = req.CustomFilters
 	}
+	if req.Query != nil {
+		if _, err := searchquery.Parse(*req.Query); err != nil {
+			respondWithQueryError(w, err)
+			return
+		}
+		existingTrigger.Query = *req.Query
+	}
 	if req.Condition != nil {
 		existingTrigger.Condition = *req.Condition
 	}
 	if req.Actions != nil {
+		if !validateTriggerActions(w, req.Actions) {
+			return
+		}
 		existingTrigger.Actions = models.TriggerActions(req.Actions)
 	}
 	if req.EnableLogging != nil {
@@ -382,7 +434,7 @@ func (h *TriggerAPIHandler) UpdateTriggerHandler(w http.ResponseWriter, r *http.
 	}
 
 	// 更新触发器
-	if err := h.triggerService.UpdateTrigger(existingTrigger); err != nil {
+	if err := h.triggerService.UpdateTrigger(existingTrigger, resume); err != nil {
 		http.Error(w, "Failed to update trigger: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -465,11 +517,12 @@ func (h *TriggerAPIHandler) DeleteTriggerHandler(w http.ResponseWriter, r *http.
 
 // EnableTriggerHandler 启用触发器
 // @Summary Enable a trigger
-// @Description Enable a trigger by ID
+// @Description Enable a trigger by ID. The emails stored while the trigger was disabled are handled according to resume.
 // @Tags triggers
 // @Accept json
 // @Produce json
 // @Param id path int true "Trigger ID"
+// @Param resume query string false "When the trigger goes from disabled to enabled: skip (default) starts after the newest email and never evaluates emails stored while it was disabled, backfill continues from its cursor and evaluates them"
 // @Success 200 {object} TriggerResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
@@ -482,8 +535,13 @@ func (h *TriggerAPIHandler) EnableTriggerHandler(w http.ResponseWriter, r *http.
 		http.Error(w, "Invalid trigger ID", http.StatusBadRequest)
 		return
 	}
+	resume, err := services.ParseTriggerResume(r.URL.Query().Get("resume"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if err := h.triggerService.EnableTrigger(uint(id)); err != nil {
+	if err := h.triggerService.EnableTrigger(uint(id), resume); err != nil {
 		http.Error(w, "Failed to enable trigger: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -664,6 +722,154 @@ func (h *TriggerAPIHandler) GetTriggerExecutionLogsHandler(w http.ResponseWriter
 	json.NewEncoder(w).Encode(response)
 }
 
+// RerunTriggerRequest 重新执行触发器的请求
+type RerunTriggerRequest struct {
+	EmailIDs []uint `json:"email_ids"`
+}
+
+// maxRerunEmails 一次重新执行的邮件数上限
+const maxRerunEmails = 100
+
+// RerunTriggerHandler 对选定的邮件重新执行触发器
+// @Summary Re-run a trigger for selected emails
+// @Description Run the current revision of a trigger on the given emails again, even when the ledger records them as processed. The condition is evaluated, the filters of the trigger are not. Returns the new ledger entry of every email, or 409 when an email is being processed by another worker.
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Trigger ID"
+// @Param request body RerunTriggerRequest true "Emails to process"
+// @Success 200 {array} models.TriggerLedgerEntry
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/triggers/{id}/rerun [post]
+func (h *TriggerAPIHandler) RerunTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid trigger ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RerunTriggerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.EmailIDs) == 0 {
+		http.Error(w, "email_ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.EmailIDs) > maxRerunEmails {
+		http.Error(w, fmt.Sprintf("At most %d emails can be re-run at once", maxRerunEmails), http.StatusBadRequest)
+		return
+	}
+
+	trigger, err := h.triggerRepo.GetByID(uint(id))
+	if err != nil {
+		http.Error(w, "Trigger not found", http.StatusNotFound)
+		return
+	}
+
+	entries, err := h.triggerService.RerunTrigger(trigger.ID, req.EmailIDs)
+	if err != nil {
+		if strings.Contains(err.Error(), "email not found") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrTriggerLedgerBusy) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to re-run trigger: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 记录活动日志
+	userID := getUserIDFromContext(r)
+	h.activityLogger.LogActivity(
+		models.ActivityTypeGeneral,
+		"重新执行触发器",
+		fmt.Sprintf("对 %d 封邮件重新执行了触发器 %s", len(entries), trigger.Name),
+		userID,
+		map[string]interface{}{
+			"trigger_id":   trigger.ID,
+			"trigger_name": trigger.Name,
+			"email_ids":    req.EmailIDs,
+		},
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// GetTriggerLedgerHandler 获取触发器的处理台账
+// @Summary Get the ledger of a trigger
+// @Description List the emails processed by a trigger with the revision and outcome, newest first
+// @Tags triggers
+// @Produce json
+// @Param id path int true "Trigger ID"
+// @Param email_id query int false "Only entries of this email"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Items per page (default: 20, max: 100)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/triggers/{id}/ledger [get]
+func (h *TriggerAPIHandler) GetTriggerLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid trigger ID", http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	limit := 20
+	if p := r.URL.Query().Get("page"); p != "" {
+		if val, err := strconv.Atoi(p); err == nil && val > 0 {
+			page = val
+		}
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil && val > 0 && val <= 100 {
+			limit = val
+		}
+	}
+	var emailID uint
+	if e := r.URL.Query().Get("email_id"); e != "" {
+		val, err := strconv.ParseUint(e, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid email_id", http.StatusBadRequest)
+			return
+		}
+		emailID = uint(val)
+	}
+
+	entries, total, err := h.ledgerRepo.List(uint(id), emailID, limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve trigger ledger: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	response := map[string]interface{}{
+		"data":        entries,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": totalPages,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // GetTriggerStatsHandler 获取触发器统计信息
 // @Summary Get trigger statistics
 // @Description Get trigger statistics and worker status
@@ -710,3 +916,22 @@ func (h *TriggerAPIHandler) GetTriggerStatsHandler(w http.ResponseWriter, r *htt
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// validateTriggerActions checks the configuration of actions that can be validated up front
+func validateTriggerActions(w http.ResponseWriter, actions []models.TriggerActionConfig) bool {
+	for _, action := range actions {
+		switch action.Type {
+		case models.TriggerActionTypeAddTags, models.TriggerActionTypeRemoveTags:
+			if _, err := services.ParseTagActionConfig(action.Config); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid action %q: %v", action.Name, err), http.StatusBadRequest)
+				return false
+			}
+		case models.TriggerActionTypeExtractValues:
+			if _, err := services.ParseExtractValuesActionConfig(action.Config); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid action %q: %v", action.Name, err), http.StatusBadRequest)
+				return false
+			}
+		}
+	}
+	return true
+}
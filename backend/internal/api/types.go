@@ -2,6 +2,8 @@ package api
 
 import (
 	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/services"
 	"time"
 )
 
@@ -97,6 +99,7 @@ type UpdateAccountRequest struct {
 	IsDomainMail     *bool            `json:"isDomainMail,omitempty"`
 	Domain           *string          `json:"domain,omitempty"`
 	CustomSettings   *models.JSONMap  `json:"customSettings,omitempty"`
+	Tags             []string         `json:"tags,omitempty"`
 	LastSyncAt       *time.Time       `json:"lastSyncAt,omitempty"`
 }
 
@@ -113,6 +116,7 @@ type CreateAccountRequest struct {
 	IsDomainMail     bool            `json:"isDomainMail"`
 	Domain           string          `json:"domain,omitempty"`
 	CustomSettings   models.JSONMap  `json:"customSettings,omitempty"`
+	Tags             []string        `json:"tags,omitempty"`
 }
 
 // EmailSearchRequest represents the request parameters for the /emails endpoint
@@ -153,6 +157,10 @@ type EmailSearchResponse struct {
 	Emails []models.Email `json:"emails"`
 	// Pagination information
 	Pagination PaginationInfo `json:"pagination"`
+	// Highlighted snippets of full-text hits, keyed by email ID
+	Highlights map[uint]models.SearchHighlight `json:"highlights,omitempty"`
+	// Match counts per facet value, keyed by facet name (only when facets were requested)
+	Facets map[string][]models.SearchFacetBucket `json:"facets,omitempty"`
 }
 
 // PaginationInfo contains pagination metadata
@@ -175,14 +183,20 @@ type PaginationInfo struct {
 // ExtractorConfig defines the configuration for content extraction
 // @Description Configuration for email content extraction
 type ExtractorConfig struct {
-	// Field to extract from: ALL, from, to, cc, subject, body, html_body, headers
+	// Field to extract from: ALL, from, to, cc, subject, body, html_body, headers or attachment:<glob>
 	Field string `json:"field" binding:"required" example:"subject"`
-	// Type of extraction: regex, js, gotemplate
+	// Type of extraction: regex, js, gotemplate, html, jsonpath
 	Type string `json:"type" binding:"required" example:"regex"`
 	// Optional match configuration (returns {matched: boolean, reason?: string})
 	Match *string `json:"match,omitempty" example:"return {matched: content.includes('invoice'), reason: 'No invoice keyword found'}"`
 	// Extract configuration (returns string or null)
 	Extract string `json:"extract" binding:"required" example:"Invoice #(\\d+)"`
+	// Optional output name; named outputs are returned in values
+	Name string `json:"name,omitempty" example:"invoice_number"`
+	// Output type of a named extractor: string (default), number, date, url or list
+	OutputType string `json:"output_type,omitempty" example:"string"`
+	// Report a validation error when a named output has no value
+	Required bool `json:"required,omitempty" example:"true"`
 }
 
 // ExtractEmailsRequest represents the request body for the /extract-emails endpoint
@@ -215,6 +229,11 @@ type ExtractEmailsRequest struct {
 
 	// Extractor template ID (if provided, will be merged with extractors)
 	ExtractorID *uint `json:"extractor_id,omitempty" example:"1"`
+	// Pin a revision of the extractor template (default: current revision)
+	ExtractorRevision *int `json:"extractor_revision,omitempty" example:"3"`
+	// Store the named outputs of the template in extracted_values, replacing
+	// earlier values of the template on the same emails (requires extractor_id)
+	SaveValues bool `json:"save_values,omitempty" example:"false"`
 
 	// Processing options
 	BatchSize int `json:"batch_size,omitempty" example:"50"`
@@ -247,6 +266,15 @@ type CustomEmailForTesting struct {
 	Subject  string `json:"subject" example:"Test Email Subject"`
 	Body     string `json:"body" example:"This is the email body content"`
 	HTMLBody string `json:"html_body,omitempty" example:"<p>This is the HTML body</p>"`
+	// Optional attachments for attachment:<glob> fields
+	Attachments []CustomAttachmentForTesting `json:"attachments,omitempty"`
+}
+
+// CustomAttachmentForTesting is a text attachment of a custom test email
+type CustomAttachmentForTesting struct {
+	Filename string `json:"filename" example:"order.json"`
+	MIMEType string `json:"mime_type,omitempty" example:"application/json"`
+	Content  string `json:"content" example:"{\"order\": {\"id\": 42}}"`
 }
 
 // TestExtractorResult represents the result of testing a single extractor
@@ -256,6 +284,11 @@ type TestExtractorResult struct {
 	Type   string  `json:"type" example:"regex"`
 	Result *string `json:"result" example:"extracted value"`
 	Error  string  `json:"error,omitempty" example:"extraction failed: invalid regex"`
+	// Output name and typed value of a named extractor
+	Name  string      `json:"name,omitempty" example:"invoice_number"`
+	Value interface{} `json:"value,omitempty"`
+	// Validation error of a named extractor, e.g. a missing required value
+	ValidationError string `json:"validation_error,omitempty" example:"required value is missing"`
 }
 
 // TestExtractorTemplateResponse represents the response for testing an extractor template
@@ -281,8 +314,91 @@ type ExtractorTemplateResponse struct {
 	Name        string            `json:"name" example:"Invoice Extractor"`
 	Description string            `json:"description,omitempty" example:"Extracts invoice numbers and amounts"`
 	Extractors  []ExtractorConfig `json:"extractors"`
+	Revision    int               `json:"revision" example:"3"`
 	CreatedAt   time.Time         `json:"created_at" example:"2024-01-01T00:00:00Z"`
 	UpdatedAt   time.Time         `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+	// Fixture results of the saved extractors (only when the extractors changed)
+	Suite *services.ExtractorSuiteResult `json:"suite,omitempty"`
+}
+
+// ExtractorTemplateRevisionResponse represents a saved revision of an extractor template
+// @Description Immutable revision of an extractor template
+type ExtractorTemplateRevisionResponse struct {
+	TemplateID  uint              `json:"template_id" example:"1"`
+	Revision    int               `json:"revision" example:"3"`
+	Name        string            `json:"name" example:"Invoice Extractor"`
+	Description string            `json:"description,omitempty"`
+	Extractors  []ExtractorConfig `json:"extractors"`
+	AuthorID    *uint             `json:"author_id,omitempty" example:"1"`
+	Author      string            `json:"author,omitempty" example:"admin"`
+	Message     string            `json:"message,omitempty" example:"restored from revision 1"`
+	CreatedAt   time.Time         `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	// Whether this is the current revision of the template
+	Current bool `json:"current"`
+	// Changes compared to the previous revision
+	Changes []services.ExtractorRevisionChange `json:"changes"`
+}
+
+// ExtractorTemplateDiffResponse represents the changes between two revisions
+// @Description Changes between two revisions of an extractor template
+type ExtractorTemplateDiffResponse struct {
+	TemplateID uint                               `json:"template_id" example:"1"`
+	From       int                                `json:"from" example:"2"`
+	To         int                                `json:"to" example:"3"`
+	Changes    []services.ExtractorRevisionChange `json:"changes"`
+}
+
+// CreateExtractorFixtureRequest represents the request body for adding a stored email as fixture
+// @Description Request body for adding a stored email as extractor template fixture
+type CreateExtractorFixtureRequest struct {
+	Name    string `json:"name,omitempty" example:"Order confirmation"`
+	EmailID *uint  `json:"email_id" example:"123"`
+	// Expected output, defaults to the current output of the template
+	Expected *models.ExtractorFixtureOutput `json:"expected,omitempty"`
+}
+
+// UpdateExtractorFixtureRequest represents the request body for updating a fixture
+// @Description Request body for updating an extractor template fixture
+type UpdateExtractorFixtureRequest struct {
+	Name     string                         `json:"name,omitempty" example:"Order confirmation"`
+	Expected *models.ExtractorFixtureOutput `json:"expected,omitempty"`
+	// Take the current output of the template as the expected output
+	Record bool `json:"record,omitempty" example:"false"`
+}
+
+// ExtractorSuiteRegressionResponse is returned when a template change breaks fixtures that passed before
+// @Description Template change rejected because fixtures regressed
+type ExtractorSuiteRegressionResponse struct {
+	Error string                         `json:"error" example:"1 fixture(s) regressed, retry with force=true to save anyway"`
+	Suite *services.ExtractorSuiteResult `json:"suite"`
+}
+
+// ExtractedValueResponse is a stored named output of an extractor template
+// @Description Value is a number, an RFC3339 date, a list of strings or a string depending on type
+type ExtractedValueResponse struct {
+	ID          uint        `json:"id"`
+	EmailID     uint        `json:"email_id" example:"123"`
+	TemplateID  uint        `json:"template_id" example:"1"`
+	Revision    int         `json:"revision" example:"3"`
+	Field       string      `json:"field" example:"order_id"`
+	Type        string      `json:"type" example:"string"`
+	Value       interface{} `json:"value"`
+	ExtractedAt time.Time   `json:"extracted_at"`
+}
+
+// PaginatedExtractedValuesResponse represents a paginated response for extracted values
+type PaginatedExtractedValuesResponse struct {
+	Data       []ExtractedValueResponse `json:"data"`
+	Total      int64                    `json:"total"`
+	Page       int                      `json:"page"`
+	Limit      int                      `json:"limit"`
+	TotalPages int                      `json:"total_pages"`
+}
+
+// ExtractedValueAggregateResponse represents the groups of an extracted value aggregation
+type ExtractedValueAggregateResponse struct {
+	GroupBy string                           `json:"group_by,omitempty" example:"value"`
+	Groups  []repository.ExtractedValueGroup `json:"groups"`
 }
 
 // PaginatedExtractorTemplatesResponse represents a paginated response for extractor templates
@@ -302,6 +418,10 @@ type ExtractorResult struct {
 	Email models.Email `json:"email"`
 	// Array of extracted content matches
 	Matches []string `json:"matches"`
+	// Typed values of named extractors
+	Values map[string]interface{} `json:"values,omitempty"`
+	// Validation errors of named extractors
+	Errors []services.ExtractionError `json:"errors,omitempty"`
 }
 
 // PaginatedAccountsResponse represents a paginated response for email accounts
@@ -447,6 +567,10 @@ type WaitEmailRequest struct {
 	StartTime *string `json:"start_time,omitempty" form:"start_time" example:"2024-01-01T00:00:00Z"`
 	// Extraction configurations (same as extract-emails endpoint)
 	Extract []ExtractorConfig `json:"extract,omitempty"`
+	// Extractor template ID (if provided, its extractors run before extract)
+	ExtractorID *uint `json:"extractor_id,omitempty" example:"1"`
+	// Pin a revision of the extractor template (default: current revision)
+	ExtractorRevision *int `json:"extractor_revision,omitempty" example:"3"`
 }
 
 // WaitEmailResponse represents the response for the /wait-email endpoint
@@ -460,6 +584,10 @@ type WaitEmailResponse struct {
 	Email *models.Email `json:"email,omitempty"`
 	// Extracted content (if extractors were provided)
 	Matches []string `json:"matches,omitempty"`
+	// Typed values of named extractors
+	Values map[string]interface{} `json:"values,omitempty"`
+	// Validation errors of named extractors
+	Errors []services.ExtractionError `json:"errors,omitempty"`
 	// Time taken to find the email in seconds
 	ElapsedTime float64 `json:"elapsed_time" example:"12.5"`
 	// Number of checks performed
@@ -508,6 +636,10 @@ type CheckEmailResponse struct {
 	Email *models.Email `json:"email,omitempty"`
 	// Extracted content (if extractors were provided)
 	Matches []string `json:"matches,omitempty"`
+	// Typed values of named extractors
+	Values map[string]interface{} `json:"values,omitempty"`
+	// Validation errors of named extractors
+	Errors []services.ExtractionError `json:"errors,omitempty"`
 	// Message describing the result
 	Message string `json:"message" example:"Email found"`
 	// Error details (if any)
@@ -553,6 +685,8 @@ type SubscriptionFilters struct {
 	SubjectFilter string `json:"subject_filter,omitempty" example:"urgent"`
 	// Filter by keywords in body
 	KeywordFilter string `json:"keyword_filter,omitempty" example:"invoice"`
+	// Gmail-style search query
+	Query string `json:"query,omitempty" example:"from:github subject:(verify OR confirm) -in:spam"`
 }
 
 // SubscriptionResponse represents a subscription in API responses
@@ -137,10 +137,13 @@ func (h *APIHandler) WaitEmailWebSocketHandler(w http.ResponseWriter, r *http.Re
 		extractorService = services.NewExtractorService()
 		for _, extractor := range request.Extract {
 			serviceExtractors = append(serviceExtractors, services.ExtractorConfig{
-				Field:   services.ExtractorField(extractor.Field),
-				Type:    services.ExtractorType(extractor.Type),
-				Match:   extractor.Match,
-				Extract: extractor.Extract,
+				Field:      services.ExtractorField(extractor.Field),
+				Type:       services.ExtractorType(extractor.Type),
+				Match:      extractor.Match,
+				Extract:    extractor.Extract,
+				Name:       extractor.Name,
+				OutputType: extractor.OutputType,
+				Required:   extractor.Required,
 			})
 		}
 	}
@@ -281,6 +284,8 @@ func (h *APIHandler) WaitEmailWebSocketHandler(w http.ResponseWriter, r *http.Re
 					Data: map[string]interface{}{
 						"email":   email,
 						"matches": result.Matches,
+						"values":  result.Values,
+						"errors":  result.Errors,
 					},
 				})
 			}
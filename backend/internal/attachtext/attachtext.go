@@ -0,0 +1,181 @@
+// Package attachtext extracts the plain text of email attachments with pure
+// Go parsers: the text layer of PDF files, CSV, Word and Excel documents
+// (DOCX/XLSX) and text/* files. Scanned PDFs without a text layer yield no
+// text; OCR is out of scope.
+package attachtext
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"mailman/internal/utils"
+)
+
+// MaxTextBytes limits the extracted text of a single attachment
+const MaxTextBytes = 1 << 20
+
+// ErrUnsupported is returned for attachment types without a text extractor
+var ErrUnsupported = errors.New("unsupported attachment type")
+
+// Format is the document format an attachment is read as
+type Format string
+
+const (
+	FormatPDF  Format = "pdf"
+	FormatCSV  Format = "csv"
+	FormatDOCX Format = "docx"
+	FormatXLSX Format = "xlsx"
+	FormatHTML Format = "html"
+	FormatText Format = "text"
+)
+
+// mimeFormats maps MIME types to formats, text/* is handled separately
+var mimeFormats = map[string]Format{
+	"application/pdf":           FormatPDF,
+	"application/x-pdf":         FormatPDF,
+	"text/csv":                  FormatCSV,
+	"application/csv":           FormatCSV,
+	"text/tab-separated-values": FormatCSV,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": FormatDOCX,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       FormatXLSX,
+	"text/html":              FormatHTML,
+	"application/xhtml+xml":  FormatHTML,
+	"application/json":       FormatText,
+	"application/xml":        FormatText,
+	"application/ld+json":    FormatText,
+	"application/x-ndjson":   FormatText,
+	"application/javascript": FormatText,
+}
+
+var extensionFormats = map[string]Format{
+	".pdf":  FormatPDF,
+	".csv":  FormatCSV,
+	".tsv":  FormatCSV,
+	".docx": FormatDOCX,
+	".xlsx": FormatXLSX,
+	".htm":  FormatHTML,
+	".html": FormatHTML,
+	".txt":  FormatText,
+	".text": FormatText,
+	".md":   FormatText,
+	".log":  FormatText,
+	".json": FormatText,
+	".xml":  FormatText,
+	".ics":  FormatText,
+	".vcf":  FormatText,
+	".eml":  FormatText,
+}
+
+// DetectFormat returns the format of an attachment by MIME type, falling back
+// to the file extension for generic types such as application/octet-stream
+func DetectFormat(filename, mimeType string) (Format, bool) {
+	mediaType := strings.ToLower(strings.TrimSpace(mimeType))
+	if parsed, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mediaType = parsed
+	}
+	if format, ok := mimeFormats[mediaType]; ok {
+		return format, true
+	}
+	if format, ok := extensionFormats[strings.ToLower(filepath.Ext(filename))]; ok {
+		return format, true
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return FormatText, true
+	}
+	return "", false
+}
+
+// IsTextual reports whether the raw content of an attachment is already text
+func IsTextual(filename, mimeType string) bool {
+	format, ok := DetectFormat(filename, mimeType)
+	return ok && (format == FormatText || format == FormatCSV || format == FormatHTML)
+}
+
+// Extract returns the plain text of an attachment, ErrUnsupported when its
+// type has no extractor
+func Extract(filename, mimeType string, content []byte) (string, error) {
+	format, ok := DetectFormat(filename, mimeType)
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	var text string
+	var err error
+	switch format {
+	case FormatPDF:
+		text, err = extractPDF(content)
+	case FormatCSV:
+		text, err = extractCSV(content)
+	case FormatDOCX:
+		text, err = extractDOCX(content)
+	case FormatXLSX:
+		text, err = extractXLSX(content)
+	case FormatHTML:
+		text = utils.HTMLToText(decodeText(content))
+	default:
+		text = decodeText(content)
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncate(strings.TrimSpace(text), MaxTextBytes), nil
+}
+
+// decodeText turns raw bytes into valid UTF-8, dropping a byte order mark
+func decodeText(content []byte) string {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	return strings.ToValidUTF8(string(content), "")
+}
+
+// extractCSV renders the rows of a CSV file as tab separated lines. The
+// delimiter is guessed from the first line.
+func extractCSV(content []byte) (string, error) {
+	text := decodeText(content)
+	firstLine := text
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		firstLine = text[:i]
+	}
+	delimiter, best := ',', strings.Count(firstLine, ",")
+	for _, candidate := range []rune{';', '\t', '|'} {
+		if count := strings.Count(firstLine, string(candidate)); count > best {
+			delimiter, best = candidate, count
+		}
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var sb strings.Builder
+	for sb.Len() < MaxTextBytes {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(strings.Join(record, "\t"))
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// truncate cuts text to at most limit bytes without splitting a rune
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
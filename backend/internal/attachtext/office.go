@@ -0,0 +1,251 @@
+package attachtext
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPartBytes limits the uncompressed size of a single XML part, so a zip
+// bomb cannot exhaust memory
+const maxPartBytes = 64 << 20
+
+func openZip(content []byte) (*zip.Reader, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid office document: %w", err)
+	}
+	return reader, nil
+}
+
+func openPart(file *zip.File) (io.ReadCloser, error) {
+	if file.UncompressedSize64 > maxPartBytes {
+		return nil, fmt.Errorf("%s is too large", file.Name)
+	}
+	return file.Open()
+}
+
+// extractDOCX reads the paragraphs of word/document.xml
+func extractDOCX(content []byte) (string, error) {
+	reader, err := openZip(content)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	found := false
+	for _, file := range reader.File {
+		// 正文、页眉页脚和脚注都是 WordprocessingML
+		if file.Name != "word/document.xml" && !strings.HasPrefix(file.Name, "word/header") &&
+			!strings.HasPrefix(file.Name, "word/footer") && file.Name != "word/footnotes.xml" {
+			continue
+		}
+		found = true
+		part, err := openPart(file)
+		if err != nil {
+			return "", err
+		}
+		err = wordText(part, &sb)
+		part.Close()
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", file.Name, err)
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("word/document.xml not found")
+	}
+	return sb.String(), nil
+}
+
+func wordText(r io.Reader, sb *strings.Builder) error {
+	decoder := xml.NewDecoder(r)
+	inText := false
+	for sb.Len() < MaxTextBytes {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteString("\t")
+			case "br", "cr":
+				sb.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				sb.WriteString("\n")
+			case "tc":
+				sb.WriteString("\t")
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+	return nil
+}
+
+// extractXLSX renders every worksheet as tab separated rows, resolving
+// shared strings
+func extractXLSX(content []byte) (string, error) {
+	reader, err := openZip(content)
+	if err != nil {
+		return "", err
+	}
+
+	var shared []string
+	var sheets []*zip.File
+	for _, file := range reader.File {
+		switch {
+		case file.Name == "xl/sharedStrings.xml":
+			part, err := openPart(file)
+			if err != nil {
+				return "", err
+			}
+			shared, err = sharedStrings(part)
+			part.Close()
+			if err != nil {
+				return "", fmt.Errorf("invalid shared strings: %w", err)
+			}
+		case strings.HasPrefix(file.Name, "xl/worksheets/") && strings.HasSuffix(file.Name, ".xml"):
+			sheets = append(sheets, file)
+		}
+	}
+	if len(sheets) == 0 {
+		return "", fmt.Errorf("no worksheet found")
+	}
+	sort.Slice(sheets, func(i, j int) bool { return sheetNumber(sheets[i].Name) < sheetNumber(sheets[j].Name) })
+
+	var sb strings.Builder
+	for _, sheet := range sheets {
+		part, err := openPart(sheet)
+		if err != nil {
+			return "", err
+		}
+		err = sheetText(part, shared, &sb)
+		part.Close()
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", sheet.Name, err)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// sheetNumber orders sheet2.xml before sheet10.xml
+func sheetNumber(name string) int {
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "xl/worksheets/sheet"), ".xml")
+	number, err := strconv.Atoi(name)
+	if err != nil {
+		return 1 << 30
+	}
+	return number
+}
+
+func sharedStrings(r io.Reader) ([]string, error) {
+	decoder := xml.NewDecoder(r)
+	var strs []string
+	var current strings.Builder
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "si" {
+				current.Reset()
+			} else if t.Name.Local == "t" {
+				inText = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "si" {
+				strs = append(strs, current.String())
+			} else if t.Name.Local == "t" {
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(t)
+			}
+		}
+	}
+}
+
+func sheetText(r io.Reader, shared []string, sb *strings.Builder) error {
+	decoder := xml.NewDecoder(r)
+	var row []string
+	var cellType string
+	var value strings.Builder
+	inValue := false
+	for sb.Len() < MaxTextBytes {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = row[:0]
+			case "c":
+				cellType = ""
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "t" {
+						cellType = attr.Value
+					}
+				}
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				cell := value.String()
+				if cellType == "s" {
+					if index, err := strconv.Atoi(cell); err == nil && index >= 0 && index < len(shared) {
+						cell = shared[index]
+					}
+				}
+				row = append(row, cell)
+			case "row":
+				line := strings.TrimRight(strings.Join(row, "\t"), "\t")
+				if line != "" {
+					sb.WriteString(line)
+					sb.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+	return nil
+}
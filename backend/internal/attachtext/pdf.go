@@ -0,0 +1,62 @@
+package attachtext
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// extractPDF reads the text layer of a PDF page by page, grouping the text
+// runs of each page into lines
+func extractPDF(content []byte) (text string, err error) {
+	// 解析器在遇到损坏的文件时可能 panic
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("invalid PDF: %w", err)
+	}
+
+	var sb strings.Builder
+	for i := 1; i <= reader.NumPage() && sb.Len() < MaxTextBytes; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		rows, err := page.GetTextByRow()
+		if err != nil {
+			return "", fmt.Errorf("failed to read page %d: %w", i, err)
+		}
+		for _, row := range rows {
+			sb.WriteString(pdfLine(row.Content))
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// pdfLine joins the text runs of a line, inserting a space where the gap
+// between two runs is wider than a fraction of the font size
+func pdfLine(runs pdf.TextHorizontal) string {
+	var sb strings.Builder
+	for i, run := range runs {
+		if i > 0 {
+			previous := runs[i-1]
+			gap := run.X - (previous.X + previous.W)
+			if previous.W == 0 || gap > previous.FontSize*0.2 {
+				if !strings.HasSuffix(previous.S, " ") && !strings.HasPrefix(run.S, " ") {
+					sb.WriteString(" ")
+				}
+			}
+		}
+		sb.WriteString(run.S)
+	}
+	return sb.String()
+}
@@ -0,0 +1,227 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密快照的格式：
+//
+//	magic | salt(16) | nonce prefix(4) | chunk...
+//	chunk = length(uint32) | AES-256-GCM(plaintext)
+//
+// 每个分块最多 chunkSize 字节明文，nonce 由前缀和分块序号组成；最后一个分块的
+// AAD 标记为结束块，因此被截断或重排的文件无法通过校验。
+var encryptedMagic = []byte("MMBAKENC1\n")
+
+const (
+	chunkSize  = 64 * 1024
+	saltSize   = 16
+	prefixSize = 4
+)
+
+var (
+	// ErrPassphraseRequired is returned when an encrypted snapshot is read without a passphrase
+	ErrPassphraseRequired = errors.New("snapshot is encrypted, a passphrase is required")
+	// ErrWrongPassphrase is returned when an encrypted snapshot cannot be decrypted
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted snapshot")
+	// ErrTruncated is returned when a snapshot ends before its trailer
+	ErrTruncated = errors.New("snapshot is truncated")
+)
+
+// deriveKey 由口令派生 AES-256 密钥
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[prefixSize:], counter)
+	return nonce
+}
+
+func chunkAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptWriter encrypts a stream in authenticated chunks
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	buf     []byte
+}
+
+// newEncryptWriter writes the header of an encrypted snapshot; Close must be
+// called to write the final chunk
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, saltSize)
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append(append([]byte{}, encryptedMagic...), salt...), prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == cap(e.buf) {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the buffered data as the final chunk
+func (e *encryptWriter) Close() error {
+	return e.flush(true)
+}
+
+func (e *encryptWriter) flush(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter), e.buf, chunkAAD(final))
+	e.counter++
+	e.buf = e.buf[:0]
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := e.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader reverses encryptWriter
+type decryptReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	plain   []byte
+	done    bool
+}
+
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	header := make([]byte, saltSize+prefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	key, err := deriveKey(passphrase, header[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead, prefix: header[saltSize:]}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	var length [4]byte
+	if _, err := io.ReadFull(d.r, length[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size > chunkSize+uint32(d.aead.Overhead()) {
+		return ErrWrongPassphrase
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return ErrTruncated
+	}
+
+	nonce := chunkNonce(d.prefix, d.counter)
+	plain, err := d.aead.Open(nil, nonce, sealed, chunkAAD(false))
+	if err != nil {
+		plain, err = d.aead.Open(nil, nonce, sealed, chunkAAD(true))
+		if err != nil {
+			return ErrWrongPassphrase
+		}
+		d.done = true
+	}
+	d.counter++
+	d.plain = plain
+	return nil
+}
+
+// openSnapshotStream detects an encrypted snapshot and returns the decrypted stream
+func openSnapshotStream(r io.Reader, passphrase string) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(encryptedMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, encryptedMagic) {
+		return buffered, nil
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	if _, err := buffered.Discard(len(encryptedMagic)); err != nil {
+		return nil, err
+	}
+	return newDecryptReader(buffered, passphrase)
+}
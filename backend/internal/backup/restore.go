@@ -0,0 +1,265 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"mailman/internal/database"
+	"mailman/internal/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const restoreBatchSize = 100
+
+// ErrNotEmpty is returned when restoring into a database that already has data without Replace
+var ErrNotEmpty = errors.New("target database is not empty")
+
+// RestoreOptions controls a restore
+type RestoreOptions struct {
+	Passphrase string
+
+	// Replace 清空目标数据库中的现有数据（包括快照中不包含的邮件、日志和会话）后再恢复
+	Replace bool
+
+	// IndexAttachmentNames 与 SEARCH_INDEX_ATTACHMENT_NAMES 一致，用于重建搜索索引
+	IndexAttachmentNames bool
+}
+
+// Restore loads a snapshot into db, whose schema must already be migrated.
+// Everything happens in one transaction: a failed, truncated or tampered
+// snapshot leaves the database unchanged. It returns the snapshot manifest
+// with the restored row counts.
+func Restore(ctx context.Context, db *gorm.DB, r io.Reader, opts RestoreOptions) (*Manifest, error) {
+	stream, err := openSnapshotStream(r, opts.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := gzip.NewReader(stream)
+	if err != nil {
+		if errors.Is(err, ErrWrongPassphrase) || errors.Is(err, ErrTruncated) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("not a mailman snapshot: %w", err)
+	}
+	defer compressed.Close()
+
+	reader := bufio.NewReaderSize(compressed, 1<<20)
+	decoder := json.NewDecoder(reader)
+
+	var header record
+	if err := decoder.Decode(&header); err != nil {
+		return nil, snapshotReadError(err)
+	}
+	if header.Type != "header" || header.Manifest == nil {
+		return nil, fmt.Errorf("not a mailman snapshot: missing header")
+	}
+	manifest := header.Manifest
+	if manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("snapshot format %d is newer than this release supports (%d)", manifest.FormatVersion, FormatVersion)
+	}
+	version, err := database.NewMigrator(db).Version()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > version {
+		return nil, fmt.Errorf("snapshot has schema version %d but the database is at %d, upgrade mailman and run the migrations first", manifest.SchemaVersion, version)
+	}
+
+	schemas := make(map[string]*schema.Schema, len(tables))
+	for _, t := range tables {
+		sch, err := parseSchema(db, t.model)
+		if err != nil {
+			return nil, err
+		}
+		schemas[sch.Table] = sch
+	}
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if opts.Replace {
+			if err := clearTables(tx); err != nil {
+				return err
+			}
+		} else if err := ensureEmpty(tx); err != nil {
+			return err
+		}
+
+		restorer := &tableRestorer{ctx: ctx, tx: tx, counts: make(map[string]int64)}
+		for {
+			var rec record
+			if err := decoder.Decode(&rec); err != nil {
+				return snapshotReadError(err)
+			}
+			if rec.Type == "end" {
+				if err := restorer.flush(); err != nil {
+					return err
+				}
+				manifest.Counts = restorer.counts
+				return restorer.verify(rec.Counts)
+			}
+			if rec.Type != "row" {
+				return fmt.Errorf("unexpected record %q in snapshot", rec.Type)
+			}
+			sch, ok := schemas[rec.Table]
+			if !ok {
+				return fmt.Errorf("snapshot contains unknown table %s", rec.Table)
+			}
+			if err := restorer.add(sch, rec.Row); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resetSequences(db, schemas); err != nil {
+		return nil, err
+	}
+	if manifest.IncludeEmails {
+		index := repository.NewSearchIndex(db)
+		index.SetIncludeAttachmentNames(opts.IndexAttachmentNames)
+		if _, err := index.Rebuild(500); err != nil {
+			return nil, fmt.Errorf("data restored but rebuilding the search index failed, retry with POST /api/emails/search/reindex: %w", err)
+		}
+	}
+	return manifest, nil
+}
+
+// snapshotReadError 区分截断的快照和其他读取错误
+func snapshotReadError(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	if errors.Is(err, ErrWrongPassphrase) || errors.Is(err, ErrTruncated) {
+		return err
+	}
+	return fmt.Errorf("failed to read snapshot: %w", err)
+}
+
+// tableRestorer inserts rows in batches, keeping their primary keys
+type tableRestorer struct {
+	ctx    context.Context
+	tx     *gorm.DB
+	counts map[string]int64
+
+	schema *schema.Schema
+	batch  reflect.Value
+}
+
+func (t *tableRestorer) add(sch *schema.Schema, data json.RawMessage) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	if t.schema != sch {
+		if err := t.flush(); err != nil {
+			return err
+		}
+		t.schema = sch
+		t.batch = reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(sch.ModelType)), 0, restoreBatchSize)
+	}
+
+	value, err := decodeRow(t.ctx, sch, data)
+	if err != nil {
+		return fmt.Errorf("invalid %s row: %w", sch.Table, err)
+	}
+	t.batch = reflect.Append(t.batch, value)
+	t.counts[sch.Table]++
+	if t.batch.Len() >= restoreBatchSize {
+		return t.flush()
+	}
+	return nil
+}
+
+func (t *tableRestorer) flush() error {
+	if t.schema == nil || t.batch.Len() == 0 {
+		return nil
+	}
+	// Select("*") 写入所有列，否则值为零值且带默认值的列（如 is_active=false）会被数据库默认值替换
+	err := t.tx.Session(&gorm.Session{SkipHooks: true}).
+		Select("*").Omit(clause.Associations).
+		Create(t.batch.Interface()).Error
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", t.schema.Table, err)
+	}
+	t.batch = t.batch.Slice(0, 0)
+	return nil
+}
+
+// verify compares the restored rows with the counts in the snapshot trailer
+func (t *tableRestorer) verify(expected map[string]int64) error {
+	for table, count := range expected {
+		if t.counts[table] != count {
+			return fmt.Errorf("snapshot is corrupted: %s has %d rows, expected %d", table, t.counts[table], count)
+		}
+	}
+	for table, count := range t.counts {
+		if _, ok := expected[table]; !ok && count > 0 {
+			return fmt.Errorf("snapshot is corrupted: unexpected rows for %s", table)
+		}
+	}
+	return nil
+}
+
+// ensureEmpty refuses to mix a snapshot with existing data
+func ensureEmpty(tx *gorm.DB) error {
+	for _, t := range tables {
+		var count int64
+		if err := tx.Model(t.model).Unscoped().Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			sch, _ := parseSchema(tx, t.model)
+			return fmt.Errorf("%w: %s has rows, restore into a new database or replace the existing data", ErrNotEmpty, sch.Table)
+		}
+	}
+	return nil
+}
+
+// clearTables deletes the existing data, dependent tables first
+func clearTables(tx *gorm.DB) error {
+	targets := append([]interface{}{}, transientTables...)
+	for i := len(tables) - 1; i >= 0; i-- {
+		targets = append(targets, tables[i].model)
+	}
+	for _, model := range targets {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error; err != nil {
+			return fmt.Errorf("failed to clear %T: %w", model, err)
+		}
+	}
+	if tx.Dialector.Name() == "sqlite" && tx.Migrator().HasTable("email_search_fts") {
+		return tx.Exec("DELETE FROM email_search_fts").Error
+	}
+	return nil
+}
+
+// resetSequences moves the Postgres id sequences past the restored ids;
+// SQLite and MySQL derive the next id from the table contents
+func resetSequences(db *gorm.DB, schemas map[string]*schema.Schema) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for table, sch := range schemas {
+		field := sch.PrioritizedPrimaryField
+		if field == nil || !field.AutoIncrement {
+			continue
+		}
+		err := db.Exec(
+			fmt.Sprintf("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)",
+				db.Statement.Quote(field.DBName), db.Statement.Quote(table)),
+			table, field.DBName,
+		).Error
+		if err != nil {
+			return fmt.Errorf("failed to reset id sequence of %s: %w", table, err)
+		}
+	}
+	return nil
+}
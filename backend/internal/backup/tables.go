@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"mailman/internal/models"
+)
+
+// scope 决定表在什么情况下进入快照
+type scope int
+
+const (
+	scopeAlways      scope = iota // 账户、配置、模板、触发器、同步状态
+	scopeEmails                   // 邮件正文及其派生数据
+	scopeAttachments              // 附件内容
+)
+
+// table is a table included in snapshots
+type table struct {
+	model interface{}
+	scope scope
+}
+
+// tables 按外键依赖排列：恢复时按顺序写入，清空时逆序删除
+var tables = []table{
+	{model: &models.User{}},
+	{model: &models.MailProvider{}},
+	{model: &models.OAuth2GlobalConfig{}},
+	{model: &models.EmailAccount{}},
+	{model: &models.Mailbox{}},
+	{model: &models.EmailAccountSyncConfig{}},
+	{model: &models.GlobalSyncConfig{}},
+	{model: &models.IncrementalSyncRecord{}},
+	{model: &models.SyncStatistics{}},
+	{model: &models.OpenAIConfig{}},
+	{model: &models.AIPromptTemplate{}},
+	{model: &models.AIGeneratedTemplate{}},
+	{model: &models.ExtractorTemplate{}},
+	{model: &models.ExtractorTemplateRevision{}},
+	{model: &models.ExtractorFixture{}},
+	{model: &models.EmailTrigger{}},
+	{model: &models.ExtractionPipeline{}},
+	{model: &models.SavedSearch{}},
+	{model: &models.RetentionPolicy{}},
+	{model: &models.Tag{}},
+	{model: &models.Contact{}},
+	{model: &models.ContactAddress{}},
+	{model: &models.ContactAccount{}},
+	{model: &models.Email{}, scope: scopeEmails},
+	{model: &models.EmailAddress{}, scope: scopeEmails},
+	{model: &models.EmailTag{}, scope: scopeEmails},
+	{model: &models.ExtractedValue{}, scope: scopeEmails},
+	{model: &models.TriggerLedgerEntry{}, scope: scopeEmails},
+	{model: &models.Attachment{}, scope: scopeAttachments},
+}
+
+// transientTables 不进入快照的日志、会话和派生数据。替换恢复时与快照中的表一起清空，
+// 搜索索引在恢复后重建
+var transientTables = []interface{}{
+	&models.UserSession{},
+	&models.OAuth2AuthSession{},
+	&models.ActivityLog{},
+	&models.TriggerExecutionLog{},
+	&models.ExportJob{},
+	&models.EmailSearchDocument{},
+}
+
+// included reports whether the table is part of a snapshot with the given options
+func (t table) included(includeEmails, includeAttachments bool) bool {
+	switch t.scope {
+	case scopeEmails:
+		return includeEmails
+	case scopeAttachments:
+		return includeEmails && includeAttachments
+	}
+	return true
+}
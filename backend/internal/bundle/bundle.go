@@ -0,0 +1,408 @@
+// Package bundle exports and imports configuration as a single JSON or YAML
+// document, so that extractor templates, triggers, AI prompt templates and
+// sync configs can be moved between installations, e.g. from staging to
+// production.
+//
+// A bundle refers to other objects by name instead of by ID: triggers name
+// the extractor templates of their extract_values actions and the accounts
+// of their scope by email address, sync configs name their account by email
+// address. Importing resolves the names in the target database.
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/services"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Version is the bundle format version written by Export
+const Version = 1
+
+// Kinds of objects in a bundle
+const (
+	KindExtractorTemplate = "extractor_template"
+	KindTrigger           = "trigger"
+	KindPromptTemplate    = "prompt_template"
+	KindSyncConfig        = "sync_config"
+)
+
+// Formats supported by Encode
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// ErrInvalidBundle is returned for documents that are not a readable bundle
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// Bundle 配置包。各类对象按名称引用彼此，不包含 ID、统计信息和同步状态
+type Bundle struct {
+	Version            int                 `json:"version"`
+	ExportedAt         time.Time           `json:"exported_at"`
+	ExtractorTemplates []ExtractorTemplate `json:"extractor_templates,omitempty"`
+	Triggers           []Trigger           `json:"triggers,omitempty"`
+	PromptTemplates    []PromptTemplate    `json:"prompt_templates,omitempty"`
+	SyncConfigs        []SyncConfig        `json:"sync_configs,omitempty"`
+}
+
+// ExtractorTemplate is an extractor template, identified by its name
+type ExtractorTemplate struct {
+	Name        string                          `json:"name"`
+	Description string                          `json:"description,omitempty"`
+	Extractors  models.ExtractorTemplateConfigs `json:"extractors"`
+}
+
+// Trigger is an email trigger, identified by its name. The config of an
+// extract_values action names its template, see ExtractValuesConfig.
+type Trigger struct {
+	Name          string                        `json:"name"`
+	Description   string                        `json:"description,omitempty"`
+	Status        models.TriggerStatus          `json:"status"`
+	CheckInterval int                           `json:"check_interval"`
+	Accounts      []string                      `json:"accounts,omitempty"`     // 账户范围，按邮箱地址
+	AccountTags   []string                      `json:"account_tags,omitempty"` // 账户范围，按账户标签
+	EmailAddress  string                        `json:"email_address,omitempty"`
+	StartDate     *time.Time                    `json:"start_date,omitempty"`
+	EndDate       *time.Time                    `json:"end_date,omitempty"`
+	Subject       string                        `json:"subject,omitempty"`
+	From          string                        `json:"from,omitempty"`
+	To            string                        `json:"to,omitempty"`
+	HasAttachment *bool                         `json:"has_attachment,omitempty"`
+	Unread        *bool                         `json:"unread,omitempty"`
+	Labels        []string                      `json:"labels,omitempty"`
+	Folders       []string                      `json:"folders,omitempty"`
+	CustomFilters map[string]string             `json:"custom_filters,omitempty"`
+	Query         string                        `json:"query,omitempty"`
+	Condition     models.TriggerConditionConfig `json:"condition"`
+	Actions       models.TriggerActions         `json:"actions"`
+	EnableLogging bool                          `json:"enable_logging"`
+}
+
+// ExtractValuesConfig 包中 extract_values 动作的配置，模板按名称引用。
+// revision 是模板在导出方的修订号，导入后的模板修订历史从头开始
+type ExtractValuesConfig struct {
+	Template string `json:"template"`
+	Revision *int   `json:"revision,omitempty"`
+}
+
+// PromptTemplate is an AI prompt template, identified by its scenario
+type PromptTemplate struct {
+	Scenario     string         `json:"scenario"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description,omitempty"`
+	SystemPrompt string         `json:"system_prompt"`
+	UserPrompt   string         `json:"user_prompt,omitempty"`
+	Variables    models.JSONMap `json:"variables,omitempty"`
+	MaxTokens    int            `json:"max_tokens"`
+	Temperature  float64        `json:"temperature"`
+	IsActive     bool           `json:"is_active"`
+}
+
+// SyncConfig is the sync config of an account, identified by the email
+// address of the account. Accounts themselves are not part of a bundle.
+type SyncConfig struct {
+	Account        string   `json:"account"`
+	EnableAutoSync bool     `json:"enable_auto_sync"`
+	SyncInterval   int      `json:"sync_interval"`
+	SyncFolders    []string `json:"sync_folders,omitempty"`
+}
+
+// ExportOptions selects what Export includes
+type ExportOptions struct {
+	// Kinds 要导出的对象类型，为空时导出全部
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+func (o ExportOptions) includes(kind string) bool {
+	if len(o.Kinds) == 0 {
+		return true
+	}
+	for _, k := range o.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseKinds parses a comma separated list of kinds, e.g. "trigger,extractor_template"
+func ParseKinds(value string) ([]string, error) {
+	var kinds []string
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+		switch kind {
+		case "":
+			continue
+		case KindExtractorTemplate, KindTrigger, KindPromptTemplate, KindSyncConfig:
+			kinds = append(kinds, kind)
+		default:
+			return nil, fmt.Errorf("unknown kind %q", kind)
+		}
+	}
+	return kinds, nil
+}
+
+// Export reads the configuration from the database
+func Export(db *gorm.DB, opts ExportOptions) (*Bundle, error) {
+	state, err := loadState(db)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{Version: Version, ExportedAt: time.Now().UTC()}
+	if opts.includes(KindExtractorTemplate) {
+		for i := range state.templates {
+			b.ExtractorTemplates = append(b.ExtractorTemplates, exportTemplate(&state.templates[i]))
+		}
+	}
+	if opts.includes(KindTrigger) {
+		for i := range state.triggers {
+			trigger, err := exportTrigger(&state.triggers[i], state.templateNames(), state.accountAddresses())
+			if err != nil {
+				return nil, err
+			}
+			b.Triggers = append(b.Triggers, *trigger)
+		}
+	}
+	if opts.includes(KindPromptTemplate) {
+		for i := range state.prompts {
+			b.PromptTemplates = append(b.PromptTemplates, exportPromptTemplate(&state.prompts[i]))
+		}
+	}
+	if opts.includes(KindSyncConfig) {
+		accounts := state.accountAddresses()
+		for i := range state.syncConfigs {
+			address, ok := accounts[state.syncConfigs[i].AccountID]
+			if !ok {
+				continue // 账户已删除
+			}
+			b.SyncConfigs = append(b.SyncConfigs, exportSyncConfig(&state.syncConfigs[i], address))
+		}
+	}
+	return b, nil
+}
+
+// Encode writes a bundle as JSON or YAML
+func Encode(w io.Writer, b *Bundle, format string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "", FormatJSON:
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case FormatYAML:
+		// JSON 是 YAML 的子集，经过 yaml.Node 转换可以保留字段顺序
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// blockStyle drops the flow style of a document parsed from JSON, so that
+// it is written as regular YAML with multi-line scripts as literal blocks
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// Decode reads a bundle written as JSON or YAML
+func Decode(r io.Reader) (*Bundle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("%w: empty document", ErrInvalidBundle)
+	}
+
+	// YAML 解码后转成 JSON，两种格式共用一套 json 标签
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	data, err = json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	var b Bundle
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if b.Version == 0 || b.Version > Version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, b.Version)
+	}
+	return &b, nil
+}
+
+// state is the configuration currently stored in the database
+type state struct {
+	templates   []models.ExtractorTemplate
+	triggers    []models.EmailTrigger
+	prompts     []models.AIPromptTemplate
+	syncConfigs []models.EmailAccountSyncConfig
+	accounts    []models.EmailAccount
+}
+
+func loadState(db *gorm.DB) (*state, error) {
+	s := &state{}
+	if err := db.Order("name").Find(&s.templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load extractor templates: %w", err)
+	}
+	if err := db.Order("id").Find(&s.triggers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load triggers: %w", err)
+	}
+	if err := db.Order("scenario").Find(&s.prompts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+	}
+	if err := db.Order("account_id").Find(&s.syncConfigs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load sync configs: %w", err)
+	}
+	if err := db.Select("id", "email_address").Find(&s.accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load accounts: %w", err)
+	}
+	return s, nil
+}
+
+func (s *state) templateNames() map[uint]string {
+	names := make(map[uint]string, len(s.templates))
+	for _, template := range s.templates {
+		names[template.ID] = template.Name
+	}
+	return names
+}
+
+func (s *state) accountAddresses() map[uint]string {
+	addresses := make(map[uint]string, len(s.accounts))
+	for _, account := range s.accounts {
+		addresses[account.ID] = account.EmailAddress
+	}
+	return addresses
+}
+
+func exportTemplate(t *models.ExtractorTemplate) ExtractorTemplate {
+	extractors := t.Extractors
+	if extractors == nil {
+		extractors = models.ExtractorTemplateConfigs{}
+	}
+	return ExtractorTemplate{Name: t.Name, Description: t.Description, Extractors: extractors}
+}
+
+// exportTrigger converts a trigger, replacing template IDs in the configs of
+// extract_values actions by template names and the account scope by the
+// email addresses of the accounts
+func exportTrigger(t *models.EmailTrigger, templateNames map[uint]string, accountAddresses map[uint]string) (*Trigger, error) {
+	var accounts []string
+	for _, accountID := range t.AccountIDs {
+		if address, ok := accountAddresses[accountID]; ok {
+			accounts = append(accounts, address)
+		}
+	}
+	// 已删除的账户不导出，但范围不能因此扩大到所有账户
+	if len(t.AccountIDs) > 0 && len(accounts) == 0 {
+		return nil, fmt.Errorf("trigger %q: the accounts of its scope no longer exist", t.Name)
+	}
+
+	actions := make(models.TriggerActions, len(t.Actions))
+	for i, action := range t.Actions {
+		if action.Type == models.TriggerActionTypeExtractValues {
+			config, err := services.ParseExtractValuesActionConfig(action.Config)
+			if err != nil {
+				return nil, fmt.Errorf("trigger %q, action %q: %w", t.Name, action.Name, err)
+			}
+			name, ok := templateNames[config.TemplateID]
+			if !ok {
+				return nil, fmt.Errorf("trigger %q, action %q: extractor template %d does not exist", t.Name, action.Name, config.TemplateID)
+			}
+			encoded, err := json.Marshal(ExtractValuesConfig{Template: name, Revision: config.Revision})
+			if err != nil {
+				return nil, err
+			}
+			action.Config = string(encoded)
+		}
+		actions[i] = action
+	}
+
+	return &Trigger{
+		Name:          t.Name,
+		Description:   t.Description,
+		Status:        t.Status,
+		CheckInterval: t.CheckInterval,
+		Accounts:      accounts,
+		AccountTags:   t.AccountTags,
+		EmailAddress:  t.EmailAddress,
+		StartDate:     t.StartDate,
+		EndDate:       t.EndDate,
+		Subject:       t.Subject,
+		From:          t.From,
+		To:            t.To,
+		HasAttachment: t.HasAttachment,
+		Unread:        t.Unread,
+		Labels:        t.Labels,
+		Folders:       t.Folders,
+		CustomFilters: t.CustomFilters,
+		Query:         t.Query,
+		Condition:     t.Condition,
+		Actions:       actions,
+		EnableLogging: t.EnableLogging,
+	}, nil
+}
+
+func exportPromptTemplate(t *models.AIPromptTemplate) PromptTemplate {
+	return PromptTemplate{
+		Scenario:     t.Scenario,
+		Name:         t.Name,
+		Description:  t.Description,
+		SystemPrompt: t.SystemPrompt,
+		UserPrompt:   t.UserPrompt,
+		Variables:    t.Variables,
+		MaxTokens:    t.MaxTokens,
+		Temperature:  t.Temperature,
+		IsActive:     t.IsActive,
+	}
+}
+
+func exportSyncConfig(c *models.EmailAccountSyncConfig, account string) SyncConfig {
+	return SyncConfig{
+		Account:        account,
+		EnableAutoSync: c.EnableAutoSync,
+		SyncInterval:   c.SyncInterval,
+		SyncFolders:    c.SyncFolders,
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
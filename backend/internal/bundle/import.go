@@ -0,0 +1,721 @@
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/searchquery"
+	"mailman/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// Conflict modes, deciding what happens to an object that already exists in
+// the target with different content
+const (
+	ConflictSkip      = "skip"      // 保留目标中的对象
+	ConflictOverwrite = "overwrite" // 用包中的内容覆盖
+	ConflictRename    = "rename"    // 以新名称另建一个
+)
+
+// Planned actions of a change
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionSkip      = "skip"
+	ActionRename    = "rename" // 以 NewName 创建
+)
+
+// ErrUnresolved is returned by Import when some entries of the bundle cannot
+// be imported, see Change.Error. Nothing is written in that case.
+var ErrUnresolved = errors.New("bundle has entries that cannot be imported")
+
+// ImportOptions controls Import
+type ImportOptions struct {
+	Mode   string `json:"mode"`    // skip（默认）、overwrite 或 rename
+	DryRun bool   `json:"dry_run"` // 只计算变更，不写入
+	// Force 覆盖模板时即使测试用例回归也照样写入
+	Force bool `json:"force"`
+}
+
+// FieldDiff is a field that differs between the target and the bundle
+type FieldDiff struct {
+	Field    string      `json:"field"`
+	Current  interface{} `json:"current,omitempty"`
+	Incoming interface{} `json:"incoming,omitempty"`
+}
+
+// Change is what importing one entry of a bundle does
+type Change struct {
+	Kind     string      `json:"kind"`
+	Name     string      `json:"name"`
+	Action   string      `json:"action,omitempty"`
+	NewName  string      `json:"new_name,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	Diff     []FieldDiff `json:"diff,omitempty"`
+}
+
+// ImportResult lists the changes of an import, also of a dry run
+type ImportResult struct {
+	Mode    string   `json:"mode"`
+	DryRun  bool     `json:"dry_run"`
+	Applied bool     `json:"applied"`
+	Changes []Change `json:"changes"`
+
+	// 写入的触发器和同步配置，运行中的服务需要据此重新加载
+	Triggers     []uint `json:"-"`
+	SyncAccounts []uint `json:"-"`
+}
+
+// Counts returns the number of changes by action
+func (r *ImportResult) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, change := range r.Changes {
+		if change.Error != "" {
+			counts["error"]++
+		} else {
+			counts[change.Action]++
+		}
+	}
+	return counts
+}
+
+// Errors returns the entries that cannot be imported
+func (r *ImportResult) Errors() []string {
+	var errs []string
+	for _, change := range r.Changes {
+		if change.Error != "" {
+			errs = append(errs, fmt.Sprintf("%s %q: %s", change.Kind, change.Name, change.Error))
+		}
+	}
+	return errs
+}
+
+// Import compares a bundle with the database and, unless opts.DryRun is set,
+// applies the changes in one transaction. When an entry cannot be imported
+// the result is returned together with ErrUnresolved and nothing is written.
+func Import(db *gorm.DB, b *Bundle, opts ImportOptions) (*ImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = ConflictSkip
+	}
+	switch opts.Mode {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+	default:
+		return nil, fmt.Errorf("unknown conflict mode %q", opts.Mode)
+	}
+
+	state, err := loadState(db)
+	if err != nil {
+		return nil, err
+	}
+	im := newImporter(state, opts)
+	im.suite = services.NewExtractorSuiteService(repository.NewExtractorFixtureRepository(db),
+		repository.NewExtractorTemplateRepository(db), repository.NewEmailRepository(db))
+	im.planTemplates(b.ExtractorTemplates)
+	im.planPromptTemplates(b.PromptTemplates)
+	im.planTriggers(b.Triggers)
+	im.planSyncConfigs(b.SyncConfigs)
+
+	if len(im.result.Errors()) > 0 {
+		return im.result, ErrUnresolved
+	}
+	if opts.DryRun {
+		return im.result, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, step := range im.steps {
+			if err := step(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		im.result.Triggers, im.result.SyncAccounts = nil, nil
+		return im.result, err
+	}
+	im.result.Applied = true
+	return im.result, nil
+}
+
+// importer plans an import; steps are run in order when it is applied
+type importer struct {
+	state  *state
+	mode   string
+	force  bool
+	suite  *services.ExtractorSuiteService
+	result *ImportResult
+	steps  []func(tx *gorm.DB) error
+
+	templateIDs   map[string]uint                 // 目标中的模板名称到 ID，应用时补充新建的模板
+	templateNames map[string]string               // 包中的模板名称到导入后的名称
+	accounts      map[string]*models.EmailAccount // 目标中小写的邮箱地址到账户
+}
+
+func newImporter(state *state, opts ImportOptions) *importer {
+	im := &importer{
+		state:         state,
+		mode:          opts.Mode,
+		force:         opts.Force,
+		result:        &ImportResult{Mode: opts.Mode, DryRun: opts.DryRun, Changes: []Change{}},
+		templateIDs:   make(map[string]uint),
+		templateNames: make(map[string]string),
+		accounts:      make(map[string]*models.EmailAccount, len(state.accounts)),
+	}
+	for _, template := range state.templates {
+		im.templateIDs[template.Name] = template.ID
+	}
+	for i := range state.accounts {
+		im.accounts[strings.ToLower(state.accounts[i].EmailAddress)] = &state.accounts[i]
+	}
+	return im
+}
+
+// decide sets the action of a change for an entry that may already exist in
+// the target. rename returns the new name, it is nil for kinds that cannot
+// be renamed.
+func (im *importer) decide(change *Change, exists bool, diff []FieldDiff, rename func() string) {
+	switch {
+	case !exists:
+		change.Action = ActionCreate
+		return
+	case len(diff) == 0:
+		change.Action = ActionUnchanged
+		return
+	}
+
+	change.Diff = diff
+	switch im.mode {
+	case ConflictOverwrite:
+		change.Action = ActionUpdate
+	case ConflictRename:
+		if rename == nil {
+			change.Action = ActionSkip
+			change.Reason = "exists with different content and cannot be renamed"
+			return
+		}
+		change.Action = ActionRename
+		change.NewName = rename()
+	default:
+		change.Action = ActionSkip
+		change.Reason = "exists with different content"
+	}
+}
+
+func (im *importer) add(change Change, step func(tx *gorm.DB) error) {
+	im.result.Changes = append(im.result.Changes, change)
+	if step != nil && change.Error == "" {
+		im.steps = append(im.steps, step)
+	}
+}
+
+func (im *importer) planTemplates(templates []ExtractorTemplate) {
+	existing := make(map[string]*models.ExtractorTemplate, len(im.state.templates))
+	taken := make(map[string]bool)
+	for i := range im.state.templates {
+		existing[im.state.templates[i].Name] = &im.state.templates[i]
+		taken[im.state.templates[i].Name] = true
+	}
+	for _, incoming := range templates {
+		taken[incoming.Name] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, incoming := range templates {
+		change := Change{Kind: KindExtractorTemplate, Name: incoming.Name}
+		switch {
+		case strings.TrimSpace(incoming.Name) == "":
+			change.Error = "name is required"
+		case seen[incoming.Name]:
+			change.Error = "duplicate name in bundle"
+		case len(incoming.Extractors) == 0:
+			change.Error = "at least one extractor is required"
+		default:
+			if err := services.ValidateExtractorOutputs(services.TemplateExtractorConfigs(incoming.Extractors)); err != nil {
+				change.Error = err.Error()
+			}
+		}
+		seen[incoming.Name] = true
+		if change.Error != "" {
+			im.add(change, nil)
+			continue
+		}
+
+		current := existing[incoming.Name]
+		var diff []FieldDiff
+		if current != nil {
+			diff = diffFields(exportTemplate(current), incoming)
+		}
+		im.decide(&change, current != nil, diff, func() string {
+			return uniqueName(incoming.Name, taken, " (imported)", " (imported %d)")
+		})
+
+		im.templateNames[incoming.Name] = incoming.Name
+		var step func(tx *gorm.DB) error
+		switch change.Action {
+		case ActionCreate, ActionRename:
+			template := &models.ExtractorTemplate{Name: incoming.Name, Description: incoming.Description, Extractors: incoming.Extractors}
+			if change.Action == ActionRename {
+				template.Name = change.NewName
+				im.templateNames[incoming.Name] = change.NewName
+			}
+			step = func(tx *gorm.DB) error {
+				if err := repository.NewExtractorTemplateRepository(tx).Create(template, nil); err != nil {
+					return fmt.Errorf("failed to create extractor template %q: %w", template.Name, err)
+				}
+				im.templateIDs[template.Name] = template.ID
+				return nil
+			}
+		case ActionUpdate:
+			im.checkSuite(&change, current, incoming.Extractors)
+			template := *current
+			template.Description = incoming.Description
+			template.Extractors = incoming.Extractors
+			step = func(tx *gorm.DB) error {
+				// 覆盖记录为模板的新修订，可以在修订历史中恢复
+				if err := repository.NewExtractorTemplateRepository(tx).Update(&template, nil); err != nil {
+					return fmt.Errorf("failed to update extractor template %q: %w", template.Name, err)
+				}
+				return nil
+			}
+		}
+		im.add(change, step)
+	}
+}
+
+// checkSuite runs the fixtures of a template that is about to be overwritten,
+// like saving the template through the API does
+func (im *importer) checkSuite(change *Change, current *models.ExtractorTemplate, proposed models.ExtractorTemplateConfigs) {
+	suite, err := im.suite.Check(current.ID,
+		services.TemplateExtractorConfigs(current.Extractors),
+		services.TemplateExtractorConfigs(proposed))
+	switch {
+	case err != nil:
+		change.Error = "failed to run extractor fixtures: " + err.Error()
+	case suite.Regressions > 0 && im.force:
+		change.Warnings = append(change.Warnings, fmt.Sprintf("%d fixture(s) regressed", suite.Regressions))
+	case suite.Regressions > 0:
+		change.Error = fmt.Sprintf("%d fixture(s) regressed, import with force to overwrite anyway", suite.Regressions)
+	}
+}
+
+func (im *importer) planPromptTemplates(prompts []PromptTemplate) {
+	existing := make(map[string]*models.AIPromptTemplate, len(im.state.prompts))
+	taken := make(map[string]bool)
+	for i := range im.state.prompts {
+		existing[im.state.prompts[i].Scenario] = &im.state.prompts[i]
+		taken[im.state.prompts[i].Scenario] = true
+	}
+	for _, incoming := range prompts {
+		taken[incoming.Scenario] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, incoming := range prompts {
+		change := Change{Kind: KindPromptTemplate, Name: incoming.Scenario}
+		switch {
+		case strings.TrimSpace(incoming.Scenario) == "":
+			change.Error = "scenario is required"
+		case seen[incoming.Scenario]:
+			change.Error = "duplicate scenario in bundle"
+		case strings.TrimSpace(incoming.SystemPrompt) == "":
+			change.Error = "system_prompt is required"
+		}
+		seen[incoming.Scenario] = true
+		if change.Error != "" {
+			im.add(change, nil)
+			continue
+		}
+
+		current := existing[incoming.Scenario]
+		var diff []FieldDiff
+		if current != nil {
+			diff = diffFields(exportPromptTemplate(current), incoming)
+		}
+		im.decide(&change, current != nil, diff, func() string {
+			return uniqueName(incoming.Scenario, taken, "_imported", "_imported_%d")
+		})
+
+		var step func(tx *gorm.DB) error
+		switch change.Action {
+		case ActionCreate, ActionRename:
+			prompt := &models.AIPromptTemplate{}
+			setPromptTemplate(prompt, incoming)
+			if change.Action == ActionRename {
+				prompt.Scenario = change.NewName
+			}
+			step = func(tx *gorm.DB) error {
+				err := createWithDefaults(tx, prompt, map[string]interface{}{
+					"max_tokens": prompt.MaxTokens, "temperature": prompt.Temperature, "is_active": prompt.IsActive,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to create prompt template %q: %w", prompt.Scenario, err)
+				}
+				return nil
+			}
+		case ActionUpdate:
+			prompt := *current
+			setPromptTemplate(&prompt, incoming)
+			step = func(tx *gorm.DB) error {
+				if err := repository.NewAIPromptTemplateRepository(tx).Update(&prompt); err != nil {
+					return fmt.Errorf("failed to update prompt template %q: %w", prompt.Scenario, err)
+				}
+				return nil
+			}
+		}
+		im.add(change, step)
+	}
+}
+
+func setPromptTemplate(prompt *models.AIPromptTemplate, incoming PromptTemplate) {
+	prompt.Scenario = incoming.Scenario
+	prompt.Name = incoming.Name
+	prompt.Description = incoming.Description
+	prompt.SystemPrompt = incoming.SystemPrompt
+	prompt.UserPrompt = incoming.UserPrompt
+	prompt.Variables = incoming.Variables
+	prompt.MaxTokens = incoming.MaxTokens
+	prompt.Temperature = incoming.Temperature
+	prompt.IsActive = incoming.IsActive
+}
+
+func (im *importer) planTriggers(triggers []Trigger) {
+	// 触发器名称不要求唯一，目标中同名的触发器按最早创建的一个比较
+	existing := make(map[string]*models.EmailTrigger, len(im.state.triggers))
+	taken := make(map[string]bool)
+	for i := range im.state.triggers {
+		if _, ok := existing[im.state.triggers[i].Name]; !ok {
+			existing[im.state.triggers[i].Name] = &im.state.triggers[i]
+		}
+		taken[im.state.triggers[i].Name] = true
+	}
+	for _, incoming := range triggers {
+		taken[incoming.Name] = true
+	}
+	templateNames := im.state.templateNames()
+
+	seen := make(map[string]bool)
+	for _, incoming := range triggers {
+		change := Change{Kind: KindTrigger, Name: incoming.Name}
+		resolved, err := im.resolveTrigger(incoming, &change)
+		switch {
+		case strings.TrimSpace(incoming.Name) == "":
+			change.Error = "name is required"
+		case seen[incoming.Name]:
+			change.Error = "duplicate name in bundle"
+		case err != nil:
+			change.Error = err.Error()
+		}
+		seen[incoming.Name] = true
+		if change.Error != "" {
+			im.add(change, nil)
+			continue
+		}
+
+		current := existing[incoming.Name]
+		var diff []FieldDiff
+		if current != nil {
+			if exported, err := exportTrigger(current, templateNames, im.state.accountAddresses()); err == nil {
+				diff = diffFields(exported, resolved)
+			} else {
+				// 目标中的触发器引用了不存在的模板，视为内容不同
+				diff = []FieldDiff{{Field: "actions", Current: err.Error(), Incoming: resolved.Actions}}
+			}
+		}
+		im.decide(&change, current != nil, diff, func() string {
+			return uniqueName(incoming.Name, taken, " (imported)", " (imported %d)")
+		})
+
+		var step func(tx *gorm.DB) error
+		switch change.Action {
+		case ActionCreate, ActionRename:
+			name := incoming.Name
+			if change.Action == ActionRename {
+				name = change.NewName
+			}
+			step = func(tx *gorm.DB) error {
+				trigger := &models.EmailTrigger{}
+				if err := im.setTrigger(trigger, resolved); err != nil {
+					return err
+				}
+				trigger.Name = name
+				// 导入的触发器与新建的一样，只处理此后入库的邮件
+				lastEmailID, err := repository.NewTriggerRepository(tx).LatestEmailID()
+				if err != nil {
+					return err
+				}
+				trigger.LastEmailID = lastEmailID
+				if err := createWithDefaults(tx, trigger, map[string]interface{}{"enable_logging": trigger.EnableLogging}); err != nil {
+					return fmt.Errorf("failed to create trigger %q: %w", name, err)
+				}
+				im.result.Triggers = append(im.result.Triggers, trigger.ID)
+				return nil
+			}
+		case ActionUpdate:
+			trigger := *current
+			step = func(tx *gorm.DB) error {
+				if err := im.setTrigger(&trigger, resolved); err != nil {
+					return err
+				}
+				if err := repository.NewTriggerRepository(tx).Update(&trigger); err != nil {
+					return fmt.Errorf("failed to update trigger %q: %w", trigger.Name, err)
+				}
+				im.result.Triggers = append(im.result.Triggers, trigger.ID)
+				return nil
+			}
+		}
+		im.add(change, step)
+	}
+}
+
+// resolveTrigger checks a trigger of the bundle and points the template
+// references of its extract_values actions to the templates in the target
+func (im *importer) resolveTrigger(incoming Trigger, change *Change) (Trigger, error) {
+	resolved := incoming
+	switch resolved.Status {
+	case "":
+		resolved.Status = models.TriggerStatusDisabled
+	case models.TriggerStatusEnabled, models.TriggerStatusDisabled:
+	default:
+		return resolved, fmt.Errorf("unknown status %q", resolved.Status)
+	}
+	if resolved.CheckInterval <= 0 {
+		resolved.CheckInterval = 30
+	}
+
+	if _, err := searchquery.Parse(resolved.Query); err != nil {
+		return resolved, fmt.Errorf("query: %w", err)
+	}
+	if _, err := services.ParseCustomFilters(resolved.CustomFilters); err != nil {
+		return resolved, err
+	}
+
+	// 账户不随配置包迁移，范围中的账户必须已在目标中存在
+	resolved.Accounts = make([]string, 0, len(incoming.Accounts))
+	for _, address := range incoming.Accounts {
+		account, ok := im.accounts[strings.ToLower(strings.TrimSpace(address))]
+		if !ok {
+			return resolved, fmt.Errorf("account %q of the scope not found", address)
+		}
+		resolved.Accounts = append(resolved.Accounts, account.EmailAddress)
+	}
+	if len(resolved.Accounts) == 0 {
+		resolved.Accounts = nil
+	}
+
+	resolved.Actions = make(models.TriggerActions, len(incoming.Actions))
+	for i, action := range incoming.Actions {
+		switch action.Type {
+		case models.TriggerActionTypeAddTags, models.TriggerActionTypeRemoveTags:
+			if _, err := services.ParseTagActionConfig(action.Config); err != nil {
+				return resolved, fmt.Errorf("action %q: %w", action.Name, err)
+			}
+		case models.TriggerActionTypeExtractValues:
+			var config ExtractValuesConfig
+			if err := json.Unmarshal([]byte(action.Config), &config); err != nil || config.Template == "" {
+				return resolved, fmt.Errorf("action %q: config must name its extractor template, e.g. {\"template\": \"Invoices\"}", action.Name)
+			}
+			name, ok := im.templateNames[config.Template]
+			if !ok {
+				if _, exists := im.templateIDs[config.Template]; !exists {
+					return resolved, fmt.Errorf("action %q: extractor template %q is neither in the bundle nor in the target", action.Name, config.Template)
+				}
+				name = config.Template
+			}
+			if config.Revision != nil {
+				change.Warnings = append(change.Warnings, fmt.Sprintf(
+					"action %q pins revision %d of %q, revisions are numbered per installation", action.Name, *config.Revision, name))
+			}
+			config.Template = name
+			encoded, err := json.Marshal(config)
+			if err != nil {
+				return resolved, err
+			}
+			action.Config = string(encoded)
+		}
+		resolved.Actions[i] = action
+	}
+	return resolved, nil
+}
+
+// setTrigger copies a resolved trigger of the bundle into a trigger model,
+// replacing template names by IDs. Run while applying, when the templates
+// of the bundle have been created.
+func (im *importer) setTrigger(trigger *models.EmailTrigger, incoming Trigger) error {
+	actions := make(models.TriggerActions, len(incoming.Actions))
+	for i, action := range incoming.Actions {
+		if action.Type == models.TriggerActionTypeExtractValues {
+			var config ExtractValuesConfig
+			if err := json.Unmarshal([]byte(action.Config), &config); err != nil {
+				return err
+			}
+			templateID, ok := im.templateIDs[config.Template]
+			if !ok {
+				return fmt.Errorf("trigger %q: extractor template %q was not imported", incoming.Name, config.Template)
+			}
+			encoded, err := json.Marshal(services.ExtractValuesActionConfig{TemplateID: templateID, Revision: config.Revision})
+			if err != nil {
+				return err
+			}
+			action.Config = string(encoded)
+		}
+		actions[i] = action
+	}
+
+	trigger.Name = incoming.Name
+	trigger.Description = incoming.Description
+	trigger.Status = incoming.Status
+	trigger.CheckInterval = incoming.CheckInterval
+	trigger.AccountIDs = nil
+	for _, address := range incoming.Accounts {
+		trigger.AccountIDs = append(trigger.AccountIDs, im.accounts[strings.ToLower(address)].ID)
+	}
+	trigger.AccountTags = incoming.AccountTags
+	trigger.EmailAddress = incoming.EmailAddress
+	trigger.StartDate = incoming.StartDate
+	trigger.EndDate = incoming.EndDate
+	trigger.Subject = incoming.Subject
+	trigger.From = incoming.From
+	trigger.To = incoming.To
+	trigger.HasAttachment = incoming.HasAttachment
+	trigger.Unread = incoming.Unread
+	trigger.Labels = incoming.Labels
+	trigger.Folders = incoming.Folders
+	trigger.CustomFilters = incoming.CustomFilters
+	trigger.Query = incoming.Query
+	trigger.Condition = incoming.Condition
+	trigger.Actions = actions
+	trigger.EnableLogging = incoming.EnableLogging
+	return nil
+}
+
+func (im *importer) planSyncConfigs(configs []SyncConfig) {
+	accounts := make(map[string]uint, len(im.state.accounts))
+	for _, account := range im.state.accounts {
+		accounts[strings.ToLower(account.EmailAddress)] = account.ID
+	}
+	existing := make(map[uint]*models.EmailAccountSyncConfig, len(im.state.syncConfigs))
+	for i := range im.state.syncConfigs {
+		existing[im.state.syncConfigs[i].AccountID] = &im.state.syncConfigs[i]
+	}
+
+	seen := make(map[uint]bool)
+	for _, incoming := range configs {
+		change := Change{Kind: KindSyncConfig, Name: incoming.Account}
+		accountID, ok := accounts[strings.ToLower(incoming.Account)]
+		switch {
+		case strings.TrimSpace(incoming.Account) == "":
+			change.Error = "account is required"
+		case incoming.SyncInterval < 1:
+			change.Error = "sync_interval must be at least 1 second"
+		case !ok:
+			// 账户不随配置包迁移，目标中没有的账户跳过
+			change.Action = ActionSkip
+			change.Reason = "account not found"
+		case seen[accountID]:
+			change.Error = "duplicate account in bundle"
+		}
+		if change.Error != "" || change.Action != "" {
+			im.add(change, nil)
+			continue
+		}
+		seen[accountID] = true
+
+		current := existing[accountID]
+		var diff []FieldDiff
+		if current != nil {
+			diff = diffFields(exportSyncConfig(current, incoming.Account), incoming)
+		}
+		im.decide(&change, current != nil, diff, nil)
+
+		var step func(tx *gorm.DB) error
+		switch change.Action {
+		case ActionCreate:
+			config := &models.EmailAccountSyncConfig{AccountID: accountID}
+			setSyncConfig(config, incoming)
+			step = func(tx *gorm.DB) error {
+				if err := createWithDefaults(tx, config, map[string]interface{}{"enable_auto_sync": config.EnableAutoSync}); err != nil {
+					return fmt.Errorf("failed to create sync config of %s: %w", incoming.Account, err)
+				}
+				im.result.SyncAccounts = append(im.result.SyncAccounts, accountID)
+				return nil
+			}
+		case ActionUpdate:
+			config := *current
+			setSyncConfig(&config, incoming)
+			step = func(tx *gorm.DB) error {
+				if err := repository.NewSyncConfigRepository(tx).Update(&config); err != nil {
+					return fmt.Errorf("failed to update sync config of %s: %w", incoming.Account, err)
+				}
+				im.result.SyncAccounts = append(im.result.SyncAccounts, accountID)
+				return nil
+			}
+		}
+		im.add(change, step)
+	}
+}
+
+func setSyncConfig(config *models.EmailAccountSyncConfig, incoming SyncConfig) {
+	config.EnableAutoSync = incoming.EnableAutoSync
+	config.SyncInterval = incoming.SyncInterval
+	config.SyncFolders = incoming.SyncFolders
+}
+
+// createWithDefaults creates a record and then writes columns that have a
+// database default: Create replaces their zero values, e.g. enable_logging=false,
+// by the default
+func createWithDefaults(tx *gorm.DB, record interface{}, columns map[string]interface{}) error {
+	if err := tx.Create(record).Error; err != nil {
+		return err
+	}
+	return tx.Model(record).UpdateColumns(columns).Error
+}
+
+// uniqueName returns the first free name made from base with the suffixes,
+// e.g. "Invoices (imported)", "Invoices (imported 2)"
+func uniqueName(base string, taken map[string]bool, suffix, numbered string) string {
+	name := base + suffix
+	for n := 2; taken[name]; n++ {
+		name = base + fmt.Sprintf(numbered, n)
+	}
+	taken[name] = true
+	return name
+}
+
+// diffFields compares the JSON form of two entries field by field
+func diffFields(current, incoming interface{}) []FieldDiff {
+	currentFields, incomingFields := jsonFields(current), jsonFields(incoming)
+	all := make(map[string]interface{}, len(currentFields)+len(incomingFields))
+	for key := range currentFields {
+		all[key] = nil
+	}
+	for key := range incomingFields {
+		all[key] = nil
+	}
+
+	var diff []FieldDiff
+	for _, key := range sortedKeys(all) {
+		if !reflect.DeepEqual(currentFields[key], incomingFields[key]) {
+			diff = append(diff, FieldDiff{Field: key, Current: currentFields[key], Incoming: incomingFields[key]})
+		}
+	}
+	return diff
+}
+
+func jsonFields(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
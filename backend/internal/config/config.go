@@ -8,9 +8,15 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	OpenAI   OpenAIConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	OpenAI      OpenAIConfig
+	Search      SearchConfig
+	Attachments AttachmentConfig
+	Scripts     ScriptConfig
+	Retention   RetentionConfig
+	Export      ExportConfig
+	Secrets     SecretsConfig
 }
 
 // ServerConfig holds server-related configuration
@@ -28,6 +34,8 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	AutoMigrate bool // Development mode: sync tables with the models after the versioned migrations
 }
 
 // OpenAIConfig holds OpenAI-related configuration
@@ -39,6 +47,47 @@ type OpenAIConfig struct {
 	Temperature float64
 }
 
+// SearchConfig holds full-text search configuration
+type SearchConfig struct {
+	IndexAttachmentNames bool // Include attachment file names in the full-text index
+	BackfillBatchSize    int  // Number of emails indexed per batch when backfilling on startup
+}
+
+// AttachmentConfig holds attachment text extraction configuration
+type AttachmentConfig struct {
+	TextExtraction      bool  // Extract the text of attachments in the background
+	TextIntervalSeconds int   // Seconds between two extraction runs
+	TextBatchSize       int   // Number of attachments processed per batch
+	TextMaxBytes        int64 // Larger attachments are skipped
+}
+
+// ScriptConfig holds the limits of the JavaScript of extractors and trigger conditions
+type ScriptConfig struct {
+	WallTimeMillis int // Wall-clock milliseconds a single script may run before it is interrupted
+	HeapCeilingMB  int // Process heap above which running scripts are interrupted, shared by all scripts
+	OutputKB       int // Maximum size of the result of a script
+	PoolSize       int // Number of idle VMs kept for reuse
+}
+
+// RetentionConfig holds data retention configuration
+type RetentionConfig struct {
+	Enabled              bool // Run the background retention job
+	CheckIntervalMinutes int  // Minutes between two retention runs
+}
+
+// ExportConfig holds email export configuration
+type ExportConfig struct {
+	Dir          string // Directory where background export files are written
+	SyncLimit    int    // Exports with more emails than this must run as background jobs
+	FileTTLHours int    // Hours before a finished export file is deleted
+}
+
+// SecretsConfig holds the master keys that encrypt credentials at rest
+type SecretsConfig struct {
+	MasterKey     string // Comma separated "<id>:<base64 key>" entries, the first one encrypts new values
+	MasterKeyFile string // Used when MasterKey is empty, created with a new key when missing
+}
+
 // Load loads configuration from environment variables
 func Load() *Config {
 	return &Config{
@@ -54,6 +103,8 @@ func Load() *Config {
 			Password: getEnv("DB_PASSWORD", ""),
 			DBName:   getEnv("DB_NAME", "mailman.db"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			AutoMigrate: getEnvAsBool("DB_AUTO_MIGRATE", false),
 		},
 		OpenAI: OpenAIConfig{
 			BaseURL:     getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
@@ -62,6 +113,35 @@ func Load() *Config {
 			MaxTokens:   getEnvAsInt("OPENAI_MAX_TOKENS", 1000),
 			Temperature: getEnvAsFloat("OPENAI_TEMPERATURE", 0.7),
 		},
+		Search: SearchConfig{
+			IndexAttachmentNames: getEnvAsBool("SEARCH_INDEX_ATTACHMENT_NAMES", false),
+			BackfillBatchSize:    getEnvAsInt("SEARCH_BACKFILL_BATCH_SIZE", 500),
+		},
+		Attachments: AttachmentConfig{
+			TextExtraction:      getEnvAsBool("ATTACHMENT_TEXT_EXTRACTION", true),
+			TextIntervalSeconds: getEnvAsInt("ATTACHMENT_TEXT_INTERVAL_SECONDS", 30),
+			TextBatchSize:       getEnvAsInt("ATTACHMENT_TEXT_BATCH_SIZE", 50),
+			TextMaxBytes:        int64(getEnvAsInt("ATTACHMENT_TEXT_MAX_MB", 25)) << 20,
+		},
+		Scripts: ScriptConfig{
+			WallTimeMillis: getEnvAsInt("SCRIPT_WALL_TIME_MS", getEnvAsInt("SCRIPT_CPU_TIME_MS", 2000)),
+			HeapCeilingMB:  getEnvAsInt("SCRIPT_HEAP_CEILING_MB", 1024),
+			OutputKB:       getEnvAsInt("SCRIPT_OUTPUT_KB", 256),
+			PoolSize:       getEnvAsInt("SCRIPT_POOL_SIZE", 8),
+		},
+		Retention: RetentionConfig{
+			Enabled:              getEnvAsBool("RETENTION_ENABLED", true),
+			CheckIntervalMinutes: getEnvAsInt("RETENTION_CHECK_INTERVAL_MINUTES", 60),
+		},
+		Export: ExportConfig{
+			Dir:          getEnv("EXPORT_DIR", "./data/exports"),
+			SyncLimit:    getEnvAsInt("EXPORT_SYNC_LIMIT", 1000),
+			FileTTLHours: getEnvAsInt("EXPORT_FILE_TTL_HOURS", 24),
+		},
+		Secrets: SecretsConfig{
+			MasterKey:     getEnv("SECRETS_MASTER_KEY", ""),
+			MasterKeyFile: getEnv("SECRETS_MASTER_KEY_FILE", "./data/master.key"),
+		},
 	}
 }
 
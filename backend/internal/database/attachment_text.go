@@ -0,0 +1,47 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 5 为附件增加的文本列
+type attachmentV5 struct {
+	Text            string `gorm:"type:text"`
+	TextStatus      string `gorm:"type:varchar(16);index"`
+	TextError       string `gorm:"type:text"`
+	TextExtractedAt *time.Time
+}
+
+func (attachmentV5) TableName() string { return "attachments" }
+
+var attachmentTextColumns = []string{"Text", "TextStatus", "TextError", "TextExtractedAt"}
+
+// addAttachmentTextColumns adds the extracted text columns. Existing
+// attachments start out pending and are processed in the background.
+func addAttachmentTextColumns(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	for _, column := range attachmentTextColumns {
+		if err := migrator.AddColumn(&attachmentV5{}, column); err != nil {
+			return err
+		}
+	}
+	return migrator.CreateIndex(&attachmentV5{}, "TextStatus")
+}
+
+// dropAttachmentTextColumns removes the extracted text columns
+func dropAttachmentTextColumns(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if migrator.HasIndex(&attachmentV5{}, "TextStatus") {
+		if err := migrator.DropIndex(&attachmentV5{}, "TextStatus"); err != nil {
+			return err
+		}
+	}
+	for _, column := range attachmentTextColumns {
+		if err := migrator.DropColumn(&attachmentV5{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,517 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 基线（版本 1）的表结构：版本化迁移之前最后一个发布版本的模型快照。基线迁移和旧数据库
+// 的升级都按这些定义建表，因此版本 1 的含义不随模型变化，之后的结构变化全部由后续迁移
+// 完成。这里的定义不要修改；JSON 列使用 []byte，软删除列使用 *time.Time，与当时的列类型相同。
+
+type mailProviderV1 struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"unique;not null"`
+	Type       string `gorm:"not null"`
+	IMAPServer string `gorm:"not null"`
+	IMAPPort   int    `gorm:"not null"`
+	SMTPServer string
+	SMTPPort   int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  *time.Time `gorm:"index"`
+}
+
+func (mailProviderV1) TableName() string { return "mail_providers" }
+
+type emailAccountV1 struct {
+	ID               uint                  `gorm:"primaryKey"`
+	EmailAddress     string                `gorm:"uniqueIndex;not null;type:varchar(255)"`
+	AuthType         string                `gorm:"not null;default:'password'"`
+	Password         string                //
+	Token            string                //
+	MailProviderID   *uint                 `gorm:"index"`
+	MailProvider     *mailProviderV1       `gorm:"foreignKey:MailProviderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	OAuth2ProviderID *uint                 `gorm:"index"`
+	OAuth2Provider   *oauth2GlobalConfigV1 `gorm:"foreignKey:OAuth2ProviderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Proxy            string
+	IsDomainMail     bool   `gorm:"default:false"`
+	Domain           string `gorm:"index"`
+	CustomSettings   []byte `gorm:"type:json"`
+	LastSyncAt       *time.Time
+	IsVerified       bool `gorm:"default:false"`
+	VerifiedAt       *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        *time.Time `gorm:"index"`
+}
+
+func (emailAccountV1) TableName() string { return "email_accounts" }
+
+type emailV1 struct {
+	ID          uint           `gorm:"primaryKey"`
+	MessageID   string         `gorm:"index"`
+	AccountID   uint           `gorm:"not null"`
+	Account     emailAccountV1 `gorm:"foreignKey:AccountID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Subject     string
+	From        []byte         `gorm:"type:json"`
+	To          []byte         `gorm:"type:json"`
+	Cc          []byte         `gorm:"type:json"`
+	Bcc         []byte         `gorm:"type:json"`
+	ReplyTo     []byte         `gorm:"type:json"`
+	Date        time.Time      `gorm:"index"`
+	Body        string         `gorm:"type:text"`
+	HTMLBody    string         `gorm:"type:text"`
+	RawMessage  string         `gorm:"type:longtext"`
+	Attachments []attachmentV1 `gorm:"foreignKey:EmailID"`
+	MailboxName string         `gorm:"index"`
+	Flags       []byte         `gorm:"type:json"`
+	Size        int64
+	Tags        []tagV1 `gorm:"many2many:email_tags;joinForeignKey:EmailID;joinReferences:TagID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	IsRead      bool    `gorm:"default:false;index"`
+	IsStarred   bool    `gorm:"default:false;index"`
+	IsArchived  bool    `gorm:"default:false;index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `gorm:"index"`
+}
+
+func (emailV1) TableName() string { return "emails" }
+
+type attachmentV1 struct {
+	ID        uint    `gorm:"primaryKey"`
+	EmailID   uint    `gorm:"not null"`
+	Email     emailV1 `gorm:"foreignKey:EmailID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Filename  string  `gorm:"not null"`
+	Content   []byte  `gorm:"type:blob"`
+	MIMEType  string
+	Size      int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (attachmentV1) TableName() string { return "attachments" }
+
+type mailboxV1 struct {
+	ID        uint           `gorm:"primaryKey"`
+	Name      string         `gorm:"not null"`
+	AccountID uint           `gorm:"not null"`
+	Account   emailAccountV1 `gorm:"foreignKey:AccountID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Delimiter string
+	Flags     []byte `gorm:"type:json"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (mailboxV1) TableName() string { return "mailboxes" }
+
+type incrementalSyncRecordV1 struct {
+	ID                uint           `gorm:"primaryKey"`
+	AccountID         uint           `gorm:"not null;uniqueIndex:idx_account_mailbox"`
+	Account           emailAccountV1 `gorm:"foreignKey:AccountID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	MailboxName       string         `gorm:"not null;uniqueIndex:idx_account_mailbox;type:varchar(255)"`
+	LastSyncEndTime   time.Time      `gorm:"not null"`
+	LastSyncStartTime time.Time      `gorm:"not null"`
+	EmailsProcessed   int            `gorm:"default:0"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+func (incrementalSyncRecordV1) TableName() string { return "incremental_sync_records" }
+
+type extractorTemplateV1 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"not null;uniqueIndex;type:varchar(255)"`
+	Description string
+	Extractors  []byte `gorm:"type:json;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `gorm:"index"`
+}
+
+func (extractorTemplateV1) TableName() string { return "extractor_templates" }
+
+type openAIConfigV1 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"not null;uniqueIndex;type:varchar(255)"`
+	ChannelType string `gorm:"not null;default:'openai'"`
+	BaseURL     string `gorm:"not null"`
+	APIKey      string `gorm:"not null"`
+	Model       string `gorm:"not null"`
+	Headers     []byte `gorm:"type:json"`
+	IsActive    bool   `gorm:"default:false"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `gorm:"index"`
+}
+
+func (openAIConfigV1) TableName() string { return "open_ai_configs" }
+
+type aiPromptTemplateV1 struct {
+	ID           uint   `gorm:"primaryKey"`
+	Scenario     string `gorm:"not null;uniqueIndex;type:varchar(255)"`
+	Name         string `gorm:"not null"`
+	Description  string
+	SystemPrompt string  `gorm:"type:text;not null"`
+	UserPrompt   string  `gorm:"type:text"`
+	Variables    []byte  `gorm:"type:json"`
+	MaxTokens    int     `gorm:"default:1000"`
+	Temperature  float64 `gorm:"default:0.7"`
+	IsActive     bool    `gorm:"default:true"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time `gorm:"index"`
+}
+
+func (aiPromptTemplateV1) TableName() string { return "a_iprompt_templates" }
+
+type aiGeneratedTemplateV1 struct {
+	ID               uint               `gorm:"primaryKey"`
+	Name             string             `gorm:"not null"`
+	Description      string             //
+	PromptTemplateID uint               `gorm:"not null"`
+	PromptTemplate   aiPromptTemplateV1 `gorm:"foreignKey:PromptTemplateID"`
+	UserInput        string             `gorm:"type:text"`
+	GeneratedContent string             `gorm:"type:text"`
+	ExtractorConfig  []byte             `gorm:"type:json"`
+	Model            string
+	TokensUsed       int
+	CreatedBy        string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        *time.Time `gorm:"index"`
+}
+
+func (aiGeneratedTemplateV1) TableName() string { return "ai_generated_templates" }
+
+type userV1 struct {
+	ID           uint   `gorm:"primaryKey"`
+	Username     string `gorm:"uniqueIndex;not null;type:varchar(255)"`
+	Email        string `gorm:"uniqueIndex;not null;type:varchar(255)"`
+	PasswordHash string `gorm:"not null"`
+	Avatar       string `gorm:"type:text"`
+	IsActive     bool   `gorm:"default:true"`
+	LastLoginAt  *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time `gorm:"index"`
+}
+
+func (userV1) TableName() string { return "users" }
+
+type userSessionV1 struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	User      userV1    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Token     string    `gorm:"uniqueIndex;not null;type:varchar(255)"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (userSessionV1) TableName() string { return "user_sessions" }
+
+type emailAccountSyncConfigV1 struct {
+	ID                uint   `gorm:"primaryKey"`
+	AccountID         uint   `gorm:"uniqueIndex;not null"`
+	EnableAutoSync    bool   `gorm:"default:true"`
+	SyncInterval      int    `gorm:"default:5"`
+	SyncFolders       []byte `gorm:"type:text"`
+	LastSyncTime      *time.Time
+	LastSyncEndTime   *time.Time
+	LastSyncMessageID string
+	LastSyncError     string
+	SyncStatus        string `gorm:"default:idle"`
+	LastHistoryID     string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Account           emailAccountV1 `gorm:"foreignKey:AccountID;constraint:OnDelete:CASCADE"`
+}
+
+func (emailAccountSyncConfigV1) TableName() string { return "email_account_sync_configs" }
+
+type globalSyncConfigV1 struct {
+	ID                  uint   `gorm:"primaryKey"`
+	DefaultEnableSync   bool   `gorm:"default:true"`
+	DefaultSyncInterval int    `gorm:"default:5"`
+	DefaultSyncFolders  []byte `gorm:"type:text"`
+	MaxSyncWorkers      int    `gorm:"default:10"`
+	MaxEmailsPerSync    int    `gorm:"default:100"`
+	UpdatedAt           time.Time
+}
+
+func (globalSyncConfigV1) TableName() string { return "global_sync_configs" }
+
+type syncStatisticsV1 struct {
+	ID             uint      `gorm:"primaryKey"`
+	AccountID      uint      `gorm:"not null"`
+	SyncDate       time.Time `gorm:"type:date;not null"`
+	EmailsSynced   int       `gorm:"default:0"`
+	SyncDurationMs int       `gorm:"default:0"`
+	ErrorsCount    int       `gorm:"default:0"`
+	CreatedAt      time.Time
+	Account        emailAccountV1 `gorm:"foreignKey:AccountID;constraint:OnDelete:CASCADE"`
+}
+
+func (syncStatisticsV1) TableName() string { return "sync_statistics" }
+
+type activityLogV1 struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `gorm:"index"`
+	Type        string     `gorm:"type:varchar(50);not null;index"`
+	Title       string     `gorm:"type:varchar(255);not null"`
+	Description string     `gorm:"type:text"`
+	UserID      *uint      `gorm:"index"`
+	User        *userV1    `gorm:"foreignKey:UserID"`
+	EmailID     *uint      `gorm:"index"`
+	AccountID   *uint      `gorm:"index"`
+	Metadata    string     `gorm:"type:text"`
+	Status      string     `gorm:"type:varchar(50);default:'success'"`
+	IPAddress   string     `gorm:"type:varchar(45)"`
+}
+
+func (activityLogV1) TableName() string { return "activity_logs" }
+
+type emailTriggerV1 struct {
+	ID                uint   `gorm:"primaryKey"`
+	Name              string `gorm:"not null;type:varchar(255)"`
+	Description       string
+	Status            string `gorm:"not null;default:'disabled'"`
+	CheckInterval     int    `gorm:"not null;default:30"`
+	EmailAddress      string
+	StartDate         *time.Time
+	EndDate           *time.Time
+	Subject           string
+	From              string
+	To                string
+	HasAttachment     *bool
+	Unread            *bool
+	Labels            []byte `gorm:"type:json"`
+	Folders           []byte `gorm:"type:json"`
+	CustomFilters     []byte `gorm:"type:json"`
+	Query             string `gorm:"type:text"`
+	Condition         []byte `gorm:"type:json;not null"`
+	Actions           []byte `gorm:"type:json;not null"`
+	EnableLogging     bool   `gorm:"default:true"`
+	TotalExecutions   int64  `gorm:"default:0"`
+	SuccessExecutions int64  `gorm:"default:0"`
+	LastExecutedAt    *time.Time
+	LastError         string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	DeletedAt         *time.Time `gorm:"index"`
+}
+
+func (emailTriggerV1) TableName() string { return "email_triggers" }
+
+type triggerExecutionLogV1 struct {
+	ID              uint           `gorm:"primaryKey"`
+	TriggerID       uint           `gorm:"not null;index"`
+	Trigger         emailTriggerV1 `gorm:"foreignKey:TriggerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Status          string         `gorm:"not null"`
+	StartTime       time.Time      `gorm:"not null"`
+	EndTime         time.Time      `gorm:"not null"`
+	ExecutionMs     int64          `gorm:"not null"`
+	EmailID         uint           `gorm:"not null;index"`
+	Email           emailV1        `gorm:"foreignKey:EmailID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	InputParams     []byte         `gorm:"type:json"`
+	ConditionResult bool           `gorm:"not null"`
+	ConditionError  string
+	ActionResults   []byte `gorm:"type:json"`
+	ErrorMessage    string
+	CreatedAt       time.Time
+}
+
+func (triggerExecutionLogV1) TableName() string { return "trigger_execution_logs" }
+
+type oauth2AuthSessionV1 struct {
+	ID             uint                 `gorm:"primaryKey"`
+	State          string               `gorm:"unique;not null;index"`
+	ProviderID     uint                 `gorm:"not null"`
+	Provider       oauth2GlobalConfigV1 `gorm:"foreignKey:ProviderID"`
+	Status         string               `gorm:"default:'pending'"`
+	ErrorMsg       string
+	ExpiresAt      time.Time `gorm:"not null"`
+	EmailAddress   string
+	AccessToken    string
+	RefreshToken   string
+	TokenExpiresAt int64
+	TokenType      string
+	UserInfo       string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      *time.Time `gorm:"index"`
+}
+
+func (oauth2AuthSessionV1) TableName() string { return "o_auth2_auth_sessions" }
+
+type oauth2GlobalConfigV1 struct {
+	ID           uint   `gorm:"primaryKey"`
+	Name         string `gorm:"uniqueIndex;type:varchar(255)"`
+	ProviderType string `gorm:"type:varchar(50);not null;index"`
+	ClientID     string `gorm:"not null"`
+	ClientSecret string `gorm:"not null"`
+	RedirectURI  string `gorm:"not null"`
+	Scopes       []byte `gorm:"type:json"`
+	IsEnabled    bool   `gorm:"default:true"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time `gorm:"index"`
+}
+
+func (oauth2GlobalConfigV1) TableName() string { return "o_auth2_global_configs" }
+
+type emailSearchDocumentV1 struct {
+	EmailID         uint   `gorm:"primaryKey;autoIncrement:false"`
+	AccountID       uint   `gorm:"index"`
+	Subject         string `gorm:"type:text"`
+	Addresses       string `gorm:"type:text"`
+	Content         string `gorm:"type:text"`
+	AttachmentNames string `gorm:"type:text"`
+	SenderDomain    string `gorm:"type:varchar(255);index"`
+	IndexedAt       time.Time
+}
+
+func (emailSearchDocumentV1) TableName() string { return "email_search_documents" }
+
+type savedSearchV1 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"not null;uniqueIndex;type:varchar(255)"`
+	Description string
+	Query       string `gorm:"type:text;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (savedSearchV1) TableName() string { return "saved_searches" }
+
+type retentionPolicyV1 struct {
+	ID                    uint   `gorm:"primaryKey"`
+	Name                  string `gorm:"not null;type:varchar(255)"`
+	Description           string
+	Target                string `gorm:"not null;type:varchar(50);default:'emails'"`
+	Scope                 string `gorm:"not null;type:varchar(20);default:'global'"`
+	AccountID             *uint  `gorm:"index"`
+	MailboxName           string `gorm:"type:varchar(255)"`
+	DeleteAfterDays       int    `gorm:"default:0"`
+	StripContentAfterDays int    `gorm:"default:0"`
+	MaxMessages           int    `gorm:"default:0"`
+	Enabled               bool   `gorm:"default:true"`
+	LastRunAt             *time.Time
+	LastPurged            int64 `gorm:"default:0"`
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+func (retentionPolicyV1) TableName() string { return "retention_policies" }
+
+type exportJobV1 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Format      string `gorm:"not null;type:varchar(20)"`
+	Filter      []byte `gorm:"type:json"`
+	Status      string `gorm:"not null;type:varchar(20);index"`
+	EmailCount  int64  `gorm:"default:0"`
+	FilePath    string
+	FileName    string
+	FileSize    int64  `gorm:"default:0"`
+	Error       string `gorm:"type:text"`
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time `gorm:"index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (exportJobV1) TableName() string { return "export_jobs" }
+
+type tagV1 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"not null;uniqueIndex;type:varchar(100)"`
+	Color       string `gorm:"type:varchar(20)"`
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (tagV1) TableName() string { return "tags" }
+
+type emailTagV1 struct {
+	EmailID   uint `gorm:"primaryKey"`
+	TagID     uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+func (emailTagV1) TableName() string { return "email_tags" }
+
+type emailAddressV1 struct {
+	ID        uint   `gorm:"primaryKey"`
+	EmailID   uint   `gorm:"not null;index"`
+	Role      string `gorm:"type:varchar(16);not null;index:idx_email_addresses_role_address,priority:1"`
+	Position  int
+	Name      string `gorm:"type:varchar(255)"`
+	LocalPart string `gorm:"type:varchar(255)"`
+	Domain    string `gorm:"type:varchar(255);index"`
+	Address   string `gorm:"type:varchar(320);index;index:idx_email_addresses_role_address,priority:2"`
+}
+
+func (emailAddressV1) TableName() string { return "email_addresses" }
+
+// baselineModels are the tables of the baseline in the order the last
+// unversioned release migrated them. OAuth2 configurations are handled by
+// migrateOAuth2GlobalConfig, whose old table needs a fixup.
+var baselineModels = []interface{}{
+	&mailProviderV1{},
+	&emailAccountV1{},
+	&emailV1{},
+	&attachmentV1{},
+	&mailboxV1{},
+	&incrementalSyncRecordV1{},
+	&extractorTemplateV1{},
+	&openAIConfigV1{},
+	&aiPromptTemplateV1{},
+	&aiGeneratedTemplateV1{},
+	&userV1{},
+	&userSessionV1{},
+	&emailAccountSyncConfigV1{},
+	&globalSyncConfigV1{},
+	&syncStatisticsV1{},
+	&activityLogV1{},
+	&emailTriggerV1{},
+	&triggerExecutionLogV1{},
+	&oauth2AuthSessionV1{},
+	&emailSearchDocumentV1{},
+	&savedSearchV1{},
+	&retentionPolicyV1{},
+	&exportJobV1{},
+	&tagV1{},
+	&emailTagV1{},
+	&emailAddressV1{},
+}
+
+// createBaseline creates the baseline schema on an empty database
+func createBaseline(tx *gorm.DB) error {
+	if err := migrateBaselineTables(tx); err != nil {
+		return err
+	}
+	if err := tx.AutoMigrate(&oauth2GlobalConfigV1{}); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+	return migrateSearchIndex(tx)
+}
+
+// migrateBaselineTables creates or completes the baseline tables except the
+// OAuth2 configurations
+func migrateBaselineTables(tx *gorm.DB) error {
+	// 邮件标签使用自定义的关联表
+	if err := tx.SetupJoinTable(&emailV1{}, "Tags", &emailTagV1{}); err != nil {
+		return fmt.Errorf("failed to set up email tags join table: %w", err)
+	}
+	if err := tx.AutoMigrate(baselineModels...); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 4 创建通讯录表时的表结构。迁移不能依赖会继续变化的模型，因此在这里固定一份
+type contactV4 struct {
+	ID           uint   `gorm:"primaryKey"`
+	Address      string `gorm:"type:varchar(320);uniqueIndex;not null"`
+	Name         string `gorm:"type:varchar(255);index"`
+	CustomName   bool   `gorm:"default:false"`
+	DisplayNames string `gorm:"type:json"`
+	Organization string `gorm:"type:varchar(255)"`
+	Phones       string `gorm:"type:json"`
+	Notes        string `gorm:"type:text"`
+	FromCount    int64  `gorm:"default:0"`
+	ToCount      int64  `gorm:"default:0"`
+	MessageCount int64  `gorm:"default:0;index"`
+	FirstSeenAt  *time.Time
+	LastSeenAt   *time.Time `gorm:"index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+
+	Addresses []contactAddressV4 `gorm:"foreignKey:ContactID;constraint:OnDelete:CASCADE;"`
+	Accounts  []contactAccountV4 `gorm:"foreignKey:ContactID;constraint:OnDelete:CASCADE;"`
+}
+
+func (contactV4) TableName() string { return "contacts" }
+
+type contactAddressV4 struct {
+	ID        uint   `gorm:"primaryKey"`
+	ContactID uint   `gorm:"not null;index"`
+	Address   string `gorm:"type:varchar(320);uniqueIndex;not null"`
+}
+
+func (contactAddressV4) TableName() string { return "contact_addresses" }
+
+type contactAccountV4 struct {
+	ContactID   uint `gorm:"primaryKey"`
+	AccountID   uint `gorm:"primaryKey;index"`
+	FromCount   int64
+	ToCount     int64
+	FirstSeenAt *time.Time
+	LastSeenAt  *time.Time
+}
+
+func (contactAccountV4) TableName() string { return "contact_accounts" }
+
+// createContactTables creates the tables of the contacts directory. The
+// contacts themselves are created from the stored emails at startup.
+func createContactTables(tx *gorm.DB) error {
+	return tx.AutoMigrate(&contactV4{}, &contactAddressV4{}, &contactAccountV4{})
+}
+
+// dropContactTables removes the contacts directory
+func dropContactTables(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&contactAccountV4{}, &contactAddressV4{}, &contactV4{})
+}
@@ -26,6 +26,10 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	Quiet    bool // 不输出 SQL 日志，命令行子命令使用
+
+	SkipMigrations bool // 只连接数据库，不执行迁移（mailman migrate 使用）
+	AutoMigrate    bool // 开发模式：迁移之后再用 AutoMigrate 同步模型变更
 }
 
 // Initialize sets up the database connection
@@ -47,6 +51,9 @@ func Initialize(config Config) error {
 	gormConfig := &gorm.Config{
 		Logger: newLogger,
 	}
+	if config.Quiet {
+		gormConfig.Logger = newLogger.LogMode(logger.Silent)
+	}
 
 	switch config.Driver {
 	case "sqlite":
@@ -68,110 +75,111 @@ func Initialize(config Config) error {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// 邮件标签使用自定义的关联表
+	if err := DB.SetupJoinTable(&models.Email{}, "Tags", &models.EmailTag{}); err != nil {
+		return fmt.Errorf("failed to set up email tags join table: %w", err)
+	}
+
+	if config.SkipMigrations {
+		return nil
+	}
+
 	// Run migrations
 	if err := Migrate(); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
+	if config.AutoMigrate {
+		if err := AutoMigrate(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-// Migrate runs database migrations
+// Migrate applies the pending versioned migrations, see migrations.go
 func Migrate() error {
-	// 首先迁移除了OAuth2GlobalConfig之外的所有表
-	if err := DB.AutoMigrate(
-		&models.MailProvider{},
-		&models.EmailAccount{},
-		&models.Email{},
-		&models.Attachment{},
-		&models.Mailbox{},
-		&models.IncrementalSyncRecord{},
-		&models.ExtractorTemplate{},
-		&models.OpenAIConfig{},
-		&models.AIPromptTemplate{},
-		&models.AIGeneratedTemplate{},
-		&models.User{},
-		&models.UserSession{},
-		&models.EmailAccountSyncConfig{},
-		&models.GlobalSyncConfig{},
-		&models.SyncStatistics{},
-		&models.ActivityLog{},
-		&models.EmailTrigger{},
-		&models.TriggerExecutionLog{},
-		&models.OAuth2AuthSession{},
-	); err != nil {
-		return fmt.Errorf("failed to migrate tables: %w", err)
-	}
-
-	// 单独处理OAuth2GlobalConfig的迁移
-	if err := migrateOAuth2GlobalConfig(); err != nil {
-		return fmt.Errorf("failed to migrate OAuth2GlobalConfig: %w", err)
+	applied, err := NewMigrator(DB).Up()
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		log.Printf("[Database] Applied %d migrations, schema is at version %d", len(applied), applied[len(applied)-1].Version)
 	}
-
 	return nil
 }
 
+// AutoMigrate 开发模式：让表结构直接跟随模型定义，省去为每次改动编写迁移。
+// 它不会删除列或修改索引，生产环境应使用版本化迁移
+func AutoMigrate() error {
+	log.Printf("[Database] Development mode: auto-migrating models")
+	if err := DB.AutoMigrate(schemaModels...); err != nil {
+		return fmt.Errorf("failed to auto-migrate tables: %w", err)
+	}
+	return migrateSearchIndex(DB)
+}
+
 // migrateOAuth2GlobalConfig 处理OAuth2GlobalConfig的完整迁移
-func migrateOAuth2GlobalConfig() error {
+func migrateOAuth2GlobalConfig(db *gorm.DB) error {
 	// 检查表是否存在
-	if !DB.Migrator().HasTable(&models.OAuth2GlobalConfig{}) {
+	if !db.Migrator().HasTable(&oauth2GlobalConfigV1{}) {
 		// 表不存在，直接创建
-		return DB.AutoMigrate(&models.OAuth2GlobalConfig{})
+		return db.AutoMigrate(&oauth2GlobalConfigV1{})
 	}
 
 	// 处理旧表结构迁移（移除provider_type唯一约束）
-	if err := migrateOAuth2ProviderTypeConstraint(); err != nil {
+	if err := migrateOAuth2ProviderTypeConstraint(db); err != nil {
 		return fmt.Errorf("failed to migrate provider_type constraint: %w", err)
 	}
 
 	// 检查name字段是否存在
-	if !DB.Migrator().HasColumn(&models.OAuth2GlobalConfig{}, "name") {
+	if !db.Migrator().HasColumn(&oauth2GlobalConfigV1{}, "name") {
 		// 添加name字段（允许为空）
-		if err := DB.Exec("ALTER TABLE o_auth2_global_configs ADD COLUMN name TEXT").Error; err != nil {
+		if err := db.Exec("ALTER TABLE o_auth2_global_configs ADD COLUMN name TEXT").Error; err != nil {
 			return fmt.Errorf("failed to add name column: %w", err)
 		}
 
 		// 为现有记录更新name字段
-		if err := DB.Exec("UPDATE o_auth2_global_configs SET name = 'Default ' || provider_type || ' Config' WHERE name IS NULL OR name = ''").Error; err != nil {
+		if err := db.Exec("UPDATE o_auth2_global_configs SET name = 'Default ' || provider_type || ' Config' WHERE name IS NULL OR name = ''").Error; err != nil {
 			return fmt.Errorf("failed to update name field for existing records: %w", err)
 		}
 	}
 
 	// 检查是否需要更新其他字段
-	return DB.AutoMigrate(&models.OAuth2GlobalConfig{})
+	return db.AutoMigrate(&oauth2GlobalConfigV1{})
 }
 
 // migrateOAuth2ProviderTypeConstraint 处理provider_type字段的约束迁移
-func migrateOAuth2ProviderTypeConstraint() error {
+func migrateOAuth2ProviderTypeConstraint(db *gorm.DB) error {
 	// 检查是否存在provider_type的唯一约束（通过尝试插入重复数据来检测）
 	var count int64
-	DB.Model(&models.OAuth2GlobalConfig{}).Count(&count)
+	db.Model(&oauth2GlobalConfigV1{}).Count(&count)
 	
 	// 如果表中有数据，先检查约束
 	if count > 0 {
 		// 获取现有的一条记录来测试
-		var existingConfig models.OAuth2GlobalConfig
-		if err := DB.First(&existingConfig).Error; err == nil {
+		var existingConfig oauth2GlobalConfigV1
+		if err := db.First(&existingConfig).Error; err == nil {
 			// 尝试创建一个具有相同provider_type的临时记录来测试唯一约束
-			testConfig := models.OAuth2GlobalConfig{
+			testConfig := oauth2GlobalConfigV1{
 				Name:         "test_constraint_check",
 				ProviderType: existingConfig.ProviderType,
 				ClientID:     "test",
 				ClientSecret: "test",
 				RedirectURI:  "http://test.com",
-				Scopes:       models.StringSlice{"test"},
+				Scopes:       []byte(`["test"]`),
 				IsEnabled:    false,
 			}
 			
 			// 尝试插入，如果失败说明有唯一约束
-			if err := DB.Create(&testConfig).Error; err != nil {
+			if err := db.Create(&testConfig).Error; err != nil {
 				if err.Error() == "UNIQUE constraint failed: o_auth2_global_configs.provider_type" {
 					// 存在唯一约束，需要重建表
-					return recreateOAuth2ConfigTable()
+					return recreateOAuth2ConfigTable(db)
 				}
 			} else {
 				// 插入成功，删除测试记录
-				DB.Delete(&testConfig)
+				db.Delete(&testConfig)
 			}
 		}
 	}
@@ -180,20 +188,20 @@ func migrateOAuth2ProviderTypeConstraint() error {
 }
 
 // recreateOAuth2ConfigTable 重建OAuth2GlobalConfig表以移除provider_type的唯一约束
-func recreateOAuth2ConfigTable() error {
+func recreateOAuth2ConfigTable(db *gorm.DB) error {
 	// 1. 备份现有数据
-	var existingConfigs []models.OAuth2GlobalConfig
-	if err := DB.Find(&existingConfigs).Error; err != nil {
+	var existingConfigs []oauth2GlobalConfigV1
+	if err := db.Find(&existingConfigs).Error; err != nil {
 		return fmt.Errorf("failed to backup existing configs: %w", err)
 	}
 
 	// 2. 删除现有表
-	if err := DB.Migrator().DropTable(&models.OAuth2GlobalConfig{}); err != nil {
+	if err := db.Migrator().DropTable(&oauth2GlobalConfigV1{}); err != nil {
 		return fmt.Errorf("failed to drop existing table: %w", err)
 	}
 
-	// 3. 创建新表（使用当前模型定义，没有唯一约束）
-	if err := DB.AutoMigrate(&models.OAuth2GlobalConfig{}); err != nil {
+	// 3. 创建新表（使用基线定义，没有唯一约束）
+	if err := db.AutoMigrate(&oauth2GlobalConfigV1{}); err != nil {
 		return fmt.Errorf("failed to create new table: %w", err)
 	}
 
@@ -202,7 +210,7 @@ func recreateOAuth2ConfigTable() error {
 		if config.Name == "" {
 			config.Name = fmt.Sprintf("Default %s Config %d", config.ProviderType, i+1)
 		}
-		if err := DB.Create(&config).Error; err != nil {
+		if err := db.Create(&config).Error; err != nil {
 			return fmt.Errorf("failed to restore config %d: %w", config.ID, err)
 		}
 	}
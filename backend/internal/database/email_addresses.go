@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// needsAddressBackfill reports whether emails exist from before the
+// normalized email_addresses table, checked before the baseline tables are completed
+func needsAddressBackfill(db *gorm.DB) bool {
+	migrator := db.Migrator()
+	return migrator.HasTable(&emailV1{}) && !migrator.HasTable(&emailAddressV1{})
+}
+
+// backfillEmailAddresses fills the email_addresses table from the address
+// columns of existing emails, the same way new emails are indexed on insert
+func backfillEmailAddresses(db *gorm.DB) error {
+	const batchSize = 500
+
+	var lastID uint
+	var total int
+	for {
+		var emails []models.Email
+		err := db.Select("id", "from", "to", "cc", "bcc", "reply_to").
+			Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&emails).Error
+		if err != nil {
+			return fmt.Errorf("failed to load emails for address backfill: %w", err)
+		}
+		if len(emails) == 0 {
+			break
+		}
+
+		var records []emailAddressV1
+		for i := range emails {
+			for _, address := range emails[i].AddressRecords() {
+				records = append(records, emailAddressV1{
+					EmailID:   address.EmailID,
+					Role:      string(address.Role),
+					Position:  address.Position,
+					Name:      address.Name,
+					LocalPart: address.LocalPart,
+					Domain:    address.Domain,
+					Address:   address.Address,
+				})
+			}
+		}
+		if len(records) > 0 {
+			if err := db.CreateInBatches(records, batchSize).Error; err != nil {
+				return fmt.Errorf("failed to backfill email addresses: %w", err)
+			}
+		}
+		total += len(records)
+		lastID = emails[len(emails)-1].ID
+	}
+
+	log.Printf("[Database] Backfilled %d email addresses", total)
+	return nil
+}
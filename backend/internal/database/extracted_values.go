@@ -0,0 +1,33 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 9 创建的提取结果表
+type extractedValueV9 struct {
+	ID          uint   `gorm:"primaryKey"`
+	EmailID     uint   `gorm:"not null;uniqueIndex:idx_extracted_values_email_template_field,priority:1"`
+	TemplateID  uint   `gorm:"not null;uniqueIndex:idx_extracted_values_email_template_field,priority:2;index:idx_extracted_values_template_field,priority:1"`
+	Revision    int    `gorm:"not null;default:0"`
+	Field       string `gorm:"type:varchar(255);not null;uniqueIndex:idx_extracted_values_email_template_field,priority:3;index:idx_extracted_values_template_field,priority:2"`
+	Type        string `gorm:"type:varchar(16);not null"`
+	Value       string `gorm:"type:text"`
+	Number      *float64
+	Date        *time.Time
+	ExtractedAt time.Time `gorm:"not null;index"`
+}
+
+func (extractedValueV9) TableName() string { return "extracted_values" }
+
+// createExtractedValues creates the table of stored extraction results
+func createExtractedValues(tx *gorm.DB) error {
+	return tx.AutoMigrate(&extractedValueV9{})
+}
+
+// dropExtractedValues removes the stored extraction results
+func dropExtractedValues(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&extractedValueV9{})
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 10 创建的提取流水线表
+type extractionPipelineV10 struct {
+	ID             uint   `gorm:"primaryKey"`
+	Name           string `gorm:"not null;uniqueIndex;type:varchar(255)"`
+	Description    string
+	TemplateID     uint   `gorm:"not null;index"`
+	Enabled        bool   `gorm:"default:true"`
+	AccountIDs     []byte `gorm:"type:json"`
+	AliasPatterns  []byte `gorm:"type:json"`
+	SenderDomains  []byte `gorm:"type:json"`
+	Mailboxes      []byte `gorm:"type:json"`
+	Query          string `gorm:"type:text"`
+	WebhookURL     string `gorm:"type:varchar(1024)"`
+	WebhookSecret  string
+	LastEmailID    uint  `gorm:"not null;default:0"`
+	ProcessedCount int64 `gorm:"not null;default:0"`
+	ExtractedCount int64 `gorm:"not null;default:0"`
+	LastRunAt      *time.Time
+	LastError      string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (extractionPipelineV10) TableName() string { return "extraction_pipelines" }
+
+// createExtractionPipelines creates the table of automatic extraction pipelines
+func createExtractionPipelines(tx *gorm.DB) error {
+	return tx.AutoMigrate(&extractionPipelineV10{})
+}
+
+// dropExtractionPipelines removes the extraction pipelines
+func dropExtractionPipelines(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&extractionPipelineV10{})
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 8 创建的提取模板测试用例表
+type extractorFixtureV8 struct {
+	ID           uint   `gorm:"primaryKey"`
+	TemplateID   uint   `gorm:"not null;index"`
+	Name         string `gorm:"type:varchar(255);not null"`
+	Source       string `gorm:"type:varchar(16);not null"`
+	EmailID      *uint  `gorm:"index"`
+	RawMessage   []byte
+	Expected     []byte `gorm:"type:json"`
+	LastStatus   string `gorm:"type:varchar(16)"`
+	LastRunAt    *time.Time
+	LastBuiltins string `gorm:"type:varchar(255)"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (extractorFixtureV8) TableName() string { return "extractor_fixtures" }
+
+// createExtractorFixtures creates the table of extractor regression fixtures
+func createExtractorFixtures(tx *gorm.DB) error {
+	return tx.AutoMigrate(&extractorFixtureV8{})
+}
+
+// dropExtractorFixtures removes the extractor regression fixtures
+func dropExtractorFixtures(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&extractorFixtureV8{})
+}
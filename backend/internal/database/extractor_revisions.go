@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 6 为提取模板增加的当前修订号
+type extractorTemplateV6 struct {
+	Revision int `gorm:"not null;default:0"`
+}
+
+func (extractorTemplateV6) TableName() string { return "extractor_templates" }
+
+// 迁移 6 创建的修订表
+type extractorTemplateRevisionV6 struct {
+	ID          uint   `gorm:"primaryKey"`
+	TemplateID  uint   `gorm:"not null;uniqueIndex:idx_extractor_revisions_template_revision"`
+	Revision    int    `gorm:"not null;uniqueIndex:idx_extractor_revisions_template_revision"`
+	Name        string `gorm:"type:varchar(255)"`
+	Description string
+	Extractors  []byte `gorm:"type:json;not null"`
+	AuthorID    *uint
+	Author      string `gorm:"type:varchar(255)"`
+	Message     string `gorm:"type:varchar(255)"`
+	CreatedAt   time.Time
+}
+
+func (extractorTemplateRevisionV6) TableName() string { return "extractor_template_revisions" }
+
+// initialRevisionMessage marks the revisions created from templates that
+// existed before revision history
+const initialRevisionMessage = "initial revision"
+
+// createExtractorRevisions adds revision history to extractor templates
+func createExtractorRevisions(tx *gorm.DB) error {
+	if err := tx.Migrator().AddColumn(&extractorTemplateV6{}, "Revision"); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(&extractorTemplateRevisionV6{})
+}
+
+// dropExtractorRevisions removes revision history
+func dropExtractorRevisions(tx *gorm.DB) error {
+	if err := tx.Migrator().DropTable(&extractorTemplateRevisionV6{}); err != nil {
+		return err
+	}
+	return tx.Migrator().DropColumn(&extractorTemplateV6{}, "Revision")
+}
+
+// createInitialRevisions records the current state of templates without any
+// revision as their revision 1, so that later edits can be diffed against it
+func createInitialRevisions(tx *gorm.DB) error {
+	var templates []struct {
+		ID          uint
+		Name        string
+		Description string
+		Extractors  []byte
+		UpdatedAt   time.Time
+	}
+	err := tx.Table("extractor_templates").
+		Select("id, name, description, extractors, updated_at").
+		Where("id NOT IN (?)", tx.Table("extractor_template_revisions").Select("template_id")).
+		Find(&templates).Error
+	if err != nil {
+		return fmt.Errorf("failed to read extractor templates: %w", err)
+	}
+
+	for _, template := range templates {
+		// 与模型一致按字节写入，读取时 ExtractorTemplateConfigs 只接受 []byte
+		extractors := template.Extractors
+		if len(extractors) == 0 {
+			extractors = []byte("[]")
+		}
+		revision := extractorTemplateRevisionV6{
+			TemplateID:  template.ID,
+			Revision:    1,
+			Name:        template.Name,
+			Description: template.Description,
+			Extractors:  extractors,
+			Message:     initialRevisionMessage,
+			CreatedAt:   template.UpdatedAt,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return fmt.Errorf("failed to create revision of extractor template %d: %w", template.ID, err)
+		}
+		if err := tx.Table("extractor_templates").Where("id = ?", template.ID).UpdateColumn("revision", 1).Error; err != nil {
+			return fmt.Errorf("failed to update extractor template %d: %w", template.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// needsLocalStateSeed reports whether the emails table predates the local
+// read/starred state columns, checked before the baseline tables are completed
+func needsLocalStateSeed(db *gorm.DB) bool {
+	migrator := db.Migrator()
+	return migrator.HasTable(&emailV1{}) && !migrator.HasColumn(&emailV1{}, "IsRead")
+}
+
+// seedLocalState initializes the local read/starred state of existing emails
+// from their IMAP flags, the same way new emails are seeded on insert
+func seedLocalState(db *gorm.DB) error {
+	textType := "TEXT"
+	if db.Dialector.Name() == "mysql" {
+		textType = "CHAR"
+	}
+	flags := fmt.Sprintf("LOWER(COALESCE(CAST(flags AS %s), ''))", textType)
+
+	read := db.Exec("UPDATE emails SET is_read = ? WHERE "+flags+` LIKE '%seen"%'`, true)
+	if read.Error != nil {
+		return fmt.Errorf("failed to seed read state: %w", read.Error)
+	}
+	starred := db.Exec("UPDATE emails SET is_starred = ? WHERE "+flags+` LIKE '%flagged"%'`, true)
+	if starred.Error != nil {
+		return fmt.Errorf("failed to seed starred state: %w", starred.Error)
+	}
+
+	log.Printf("[Database] Seeded local state from IMAP flags: %d read, %d starred", read.RowsAffected, starred.RowsAffected)
+	return nil
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"fmt"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// schemaModels are the models whose tables make up the current schema. The
+// development mode migrates them directly; migrations must arrive at the same
+// tables and columns, see TestMigrationsMatchModels.
+var schemaModels = []interface{}{
+	&models.MailProvider{},
+	&models.EmailAccount{},
+	&models.Email{},
+	&models.Attachment{},
+	&models.Mailbox{},
+	&models.IncrementalSyncRecord{},
+	&models.ExtractorTemplate{},
+	&models.ExtractorTemplateRevision{},
+	&models.ExtractorFixture{},
+	&models.ExtractedValue{},
+	&models.ExtractionPipeline{},
+	&models.TriggerLedgerEntry{},
+	&models.OpenAIConfig{},
+	&models.AIPromptTemplate{},
+	&models.AIGeneratedTemplate{},
+	&models.User{},
+	&models.UserSession{},
+	&models.EmailAccountSyncConfig{},
+	&models.GlobalSyncConfig{},
+	&models.SyncStatistics{},
+	&models.ActivityLog{},
+	&models.EmailTrigger{},
+	&models.TriggerExecutionLog{},
+	&models.OAuth2AuthSession{},
+	&models.OAuth2GlobalConfig{},
+	&models.EmailSearchDocument{},
+	&models.SavedSearch{},
+	&models.RetentionPolicy{},
+	&models.ExportJob{},
+	&models.Tag{},
+	&models.EmailTag{},
+	&models.EmailAddress{},
+	&models.Contact{},
+	&models.ContactAddress{},
+	&models.ContactAccount{},
+}
+
+// migrations 版本化迁移，按版本号顺序执行。
+//
+// 基线迁移按 baseline.go 中冻结的表结构建表，新数据库和已有数据库都从基线开始依次执行
+// 后续迁移。因此修改模型时必须同时追加一个迁移；迁移中使用显式的 SQL 或带版本号的结构体，
+// 不要依赖会随代码变化的模型定义。
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up:      createBaseline,
+		Down: func(tx *gorm.DB) error {
+			return fmt.Errorf("%w: restore a backup or drop the database instead", ErrIrreversible)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "emails_account_mailbox_date_index",
+		Up: SQLStep(map[string][]string{
+			"": {"CREATE INDEX idx_emails_account_mailbox_date ON emails (account_id, mailbox_name, date)"},
+		}),
+		Down: SQLStep(map[string][]string{
+			"mysql": {"DROP INDEX idx_emails_account_mailbox_date ON emails"},
+			"":      {"DROP INDEX idx_emails_account_mailbox_date"},
+		}),
+	},
+	{
+		// 加密已有的账户密码、令牌、OAuth2 client secret 和 AI API key
+		Version: 3,
+		Name:    "encrypt_secrets",
+		Up:      encryptSecrets,
+		Down:    decryptSecrets,
+	},
+	{
+		Version: 4,
+		Name:    "contacts",
+		Up:      createContactTables,
+		Down:    dropContactTables,
+	},
+	{
+		Version: 5,
+		Name:    "attachment_text",
+		Up:      addAttachmentTextColumns,
+		Down:    dropAttachmentTextColumns,
+	},
+	{
+		Version: 6,
+		Name:    "extractor_template_revisions",
+		Up:      createExtractorRevisions,
+		Down:    dropExtractorRevisions,
+	},
+	{
+		// 为已有模板记录修订 1；回滚迁移 6 时修订表整体删除，这里无需撤销
+		Version: 7,
+		Name:    "extractor_template_initial_revisions",
+		Up:      createInitialRevisions,
+		Down:    func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 8,
+		Name:    "extractor_fixtures",
+		Up:      createExtractorFixtures,
+		Down:    dropExtractorFixtures,
+	},
+	{
+		Version: 9,
+		Name:    "extracted_values",
+		Up:      createExtractedValues,
+		Down:    dropExtractedValues,
+	},
+	{
+		Version: 10,
+		Name:    "extraction_pipelines",
+		Up:      createExtractionPipelines,
+		Down:    dropExtractionPipelines,
+	},
+	{
+		Version: 11,
+		Name:    "trigger_email_cursor",
+		Up:      addTriggerCursor,
+		Down:    dropTriggerCursor,
+	},
+	{
+		Version: 12,
+		Name:    "trigger_ledger",
+		Up:      createTriggerLedger,
+		Down:    dropTriggerLedger,
+	},
+	{
+		Version: 13,
+		Name:    "trigger_account_scope",
+		Up:      addTriggerAccountScope,
+		Down:    dropTriggerAccountScope,
+	},
+	{
+		Version: 14,
+		Name:    "trigger_ledger_lease",
+		Up:      addTriggerLedgerLease,
+		Down:    dropTriggerLedgerLease,
+	},
+	{
+		Version: 15,
+		Name:    "account_tags",
+		Up:      addAccountTags,
+		Down:    dropAccountTags,
+	},
+	{
+		// 触发器的 custom_filters 和 condition 按 JSON 读写（随配置包导入引入），修正不是 JSON 的旧行
+		Version: 16,
+		Name:    "trigger_json_columns",
+		Up:      normalizeTriggerJSON,
+		Down:    func(tx *gorm.DB) error { return nil },
+	},
+}
+
+// upgradeLegacySchema brings a database created before versioned migrations,
+// which relied on AutoMigrate plus fixups at every startup, to the baseline
+func upgradeLegacySchema(db *gorm.DB) error {
+	seedState := needsLocalStateSeed(db)
+	backfillAddresses := needsAddressBackfill(db)
+
+	// OAuth2GlobalConfig 的旧表结构需要单独处理
+	if err := migrateBaselineTables(db); err != nil {
+		return err
+	}
+
+	// 旧数据的本地已读/星标状态由 IMAP 标记初始化
+	if seedState {
+		if err := seedLocalState(db); err != nil {
+			return err
+		}
+	}
+
+	// 旧邮件的地址写入规范化地址表
+	if backfillAddresses {
+		if err := backfillEmailAddresses(db); err != nil {
+			return err
+		}
+	}
+
+	// 全文索引（依赖具体数据库方言）
+	if err := migrateSearchIndex(db); err != nil {
+		return fmt.Errorf("failed to migrate search index: %w", err)
+	}
+
+	// 单独处理OAuth2GlobalConfig的迁移
+	if err := migrateOAuth2GlobalConfig(db); err != nil {
+		return fmt.Errorf("failed to migrate OAuth2GlobalConfig: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrIrreversible is returned by the Down step of migrations that cannot be rolled back
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// MigrationStep changes the schema in one direction
+type MigrationStep func(tx *gorm.DB) error
+
+// Migration is a numbered, reversible schema change. Versions are never
+// reused or renumbered once released; a change to the models needs a new
+// migration so that existing databases follow.
+type Migration struct {
+	Version int
+	Name    string
+	Up      MigrationStep
+	Down    MigrationStep
+}
+
+// SQLStep runs the statements registered for the current dialect (sqlite,
+// mysql or postgres); statements under "" run on every dialect
+func SQLStep(statements map[string][]string) MigrationStep {
+	return func(tx *gorm.DB) error {
+		dialect := tx.Dialector.Name()
+		list, ok := statements[dialect]
+		if !ok {
+			list, ok = statements[""]
+		}
+		if !ok {
+			return fmt.Errorf("no statements for dialect %s", dialect)
+		}
+		for _, statement := range list {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName implements gorm's tabler interface
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// schemaMigrationLock is a single row table used as a cross-instance lock
+type schemaMigrationLock struct {
+	ID       int       `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string    `gorm:"type:varchar(255);not null"`
+	LockedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// MigrationStatus describes a known migration and whether it has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+const (
+	// 锁超过该时间未刷新视为持有者已崩溃，可以被接管
+	migrationLockStaleAfter = 5 * time.Minute
+	migrationLockRefresh    = time.Minute
+	migrationLockWait       = 10 * time.Minute
+)
+
+// Migrator applies and rolls back versioned migrations
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator for the registered migrations
+func NewMigrator(db *gorm.DB) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, migrations: sorted}
+}
+
+// Latest returns the highest known migration version
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the highest applied migration version, 0 for an unversioned database
+func (m *Migrator) Version() (int, error) {
+	if !m.db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	if err := m.db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Up applies all pending migrations and returns the applied ones.
+//
+// An empty database runs the whole chain starting with the baseline. A
+// database created by the AutoMigrate based startup of earlier releases is
+// first upgraded the old way to the baseline, recorded at version 1 and then
+// follows the same chain.
+func (m *Migrator) Up() ([]Migration, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	if len(applied) == 0 && m.db.Migrator().HasTable("emails") && len(m.migrations) > 0 {
+		baseline, err := m.adoptLegacySchema()
+		if err != nil {
+			return nil, err
+		}
+		applied[baseline.Version] = SchemaMigration{Version: baseline.Version, Name: baseline.Name}
+		done = append(done, baseline)
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		log.Printf("[Database] Applying migration %d_%s", migration.Version, migration.Name)
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, nil
+	}
+
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var records []SchemaMigration
+	if err := m.db.Order("version DESC").Limit(steps).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+
+	var done []Migration
+	for _, record := range records {
+		migration, ok := m.find(record.Version)
+		if !ok {
+			return done, fmt.Errorf("applied migration %d_%s is unknown to this release", record.Version, record.Name)
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+
+		log.Printf("[Database] Rolling back migration %d_%s", migration.Version, migration.Name)
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, record.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback of migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Status lists all known migrations, and applied migrations unknown to this
+// release, in version order
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.ensureTables(); err != nil {
+		return nil, err
+	}
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &record.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, MigrationStatus{Version: record.Version, Name: record.Name, Applied: true, AppliedAt: &appliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// adoptLegacySchema upgrades an unversioned database to the baseline and records it
+func (m *Migrator) adoptLegacySchema() (Migration, error) {
+	baseline := m.migrations[0]
+	log.Printf("[Database] Adopting existing schema at version %d", baseline.Version)
+	if err := upgradeLegacySchema(m.db); err != nil {
+		return baseline, fmt.Errorf("failed to upgrade existing schema: %w", err)
+	}
+	if err := m.db.Create(&SchemaMigration{Version: baseline.Version, Name: baseline.Name, AppliedAt: time.Now()}).Error; err != nil {
+		return baseline, fmt.Errorf("failed to record migration %d: %w", baseline.Version, err)
+	}
+	return baseline, nil
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+func (m *Migrator) appliedVersions() (map[int]SchemaMigration, error) {
+	var records []SchemaMigration
+	if err := m.db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// ensureTables creates the bookkeeping tables, tolerating another instance creating them concurrently
+func (m *Migrator) ensureTables() error {
+	for _, table := range []interface{}{&SchemaMigration{}, &schemaMigrationLock{}} {
+		if m.db.Migrator().HasTable(table) {
+			continue
+		}
+		if err := m.db.Migrator().CreateTable(table); err != nil && !m.db.Migrator().HasTable(table) {
+			return fmt.Errorf("failed to create migration table: %w", err)
+		}
+	}
+	return nil
+}
+
+// lock takes the migration lock, waiting for other instances to finish. A lock
+// that has not been refreshed for migrationLockStaleAfter is taken over.
+func (m *Migrator) lock() (func(), error) {
+	if err := m.ensureTables(); err != nil {
+		return nil, err
+	}
+
+	owner := lockOwner()
+	deadline := time.Now().Add(migrationLockWait)
+	for {
+		err := m.db.Create(&schemaMigrationLock{ID: 1, Owner: owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			break
+		}
+
+		var held schemaMigrationLock
+		if m.db.First(&held, 1).Error == nil {
+			if time.Since(held.LockedAt) > migrationLockStaleAfter {
+				log.Printf("[Database] Taking over stale migration lock of %s", held.Owner)
+				m.db.Where("id = 1 AND owner = ?", held.Owner).Delete(&schemaMigrationLock{})
+				continue
+			}
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("migration lock is held by %s since %s", held.Owner, held.LockedAt.Format(time.RFC3339))
+			}
+			log.Printf("[Database] Waiting for migrations of %s", held.Owner)
+		} else if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	// 迁移期间定期刷新锁，避免长时间的迁移被其他实例当作失效锁接管
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(migrationLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.db.Model(&schemaMigrationLock{}).Where("id = 1 AND owner = ?", owner).Update("locked_at", time.Now())
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+		if err := m.db.Where("id = 1 AND owner = ?", owner).Delete(&schemaMigrationLock{}).Error; err != nil {
+			log.Printf("[Database] Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+// lockOwner identifies this process in the migration lock
+func lockOwner() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/secrets"
+
+	"gorm.io/gorm"
+)
+
+// openMigrationTestDB prepares a database the way Initialize does
+func openMigrationTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTestDB(t)
+	if err := db.SetupJoinTable(&models.Email{}, "Tags", &models.EmailTag{}); err != nil {
+		t.Fatalf("failed to set up email tags join table: %v", err)
+	}
+
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyring, err := secrets.ParseKeyring(key)
+	if err != nil {
+		t.Fatalf("failed to parse key: %v", err)
+	}
+
+	previousKeyring := secrets.Default()
+	secrets.SetDefault(keyring)
+	t.Cleanup(func() { secrets.SetDefault(previousKeyring) })
+	return db
+}
+
+// insertPlaintextAccount stores an account the way releases before encryption at rest did
+func insertPlaintextAccount(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	if err := db.Exec("INSERT INTO email_accounts (id, email_address, auth_type, password) VALUES (1, 'me@example.com', 'password', 'hunter2')").Error; err != nil {
+		t.Fatalf("failed to insert account: %v", err)
+	}
+}
+
+// assertLatest checks the recorded version, the columns of the latest
+// migrations, the encrypted account password and the released lock
+func assertLatest(t *testing.T, db *gorm.DB, migrator *Migrator) {
+	t.Helper()
+	version, err := migrator.Version()
+	if err != nil {
+		t.Fatalf("failed to read version: %v", err)
+	}
+	if version != migrator.Latest() {
+		t.Fatalf("expected version %d, got %d", migrator.Latest(), version)
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("failed to read status: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Fatalf("migration %d_%s is not recorded", status.Version, status.Name)
+		}
+	}
+
+	columns := []struct{ table, column string }{
+		{"attachments", "text_status"},
+		{"email_triggers", "last_email_id"},
+		{"email_triggers", "account_ids"},
+		{"email_triggers", "account_tags"},
+		{"trigger_ledger_entries", "lease_expires_at"},
+		{"email_accounts", "tags"},
+	}
+	for _, c := range columns {
+		if !db.Migrator().HasColumn(c.table, c.column) {
+			t.Fatalf("expected column %s.%s", c.table, c.column)
+		}
+	}
+	for _, table := range []string{"contacts", "extractor_template_revisions", "extracted_values", "extraction_pipelines"} {
+		if !db.Migrator().HasTable(table) {
+			t.Fatalf("expected table %s", table)
+		}
+	}
+
+	var password string
+	if err := db.Raw("SELECT password FROM email_accounts WHERE id = 1").Scan(&password).Error; err != nil {
+		t.Fatalf("failed to read account: %v", err)
+	}
+	if !secrets.IsEncrypted(password) {
+		t.Fatalf("expected the account password to be encrypted, got %q", password)
+	}
+
+	var locks int64
+	db.Model(&schemaMigrationLock{}).Count(&locks)
+	if locks != 0 {
+		t.Fatalf("expected the migration lock to be released, %d rows left", locks)
+	}
+}
+
+func TestMigratorEmptyDatabase(t *testing.T) {
+	db := openMigrationTestDB(t)
+	migrator := NewMigrator(db)
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected %d migrations to be recorded, got %d", len(migrations), len(applied))
+	}
+	insertPlaintextAccount(t, db)
+	if err := encryptSecrets(db); err != nil {
+		t.Fatalf("failed to encrypt secrets: %v", err)
+	}
+	assertLatest(t, db, migrator)
+
+	applied, err = migrator.Up()
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("expected nothing to apply on the second run, got %d, %v", len(applied), err)
+	}
+}
+
+func TestMigratorFullChainFromBaseline(t *testing.T) {
+	db := openMigrationTestDB(t)
+	migrator := NewMigrator(db)
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	// 回滚到基线，之后的每个迁移都要能在基线结构上执行
+	rolledBack, err := migrator.Down(migrator.Latest() - 1)
+	if err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if len(rolledBack) != len(migrations)-1 {
+		t.Fatalf("expected %d migrations to be rolled back, got %d", len(migrations)-1, len(rolledBack))
+	}
+	if version, _ := migrator.Version(); version != 1 {
+		t.Fatalf("expected version 1 after the rollback, got %d", version)
+	}
+	if db.Migrator().HasColumn("trigger_ledger_entries", "lease_expires_at") || db.Migrator().HasColumn("email_accounts", "tags") {
+		t.Fatal("expected the rollback to drop the columns of later migrations")
+	}
+	insertPlaintextAccount(t, db)
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("Up from the baseline failed: %v", err)
+	}
+	if len(applied) != len(migrations)-1 || applied[0].Version != 2 {
+		t.Fatalf("expected migrations 2 to %d to be applied, got %d", migrator.Latest(), len(applied))
+	}
+	assertLatest(t, db, migrator)
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	migrated := openMigrationTestDB(t)
+	if _, err := NewMigrator(migrated).Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	expected := openMigrationTestDB(t)
+	if err := expected.AutoMigrate(schemaModels...); err != nil {
+		t.Fatalf("failed to migrate models: %v", err)
+	}
+	if err := migrateSearchIndex(expected); err != nil {
+		t.Fatalf("failed to create search index: %v", err)
+	}
+
+	tables, err := expected.Migrator().GetTables()
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+	for _, table := range tables {
+		if !migrated.Migrator().HasTable(table) {
+			t.Errorf("table %s is missing after the migrations", table)
+			continue
+		}
+		want, got := columnTypes(t, expected, table), columnTypes(t, migrated, table)
+		for column, typ := range want {
+			if got[column] != typ {
+				t.Errorf("column %s.%s: migrations give %q, models give %q", table, column, got[column], typ)
+			}
+		}
+		for column := range got {
+			if _, ok := want[column]; !ok {
+				t.Errorf("column %s.%s is not in the models", table, column)
+			}
+		}
+		migratedIndexes := indexNames(t, migrated, table)
+		for index := range indexNames(t, expected, table) {
+			if !migratedIndexes[index] {
+				t.Errorf("index %s on %s is missing after the migrations", index, table)
+			}
+		}
+	}
+}
+
+// columnTypes maps the columns of a table to their database types
+func columnTypes(t *testing.T, db *gorm.DB, table string) map[string]string {
+	t.Helper()
+	columns, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		t.Fatalf("failed to read columns of %s: %v", table, err)
+	}
+	types := make(map[string]string, len(columns))
+	for _, column := range columns {
+		types[column.Name()] = strings.ToLower(column.DatabaseTypeName())
+	}
+	return types
+}
+
+// indexNames lists the named indexes of a sqlite table
+func indexNames(t *testing.T, db *gorm.DB, table string) map[string]bool {
+	t.Helper()
+	var indexes []string
+	err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).Scan(&indexes).Error
+	if err != nil {
+		t.Fatalf("failed to read indexes of %s: %v", table, err)
+	}
+	names := make(map[string]bool, len(indexes))
+	for _, index := range indexes {
+		names[index] = true
+	}
+	return names
+}
+
+func TestMigratorAdoptsLegacySchema(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	// 版本化迁移之前的发布版本在每次启动时用 AutoMigrate 建表，不记录版本。这里按基线结构
+	// 建表，并去掉更早版本还没有的本地状态列和规范化地址表
+	if err := db.SetupJoinTable(&emailV1{}, "Tags", &emailTagV1{}); err != nil {
+		t.Fatalf("failed to set up email tags join table: %v", err)
+	}
+	legacyModels := append([]interface{}{&oauth2GlobalConfigV1{}}, baselineModels...)
+	if err := db.AutoMigrate(legacyModels...); err != nil {
+		t.Fatalf("failed to create legacy tables: %v", err)
+	}
+	for _, column := range []string{"IsRead", "IsStarred"} {
+		if err := db.Migrator().DropColumn(&emailV1{}, column); err != nil {
+			t.Fatalf("failed to drop %s: %v", column, err)
+		}
+	}
+	if err := db.Migrator().DropTable(&emailAddressV1{}); err != nil {
+		t.Fatalf("failed to drop email_addresses: %v", err)
+	}
+	insertPlaintextAccount(t, db)
+	err := db.Exec(`INSERT INTO emails (id, account_id, subject, "from", "to", flags, date) VALUES (1, 1, 'Hello', ?, ?, ?, ?)`,
+		[]byte(`["Alice <alice@example.com>"]`), []byte(`["me@example.com"]`), []byte(`["\\Seen"]`), time.Now()).Error
+	if err != nil {
+		t.Fatalf("failed to insert email: %v", err)
+	}
+
+	migrator := NewMigrator(db)
+	if version, _ := migrator.Version(); version != 0 {
+		t.Fatalf("expected an unversioned database, got version %d", version)
+	}
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected %d migrations to be recorded, got %d", len(migrations), len(applied))
+	}
+	assertLatest(t, db, migrator)
+
+	var read bool
+	if err := db.Raw("SELECT is_read FROM emails WHERE id = 1").Scan(&read).Error; err != nil || !read {
+		t.Fatalf("expected the read state to be seeded from the flags, got %v, %v", read, err)
+	}
+	var addresses []string
+	if err := db.Raw("SELECT address FROM email_addresses WHERE email_id = 1 ORDER BY role").Scan(&addresses).Error; err != nil {
+		t.Fatalf("failed to read addresses: %v", err)
+	}
+	if strings.Join(addresses, ",") != "alice@example.com,me@example.com" {
+		t.Fatalf("expected the addresses to be backfilled, got %v", addresses)
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// migrateSearchIndex creates the dialect specific full-text structures on top of
+// the email_search_documents table:
+//   - SQLite:   an FTS5 virtual table (requires the sqlite_fts5 build tag)
+//   - Postgres: a generated tsvector column with a GIN index
+//   - MySQL:    a FULLTEXT index
+func migrateSearchIndex(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS email_search_fts USING fts5(
+			subject, addresses, content, attachment_names,
+			tokenize = 'unicode61 remove_diacritics 2'
+		)`).Error
+		if err != nil {
+			// FTS5 is a compile time option of the SQLite driver, fall back to LIKE matching
+			log.Printf("[Database] FTS5 is not available, full-text search falls back to LIKE matching: %v", err)
+		}
+		return nil
+
+	case "postgres":
+		if err := db.Exec(`ALTER TABLE email_search_documents ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', coalesce(subject, '')), 'A') ||
+				setweight(to_tsvector('simple', coalesce(addresses, '')), 'B') ||
+				setweight(to_tsvector('simple', coalesce(content, '')), 'C') ||
+				setweight(to_tsvector('simple', coalesce(attachment_names, '')), 'D')
+			) STORED`).Error; err != nil {
+			return fmt.Errorf("failed to add search_vector column: %w", err)
+		}
+		if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_email_search_vector ON email_search_documents USING GIN (search_vector)`).Error; err != nil {
+			return fmt.Errorf("failed to create search_vector index: %w", err)
+		}
+		return nil
+
+	case "mysql":
+		if db.Migrator().HasIndex("email_search_documents", "idx_email_search_fulltext") {
+			return nil
+		}
+		if err := db.Exec(`ALTER TABLE email_search_documents
+			ADD FULLTEXT INDEX idx_email_search_fulltext (subject, addresses, content, attachment_names) WITH PARSER ngram`).Error; err != nil {
+			return fmt.Errorf("failed to create fulltext index: %w", err)
+		}
+		return nil
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"mailman/internal/secrets"
+
+	"gorm.io/gorm"
+)
+
+// secretColumn is a column encrypted at rest, see models/encrypted.go
+type secretColumn struct {
+	Table    string
+	Column   string
+	Settings bool // JSON settings column whose sensitive keys are encrypted individually
+}
+
+// secretColumns 与模型中 serializer:encrypted / encrypted_settings 的字段一一对应
+var secretColumns = []secretColumn{
+	{Table: "email_accounts", Column: "password"},
+	{Table: "email_accounts", Column: "token"},
+	{Table: "email_accounts", Column: "custom_settings", Settings: true},
+	{Table: "o_auth2_global_configs", Column: "client_secret"},
+	{Table: "open_ai_configs", Column: "api_key"},
+}
+
+// transformSecrets rewrites every stored secret with fn, which reports
+// whether the value changed. It returns the number of rewritten values.
+func transformSecrets(tx *gorm.DB, fn func(value string) (string, bool, error)) (int, error) {
+	total := 0
+	for _, column := range secretColumns {
+		if !tx.Migrator().HasTable(column.Table) {
+			continue
+		}
+
+		var rows []struct {
+			ID    uint
+			Value *string
+		}
+		quoted := tx.Statement.Quote(column.Column)
+		if err := tx.Table(column.Table).Select("id, " + quoted + " AS value").Find(&rows).Error; err != nil {
+			return total, fmt.Errorf("failed to read %s.%s: %w", column.Table, column.Column, err)
+		}
+
+		for _, row := range rows {
+			if row.Value == nil || *row.Value == "" {
+				continue
+			}
+			value, changed, err := transformValue(column, *row.Value, fn)
+			if err != nil {
+				return total, fmt.Errorf("%s.%s of row %d: %w", column.Table, column.Column, row.ID, err)
+			}
+			if !changed {
+				continue
+			}
+			if err := tx.Table(column.Table).Where("id = ?", row.ID).UpdateColumn(column.Column, value).Error; err != nil {
+				return total, fmt.Errorf("failed to update %s.%s of row %d: %w", column.Table, column.Column, row.ID, err)
+			}
+			total++
+		}
+	}
+	return total, nil
+}
+
+// transformValue applies fn to a column value, or to the sensitive keys of a settings column
+func transformValue(column secretColumn, value string, fn func(string) (string, bool, error)) (string, bool, error) {
+	if !column.Settings {
+		return fn(value)
+	}
+
+	var settings map[string]string
+	if err := json.Unmarshal([]byte(value), &settings); err != nil {
+		// 无法解析的设置原样保留，读取时同样会失败，不在这里中断迁移
+		return value, false, nil
+	}
+	changed := false
+	for key, setting := range settings {
+		if !secrets.SensitiveSettingKeys[key] || setting == "" {
+			continue
+		}
+		transformed, settingChanged, err := fn(setting)
+		if err != nil {
+			return "", false, fmt.Errorf("key %s: %w", key, err)
+		}
+		if settingChanged {
+			settings[key] = transformed
+			changed = true
+		}
+	}
+	if !changed {
+		return value, false, nil
+	}
+	data, err := json.Marshal(settings)
+	return string(data), err == nil, err
+}
+
+// encryptSecrets encrypts plaintext secrets written before encryption at rest
+func encryptSecrets(tx *gorm.DB) error {
+	keyring := secrets.Default()
+	if keyring == nil {
+		return secrets.ErrNotConfigured
+	}
+	_, err := transformSecrets(tx, func(value string) (string, bool, error) {
+		if secrets.IsEncrypted(value) {
+			return value, false, nil
+		}
+		encrypted, err := keyring.Encrypt(value)
+		return encrypted, err == nil, err
+	})
+	return err
+}
+
+// decryptSecrets reverts encryptSecrets
+func decryptSecrets(tx *gorm.DB) error {
+	keyring := secrets.Default()
+	if keyring == nil {
+		return secrets.ErrNotConfigured
+	}
+	_, err := transformSecrets(tx, func(value string) (string, bool, error) {
+		if !secrets.IsEncrypted(value) {
+			return value, false, nil
+		}
+		plaintext, err := keyring.Decrypt(value)
+		return plaintext, err == nil, err
+	})
+	return err
+}
+
+// RotateSecrets re-wraps every stored secret with the active master key of
+// the default keyring, encrypting leftover plaintext values. Afterwards older
+// master keys can be removed from the configuration.
+func RotateSecrets() (int, error) {
+	keyring := secrets.Default()
+	if keyring == nil {
+		return 0, secrets.ErrNotConfigured
+	}
+
+	var rotated int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rotated, err = transformSecrets(tx, keyring.Rewrap)
+		return err
+	})
+	return rotated, err
+}
+
+// SecretKeyUsage counts the stored secrets per master key id; plaintext values are counted under ""
+func SecretKeyUsage() (map[string]int, error) {
+	usage := make(map[string]int)
+	_, err := transformSecrets(DB, func(value string) (string, bool, error) {
+		usage[secrets.KeyID(value)]++
+		return value, false, nil
+	})
+	return usage, err
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// 迁移 13 为触发器增加的账户范围
+type emailTriggerV13 struct {
+	AccountIDs []byte `gorm:"type:json"`
+}
+
+func (emailTriggerV13) TableName() string { return "email_triggers" }
+
+// addTriggerAccountScope adds the account scope of triggers. Existing
+// triggers keep evaluating the emails of every account.
+func addTriggerAccountScope(tx *gorm.DB) error {
+	return tx.Migrator().AddColumn(&emailTriggerV13{}, "AccountIDs")
+}
+
+// dropTriggerAccountScope removes the account scope of triggers
+func dropTriggerAccountScope(tx *gorm.DB) error {
+	return tx.Migrator().DropColumn(&emailTriggerV13{}, "AccountIDs")
+}
+
+// 迁移 15 增加的账户标签和触发器的标签范围
+type emailAccountV15 struct {
+	Tags []byte `gorm:"type:json"`
+}
+
+func (emailAccountV15) TableName() string { return "email_accounts" }
+
+type emailTriggerV15 struct {
+	AccountTags []byte `gorm:"type:json"`
+}
+
+func (emailTriggerV15) TableName() string { return "email_triggers" }
+
+// addAccountTags adds account tags and lets triggers scope to accounts by tag
+func addAccountTags(tx *gorm.DB) error {
+	if err := tx.Migrator().AddColumn(&emailAccountV15{}, "Tags"); err != nil {
+		return err
+	}
+	return tx.Migrator().AddColumn(&emailTriggerV15{}, "AccountTags")
+}
+
+// dropAccountTags removes account tags and the tag scope of triggers
+func dropAccountTags(tx *gorm.DB) error {
+	if err := tx.Migrator().DropColumn(&emailTriggerV15{}, "AccountTags"); err != nil {
+		return err
+	}
+	return tx.Migrator().DropColumn(&emailAccountV15{}, "Tags")
+}
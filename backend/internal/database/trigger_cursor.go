@@ -0,0 +1,33 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// 迁移 11 为触发器增加的邮件进度
+type emailTriggerV11 struct {
+	LastEmailID uint `gorm:"not null;default:0"`
+}
+
+func (emailTriggerV11) TableName() string { return "email_triggers" }
+
+// addTriggerCursor adds the email cursor of triggers. Existing triggers start
+// after the newest stored email, as they have already polled the mail before.
+func addTriggerCursor(tx *gorm.DB) error {
+	if err := tx.Migrator().AddColumn(&emailTriggerV11{}, "LastEmailID"); err != nil {
+		return err
+	}
+	var maxID *uint
+	if err := tx.Table("emails").Select("MAX(id)").Scan(&maxID).Error; err != nil {
+		return err
+	}
+	if maxID == nil {
+		return nil
+	}
+	return tx.Table("email_triggers").Where("1 = 1").UpdateColumn("last_email_id", *maxID).Error
+}
+
+// dropTriggerCursor removes the email cursor of triggers
+func dropTriggerCursor(tx *gorm.DB) error {
+	return tx.Migrator().DropColumn(&emailTriggerV11{}, "LastEmailID")
+}
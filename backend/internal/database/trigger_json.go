@@ -0,0 +1,67 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 16 检查的触发器列。custom_filters 和 condition 按 JSON 序列化读写，
+// 早于此的版本没有可用的写入路径，但手工或外部工具写入的行可能不是 JSON，
+// 这样的行会让触发器列表整体读取失败
+type emailTriggerJSONRow struct {
+	ID            uint
+	Name          string
+	Status        string
+	CustomFilters *string
+	Condition     *string
+}
+
+// emptyTriggerCondition 无法解析的条件替换为空条件，评估时报错，不会执行动作
+const emptyTriggerCondition = `{"type":"","script":""}`
+
+// normalizeTriggerJSON rewrites custom_filters and condition values of
+// triggers that are not JSON objects. Unreadable custom filters are cleared;
+// a trigger whose condition cannot be read is disabled with the reason in
+// last_error, so that no action runs on a guessed condition.
+func normalizeTriggerJSON(tx *gorm.DB) error {
+	if !tx.Migrator().HasTable("email_triggers") {
+		return nil
+	}
+	var rows []emailTriggerJSONRow
+	if err := tx.Table("email_triggers").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		updates := make(map[string]interface{})
+		if row.CustomFilters != nil && !isJSONObject(*row.CustomFilters, true) {
+			log.Printf("[Database] Clearing unreadable custom filters of trigger %d (%s): %q", row.ID, row.Name, *row.CustomFilters)
+			updates["custom_filters"] = nil
+		}
+		if row.Condition == nil || !isJSONObject(*row.Condition, false) {
+			log.Printf("[Database] Disabling trigger %d (%s), its condition is not readable", row.ID, row.Name)
+			updates["condition"] = emptyTriggerCondition
+			updates["status"] = "disabled"
+			updates["last_error"] = "condition could not be read after upgrade, please edit the trigger"
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := tx.Table("email_triggers").Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isJSONObject reports whether a stored value decodes as a JSON object; the
+// empty string and null are accepted where the column is optional
+func isJSONObject(value string, optional bool) bool {
+	if value == "" || value == "null" {
+		return optional
+	}
+	var object map[string]interface{}
+	return json.Unmarshal([]byte(value), &object) == nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"mailman/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "mailman.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	return db
+}
+
+func TestNormalizeTriggerJSON(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&models.EmailTrigger{}); err != nil {
+		t.Fatalf("failed to create triggers table: %v", err)
+	}
+
+	// 旧格式：Go 的 fmt 输出而不是 JSON，以及缺少自定义过滤器的正常行
+	rows := []string{
+		`INSERT INTO email_triggers (id, name, status, check_interval, custom_filters, "condition", actions) VALUES (1, 'legacy', 'enabled', 30, 'map[larger:1M]', '{js return true}', '[]')`,
+		`INSERT INTO email_triggers (id, name, status, check_interval, custom_filters, "condition", actions) VALUES (2, 'current', 'enabled', 30, '{"larger":"1M"}', '{"type":"js","script":"return true"}', '[]')`,
+		`INSERT INTO email_triggers (id, name, status, check_interval, custom_filters, "condition", actions) VALUES (3, 'no filters', 'enabled', 30, NULL, '{"type":"gotemplate","script":"true"}', '[]')`,
+	}
+	for _, row := range rows {
+		if err := db.Exec(row).Error; err != nil {
+			t.Fatalf("failed to insert row: %v", err)
+		}
+	}
+
+	if err := normalizeTriggerJSON(db); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+
+	var triggers []models.EmailTrigger
+	if err := db.Order("id").Find(&triggers).Error; err != nil {
+		t.Fatalf("triggers are not readable after the migration: %v", err)
+	}
+	if len(triggers) != 3 {
+		t.Fatalf("expected 3 triggers, got %d", len(triggers))
+	}
+
+	legacy := triggers[0]
+	if legacy.Status != models.TriggerStatusDisabled || legacy.CustomFilters != nil || legacy.Condition.Type != "" || legacy.LastError == "" {
+		t.Fatalf("expected the legacy trigger to be disabled and cleared, got %+v", legacy)
+	}
+	current := triggers[1]
+	if current.Status != models.TriggerStatusEnabled || current.CustomFilters["larger"] != "1M" || current.Condition.Script != "return true" {
+		t.Fatalf("expected the current trigger to be unchanged, got %+v", current)
+	}
+	if triggers[2].Status != models.TriggerStatusEnabled || triggers[2].Condition.Type != "gotemplate" {
+		t.Fatalf("expected the trigger without filters to be unchanged, got %+v", triggers[2])
+	}
+
+	// 再次执行不改变任何行
+	if err := normalizeTriggerJSON(db); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移 12 为触发器增加的修订号
+type emailTriggerV12 struct {
+	Revision int `gorm:"not null;default:1"`
+}
+
+func (emailTriggerV12) TableName() string { return "email_triggers" }
+
+// 迁移 12 创建的处理台账
+type triggerLedgerEntryV12 struct {
+	ID               uint   `gorm:"primaryKey"`
+	TriggerID        uint   `gorm:"not null;uniqueIndex:idx_trigger_ledger_key,priority:1"`
+	EmailID          uint   `gorm:"not null;uniqueIndex:idx_trigger_ledger_key,priority:2;index"`
+	Revision         int    `gorm:"not null;uniqueIndex:idx_trigger_ledger_key,priority:3"`
+	State            string `gorm:"type:varchar(16);not null"`
+	Outcome          string `gorm:"type:varchar(16)"`
+	ConditionResult  bool
+	CompletedActions []byte `gorm:"type:json"`
+	Attempts         int    `gorm:"not null;default:1"`
+	Error            string `gorm:"type:text"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (triggerLedgerEntryV12) TableName() string { return "trigger_ledger_entries" }
+
+// createTriggerLedger adds trigger revisions and the ledger of processed emails
+func createTriggerLedger(tx *gorm.DB) error {
+	if err := tx.Migrator().AddColumn(&emailTriggerV12{}, "Revision"); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(&triggerLedgerEntryV12{})
+}
+
+// dropTriggerLedger removes the ledger and trigger revisions
+func dropTriggerLedger(tx *gorm.DB) error {
+	if err := tx.Migrator().DropTable(&triggerLedgerEntryV12{}); err != nil {
+		return err
+	}
+	return tx.Migrator().DropColumn(&emailTriggerV12{}, "Revision")
+}
+
+// 迁移 14 为处理台账增加的租约
+type triggerLedgerEntryV14 struct {
+	LeaseOwner     string `gorm:"type:varchar(64)"`
+	LeaseExpiresAt *time.Time
+}
+
+func (triggerLedgerEntryV14) TableName() string { return "trigger_ledger_entries" }
+
+// addTriggerLedgerLease adds the lease with which a worker claims a ledger
+// entry. Existing running entries have no lease and can be claimed at once.
+func addTriggerLedgerLease(tx *gorm.DB) error {
+	for _, field := range []string{"LeaseOwner", "LeaseExpiresAt"} {
+		if err := tx.Migrator().AddColumn(&triggerLedgerEntryV14{}, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropTriggerLedgerLease removes the lease of ledger entries
+func dropTriggerLedgerLease(tx *gorm.DB) error {
+	for _, field := range []string{"LeaseExpiresAt", "LeaseOwner"} {
+		if err := tx.Migrator().DropColumn(&triggerLedgerEntryV14{}, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -46,6 +46,12 @@ const (
 	ActivityTriggerDisabled ActivityType = "trigger_disabled"
 	ActivityTriggerExecuted ActivityType = "trigger_executed"
 
+	// 数据保留相关活动
+	ActivityRetentionPurged ActivityType = "retention_purged"
+
+	// 提取模板相关活动
+	ActivityExtractorSuiteFailed ActivityType = "extractor_suite_failed"
+
 	// 通用活动类型
 	ActivityTypeGeneral ActivityType = "general"
 )
@@ -109,7 +115,7 @@ func GetActivityTypeInfo(activityType ActivityType) (icon string, color string)
 		return "user-plus", "purple"
 	case ActivityAccountSynced, ActivitySyncCompleted:
 		return "check-circle", "green"
-	case ActivitySyncFailed:
+	case ActivitySyncFailed, ActivityExtractorSuiteFailed:
 		return "x-circle", "red"
 	case ActivitySubscribed:
 		return "bell", "blue"
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// ContactRoles 参与联系人统计的地址角色
+var ContactRoles = []AddressRole{AddressRoleFrom, AddressRoleTo, AddressRoleCc}
+
+// Contact 通讯录中的联系人，由邮件往来中出现过的地址汇总而来，也可以从 vCard 导入。
+// 统计数据由 email_addresses 表计算；合并后一个联系人可以有多个地址
+type Contact struct {
+	ID           uint        `gorm:"primaryKey" json:"id"`
+	Address      string      `gorm:"type:varchar(320);uniqueIndex;not null" json:"address"` // 主地址
+	Name         string      `gorm:"type:varchar(255);index" json:"name"`
+	CustomName   bool        `gorm:"default:false" json:"custom_name"` // 名称由用户或 vCard 指定，不再随邮件中的显示名变化
+	DisplayNames StringSlice `gorm:"type:json" json:"display_names"`   // 邮件中出现过的显示名，按使用次数排序
+	Organization string      `gorm:"type:varchar(255)" json:"organization,omitempty"`
+	Phones       StringSlice `gorm:"type:json" json:"phones,omitempty"`
+	Notes        string      `gorm:"type:text" json:"notes,omitempty"`
+
+	FromCount    int64      `gorm:"default:0" json:"from_count"`          // 该联系人发出的邮件数
+	ToCount      int64      `gorm:"default:0" json:"to_count"`            // 收件人或抄送中包含该联系人的邮件数
+	MessageCount int64      `gorm:"default:0;index" json:"message_count"` // 涉及该联系人的邮件总数
+	FirstSeenAt  *time.Time `json:"first_seen_at,omitempty"`
+	LastSeenAt   *time.Time `gorm:"index" json:"last_seen_at,omitempty"`
+
+	Addresses []ContactAddress `gorm:"constraint:OnDelete:CASCADE;" json:"addresses,omitempty"`
+	Accounts  []ContactAccount `gorm:"constraint:OnDelete:CASCADE;" json:"accounts,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ContactAddress 联系人的一个地址，每个地址只属于一个联系人
+type ContactAddress struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ContactID uint   `gorm:"not null;index" json:"contact_id"`
+	Address   string `gorm:"type:varchar(320);uniqueIndex;not null" json:"address"`
+}
+
+// ContactAccount 联系人在某个邮箱账户中的往来统计
+type ContactAccount struct {
+	ContactID   uint       `gorm:"primaryKey" json:"contact_id"`
+	AccountID   uint       `gorm:"primaryKey;index" json:"account_id"`
+	FromCount   int64      `json:"from_count"`
+	ToCount     int64      `json:"to_count"`
+	FirstSeenAt *time.Time `json:"first_seen_at,omitempty"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// AddressRole 地址在邮件中的角色
+type AddressRole string
+
+const (
+	AddressRoleFrom    AddressRole = "from"
+	AddressRoleTo      AddressRole = "to"
+	AddressRoleCc      AddressRole = "cc"
+	AddressRoleBcc     AddressRole = "bcc"
+	AddressRoleReplyTo AddressRole = "reply-to"
+)
+
+// EmailAddress 规范化后的邮件地址，每封邮件的每个地址一行，用于跨数据库的带索引地址搜索
+type EmailAddress struct {
+	ID        uint        `gorm:"primaryKey" json:"id"`
+	EmailID   uint        `gorm:"not null;index" json:"email_id"`
+	Role      AddressRole `gorm:"type:varchar(16);not null;index:idx_email_addresses_role_address,priority:1" json:"role"`
+	Position  int         `json:"position"` // 在该角色地址列表中的顺序
+	Name      string      `gorm:"type:varchar(255)" json:"name,omitempty"`
+	LocalPart string      `gorm:"type:varchar(255)" json:"local_part"`
+	Domain    string      `gorm:"type:varchar(255);index" json:"domain"`
+	Address   string      `gorm:"type:varchar(320);index;index:idx_email_addresses_role_address,priority:2" json:"address"` // 小写的完整地址
+}
+
+// AddressRecords 将邮件的 From/To/Cc/Bcc/Reply-To 展开为规范化地址行
+func (e *Email) AddressRecords() []EmailAddress {
+	var records []EmailAddress
+	for _, list := range []struct {
+		role      AddressRole
+		addresses StringSlice
+	}{
+		{AddressRoleFrom, e.From},
+		{AddressRoleTo, e.To},
+		{AddressRoleCc, e.Cc},
+		{AddressRoleBcc, e.Bcc},
+		{AddressRoleReplyTo, e.ReplyTo},
+	} {
+		for i, address := range ParseAddressList(list.addresses) {
+			address.EmailID = e.ID
+			address.Role = list.role
+			address.Position = i
+			records = append(records, address)
+		}
+	}
+	return records
+}
+
+// ParseAddressList 解析存储的地址列表。每一项可能是 "Name <a@b.com>"、裸地址，
+// 也可能是未拆分的整个头部（如 Gmail API 返回的 "a@b.com, c@d.com"）
+func ParseAddressList(values []string) []EmailAddress {
+	var addresses []EmailAddress
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if list, err := mail.ParseAddressList(value); err == nil {
+			for _, parsed := range list {
+				addresses = append(addresses, NewEmailAddress(parsed.Name, parsed.Address))
+			}
+			continue
+		}
+		// 不符合 RFC 5322 的地址按 "Name <addr>" 宽松解析
+		addresses = append(addresses, ParseAddress(value))
+	}
+	return addresses
+}
+
+// ParseAddress 宽松解析单个地址
+func ParseAddress(value string) EmailAddress {
+	value = strings.TrimSpace(value)
+	if parsed, err := mail.ParseAddress(value); err == nil {
+		return NewEmailAddress(parsed.Name, parsed.Address)
+	}
+	if start := strings.LastIndex(value, "<"); start != -1 {
+		if end := strings.LastIndex(value, ">"); end > start {
+			name := strings.Trim(strings.TrimSpace(value[:start]), `"'`)
+			return NewEmailAddress(name, value[start+1:end])
+		}
+	}
+	return NewEmailAddress("", value)
+}
+
+// NewEmailAddress 由显示名和地址构造规范化地址
+func NewEmailAddress(name, address string) EmailAddress {
+	address = strings.ToLower(strings.TrimSpace(address))
+	record := EmailAddress{
+		Name:      strings.TrimSpace(name),
+		Address:   address,
+		LocalPart: address,
+	}
+	if at := strings.LastIndex(address, "@"); at != -1 {
+		record.LocalPart = address[:at]
+		record.Domain = address[at+1:]
+	}
+	return record
+}
+
+// AddressPatternKind 地址搜索值的匹配方式
+type AddressPatternKind int
+
+const (
+	AddressPatternSubstring AddressPatternKind = iota // 地址或显示名包含该值
+	AddressPatternExact                               // 完整地址，精确匹配
+	AddressPatternDomain                              // "@example.com"，匹配域名
+)
+
+// ClassifyAddressPattern 判断地址搜索值的匹配方式，返回小写后的值。
+// 完整地址和 "@域名" 可以走索引，其余按子串匹配
+func ClassifyAddressPattern(value string) (AddressPatternKind, string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if strings.HasPrefix(value, "@") && len(value) > 1 && !strings.Contains(value[1:], "@") {
+		return AddressPatternDomain, value[1:]
+	}
+	if parsed, err := mail.ParseAddress(value); err == nil && parsed.Name == "" && parsed.Address == value {
+		return AddressPatternExact, value
+	}
+	if start := strings.Index(value, "<"); start != -1 {
+		if end := strings.Index(value, ">"); end > start && strings.Contains(value[start:end], "@") {
+			return AddressPatternExact, strings.TrimSpace(value[start+1 : end])
+		}
+	}
+	return AddressPatternSubstring, value
+}
+
+// Matches 判断地址是否匹配搜索值，与数据库中的地址搜索条件语义一致
+func (a EmailAddress) Matches(value string) bool {
+	kind, pattern := ClassifyAddressPattern(value)
+	switch kind {
+	case AddressPatternExact:
+		return a.Address == pattern
+	case AddressPatternDomain:
+		return a.Domain == pattern
+	}
+	return strings.Contains(a.Address, pattern) || strings.Contains(strings.ToLower(a.Name), pattern)
+}
+
+// AddressesMatch 判断地址列表中是否有地址匹配搜索值
+func AddressesMatch(values []string, pattern string) bool {
+	for _, address := range ParseAddressList(values) {
+		if address.Matches(pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"mailman/internal/secrets"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+	schema.RegisterSerializer("encrypted_settings", EncryptedSettingsSerializer{})
+}
+
+// EncryptedSerializer 加密存储字符串字段（gorm:"serializer:encrypted"），密钥见 secrets 包。
+// 读取时兼容尚未加密的旧数据
+type EncryptedSerializer struct{}
+
+// Scan implements the gorm serializer interface
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	value, err := decryptColumn(dbValue)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field.DBName, err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(value)
+	return nil
+}
+
+// Value implements the gorm serializer interface
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	if value == "" {
+		return "", nil
+	}
+	keyring := secrets.Default()
+	if keyring == nil {
+		return nil, secrets.ErrNotConfigured
+	}
+	return keyring.Encrypt(value)
+}
+
+// EncryptedSettingsSerializer 以 JSON 存储 JSONMap，其中的令牌等敏感项单独加密，列仍是合法的 JSON
+type EncryptedSettingsSerializer struct{}
+
+// Scan implements the gorm serializer interface
+func (EncryptedSettingsSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	settings := JSONMap{}
+	var data []byte
+	switch v := dbValue.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("%s: %w", field.DBName, err)
+		}
+	}
+
+	for key, value := range settings {
+		if !secrets.IsEncrypted(value) {
+			continue
+		}
+		plaintext, err := decryptColumn(value)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", field.DBName, key, err)
+		}
+		settings[key] = plaintext
+	}
+	field.ReflectValueOf(ctx, dst).Set(reflect.ValueOf(settings))
+	return nil
+}
+
+// Value implements the gorm serializer interface
+func (EncryptedSettingsSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	settings, _ := fieldValue.(JSONMap)
+	stored := make(map[string]string, len(settings))
+	for key, value := range settings {
+		if secrets.SensitiveSettingKeys[key] && value != "" {
+			keyring := secrets.Default()
+			if keyring == nil {
+				return nil, secrets.ErrNotConfigured
+			}
+			encrypted, err := keyring.Encrypt(value)
+			if err != nil {
+				return nil, err
+			}
+			value = encrypted
+		}
+		stored[key] = value
+	}
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
+
+// decryptColumn decrypts a stored column value
+func decryptColumn(dbValue interface{}) (string, error) {
+	var value string
+	switch v := dbValue.(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported column type %T", dbValue)
+	}
+	if !secrets.IsEncrypted(value) {
+		return value, nil
+	}
+
+	keyring := secrets.Default()
+	if keyring == nil {
+		return "", secrets.ErrNotConfigured
+	}
+	return keyring.Decrypt(value)
+}
+
+// MarshalJSON 在 API 响应中隐藏密码、令牌等凭据
+func (a EmailAccount) MarshalJSON() ([]byte, error) {
+	type account EmailAccount
+	redacted := account(a)
+	redacted.Password = secrets.Redact(a.Password)
+	redacted.Token = secrets.Redact(a.Token)
+	redacted.CustomSettings = secrets.RedactSettings(a.CustomSettings)
+	return json.Marshal(redacted)
+}
+
+// MarshalJSON 在 API 响应中隐藏 client secret
+func (c OAuth2GlobalConfig) MarshalJSON() ([]byte, error) {
+	type config OAuth2GlobalConfig
+	redacted := config(c)
+	redacted.ClientSecret = secrets.Redact(c.ClientSecret)
+	return json.Marshal(redacted)
+}
+
+// MarshalJSON 在 API 响应中隐藏 API key
+func (c OpenAIConfig) MarshalJSON() ([]byte, error) {
+	type config OpenAIConfig
+	redacted := config(c)
+	redacted.APIKey = secrets.Redact(c.APIKey)
+	return json.Marshal(redacted)
+}
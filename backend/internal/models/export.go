@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// ExportFormat 邮件导出格式
+type ExportFormat string
+
+const (
+	ExportFormatMbox  ExportFormat = "mbox"  // mboxrd 格式的单个文件
+	ExportFormatEML   ExportFormat = "eml"   // 每封邮件一个 .eml 文件，打包为 zip
+	ExportFormatJSONL ExportFormat = "jsonl" // 每行一个 JSON 对象，包含提取的字段
+)
+
+// ExportJobStatus 导出任务状态
+type ExportJobStatus string
+
+const (
+	ExportJobPending   ExportJobStatus = "pending"
+	ExportJobRunning   ExportJobStatus = "running"
+	ExportJobCompleted ExportJobStatus = "completed"
+	ExportJobFailed    ExportJobStatus = "failed"
+)
+
+// ExportFilter 选择要导出的邮件
+type ExportFilter struct {
+	AccountID           uint       `json:"account_id,omitempty"`
+	MailboxName         string     `json:"mailbox_name,omitempty"`
+	Query               string     `json:"query,omitempty"`   // Gmail 风格的搜索语句
+	Keyword             string     `json:"keyword,omitempty"` // 全文搜索关键词
+	StartDate           *time.Time `json:"start_date,omitempty"`
+	EndDate             *time.Time `json:"end_date,omitempty"`
+	ExtractorTemplateID *uint      `json:"extractor_template_id,omitempty"` // JSONL 导出时附带该模板的提取结果
+}
+
+// Value implements the driver.Valuer interface
+func (f ExportFilter) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// Scan implements the sql.Scanner interface
+func (f *ExportFilter) Scan(value interface{}) error {
+	if value == nil {
+		*f = ExportFilter{}
+		return nil
+	}
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return nil
+	}
+	return json.Unmarshal(bytes, f)
+}
+
+// ExportJob 后台导出任务
+type ExportJob struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	Format      ExportFormat    `gorm:"not null;type:varchar(20)" json:"format"`
+	Filter      ExportFilter    `gorm:"type:json" json:"filter"`
+	Status      ExportJobStatus `gorm:"not null;type:varchar(20);index" json:"status"`
+	EmailCount  int64           `gorm:"default:0" json:"email_count"`
+	FilePath    string          `json:"-"`
+	FileName    string          `json:"file_name,omitempty"`
+	FileSize    int64           `gorm:"default:0" json:"file_size"`
+	Error       string          `gorm:"type:text" json:"error,omitempty"`
+	DownloadURL string          `gorm:"-" json:"download_url,omitempty"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time      `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
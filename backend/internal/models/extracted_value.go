@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ExtractedValue 提取结果：模板的一个命名输出在一封邮件上的值。
+// 同一模板再次处理同一封邮件时，替换该邮件上原有的全部值
+type ExtractedValue struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	EmailID    uint   `gorm:"not null;uniqueIndex:idx_extracted_values_email_template_field,priority:1" json:"email_id"`
+	TemplateID uint   `gorm:"not null;uniqueIndex:idx_extracted_values_email_template_field,priority:2;index:idx_extracted_values_template_field,priority:1" json:"template_id"`
+	Revision   int    `gorm:"not null;default:0" json:"revision"` // 产生该值的模板修订
+	Field      string `gorm:"type:varchar(255);not null;uniqueIndex:idx_extracted_values_email_template_field,priority:3;index:idx_extracted_values_template_field,priority:2" json:"field"`
+	Type       string `gorm:"type:varchar(16);not null" json:"type"` // 输出类型：string、number、date、url 或 list
+
+	// 值的字符串表示，list 类型为 JSON 数组；number 和 date 另存一列用于比较和聚合
+	Value  string     `gorm:"type:text" json:"value"`
+	Number *float64   `json:"number,omitempty"`
+	Date   *time.Time `json:"date,omitempty"`
+
+	ExtractedAt time.Time `gorm:"not null;index" json:"extracted_at"`
+}
+
+// Typed returns the value as produced by the extractor
+func (v *ExtractedValue) Typed() interface{} {
+	switch {
+	case v.Number != nil:
+		return *v.Number
+	case v.Date != nil:
+		return *v.Date
+	case v.Type == "list":
+		var items []string
+		if err := json.Unmarshal([]byte(v.Value), &items); err == nil {
+			return items
+		}
+	}
+	return v.Value
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// ExtractionPipeline 提取流水线：新入库的邮件落在作用范围内时自动运行提取模板，
+// 结果写入 extracted_values 并通过 WebSocket 和 webhook 推送。
+// 作用范围的各项之间为“与”，同一项的多个值之间为“或”，全部为空时匹配所有邮件
+type ExtractionPipeline struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"not null;uniqueIndex;type:varchar(255)" json:"name"`
+	Description string `json:"description,omitempty"`
+	TemplateID  uint   `gorm:"not null;index" json:"template_id"`
+	Enabled     bool   `gorm:"default:true" json:"enabled"`
+
+	// 作用范围
+	AccountIDs    []uint      `gorm:"type:json;serializer:json" json:"account_ids,omitempty"` // 账户
+	AliasPatterns StringSlice `gorm:"type:json" json:"alias_patterns,omitempty"`              // 收件地址，完整地址或 *@example.com，与触发器的别名相同
+	SenderDomains StringSlice `gorm:"type:json" json:"sender_domains,omitempty"`              // 发件人域名，与搜索语句的 from:@域名 相同
+	Mailboxes     StringSlice `gorm:"type:json" json:"mailboxes,omitempty"`                   // 邮箱文件夹
+	Query         string      `gorm:"type:text" json:"query,omitempty"`                       // Gmail风格搜索语句
+
+	// 结果推送，webhook 请求带 X-Mailman-Signature: sha256=<HMAC>（设置了密钥时）
+	WebhookURL    string `gorm:"type:varchar(1024)" json:"webhook_url,omitempty"`
+	WebhookSecret string `gorm:"serializer:encrypted" json:"webhook_secret,omitempty"`
+
+	// 处理进度：此前的邮件都已处理完，只处理 ID 更大的邮件，创建时从当时最新的邮件开始
+	LastEmailID    uint       `gorm:"not null;default:0" json:"last_email_id"`
+	ProcessedCount int64      `gorm:"not null;default:0" json:"processed_count"` // 落在范围内并运行了模板的邮件数
+	ExtractedCount int64      `gorm:"not null;default:0" json:"extracted_count"` // 其中提取到值的邮件数
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
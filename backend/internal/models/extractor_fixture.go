@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// Sources of extractor fixtures
+const (
+	ExtractorFixtureSourceEmail = "email" // 引用已存储的邮件
+	ExtractorFixtureSourceEML   = "eml"   // 上传的 .eml 文件
+)
+
+// Results of running an extractor fixture
+const (
+	ExtractorFixturePassed = "passed"
+	ExtractorFixtureFailed = "failed"
+	ExtractorFixtureError  = "error" // 邮件无法加载或提取器执行出错
+)
+
+// ExtractorFixtureOutput is the expected or actual output of a template for one email
+type ExtractorFixtureOutput struct {
+	Matches []string               `json:"matches"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+}
+
+// Scan implements the sql.Scanner interface
+func (o *ExtractorFixtureOutput) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (o ExtractorFixtureOutput) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+// ExtractorFixture 提取模板的回归测试用例：一封邮件及其期望的提取结果。
+// 模板更新前会运行全部用例，原本通过的用例失败时拒绝更新
+type ExtractorFixture struct {
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	TemplateID uint                   `gorm:"not null;index" json:"template_id"`
+	Name       string                 `gorm:"type:varchar(255);not null" json:"name"`
+	Source     string                 `gorm:"type:varchar(16);not null" json:"source"`
+	EmailID    *uint                  `gorm:"index" json:"email_id,omitempty"` // Source 为 email 时引用的邮件
+	RawMessage []byte                 `json:"-"`                               // Source 为 eml 时的原始报文
+	Expected   ExtractorFixtureOutput `gorm:"type:json" json:"expected"`
+
+	LastStatus   string     `gorm:"type:varchar(16)" json:"last_status,omitempty"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastBuiltins string     `gorm:"type:varchar(255)" json:"-"` // 上次运行时的内置提取器版本，升级后据此重新运行
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
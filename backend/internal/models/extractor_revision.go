@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// ExtractorTemplateRevision 提取模板每次保存时的不可变快照。模板的 Revision 字段
+// 指向当前生效的修订，提取和等待接口可以固定使用某个修订
+type ExtractorTemplateRevision struct {
+	ID          uint                     `gorm:"primaryKey" json:"id"`
+	TemplateID  uint                     `gorm:"not null;uniqueIndex:idx_extractor_revisions_template_revision" json:"template_id"`
+	Revision    int                      `gorm:"not null;uniqueIndex:idx_extractor_revisions_template_revision" json:"revision"`
+	Name        string                   `gorm:"type:varchar(255)" json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Extractors  ExtractorTemplateConfigs `gorm:"type:json;not null" json:"extractors"`
+	AuthorID    *uint                    `json:"author_id,omitempty"`
+	Author      string                   `gorm:"type:varchar(255)" json:"author,omitempty"`  // 保存时的用户名，用户删除后仍可见
+	Message     string                   `gorm:"type:varchar(255)" json:"message,omitempty"` // 例如 "restored from revision 3"
+	CreatedAt   time.Time                `json:"created_at"`
+}
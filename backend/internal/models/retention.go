@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// RetentionScope 保留策略作用范围
+type RetentionScope string
+
+const (
+	RetentionScopeGlobal  RetentionScope = "global"  // 所有账户
+	RetentionScopeAccount RetentionScope = "account" // 指定账户
+	RetentionScopeMailbox RetentionScope = "mailbox" // 指定邮箱文件夹（可限定账户）
+)
+
+// RetentionTarget 保留策略清理对象
+type RetentionTarget string
+
+const (
+	RetentionTargetEmails       RetentionTarget = "emails"                 // 邮件
+	RetentionTargetTriggerLogs  RetentionTarget = "trigger_execution_logs" // 触发器执行日志
+	RetentionTargetActivityLogs RetentionTarget = "activity_logs"          // 活动日志
+)
+
+// RetentionPolicy 数据保留策略
+// 对同一个邮箱文件夹，最具体的策略生效：mailbox > account > global。
+// 各规则为0表示不启用该规则。
+type RetentionPolicy struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	Name        string          `gorm:"not null;type:varchar(255)" json:"name"`
+	Description string          `json:"description,omitempty"`
+	Target      RetentionTarget `gorm:"not null;type:varchar(50);default:'emails'" json:"target"`
+	Scope       RetentionScope  `gorm:"not null;type:varchar(20);default:'global'" json:"scope"`
+	AccountID   *uint           `gorm:"index" json:"account_id,omitempty"`               // account/mailbox 范围使用
+	MailboxName string          `gorm:"type:varchar(255)" json:"mailbox_name,omitempty"` // mailbox 范围使用
+
+	DeleteAfterDays       int `gorm:"default:0" json:"delete_after_days"`        // 删除早于N天的数据
+	StripContentAfterDays int `gorm:"default:0" json:"strip_content_after_days"` // N天后删除原始报文和附件，保留元数据（仅邮件）
+	MaxMessages           int `gorm:"default:0" json:"max_messages"`             // 最多保留N条（邮件按文件夹计算）
+
+	Enabled    bool       `gorm:"default:true" json:"enabled"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastPurged int64      `gorm:"default:0" json:"last_purged"` // 上次执行清理的记录数
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
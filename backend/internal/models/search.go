@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// EmailSearchDocument holds the denormalized text of an email that the
+// full-text index is built from. There is exactly one document per email.
+type EmailSearchDocument struct {
+	EmailID         uint      `gorm:"primaryKey;autoIncrement:false" json:"email_id"`
+	AccountID       uint      `gorm:"index" json:"account_id"`
+	Subject         string    `gorm:"type:text" json:"subject"`
+	Addresses       string    `gorm:"type:text" json:"addresses"`        // From/To/Cc/Bcc joined by spaces
+	Content         string    `gorm:"type:text" json:"content"`          // Plain body, or text derived from the HTML body
+	AttachmentNames string    `gorm:"type:text" json:"attachment_names"` // Only filled when attachment indexing is enabled
+	SenderDomain    string    `gorm:"type:varchar(255);index" json:"sender_domain"`
+	IndexedAt       time.Time `json:"indexed_at"`
+}
+
+// SearchHighlight carries the ranking and highlighted fragments of a full-text hit.
+type SearchHighlight struct {
+	EmailID uint    `json:"email_id"`
+	Score   float64 `json:"score"`
+	Subject string  `json:"subject,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+}
+
+// SavedSearch is a named Gmail-style search query
+type SavedSearch struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null;uniqueIndex;type:varchar(255)" json:"name"`
+	Description string    `json:"description,omitempty"`
+	Query       string    `gorm:"type:text;not null" json:"query"` // e.g. from:github subject:(verify OR confirm) newer_than:2d
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SearchFacetBucket is one value of a search facet and the number of matching emails
+type SearchFacetBucket struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"` // Human readable value, e.g. the account address
+	Count int64  `json:"count"`
+}
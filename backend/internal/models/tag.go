@@ -0,0 +1,37 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Tag 用户自定义标签，与邮件服务商无关
+type Tag struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null;uniqueIndex;type:varchar(100)" json:"name"`
+	Color       string    `gorm:"type:varchar(20)" json:"color,omitempty"` // 如 #ff9900
+	Description string    `json:"description,omitempty"`
+	EmailCount  int64     `gorm:"-" json:"email_count"` // 打了该标签的邮件数，仅列表接口返回
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// EmailTag 邮件与标签的多对多关联表
+type EmailTag struct {
+	EmailID   uint      `gorm:"primaryKey" json:"email_id"`
+	TagID     uint      `gorm:"primaryKey;index" json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SeedLocalState 新邮件入库时用抓取到的 IMAP 标记初始化本地已读/星标状态，
+// 之后本地状态独立维护，不再随服务器标记变化
+func (e *Email) SeedLocalState() {
+	for _, flag := range e.Flags {
+		switch strings.ToLower(strings.TrimPrefix(flag, `\`)) {
+		case "seen":
+			e.IsRead = true
+		case "flagged":
+			e.IsStarred = true
+		}
+	}
+}
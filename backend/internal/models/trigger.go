@@ -20,12 +20,15 @@ type TriggerActionType string
 const (
 	TriggerActionTypeModifyContent TriggerActionType = "modify_content" // 修改邮件内容
 	TriggerActionTypeSMTP          TriggerActionType = "smtp"           // SMTP转发（未来扩展）
+	TriggerActionTypeAddTags       TriggerActionType = "add_tags"       // 为邮件添加用户标签
+	TriggerActionTypeRemoveTags    TriggerActionType = "remove_tags"    // 移除邮件的用户标签
+	TriggerActionTypeExtractValues TriggerActionType = "extract_values" // 运行提取模板并保存提取结果
 )
 
 // TriggerConditionConfig 触发条件配置
 type TriggerConditionConfig struct {
-	Type    string `json:"type"`              // js, gotemplate
-	Script  string `json:"script"`            // 脚本内容
+	Type    string `json:"type"`              // js, gotemplate, builtin
+	Script  string `json:"script"`            // 脚本内容，builtin 类型为内置提取器名称
 	Timeout *int   `json:"timeout,omitempty"` // 超时时间（秒）
 }
 
@@ -73,22 +76,27 @@ type EmailTrigger struct {
 	// 检查配置
 	CheckInterval int `gorm:"not null;default:30" json:"check_interval"` // 检查间隔（秒）
 
+	// 账户范围：只评估这些账户及带有这些标签的账户的邮件，两者都为空时评估所有账户
+	AccountIDs  []uint      `gorm:"type:json;serializer:json" json:"account_ids,omitempty"`
+	AccountTags StringSlice `gorm:"type:json" json:"account_tags,omitempty"`
+
 	// 过滤参数（复用EmailFilter结构）
-	EmailAddress  string            `json:"email_address,omitempty"`                   // 邮箱地址过滤
-	StartDate     *time.Time        `json:"start_date,omitempty"`                      // 开始日期
-	EndDate       *time.Time        `json:"end_date,omitempty"`                        // 结束日期
-	Subject       string            `json:"subject,omitempty"`                         // 主题过滤
-	From          string            `json:"from,omitempty"`                            // 发件人过滤
-	To            string            `json:"to,omitempty"`                              // 收件人过滤
-	HasAttachment *bool             `json:"has_attachment,omitempty"`                  // 是否有附件
-	Unread        *bool             `json:"unread,omitempty"`                          // 是否未读
-	Labels        StringSlice       `gorm:"type:json" json:"labels,omitempty"`         // 标签过滤
-	Folders       StringSlice       `gorm:"type:json" json:"folders,omitempty"`        // 文件夹列表
-	CustomFilters map[string]string `gorm:"type:json" json:"custom_filters,omitempty"` // 自定义过滤器
-
-	// 触发条件和动作
-	Condition TriggerConditionConfig `gorm:"type:json;not null" json:"condition"` // 触发条件
-	Actions   TriggerActions         `gorm:"type:json;not null" json:"actions"`   // 触发动作
+	EmailAddress  string            `json:"email_address,omitempty"`                                   // 收件地址或别名，支持 user+tag@gmail.com 和 *@domain.com
+	StartDate     *time.Time        `json:"start_date,omitempty"`                                      // 开始日期
+	EndDate       *time.Time        `json:"end_date,omitempty"`                                        // 结束日期
+	Subject       string            `json:"subject,omitempty"`                                         // 主题过滤
+	From          string            `json:"from,omitempty"`                                            // 发件人过滤
+	To            string            `json:"to,omitempty"`                                              // 收件人过滤
+	HasAttachment *bool             `json:"has_attachment,omitempty"`                                  // 是否有附件
+	Unread        *bool             `json:"unread,omitempty"`                                          // 是否未读
+	Labels        StringSlice       `gorm:"type:json" json:"labels,omitempty"`                         // 标签过滤
+	Folders       StringSlice       `gorm:"type:json" json:"folders,omitempty"`                        // 文件夹列表
+	CustomFilters map[string]string `gorm:"type:json;serializer:json" json:"custom_filters,omitempty"` // 自定义过滤器，键为搜索运算符，如 {"larger": "1M"}
+	Query         string            `gorm:"type:text" json:"query,omitempty"`                          // Gmail风格搜索语句，如 from:github newer_than:2d
+
+	// 触发条件和动作；CustomFilters 和 Condition 以 JSON 存储，不是 JSON 的旧行由迁移 16 修正
+	Condition TriggerConditionConfig `gorm:"type:json;not null;serializer:json" json:"condition"` // 触发条件
+	Actions   TriggerActions         `gorm:"type:json;not null" json:"actions"`                   // 触发动作
 
 	// 日志配置
 	EnableLogging bool `gorm:"default:true" json:"enable_logging"` // 是否启用日志
@@ -99,6 +107,12 @@ type EmailTrigger struct {
 	LastExecutedAt    *time.Time `json:"last_executed_at,omitempty"`          // 最后执行时间
 	LastError         string     `json:"last_error,omitempty"`                // 最后错误信息
 
+	// 处理进度：此前的邮件都已评估完，只有 ID 更大的邮件会交给触发器
+	LastEmailID uint `gorm:"not null;default:0" json:"last_email_id"`
+
+	// 配置修订号，每次修改加一，处理台账按修订记录
+	Revision int `gorm:"not null;default:1" json:"revision"`
+
 	// 时间戳
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -179,3 +193,34 @@ type TriggerExecutionLog struct {
 	// 时间戳
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// TriggerLedgerState 处理台账中一封邮件的处理状态
+type TriggerLedgerState string
+
+const (
+	TriggerLedgerStateRunning TriggerLedgerState = "running" // 执行中；租约过期后再次评估时跳过已完成的动作
+	TriggerLedgerStateDone    TriggerLedgerState = "done"    // 已处理完，再次评估时跳过
+)
+
+// TriggerLedgerEntry 处理台账：记录触发器的某个修订是否处理过一封邮件及其结果，
+// 防止重启或重叠的检查重复执行动作（例如重复转发）
+type TriggerLedgerEntry struct {
+	ID        uint `gorm:"primaryKey" json:"id"`
+	TriggerID uint `gorm:"not null;uniqueIndex:idx_trigger_ledger_key,priority:1" json:"trigger_id"`
+	EmailID   uint `gorm:"not null;uniqueIndex:idx_trigger_ledger_key,priority:2;index" json:"email_id"`
+	Revision  int  `gorm:"not null;uniqueIndex:idx_trigger_ledger_key,priority:3" json:"revision"`
+
+	State            TriggerLedgerState     `gorm:"type:varchar(16);not null" json:"state"`
+	Outcome          TriggerExecutionStatus `gorm:"type:varchar(16)" json:"outcome,omitempty"` // 处理完后的结果
+	ConditionResult  bool                   `json:"condition_result"`
+	CompletedActions []int                  `gorm:"type:json;serializer:json" json:"completed_actions,omitempty"` // 已成功的动作，按执行顺序的下标
+	Attempts         int                    `gorm:"not null;default:1" json:"attempts"`
+	Error            string                 `gorm:"type:text" json:"error,omitempty"`
+
+	// 认领：只有持有未过期租约的一方执行动作，防止重新执行与后台检查或多个进程重复执行
+	LeaseOwner     string     `gorm:"type:varchar(64)" json:"-"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
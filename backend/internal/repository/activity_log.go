@@ -120,6 +120,11 @@ func (r *ActivityLogRepository) DeleteOldActivities(days int) error {
 	return r.db.Where("created_at < ?", cutoffDate).Delete(&models.ActivityLog{}).Error
 }
 
+// ApplyRetention 按保留策略删除早于 deleteBefore 以及超出最新 maxLogs 条的活动记录
+func (r *ActivityLogRepository) ApplyRetention(deleteBefore *time.Time, maxLogs int, dryRun bool) (RetentionCounts, error) {
+	return applyLogRetention(r.db, &models.ActivityLog{}, deleteBefore, maxLogs, dryRun)
+}
+
 // LogActivity 便捷方法：记录活动
 func (r *ActivityLogRepository) LogActivity(activityType models.ActivityType, title, description string, userID *uint, metadata interface{}) error {
 	log := &models.ActivityLog{
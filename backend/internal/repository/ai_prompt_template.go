@@ -94,10 +94,13 @@ func (r *AIPromptTemplateRepository) InitializeDefaultTemplates() error {
 			SystemPrompt: `你是一个专业的邮件模板生成助手。你的任务是根据用户的需求，生成用于提取邮件信息的模板配置。
 
 模板配置必须是一个 JSON 数组，每个元素包含以下字段：
-- field: 要从中提取的字段（可选值：from, to, cc, subject, body, html_body, headers, ALL）
-- type: 提取类型（可选值：regex, js, gotemplate）
+- field: 要从中提取的字段（可选值：from, to, cc, subject, body, html_body, headers, ALL, attachments（全部附件的文本，包括 PDF、CSV、DOCX、XLSX），或 attachment:<通配符> 表示文件名匹配的附件，例如 attachment:*.json）
+- type: 提取类型（可选值：regex, js, gotemplate, html, jsonpath, builtin；html 使用 CSS 选择器或 XPath，例如 a.verify@href 提取链接地址；jsonpath 对 JSON 正文或附件求值，例如 $.order.id；builtin 使用内置提取器，extract 填写 otp、verify_link、magic_link、tracking_number、amount 或 unsubscribe_link，验证码和验证链接优先使用）
 - match: （可选）匹配条件，返回 {matched: boolean, reason?: string}
 - extract: 提取规则，返回提取的字符串或 null
+- name: （可选）输出名称，结果以该名称写入 values
+- output_type: （可选，需要 name）输出类型：string, number, date, url, list
+- required: （可选，需要 name）为 true 时缺少该值会报告校验错误
 
 示例配置：
 [
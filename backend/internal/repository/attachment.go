@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// AttachmentTextStats counts attachments by text extraction state
+type AttachmentTextStats struct {
+	Pending     int64 `json:"pending"`
+	Done        int64 `json:"done"`
+	Unsupported int64 `json:"unsupported"`
+	Failed      int64 `json:"failed"`
+}
+
+// AttachmentRepository handles the text extraction state of attachments
+type AttachmentRepository struct {
+	db *gorm.DB
+}
+
+// NewAttachmentRepository creates a new attachment repository
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// attachmentsStored is called after emails with attachments are stored, see OnAttachmentsStored
+var attachmentsStored func()
+
+// OnAttachmentsStored registers a callback invoked after emails carrying
+// attachments are created, so text extraction can start without waiting for
+// its next poll. It must be set during startup.
+func OnAttachmentsStored(callback func()) {
+	attachmentsStored = callback
+}
+
+func notifyAttachmentsStored(emails []models.Email) {
+	if attachmentsStored == nil {
+		return
+	}
+	for i := range emails {
+		if len(emails[i].Attachments) > 0 {
+			attachmentsStored()
+			return
+		}
+	}
+}
+
+// pendingTextCondition matches attachments whose text has not been extracted,
+// columns added by the migration are NULL on some dialects
+const pendingTextCondition = "text_status = '' OR text_status IS NULL"
+
+// ListPendingText returns attachments waiting for text extraction, oldest first
+func (r *AttachmentRepository) ListPendingText(limit int) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.Where(pendingTextCondition).Order("id ASC").Limit(limit).Find(&attachments).Error
+	return attachments, err
+}
+
+// SaveText stores the extraction result of an attachment
+func (r *AttachmentRepository) SaveText(id uint, text, status, errorMessage string) error {
+	now := time.Now()
+	return r.db.Model(&models.Attachment{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"text":              text,
+		"text_status":       status,
+		"text_error":        errorMessage,
+		"text_extracted_at": &now,
+	}).Error
+}
+
+// RetryText marks attachments with the given state as pending again, e.g.
+// failed ones after a parser fix, and returns how many were reset
+func (r *AttachmentRepository) RetryText(status string) (int64, error) {
+	result := r.db.Model(&models.Attachment{}).Where("text_status = ?", status).Updates(map[string]interface{}{
+		"text_status": models.AttachmentTextPending,
+		"text_error":  "",
+	})
+	return result.RowsAffected, result.Error
+}
+
+// TextStats counts attachments by text extraction state
+func (r *AttachmentRepository) TextStats() (*AttachmentTextStats, error) {
+	var rows []struct {
+		TextStatus *string
+		Count      int64
+	}
+	err := r.db.Model(&models.Attachment{}).Select("text_status, COUNT(*) AS count").Group("text_status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &AttachmentTextStats{}
+	for _, row := range rows {
+		status := ""
+		if row.TextStatus != nil {
+			status = *row.TextStatus
+		}
+		switch status {
+		case models.AttachmentTextDone:
+			stats.Done += row.Count
+		case models.AttachmentTextUnsupported:
+			stats.Unsupported += row.Count
+		case models.AttachmentTextFailed:
+			stats.Failed += row.Count
+		default:
+			stats.Pending += row.Count
+		}
+	}
+	return stats, nil
+}
+
+// GetByID returns an attachment by ID
+func (r *AttachmentRepository) GetByID(id uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := r.db.First(&attachment, id).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
@@ -0,0 +1,847 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/vcard"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// contactBatchSize bounds the IN lists of contact refreshes
+	contactBatchSize = 500
+	// maxContactDisplayNames 每个联系人保留的显示名数量
+	maxContactDisplayNames = 10
+)
+
+// ContactRepository handles database operations for contacts. Contact
+// statistics are derived from the email_addresses table and kept up to date
+// by EmailRepository whenever emails are created, updated or deleted.
+type ContactRepository struct {
+	db *gorm.DB
+}
+
+// NewContactRepository creates a new ContactRepository
+func NewContactRepository(db *gorm.DB) *ContactRepository {
+	return &ContactRepository{db: db}
+}
+
+// ContactFilter selects and orders contacts
+type ContactFilter struct {
+	Query     string // 地址、名称或组织包含该值
+	AccountID uint   // 只包含与该账户有往来的联系人，统计与排序按该账户计算
+	Sort      string // messages、from、to、last_seen、first_seen 或 name，默认 last_seen
+	Limit     int
+	Offset    int
+}
+
+// contactSorts maps sort names to the ORDER BY of all contacts and of the contacts of one account
+var contactSorts = map[string][2]string{
+	"messages":   {"contacts.message_count DESC", "contact_accounts.from_count + contact_accounts.to_count DESC"},
+	"from":       {"contacts.from_count DESC", "contact_accounts.from_count DESC"},
+	"to":         {"contacts.to_count DESC", "contact_accounts.to_count DESC"},
+	"last_seen":  {"contacts.last_seen_at IS NULL, contacts.last_seen_at DESC", "contact_accounts.last_seen_at IS NULL, contact_accounts.last_seen_at DESC"},
+	"first_seen": {"contacts.first_seen_at IS NULL, contacts.first_seen_at", "contact_accounts.first_seen_at IS NULL, contact_accounts.first_seen_at"},
+	"name":       {"LOWER(contacts.name), contacts.address", "LOWER(contacts.name), contacts.address"},
+}
+
+// IsValidContactSort reports whether sort is a supported contact order, empty means the default
+func IsValidContactSort(sort string) bool {
+	_, ok := contactSorts[sort]
+	return ok || sort == ""
+}
+
+// ContactUpdate holds the editable fields of a contact, nil fields are left unchanged
+type ContactUpdate struct {
+	Name         *string   `json:"name,omitempty"` // 空字符串恢复为邮件中最常用的显示名
+	Organization *string   `json:"organization,omitempty"`
+	Phones       *[]string `json:"phones,omitempty"`
+	Notes        *string   `json:"notes,omitempty"`
+}
+
+// Correspondent is a contact that sent email to an address
+type Correspondent struct {
+	Contact    models.Contact `json:"contact"`
+	Messages   int64          `json:"messages"`
+	LastSentAt *time.Time     `json:"last_sent_at,omitempty"`
+}
+
+// ContactImportResult summarizes a vCard import
+type ContactImportResult struct {
+	Cards   int `json:"cards"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"` // 没有有效邮件地址的名片
+}
+
+func (r *ContactRepository) filtered(filter ContactFilter) *gorm.DB {
+	query := r.db.Model(&models.Contact{})
+	if filter.AccountID > 0 {
+		query = query.Joins("JOIN contact_accounts ON contact_accounts.contact_id = contacts.id AND contact_accounts.account_id = ?", filter.AccountID)
+	}
+	if value := strings.TrimSpace(filter.Query); value != "" {
+		pattern := likePattern(value)
+		query = query.Where(
+			"(contacts.address LIKE ? ESCAPE '!' OR LOWER(contacts.name) LIKE ? ESCAPE '!' OR LOWER(contacts.organization) LIKE ? ESCAPE '!'"+
+				" OR contacts.id IN (SELECT contact_id FROM contact_addresses WHERE address LIKE ? ESCAPE '!'))",
+			pattern, pattern, pattern, pattern,
+		)
+	}
+	return query
+}
+
+// List returns a page of contacts with their addresses and per-account statistics, and the total count
+func (r *ContactRepository) List(filter ContactFilter) ([]models.Contact, int64, error) {
+	var total int64
+	if err := r.filtered(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	sortKey := filter.Sort
+	if sortKey == "" {
+		sortKey = "last_seen"
+	}
+	order, ok := contactSorts[sortKey]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported sort %q", filter.Sort)
+	}
+	orderBy := order[0]
+	if filter.AccountID > 0 {
+		orderBy = order[1]
+	}
+
+	query := r.filtered(filter).Select("contacts.*").Order(orderBy).Order("contacts.id")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var contacts []models.Contact
+	err := query.Preload("Addresses", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Accounts").Find(&contacts).Error
+	return contacts, total, err
+}
+
+// Each calls fn with batches of the contacts matching filter, ordered by ID.
+// Sort, Limit and Offset are ignored.
+func (r *ContactRepository) Each(filter ContactFilter, fn func([]models.Contact) error) error {
+	var lastID uint
+	for {
+		var contacts []models.Contact
+		err := r.filtered(filter).Select("contacts.*").Where("contacts.id > ?", lastID).
+			Order("contacts.id").Limit(contactBatchSize).
+			Preload("Addresses", func(db *gorm.DB) *gorm.DB {
+				return db.Order("id")
+			}).Find(&contacts).Error
+		if err != nil {
+			return err
+		}
+		if len(contacts) == 0 {
+			return nil
+		}
+		if err := fn(contacts); err != nil {
+			return err
+		}
+		lastID = contacts[len(contacts)-1].ID
+	}
+}
+
+// GetByID retrieves a contact with its addresses and per-account statistics
+func (r *ContactRepository) GetByID(id uint) (*models.Contact, error) {
+	var contact models.Contact
+	err := r.db.Preload("Addresses", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Accounts").First(&contact, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("contact not found")
+		}
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// Update changes the editable fields of a contact
+func (r *ContactRepository) Update(id uint, update ContactUpdate) (*models.Contact, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var contact models.Contact
+		if err := tx.First(&contact, id).Error; err != nil {
+			return err
+		}
+
+		if update.Name != nil {
+			contact.Name = strings.TrimSpace(*update.Name)
+			contact.CustomName = contact.Name != ""
+		}
+		if update.Organization != nil {
+			contact.Organization = strings.TrimSpace(*update.Organization)
+		}
+		if update.Phones != nil {
+			contact.Phones = mergeValues(nil, *update.Phones)
+		}
+		if update.Notes != nil {
+			contact.Notes = *update.Notes
+		}
+		if err := tx.Select("name", "custom_name", "organization", "phones", "notes", "updated_at").Save(&contact).Error; err != nil {
+			return err
+		}
+		// 清空名称后重新取邮件中的显示名
+		return recomputeContacts(tx, []uint{contact.ID})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("contact not found")
+		}
+		return nil, err
+	}
+	return r.GetByID(id)
+}
+
+// Merge moves the addresses of the source contacts to the target contact and
+// deletes the source contacts. Statistics are recomputed over all addresses.
+func (r *ContactRepository) Merge(targetID uint, sourceIDs []uint) (*models.Contact, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var target models.Contact
+		if err := tx.First(&target, targetID).Error; err != nil {
+			return err
+		}
+		var sources []models.Contact
+		if err := tx.Where("id IN ? AND id <> ?", sourceIDs, targetID).Find(&sources).Error; err != nil {
+			return err
+		}
+		if len(sources) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(sources))
+		for i, source := range sources {
+			ids[i] = source.ID
+			target.Phones = mergeValues(target.Phones, source.Phones)
+			if target.Organization == "" {
+				target.Organization = source.Organization
+			}
+			if source.Notes != "" && !strings.Contains(target.Notes, source.Notes) {
+				target.Notes = strings.TrimSpace(target.Notes + "\n" + source.Notes)
+			}
+			if !target.CustomName && source.CustomName {
+				target.Name, target.CustomName = source.Name, true
+			}
+		}
+
+		if err := tx.Model(&models.ContactAddress{}).Where("contact_id IN ?", ids).Update("contact_id", targetID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("contact_id IN ?", ids).Delete(&models.ContactAccount{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Contact{}, ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("name", "custom_name", "organization", "phones", "notes", "updated_at").Save(&target).Error; err != nil {
+			return err
+		}
+		return recomputeContacts(tx, []uint{targetID})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("contact not found")
+		}
+		return nil, err
+	}
+	return r.GetByID(targetID)
+}
+
+// Correspondents returns the contacts that sent email to an address (or an
+// "@domain"), ordered by the number of such emails
+func (r *ContactRepository) Correspondents(address string, accountID uint, limit int) ([]Correspondent, error) {
+	kind, value := models.ClassifyAddressPattern(address)
+	recipient := "recipient.address = ?"
+	switch kind {
+	case models.AddressPatternDomain:
+		recipient = "recipient.domain = ?"
+	case models.AddressPatternSubstring:
+		return nil, fmt.Errorf("expected an email address or @domain, got %q", address)
+	}
+
+	query := r.db.Table("email_addresses AS recipient").
+		Select("contact_addresses.contact_id, COUNT(DISTINCT recipient.email_id) AS messages, MAX(emails.date) AS last_sent_at").
+		Joins("JOIN email_addresses AS sender ON sender.email_id = recipient.email_id AND sender.role = ?", models.AddressRoleFrom).
+		Joins("JOIN contact_addresses ON contact_addresses.address = sender.address").
+		Joins("JOIN emails ON emails.id = recipient.email_id").
+		Where(recipient, value).
+		Where("recipient.role IN ?", []models.AddressRole{models.AddressRoleTo, models.AddressRoleCc, models.AddressRoleBcc}).
+		Group("contact_addresses.contact_id").
+		Order("messages DESC").Order("contact_addresses.contact_id")
+	if accountID > 0 {
+		query = query.Where("emails.account_id = ?", accountID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var rows []struct {
+		ContactID  uint
+		Messages   int64
+		LastSentAt aggregateTime
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []Correspondent{}, nil
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ContactID
+	}
+	var contacts []models.Contact
+	if err := r.db.Preload("Addresses").Where("id IN ?", ids).Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Contact, len(contacts))
+	for _, contact := range contacts {
+		byID[contact.ID] = contact
+	}
+
+	correspondents := make([]Correspondent, 0, len(rows))
+	for _, row := range rows {
+		correspondents = append(correspondents, Correspondent{
+			Contact:    byID[row.ContactID],
+			Messages:   row.Messages,
+			LastSentAt: row.LastSentAt.Time,
+		})
+	}
+	return correspondents, nil
+}
+
+// ImportCards adds the cards to the directory. A card is merged into the
+// contact owning one of its addresses, otherwise a new contact is created.
+func (r *ContactRepository) ImportCards(cards []vcard.Card) (ContactImportResult, error) {
+	var result ContactImportResult
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = importCards(tx, cards)
+		return err
+	})
+	return result, err
+}
+
+// ImportAttachments imports the vCards found among stored attachments
+func (r *ContactRepository) ImportAttachments() (ContactImportResult, error) {
+	var total ContactImportResult
+	var lastID uint
+	for {
+		var attachments []models.Attachment
+		err := r.db.Select("id", "filename", "mime_type", "content").
+			Where("id > ?", lastID).
+			Where("LOWER(filename) LIKE ? OR LOWER(filename) LIKE ? OR LOWER(mime_type) LIKE ? OR LOWER(mime_type) LIKE ? OR LOWER(mime_type) LIKE ?",
+				"%.vcf", "%.vcard", "text/vcard%", "text/x-vcard%", "text/directory%").
+			Order("id").Limit(100).Find(&attachments).Error
+		if err != nil {
+			return total, err
+		}
+		if len(attachments) == 0 {
+			return total, nil
+		}
+
+		result, err := r.ImportCards(parseVCardAttachments(attachments))
+		if err != nil {
+			return total, err
+		}
+		total.Cards += result.Cards
+		total.Created += result.Created
+		total.Updated += result.Updated
+		total.Skipped += result.Skipped
+		lastID = attachments[len(attachments)-1].ID
+	}
+}
+
+// Backfill creates the contacts of addresses that have none yet, such as
+// emails stored before the contacts directory existed. It returns the number
+// of new addresses.
+func (r *ContactRepository) Backfill(batchSize int) (int, error) {
+	if batchSize <= 0 || batchSize > contactBatchSize {
+		batchSize = contactBatchSize
+	}
+
+	total := 0
+	for {
+		var addresses []string
+		err := r.db.Model(&models.EmailAddress{}).Distinct("address").
+			Where("role IN ? AND domain <> ''", models.ContactRoles).
+			Where("NOT EXISTS (SELECT 1 FROM contact_addresses WHERE contact_addresses.address = email_addresses.address)").
+			Limit(batchSize).Pluck("address", &addresses).Error
+		if err != nil {
+			return total, err
+		}
+		if len(addresses) == 0 {
+			return total, nil
+		}
+		if err := r.db.Transaction(func(tx *gorm.DB) error {
+			return touchContacts(tx, addresses)
+		}); err != nil {
+			return total, err
+		}
+		total += len(addresses)
+	}
+}
+
+// Rebuild recomputes the statistics of every contact and creates missing contacts
+func (r *ContactRepository) Rebuild() (int, error) {
+	var lastID uint
+	total := 0
+	for {
+		var ids []uint
+		if err := r.db.Model(&models.Contact{}).Where("id > ?", lastID).Order("id").Limit(contactBatchSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err := r.db.Transaction(func(tx *gorm.DB) error {
+			return recomputeContacts(tx, ids)
+		}); err != nil {
+			return total, err
+		}
+		total += len(ids)
+		lastID = ids[len(ids)-1]
+	}
+
+	created, err := r.Backfill(contactBatchSize)
+	return total + created, err
+}
+
+// contactAddressesOf returns the addresses of emails that count for contacts;
+// emailIDs is a slice of ids or a subquery selecting them
+func contactAddressesOf(tx *gorm.DB, emailIDs interface{}) ([]string, error) {
+	var addresses []string
+	err := tx.Model(&models.EmailAddress{}).Distinct("address").
+		Where("email_id IN (?) AND role IN ? AND domain <> ''", emailIDs, models.ContactRoles).
+		Pluck("address", &addresses).Error
+	return addresses, err
+}
+
+// contactAddressesOfRecords returns the addresses of new address rows that count for contacts
+func contactAddressesOfRecords(records []models.EmailAddress) []string {
+	var addresses []string
+	for _, record := range records {
+		if record.Domain == "" {
+			continue
+		}
+		for _, role := range models.ContactRoles {
+			if record.Role == role {
+				addresses = append(addresses, record.Address)
+				break
+			}
+		}
+	}
+	return addresses
+}
+
+// touchContacts creates the contacts of new addresses and recomputes the contacts of all given addresses
+func touchContacts(tx *gorm.DB, addresses []string) error {
+	return refreshContactsOf(tx, addresses, true)
+}
+
+// refreshContacts recomputes the contacts of addresses whose emails changed or were deleted
+func refreshContacts(tx *gorm.DB, addresses []string) error {
+	return refreshContactsOf(tx, addresses, false)
+}
+
+func refreshContactsOf(tx *gorm.DB, addresses []string, create bool) error {
+	addresses = mergeValues(nil, addresses)
+	for start := 0; start < len(addresses); start += contactBatchSize {
+		end := start + contactBatchSize
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		ids, err := contactIDsFor(tx, addresses[start:end], create)
+		if err != nil {
+			return err
+		}
+		if err := recomputeContacts(tx, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contactIDsFor maps addresses to their contacts, creating contacts for unknown addresses when create is set
+func contactIDsFor(tx *gorm.DB, addresses []string, create bool) ([]uint, error) {
+	var mapped []models.ContactAddress
+	if err := tx.Where("address IN ?", addresses).Find(&mapped).Error; err != nil {
+		return nil, err
+	}
+
+	if create && len(mapped) < len(addresses) {
+		known := make(map[string]bool, len(mapped))
+		for _, m := range mapped {
+			known[m.Address] = true
+		}
+		var missing []string
+		var contacts []models.Contact
+		for _, address := range addresses {
+			if !known[address] {
+				missing = append(missing, address)
+				contacts = append(contacts, models.Contact{Address: address})
+			}
+		}
+
+		// 并发的同步或补建可能同时创建同一个联系人，冲突时沿用已有的行
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&contacts).Error; err != nil {
+			return nil, err
+		}
+		var created []models.Contact
+		if err := tx.Select("id", "address").Where("address IN ?", missing).Find(&created).Error; err != nil {
+			return nil, err
+		}
+		links := make([]models.ContactAddress, 0, len(created))
+		for _, contact := range created {
+			links = append(links, models.ContactAddress{ContactID: contact.ID, Address: contact.Address})
+		}
+		if len(links) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+				return nil, err
+			}
+		}
+
+		mapped = nil
+		if err := tx.Where("address IN ?", addresses).Find(&mapped).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[uint]bool, len(mapped))
+	var ids []uint
+	for _, m := range mapped {
+		if !seen[m.ContactID] {
+			seen[m.ContactID] = true
+			ids = append(ids, m.ContactID)
+		}
+	}
+	return ids, nil
+}
+
+// recomputeContacts derives the statistics, display names and per-account rows of contacts from email_addresses
+func recomputeContacts(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	source := func() *gorm.DB {
+		return tx.Table("email_addresses").
+			Joins("JOIN contact_addresses ON contact_addresses.address = email_addresses.address").
+			Joins("JOIN emails ON emails.id = email_addresses.email_id").
+			Where("contact_addresses.contact_id IN ? AND email_addresses.role IN ?", ids, models.ContactRoles)
+	}
+
+	const direction = "CASE WHEN email_addresses.role = 'from' THEN 1 ELSE 0 END"
+	var perAccount []struct {
+		ContactID uint
+		AccountID uint
+		Inbound   int
+		Messages  int64
+		FirstSeen aggregateTime
+		LastSeen  aggregateTime
+	}
+	err := source().
+		Select("contact_addresses.contact_id, emails.account_id, " + direction + " AS inbound, " +
+			"COUNT(DISTINCT email_addresses.email_id) AS messages, MIN(emails.date) AS first_seen, MAX(emails.date) AS last_seen").
+		Group("contact_addresses.contact_id, emails.account_id, " + direction).
+		Scan(&perAccount).Error
+	if err != nil {
+		return fmt.Errorf("failed to aggregate contacts: %w", err)
+	}
+
+	var totals []struct {
+		ContactID uint
+		Messages  int64
+	}
+	err = source().
+		Select("contact_addresses.contact_id, COUNT(DISTINCT email_addresses.email_id) AS messages").
+		Group("contact_addresses.contact_id").
+		Scan(&totals).Error
+	if err != nil {
+		return fmt.Errorf("failed to count contact messages: %w", err)
+	}
+
+	var names []struct {
+		ContactID uint
+		Name      string
+		Uses      int64
+	}
+	err = source().
+		Select("contact_addresses.contact_id, email_addresses.name, COUNT(*) AS uses").
+		Where("email_addresses.name <> ''").
+		Group("contact_addresses.contact_id, email_addresses.name").
+		Order("uses DESC").Order("email_addresses.name").
+		Scan(&names).Error
+	if err != nil {
+		return fmt.Errorf("failed to collect contact names: %w", err)
+	}
+
+	var contacts []models.Contact
+	if err := tx.Select("id", "name", "custom_name").Where("id IN ?", ids).Find(&contacts).Error; err != nil {
+		return err
+	}
+
+	type stats struct {
+		from, to, messages int64
+		first, last        *time.Time
+		names              models.StringSlice
+	}
+	byContact := make(map[uint]*stats, len(ids))
+	for _, id := range ids {
+		byContact[id] = &stats{names: models.StringSlice{}}
+	}
+	accounts := make(map[[2]uint]*models.ContactAccount)
+	var accountOrder [][2]uint
+	for _, row := range perAccount {
+		s := byContact[row.ContactID]
+		key := [2]uint{row.ContactID, row.AccountID}
+		account, ok := accounts[key]
+		if !ok {
+			account = &models.ContactAccount{ContactID: row.ContactID, AccountID: row.AccountID}
+			accounts[key] = account
+			accountOrder = append(accountOrder, key)
+		}
+		if row.Inbound == 1 {
+			s.from += row.Messages
+			account.FromCount += row.Messages
+		} else {
+			s.to += row.Messages
+			account.ToCount += row.Messages
+		}
+		s.first, s.last = spanTimes(s.first, s.last, row.FirstSeen.Time, row.LastSeen.Time)
+		account.FirstSeenAt, account.LastSeenAt = spanTimes(account.FirstSeenAt, account.LastSeenAt, row.FirstSeen.Time, row.LastSeen.Time)
+	}
+	for _, row := range totals {
+		byContact[row.ContactID].messages = row.Messages
+	}
+	for _, row := range names {
+		s := byContact[row.ContactID]
+		if len(s.names) < maxContactDisplayNames {
+			s.names = append(s.names, row.Name)
+		}
+	}
+
+	for _, contact := range contacts {
+		s := byContact[contact.ID]
+		updates := map[string]interface{}{
+			"from_count":    s.from,
+			"to_count":      s.to,
+			"message_count": s.messages,
+			"first_seen_at": s.first,
+			"last_seen_at":  s.last,
+			"display_names": s.names,
+		}
+		if !contact.CustomName {
+			name := ""
+			if len(s.names) > 0 {
+				name = s.names[0]
+			}
+			updates["name"] = name
+		}
+		if err := tx.Model(&models.Contact{}).Where("id = ?", contact.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Where("contact_id IN ?", ids).Delete(&models.ContactAccount{}).Error; err != nil {
+		return err
+	}
+	if len(accountOrder) == 0 {
+		return nil
+	}
+	rows := make([]models.ContactAccount, 0, len(accountOrder))
+	for _, key := range accountOrder {
+		rows = append(rows, *accounts[key])
+	}
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 200).Error
+}
+
+// importCards merges vCards into the directory inside a transaction
+func importCards(tx *gorm.DB, cards []vcard.Card) (ContactImportResult, error) {
+	result := ContactImportResult{Cards: len(cards)}
+	var touched []uint
+
+	for _, card := range cards {
+		var addresses []string
+		for _, email := range card.Emails {
+			parsed := models.ParseAddress(email)
+			if parsed.Domain != "" {
+				addresses = append(addresses, parsed.Address)
+			}
+		}
+		addresses = mergeValues(nil, addresses)
+		if len(addresses) == 0 {
+			result.Skipped++
+			continue
+		}
+
+		var mapped []models.ContactAddress
+		if err := tx.Where("address IN ?", addresses).Order("id").Find(&mapped).Error; err != nil {
+			return result, err
+		}
+
+		var contact models.Contact
+		if len(mapped) > 0 {
+			if err := tx.First(&contact, mapped[0].ContactID).Error; err != nil {
+				return result, err
+			}
+			result.Updated++
+		} else {
+			contact.Address = addresses[0]
+			result.Created++
+		}
+
+		if name := strings.TrimSpace(card.Name); name != "" && !contact.CustomName {
+			contact.Name, contact.CustomName = name, true
+		}
+		if contact.Organization == "" {
+			contact.Organization = strings.TrimSpace(card.Organization)
+		}
+		if note := strings.TrimSpace(card.Note); note != "" && !strings.Contains(contact.Notes, note) {
+			contact.Notes = strings.TrimSpace(contact.Notes + "\n" + note)
+		}
+		contact.Phones = mergeValues(contact.Phones, card.Phones)
+		if err := tx.Save(&contact).Error; err != nil {
+			return result, err
+		}
+
+		// 名片中尚未归属其他联系人的地址加入该联系人
+		links := make([]models.ContactAddress, 0, len(addresses))
+		for _, address := range addresses {
+			links = append(links, models.ContactAddress{ContactID: contact.ID, Address: address})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+			return result, err
+		}
+		touched = append(touched, contact.ID)
+	}
+
+	return result, recomputeContacts(tx, touched)
+}
+
+// importVCardAttachments imports the vCards attached to newly stored emails.
+// Unreadable cards are logged and skipped so that they never block a sync.
+func importVCardAttachments(tx *gorm.DB, emails []models.Email) error {
+	var attachments []models.Attachment
+	for i := range emails {
+		attachments = append(attachments, emails[i].Attachments...)
+	}
+	cards := parseVCardAttachments(attachments)
+	if len(cards) == 0 {
+		return nil
+	}
+	_, err := importCards(tx, cards)
+	return err
+}
+
+func parseVCardAttachments(attachments []models.Attachment) []vcard.Card {
+	var cards []vcard.Card
+	for _, attachment := range attachments {
+		if !vcard.IsVCard(attachment.Filename, attachment.MIMEType) || len(attachment.Content) == 0 {
+			continue
+		}
+		parsed, err := vcard.Parse(bytes.NewReader(attachment.Content))
+		if err != nil {
+			log.Printf("[Contacts] Skipping vCard attachment %d (%s): %v", attachment.ID, attachment.Filename, err)
+			continue
+		}
+		cards = append(cards, parsed...)
+	}
+	return cards
+}
+
+// mergeValues appends the non-empty values missing from list, keeping the order
+func mergeValues(list []string, values []string) []string {
+	seen := make(map[string]bool, len(list)+len(values))
+	merged := make([]string, 0, len(list)+len(values))
+	for _, value := range append(append([]string{}, list...), values...) {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		merged = append(merged, value)
+	}
+	return merged
+}
+
+// spanTimes widens the range [first, last] to include [from, to]
+func spanTimes(first, last, from, to *time.Time) (*time.Time, *time.Time) {
+	if from != nil && (first == nil || from.Before(*first)) {
+		first = from
+	}
+	if to != nil && (last == nil || to.After(*last)) {
+		last = to
+	}
+	return first, last
+}
+
+// aggregateTimeLayouts are the formats SQLite returns for MIN/MAX of time columns
+var aggregateTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// aggregateTime scans MIN/MAX of a time column. SQLite has no time type and
+// returns aggregates of time columns as text, the other drivers as time.Time.
+type aggregateTime struct {
+	Time *time.Time
+}
+
+// Value implements the driver.Valuer interface, which lets GORM treat the type as a column
+func (t aggregateTime) Value() (driver.Value, error) {
+	if t.Time == nil {
+		return nil, nil
+	}
+	return *t.Time, nil
+}
+
+// Scan implements the sql.Scanner interface
+func (t *aggregateTime) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		t.Time = nil
+		return nil
+	case time.Time:
+		t.Time = &v
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("cannot scan %T into a time", value)
+	}
+
+	text = strings.TrimSuffix(text, "Z")
+	for _, layout := range aggregateTimeLayouts {
+		if parsed, err := time.Parse(layout, text); err == nil {
+			t.Time = &parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse time %q", text)
+}
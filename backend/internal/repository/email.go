@@ -3,6 +3,8 @@ package repository
 import (
 	"errors"
 	"mailman/internal/models"
+	"mailman/internal/searchquery"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,17 +12,39 @@ import (
 
 // EmailRepository handles database operations for Email
 type EmailRepository struct {
-	db *gorm.DB
+	db          *gorm.DB
+	searchIndex *SearchIndex
 }
 
 // NewEmailRepository creates a new EmailRepository
 func NewEmailRepository(db *gorm.DB) *EmailRepository {
-	return &EmailRepository{db: db}
+	return &EmailRepository{db: db, searchIndex: NewSearchIndex(db)}
+}
+
+// SearchIndex returns the full-text index maintained by this repository
+func (r *EmailRepository) SearchIndex() *SearchIndex {
+	return r.searchIndex
 }
 
 // Create creates a new email
 func (r *EmailRepository) Create(email *models.Email) error {
-	return r.db.Create(email).Error
+	email.SeedLocalState()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(email).Error; err != nil {
+			return err
+		}
+		if err := saveAddresses(tx, []models.Email{*email}); err != nil {
+			return err
+		}
+		return importVCardAttachments(tx, []models.Email{*email})
+	})
+	if err != nil {
+		return err
+	}
+	logIndexError("index email", r.searchIndex.IndexEmails([]models.Email{*email}))
+	notifyAttachmentsStored([]models.Email{*email})
+	notifyEmailsStored()
+	return nil
 }
 
 // CreateBatch creates multiple emails in a batch
@@ -28,13 +52,94 @@ func (r *EmailRepository) CreateBatch(emails []models.Email) error {
 	if len(emails) == 0 {
 		return nil
 	}
-	return r.db.CreateInBatches(emails, 100).Error
+	for i := range emails {
+		emails[i].SeedLocalState()
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(emails, 100).Error; err != nil {
+			return err
+		}
+		if err := saveAddresses(tx, emails); err != nil {
+			return err
+		}
+		return importVCardAttachments(tx, emails)
+	})
+	if err != nil {
+		return err
+	}
+	logIndexError("index email batch", r.searchIndex.IndexEmails(emails))
+	notifyAttachmentsStored(emails)
+	notifyEmailsStored()
+	return nil
+}
+
+// emailsStored are called after new emails are stored, see OnEmailsStored
+var emailsStored []func()
+
+// OnEmailsStored registers a callback invoked after new emails are created,
+// so that background processing can pick them up without waiting for its next
+// poll. Callbacks must be registered during startup and must not block.
+func OnEmailsStored(callback func()) {
+	emailsStored = append(emailsStored, callback)
+}
+
+func notifyEmailsStored() {
+	for _, callback := range emailsStored {
+		callback()
+	}
+}
+
+// latestEmailID returns the ID of the newest stored email, 0 when there is none.
+// Email IDs only grow, so it marks where processing of new emails starts.
+func latestEmailID(db *gorm.DB) (uint, error) {
+	var maxID *uint
+	if err := db.Model(&models.Email{}).Select("MAX(id)").Scan(&maxID).Error; err != nil {
+		return 0, err
+	}
+	if maxID == nil {
+		return 0, nil
+	}
+	return *maxID, nil
+}
+
+// EmailVisibilityLag bounds how long storing emails takes to commit. An email
+// gets its ID when it is inserted but only becomes visible when its transaction
+// commits, so with concurrent syncs a lower ID can appear after a higher one.
+// Cursors over email IDs only move past emails stored longer ago than this.
+const EmailVisibilityLag = 5 * time.Minute
+
+// settledEmailID returns the ID of the newest email stored at or before cutoff,
+// 0 when there is none. Emails with a lower ID were inserted earlier, so when
+// cutoff is EmailVisibilityLag ago no email up to this ID can still appear.
+func settledEmailID(db *gorm.DB, cutoff time.Time) (uint, error) {
+	var ids []uint
+	err := db.Model(&models.Email{}).Where("created_at <= ?", cutoff).Order("id DESC").Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// ListAfterID returns up to limit emails with an ID in (afterID, untilID],
+// oldest first, with their account, attachments and tags. accountIDs limits
+// the result to these accounts when not empty.
+func (r *EmailRepository) ListAfterID(afterID, untilID uint, accountIDs []uint, limit int) ([]models.Email, error) {
+	var emails []models.Email
+	query := r.db.Preload("Account").Preload("Attachments").Preload("Tags").
+		Where("id > ? AND id <= ?", afterID, untilID).
+		Order("id ASC").
+		Limit(limit)
+	if len(accountIDs) > 0 {
+		query = query.Where("account_id IN ?", accountIDs)
+	}
+	err := query.Find(&emails).Error
+	return emails, err
 }
 
 // GetByID retrieves an email by ID
 func (r *EmailRepository) GetByID(id uint) (*models.Email, error) {
 	var email models.Email
-	err := r.db.Preload("Account").Preload("Attachments").First(&email, id).Error
+	err := r.db.Preload("Account").Preload("Attachments").Preload("Tags").First(&email, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("email not found")
@@ -110,15 +215,26 @@ func (r *EmailRepository) GetByDateRange(accountID uint, startDate, endDate time
 // Search searches emails by subject or sender
 func (r *EmailRepository) Search(accountID uint, query string) ([]models.Email, error) {
 	var emails []models.Email
-	searchPattern := "%" + query + "%"
-	err := r.db.Where("account_id = ? AND (subject LIKE ? OR from LIKE ?)", accountID, searchPattern, searchPattern).
+	fromSQL, fromArgs := AddressCondition(query, models.AddressRoleFrom)
+	err := r.db.Where("emails.account_id = ?", accountID).
+		Where(r.db.Where("LOWER(emails.subject) LIKE ? ESCAPE '!'", likePattern(query)).Or(fromSQL, fromArgs...)).
 		Order("date DESC").Find(&emails).Error
 	return emails, err
 }
 
 // Update updates an email
 func (r *EmailRepository) Update(email *models.Email) error {
-	return r.db.Save(email).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(email).Error; err != nil {
+			return err
+		}
+		return replaceAddresses(tx, email)
+	})
+	if err != nil {
+		return err
+	}
+	logIndexError("reindex email", r.searchIndex.IndexEmails([]models.Email{*email}))
+	return nil
 }
 
 // UpdateFlags updates email flags
@@ -128,12 +244,66 @@ func (r *EmailRepository) UpdateFlags(id uint, flags models.StringSlice) error {
 
 // Delete soft deletes an email
 func (r *EmailRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Email{}, id).Error
+	addresses, err := contactAddressesOf(r.db, []uint{id})
+	if err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id = ?", id).Delete(&models.EmailTag{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id = ?", id).Delete(&models.EmailAddress{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id = ?", id).Delete(&models.ExtractedValue{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id = ?", id).Delete(&models.TriggerLedgerEntry{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Delete(&models.Email{}, id).Error; err != nil {
+		return err
+	}
+	if err := r.refreshContacts(addresses); err != nil {
+		return err
+	}
+	logIndexError("remove email from index", r.searchIndex.Remove(id))
+	return nil
 }
 
 // DeleteByAccount deletes all emails for a specific account
 func (r *EmailRepository) DeleteByAccount(accountID uint) error {
-	return r.db.Where("account_id = ?", accountID).Delete(&models.Email{}).Error
+	accountEmails := r.db.Model(&models.Email{}).Select("id").Where("account_id = ?", accountID)
+	addresses, err := contactAddressesOf(r.db, accountEmails)
+	if err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id IN (?)", accountEmails).Delete(&models.EmailTag{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id IN (?)", accountEmails).Delete(&models.EmailAddress{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id IN (?)", accountEmails).Delete(&models.ExtractedValue{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("email_id IN (?)", accountEmails).Delete(&models.TriggerLedgerEntry{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("account_id = ?", accountID).Delete(&models.Email{}).Error; err != nil {
+		return err
+	}
+	if err := r.refreshContacts(addresses); err != nil {
+		return err
+	}
+	logIndexError("remove account from index", r.searchIndex.RemoveByAccount(accountID))
+	return nil
+}
+
+// refreshContacts recomputes the contacts of addresses whose emails were deleted
+func (r *EmailRepository) refreshContacts(addresses []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return refreshContacts(tx, addresses)
+	})
 }
 
 // GetCount returns the total count of emails for an account
@@ -227,7 +397,7 @@ type EmailSearchOptions struct {
 	AccountID    uint
 	Limit        int
 	Offset       int
-	SortBy       string
+	SortBy       string // SQL order, or "relevance" to rank full-text hits
 	StartDate    *time.Time
 	EndDate      *time.Time
 	FromQuery    string
@@ -236,87 +406,166 @@ type EmailSearchOptions struct {
 	SubjectQuery string
 	BodyQuery    string
 	HTMLQuery    string
-	Keyword      string // Global search across all text fields
+	Keyword      string // Global full-text search across subject, addresses and body
+	Query        string // Gmail-style query, see package searchquery
 	MailboxName  string
+	Tags         []string // Only emails carrying all of these user tags
+	Highlight    bool     // Return highlighted snippets for keyword hits
+
+	Facets        []string // Facets to count over all matches, see ValidFacets
+	FacetInterval string   // Date facet bucket size: day (default), week or month
+	FacetLimit    int      // Maximum buckets per facet, defaults to 20
 }
 
-// SearchEmails performs advanced search on emails with multiple criteria
-func (r *EmailRepository) SearchEmails(options EmailSearchOptions) ([]models.Email, int64, error) {
-	var emails []models.Email
-	var totalCount int64
+// SortByRelevance orders keyword hits by their full-text rank
+const SortByRelevance = "relevance"
 
-	// Build the base query
-	query := r.db.Model(&models.Email{})
+// EmailSearchResult is the outcome of EmailRepository.SearchEmailsDetailed
+type EmailSearchResult struct {
+	Emails     []models.Email
+	Total      int64
+	Highlights map[uint]models.SearchHighlight       // Keyed by email ID, only set for full-text searches with Highlight
+	Facets     map[string][]models.SearchFacetBucket // Keyed by facet name, only set when Facets were requested
+}
 
+// applySearchFilters applies the options to an emails query. It returns the
+// keyword used to rank and highlight the results, which is either the plain
+// Keyword or the free-text terms of the search Query.
+func (r *EmailRepository) applySearchFilters(query *gorm.DB, options EmailSearchOptions) (*gorm.DB, string, error) {
 	// Apply account filter only if AccountID is specified (non-zero)
 	if options.AccountID > 0 {
-		query = query.Where("account_id = ?", options.AccountID)
+		query = query.Where("emails.account_id = ?", options.AccountID)
 	}
 
 	// Apply date range filter
 	if options.StartDate != nil {
-		query = query.Where("date >= ?", *options.StartDate)
+		query = query.Where("emails.date >= ?", *options.StartDate)
 	}
 	if options.EndDate != nil {
-		query = query.Where("date <= ?", *options.EndDate)
+		query = query.Where("emails.date <= ?", *options.EndDate)
 	}
 
 	// Apply mailbox filter
 	if options.MailboxName != "" {
-		query = query.Where("mailbox_name = ?", options.MailboxName)
+		query = query.Where("emails.mailbox_name = ?", options.MailboxName)
 	}
 
-	// Apply text search filters
-	if options.Keyword != "" {
-		// Global keyword search across all text fields
-		keywordPattern := "%" + options.Keyword + "%"
-		query = query.Where(
-			"subject LIKE ? OR JSON_EXTRACT(`from`, '$[0]') LIKE ? OR `to` LIKE ? OR cc LIKE ? OR body LIKE ? OR html_body LIKE ?",
-			keywordPattern, keywordPattern, keywordPattern, keywordPattern, keywordPattern, keywordPattern,
-		)
-	} else {
-		// Individual field searches
-		if options.FromQuery != "" {
-			fromPattern := "%" + options.FromQuery + "%"
-			query = query.Where("JSON_EXTRACT(`from`, '$[0]') LIKE ?", fromPattern)
-		}
-		if options.ToQuery != "" {
-			// Search across the entire To field JSON array using LIKE for SQLite compatibility
-			toPattern := "%" + options.ToQuery + "%"
-			query = query.Where("`to` LIKE ?", toPattern)
+	// Apply tag filter
+	for _, tag := range options.Tags {
+		if strings.TrimSpace(tag) != "" {
+			sql, args := TagCondition(tag)
+			query = query.Where(sql, args...)
 		}
-		if options.CcQuery != "" {
-			// Search across the entire CC field JSON array using LIKE for SQLite compatibility
-			ccPattern := "%" + options.CcQuery + "%"
-			query = query.Where("cc LIKE ?", ccPattern)
-		}
-		if options.SubjectQuery != "" {
-			subjectPattern := "%" + options.SubjectQuery + "%"
-			query = query.Where("subject LIKE ?", subjectPattern)
+	}
+
+	// Gmail-style query
+	rankKeyword := ""
+	if strings.TrimSpace(options.Query) != "" {
+		node, err := searchquery.Parse(options.Query)
+		if err != nil {
+			return nil, "", err
 		}
-		if options.BodyQuery != "" {
-			bodyPattern := "%" + options.BodyQuery + "%"
-			query = query.Where("body LIKE ?", bodyPattern)
+		if node != nil {
+			sql, args := r.compileSearchQuery(node, time.Now())
+			query = query.Where(sql, args...)
+			rankKeyword = strings.Join(searchquery.TextTerms(node), " ")
 		}
-		if options.HTMLQuery != "" {
-			htmlPattern := "%" + options.HTMLQuery + "%"
-			query = query.Where("html_body LIKE ?", htmlPattern)
+	}
+
+	// Keyword search goes through the full-text index and replaces the field filters
+	if options.Keyword != "" {
+		return r.searchIndex.JoinHits(query, options.Keyword), options.Keyword, nil
+	}
+	if rankKeyword != "" && isRelevanceSort(options.SortBy) {
+		query = r.searchIndex.JoinScores(query, rankKeyword)
+	}
+
+	// Individual field searches, addresses go through the normalized email_addresses table
+	if options.FromQuery != "" {
+		sql, args := AddressCondition(options.FromQuery, models.AddressRoleFrom)
+		query = query.Where(sql, args...)
+	}
+	if options.ToQuery != "" {
+		sql, args := AddressCondition(options.ToQuery, models.AddressRoleTo)
+		query = query.Where(sql, args...)
+	}
+	if options.CcQuery != "" {
+		sql, args := AddressCondition(options.CcQuery, models.AddressRoleCc)
+		query = query.Where(sql, args...)
+	}
+	if options.SubjectQuery != "" {
+		subjectPattern := "%" + options.SubjectQuery + "%"
+		query = query.Where("subject LIKE ?", subjectPattern)
+	}
+	if options.BodyQuery != "" {
+		bodyPattern := "%" + options.BodyQuery + "%"
+		query = query.Where("body LIKE ?", bodyPattern)
+	}
+	if options.HTMLQuery != "" {
+		htmlPattern := "%" + options.HTMLQuery + "%"
+		query = query.Where("html_body LIKE ?", htmlPattern)
+	}
+
+	return query, rankKeyword, nil
+}
+
+func isRelevanceSort(sortBy string) bool {
+	return strings.EqualFold(strings.TrimSpace(sortBy), SortByRelevance)
+}
+
+// orderClause resolves the sort option, falling back to date when there is nothing to rank
+func orderClause(options EmailSearchOptions, rankKeyword, fallback string) string {
+	sortBy := strings.TrimSpace(options.SortBy)
+	if isRelevanceSort(sortBy) {
+		if rankKeyword != "" {
+			return "COALESCE(search_hits.score, 0) DESC, emails.date DESC"
 		}
+		return fallback
+	}
+	if sortBy == "" {
+		return fallback
+	}
+	return sortBy
+}
+
+// SearchEmails performs advanced search on emails with multiple criteria
+func (r *EmailRepository) SearchEmails(options EmailSearchOptions) ([]models.Email, int64, error) {
+	result, err := r.SearchEmailsDetailed(options)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result.Emails, result.Total, nil
+}
+
+// SearchEmailsDetailed performs advanced search on emails and returns ranking details for keyword hits
+func (r *EmailRepository) SearchEmailsDetailed(options EmailSearchOptions) (*EmailSearchResult, error) {
+	var emails []models.Email
+	var totalCount int64
+
+	// Build the filtered query
+	query, rankKeyword, err := r.applySearchFilters(r.db.Model(&models.Email{}), options)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get total count for pagination
 	countQuery := query
-	err := countQuery.Count(&totalCount).Error
+	err = countQuery.Count(&totalCount).Error
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// Apply sorting
-	sortBy := options.SortBy
-	if sortBy == "" {
-		sortBy = "date DESC"
+	// Count facets over every match, before sorting and pagination
+	var facets map[string][]models.SearchFacetBucket
+	if len(options.Facets) > 0 {
+		facets, err = r.searchFacets(query, options)
+		if err != nil {
+			return nil, err
+		}
 	}
-	query = query.Order(sortBy)
+
+	// Apply sorting
+	query = query.Order(orderClause(options, rankKeyword, "date DESC"))
 
 	// Apply pagination
 	if options.Limit > 0 {
@@ -327,89 +576,51 @@ func (r *EmailRepository) SearchEmails(options EmailSearchOptions) ([]models.Ema
 	}
 
 	// Execute the query
-	err = query.Find(&emails).Error
-	return emails, totalCount, err
+	if err := query.Preload("Tags").Find(&emails).Error; err != nil {
+		return nil, err
+	}
+
+	result := &EmailSearchResult{Emails: emails, Total: totalCount, Facets: facets}
+	if rankKeyword != "" && options.Highlight {
+		ids := make([]uint, 0, len(emails))
+		for _, email := range emails {
+			ids = append(ids, email.ID)
+		}
+		highlights, err := r.searchIndex.Highlights(rankKeyword, ids)
+		if err != nil {
+			return nil, err
+		}
+		result.Highlights = highlights
+	}
+
+	return result, nil
 }
 
 // EmailCursor represents a cursor for streaming email queries
 type EmailCursor struct {
 	db        *gorm.DB
 	query     *gorm.DB
+	err       error // Error building the query, returned by Next
 	batchSize int
 	lastID    uint
 }
 
-// NewEmailCursor creates a new email cursor for streaming queries
+// NewEmailCursor creates a new email cursor for streaming queries.
+// Emails are returned newest first by ID; options.SortBy, Limit and Offset are ignored.
 func (r *EmailRepository) NewEmailCursor(options EmailSearchOptions, batchSize int) *EmailCursor {
 	if batchSize <= 0 {
 		batchSize = 100 // Default batch size
 	}
 
 	// Build the base query (same as SearchEmails)
-	query := r.db.Model(&models.Email{})
-
-	// Only filter by account ID if it's specified (non-zero)
-	if options.AccountID != 0 {
-		query = query.Where("account_id = ?", options.AccountID)
-	}
-
-	// Apply date range filter
-	if options.StartDate != nil {
-		query = query.Where("date >= ?", *options.StartDate)
-	}
-	if options.EndDate != nil {
-		query = query.Where("date <= ?", *options.EndDate)
-	}
-
-	// Apply mailbox filter
-	if options.MailboxName != "" {
-		query = query.Where("mailbox_name = ?", options.MailboxName)
-	}
-
-	// Apply text search filters
-	if options.Keyword != "" {
-		// Global keyword search across all text fields
-		keywordPattern := "%" + options.Keyword + "%"
-		query = query.Where(
-			"subject LIKE ? OR JSON_EXTRACT(`from`, '$[0]') LIKE ? OR JSON_EXTRACT(`to`, '$[0]') LIKE ? OR JSON_EXTRACT(cc, '$[0]') LIKE ? OR body LIKE ? OR html_body LIKE ?",
-			keywordPattern, keywordPattern, keywordPattern, keywordPattern, keywordPattern, keywordPattern,
-		)
-	} else {
-		// Individual field searches
-		if options.FromQuery != "" {
-			fromPattern := "%" + options.FromQuery + "%"
-			query = query.Where("JSON_EXTRACT(`from`, '$[0]') LIKE ?", fromPattern)
-		}
-		if options.ToQuery != "" {
-			toPattern := "%" + options.ToQuery + "%"
-			query = query.Where("JSON_EXTRACT(`to`, '$[0]') LIKE ?", toPattern)
-		}
-		if options.CcQuery != "" {
-			ccPattern := "%" + options.CcQuery + "%"
-			query = query.Where("JSON_EXTRACT(cc, '$[0]') LIKE ?", ccPattern)
-		}
-		if options.SubjectQuery != "" {
-			subjectPattern := "%" + options.SubjectQuery + "%"
-			query = query.Where("subject LIKE ?", subjectPattern)
-		}
-		if options.BodyQuery != "" {
-			bodyPattern := "%" + options.BodyQuery + "%"
-			query = query.Where("body LIKE ?", bodyPattern)
-		}
-		if options.HTMLQuery != "" {
-			htmlPattern := "%" + options.HTMLQuery + "%"
-			query = query.Where("html_body LIKE ?", htmlPattern)
-		}
+	query, _, err := r.applySearchFilters(r.db.Model(&models.Email{}), options)
+	if err != nil {
+		return &EmailCursor{db: r.db, err: err, batchSize: batchSize}
 	}
 
-	// Apply sorting (always include ID for consistent cursor pagination)
-	sortBy := options.SortBy
-	if sortBy == "" {
-		sortBy = "date DESC, id DESC"
-	} else {
-		sortBy += ", id DESC"
-	}
-	query = query.Order(sortBy)
+	// The cursor pages by ID, so it must also be ordered by ID alone; any other
+	// order would skip emails whose date order differs from their insert order.
+	query = query.Order("emails.id DESC")
 
 	return &EmailCursor{
 		db:        r.db,
@@ -422,11 +633,14 @@ func (r *EmailRepository) NewEmailCursor(options EmailSearchOptions, batchSize i
 // Next fetches the next batch of emails from the cursor
 func (c *EmailCursor) Next() ([]models.Email, error) {
 	var emails []models.Email
+	if c.err != nil {
+		return nil, c.err
+	}
 
 	// Add cursor condition for pagination
 	query := c.query
 	if c.lastID > 0 {
-		query = query.Where("id < ?", c.lastID)
+		query = query.Where("emails.id < ?", c.lastID)
 	}
 
 	err := query.Limit(c.batchSize).Find(&emails).Error
@@ -445,9 +659,12 @@ func (c *EmailCursor) Next() ([]models.Email, error) {
 // HasMore checks if there are more emails to fetch
 func (c *EmailCursor) HasMore() (bool, error) {
 	var count int64
+	if c.err != nil {
+		return false, c.err
+	}
 	query := c.query
 	if c.lastID > 0 {
-		query = query.Where("id < ?", c.lastID)
+		query = query.Where("emails.id < ?", c.lastID)
 	}
 
 	err := query.Limit(1).Count(&count).Error
@@ -485,3 +702,29 @@ func (r *EmailRepository) GetAllMailboxFolders() ([]string, error) {
 	
 	return folders, nil
 }
+
+// LoadAttachments loads the attachments of a batch of emails with a single query
+func (r *EmailRepository) LoadAttachments(emails []models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(emails))
+	for i := range emails {
+		ids[i] = emails[i].ID
+	}
+
+	var attachments []models.Attachment
+	if err := r.db.Where("email_id IN ?", ids).Order("id ASC").Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	byEmail := make(map[uint][]models.Attachment, len(emails))
+	for _, attachment := range attachments {
+		byEmail[attachment.EmailID] = append(byEmail[attachment.EmailID], attachment)
+	}
+	for i := range emails {
+		emails[i].Attachments = byEmail[emails[i].ID]
+	}
+	return nil
+}
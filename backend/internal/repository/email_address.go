@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// AddressCondition matches emails having an address of one of the roles (any
+// role when none is given) that matches value. Full addresses and "@domain"
+// values use the indexes of the email_addresses table; anything else matches
+// a substring of the address or the display name.
+func AddressCondition(value string, roles ...models.AddressRole) (string, []interface{}) {
+	var condition string
+	var args []interface{}
+
+	kind, pattern := models.ClassifyAddressPattern(value)
+	switch kind {
+	case models.AddressPatternExact:
+		condition = "email_addresses.address = ?"
+		args = append(args, pattern)
+	case models.AddressPatternDomain:
+		condition = "email_addresses.domain = ?"
+		args = append(args, pattern)
+	default:
+		condition = "(email_addresses.address LIKE ? ESCAPE '!' OR LOWER(email_addresses.name) LIKE ? ESCAPE '!')"
+		args = append(args, likePattern(pattern), likePattern(pattern))
+	}
+
+	if len(roles) > 0 {
+		condition += " AND email_addresses.role IN ?"
+		args = append(args, roles)
+	}
+	return "emails.id IN (SELECT email_addresses.email_id FROM email_addresses WHERE " + condition + ")", args
+}
+
+// saveAddresses stores the normalized addresses of newly created emails
+func saveAddresses(tx *gorm.DB, emails []models.Email) error {
+	var records []models.EmailAddress
+	for i := range emails {
+		records = append(records, emails[i].AddressRecords()...)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if err := tx.CreateInBatches(records, 500).Error; err != nil {
+		return err
+	}
+	return touchContacts(tx, contactAddressesOfRecords(records))
+}
+
+// replaceAddresses rebuilds the normalized addresses of an updated email
+func replaceAddresses(tx *gorm.DB, email *models.Email) error {
+	previous, err := contactAddressesOf(tx, []uint{email.ID})
+	if err != nil {
+		return err
+	}
+	if err := tx.Where("email_id = ?", email.ID).Delete(&models.EmailAddress{}).Error; err != nil {
+		return err
+	}
+	if err := saveAddresses(tx, []models.Email{*email}); err != nil {
+		return err
+	}
+	// 不再出现在该邮件中的地址需要重新统计
+	return refreshContacts(tx, previous)
+}
+
+// GetAddresses returns the normalized addresses of an email
+func (r *EmailRepository) GetAddresses(emailID uint) ([]models.EmailAddress, error) {
+	var addresses []models.EmailAddress
+	err := r.db.Where("email_id = ?", emailID).Order("role, position").Find(&addresses).Error
+	return addresses, err
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// retentionBatchSize is the number of emails deleted or stripped per statement
+const retentionBatchSize = 500
+
+// MailboxKey identifies a mailbox of an account
+type MailboxKey struct {
+	AccountID   uint   `json:"account_id"`
+	MailboxName string `json:"mailbox_name"`
+}
+
+// RetentionRules are the retention rules applied to the emails of one mailbox
+type RetentionRules struct {
+	DeleteBefore *time.Time // Delete emails dated before
+	StripBefore  *time.Time // Drop the raw message and attachments of emails dated before
+	MaxMessages  int        // Keep at most this many of the newest emails
+}
+
+// ListMailboxKeys returns every mailbox that holds emails
+func (r *EmailRepository) ListMailboxKeys() ([]MailboxKey, error) {
+	var keys []MailboxKey
+	err := r.db.Model(&models.Email{}).
+		Select("DISTINCT account_id, COALESCE(mailbox_name, '') AS mailbox_name").
+		Order("account_id ASC, mailbox_name ASC").
+		Scan(&keys).Error
+	return keys, err
+}
+
+// ApplyRetention enforces the rules on one mailbox. Expired emails are deleted
+// first, then the oldest emails beyond MaxMessages, and finally the content of
+// the remaining emails older than StripBefore is dropped. In a dry run the
+// affected emails are only counted.
+func (r *EmailRepository) ApplyRetention(key MailboxKey, rules RetentionRules, dryRun bool) (RetentionCounts, error) {
+	var counts RetentionCounts
+
+	mailbox := func() *gorm.DB {
+		return r.db.Model(&models.Email{}).Where("account_id = ? AND COALESCE(mailbox_name, '') = ?", key.AccountID, key.MailboxName)
+	}
+	notExpired := func(query *gorm.DB) *gorm.DB {
+		if rules.DeleteBefore != nil {
+			return query.Where("date >= ?", *rules.DeleteBefore)
+		}
+		return query
+	}
+
+	// 1. Emails older than the delete cutoff
+	if rules.DeleteBefore != nil {
+		n, err := r.purge(mailbox().Where("date < ?", *rules.DeleteBefore), dryRun, r.DeleteByIDs)
+		if err != nil {
+			return counts, err
+		}
+		counts.Deleted = n
+	}
+
+	// 2. Emails beyond the newest MaxMessages
+	var beyondLimit func(*gorm.DB) *gorm.DB
+	if rules.MaxMessages > 0 {
+		var boundary struct {
+			ID   uint
+			Date time.Time
+		}
+		result := notExpired(mailbox()).Select("id", "date").
+			Order("date DESC, id DESC").Offset(rules.MaxMessages - 1).Limit(1).Scan(&boundary)
+		if result.Error != nil {
+			return counts, result.Error
+		}
+		if result.RowsAffected > 0 {
+			beyondLimit = func(query *gorm.DB) *gorm.DB {
+				return query.Where("date < ? OR (date = ? AND id < ?)", boundary.Date, boundary.Date, boundary.ID)
+			}
+			n, err := r.purge(beyondLimit(notExpired(mailbox())), dryRun, r.DeleteByIDs)
+			if err != nil {
+				return counts, err
+			}
+			counts.OverLimit = n
+		}
+	}
+
+	// 3. Content of the remaining emails older than the strip cutoff
+	if rules.StripBefore != nil {
+		query := notExpired(mailbox()).
+			Where("date < ?", *rules.StripBefore).
+			Where("(COALESCE(raw_message, '') <> '' OR EXISTS (SELECT 1 FROM attachments WHERE attachments.email_id = emails.id))")
+		if beyondLimit != nil && dryRun {
+			query = query.Not(beyondLimit(r.db))
+		}
+		n, err := r.purge(query, dryRun, r.StripContent)
+		if err != nil {
+			return counts, err
+		}
+		counts.Stripped = n
+	}
+
+	return counts, nil
+}
+
+// purge counts the emails matched by query, or applies action to them batch by batch
+func (r *EmailRepository) purge(query *gorm.DB, dryRun bool, action func(ids []uint) error) (int64, error) {
+	if dryRun {
+		var count int64
+		err := query.Count(&count).Error
+		return count, err
+	}
+
+	var total int64
+	for {
+		var ids []uint
+		if err := query.Session(&gorm.Session{}).Order("id ASC").Limit(retentionBatchSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		if err := action(ids); err != nil {
+			return total, err
+		}
+		total += int64(len(ids))
+	}
+}
+
+// DeleteByIDs permanently deletes emails together with their attachments,
+// trigger execution logs, tags, addresses, extracted values and search index
+// entries, and recomputes the contacts of their addresses
+func (r *EmailRepository) DeleteByIDs(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email_id IN ?", ids).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email_id IN ?", ids).Delete(&models.TriggerExecutionLog{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email_id IN ?", ids).Delete(&models.EmailTag{}).Error; err != nil {
+			return err
+		}
+		addresses, err := contactAddressesOf(tx, ids)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("email_id IN ?", ids).Delete(&models.EmailAddress{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email_id IN ?", ids).Delete(&models.ExtractedValue{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email_id IN ?", ids).Delete(&models.TriggerLedgerEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.Email{}).Error; err != nil {
+			return err
+		}
+		return refreshContacts(tx, addresses)
+	})
+	if err != nil {
+		return err
+	}
+
+	logIndexError("remove emails from index", r.searchIndex.Remove(ids...))
+	return nil
+}
+
+// StripContent drops the raw message and attachments of emails while keeping their metadata
+func (r *EmailRepository) StripContent(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email_id IN ?", ids).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Email{}).Where("id IN ?", ids).Update("raw_message", "").Error
+	})
+}
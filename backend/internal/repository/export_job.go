@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ExportJobRepository handles database operations for export jobs
+type ExportJobRepository struct {
+	db *gorm.DB
+}
+
+// NewExportJobRepository creates a new export job repository
+func NewExportJobRepository(db *gorm.DB) *ExportJobRepository {
+	return &ExportJobRepository{db: db}
+}
+
+// Create creates a new export job
+func (r *ExportJobRepository) Create(job *models.ExportJob) error {
+	return r.db.Create(job).Error
+}
+
+// GetByID returns an export job by ID
+func (r *ExportJobRepository) GetByID(id uint) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := r.db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List returns the most recent export jobs
+func (r *ExportJobRepository) List(limit int) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	query := r.db.Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+// GetByStatus returns export jobs in the given states, oldest first
+func (r *ExportJobRepository) GetByStatus(statuses ...models.ExportJobStatus) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := r.db.Where("status IN ?", statuses).Order("id ASC").Find(&jobs).Error
+	return jobs, err
+}
+
+// GetExpired returns finished export jobs whose files have expired
+func (r *ExportJobRepository) GetExpired(now time.Time) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := r.db.Where("expires_at IS NOT NULL AND expires_at < ?", now).Find(&jobs).Error
+	return jobs, err
+}
+
+// Update saves an export job
+func (r *ExportJobRepository) Update(job *models.ExportJob) error {
+	return r.db.Save(job).Error
+}
+
+// UpdateProgress records the number of emails written so far
+func (r *ExportJobRepository) UpdateProgress(id uint, emailCount int64) error {
+	return r.db.Model(&models.ExportJob{}).Where("id = ?", id).Update("email_count", emailCount).Error
+}
+
+// Delete deletes an export job
+func (r *ExportJobRepository) Delete(id uint) error {
+	return r.db.Delete(&models.ExportJob{}, id).Error
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ExtractedValueFilter selects stored extraction results, zero values match everything
+type ExtractedValueFilter struct {
+	TemplateID uint
+	Field      string
+	EmailID    uint
+	AccountID  uint
+	Value      string     // 与字符串表示完全相同
+	Since      *time.Time // 提取时间下限（含）
+	Until      *time.Time // 提取时间上限（不含）
+}
+
+// Groupings supported by ExtractedValueRepository.Aggregate
+const (
+	ExtractedValueGroupNone     = ""
+	ExtractedValueGroupField    = "field"
+	ExtractedValueGroupValue    = "value"
+	ExtractedValueGroupTemplate = "template"
+	ExtractedValueGroupDay      = "day" // 按提取日期
+)
+
+// ExtractedValueGroup is one group of an aggregation. The numeric statistics
+// only cover number values and are omitted when the group has none.
+type ExtractedValueGroup struct {
+	Key    string   `json:"key"`
+	Count  int64    `json:"count"`
+	Emails int64    `json:"emails"` // 不同邮件的数量
+	Sum    *float64 `json:"sum,omitempty"`
+	Avg    *float64 `json:"avg,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// ExtractedValueRepository stores the named outputs of templates run on emails
+type ExtractedValueRepository struct {
+	db *gorm.DB
+}
+
+// NewExtractedValueRepository creates a new extracted value repository
+func NewExtractedValueRepository(db *gorm.DB) *ExtractedValueRepository {
+	return &ExtractedValueRepository{db: db}
+}
+
+// Replace stores the values a template produced for an email, replacing the
+// values of earlier runs of the same template on the same email
+func (r *ExtractedValueRepository) Replace(emailID, templateID uint, values []models.ExtractedValue) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email_id = ? AND template_id = ?", emailID, templateID).Delete(&models.ExtractedValue{}).Error; err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return tx.Create(&values).Error
+	})
+}
+
+// List returns matching values, most recently extracted first, and the total count
+func (r *ExtractedValueRepository) List(filter ExtractedValueFilter, limit, offset int) ([]models.ExtractedValue, int64, error) {
+	query := r.filtered(filter)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var values []models.ExtractedValue
+	query = query.Order("extracted_values.extracted_at DESC").Order("extracted_values.id DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&values).Error; err != nil {
+		return nil, 0, err
+	}
+	return values, total, nil
+}
+
+// Aggregate counts matching values by group, largest groups first; groups by
+// day are ordered by date instead
+func (r *ExtractedValueRepository) Aggregate(filter ExtractedValueFilter, groupBy string, limit int) ([]ExtractedValueGroup, error) {
+	var key string
+	switch groupBy {
+	case ExtractedValueGroupNone:
+		key = "''"
+	case ExtractedValueGroupField:
+		key = "extracted_values.field"
+	case ExtractedValueGroupValue:
+		key = "extracted_values.value"
+	case ExtractedValueGroupTemplate:
+		key = "extracted_values.template_id"
+	case ExtractedValueGroupDay:
+		key = "DATE(extracted_values.extracted_at)"
+	default:
+		return nil, fmt.Errorf("unsupported group_by %q", groupBy)
+	}
+
+	// 别名避开 key、count 等保留字
+	query := r.filtered(filter).Select(key + " AS group_key, COUNT(*) AS value_count, COUNT(DISTINCT extracted_values.email_id) AS email_count, " +
+		"SUM(extracted_values.number) AS number_sum, AVG(extracted_values.number) AS number_avg, " +
+		"MIN(extracted_values.number) AS number_min, MAX(extracted_values.number) AS number_max")
+	if groupBy != ExtractedValueGroupNone {
+		query = query.Group(key)
+	}
+	if groupBy == ExtractedValueGroupDay {
+		query = query.Order("group_key ASC")
+	} else {
+		query = query.Order("value_count DESC").Order("group_key ASC")
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var rows []struct {
+		GroupKey   string
+		ValueCount int64
+		EmailCount int64
+		NumberSum  *float64
+		NumberAvg  *float64
+		NumberMin  *float64
+		NumberMax  *float64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	groups := make([]ExtractedValueGroup, 0, len(rows))
+	for _, row := range rows {
+		if row.ValueCount == 0 {
+			continue // 没有分组时，空结果集也会返回一行
+		}
+		if groupBy == ExtractedValueGroupDay && len(row.GroupKey) > 10 {
+			row.GroupKey = row.GroupKey[:10] // MySQL 和 PostgreSQL 返回的是时间
+		}
+		groups = append(groups, ExtractedValueGroup{
+			Key:    row.GroupKey,
+			Count:  row.ValueCount,
+			Emails: row.EmailCount,
+			Sum:    row.NumberSum,
+			Avg:    row.NumberAvg,
+			Min:    row.NumberMin,
+			Max:    row.NumberMax,
+		})
+	}
+	return groups, nil
+}
+
+// filtered returns a query of the values matching the filter
+func (r *ExtractedValueRepository) filtered(filter ExtractedValueFilter) *gorm.DB {
+	query := r.db.Model(&models.ExtractedValue{})
+	if filter.TemplateID != 0 {
+		query = query.Where("extracted_values.template_id = ?", filter.TemplateID)
+	}
+	if filter.Field != "" {
+		query = query.Where("extracted_values.field = ?", filter.Field)
+	}
+	if filter.EmailID != 0 {
+		query = query.Where("extracted_values.email_id = ?", filter.EmailID)
+	}
+	if filter.AccountID != 0 {
+		query = query.Where("extracted_values.email_id IN (?)",
+			r.db.Model(&models.Email{}).Select("id").Where("account_id = ?", filter.AccountID))
+	}
+	if filter.Value != "" {
+		query = query.Where("extracted_values.value = ?", filter.Value)
+	}
+	if filter.Since != nil {
+		query = query.Where("extracted_values.extracted_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("extracted_values.extracted_at < ?", *filter.Until)
+	}
+	return query
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ExtractionPipelineRepository handles database operations for extraction pipelines
+type ExtractionPipelineRepository struct {
+	db *gorm.DB
+}
+
+// NewExtractionPipelineRepository creates a new ExtractionPipelineRepository
+func NewExtractionPipelineRepository(db *gorm.DB) *ExtractionPipelineRepository {
+	return &ExtractionPipelineRepository{db: db}
+}
+
+// Create creates a pipeline that starts after the newest stored email, so
+// that only emails arriving from now on are processed
+func (r *ExtractionPipelineRepository) Create(pipeline *models.ExtractionPipeline) error {
+	lastEmailID, err := r.MaxEmailID()
+	if err != nil {
+		return err
+	}
+	pipeline.LastEmailID = lastEmailID
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		enabled := pipeline.Enabled
+		if err := tx.Create(pipeline).Error; err != nil {
+			return err
+		}
+		// Create 会把零值的 enabled 替换为默认值 true
+		if !enabled {
+			pipeline.Enabled = false
+			return tx.Model(pipeline).UpdateColumn("enabled", false).Error
+		}
+		return nil
+	})
+}
+
+// GetByID retrieves a pipeline by ID
+func (r *ExtractionPipelineRepository) GetByID(id uint) (*models.ExtractionPipeline, error) {
+	var pipeline models.ExtractionPipeline
+	if err := r.db.First(&pipeline, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("extraction pipeline not found")
+		}
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// GetByName retrieves a pipeline by name
+func (r *ExtractionPipelineRepository) GetByName(name string) (*models.ExtractionPipeline, error) {
+	var pipeline models.ExtractionPipeline
+	if err := r.db.Where("name = ?", name).First(&pipeline).Error; err != nil {
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// GetAll retrieves all pipelines, optionally only those of one template
+func (r *ExtractionPipelineRepository) GetAll(templateID uint) ([]models.ExtractionPipeline, error) {
+	var pipelines []models.ExtractionPipeline
+	query := r.db.Order("id ASC")
+	if templateID > 0 {
+		query = query.Where("template_id = ?", templateID)
+	}
+	err := query.Find(&pipelines).Error
+	return pipelines, err
+}
+
+// ListEnabled retrieves the enabled pipelines
+func (r *ExtractionPipelineRepository) ListEnabled() ([]models.ExtractionPipeline, error) {
+	var pipelines []models.ExtractionPipeline
+	err := r.db.Where("enabled = ?", true).Order("id ASC").Find(&pipelines).Error
+	return pipelines, err
+}
+
+// Update saves the configuration of a pipeline; progress and statistics are
+// only changed by the pipeline service
+func (r *ExtractionPipelineRepository) Update(pipeline *models.ExtractionPipeline) error {
+	return r.db.Model(pipeline).
+		Select("name", "description", "template_id", "enabled", "account_ids", "alias_patterns",
+			"sender_domains", "mailboxes", "query", "webhook_url", "webhook_secret", "updated_at").
+		Updates(pipeline).Error
+}
+
+// Delete deletes a pipeline, the values it extracted are kept
+func (r *ExtractionPipelineRepository) Delete(id uint) error {
+	return r.db.Delete(&models.ExtractionPipeline{}, id).Error
+}
+
+// MaxEmailID returns the ID of the newest stored email
+func (r *ExtractionPipelineRepository) MaxEmailID() (uint, error) {
+	return latestEmailID(r.db)
+}
+
+// SettledEmailID returns the highest email ID a pipeline cursor may move past,
+// see EmailVisibilityLag
+func (r *ExtractionPipelineRepository) SettledEmailID(now time.Time) (uint, error) {
+	return settledEmailID(r.db, now.Add(-EmailVisibilityLag))
+}
+
+// PendingEmails returns up to limit emails with an ID in (afterID, untilID],
+// oldest first. The account scope of the pipeline is applied in the query,
+// the other scopes are matched by the caller.
+func (r *ExtractionPipelineRepository) PendingEmails(pipeline *models.ExtractionPipeline, afterID, untilID uint, limit int) ([]models.Email, error) {
+	var emails []models.Email
+	query := r.db.Preload("Account").Preload("Tags").
+		Where("id > ? AND id <= ?", afterID, untilID).
+		Order("id ASC").
+		Limit(limit)
+	if len(pipeline.AccountIDs) > 0 {
+		query = query.Where("account_id IN ?", pipeline.AccountIDs)
+	}
+	err := query.Find(&emails).Error
+	return emails, err
+}
+
+// Advance moves the cursor of a pipeline past the processed emails and adds
+// to its statistics. lastError replaces the recorded error of earlier runs.
+func (r *ExtractionPipelineRepository) Advance(id, lastEmailID uint, processed, extracted int64, lastError string) error {
+	return r.db.Model(&models.ExtractionPipeline{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"last_email_id":   lastEmailID,
+		"processed_count": gorm.Expr("processed_count + ?", processed),
+		"extracted_count": gorm.Expr("extracted_count + ?", extracted),
+		"last_run_at":     time.Now(),
+		"last_error":      lastError,
+	}).Error
+}
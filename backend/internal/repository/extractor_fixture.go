@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrExtractorFixtureNotFound is returned for an unknown fixture of a template
+var ErrExtractorFixtureNotFound = errors.New("extractor fixture not found")
+
+// ExtractorFixtureRepository handles the regression fixtures of extractor templates
+type ExtractorFixtureRepository struct {
+	db *gorm.DB
+}
+
+// NewExtractorFixtureRepository creates a new extractor fixture repository
+func NewExtractorFixtureRepository(db *gorm.DB) *ExtractorFixtureRepository {
+	return &ExtractorFixtureRepository{db: db}
+}
+
+// Create creates a fixture
+func (r *ExtractorFixtureRepository) Create(fixture *models.ExtractorFixture) error {
+	return r.db.Create(fixture).Error
+}
+
+// Update saves a fixture
+func (r *ExtractorFixtureRepository) Update(fixture *models.ExtractorFixture) error {
+	return r.db.Save(fixture).Error
+}
+
+// Delete removes a fixture of a template
+func (r *ExtractorFixtureRepository) Delete(templateID, id uint) error {
+	result := r.db.Where("template_id = ?", templateID).Delete(&models.ExtractorFixture{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrExtractorFixtureNotFound
+	}
+	return nil
+}
+
+// Get returns a fixture of a template
+func (r *ExtractorFixtureRepository) Get(templateID, id uint) (*models.ExtractorFixture, error) {
+	var fixture models.ExtractorFixture
+	err := r.db.Where("template_id = ?", templateID).First(&fixture, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExtractorFixtureNotFound
+		}
+		return nil, err
+	}
+	return &fixture, nil
+}
+
+// ListByTemplate returns the fixtures of a template in creation order
+func (r *ExtractorFixtureRepository) ListByTemplate(templateID uint) ([]models.ExtractorFixture, error) {
+	var fixtures []models.ExtractorFixture
+	err := r.db.Where("template_id = ?", templateID).Order("id ASC").Find(&fixtures).Error
+	return fixtures, err
+}
+
+// TemplatesRunWithOtherBuiltins returns the templates having fixtures last
+// run with a different set of builtin extractor versions
+func (r *ExtractorFixtureRepository) TemplatesRunWithOtherBuiltins(builtins string) ([]uint, error) {
+	var templateIDs []uint
+	err := r.db.Model(&models.ExtractorFixture{}).
+		Where("last_builtins <> ? OR last_builtins IS NULL", builtins).
+		Distinct().Pluck("template_id", &templateIDs).Error
+	return templateIDs, err
+}
+
+// SaveResult records the outcome of the last run of a fixture
+func (r *ExtractorFixtureRepository) SaveResult(id uint, status, builtins string, runAt time.Time) error {
+	return r.db.Model(&models.ExtractorFixture{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"last_status":   status,
+		"last_run_at":   runAt,
+		"last_builtins": builtins,
+	}).Error
+}
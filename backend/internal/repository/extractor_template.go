@@ -2,6 +2,7 @@ package repository
 
 import (
 	"errors"
+	"fmt"
 	"mailman/internal/models"
 
 	"gorm.io/gorm"
@@ -17,9 +18,19 @@ func NewExtractorTemplateRepository(db *gorm.DB) *ExtractorTemplateRepository {
 	return &ExtractorTemplateRepository{db: db}
 }
 
-// Create creates a new extractor template
-func (r *ExtractorTemplateRepository) Create(template *models.ExtractorTemplate) error {
-	return r.db.Create(template).Error
+// ErrExtractorRevisionNotFound is returned for an unknown revision of a template
+var ErrExtractorRevisionNotFound = errors.New("extractor template revision not found")
+
+// Create creates a new extractor template together with its first revision.
+// author may be nil, e.g. when authentication is disabled.
+func (r *ExtractorTemplateRepository) Create(template *models.ExtractorTemplate, author *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		template.Revision = 1
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+		return createRevision(tx, template, author, "")
+	})
 }
 
 // GetByID retrieves an extractor template by ID
@@ -55,9 +66,91 @@ func (r *ExtractorTemplateRepository) GetAll() ([]models.ExtractorTemplate, erro
 	return templates, err
 }
 
-// Update updates an existing extractor template
-func (r *ExtractorTemplateRepository) Update(template *models.ExtractorTemplate) error {
-	return r.db.Save(template).Error
+// Update saves an existing extractor template as a new revision
+func (r *ExtractorTemplateRepository) Update(template *models.ExtractorTemplate, author *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return saveRevision(tx, template, author, "")
+	})
+}
+
+// Restore makes the content of an earlier revision current again. The
+// restore is recorded as a new revision, history is never rewritten.
+func (r *ExtractorTemplateRepository) Restore(id uint, revision int, author *models.User) (*models.ExtractorTemplate, error) {
+	template, err := r.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	source, err := r.GetRevision(id, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	template.Name = source.Name
+	template.Description = source.Description
+	template.Extractors = source.Extractors
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		return saveRevision(tx, template, author, fmt.Sprintf("restored from revision %d", revision))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// ListRevisions returns the revisions of a template, newest first
+func (r *ExtractorTemplateRepository) ListRevisions(templateID uint) ([]models.ExtractorTemplateRevision, error) {
+	var revisions []models.ExtractorTemplateRevision
+	err := r.db.Where("template_id = ?", templateID).Order("revision DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// GetRevision returns one revision of a template
+func (r *ExtractorTemplateRepository) GetRevision(templateID uint, revision int) (*models.ExtractorTemplateRevision, error) {
+	var result models.ExtractorTemplateRevision
+	err := r.db.Where("template_id = ? AND revision = ?", templateID, revision).First(&result).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExtractorRevisionNotFound
+		}
+		return nil, err
+	}
+	return &result, nil
+}
+
+// saveRevision stores the template and records its content as the next revision
+func saveRevision(tx *gorm.DB, template *models.ExtractorTemplate, author *models.User, message string) error {
+	var latest int
+	err := tx.Model(&models.ExtractorTemplateRevision{}).
+		Where("template_id = ?", template.ID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error
+	if err != nil {
+		return err
+	}
+	if template.Revision > latest {
+		latest = template.Revision
+	}
+	template.Revision = latest + 1
+	if err := tx.Save(template).Error; err != nil {
+		return err
+	}
+	return createRevision(tx, template, author, message)
+}
+
+// createRevision records the current content of a template as revision template.Revision
+func createRevision(tx *gorm.DB, template *models.ExtractorTemplate, author *models.User, message string) error {
+	revision := &models.ExtractorTemplateRevision{
+		TemplateID:  template.ID,
+		Revision:    template.Revision,
+		Name:        template.Name,
+		Description: template.Description,
+		Extractors:  template.Extractors,
+		Message:     message,
+	}
+	if author != nil {
+		revision.AuthorID = &author.ID
+		revision.Author = author.Username
+	}
+	return tx.Create(revision).Error
 }
 
 // Delete soft deletes an extractor template
@@ -65,9 +158,23 @@ func (r *ExtractorTemplateRepository) Delete(id uint) error {
 	return r.db.Delete(&models.ExtractorTemplate{}, id).Error
 }
 
-// HardDelete permanently deletes an extractor template
+// HardDelete permanently deletes an extractor template, its revisions, fixtures and extracted values
 func (r *ExtractorTemplateRepository) HardDelete(id uint) error {
-	return r.db.Unscoped().Delete(&models.ExtractorTemplate{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", id).Delete(&models.ExtractorTemplateRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", id).Delete(&models.ExtractorFixture{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", id).Delete(&models.ExtractedValue{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", id).Delete(&models.ExtractionPipeline{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.ExtractorTemplate{}, id).Error
+	})
 }
 
 // GetAllPaginated retrieves extractor templates with pagination and search
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// RetentionCounts reports how many records a retention run removed, or would remove in a dry run
+type RetentionCounts struct {
+	Deleted   int64 `json:"deleted"`    // Older than the delete cutoff
+	OverLimit int64 `json:"over_limit"` // Beyond the maximum number of records
+	Stripped  int64 `json:"stripped"`   // Raw message and attachments dropped, metadata kept
+}
+
+// Total returns the number of affected records
+func (c RetentionCounts) Total() int64 {
+	return c.Deleted + c.OverLimit + c.Stripped
+}
+
+// RetentionPolicyRepository handles database operations for retention policies
+type RetentionPolicyRepository struct {
+	db *gorm.DB
+}
+
+// NewRetentionPolicyRepository creates a new retention policy repository
+func NewRetentionPolicyRepository(db *gorm.DB) *RetentionPolicyRepository {
+	return &RetentionPolicyRepository{db: db}
+}
+
+// Create creates a new retention policy
+func (r *RetentionPolicyRepository) Create(policy *models.RetentionPolicy) error {
+	return r.db.Create(policy).Error
+}
+
+// GetByID returns a retention policy by ID
+func (r *RetentionPolicyRepository) GetByID(id uint) (*models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+	if err := r.db.First(&policy, id).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// List returns all retention policies
+func (r *RetentionPolicyRepository) List() ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	err := r.db.Order("target ASC, scope ASC, id ASC").Find(&policies).Error
+	return policies, err
+}
+
+// GetEnabled returns all enabled retention policies
+func (r *RetentionPolicyRepository) GetEnabled() ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	err := r.db.Where("enabled = ?", true).Order("id ASC").Find(&policies).Error
+	return policies, err
+}
+
+// Update updates an existing retention policy
+func (r *RetentionPolicyRepository) Update(policy *models.RetentionPolicy) error {
+	return r.db.Save(policy).Error
+}
+
+// UpdateRunStats records the outcome of the last enforcement run
+func (r *RetentionPolicyRepository) UpdateRunStats(id uint, runAt time.Time, purged int64) error {
+	return r.db.Model(&models.RetentionPolicy{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_run_at": runAt,
+		"last_purged": purged,
+	}).Error
+}
+
+// Delete deletes a retention policy
+func (r *RetentionPolicyRepository) Delete(id uint) error {
+	return r.db.Delete(&models.RetentionPolicy{}, id).Error
+}
+
+// applyLogRetention deletes rows of a log table created before a cutoff and
+// beyond the newest maxRows rows. In a dry run the rows are only counted.
+func applyLogRetention(db *gorm.DB, model interface{}, deleteBefore *time.Time, maxRows int, dryRun bool) (RetentionCounts, error) {
+	var counts RetentionCounts
+
+	if deleteBefore != nil {
+		query := db.Model(model).Where("created_at < ?", *deleteBefore)
+		if dryRun {
+			if err := query.Count(&counts.Deleted).Error; err != nil {
+				return counts, err
+			}
+		} else {
+			result := query.Delete(model)
+			if result.Error != nil {
+				return counts, result.Error
+			}
+			counts.Deleted = result.RowsAffected
+		}
+	}
+
+	if maxRows > 0 {
+		// The oldest row that is still kept
+		query := db.Model(model)
+		if deleteBefore != nil {
+			query = query.Where("created_at >= ?", *deleteBefore)
+		}
+		var boundary struct {
+			ID        uint
+			CreatedAt time.Time
+		}
+		result := query.Select("id", "created_at").Order("created_at DESC, id DESC").Offset(maxRows - 1).Limit(1).Scan(&boundary)
+		if result.Error != nil {
+			return counts, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return counts, nil
+		}
+
+		beyond := db.Model(model).Where("created_at < ? OR (created_at = ? AND id < ?)", boundary.CreatedAt, boundary.CreatedAt, boundary.ID)
+		if deleteBefore != nil {
+			beyond = beyond.Where("created_at >= ?", *deleteBefore)
+		}
+		if dryRun {
+			if err := beyond.Count(&counts.OverLimit).Error; err != nil {
+				return counts, err
+			}
+		} else {
+			result := beyond.Delete(model)
+			if result.Error != nil {
+				return counts, result.Error
+			}
+			counts.OverLimit = result.RowsAffected
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SavedSearchRepository handles database operations for saved searches
+type SavedSearchRepository struct {
+	db *gorm.DB
+}
+
+// NewSavedSearchRepository creates a new saved search repository
+func NewSavedSearchRepository(db *gorm.DB) *SavedSearchRepository {
+	return &SavedSearchRepository{db: db}
+}
+
+// Create creates a new saved search
+func (r *SavedSearchRepository) Create(search *models.SavedSearch) error {
+	return r.db.Create(search).Error
+}
+
+// GetByID returns a saved search by ID
+func (r *SavedSearchRepository) GetByID(id uint) (*models.SavedSearch, error) {
+	var search models.SavedSearch
+	if err := r.db.First(&search, id).Error; err != nil {
+		return nil, err
+	}
+	return &search, nil
+}
+
+// GetByName returns a saved search by name
+func (r *SavedSearchRepository) GetByName(name string) (*models.SavedSearch, error) {
+	var search models.SavedSearch
+	if err := r.db.Where("name = ?", name).First(&search).Error; err != nil {
+		return nil, err
+	}
+	return &search, nil
+}
+
+// List returns all saved searches ordered by name
+func (r *SavedSearchRepository) List() ([]models.SavedSearch, error) {
+	var searches []models.SavedSearch
+	err := r.db.Order("name ASC").Find(&searches).Error
+	return searches, err
+}
+
+// Update updates an existing saved search
+func (r *SavedSearchRepository) Update(search *models.SavedSearch) error {
+	return r.db.Save(search).Error
+}
+
+// Delete deletes a saved search
+func (r *SavedSearchRepository) Delete(id uint) error {
+	return r.db.Delete(&models.SavedSearch{}, id).Error
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Facets that can be requested through EmailSearchOptions.Facets
+const (
+	FacetAccount       = "account"
+	FacetMailbox       = "mailbox"
+	FacetSenderDomain  = "sender_domain"
+	FacetDate          = "date"
+	FacetHasAttachment = "has_attachment"
+	FacetReadState     = "read_state"
+)
+
+// Date facet bucket sizes
+const (
+	FacetIntervalDay   = "day"
+	FacetIntervalWeek  = "week"
+	FacetIntervalMonth = "month"
+)
+
+// defaultFacetLimit caps the number of buckets returned per facet
+const defaultFacetLimit = 20
+
+// ValidFacets lists the facet names in response order
+var ValidFacets = []string{FacetAccount, FacetMailbox, FacetSenderDomain, FacetDate, FacetHasAttachment, FacetReadState}
+
+// IsValidFacet reports whether name is a supported facet
+func IsValidFacet(name string) bool {
+	for _, facet := range ValidFacets {
+		if facet == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidFacetInterval reports whether interval is a supported date bucket size
+func IsValidFacetInterval(interval string) bool {
+	return interval == "" || interval == FacetIntervalDay || interval == FacetIntervalWeek || interval == FacetIntervalMonth
+}
+
+// searchFacets counts the emails matched by filtered per value of every requested facet
+func (r *EmailRepository) searchFacets(filtered *gorm.DB, options EmailSearchOptions) (map[string][]models.SearchFacetBucket, error) {
+	limit := options.FacetLimit
+	if limit <= 0 {
+		limit = defaultFacetLimit
+	}
+
+	matched := filtered.Session(&gorm.Session{}).Select("emails.id")
+	facets := make(map[string][]models.SearchFacetBucket, len(options.Facets))
+
+	for _, facet := range options.Facets {
+		if _, done := facets[facet]; done {
+			continue
+		}
+
+		expr, join, orderByValue, err := r.facetExpression(facet, options.FacetInterval)
+		if err != nil {
+			return nil, err
+		}
+
+		query := r.db.Table("emails").
+			Select(expr+" AS value, COUNT(*) AS count").
+			Where("emails.id IN (?)", matched).
+			Group(expr).
+			Limit(limit)
+		if join != "" {
+			query = query.Joins(join)
+		}
+		if orderByValue {
+			query = query.Order("value DESC")
+		} else {
+			query = query.Order("count DESC")
+		}
+
+		var buckets []models.SearchFacetBucket
+		if err := query.Scan(&buckets).Error; err != nil {
+			return nil, fmt.Errorf("failed to compute %s facet: %w", facet, err)
+		}
+		if buckets == nil {
+			buckets = []models.SearchFacetBucket{}
+		}
+
+		if facet == FacetAccount {
+			if err := r.labelAccountBuckets(buckets); err != nil {
+				return nil, err
+			}
+		}
+		facets[facet] = buckets
+	}
+
+	return facets, nil
+}
+
+// facetExpression returns the grouping expression of a facet, an optional join
+// and whether buckets are ordered by value (dates) instead of by count
+func (r *EmailRepository) facetExpression(facet, interval string) (string, string, bool, error) {
+	c := &queryCompiler{db: r.db, index: r.searchIndex}
+
+	switch facet {
+	case FacetAccount:
+		return c.column("account_id"), "", false, nil
+
+	case FacetMailbox:
+		return "COALESCE(" + c.column("mailbox_name") + ", '')", "", false, nil
+
+	case FacetSenderDomain:
+		// The sender domain is kept on the search document of every indexed email
+		return "COALESCE(email_search_documents.sender_domain, '')",
+			"LEFT JOIN email_search_documents ON email_search_documents.email_id = emails.id", false, nil
+
+	case FacetDate:
+		return r.dateBucketExpression(c.column("date"), interval), "", true, nil
+
+	case FacetHasAttachment:
+		return "CASE WHEN EXISTS (SELECT 1 FROM attachments WHERE attachments.email_id = emails.id) THEN 'true' ELSE 'false' END",
+			"", false, nil
+
+	case FacetReadState:
+		return "CASE WHEN " + c.column("is_read") + " THEN 'read' ELSE 'unread' END", "", false, nil
+	}
+
+	return "", "", false, fmt.Errorf("unknown facet %q", facet)
+}
+
+// dateBucketExpression truncates a date column to the start of its day, week
+// (starting on Monday) or month, formatted as YYYY-MM-DD or YYYY-MM
+func (r *EmailRepository) dateBucketExpression(column, interval string) string {
+	switch r.db.Dialector.Name() {
+	case "postgres":
+		switch interval {
+		case FacetIntervalWeek:
+			return "to_char(date_trunc('week', " + column + "), 'YYYY-MM-DD')"
+		case FacetIntervalMonth:
+			return "to_char(" + column + ", 'YYYY-MM')"
+		}
+		return "to_char(" + column + ", 'YYYY-MM-DD')"
+
+	case "mysql":
+		switch interval {
+		case FacetIntervalWeek:
+			return "DATE_FORMAT(DATE_SUB(" + column + ", INTERVAL WEEKDAY(" + column + ") DAY), '%Y-%m-%d')"
+		case FacetIntervalMonth:
+			return "DATE_FORMAT(" + column + ", '%Y-%m')"
+		}
+		return "DATE_FORMAT(" + column + ", '%Y-%m-%d')"
+	}
+
+	// SQLite
+	switch interval {
+	case FacetIntervalWeek:
+		return "date(" + column + ", 'weekday 0', '-6 days')"
+	case FacetIntervalMonth:
+		return "strftime('%Y-%m', " + column + ")"
+	}
+	return "date(" + column + ")"
+}
+
+// labelAccountBuckets fills in the account address of account facet buckets
+func (r *EmailRepository) labelAccountBuckets(buckets []models.SearchFacetBucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(buckets))
+	for _, bucket := range buckets {
+		if id, err := strconv.ParseUint(bucket.Value, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+
+	var accounts []models.EmailAccount
+	if err := r.db.Select("id", "email_address").Where("id IN ?", ids).Find(&accounts).Error; err != nil {
+		return fmt.Errorf("failed to label account facet: %w", err)
+	}
+
+	addresses := make(map[string]string, len(accounts))
+	for _, account := range accounts {
+		addresses[strconv.FormatUint(uint64(account.ID), 10)] = account.EmailAddress
+	}
+	for i := range buckets {
+		buckets[i].Label = addresses[buckets[i].Value]
+	}
+	return nil
+}
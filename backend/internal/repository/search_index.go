@@ -0,0 +1,559 @@
+package repository
+
+import (
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"mailman/internal/models"
+	"mailman/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxIndexedContentBytes keeps documents inside the TEXT column limit of every dialect
+	maxIndexedContentBytes = 60000
+
+	// highlightStart/highlightEnd are sentinels emitted by the database highlighters.
+	// They are replaced by <mark> tags after the surrounding text has been HTML escaped.
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+// SearchIndex maintains the full-text index of emails and answers ranked keyword queries.
+// It uses FTS5 on SQLite, a tsvector/GIN index on Postgres and a FULLTEXT index on MySQL.
+// When none of these is available it degrades to LIKE matching on the search documents.
+type SearchIndex struct {
+	db                     *gorm.DB
+	includeAttachmentNames bool
+
+	fts5Once sync.Once
+	fts5     bool
+}
+
+// NewSearchIndex creates a new SearchIndex
+func NewSearchIndex(db *gorm.DB) *SearchIndex {
+	return &SearchIndex{db: db}
+}
+
+// SetIncludeAttachmentNames controls whether attachment filenames are indexed
+func (i *SearchIndex) SetIncludeAttachmentNames(enabled bool) {
+	i.includeAttachmentNames = enabled
+}
+
+// hasFTS5 reports whether the SQLite FTS5 table was created by the migration
+func (i *SearchIndex) hasFTS5() bool {
+	i.fts5Once.Do(func() {
+		if i.db.Dialector.Name() != "sqlite" {
+			return
+		}
+		var count int64
+		i.db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'email_search_fts'").Scan(&count)
+		i.fts5 = count > 0
+	})
+	return i.fts5
+}
+
+// BuildSearchDocument derives the indexed text of an email
+func BuildSearchDocument(email *models.Email, includeAttachmentNames bool) models.EmailSearchDocument {
+	var addresses []string
+	addresses = append(addresses, email.From...)
+	addresses = append(addresses, email.To...)
+	addresses = append(addresses, email.Cc...)
+	addresses = append(addresses, email.Bcc...)
+
+	content := email.Body
+	if strings.TrimSpace(content) == "" {
+		content = utils.HTMLToText(email.HTMLBody)
+	}
+	// 附件中提取的文本接在正文之后，正文过长时可能被截断
+	for _, attachment := range email.Attachments {
+		if attachment.Text != "" {
+			content += "\n" + attachment.Text
+		}
+	}
+
+	doc := models.EmailSearchDocument{
+		EmailID:   email.ID,
+		AccountID: email.AccountID,
+		Subject:   email.Subject,
+		Addresses: strings.Join(addresses, " "),
+		Content:   truncateUTF8(content, maxIndexedContentBytes),
+		IndexedAt: time.Now(),
+	}
+
+	if len(email.From) > 0 {
+		doc.SenderDomain = addressDomain(email.From[0])
+	}
+
+	if includeAttachmentNames {
+		names := make([]string, 0, len(email.Attachments))
+		for _, attachment := range email.Attachments {
+			names = append(names, attachment.Filename)
+		}
+		doc.AttachmentNames = strings.Join(names, " ")
+	}
+
+	return doc
+}
+
+// IndexEmails adds or refreshes the index entries of the given emails
+func (i *SearchIndex) IndexEmails(emails []models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	docs := make([]models.EmailSearchDocument, 0, len(emails))
+	ids := make([]uint, 0, len(emails))
+	for idx := range emails {
+		if emails[idx].ID == 0 {
+			continue
+		}
+		docs = append(docs, BuildSearchDocument(&emails[idx], i.includeAttachmentNames))
+		ids = append(ids, emails[idx].ID)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(docs, 100).Error; err != nil {
+			return err
+		}
+
+		if !i.hasFTS5() {
+			return nil
+		}
+
+		if err := tx.Exec("DELETE FROM email_search_fts WHERE rowid IN ?", ids).Error; err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := tx.Exec(
+				"INSERT INTO email_search_fts (rowid, subject, addresses, content, attachment_names) VALUES (?, ?, ?, ?, ?)",
+				doc.EmailID, doc.Subject, doc.Addresses, doc.Content, doc.AttachmentNames,
+			).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Remove deletes the index entries of the given emails
+func (i *SearchIndex) Remove(ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if i.hasFTS5() {
+		if err := i.db.Exec("DELETE FROM email_search_fts WHERE rowid IN ?", ids).Error; err != nil {
+			return err
+		}
+	}
+	return i.db.Where("email_id IN ?", ids).Delete(&models.EmailSearchDocument{}).Error
+}
+
+// RemoveByAccount deletes the index entries of every email of an account
+func (i *SearchIndex) RemoveByAccount(accountID uint) error {
+	if i.hasFTS5() {
+		if err := i.db.Exec(
+			"DELETE FROM email_search_fts WHERE rowid IN (SELECT email_id FROM email_search_documents WHERE account_id = ?)",
+			accountID,
+		).Error; err != nil {
+			return err
+		}
+	}
+	return i.db.Where("account_id = ?", accountID).Delete(&models.EmailSearchDocument{}).Error
+}
+
+// Backfill indexes every email that has no search document yet and returns how many were indexed
+func (i *SearchIndex) Backfill(batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 200
+	}
+
+	indexed := 0
+	var lastID uint
+	for {
+		var emails []models.Email
+		err := i.db.Omit("raw_message").
+			Preload("Attachments", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id", "email_id", "filename", "text")
+			}).
+			Where("id > ? AND id NOT IN (SELECT email_id FROM email_search_documents)", lastID).
+			Order("id ASC").
+			Limit(batchSize).
+			Find(&emails).Error
+		if err != nil {
+			return indexed, err
+		}
+		if len(emails) == 0 {
+			return indexed, nil
+		}
+
+		if err := i.IndexEmails(emails); err != nil {
+			return indexed, err
+		}
+		indexed += len(emails)
+		lastID = emails[len(emails)-1].ID
+	}
+}
+
+// Reindex refreshes the index entries of the given emails from the database,
+// used when derived data such as attachment text changes after ingest
+func (i *SearchIndex) Reindex(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var emails []models.Email
+	err := i.db.Omit("raw_message").
+		Preload("Attachments", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "email_id", "filename", "text")
+		}).
+		Where("id IN ?", ids).
+		Find(&emails).Error
+	if err != nil {
+		return err
+	}
+	return i.IndexEmails(emails)
+}
+
+// Rebuild drops every index entry and indexes all emails again
+func (i *SearchIndex) Rebuild(batchSize int) (int, error) {
+	if i.hasFTS5() {
+		if err := i.db.Exec("DELETE FROM email_search_fts").Error; err != nil {
+			return 0, err
+		}
+	}
+	if err := i.db.Where("1 = 1").Delete(&models.EmailSearchDocument{}).Error; err != nil {
+		return 0, err
+	}
+	return i.Backfill(batchSize)
+}
+
+// JoinHits restricts an emails query to keyword hits and exposes their relevance
+// as search_hits.score (higher is better)
+func (i *SearchIndex) JoinHits(query *gorm.DB, keyword string) *gorm.DB {
+	sql, args := i.hitsQuery(keyword)
+	return query.Joins("JOIN ("+sql+") search_hits ON search_hits.email_id = emails.id", args...)
+}
+
+// JoinScores exposes keyword relevance as search_hits.score without restricting
+// the query, emails that do not hit the keyword have a NULL score
+func (i *SearchIndex) JoinScores(query *gorm.DB, keyword string) *gorm.DB {
+	sql, args := i.hitsQuery(keyword)
+	return query.Joins("LEFT JOIN ("+sql+") search_hits ON search_hits.email_id = emails.id", args...)
+}
+
+// MatchCondition returns a WHERE condition selecting the emails that hit a keyword
+func (i *SearchIndex) MatchCondition(keyword string) (string, []interface{}) {
+	sql, args := i.hitsQuery(keyword)
+	return "emails.id IN (SELECT email_id FROM (" + sql + ") text_hits)", args
+}
+
+// hitsQuery returns a query producing (email_id, score) rows for a keyword
+func (i *SearchIndex) hitsQuery(keyword string) (string, []interface{}) {
+	terms := searchTerms(keyword)
+
+	switch {
+	case i.hasFTS5():
+		return "SELECT rowid AS email_id, -bm25(email_search_fts, 10.0, 5.0, 1.0, 2.0) AS score FROM email_search_fts WHERE email_search_fts MATCH ?",
+			[]interface{}{fts5Query(terms)}
+
+	case i.db.Dialector.Name() == "postgres":
+		return "SELECT email_id, ts_rank(search_vector, websearch_to_tsquery('simple', ?)) AS score FROM email_search_documents WHERE search_vector @@ websearch_to_tsquery('simple', ?)",
+			[]interface{}{keyword, keyword}
+
+	case i.db.Dialector.Name() == "mysql":
+		query := mysqlBooleanQuery(terms)
+		return "SELECT email_id, MATCH(subject, addresses, content, attachment_names) AGAINST (? IN BOOLEAN MODE) AS score FROM email_search_documents WHERE MATCH(subject, addresses, content, attachment_names) AGAINST (? IN BOOLEAN MODE)",
+			[]interface{}{query, query}
+	}
+
+	// LIKE fallback: every term must appear in one of the indexed columns
+	var conditions []string
+	var args []interface{}
+	for _, term := range terms {
+		pattern := "%" + term + "%"
+		conditions = append(conditions, "(subject LIKE ? OR addresses LIKE ? OR content LIKE ? OR attachment_names LIKE ?)")
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+	if len(conditions) == 0 {
+		conditions = append(conditions, "1 = 0")
+	}
+	return "SELECT email_id, 0 AS score FROM email_search_documents WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Highlights returns the ranking and highlighted fragments of the given keyword hits
+func (i *SearchIndex) Highlights(keyword string, ids []uint) (map[uint]models.SearchHighlight, error) {
+	result := make(map[uint]models.SearchHighlight, len(ids))
+	if len(ids) == 0 || strings.TrimSpace(keyword) == "" {
+		return result, nil
+	}
+
+	var rows []models.SearchHighlight
+	var err error
+
+	switch {
+	case i.hasFTS5():
+		err = i.db.Raw(
+			"SELECT rowid AS email_id, -bm25(email_search_fts, 10.0, 5.0, 1.0, 2.0) AS score, "+
+				"highlight(email_search_fts, 0, ?, ?) AS subject, "+
+				"snippet(email_search_fts, -1, ?, ?, '…', 24) AS snippet "+
+				"FROM email_search_fts WHERE email_search_fts MATCH ? AND rowid IN ?",
+			highlightStart, highlightEnd, highlightStart, highlightEnd, fts5Query(searchTerms(keyword)), ids,
+		).Scan(&rows).Error
+
+	case i.db.Dialector.Name() == "postgres":
+		options := "StartSel=" + highlightStart + ", StopSel=" + highlightEnd
+		err = i.db.Raw(
+			"SELECT email_id, ts_rank(search_vector, q) AS score, "+
+				"ts_headline('simple', subject, q, ?) AS subject, "+
+				"ts_headline('simple', content, q, ?) AS snippet "+
+				"FROM email_search_documents, websearch_to_tsquery('simple', ?) q WHERE email_id IN ?",
+			options+", HighlightAll=true",
+			options+", MaxFragments=2, MaxWords=24, MinWords=8, FragmentDelimiter=\" … \"",
+			keyword, ids,
+		).Scan(&rows).Error
+
+	default:
+		var docs []models.EmailSearchDocument
+		if err := i.db.Where("email_id IN ?", ids).Find(&docs).Error; err != nil {
+			return nil, err
+		}
+		terms := searchTerms(keyword)
+		for _, doc := range docs {
+			text := doc.Content
+			if text == "" {
+				text = doc.Addresses
+			}
+			rows = append(rows, models.SearchHighlight{
+				EmailID: doc.EmailID,
+				Subject: markTerms(doc.Subject, terms),
+				Snippet: markTerms(snippetAround(text, terms, 160), terms),
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		row.Subject = renderHighlight(row.Subject)
+		row.Snippet = renderHighlight(row.Snippet)
+		result[row.EmailID] = row
+	}
+	return result, nil
+}
+
+// searchTerms splits a keyword into terms, keeping "quoted phrases" together
+func searchTerms(keyword string) []string {
+	var terms []string
+	var current strings.Builder
+	inQuotes := false
+
+	flush := func() {
+		term := strings.TrimSpace(current.String())
+		if term != "" {
+			terms = append(terms, term)
+		}
+		current.Reset()
+	}
+
+	for _, r := range keyword {
+		switch {
+		case r == '"':
+			flush()
+			inQuotes = !inQuotes
+		case !inQuotes && (r == ' ' || r == '\t' || r == '\n'):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return terms
+}
+
+// fts5Query quotes every term so user input cannot inject FTS5 syntax.
+// Single words are matched as prefixes, phrases literally.
+func fts5Query(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if !strings.ContainsAny(term, " \t") {
+			quoted += "*"
+		}
+		parts = append(parts, quoted)
+	}
+	if len(parts) == 0 {
+		return `""`
+	}
+	return strings.Join(parts, " ")
+}
+
+// mysqlBooleanQuery builds a boolean mode query requiring every term
+func mysqlBooleanQuery(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		cleaned := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`+-><()~*"@`, r) {
+				return ' '
+			}
+			return r
+		}, term)
+		cleaned = strings.TrimSpace(cleaned)
+		if cleaned == "" {
+			continue
+		}
+		if strings.ContainsAny(cleaned, " \t") {
+			parts = append(parts, `+"`+cleaned+`"`)
+		} else {
+			parts = append(parts, "+"+cleaned+"*")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// snippetAround cuts a window of text around the first term occurrence
+func snippetAround(text string, terms []string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+
+	lower := []rune(strings.ToLower(text))
+	position := -1
+	for _, term := range terms {
+		if idx := runeIndex(lower, []rune(strings.ToLower(term))); idx >= 0 && (position < 0 || idx < position) {
+			position = idx
+		}
+	}
+
+	start := 0
+	if position > width/3 {
+		start = position - width/3
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// markTerms wraps case-insensitive term occurrences in highlight sentinels
+func markTerms(text string, terms []string) string {
+	if text == "" || len(terms) == 0 {
+		return text
+	}
+
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	marked := make([]bool, len(runes))
+	for _, term := range terms {
+		needle := []rune(strings.ToLower(term))
+		if len(needle) == 0 || len(lower) != len(runes) {
+			continue
+		}
+		for offset := 0; offset+len(needle) <= len(lower); {
+			idx := runeIndex(lower[offset:], needle)
+			if idx < 0 {
+				break
+			}
+			for k := offset + idx; k < offset+idx+len(needle); k++ {
+				marked[k] = true
+			}
+			offset += idx + len(needle)
+		}
+	}
+
+	var sb strings.Builder
+	open := false
+	for idx, r := range runes {
+		if marked[idx] && !open {
+			sb.WriteString(highlightStart)
+			open = true
+		} else if !marked[idx] && open {
+			sb.WriteString(highlightEnd)
+			open = false
+		}
+		sb.WriteRune(r)
+	}
+	if open {
+		sb.WriteString(highlightEnd)
+	}
+	return sb.String()
+}
+
+// renderHighlight escapes fragment text and turns the sentinels into <mark> tags
+func renderHighlight(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+}
+
+// runeIndex finds needle in haystack and returns the rune offset or -1
+func runeIndex(haystack, needle []rune) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for idx := 0; idx+len(needle) <= len(haystack); idx++ {
+		match := true
+		for k := range needle {
+			if haystack[idx+k] != needle[k] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return idx
+		}
+	}
+	return -1
+}
+
+// truncateUTF8 cuts text to at most limit bytes without splitting a rune
+func truncateUTF8(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
+
+// addressDomain returns the lowercased domain of an address like "Name <user@example.com>"
+func addressDomain(address string) string {
+	if start := strings.LastIndex(address, "<"); start != -1 {
+		if end := strings.Index(address[start:], ">"); end != -1 {
+			address = address[start+1 : start+end]
+		}
+	}
+	at := strings.LastIndex(address, "@")
+	if at == -1 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(address[at+1:]))
+}
+
+// logIndexError reports a failed index update without failing the write that caused it
+func logIndexError(operation string, err error) {
+	if err != nil {
+		log.Printf("[SearchIndex] Failed to %s: %v", operation, err)
+	}
+}
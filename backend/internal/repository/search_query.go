@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/searchquery"
+
+	"gorm.io/gorm"
+)
+
+// queryCompiler turns a parsed search query into a WHERE condition on the emails table
+type queryCompiler struct {
+	db    *gorm.DB
+	index *SearchIndex
+	now   time.Time
+}
+
+// compileSearchQuery compiles a parsed query into SQL and its arguments
+func (r *EmailRepository) compileSearchQuery(node searchquery.Node, now time.Time) (string, []interface{}) {
+	c := &queryCompiler{db: r.db, index: r.searchIndex, now: now}
+	return c.compile(node)
+}
+
+func (c *queryCompiler) compile(node searchquery.Node) (string, []interface{}) {
+	switch n := node.(type) {
+	case *searchquery.And:
+		return c.join(n.Children, " AND ")
+	case *searchquery.Or:
+		return c.join(n.Children, " OR ")
+	case *searchquery.Not:
+		sql, args := c.compile(n.Child)
+		return "NOT (" + sql + ")", args
+	case *searchquery.Term:
+		return c.term(n)
+	}
+	return "1 = 1", nil
+}
+
+func (c *queryCompiler) join(children []searchquery.Node, separator string) (string, []interface{}) {
+	parts := make([]string, 0, len(children))
+	var args []interface{}
+	for _, child := range children {
+		sql, childArgs := c.compile(child)
+		parts = append(parts, sql)
+		args = append(args, childArgs...)
+	}
+	return "(" + strings.Join(parts, separator) + ")", args
+}
+
+func (c *queryCompiler) term(t *searchquery.Term) (string, []interface{}) {
+	switch t.Field {
+	case searchquery.FieldText:
+		keyword := t.Value
+		if t.Quoted {
+			keyword = `"` + keyword + `"`
+		}
+		return c.index.MatchCondition(keyword)
+
+	case searchquery.FieldFrom, searchquery.FieldTo, searchquery.FieldCc, searchquery.FieldBcc:
+		return AddressCondition(t.Value, models.AddressRole(t.Field))
+
+	case searchquery.FieldSubject:
+		return c.like(c.column("subject"), t.Value)
+
+	case searchquery.FieldBody:
+		bodySQL, bodyArgs := c.like(c.column("body"), t.Value)
+		htmlSQL, htmlArgs := c.like(c.column("html_body"), t.Value)
+		return "(" + bodySQL + " OR " + htmlSQL + ")", append(bodyArgs, htmlArgs...)
+
+	case searchquery.FieldIn:
+		return c.mailbox(t.Value)
+
+	case searchquery.FieldLabel:
+		mailboxSQL, mailboxArgs := c.mailbox(t.Value)
+		flagSQL, flagArgs := c.flag(t.Value)
+		tagSQL, tagArgs := TagCondition(t.Value)
+		args := append(append(mailboxArgs, flagArgs...), tagArgs...)
+		return "(" + mailboxSQL + " OR " + flagSQL + " OR " + tagSQL + ")", args
+
+	case searchquery.FieldTag:
+		return TagCondition(t.Value)
+
+	case searchquery.FieldHas:
+		return "EXISTS (SELECT 1 FROM attachments WHERE attachments.email_id = emails.id)", nil
+
+	case searchquery.FieldIs:
+		switch t.Value {
+		case "unread":
+			return c.column("is_read") + " = ?", []interface{}{false}
+		case "read":
+			return c.column("is_read") + " = ?", []interface{}{true}
+		case "starred":
+			return c.column("is_starred") + " = ?", []interface{}{true}
+		case "answered":
+			return c.flag("answered")
+		case "archived":
+			return c.column("is_archived") + " = ?", []interface{}{true}
+		}
+
+	case searchquery.FieldBefore, searchquery.FieldOlderThan:
+		return c.column("date") + " < ?", []interface{}{t.Cutoff(c.now)}
+
+	case searchquery.FieldAfter, searchquery.FieldNewerThan:
+		return c.column("date") + " >= ?", []interface{}{t.Cutoff(c.now)}
+
+	case searchquery.FieldLarger:
+		return c.column("size") + " > ?", []interface{}{t.Size}
+
+	case searchquery.FieldSmaller:
+		return c.column("size") + " < ?", []interface{}{t.Size}
+
+	case searchquery.FieldAccount:
+		if id, err := strconv.ParseUint(t.Value, 10, 64); err == nil {
+			return c.column("account_id") + " = ?", []interface{}{uint(id)}
+		}
+		return c.column("account_id") + " IN (SELECT id FROM email_accounts WHERE LOWER(email_address) LIKE ? ESCAPE '!')",
+			[]interface{}{likePattern(t.Value)}
+	}
+
+	return "1 = 1", nil
+}
+
+// column returns a quoted, table qualified column of the emails table
+func (c *queryCompiler) column(name string) string {
+	var sb strings.Builder
+	c.db.Dialector.QuoteTo(&sb, "emails."+name)
+	return sb.String()
+}
+
+// text renders a column as lower-cased text, JSON columns included
+func (c *queryCompiler) text(column string) string {
+	textType := "TEXT"
+	if c.db.Dialector.Name() == "mysql" {
+		textType = "CHAR"
+	}
+	return fmt.Sprintf("LOWER(COALESCE(CAST(%s AS %s), ''))", column, textType)
+}
+
+// like matches a case-insensitive substring of a column
+func (c *queryCompiler) like(column, value string) (string, []interface{}) {
+	return c.text(column) + " LIKE ? ESCAPE '!'", []interface{}{likePattern(value)}
+}
+
+// flag matches an IMAP flag (\Seen, \Flagged, ...) or keyword stored in the flags JSON array
+func (c *queryCompiler) flag(name string) (string, []interface{}) {
+	return c.like(c.column("flags"), name+`"`)
+}
+
+// mailbox matches an in:/label: value against the mailbox name, nested folders match on their last segment
+func (c *queryCompiler) mailbox(value string) (string, []interface{}) {
+	if searchquery.MatchesAnyMailbox(value) {
+		return "1 = 1", nil
+	}
+
+	column := "LOWER(" + c.column("mailbox_name") + ")"
+	names := searchquery.MailboxNames(value)
+	conditions := []string{column + " IN ?"}
+	args := []interface{}{names}
+	for _, name := range names {
+		conditions = append(conditions, column+" LIKE ? ESCAPE '!'", column+" LIKE ? ESCAPE '!'")
+		args = append(args, "%/"+escapeLike(name), "%."+escapeLike(name))
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// likePattern builds a lower-cased substring pattern using '!' as escape character
+func likePattern(value string) string {
+	return "%" + escapeLike(strings.ToLower(value)) + "%"
+}
+
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return replacer.Replace(value)
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"strings"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TagCondition matches emails carrying the named tag, ignoring case
+func TagCondition(name string) (string, []interface{}) {
+	return "emails.id IN (SELECT email_tags.email_id FROM email_tags JOIN tags ON tags.id = email_tags.tag_id WHERE LOWER(tags.name) = ?)",
+		[]interface{}{strings.ToLower(strings.TrimSpace(name))}
+}
+
+// TagRepository handles database operations for user tags
+type TagRepository struct {
+	db *gorm.DB
+}
+
+// NewTagRepository creates a new tag repository
+func NewTagRepository(db *gorm.DB) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+// Create creates a new tag
+func (r *TagRepository) Create(tag *models.Tag) error {
+	return r.db.Create(tag).Error
+}
+
+// GetByID returns a tag by ID
+func (r *TagRepository) GetByID(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.db.First(&tag, id).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetByName returns a tag by name, ignoring case
+func (r *TagRepository) GetByName(name string) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.db.Where("LOWER(name) = ?", strings.ToLower(strings.TrimSpace(name))).First(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetByIDs returns the tags with the given IDs
+func (r *TagRepository) GetByIDs(ids []uint) ([]models.Tag, error) {
+	var tags []models.Tag
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	err := r.db.Where("id IN ?", ids).Order("name ASC").Find(&tags).Error
+	return tags, err
+}
+
+// List returns all tags with the number of emails carrying each of them
+func (r *TagRepository) List() ([]models.Tag, error) {
+	var tags []models.Tag
+	if err := r.db.Order("name ASC").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		TagID uint
+		Count int64
+	}
+	if err := r.db.Model(&models.EmailTag{}).Select("tag_id, COUNT(*) AS count").Group("tag_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	byTag := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		byTag[c.TagID] = c.Count
+	}
+	for i := range tags {
+		tags[i].EmailCount = byTag[tags[i].ID]
+	}
+	return tags, nil
+}
+
+// Update saves a tag
+func (r *TagRepository) Update(tag *models.Tag) error {
+	return r.db.Save(tag).Error
+}
+
+// Delete deletes a tag and removes it from all emails
+func (r *TagRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", id).Delete(&models.EmailTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Tag{}, id).Error
+	})
+}
+
+// FindOrCreate returns the tags with the given names, creating the missing ones
+func (r *TagRepository) FindOrCreate(names []string) ([]models.Tag, error) {
+	var tags []models.Tag
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		tag, err := r.GetByName(name)
+		if err == gorm.ErrRecordNotFound {
+			tag = &models.Tag{Name: name}
+			err = r.Create(tag)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, *tag)
+	}
+	return tags, nil
+}
+
+// AddToEmails tags every email with every tag and returns the number of new associations
+func (r *TagRepository) AddToEmails(emailIDs, tagIDs []uint) (int64, error) {
+	if len(emailIDs) == 0 || len(tagIDs) == 0 {
+		return 0, nil
+	}
+
+	links := make([]models.EmailTag, 0, len(emailIDs)*len(tagIDs))
+	for _, emailID := range emailIDs {
+		for _, tagID := range tagIDs {
+			links = append(links, models.EmailTag{EmailID: emailID, TagID: tagID})
+		}
+	}
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(links, 500)
+	return result.RowsAffected, result.Error
+}
+
+// RemoveFromEmails removes the tags from the emails and returns the number of removed associations
+func (r *TagRepository) RemoveFromEmails(emailIDs, tagIDs []uint) (int64, error) {
+	if len(emailIDs) == 0 || len(tagIDs) == 0 {
+		return 0, nil
+	}
+	result := r.db.Where("email_id IN ? AND tag_id IN ?", emailIDs, tagIDs).Delete(&models.EmailTag{})
+	return result.RowsAffected, result.Error
+}
+
+// EmailStateUpdate changes the local state of emails; nil fields are left unchanged
+type EmailStateUpdate struct {
+	Read     *bool `json:"read,omitempty"`
+	Starred  *bool `json:"starred,omitempty"`
+	Archived *bool `json:"archived,omitempty"`
+}
+
+// IsEmpty reports whether the update changes nothing
+func (u EmailStateUpdate) IsEmpty() bool {
+	return u.Read == nil && u.Starred == nil && u.Archived == nil
+}
+
+// UpdateLocalState sets the local read, starred and archived state of emails
+func (r *EmailRepository) UpdateLocalState(ids []uint, update EmailStateUpdate) (int64, error) {
+	if len(ids) == 0 || update.IsEmpty() {
+		return 0, nil
+	}
+
+	values := map[string]interface{}{}
+	if update.Read != nil {
+		values["is_read"] = *update.Read
+	}
+	if update.Starred != nil {
+		values["is_starred"] = *update.Starred
+	}
+	if update.Archived != nil {
+		values["is_archived"] = *update.Archived
+	}
+	result := r.db.Model(&models.Email{}).Where("id IN ?", ids).Updates(values)
+	return result.RowsAffected, result.Error
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"errors"
 	"mailman/internal/models"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,8 +19,16 @@ func NewTriggerRepository(db *gorm.DB) *TriggerRepository {
 	return &TriggerRepository{db: db}
 }
 
-// Create creates a new trigger
+// Create creates a new trigger. Unless a cursor is given, the trigger starts
+// after the newest stored email and only sees emails arriving from now on.
 func (r *TriggerRepository) Create(trigger *models.EmailTrigger) error {
+	if trigger.LastEmailID == 0 {
+		lastEmailID, err := r.LatestEmailID()
+		if err != nil {
+			return err
+		}
+		trigger.LastEmailID = lastEmailID
+	}
 	return r.db.Create(trigger).Error
 }
 
@@ -84,9 +93,78 @@ func (r *TriggerRepository) GetByStatus(status models.TriggerStatus) ([]models.E
 	return triggers, err
 }
 
-// Update updates a trigger
+// Update updates a trigger and starts its next revision. The cursor and the
+// statistics are left alone, they only change through UpdateCursor and
+// RecordExecution.
 func (r *TriggerRepository) Update(trigger *models.EmailTrigger) error {
-	return r.db.Save(trigger).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("last_email_id", "revision", "total_executions", "success_executions", "last_executed_at", "last_error").
+			Save(trigger).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(trigger).UpdateColumn("revision", gorm.Expr("revision + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.EmailTrigger{}).Where("id = ?", trigger.ID).Select("revision").Scan(&trigger.Revision).Error
+	})
+}
+
+// GetCursor returns the ID of the last email evaluated by a trigger
+func (r *TriggerRepository) GetCursor(id uint) (uint, error) {
+	var trigger models.EmailTrigger
+	if err := r.db.Select("id", "last_email_id").First(&trigger, id).Error; err != nil {
+		return 0, err
+	}
+	return trigger.LastEmailID, nil
+}
+
+// UpdateCursor records the ID of the last email evaluated by a trigger
+func (r *TriggerRepository) UpdateCursor(id, lastEmailID uint) error {
+	return r.db.Model(&models.EmailTrigger{}).Where("id = ?", id).UpdateColumn("last_email_id", lastEmailID).Error
+}
+
+// ScopeAccountIDs resolves the account scope of a trigger: its account IDs
+// plus the accounts carrying one of its account tags. It returns nil for a
+// trigger without a scope and an empty slice when no account is in scope.
+func (r *TriggerRepository) ScopeAccountIDs(trigger *models.EmailTrigger) ([]uint, error) {
+	if len(trigger.AccountIDs) == 0 && len(trigger.AccountTags) == 0 {
+		return nil, nil
+	}
+	ids := append(make([]uint, 0, len(trigger.AccountIDs)), trigger.AccountIDs...)
+	if len(trigger.AccountTags) == 0 {
+		return ids, nil
+	}
+
+	// 标签保存在 JSON 列中，账户数量不多，在内存中比较以兼容各数据库
+	wanted := make(map[string]bool, len(trigger.AccountTags))
+	for _, tag := range trigger.AccountTags {
+		wanted[strings.ToLower(strings.TrimSpace(tag))] = true
+	}
+	var accounts []models.EmailAccount
+	if err := r.db.Select("id", "tags").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		for _, tag := range account.Tags {
+			if wanted[strings.ToLower(strings.TrimSpace(tag))] {
+				ids = append(ids, account.ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// LatestEmailID returns the ID of the newest stored email
+func (r *TriggerRepository) LatestEmailID() (uint, error) {
+	return latestEmailID(r.db)
+}
+
+// SettledEmailID returns the highest email ID a trigger cursor may move past,
+// see EmailVisibilityLag
+func (r *TriggerRepository) SettledEmailID(now time.Time) (uint, error) {
+	return settledEmailID(r.db, now.Add(-EmailVisibilityLag))
 }
 
 // UpdateStatus updates trigger status
@@ -94,20 +172,29 @@ func (r *TriggerRepository) UpdateStatus(id uint, status models.TriggerStatus) e
 	return r.db.Model(&models.EmailTrigger{}).Where("id = ?", id).Update("status", status).Error
 }
 
-// UpdateStatistics updates trigger execution statistics
-func (r *TriggerRepository) UpdateStatistics(id uint, totalExecutions, successExecutions int64, lastExecutedAt *time.Time, lastError string) error {
+// RecordExecution adds one execution to the statistics of a trigger. The
+// counters are incremented in the database, as executions of a trigger do
+// not see each other's updates.
+func (r *TriggerRepository) RecordExecution(id uint, success bool, executedAt time.Time, lastError string) error {
 	updates := map[string]interface{}{
-		"total_executions":   totalExecutions,
-		"success_executions": successExecutions,
-		"last_executed_at":   lastExecutedAt,
-		"last_error":         lastError,
+		"total_executions": gorm.Expr("total_executions + 1"),
+		"last_executed_at": executedAt,
+		"last_error":       lastError,
+	}
+	if success {
+		updates["success_executions"] = gorm.Expr("success_executions + 1")
 	}
-	return r.db.Model(&models.EmailTrigger{}).Where("id = ?", id).Updates(updates).Error
+	return r.db.Model(&models.EmailTrigger{}).Where("id = ?", id).UpdateColumns(updates).Error
 }
 
-// Delete soft deletes a trigger
+// Delete deletes a trigger and its ledger of processed emails
 func (r *TriggerRepository) Delete(id uint) error {
-	return r.db.Delete(&models.EmailTrigger{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("trigger_id = ?", id).Delete(&models.TriggerLedgerEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.EmailTrigger{}, id).Error
+	})
 }
 
 // GetCount returns the total count of triggers
@@ -233,6 +320,11 @@ func (r *TriggerExecutionLogRepository) DeleteOldLogs(beforeDate time.Time) (int
 	return result.RowsAffected, result.Error
 }
 
+// ApplyRetention deletes logs created before deleteBefore and beyond the newest maxLogs logs
+func (r *TriggerExecutionLogRepository) ApplyRetention(deleteBefore *time.Time, maxLogs int, dryRun bool) (RetentionCounts, error) {
+	return applyLogRetention(r.db, &models.TriggerExecutionLog{}, deleteBefore, maxLogs, dryRun)
+}
+
 // GetStatistics retrieves execution statistics for a trigger
 func (r *TriggerExecutionLogRepository) GetStatistics(triggerID uint, startDate, endDate *time.Time) (map[string]interface{}, error) {
 	query := r.db.Model(&models.TriggerExecutionLog{}).Where("trigger_id = ?", triggerID)
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// TriggerLedgerRepository handles the ledger of emails processed by triggers
+type TriggerLedgerRepository struct {
+	db *gorm.DB
+}
+
+// NewTriggerLedgerRepository creates a new TriggerLedgerRepository
+func NewTriggerLedgerRepository(db *gorm.DB) *TriggerLedgerRepository {
+	return &TriggerLedgerRepository{db: db}
+}
+
+// Get returns the entry of a trigger revision for an email
+func (r *TriggerLedgerRepository) Get(triggerID, emailID uint, revision int) (*models.TriggerLedgerEntry, error) {
+	var entry models.TriggerLedgerEntry
+	err := r.db.Where("trigger_id = ? AND email_id = ? AND revision = ?", triggerID, emailID, revision).First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// TriggerLedgerLease is how long a claim on an entry stays valid. Every
+// completed action renews it; an entry whose lease expired was interrupted
+// and can be claimed by another worker.
+const TriggerLedgerLease = 10 * time.Minute
+
+var (
+	// ErrTriggerLedgerBusy is returned when another worker holds the entry
+	ErrTriggerLedgerBusy = errors.New("email is being processed by another worker")
+	// ErrTriggerLedgerLeaseLost is returned when the lease of an entry expired and another worker claimed it
+	ErrTriggerLedgerLeaseLost = errors.New("trigger ledger lease lost")
+)
+
+// Begin claims the entry of a trigger revision for an email. It returns the
+// entry and whether the caller owns it and has to process the email: an
+// entry that is done, or held by another worker whose lease has not expired,
+// is returned unchanged. An interrupted entry is resumed with its completed
+// actions.
+func (r *TriggerLedgerRepository) Begin(triggerID, emailID uint, revision int) (*models.TriggerLedgerEntry, bool, error) {
+	if entry, created, err := r.create(triggerID, emailID, revision); err != nil || created {
+		return entry, created, err
+	}
+
+	owner, expires := newLeaseOwner(), time.Now().Add(TriggerLedgerLease)
+	result := r.db.Model(&models.TriggerLedgerEntry{}).
+		Where("trigger_id = ? AND email_id = ? AND revision = ? AND state = ?", triggerID, emailID, revision, models.TriggerLedgerStateRunning).
+		Where("lease_expires_at IS NULL OR lease_expires_at < ?", time.Now()).
+		Updates(map[string]interface{}{
+			"lease_owner":      owner,
+			"lease_expires_at": expires,
+			"attempts":         gorm.Expr("attempts + 1"),
+		})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	entry, err := r.Get(triggerID, emailID, revision)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, result.RowsAffected == 1, nil
+}
+
+// Restart claims the entry of a trigger revision for an email to process the
+// email again from the start, whether or not it is done. It fails with
+// ErrTriggerLedgerBusy while another worker holds the entry.
+func (r *TriggerLedgerRepository) Restart(triggerID, emailID uint, revision int) (*models.TriggerLedgerEntry, error) {
+	if entry, created, err := r.create(triggerID, emailID, revision); err != nil || created {
+		return entry, err
+	}
+
+	owner, expires := newLeaseOwner(), time.Now().Add(TriggerLedgerLease)
+	result := r.db.Model(&models.TriggerLedgerEntry{}).
+		Where("trigger_id = ? AND email_id = ? AND revision = ?", triggerID, emailID, revision).
+		Where("state = ? OR lease_expires_at IS NULL OR lease_expires_at < ?", models.TriggerLedgerStateDone, time.Now()).
+		Updates(map[string]interface{}{
+			"state":             models.TriggerLedgerStateRunning,
+			"outcome":           "",
+			"condition_result":  false,
+			"completed_actions": nil,
+			"attempts":          1,
+			"error":             "",
+			"lease_owner":       owner,
+			"lease_expires_at":  expires,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrTriggerLedgerBusy
+	}
+	return r.Get(triggerID, emailID, revision)
+}
+
+// create adds a claimed entry unless the email already has one. It reports
+// false without an error when the entry exists, including when a concurrent
+// worker created it first.
+func (r *TriggerLedgerRepository) create(triggerID, emailID uint, revision int) (*models.TriggerLedgerEntry, bool, error) {
+	_, err := r.Get(triggerID, emailID, revision)
+	if err == nil {
+		return nil, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	expires := time.Now().Add(TriggerLedgerLease)
+	entry := &models.TriggerLedgerEntry{
+		TriggerID:      triggerID,
+		EmailID:        emailID,
+		Revision:       revision,
+		State:          models.TriggerLedgerStateRunning,
+		Attempts:       1,
+		LeaseOwner:     newLeaseOwner(),
+		LeaseExpiresAt: &expires,
+	}
+	if err := r.db.Create(entry).Error; err != nil {
+		// 同时开始处理的另一方已经建立了记录，由调用方按条件认领
+		if _, getErr := r.Get(triggerID, emailID, revision); getErr == nil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// CompleteAction records that an action of a claimed entry succeeded and
+// renews the lease
+func (r *TriggerLedgerRepository) CompleteAction(entry *models.TriggerLedgerEntry, action int) error {
+	expires := time.Now().Add(TriggerLedgerLease)
+	completed := append(append([]int(nil), entry.CompletedActions...), action)
+	result := r.db.Model(entry).Where("lease_owner = ?", entry.LeaseOwner).
+		Select("completed_actions", "lease_expires_at", "updated_at").
+		Updates(&models.TriggerLedgerEntry{CompletedActions: completed, LeaseExpiresAt: &expires})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrTriggerLedgerLeaseLost
+	}
+	entry.CompletedActions = completed
+	entry.LeaseExpiresAt = &expires
+	return nil
+}
+
+// Finish marks a claimed entry as done with the outcome of the execution and
+// releases the lease
+func (r *TriggerLedgerRepository) Finish(entry *models.TriggerLedgerEntry, outcome models.TriggerExecutionStatus, conditionResult bool, errorMessage string) error {
+	result := r.db.Model(entry).Where("lease_owner = ?", entry.LeaseOwner).
+		Select("state", "outcome", "condition_result", "error", "lease_owner", "lease_expires_at", "updated_at").
+		Updates(&models.TriggerLedgerEntry{
+			State:           models.TriggerLedgerStateDone,
+			Outcome:         outcome,
+			ConditionResult: conditionResult,
+			Error:           errorMessage,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrTriggerLedgerLeaseLost
+	}
+	entry.State = models.TriggerLedgerStateDone
+	entry.Outcome = outcome
+	entry.ConditionResult = conditionResult
+	entry.Error = errorMessage
+	entry.LeaseOwner = ""
+	entry.LeaseExpiresAt = nil
+	return nil
+}
+
+// List returns the entries of a trigger, newest first, optionally only those of one email
+func (r *TriggerLedgerRepository) List(triggerID, emailID uint, limit, offset int) ([]models.TriggerLedgerEntry, int64, error) {
+	var entries []models.TriggerLedgerEntry
+	var total int64
+
+	query := r.db.Model(&models.TriggerLedgerEntry{}).Where("trigger_id = ?", triggerID)
+	if emailID > 0 {
+		query = query.Where("email_id = ?", emailID)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&entries).Error
+	return entries, total, err
+}
+
+// newLeaseOwner identifies a single claim of an entry
+func newLeaseOwner() string {
+	owner := make([]byte, 8)
+	rand.Read(owner)
+	return hex.EncodeToString(owner)
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"mailman/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestLedger(t *testing.T) (*TriggerLedgerRepository, *gorm.DB) {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "ledger.db") + "?_busy_timeout=10000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.TriggerLedgerEntry{}); err != nil {
+		t.Fatalf("failed to create ledger table: %v", err)
+	}
+	return NewTriggerLedgerRepository(db), db
+}
+
+// expireLease simulates a worker that stopped while holding the entry
+func expireLease(t *testing.T, db *gorm.DB, entry *models.TriggerLedgerEntry) {
+	t.Helper()
+	if err := db.Model(&models.TriggerLedgerEntry{}).Where("id = ?", entry.ID).
+		Update("lease_expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("failed to expire lease: %v", err)
+	}
+}
+
+func TestTriggerLedgerResume(t *testing.T) {
+	ledger, db := newTestLedger(t)
+
+	entry, claimed, err := ledger.Begin(1, 10, 1)
+	if err != nil || !claimed {
+		t.Fatalf("expected the first Begin to claim the entry, got %v, %v", claimed, err)
+	}
+	if err := ledger.CompleteAction(entry, 0); err != nil {
+		t.Fatalf("failed to complete action: %v", err)
+	}
+
+	// 租约有效时其他一方不能认领
+	if _, claimed, err := ledger.Begin(1, 10, 1); err != nil || claimed {
+		t.Fatalf("expected a held entry not to be claimed, got %v, %v", claimed, err)
+	}
+
+	expireLease(t, db, entry)
+	resumed, claimed, err := ledger.Begin(1, 10, 1)
+	if err != nil || !claimed {
+		t.Fatalf("expected an expired entry to be claimed, got %v, %v", claimed, err)
+	}
+	if resumed.Attempts != 2 || len(resumed.CompletedActions) != 1 || resumed.CompletedActions[0] != 0 {
+		t.Fatalf("expected attempt 2 with action 0 completed, got %d, %v", resumed.Attempts, resumed.CompletedActions)
+	}
+
+	// 原持有者的租约已经失效
+	if err := ledger.CompleteAction(entry, 1); !errors.Is(err, ErrTriggerLedgerLeaseLost) {
+		t.Fatalf("expected the old owner to lose the lease, got %v", err)
+	}
+	if err := ledger.Finish(entry, models.TriggerExecutionStatusSuccess, true, ""); !errors.Is(err, ErrTriggerLedgerLeaseLost) {
+		t.Fatalf("expected the old owner not to finish the entry, got %v", err)
+	}
+
+	if err := ledger.Finish(resumed, models.TriggerExecutionStatusSuccess, true, ""); err != nil {
+		t.Fatalf("failed to finish entry: %v", err)
+	}
+	done, claimed, err := ledger.Begin(1, 10, 1)
+	if err != nil || claimed || done.State != models.TriggerLedgerStateDone {
+		t.Fatalf("expected a done entry to be skipped, got %v, %v, %v", done.State, claimed, err)
+	}
+
+	// 新修订单独记录
+	if _, claimed, err := ledger.Begin(1, 10, 2); err != nil || !claimed {
+		t.Fatalf("expected a new revision to be claimed, got %v, %v", claimed, err)
+	}
+}
+
+func TestTriggerLedgerRestart(t *testing.T) {
+	ledger, _ := newTestLedger(t)
+
+	entry, _, err := ledger.Begin(1, 10, 1)
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	if _, err := ledger.Restart(1, 10, 1); !errors.Is(err, ErrTriggerLedgerBusy) {
+		t.Fatalf("expected a held entry to be busy, got %v", err)
+	}
+
+	if err := ledger.CompleteAction(entry, 0); err != nil {
+		t.Fatalf("failed to complete action: %v", err)
+	}
+	if err := ledger.Finish(entry, models.TriggerExecutionStatusSuccess, true, ""); err != nil {
+		t.Fatalf("failed to finish entry: %v", err)
+	}
+	restarted, err := ledger.Restart(1, 10, 1)
+	if err != nil {
+		t.Fatalf("failed to restart a done entry: %v", err)
+	}
+	if restarted.State != models.TriggerLedgerStateRunning || len(restarted.CompletedActions) != 0 || restarted.Attempts != 1 {
+		t.Fatalf("expected a fresh running entry, got %+v", restarted)
+	}
+}
+
+func TestTriggerLedgerConcurrentClaims(t *testing.T) {
+	ledger, db := newTestLedger(t)
+	const workers = 8
+
+	claim := func() int {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		claims := 0
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, claimed, err := ledger.Begin(1, 20, 1)
+				if err != nil {
+					t.Errorf("Begin failed: %v", err)
+					return
+				}
+				if claimed {
+					mu.Lock()
+					claims++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		return claims
+	}
+
+	if claims := claim(); claims != 1 {
+		t.Fatalf("expected exactly one worker to claim a new entry, got %d", claims)
+	}
+
+	entry, err := ledger.Get(1, 20, 1)
+	if err != nil {
+		t.Fatalf("failed to read entry: %v", err)
+	}
+	expireLease(t, db, entry)
+	if claims := claim(); claims != 1 {
+		t.Fatalf("expected exactly one worker to resume an expired entry, got %d", claims)
+	}
+}
@@ -0,0 +1,226 @@
+// Package searchquery implements the Gmail-style search language used by the
+// email search API, saved searches, triggers and subscriptions, e.g.
+//
+//	from:github subject:(verify OR confirm) has:attachment newer_than:2d -in:spam
+//
+// Parse turns a query into an AST; the repository compiles the AST to SQL and
+// Match evaluates it against an in-memory email.
+package searchquery
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Field identifies the operator of a term
+type Field string
+
+const (
+	FieldText      Field = "" // Free text, matched against the full-text index
+	FieldFrom      Field = "from"
+	FieldTo        Field = "to"
+	FieldCc        Field = "cc"
+	FieldBcc       Field = "bcc"
+	FieldSubject   Field = "subject"
+	FieldBody      Field = "body"
+	FieldIn        Field = "in"
+	FieldLabel     Field = "label"
+	FieldHas       Field = "has"
+	FieldIs        Field = "is"
+	FieldBefore    Field = "before"
+	FieldAfter     Field = "after"
+	FieldNewerThan Field = "newer_than"
+	FieldOlderThan Field = "older_than"
+	FieldLarger    Field = "larger"
+	FieldSmaller   Field = "smaller"
+	FieldAccount   Field = "account"
+	FieldTag       Field = "tag"
+)
+
+// fieldNames maps operator names (and their Gmail aliases) to fields
+var fieldNames = map[string]Field{
+	"from":       FieldFrom,
+	"to":         FieldTo,
+	"cc":         FieldCc,
+	"bcc":        FieldBcc,
+	"subject":    FieldSubject,
+	"body":       FieldBody,
+	"in":         FieldIn,
+	"label":      FieldLabel,
+	"has":        FieldHas,
+	"is":         FieldIs,
+	"before":     FieldBefore,
+	"older":      FieldBefore,
+	"after":      FieldAfter,
+	"newer":      FieldAfter,
+	"newer_than": FieldNewerThan,
+	"older_than": FieldOlderThan,
+	"larger":     FieldLarger,
+	"size":       FieldLarger,
+	"smaller":    FieldSmaller,
+	"account":    FieldAccount,
+	"tag":        FieldTag,
+}
+
+// Node is an element of a parsed query
+type Node interface {
+	// Position is the rune offset of the node in the original query
+	Position() int
+	// String renders the node back to canonical query syntax
+	String() string
+}
+
+// Term is a single condition, either free text or field:value
+type Term struct {
+	Field  Field
+	Value  string // Normalized value (has:/is:/in:/label:/tag: values are lower-cased)
+	Quoted bool   // Value was written as a "quoted phrase"
+	Pos    int
+
+	Time time.Time // before:/after: absolute date
+	Size int64     // larger:/smaller: size in bytes
+
+	ageAmount int  // newer_than:/older_than: amount
+	ageUnit   rune // newer_than:/older_than: unit (h, d, w, m, y)
+}
+
+// And matches when every child matches
+type And struct {
+	Children []Node
+	Pos      int
+}
+
+// Or matches when any child matches
+type Or struct {
+	Children []Node
+	Pos      int
+}
+
+// Not inverts its child
+type Not struct {
+	Child Node
+	Pos   int
+}
+
+func (t *Term) Position() int { return t.Pos }
+func (a *And) Position() int  { return a.Pos }
+func (o *Or) Position() int   { return o.Pos }
+func (n *Not) Position() int  { return n.Pos }
+
+// Cutoff resolves the point in time a date term compares against.
+// Relative terms (newer_than:/older_than:) are resolved against now.
+func (t *Term) Cutoff(now time.Time) time.Time {
+	switch t.Field {
+	case FieldNewerThan, FieldOlderThan:
+		switch t.ageUnit {
+		case 'h':
+			return now.Add(-time.Duration(t.ageAmount) * time.Hour)
+		case 'd':
+			return now.AddDate(0, 0, -t.ageAmount)
+		case 'w':
+			return now.AddDate(0, 0, -7*t.ageAmount)
+		case 'm':
+			return now.AddDate(0, -t.ageAmount, 0)
+		case 'y':
+			return now.AddDate(-t.ageAmount, 0, 0)
+		}
+	}
+	return t.Time
+}
+
+func (t *Term) String() string {
+	value := t.Value
+	if t.Quoted || strings.ContainsAny(value, " \t()\"") {
+		value = `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	if t.Field == FieldText {
+		return value
+	}
+	return string(t.Field) + ":" + value
+}
+
+func (a *And) String() string {
+	parts := make([]string, len(a.Children))
+	for i, child := range a.Children {
+		if _, isOr := child.(*Or); isOr {
+			parts[i] = "(" + child.String() + ")"
+		} else {
+			parts[i] = child.String()
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (o *Or) String() string {
+	parts := make([]string, len(o.Children))
+	for i, child := range o.Children {
+		parts[i] = child.String()
+	}
+	return strings.Join(parts, " OR ")
+}
+
+func (n *Not) String() string {
+	switch n.Child.(type) {
+	case *And, *Or:
+		return "-(" + n.Child.String() + ")"
+	}
+	return "-" + n.Child.String()
+}
+
+// MarshalJSON renders the term for the query inspection API
+func (t *Term) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":     "term",
+		"field":    string(t.Field),
+		"value":    t.Value,
+		"quoted":   t.Quoted,
+		"position": t.Pos,
+	})
+}
+
+// MarshalJSON renders the node for the query inspection API
+func (a *And) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"type": "and", "children": a.Children, "position": a.Pos})
+}
+
+// MarshalJSON renders the node for the query inspection API
+func (o *Or) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"type": "or", "children": o.Children, "position": o.Pos})
+}
+
+// MarshalJSON renders the node for the query inspection API
+func (n *Not) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"type": "not", "child": n.Child, "position": n.Pos})
+}
+
+// TextTerms returns the free-text terms that are not negated, quoted phrases
+// keep their quotes. They are used to rank results and build highlights.
+func TextTerms(node Node) []string {
+	var terms []string
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch v := n.(type) {
+		case *Term:
+			if v.Field == FieldText {
+				if v.Quoted {
+					terms = append(terms, `"`+v.Value+`"`)
+				} else {
+					terms = append(terms, v.Value)
+				}
+			}
+		case *And:
+			for _, child := range v.Children {
+				walk(child)
+			}
+		case *Or:
+			for _, child := range v.Children {
+				walk(child)
+			}
+		}
+	}
+	if node != nil {
+		walk(node)
+	}
+	return terms
+}
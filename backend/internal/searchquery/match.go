@@ -0,0 +1,194 @@
+package searchquery
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/utils"
+)
+
+// mailboxAliases maps Gmail's well-known in: names to the folder names used by
+// common IMAP servers
+var mailboxAliases = map[string][]string{
+	"inbox":  {"inbox"},
+	"spam":   {"spam", "junk", "junk e-mail", "junk email", "垃圾邮件"},
+	"trash":  {"trash", "deleted", "deleted items", "deleted messages", "已删除邮件"},
+	"sent":   {"sent", "sent items", "sent mail", "sent messages", "已发送邮件"},
+	"drafts": {"drafts", "draft", "草稿箱"},
+}
+
+// MailboxNames returns the lower-cased folder names an in:/label: value stands for
+func MailboxNames(value string) []string {
+	value = strings.ToLower(value)
+	if aliases, ok := mailboxAliases[value]; ok {
+		return aliases
+	}
+	return []string{value}
+}
+
+// MatchesAnyMailbox reports whether an in: value matches every folder (in:anywhere)
+func MatchesAnyMailbox(value string) bool {
+	return value == "anywhere" || value == "all"
+}
+
+// mailboxMatches compares a folder name with an in: value. Nested folders such
+// as "[Gmail]/Spam" or "INBOX.Junk" match on their last segment.
+func mailboxMatches(mailbox, value string) bool {
+	if MatchesAnyMailbox(value) {
+		return true
+	}
+	mailbox = strings.ToLower(mailbox)
+	for _, name := range MailboxNames(value) {
+		if mailbox == name || strings.HasSuffix(mailbox, "/"+name) || strings.HasSuffix(mailbox, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFlag reports whether the IMAP flags contain the flag, ignoring case and the leading backslash
+func hasFlag(flags models.StringSlice, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(strings.TrimPrefix(f, `\`), flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTag reports whether the email carries the tag, ignoring case
+func hasTag(tags []models.Tag, name string) bool {
+	for _, tag := range tags {
+		if strings.EqualFold(tag.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matcher caches the derived text of one email while the tree is evaluated
+type matcher struct {
+	email    *models.Email
+	now      time.Time
+	fullText string
+}
+
+// Match reports whether the email satisfies the query. A nil node matches everything.
+// Relative dates are resolved against now.
+func Match(node Node, email *models.Email, now time.Time) bool {
+	if node == nil {
+		return true
+	}
+	if email.ID == 0 {
+		// Emails that are not stored yet have no local state, derive it from the IMAP flags
+		seeded := *email
+		seeded.SeedLocalState()
+		email = &seeded
+	}
+	m := &matcher{email: email, now: now}
+	return m.eval(node)
+}
+
+func (m *matcher) eval(node Node) bool {
+	switch n := node.(type) {
+	case *And:
+		for _, child := range n.Children {
+			if !m.eval(child) {
+				return false
+			}
+		}
+		return true
+	case *Or:
+		for _, child := range n.Children {
+			if m.eval(child) {
+				return true
+			}
+		}
+		return false
+	case *Not:
+		return !m.eval(n.Child)
+	case *Term:
+		return m.evalTerm(n)
+	}
+	return false
+}
+
+func (m *matcher) evalTerm(t *Term) bool {
+	email := m.email
+	value := strings.ToLower(t.Value)
+
+	switch t.Field {
+	case FieldText:
+		return strings.Contains(m.text(), value)
+	case FieldFrom:
+		return models.AddressesMatch(email.From, value)
+	case FieldTo:
+		return models.AddressesMatch(email.To, value)
+	case FieldCc:
+		return models.AddressesMatch(email.Cc, value)
+	case FieldBcc:
+		return models.AddressesMatch(email.Bcc, value)
+	case FieldSubject:
+		return strings.Contains(strings.ToLower(email.Subject), value)
+	case FieldBody:
+		return strings.Contains(strings.ToLower(email.Body), value) ||
+			strings.Contains(strings.ToLower(email.HTMLBody), value)
+	case FieldIn:
+		return mailboxMatches(email.MailboxName, value)
+	case FieldLabel:
+		return mailboxMatches(email.MailboxName, value) || hasFlag(email.Flags, value) || hasTag(email.Tags, value)
+	case FieldTag:
+		return hasTag(email.Tags, value)
+	case FieldHas:
+		return len(email.Attachments) > 0
+	case FieldIs:
+		switch t.Value {
+		case "unread":
+			return !email.IsRead
+		case "read":
+			return email.IsRead
+		case "starred":
+			return email.IsStarred
+		case "answered":
+			return hasFlag(email.Flags, "Answered")
+		case "archived":
+			return email.IsArchived
+		}
+		return false
+	case FieldBefore, FieldOlderThan:
+		return email.Date.Before(t.Cutoff(m.now))
+	case FieldAfter, FieldNewerThan:
+		return !email.Date.Before(t.Cutoff(m.now))
+	case FieldLarger:
+		return email.Size > t.Size
+	case FieldSmaller:
+		return email.Size < t.Size
+	case FieldAccount:
+		if id, err := strconv.ParseUint(t.Value, 10, 64); err == nil {
+			return uint64(email.AccountID) == id
+		}
+		return strings.Contains(strings.ToLower(email.Account.EmailAddress), value)
+	}
+	return false
+}
+
+// text returns the lower-cased searchable text of the email
+func (m *matcher) text() string {
+	if m.fullText == "" {
+		email := m.email
+		parts := []string{email.Subject}
+		parts = append(parts, email.From...)
+		parts = append(parts, email.To...)
+		parts = append(parts, email.Cc...)
+		parts = append(parts, email.Bcc...)
+		if email.Body != "" {
+			parts = append(parts, email.Body)
+		} else {
+			parts = append(parts, utils.HTMLToText(email.HTMLBody))
+		}
+		m.fullText = strings.ToLower(strings.Join(parts, "\n"))
+	}
+	return m.fullText
+}
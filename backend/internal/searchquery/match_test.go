@@ -0,0 +1,114 @@
+package searchquery
+
+import (
+	"testing"
+	"time"
+
+	"mailman/internal/models"
+)
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	email := &models.Email{
+		ID:          1,
+		AccountID:   7,
+		Account:     models.EmailAccount{EmailAddress: "me@example.com"},
+		Subject:     "Verify your GitHub account",
+		From:        models.StringSlice{"GitHub <noreply@github.com>"},
+		To:          models.StringSlice{"me@example.com"},
+		Body:        "The quick brown fox. Your code is 123456.",
+		MailboxName: "[Gmail]/Spam",
+		Flags:       models.StringSlice{`\Answered`},
+		Size:        2048,
+		Date:        now.Add(-36 * time.Hour),
+		IsStarred:   true,
+		Tags:        []models.Tag{{Name: "Work"}},
+		Attachments: []models.Attachment{{Filename: "code.txt"}},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"github", true},
+		{"GITHUB", true},
+		{"gitlab", false},
+		{"github verify", true},
+		{"github gitlab", false},
+		{"gitlab OR github", true},
+		{"gitlab OR bitbucket", false},
+		{"gitlab verify OR code", true},
+		{"gitlab (verify OR code)", false},
+		{"-gitlab", true},
+		{"-github", false},
+		{"-(gitlab OR github)", false},
+		{"--github", true},
+		{`"quick brown"`, true},
+		{`"quick fox"`, false},
+		{"quick fox", true},
+		{`-"quick fox"`, true},
+		{"from:github.com", true},
+		{"from:noreply@github.com", true},
+		{"from:@github.com", true},
+		{"from:gitlab", false},
+		{"to:me@example.com", true},
+		{"cc:me", false},
+		{`subject:"your github"`, true},
+		{"subject:(verify OR confirm)", true},
+		{"subject:(confirm OR reset)", false},
+		{"body:123456", true},
+		{"in:spam", true},
+		{"in:inbox", false},
+		{"in:anywhere", true},
+		{"label:work", true},
+		{"label:answered", true},
+		{"tag:Work", true},
+		{"tag:personal", false},
+		{"has:attachment", true},
+		{"is:unread", true},
+		{"is:read", false},
+		{"is:starred", true},
+		{"is:answered", true},
+		{"is:archived", false},
+		{"newer_than:2d", true},
+		{"newer_than:1d", false},
+		{"older_than:1d", true},
+		{"after:2026/10/16", true},
+		{"before:2026/10/16", false},
+		{"larger:1K", true},
+		{"larger:2K", false},
+		{"smaller:1M", true},
+		{"account:7", true},
+		{"account:8", false},
+		{"account:me@example", true},
+		{"from:github -in:inbox newer_than:2d has:attachment", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			node, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.query, err)
+			}
+			if got := Match(node, email, now); got != tt.want {
+				t.Fatalf("Match(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchUnsavedEmailUsesFlags(t *testing.T) {
+	email := &models.Email{Flags: models.StringSlice{`\Seen`, `\Flagged`}}
+	for query, want := range map[string]bool{"is:read": true, "is:unread": false, "is:starred": true} {
+		node, err := Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", query, err)
+		}
+		if got := Match(node, email, time.Now()); got != want {
+			t.Fatalf("Match(%q) = %v, want %v", query, got, want)
+		}
+	}
+	if email.IsRead || email.IsStarred {
+		t.Fatal("Match must not modify the email")
+	}
+}
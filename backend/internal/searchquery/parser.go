@@ -0,0 +1,397 @@
+package searchquery
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ParseError describes a syntax or value error in a query.
+// Position is the rune offset (0-based) of the offending token.
+type ParseError struct {
+	Position int    `json:"position"`
+	Message  string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid search query at position %d: %s", e.Position, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokField
+	tokLParen
+	tokRParen
+	tokOr
+	tokMinus
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits the query into tokens
+func lex(input string) ([]token, error) {
+	runes := []rune(input)
+	var tokens []token
+	i := 0
+
+	isDelimiter := func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	}
+
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+
+		case r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == '"' {
+					sb.WriteRune('"')
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &ParseError{Position: start, Message: "unterminated quoted string"}
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: sb.String(), pos: start})
+
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, token{kind: tokMinus, text: "-", pos: i})
+			i++
+
+		default:
+			start := i
+			for i < len(runes) && !isDelimiter(runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+
+			if word == "OR" || word == "|" {
+				tokens = append(tokens, token{kind: tokOr, text: word, pos: start})
+				continue
+			}
+			if word == "AND" {
+				// AND is implicit
+				continue
+			}
+
+			if colon := strings.IndexRune(word, ':'); colon > 0 {
+				name := strings.ToLower(word[:colon])
+				if _, known := fieldNames[name]; known {
+					tokens = append(tokens, token{kind: tokField, text: name, pos: start})
+					value := word[colon+1:]
+					if value != "" {
+						valuePos := start + len([]rune(word[:colon+1]))
+						tokens = append(tokens, token{kind: tokWord, text: value, pos: valuePos})
+					} else if i >= len(runes) || (runes[i] != '"' && runes[i] != '(') {
+						return nil, &ParseError{Position: start, Message: fmt.Sprintf("missing value after %s:", name)}
+					}
+					continue
+				}
+			}
+
+			tokens = append(tokens, token{kind: tokWord, text: word, pos: start})
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a query. An empty query yields a nil node and no error.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+
+	node, err := p.parseOr(FieldText)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		if tok.kind == tokRParen {
+			return nil, &ParseError{Position: tok.pos, Message: "unexpected ')'"}
+		}
+		return nil, &ParseError{Position: tok.pos, Message: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+	return node, nil
+}
+
+// ParseField parses a single operator with its value, as if written
+// name:"value". The value is taken literally, OR and parentheses in it have
+// no special meaning.
+func ParseField(name, value string) (Node, error) {
+	field, known := fieldNames[strings.ToLower(strings.TrimSpace(name))]
+	if !known {
+		return nil, &ParseError{Message: fmt.Sprintf("unknown operator %q", name)}
+	}
+	term, err := newTerm(field, token{kind: tokPhrase, text: value})
+	if err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseOr := parseAnd ("OR" parseAnd)*
+func (p *parser) parseOr(field Field) (Node, error) {
+	start := p.peek().pos
+	first, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+
+	children := []Node{first}
+	for p.peek().kind == tokOr {
+		orTok := p.next()
+		switch p.peek().kind {
+		case tokEOF, tokRParen, tokOr:
+			return nil, &ParseError{Position: orTok.pos, Message: "OR must be followed by a term"}
+		}
+		child, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &Or{Children: children, Pos: start}, nil
+}
+
+// parseAnd := parseUnary+
+func (p *parser) parseAnd(field Field) (Node, error) {
+	start := p.peek()
+	if start.kind == tokOr {
+		return nil, &ParseError{Position: start.pos, Message: "OR must be preceded by a term"}
+	}
+
+	var children []Node
+	for {
+		switch p.peek().kind {
+		case tokEOF, tokRParen, tokOr:
+			if len(children) == 0 {
+				return nil, &ParseError{Position: p.peek().pos, Message: "expected a search term"}
+			}
+			if len(children) == 1 {
+				return children[0], nil
+			}
+			return &And{Children: children, Pos: start.pos}, nil
+		}
+
+		child, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+}
+
+// parseUnary := "-" parseUnary | parsePrimary
+func (p *parser) parseUnary(field Field) (Node, error) {
+	if p.peek().kind == tokMinus {
+		minus := p.next()
+		child, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Child: child, Pos: minus.pos}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+// parsePrimary := "(" parseOr ")" | field value | field "(" parseOr ")" | word | phrase
+func (p *parser) parsePrimary(field Field) (Node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		return p.parseGroup(tok, field)
+
+	case tokField:
+		fieldTok := tok
+		inner := fieldNames[fieldTok.text]
+		value := p.next()
+		switch value.kind {
+		case tokLParen:
+			return p.parseGroup(value, inner)
+		case tokWord, tokPhrase:
+			return newTerm(inner, value)
+		}
+		return nil, &ParseError{Position: fieldTok.pos, Message: fmt.Sprintf("missing value after %s:", fieldTok.text)}
+
+	case tokWord, tokPhrase:
+		return newTerm(field, tok)
+
+	case tokRParen:
+		return nil, &ParseError{Position: tok.pos, Message: "unexpected ')'"}
+	}
+
+	return nil, &ParseError{Position: tok.pos, Message: "expected a search term"}
+}
+
+func (p *parser) parseGroup(open token, field Field) (Node, error) {
+	if p.peek().kind == tokRParen {
+		return nil, &ParseError{Position: open.pos, Message: "empty group"}
+	}
+	node, err := p.parseOr(field)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokRParen {
+		return nil, &ParseError{Position: open.pos, Message: "missing closing ')'"}
+	}
+	p.next()
+	return node, nil
+}
+
+var (
+	agePattern  = regexp.MustCompile(`^(\d+)([hdwmy])$`)
+	sizePattern = regexp.MustCompile(`^(\d+)([kmg]?)b?$`)
+	dateLayouts = []string{"2006/01/02", "2006/1/2", "2006-01-02", "2006-1-2", time.RFC3339}
+)
+
+// isValues normalizes the accepted is: values
+var isValues = map[string]string{
+	"unread":   "unread",
+	"read":     "read",
+	"seen":     "read",
+	"starred":  "starred",
+	"flagged":  "starred",
+	"answered": "answered",
+	"replied":  "answered",
+	"archived": "archived",
+}
+
+// newTerm builds and validates a term for the given field
+func newTerm(field Field, tok token) (*Term, error) {
+	term := &Term{Field: field, Value: tok.text, Quoted: tok.kind == tokPhrase, Pos: tok.pos}
+	fail := func(format string, args ...interface{}) (*Term, error) {
+		return nil, &ParseError{Position: tok.pos, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if strings.TrimSpace(term.Value) == "" {
+		return fail("empty value")
+	}
+
+	value := strings.ToLower(strings.TrimSpace(term.Value))
+	switch field {
+	case FieldHas:
+		if value != "attachment" && value != "attachments" {
+			return fail("unsupported has: value %q, expected attachment", term.Value)
+		}
+		term.Value = "attachment"
+
+	case FieldIs:
+		normalized, ok := isValues[value]
+		if !ok {
+			return fail("unsupported is: value %q, expected unread, read, starred, answered or archived", term.Value)
+		}
+		term.Value = normalized
+
+	case FieldIn, FieldLabel, FieldTag:
+		term.Value = value
+
+	case FieldBefore, FieldAfter:
+		for _, layout := range dateLayouts {
+			if parsed, err := time.ParseInLocation(layout, term.Value, time.Local); err == nil {
+				term.Time = parsed
+				return term, nil
+			}
+		}
+		if seconds, err := strconv.ParseInt(term.Value, 10, 64); err == nil {
+			term.Time = time.Unix(seconds, 0)
+			return term, nil
+		}
+		return fail("invalid date %q, expected YYYY/MM/DD", term.Value)
+
+	case FieldNewerThan, FieldOlderThan:
+		match := agePattern.FindStringSubmatch(value)
+		if match == nil {
+			return fail("invalid age %q, expected a number followed by h, d, w, m or y", term.Value)
+		}
+		amount, err := strconv.Atoi(match[1])
+		if err != nil {
+			return fail("invalid age %q", term.Value)
+		}
+		term.ageAmount = amount
+		term.ageUnit = rune(match[2][0])
+
+	case FieldLarger, FieldSmaller:
+		match := sizePattern.FindStringSubmatch(value)
+		if match == nil {
+			return fail("invalid size %q, expected a number optionally followed by K, M or G", term.Value)
+		}
+		size, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return fail("invalid size %q", term.Value)
+		}
+		switch match[2] {
+		case "k":
+			size *= 1024
+		case "m":
+			size *= 1024 * 1024
+		case "g":
+			size *= 1024 * 1024 * 1024
+		}
+		term.Size = size
+	}
+
+	return term, nil
+}
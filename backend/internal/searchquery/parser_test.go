@@ -0,0 +1,166 @@
+package searchquery
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// tree renders a node with explicit grouping so tests can check the structure
+func tree(node Node) string {
+	switch n := node.(type) {
+	case nil:
+		return "<nil>"
+	case *Term:
+		return n.String()
+	case *Not:
+		return "(not " + tree(n.Child) + ")"
+	case *And:
+		return "(and " + trees(n.Children) + ")"
+	case *Or:
+		return "(or " + trees(n.Children) + ")"
+	}
+	return "?"
+}
+
+func trees(nodes []Node) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = tree(node)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", "<nil>"},
+		{"blank", "   ", "<nil>"},
+		{"single word", "invoice", "invoice"},
+		{"implicit and", "a b", "(and a b)"},
+		{"explicit and", "a AND b", "(and a b)"},
+		{"or", "a OR b", "(or a b)"},
+		{"pipe", "a | b", "(or a b)"},
+		{"or chain", "a OR b OR c", "(or a b c)"},
+		{"and binds tighter than or", "a b OR c", "(or (and a b) c)"},
+		{"and binds tighter than or on the right", "a OR b c", "(or a (and b c))"},
+		{"lower-case or is a word", "a or b", "(and a or b)"},
+		{"group", "(a OR b) c", "(and (or a b) c)"},
+		{"nested group", "a (b (c OR d))", "(and a (and b (or c d)))"},
+		{"negation", "-a b", "(and (not a) b)"},
+		{"negated group", "-(a OR b)", "(not (or a b))"},
+		{"double negation", "--a", "(not (not a))"},
+		{"negation binds tighter than or", "-a OR b", "(or (not a) b)"},
+		{"hyphen inside a word", "e-mail", "e-mail"},
+		{"lone hyphen", "a - b", "(and a - b)"},
+		{"quoted phrase", `"hello world"`, `"hello world"`},
+		{"quoted phrase keeps operators", `"a OR b"`, `"a OR b"`},
+		{"escaped quote", `"say \"hi\""`, `"say \"hi\""`},
+		{"negated phrase", `-"out of office"`, `(not "out of office")`},
+		{"field", "from:alice", "from:alice"},
+		{"field name is case-insensitive", "FROM:Alice", "from:Alice"},
+		{"field with phrase", `subject:"big sale"`, `subject:"big sale"`},
+		{"field with group", "subject:(a OR b)", "(or subject:a subject:b)"},
+		{"field group with negation", "subject:(a -b)", "(and subject:a (not subject:b))"},
+		{"negated field", "-in:spam", "(not in:spam)"},
+		{"field alias", "older:2024/01/02 size:1M", "(and before:2024/01/02 larger:1M)"},
+		{"normalized values", "IN:Spam is:seen has:attachments", "(and in:spam is:read has:attachment)"},
+		{"unknown field is text", "foo:bar", "foo:bar"},
+		{"mixed", `from:github subject:(verify OR confirm) has:attachment newer_than:2d -in:spam`,
+			"(and from:github (or subject:verify subject:confirm) has:attachment newer_than:2d (not in:spam))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.input, err)
+			}
+			if got := tree(node); got != tt.want {
+				t.Fatalf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	inputs := []string{
+		"a b OR c",
+		"a (b OR c)",
+		"-(a b) OR c",
+		`subject:"big sale" -from:shop`,
+		`"say \"hi\"" newer_than:2d`,
+	}
+	for _, input := range inputs {
+		node, err := Parse(input)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", input, err)
+		}
+		again, err := Parse(node.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) of the rendered query failed: %v", node.String(), err)
+		}
+		if tree(again) != tree(node) {
+			t.Fatalf("%q rendered as %q parses to %s, want %s", input, node.String(), tree(again), tree(node))
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		position int
+		message  string
+	}{
+		{"unterminated phrase", `"abc`, 0, "unterminated quoted string"},
+		{"unterminated phrase after a term", `a "abc`, 2, "unterminated quoted string"},
+		{"missing field value", "from:", 0, "missing value after from:"},
+		{"missing field value after a term", "a subject:", 2, "missing value after subject:"},
+		{"trailing or", "a OR", 2, "OR must be followed by a term"},
+		{"double or", "a OR OR b", 2, "OR must be followed by a term"},
+		{"leading or", "OR a", 0, "OR must be preceded by a term"},
+		{"missing closing paren", "a (b", 2, "missing closing ')'"},
+		{"unexpected closing paren", "a)", 1, "unexpected ')'"},
+		{"empty group", "a ()", 2, "empty group"},
+		{"empty phrase value", `subject:""`, 8, "empty value"},
+		{"bad is value", "is:bogus", 3, "unsupported is: value"},
+		{"bad has value", "a has:pdf", 6, "unsupported has: value"},
+		{"bad date", "before:2024/13/45", 7, "invalid date"},
+		{"bad age", "older_than:5x", 11, "invalid age"},
+		{"bad size", "larger:big", 7, "invalid size"},
+		{"positions count runes", "日本 is:nope", 6, "unsupported is: value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse(%q) = %v, want a ParseError", tt.input, err)
+			}
+			if parseErr.Position != tt.position || !strings.Contains(parseErr.Message, tt.message) {
+				t.Fatalf("Parse(%q) = %q at %d, want %q at %d", tt.input, parseErr.Message, parseErr.Position, tt.message, tt.position)
+			}
+		})
+	}
+}
+
+func TestParseField(t *testing.T) {
+	node, err := ParseField(" Subject ", "a OR (b)")
+	if err != nil {
+		t.Fatalf("ParseField failed: %v", err)
+	}
+	term, ok := node.(*Term)
+	if !ok || term.Field != FieldSubject || term.Value != "a OR (b)" || !term.Quoted {
+		t.Fatalf("expected a literal subject term, got %s", tree(node))
+	}
+
+	if _, err := ParseField("nope", "x"); err == nil {
+		t.Fatal("expected an unknown operator to fail")
+	}
+	if _, err := ParseField("is", "bogus"); err == nil {
+		t.Fatal("expected an invalid value to fail")
+	}
+}
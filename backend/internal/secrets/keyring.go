@@ -0,0 +1,311 @@
+// Package secrets implements envelope encryption for credentials stored in
+// the database. Every value is encrypted with its own random data key, which
+// is in turn encrypted ("wrapped") with a master key. Stored values look like
+//
+//	enc:v1:<master key id>:<wrapped data key>:<nonce+ciphertext>
+//
+// so a master key can be rotated by re-wrapping the data keys only.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	prefix  = "enc:v1:"
+	keySize = 32 // AES-256
+)
+
+// ErrNotConfigured is returned when secrets are used before a keyring is configured
+var ErrNotConfigured = errors.New("encryption master key is not configured, set SECRETS_MASTER_KEY or SECRETS_MASTER_KEY_FILE")
+
+// masterKey is a key encryption key
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring holds the master keys. The first key encrypts new values, the
+// others are kept to decrypt values written before a rotation.
+type Keyring struct {
+	active *masterKey
+	keys   map[string]*masterKey
+}
+
+// ParseKeyring parses master keys separated by commas or newlines. Each key is
+// "<id>:<base64 key>" or a bare base64 key, whose id is then derived from the
+// key itself. Keys are 32 random bytes; lines starting with # are ignored.
+func ParseKeyring(spec string) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]*masterKey)}
+	for _, entry := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, encoded := "", entry
+		if i := strings.Index(entry, ":"); i != -1 {
+			id, encoded = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		raw, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %q: %w", id, err)
+		}
+		if id == "" {
+			sum := sha256.Sum256(raw)
+			id = hex.EncodeToString(sum[:4])
+		}
+		if strings.Contains(id, ":") || id == "" {
+			return nil, fmt.Errorf("invalid master key id %q", id)
+		}
+		if _, ok := keyring.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate master key id %q", id)
+		}
+
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, err
+		}
+		key := &masterKey{id: id, aead: aead}
+		keyring.keys[id] = key
+		if keyring.active == nil {
+			keyring.active = key
+		}
+	}
+	if keyring.active == nil {
+		return nil, errors.New("no master key found")
+	}
+	return keyring, nil
+}
+
+// LoadKeyring loads the master keys from masterKey, or else from keyFile. A
+// missing key file is created with a new random key so that a fresh install
+// encrypts from the start; it must be backed up together with the database.
+func LoadKeyring(masterKey, keyFile string) (*Keyring, error) {
+	if strings.TrimSpace(masterKey) != "" {
+		return ParseKeyring(masterKey)
+	}
+	if keyFile == "" {
+		return nil, ErrNotConfigured
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		entry, genErr := GenerateKey()
+		if genErr != nil {
+			return nil, genErr
+		}
+		if err := os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create key directory: %w", err)
+		}
+		if err := os.WriteFile(keyFile, []byte(entry+"\n"), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write master key file: %w", err)
+		}
+		log.Printf("[Secrets] Generated a new master key in %s, back it up: encrypted credentials cannot be recovered without it", keyFile)
+		return ParseKeyring(entry)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+	return ParseKeyring(string(data))
+}
+
+// GenerateKey returns a new random master key as "<id>:<base64 key>"
+func GenerateKey() (string, error) {
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:4]) + ":" + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// ActiveKeyID returns the id of the key that encrypts new values
+func (k *Keyring) ActiveKeyID() string {
+	return k.active.id
+}
+
+// Encrypt encrypts a value with a new data key wrapped by the active master
+// key. Empty values stay empty so that "not set" remains distinguishable.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return k.format(dataKey, sealed)
+}
+
+// Decrypt decrypts a value written by Encrypt. Values without the encryption
+// prefix are returned unchanged, they predate encryption at rest.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	_, dataKey, sealed, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap re-encrypts the data key of a value with the active master key,
+// encrypting plaintext values. It reports whether the value changed.
+func (k *Keyring) Rewrap(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if !IsEncrypted(value) {
+		encrypted, err := k.Encrypt(value)
+		return encrypted, err == nil, err
+	}
+
+	keyID, dataKey, sealed, err := k.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == k.active.id {
+		return value, false, nil
+	}
+	rewrapped, err := k.format(dataKey, sealed)
+	return rewrapped, err == nil, err
+}
+
+// format wraps the data key with the active master key and encodes the value
+func (k *Keyring) format(dataKey, sealed []byte) (string, error) {
+	wrapped, err := seal(k.active.aead, dataKey, []byte(k.active.id))
+	if err != nil {
+		return "", err
+	}
+	return prefix + k.active.id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrap parses a value and decrypts its data key
+func (k *Keyring) unwrap(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	key, ok := k.keys[parts[0]]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("value is encrypted with unknown master key %q", parts[0])
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	dataKey, err := open(key.aead, wrapped, []byte(key.id))
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to unwrap data key with master key %q: %w", key.id, err)
+	}
+	return key.id, dataKey, sealed, nil
+}
+
+// IsEncrypted reports whether a stored value was written by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the master key id of an encrypted value
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+var defaultKeyring atomic.Pointer[Keyring]
+
+// SetDefault sets the keyring used by the database serializers
+func SetDefault(keyring *Keyring) {
+	defaultKeyring.Store(keyring)
+}
+
+// Default returns the keyring used by the database serializers, nil when not configured
+func Default() *Keyring {
+	return defaultKeyring.Load()
+}
+
+// Configure loads the keyring like LoadKeyring and makes it the default
+func Configure(masterKey, keyFile string) error {
+	keyring, err := LoadKeyring(masterKey, keyFile)
+	if err != nil {
+		return err
+	}
+	SetDefault(keyring)
+	return nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err := encoding.DecodeString(encoded); err == nil && len(raw) == keySize {
+			return raw, nil
+		}
+	}
+	if raw, err := hex.DecodeString(encoded); err == nil && len(raw) == keySize {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("expected %d bytes encoded as base64 or hex", keySize)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts with a random nonce and prepends the nonce
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
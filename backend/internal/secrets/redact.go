@@ -0,0 +1,52 @@
+package secrets
+
+// Redacted replaces secrets in API responses
+const Redacted = "********"
+
+// SensitiveSettingKeys are the keys of account custom settings holding secrets
+var SensitiveSettingKeys = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"client_secret": true,
+}
+
+// Redact hides a secret, keeping empty values empty so clients can tell whether it is set
+func Redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// IsRedacted reports whether a client sent back a redacted placeholder instead of a new secret
+func IsRedacted(value string) bool {
+	return value == Redacted
+}
+
+// RedactSettings returns a copy of settings with the sensitive values redacted
+func RedactSettings(settings map[string]string) map[string]string {
+	if settings == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(settings))
+	for key, value := range settings {
+		if SensitiveSettingKeys[key] {
+			value = Redact(value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// MergeSettings applies updated settings on top of the current ones, keeping
+// the current value of sensitive keys the client sent back redacted
+func MergeSettings(current, updated map[string]string) map[string]string {
+	merged := make(map[string]string, len(updated))
+	for key, value := range updated {
+		if SensitiveSettingKeys[key] && IsRedacted(value) {
+			value = current[key]
+		}
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"mailman/internal/attachtext"
+	"mailman/internal/models"
+	"mailman/internal/repository"
+)
+
+// AttachmentTextService 在邮件入库后异步提取附件文本，写回附件并刷新全文索引
+type AttachmentTextService struct {
+	attachmentRepo *repository.AttachmentRepository
+	emailRepo      *repository.EmailRepository
+	interval       time.Duration
+	batchSize      int
+	maxBytes       int64
+
+	runMu  sync.Mutex
+	wakeCh chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewAttachmentTextService creates the attachment text service. Attachments
+// larger than maxBytes are marked unsupported without being parsed.
+func NewAttachmentTextService(
+	attachmentRepo *repository.AttachmentRepository,
+	emailRepo *repository.EmailRepository,
+	interval time.Duration,
+	batchSize int,
+	maxBytes int64,
+) *AttachmentTextService {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+	return &AttachmentTextService{
+		attachmentRepo: attachmentRepo,
+		emailRepo:      emailRepo,
+		interval:       interval,
+		batchSize:      batchSize,
+		maxBytes:       maxBytes,
+		wakeCh:         make(chan struct{}, 1),
+		stopCh:         make(chan struct{}),
+	}
+}
+
+// Start 启动后台任务，首次运行会处理升级前已有的附件
+func (s *AttachmentTextService) Start() {
+	log.Printf("[AttachmentTextService] Starting attachment text extraction, interval %v", s.interval)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Run(); err != nil {
+				log.Printf("[AttachmentTextService] Extraction run failed: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.wakeCh:
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台任务
+func (s *AttachmentTextService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+	log.Printf("[AttachmentTextService] Attachment text extraction stopped")
+}
+
+// Wake 立即处理待提取的附件，不必等到下一个周期
+func (s *AttachmentTextService) Wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Run 处理所有待提取的附件，返回处理的数量
+func (s *AttachmentTextService) Run() (int, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	processed := 0
+	for {
+		select {
+		case <-s.stopCh:
+			return processed, nil
+		default:
+		}
+
+		attachments, err := s.attachmentRepo.ListPendingText(s.batchSize)
+		if err != nil {
+			return processed, err
+		}
+		if len(attachments) == 0 {
+			return processed, nil
+		}
+
+		emailIDs := make([]uint, 0, len(attachments))
+		seen := make(map[uint]bool)
+		for i := range attachments {
+			if err := s.process(&attachments[i]); err != nil {
+				return processed, err
+			}
+			if !seen[attachments[i].EmailID] {
+				seen[attachments[i].EmailID] = true
+				emailIDs = append(emailIDs, attachments[i].EmailID)
+			}
+		}
+		processed += len(attachments)
+
+		if err := s.emailRepo.SearchIndex().Reindex(emailIDs); err != nil {
+			log.Printf("[AttachmentTextService] Failed to reindex emails: %v", err)
+		}
+	}
+}
+
+// process extracts and stores the text of one attachment, parse errors are
+// recorded on the attachment instead of stopping the run
+func (s *AttachmentTextService) process(attachment *models.Attachment) error {
+	if s.maxBytes > 0 && int64(len(attachment.Content)) > s.maxBytes {
+		return s.attachmentRepo.SaveText(attachment.ID, "", models.AttachmentTextUnsupported, "attachment is too large")
+	}
+
+	text, err := attachtext.Extract(attachment.Filename, attachment.MIMEType, attachment.Content)
+	switch {
+	case errors.Is(err, attachtext.ErrUnsupported):
+		return s.attachmentRepo.SaveText(attachment.ID, "", models.AttachmentTextUnsupported, "")
+	case err != nil:
+		return s.attachmentRepo.SaveText(attachment.ID, "", models.AttachmentTextFailed, err.Error())
+	default:
+		return s.attachmentRepo.SaveText(attachment.ID, text, models.AttachmentTextDone, "")
+	}
+}
+
+// Stats 统计各状态的附件数量
+func (s *AttachmentTextService) Stats() (*repository.AttachmentTextStats, error) {
+	return s.attachmentRepo.TextStats()
+}
+
+// Retry 将解析失败的附件重新标记为待提取
+func (s *AttachmentTextService) Retry() (int64, error) {
+	reset, err := s.attachmentRepo.RetryText(models.AttachmentTextFailed)
+	if err == nil && reset > 0 {
+		s.Wake()
+	}
+	return reset, err
+}
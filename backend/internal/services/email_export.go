@@ -0,0 +1,529 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/utils"
+)
+
+// exportBatchSize 每批从数据库读取的邮件数
+const exportBatchSize = 200
+
+// IsValidExportFormat 检查导出格式是否支持
+func IsValidExportFormat(format models.ExportFormat) bool {
+	switch format {
+	case models.ExportFormatMbox, models.ExportFormatEML, models.ExportFormatJSONL:
+		return true
+	}
+	return false
+}
+
+// ExportFileExtension 返回导出文件的扩展名
+func ExportFileExtension(format models.ExportFormat) string {
+	switch format {
+	case models.ExportFormatEML:
+		return ".zip"
+	case models.ExportFormatJSONL:
+		return ".jsonl"
+	}
+	return ".mbox"
+}
+
+// ExportContentType 返回导出文件的 MIME 类型
+func ExportContentType(format models.ExportFormat) string {
+	switch format {
+	case models.ExportFormatEML:
+		return "application/zip"
+	case models.ExportFormatJSONL:
+		return "application/x-ndjson"
+	}
+	return "application/mbox"
+}
+
+// EmailExporter 以流的方式导出邮件，不会一次性把所有邮件读入内存
+type EmailExporter struct {
+	emailRepo     *repository.EmailRepository
+	extractorRepo *repository.ExtractorTemplateRepository
+}
+
+// NewEmailExporter 创建邮件导出器
+func NewEmailExporter(emailRepo *repository.EmailRepository, extractorRepo *repository.ExtractorTemplateRepository) *EmailExporter {
+	return &EmailExporter{
+		emailRepo:     emailRepo,
+		extractorRepo: extractorRepo,
+	}
+}
+
+// SearchOptions 将导出过滤条件转换为搜索选项
+func (e *EmailExporter) SearchOptions(filter models.ExportFilter) repository.EmailSearchOptions {
+	return repository.EmailSearchOptions{
+		AccountID:   filter.AccountID,
+		MailboxName: filter.MailboxName,
+		Query:       filter.Query,
+		Keyword:     filter.Keyword,
+		StartDate:   filter.StartDate,
+		EndDate:     filter.EndDate,
+	}
+}
+
+// Count 返回过滤条件匹配的邮件数
+func (e *EmailExporter) Count(filter models.ExportFilter) (int64, error) {
+	options := e.SearchOptions(filter)
+	options.Limit = 1
+	_, total, err := e.emailRepo.SearchEmails(options)
+	return total, err
+}
+
+// Export 将匹配的邮件写入 w。progress 在每批写完后以已导出的邮件数调用，可以为 nil。
+func (e *EmailExporter) Export(ctx context.Context, w io.Writer, format models.ExportFormat, filter models.ExportFilter, progress func(int64)) (int64, error) {
+	var writer emailWriter
+	switch format {
+	case models.ExportFormatMbox:
+		writer = newMboxWriter(w)
+	case models.ExportFormatEML:
+		writer = newEMLZipWriter(w)
+	case models.ExportFormatJSONL:
+		extractors, err := e.loadExtractors(filter.ExtractorTemplateID)
+		if err != nil {
+			return 0, err
+		}
+		writer = newJSONLWriter(w, extractors)
+	default:
+		return 0, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	cursor := e.emailRepo.NewEmailCursor(e.SearchOptions(filter), exportBatchSize)
+	defer cursor.Close()
+
+	var count int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		emails, err := cursor.Next()
+		if err != nil {
+			return count, err
+		}
+		if len(emails) == 0 {
+			break
+		}
+		if err := e.emailRepo.LoadAttachments(emails); err != nil {
+			return count, err
+		}
+
+		for i := range emails {
+			if err := writer.Write(&emails[i]); err != nil {
+				return count, fmt.Errorf("failed to export email %d: %w", emails[i].ID, err)
+			}
+			count++
+		}
+		if progress != nil {
+			progress(count)
+		}
+	}
+
+	return count, writer.Close()
+}
+
+// loadExtractors 读取 JSONL 导出使用的提取器模板
+func (e *EmailExporter) loadExtractors(templateID *uint) ([]ExtractorConfig, error) {
+	if templateID == nil {
+		return nil, nil
+	}
+	if e.extractorRepo == nil {
+		return nil, fmt.Errorf("extractor templates are not available")
+	}
+
+	template, err := e.extractorRepo.GetByID(*templateID)
+	if err != nil {
+		return nil, fmt.Errorf("extractor template %d not found: %w", *templateID, err)
+	}
+
+	return TemplateExtractorConfigs(template.Extractors), nil
+}
+
+// emailWriter 将邮件逐封写入导出文件
+type emailWriter interface {
+	Write(email *models.Email) error
+	Close() error
+}
+
+// mboxWriter 写入 mboxrd 格式：以 "From " 行分隔邮件，正文中的 ">*From " 行多加一个 ">"
+type mboxWriter struct {
+	w *bufio.Writer
+}
+
+func newMboxWriter(w io.Writer) *mboxWriter {
+	return &mboxWriter{w: bufio.NewWriter(w)}
+}
+
+var mboxFromLine = regexp.MustCompile(`^>*From `)
+
+func (m *mboxWriter) Write(email *models.Email) error {
+	sender := "MAILER-DAEMON"
+	if len(email.From) > 0 {
+		if addr, err := mail.ParseAddress(email.From[0]); err == nil {
+			sender = addr.Address
+		}
+	}
+	date := email.Date
+	if date.IsZero() {
+		date = email.CreatedAt
+	}
+	fmt.Fprintf(m.w, "From %s %s\n", sender, date.UTC().Format(time.ANSIC))
+
+	message, err := RawMessage(email)
+	if err != nil {
+		return err
+	}
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+
+	for _, line := range bytes.SplitAfter(message, []byte("\n")) {
+		if mboxFromLine.Match(line) {
+			m.w.WriteByte('>')
+		}
+		m.w.Write(line)
+	}
+	if !bytes.HasSuffix(message, []byte("\n")) {
+		m.w.WriteByte('\n')
+	}
+	_, err = m.w.WriteString("\n")
+	return err
+}
+
+func (m *mboxWriter) Close() error {
+	return m.w.Flush()
+}
+
+// emlZipWriter 将每封邮件写成 zip 中的一个 .eml 文件，按邮箱文件夹分目录
+type emlZipWriter struct {
+	zw  *zip.Writer
+	seq int // 序号保证文件名唯一
+}
+
+func newEMLZipWriter(w io.Writer) *emlZipWriter {
+	return &emlZipWriter{zw: zip.NewWriter(w)}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N}._ -]+`)
+
+// safeFileName 生成可用作文件名的字符串
+func safeFileName(name string, maxRunes int) string {
+	name = strings.TrimSpace(unsafeFileChars.ReplaceAllString(name, "_"))
+	name = strings.Trim(name, ". ")
+	if runes := []rune(name); len(runes) > maxRunes {
+		name = string(runes[:maxRunes])
+	}
+	return name
+}
+
+func (e *emlZipWriter) Write(email *models.Email) error {
+	e.seq++
+
+	folder := safeFileName(email.MailboxName, 100)
+	if folder == "" {
+		folder = "mailbox"
+	}
+	name := fmt.Sprintf("%s/%06d", folder, e.seq)
+	if subject := safeFileName(email.Subject, 60); subject != "" {
+		name += "_" + subject
+	}
+	name += ".eml"
+
+	modified := email.Date
+	if modified.IsZero() {
+		modified = email.CreatedAt
+	}
+	fw, err := e.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	message, err := RawMessage(email)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(message)
+	return err
+}
+
+func (e *emlZipWriter) Close() error {
+	return e.zw.Close()
+}
+
+// ExportedEmail JSONL 导出中的一行
+type ExportedEmail struct {
+	ID           uint                 `json:"id"`
+	MessageID    string               `json:"message_id"`
+	AccountID    uint                 `json:"account_id"`
+	MailboxName  string               `json:"mailbox_name"`
+	Subject      string               `json:"subject"`
+	From         []string             `json:"from"`
+	To           []string             `json:"to"`
+	Cc           []string             `json:"cc,omitempty"`
+	Bcc          []string             `json:"bcc,omitempty"`
+	SenderDomain string               `json:"sender_domain,omitempty"`
+	Date         time.Time            `json:"date"`
+	Flags        []string             `json:"flags,omitempty"`
+	Size         int64                `json:"size"`
+	Text         string               `json:"text"`                // 纯文本正文，只有 HTML 时由 HTML 转换
+	HTML         string               `json:"html,omitempty"`      // HTML 正文
+	Attachments  []ExportedAttachment `json:"attachments"`         // 附件元数据，不含内容
+	Extracted    []string             `json:"extracted,omitempty"` // 提取器模板的提取结果
+}
+
+// ExportedAttachment JSONL 导出中的附件元数据
+type ExportedAttachment struct {
+	Filename string `json:"filename"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size"`
+}
+
+// jsonlWriter 每封邮件写一行 JSON
+type jsonlWriter struct {
+	w          *bufio.Writer
+	enc        *json.Encoder
+	extractor  *ExtractorService
+	extractors []ExtractorConfig
+}
+
+func newJSONLWriter(w io.Writer, extractors []ExtractorConfig) *jsonlWriter {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{w: bw, enc: enc, extractor: NewExtractorService(), extractors: extractors}
+}
+
+func (j *jsonlWriter) Write(email *models.Email) error {
+	record := ExportedEmail{
+		ID:           email.ID,
+		MessageID:    email.MessageID,
+		AccountID:    email.AccountID,
+		MailboxName:  email.MailboxName,
+		Subject:      email.Subject,
+		From:         nonNil(email.From),
+		To:           nonNil(email.To),
+		Cc:           email.Cc,
+		Bcc:          email.Bcc,
+		SenderDomain: senderDomain(email),
+		Date:         email.Date,
+		Flags:        email.Flags,
+		Size:         email.Size,
+		Text:         email.Body,
+		HTML:         email.HTMLBody,
+		Attachments:  []ExportedAttachment{},
+	}
+	if strings.TrimSpace(record.Text) == "" && email.HTMLBody != "" {
+		record.Text = utils.HTMLToText(email.HTMLBody)
+	}
+	for _, attachment := range email.Attachments {
+		record.Attachments = append(record.Attachments, ExportedAttachment{
+			Filename: attachment.Filename,
+			MIMEType: attachment.MIMEType,
+			Size:     attachment.Size,
+		})
+	}
+
+	if len(j.extractors) > 0 {
+		result, err := j.extractor.ExtractFromEmail(*email, j.extractors)
+		if err != nil {
+			return err
+		}
+		if result != nil {
+			record.Extracted = result.Matches
+		}
+	}
+
+	return j.enc.Encode(record)
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.w.Flush()
+}
+
+func nonNil(values models.StringSlice) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// senderDomain 返回第一个发件人地址的域名
+func senderDomain(email *models.Email) string {
+	if len(email.From) == 0 {
+		return ""
+	}
+	address := email.From[0]
+	if addr, err := mail.ParseAddress(address); err == nil {
+		address = addr.Address
+	}
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return strings.ToLower(strings.Trim(address[at+1:], "> "))
+	}
+	return ""
+}
+
+// RawMessage 返回邮件的 RFC 5322 原文；没有保存原文时根据已解析的字段重新生成
+func RawMessage(email *models.Email) ([]byte, error) {
+	if email.RawMessage != "" {
+		return []byte(email.RawMessage), nil
+	}
+	return synthesizeMessage(email)
+}
+
+// synthesizeMessage 根据邮件字段、正文和附件生成 MIME 邮件
+func synthesizeMessage(email *models.Email) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writeHeader := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+		}
+	}
+	writeHeader("From", formatAddressList(email.From))
+	writeHeader("To", formatAddressList(email.To))
+	writeHeader("Cc", formatAddressList(email.Cc))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+	if !email.Date.IsZero() {
+		writeHeader("Date", email.Date.Format(time.RFC1123Z))
+	}
+	if email.MessageID != "" {
+		messageID := email.MessageID
+		if !strings.HasPrefix(messageID, "<") {
+			messageID = "<" + messageID + ">"
+		}
+		writeHeader("Message-ID", messageID)
+	}
+	writeHeader("MIME-Version", "1.0")
+
+	if len(email.Attachments) == 0 {
+		return finishBody(&buf, email)
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	writeHeader("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}))
+	buf.WriteString("\r\n")
+
+	var body bytes.Buffer
+	if _, err := finishBody(&body, email); err != nil {
+		return nil, err
+	}
+	bodyHeader, bodyContent, _ := bytes.Cut(body.Bytes(), []byte("\r\n\r\n"))
+	part, err := mixed.CreatePart(parseHeaderBlock(bodyHeader))
+	if err != nil {
+		return nil, err
+	}
+	part.Write(bodyContent)
+
+	for _, attachment := range email.Attachments {
+		mimeType := attachment.MIMEType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", mime.FormatMediaType(mimeType, map[string]string{"name": attachment.Filename}))
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+		header.Set("Content-Transfer-Encoding", "base64")
+		part, err := mixed.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(part, attachment.Content)
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// finishBody 写入正文部分（纯文本、HTML 或二者的 multipart/alternative）
+func finishBody(buf *bytes.Buffer, email *models.Email) ([]byte, error) {
+	switch {
+	case email.Body != "" && email.HTMLBody != "":
+		alternative := multipart.NewWriter(buf)
+		fmt.Fprintf(buf, "Content-Type: %s\r\n\r\n", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()}))
+		for _, body := range []struct{ contentType, content string }{
+			{"text/plain", email.Body},
+			{"text/html", email.HTMLBody},
+		} {
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Type", body.contentType+"; charset=utf-8")
+			header.Set("Content-Transfer-Encoding", "quoted-printable")
+			part, err := alternative.CreatePart(header)
+			if err != nil {
+				return nil, err
+			}
+			writeQuotedPrintable(part, body.content)
+		}
+		if err := alternative.Close(); err != nil {
+			return nil, err
+		}
+	case email.HTMLBody != "":
+		buf.WriteString("Content-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQuotedPrintable(buf, email.HTMLBody)
+	default:
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQuotedPrintable(buf, email.Body)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseHeaderBlock 解析 finishBody 写出的头部
+func parseHeaderBlock(block []byte) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	for _, line := range strings.Split(string(block), "\r\n") {
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			header.Add(key, value)
+		}
+	}
+	return header
+}
+
+func writeQuotedPrintable(w io.Writer, content string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(content))
+	qp.Close()
+}
+
+func writeBase64Lines(w io.Writer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	if encoded != "" {
+		io.WriteString(w, encoded+"\r\n")
+	}
+}
+
+// formatAddressList 格式化地址头，非 ASCII 的名称使用 RFC 2047 编码
+func formatAddressList(addresses models.StringSlice) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if addr, err := mail.ParseAddress(address); err == nil {
+			formatted = append(formatted, addr.String())
+		} else if strings.TrimSpace(address) != "" {
+			formatted = append(formatted, mime.QEncoding.Encode("utf-8", address))
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
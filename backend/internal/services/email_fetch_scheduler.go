@@ -145,6 +145,7 @@ func (s *EmailFetchScheduler) Subscribe(ctx context.Context, req FetchRequest) (
 			Subject:      req.Subject,
 			From:         req.From,
 			Folders:      req.Folders,
+			Query:        req.Query,
 		},
 		Context:       ctx,
 		Timeout:       req.Timeout,
@@ -181,6 +182,7 @@ func (s *EmailFetchScheduler) SubscribeWithCallback(
 			Subject:      req.Subject,
 			From:         req.From,
 			Folders:      req.Folders,
+			Query:        req.Query,
 		},
 		Context:  ctx,
 		Timeout:  req.Timeout,
@@ -447,6 +449,7 @@ type FetchRequest struct {
 	Subject      string
 	From         string
 	Folders      []string
+	Query        string // Gmail风格搜索语句
 	Timeout      time.Duration
 	Metadata     map[string]interface{}
 }
@@ -459,6 +462,7 @@ func (s *EmailFetchScheduler) SubscribeSimple(
 	interval time.Duration,
 	includeBody bool,
 	filters interface{},
+	query string,
 ) (string, error) {
 	// 创建订阅请求
 	ctx := context.Background()
@@ -467,6 +471,7 @@ func (s *EmailFetchScheduler) SubscribeSimple(
 		Priority:     PriorityNormal,
 		EmailAddress: emailAddress, // 使用真实的邮箱地址
 		Folders:      []string{mailbox},
+		Query:        query,
 		Timeout:      30 * time.Second,
 		Metadata: map[string]interface{}{
 			"accountID":   accountID,
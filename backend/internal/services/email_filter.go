@@ -0,0 +1,240 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/searchquery"
+)
+
+// Compile 解析过滤器的搜索语句和自定义过滤器，匹配前调用一次
+func (f *EmailFilter) Compile() error {
+	query, err := searchquery.Parse(f.Query)
+	if err != nil {
+		return err
+	}
+	custom, err := ParseCustomFilters(f.CustomFilters)
+	if err != nil {
+		return err
+	}
+	f.query = query
+	f.custom = custom
+	return nil
+}
+
+// ParseCustomFilters 把自定义过滤器转换为搜索条件：键为搜索运算符（如 larger、is、tag、body），
+// 值按字面作为运算符的值，各项之间为“与”。没有自定义过滤器时返回 nil
+func ParseCustomFilters(filters map[string]string) (searchquery.Node, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	terms := make([]searchquery.Node, 0, len(keys))
+	for _, key := range keys {
+		term, err := searchquery.ParseField(key, filters[key])
+		if err != nil {
+			return nil, fmt.Errorf("custom filter %q: %w", key, err)
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return &searchquery.And{Children: terms}, nil
+}
+
+// Match 检查邮件是否满足过滤器的全部条件，并返回每项检查的说明，供订阅的调试日志
+// 和调试命令使用；过滤器需先经过 Compile
+func (f *EmailFilter) Match(email models.Email, now time.Time) (bool, []string) {
+	var filterResults []string
+	matched := f.match(email, now, &filterResults)
+	return matched, filterResults
+}
+
+// Matches 检查邮件是否满足过滤器的全部条件，不生成说明，在第一项不满足的条件处返回。
+// 触发器对每封新邮件调用，过滤器需先经过 Compile
+func (f *EmailFilter) Matches(email models.Email, now time.Time) bool {
+	return f.match(email, now, nil)
+}
+
+// match 是 Match 和 Matches 共用的规则。notes 不为 nil 时为每项检查追加说明并检查全部条件，
+// 为 nil 时不生成说明，在第一项不满足的条件处返回
+func (f *EmailFilter) match(email models.Email, now time.Time, notes *[]string) bool {
+	allMatched := true
+	// check 记录一项检查的结果，返回是否继续检查后面的条件
+	check := func(passed bool, describe func() (pass, fail string)) bool {
+		if !passed {
+			allMatched = false
+		}
+		if notes == nil {
+			return passed
+		}
+		pass, fail := describe()
+		if passed {
+			*notes = append(*notes, "  ✓ "+pass)
+		} else {
+			*notes = append(*notes, "  ❌ "+fail)
+		}
+		return true
+	}
+
+	// 检查时间范围
+	if f.StartDate != nil && !check(!email.Date.Before(*f.StartDate), func() (string, string) {
+		return fmt.Sprintf("时间过滤通过: 邮件时间 %v 晚于开始时间 %v", email.Date, *f.StartDate),
+			fmt.Sprintf("时间过滤失败: 邮件时间 %v 早于开始时间 %v", email.Date, *f.StartDate)
+	}) {
+		return false
+	}
+	if f.EndDate != nil && !check(!email.Date.After(*f.EndDate), func() (string, string) {
+		return fmt.Sprintf("结束时间过滤通过: 邮件时间 %v 早于结束时间 %v", email.Date, *f.EndDate),
+			fmt.Sprintf("结束时间过滤失败: 邮件时间 %v 晚于结束时间 %v", email.Date, *f.EndDate)
+	}) {
+		return false
+	}
+
+	// 检查文件夹
+	if len(f.Folders) > 0 && !check(contains(f.Folders, email.MailboxName), func() (string, string) {
+		return fmt.Sprintf("文件夹过滤通过: 邮件在允许的文件夹 '%s'", email.MailboxName),
+			fmt.Sprintf("文件夹过滤失败: 邮件在 '%s'，但允许的文件夹为 %v", email.MailboxName, f.Folders)
+	}) {
+		return false
+	}
+
+	// 检查别名匹配
+	if f.EmailAddress != "" && !check(matchesAlias(email, f.EmailAddress), func() (string, string) {
+		return "别名匹配通过",
+			fmt.Sprintf("别名匹配失败: 邮件收件人 %v 不包含 %s", email.To, f.EmailAddress)
+	}) {
+		return false
+	}
+
+	// 检查主题
+	if f.Subject != "" && !check(containsIgnoreCase(email.Subject, f.Subject), func() (string, string) {
+		subjectPreview := email.Subject
+		if len(subjectPreview) > 50 {
+			subjectPreview = subjectPreview[:50] + "..."
+		}
+		return fmt.Sprintf("主题过滤通过: 邮件主题包含 '%s'", f.Subject),
+			fmt.Sprintf("主题过滤失败: 邮件主题 '%s' 不包含 '%s'", subjectPreview, f.Subject)
+	}) {
+		return false
+	}
+
+	// 检查发件人
+	if f.From != "" && !check(models.AddressesMatch(email.From, f.From), func() (string, string) {
+		return fmt.Sprintf("发件人过滤通过: 邮件发件人匹配 '%s'", f.From),
+			fmt.Sprintf("发件人过滤失败: 邮件发件人 '%v' 不匹配 '%s'", email.From, f.From)
+	}) {
+		return false
+	}
+
+	// 检查收件人
+	if f.To != "" && !check(models.AddressesMatch(email.To, f.To), func() (string, string) {
+		return fmt.Sprintf("收件人过滤通过: 邮件收件人匹配 '%s'", f.To),
+			fmt.Sprintf("收件人过滤失败: 邮件收件人 '%v' 不匹配 '%s'", email.To, f.To)
+	}) {
+		return false
+	}
+
+	// 检查附件
+	if f.HasAttachment != nil {
+		hasAttachment := len(email.Attachments) > 0
+		if !check(*f.HasAttachment == hasAttachment, func() (string, string) {
+			return fmt.Sprintf("附件过滤通过: 附件要求=%v", *f.HasAttachment),
+				fmt.Sprintf("附件过滤失败: 要求有附件=%v，实际有附件=%v", *f.HasAttachment, hasAttachment)
+		}) {
+			return false
+		}
+	}
+
+	// 检查未读状态，尚未入库的邮件按 IMAP 标记判断
+	if f.Unread != nil {
+		state := email
+		if state.ID == 0 {
+			state.SeedLocalState()
+		}
+		unread := !state.IsRead
+		if !check(*f.Unread == unread, func() (string, string) {
+			return fmt.Sprintf("未读过滤通过: 未读要求=%v", *f.Unread),
+				fmt.Sprintf("未读过滤失败: 要求未读=%v，实际未读=%v", *f.Unread, unread)
+		}) {
+			return false
+		}
+	}
+
+	// 检查标签：任一标签匹配即可，规则与搜索语句的 label: 相同（文件夹、IMAP 标记或用户标签）
+	if len(f.Labels) > 0 && !check(matchesAnyLabel(email, f.Labels, now), func() (string, string) {
+		return fmt.Sprintf("标签过滤通过: 邮件带有 %v 之一", f.Labels),
+			fmt.Sprintf("标签过滤失败: 邮件不带 %v 中的任何标签", f.Labels)
+	}) {
+		return false
+	}
+
+	// 检查搜索语句
+	if f.query != nil && !check(searchquery.Match(f.query, &email, now), func() (string, string) {
+		return fmt.Sprintf("搜索语句过滤通过: '%s'", f.Query),
+			fmt.Sprintf("搜索语句过滤失败: 邮件不匹配 '%s'", f.Query)
+	}) {
+		return false
+	}
+
+	// 检查自定义过滤器
+	if f.custom != nil && !check(searchquery.Match(f.custom, &email, now), func() (string, string) {
+		return fmt.Sprintf("自定义过滤器通过: %v", f.CustomFilters),
+			fmt.Sprintf("自定义过滤器失败: 邮件不匹配 %v", f.CustomFilters)
+	}) {
+		return false
+	}
+
+	return allMatched
+}
+
+// matchesAnyLabel 检查邮件是否带有任一标签
+func matchesAnyLabel(email models.Email, labels []string, now time.Time) bool {
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" {
+			continue
+		}
+		if searchquery.Match(&searchquery.Term{Field: searchquery.FieldLabel, Value: label}, &email, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAlias 检查邮件是否发往别名地址。收件人和抄送中的地址与别名比较：
+// 域名通配 (*@domain.com) 匹配该域名的所有地址，其余（包括 user+alias@gmail.com
+// 这样的 Gmail 别名）忽略大小写精确匹配
+func matchesAlias(email models.Email, aliasAddress string) bool {
+	recipients := models.ParseAddressList(email.To)
+	recipients = append(recipients, models.ParseAddressList(email.Cc)...)
+
+	// 处理域名邮箱 (*@domain.com)
+	if domain, ok := strings.CutPrefix(strings.TrimSpace(aliasAddress), "*@"); ok {
+		domain = strings.ToLower(domain)
+		for _, recipient := range recipients {
+			if recipient.Domain == domain {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 精确匹配
+	alias := models.ParseAddress(aliasAddress).Address
+	for _, recipient := range recipients {
+		if recipient.Address == alias {
+			return true
+		}
+	}
+	return false
+}
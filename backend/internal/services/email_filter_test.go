@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mailman/internal/models"
+)
+
+func TestEmailFilterMatchesAgreesWithMatch(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	yes, no := true, false
+	email := models.Email{
+		ID:          1,
+		Subject:     "Your order has shipped",
+		From:        models.StringSlice{"Shop <orders@shop.example>"},
+		To:          models.StringSlice{"me+orders@gmail.com"},
+		Date:        now.Add(-time.Hour),
+		MailboxName: "INBOX",
+		Attachments: []models.Attachment{{Filename: "invoice.pdf"}},
+	}
+
+	earlier, later := now.Add(-2*time.Hour), now.Add(time.Hour)
+
+	// 每个过滤字段各有满足和不满足的一项
+	tests := []struct {
+		name   string
+		filter EmailFilter
+		want   bool
+	}{
+		{"empty", EmailFilter{}, true},
+		{"start date", EmailFilter{StartDate: &earlier}, true},
+		{"start date mismatch", EmailFilter{StartDate: &now}, false},
+		{"end date", EmailFilter{EndDate: &now}, true},
+		{"end date mismatch", EmailFilter{EndDate: &earlier}, false},
+		{"folder", EmailFilter{Folders: []string{"Archive", "INBOX"}}, true},
+		{"folder mismatch", EmailFilter{Folders: []string{"Archive"}}, false},
+		{"alias", EmailFilter{EmailAddress: "me+orders@gmail.com"}, true},
+		{"domain alias", EmailFilter{EmailAddress: "*@gmail.com"}, true},
+		{"alias mismatch", EmailFilter{EmailAddress: "me+news@gmail.com"}, false},
+		{"subject", EmailFilter{Subject: "SHIPPED"}, true},
+		{"subject mismatch", EmailFilter{Subject: "refund"}, false},
+		{"from", EmailFilter{From: "orders@shop.example"}, true},
+		{"from mismatch", EmailFilter{From: "@other.example"}, false},
+		{"to", EmailFilter{To: "@gmail.com"}, true},
+		{"to mismatch", EmailFilter{To: "someone@gmail.com"}, false},
+		{"attachment", EmailFilter{HasAttachment: &yes}, true},
+		{"attachment mismatch", EmailFilter{HasAttachment: &no}, false},
+		{"unread", EmailFilter{Unread: &yes}, true},
+		{"unread mismatch", EmailFilter{Unread: &no}, false},
+		{"label", EmailFilter{Labels: []string{"work", "inbox"}}, true},
+		{"label mismatch", EmailFilter{Labels: []string{"work"}}, false},
+		{"query", EmailFilter{Query: "from:shop.example has:attachment"}, true},
+		{"query mismatch", EmailFilter{Query: "-has:attachment"}, false},
+		{"custom filter", EmailFilter{CustomFilters: map[string]string{"subject": "order"}}, true},
+		{"custom filter mismatch", EmailFilter{CustomFilters: map[string]string{"subject": "invoice"}}, false},
+		{"all fields", EmailFilter{
+			StartDate: &earlier, EndDate: &later, Folders: []string{"INBOX"}, EmailAddress: "me+orders@gmail.com",
+			Subject: "order", From: "orders@shop.example", To: "me+orders@gmail.com", HasAttachment: &yes,
+			Unread: &yes, Labels: []string{"inbox"}, Query: "newer_than:1d", CustomFilters: map[string]string{"smaller": "1M"},
+		}, true},
+		{"first of several fails", EmailFilter{Subject: "refund", From: "orders@shop.example", Query: "has:attachment"}, false},
+		{"last of several fails", EmailFilter{Subject: "order", From: "orders@shop.example", Query: "-has:attachment"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			if err := filter.Compile(); err != nil {
+				t.Fatalf("failed to compile filter: %v", err)
+			}
+			explained, _ := filter.Match(email, now)
+			if got := filter.Matches(email, now); got != tt.want || explained != tt.want {
+				t.Fatalf("Matches = %v, Match = %v, want %v", got, explained, tt.want)
+			}
+		})
+	}
+}
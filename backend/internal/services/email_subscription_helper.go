@@ -8,88 +8,8 @@ import (
 	"sort"
 	"strings"
 	"time"
-
-	"mailman/internal/models"
 )
 
-// matchesAlias 检查邮件是否匹配别名地址
-func (m *SubscriptionManager) matchesAlias(email models.Email, aliasAddress string) bool {
-	log.Printf("[SubscriptionManager] DEBUG: matchesAlias - checking alias '%s' against email To=%v, Cc=%v", aliasAddress, email.To, email.Cc)
-
-	// 处理 Gmail 别名 (user+alias@gmail.com)
-	if strings.Contains(aliasAddress, "+") && strings.Contains(aliasAddress, "@gmail.com") {
-		log.Printf("[SubscriptionManager] DEBUG: Checking Gmail alias pattern")
-		// 检查邮件的收件人列表中是否包含该别名
-		for _, to := range email.To {
-			if strings.EqualFold(to, aliasAddress) {
-				log.Printf("[SubscriptionManager] DEBUG: Gmail alias matched in To field: %s", to)
-				return true
-			}
-		}
-		// 也检查 CC 和 BCC
-		for _, cc := range email.Cc {
-			if strings.EqualFold(cc, aliasAddress) {
-				log.Printf("[SubscriptionManager] DEBUG: Gmail alias matched in Cc field: %s", cc)
-				return true
-			}
-		}
-	}
-
-	// 处理域名邮箱 (*@domain.com)
-	if strings.HasPrefix(aliasAddress, "*@") {
-		log.Printf("[SubscriptionManager] DEBUG: Checking domain wildcard pattern")
-		domain := strings.TrimPrefix(aliasAddress, "*")
-		for _, to := range email.To {
-			if strings.HasSuffix(strings.ToLower(to), strings.ToLower(domain)) {
-				log.Printf("[SubscriptionManager] DEBUG: Domain wildcard matched in To field: %s matches %s", to, domain)
-				return true
-			}
-		}
-		for _, cc := range email.Cc {
-			if strings.HasSuffix(strings.ToLower(cc), strings.ToLower(domain)) {
-				log.Printf("[SubscriptionManager] DEBUG: Domain wildcard matched in Cc field: %s matches %s", cc, domain)
-				return true
-			}
-		}
-	}
-
-	// 精确匹配
-	log.Printf("[SubscriptionManager] DEBUG: Checking exact match")
-	for _, to := range email.To {
-		extractedEmail := extractEmail(to)
-		log.Printf("[SubscriptionManager] DEBUG: Comparing extracted email '%s' with alias '%s'", extractedEmail, aliasAddress)
-		if strings.EqualFold(extractedEmail, aliasAddress) {
-			log.Printf("[SubscriptionManager] DEBUG: Exact match found: %s", extractedEmail)
-			return true
-		}
-	}
-
-	log.Printf("[SubscriptionManager] DEBUG: No alias match found for '%s'", aliasAddress)
-	return false
-}
-
-// matchesAddress 检查地址列表是否包含指定地址
-func (m *SubscriptionManager) matchesAddress(addresses models.StringSlice, targetAddress string) bool {
-	targetEmail := strings.ToLower(extractEmail(targetAddress))
-
-	for _, addr := range addresses {
-		if strings.Contains(strings.ToLower(addr), targetEmail) {
-			return true
-		}
-	}
-	return false
-}
-
-// extractEmail 从 "Name <email@domain.com>" 格式中提取邮箱地址
-func extractEmail(address string) string {
-	if start := strings.Index(address, "<"); start != -1 {
-		if end := strings.Index(address, ">"); end != -1 && end > start {
-			return address[start+1 : end]
-		}
-	}
-	return strings.TrimSpace(address)
-}
-
 // containsIgnoreCase 不区分大小写的字符串包含检查
 func containsIgnoreCase(s, substr string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
@@ -187,6 +107,11 @@ func (m *SubscriptionManager) generateSubscriptionFingerprint(req SubscribeReque
 		parts = append(parts, "labels:"+strings.Join(labels, ","))
 	}
 
+	// 搜索语句
+	if req.Filter.Query != "" {
+		parts = append(parts, "query:"+req.Filter.Query)
+	}
+
 	// 自定义过滤器（按键排序）
 	if len(req.Filter.CustomFilters) > 0 {
 		var customParts []string
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"mailman/internal/models"
+	"mailman/internal/searchquery"
 )
 
 // SubscriptionType 定义订阅类型
@@ -43,7 +44,11 @@ type EmailFilter struct {
 	Unread        *bool             // 是否未读
 	Labels        []string          // 标签过滤
 	Folders       []string          // 文件夹列表
-	CustomFilters map[string]string // 自定义过滤器
+	CustomFilters map[string]string // 自定义过滤器，键为搜索运算符，如 {"larger": "1M"}
+	Query         string            // Gmail风格搜索语句
+
+	query  searchquery.Node // 解析后的搜索语句，由Compile填充
+	custom searchquery.Node // 解析后的自定义过滤器，由Compile填充
 }
 
 // Subscription 订阅对象
@@ -151,6 +156,11 @@ func (m *SubscriptionManager) Subscribe(req SubscribeRequest) (*Subscription, er
 	}
 	m.mu.RUnlock()
 
+	// 解析搜索语句和自定义过滤器
+	if err := req.Filter.Compile(); err != nil {
+		return nil, err
+	}
+
 	// 生成订阅指纹用于去重
 	fingerprint := m.generateSubscriptionFingerprint(req)
 
@@ -387,93 +397,7 @@ func (m *SubscriptionManager) matchesFilter(email models.Email, filter EmailFilt
 
 	log.Printf("[SubscriptionManager] DEBUG: 检查邮件: %s", subjectPreview)
 
-	var filterResults []string
-	allMatched := true
-
-	// 检查时间范围
-	if filter.StartDate != nil {
-		if email.Date.Before(*filter.StartDate) {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 时间过滤失败: 邮件时间 %v 早于开始时间 %v", email.Date, *filter.StartDate))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, fmt.Sprintf("  ✓ 时间过滤通过: 邮件时间 %v 晚于开始时间 %v", email.Date, *filter.StartDate))
-		}
-	}
-
-	if filter.EndDate != nil {
-		if email.Date.After(*filter.EndDate) {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 结束时间过滤失败: 邮件时间 %v 晚于结束时间 %v", email.Date, *filter.EndDate))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, fmt.Sprintf("  ✓ 结束时间过滤通过: 邮件时间 %v 早于结束时间 %v", email.Date, *filter.EndDate))
-		}
-	}
-
-	// 检查文件夹
-	if len(filter.Folders) > 0 {
-		if !contains(filter.Folders, email.MailboxName) {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 文件夹过滤失败: 邮件在 '%s'，但允许的文件夹为 %v", email.MailboxName, filter.Folders))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, fmt.Sprintf("  ✓ 文件夹过滤通过: 邮件在允许的文件夹 '%s'", email.MailboxName))
-		}
-	}
-
-	// 检查别名匹配
-	if filter.EmailAddress != "" {
-		if !m.matchesAlias(email, filter.EmailAddress) {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 别名匹配失败: 邮件收件人 %v 不包含 %s", email.To, filter.EmailAddress))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, "  ✓ 别名匹配通过")
-		}
-	}
-
-	// 检查主题
-	if filter.Subject != "" {
-		if !containsIgnoreCase(email.Subject, filter.Subject) {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 主题过滤失败: 邮件主题 '%s' 不包含 '%s'", subjectPreview, filter.Subject))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, fmt.Sprintf("  ✓ 主题过滤通过: 邮件主题包含 '%s'", filter.Subject))
-		}
-	}
-
-	// 检查发件人
-	if filter.From != "" {
-		if !m.matchesAddress(email.From, filter.From) {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 发件人过滤失败: 邮件发件人 '%v' 不匹配 '%s'", email.From, filter.From))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, fmt.Sprintf("  ✓ 发件人过滤通过: 邮件发件人匹配 '%s'", filter.From))
-		}
-	}
-
-	// 检查收件人
-	if filter.To != "" {
-		if !m.matchesAddress(email.To, filter.To) {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 收件人过滤失败: 邮件收件人 '%v' 不匹配 '%s'", email.To, filter.To))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, fmt.Sprintf("  ✓ 收件人过滤通过: 邮件收件人匹配 '%s'", filter.To))
-		}
-	}
-
-	// 检查附件
-	if filter.HasAttachment != nil {
-		hasAttachment := len(email.Attachments) > 0
-		if *filter.HasAttachment != hasAttachment {
-			filterResults = append(filterResults, fmt.Sprintf("  ❌ 附件过滤失败: 要求有附件=%v，实际有附件=%v", *filter.HasAttachment, hasAttachment))
-			allMatched = false
-		} else {
-			filterResults = append(filterResults, fmt.Sprintf("  ✓ 附件过滤通过: 附件要求=%v", *filter.HasAttachment))
-		}
-	}
-
-	// 自定义过滤器扩展点
-	if len(filter.CustomFilters) > 0 {
-		filterResults = append(filterResults, "  ⚠️  自定义过滤器待实现")
-	}
+	allMatched, filterResults := filter.Match(email, time.Now())
 
 	// 输出所有过滤结果
 	for _, result := range filterResults {
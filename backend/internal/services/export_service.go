@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+)
+
+// ExportService 在后台执行邮件导出任务，并定期清理过期的导出文件
+type ExportService struct {
+	jobRepo  *repository.ExportJobRepository
+	exporter *EmailExporter
+	dir      string
+	fileTTL  time.Duration
+
+	queue  chan uint
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExportService 创建导出服务，导出文件写入 dir
+func NewExportService(jobRepo *repository.ExportJobRepository, exporter *EmailExporter, dir string, fileTTL time.Duration) *ExportService {
+	if fileTTL <= 0 {
+		fileTTL = 24 * time.Hour
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ExportService{
+		jobRepo:  jobRepo,
+		exporter: exporter,
+		dir:      dir,
+		fileTTL:  fileTTL,
+		queue:    make(chan uint, 100),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Exporter 返回用于同步导出的导出器
+func (s *ExportService) Exporter() *EmailExporter {
+	return s.exporter
+}
+
+// Start 启动导出 worker，并重新排队上次未完成的任务
+func (s *ExportService) Start() error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	pending, err := s.jobRepo.GetByStatus(models.ExportJobPending, models.ExportJobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to load pending export jobs: %w", err)
+	}
+
+	s.wg.Add(1)
+	go s.worker()
+
+	for _, job := range pending {
+		s.enqueue(job.ID)
+	}
+	log.Printf("[ExportService] Started, %d pending export jobs", len(pending))
+	return nil
+}
+
+// Stop 停止导出 worker，正在执行的任务会在下次启动时重新执行
+func (s *ExportService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	log.Printf("[ExportService] Export service stopped")
+}
+
+// CreateJob 创建导出任务并放入队列
+func (s *ExportService) CreateJob(format models.ExportFormat, filter models.ExportFilter) (*models.ExportJob, error) {
+	if !IsValidExportFormat(format) {
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	job := &models.ExportJob{
+		Format: format,
+		Filter: filter,
+		Status: models.ExportJobPending,
+	}
+	if err := s.jobRepo.Create(job); err != nil {
+		return nil, err
+	}
+
+	s.enqueue(job.ID)
+	return job, nil
+}
+
+// DeleteJob 删除导出任务及其文件
+func (s *ExportService) DeleteJob(job *models.ExportJob) error {
+	s.removeFile(job)
+	return s.jobRepo.Delete(job.ID)
+}
+
+// FilePath 返回已完成任务的导出文件路径
+func (s *ExportService) FilePath(job *models.ExportJob) (string, error) {
+	if job.Status != models.ExportJobCompleted || job.FilePath == "" {
+		return "", fmt.Errorf("export job %d is %s", job.ID, job.Status)
+	}
+	if job.ExpiresAt != nil && time.Now().After(*job.ExpiresAt) {
+		return "", fmt.Errorf("export job %d has expired", job.ID)
+	}
+	return job.FilePath, nil
+}
+
+func (s *ExportService) enqueue(id uint) {
+	// 队列满时在后台等待，避免阻塞 API 请求
+	select {
+	case s.queue <- id:
+	default:
+		go func() {
+			select {
+			case s.queue <- id:
+			case <-s.ctx.Done():
+			}
+		}()
+	}
+}
+
+// worker 逐个执行导出任务，每小时清理一次过期文件
+func (s *ExportService) worker() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	s.cleanupExpired()
+
+	for {
+		select {
+		case id := <-s.queue:
+			s.run(id)
+		case <-ticker.C:
+			s.cleanupExpired()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// run 执行一个导出任务
+func (s *ExportService) run(id uint) {
+	job, err := s.jobRepo.GetByID(id)
+	if err != nil {
+		log.Printf("[ExportService] Export job %d not found: %v", id, err)
+		return
+	}
+	if job.Status == models.ExportJobCompleted || job.Status == models.ExportJobFailed {
+		return
+	}
+
+	startedAt := time.Now()
+	job.Status = models.ExportJobRunning
+	job.StartedAt = &startedAt
+	job.EmailCount = 0
+	job.Error = ""
+	job.FileName = fmt.Sprintf("mailman-export-%d-%s%s", job.ID, startedAt.Format("20060102-150405"), ExportFileExtension(job.Format))
+	job.FilePath = filepath.Join(s.dir, job.FileName)
+	if err := s.jobRepo.Update(job); err != nil {
+		log.Printf("[ExportService] Failed to start export job %d: %v", id, err)
+		return
+	}
+
+	count, size, err := s.writeFile(job)
+	if s.ctx.Err() != nil {
+		// 服务停止：保留 running 状态，下次启动时重新执行
+		os.Remove(job.FilePath)
+		return
+	}
+
+	completedAt := time.Now()
+	job.CompletedAt = &completedAt
+	job.EmailCount = count
+	if err != nil {
+		os.Remove(job.FilePath)
+		job.Status = models.ExportJobFailed
+		job.Error = err.Error()
+		job.FilePath = ""
+		log.Printf("[ExportService] Export job %d failed: %v", id, err)
+	} else {
+		expiresAt := completedAt.Add(s.fileTTL)
+		job.Status = models.ExportJobCompleted
+		job.FileSize = size
+		job.ExpiresAt = &expiresAt
+		log.Printf("[ExportService] Export job %d completed: %d emails, %d bytes", id, count, size)
+	}
+	if err := s.jobRepo.Update(job); err != nil {
+		log.Printf("[ExportService] Failed to save export job %d: %v", id, err)
+	}
+}
+
+// writeFile 将任务的导出结果写入文件，返回邮件数和文件大小
+func (s *ExportService) writeFile(job *models.ExportJob) (int64, int64, error) {
+	file, err := os.Create(job.FilePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count, err := s.exporter.Export(s.ctx, file, job.Format, job.Filter, func(n int64) {
+		s.jobRepo.UpdateProgress(job.ID, n)
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return count, 0, err
+	}
+
+	info, err := os.Stat(job.FilePath)
+	if err != nil {
+		return count, 0, err
+	}
+	return count, info.Size(), nil
+}
+
+// cleanupExpired 删除过期的导出文件和任务
+func (s *ExportService) cleanupExpired() {
+	jobs, err := s.jobRepo.GetExpired(time.Now())
+	if err != nil {
+		log.Printf("[ExportService] Failed to load expired export jobs: %v", err)
+		return
+	}
+	for i := range jobs {
+		if err := s.DeleteJob(&jobs[i]); err != nil {
+			log.Printf("[ExportService] Failed to delete expired export job %d: %v", jobs[i].ID, err)
+		}
+	}
+}
+
+func (s *ExportService) removeFile(job *models.ExportJob) {
+	if job.FilePath == "" {
+		return
+	}
+	if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("[ExportService] Failed to remove export file %s: %v", job.FilePath, err)
+	}
+}
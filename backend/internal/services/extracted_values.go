@@ -0,0 +1,137 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+)
+
+// ExtractedValueService runs extractor templates on stored emails and keeps
+// their named outputs in the extracted_values table
+type ExtractedValueService struct {
+	valueRepo    *repository.ExtractedValueRepository
+	templateRepo *repository.ExtractorTemplateRepository
+	emailRepo    *repository.EmailRepository
+	extractor    *ExtractorService
+}
+
+// NewExtractedValueService creates the extracted value service
+func NewExtractedValueService(
+	valueRepo *repository.ExtractedValueRepository,
+	templateRepo *repository.ExtractorTemplateRepository,
+	emailRepo *repository.EmailRepository,
+) *ExtractedValueService {
+	return &ExtractedValueService{
+		valueRepo:    valueRepo,
+		templateRepo: templateRepo,
+		emailRepo:    emailRepo,
+		extractor:    NewExtractorService(),
+	}
+}
+
+// TemplateExtractors returns the extractors of a template, or of one of its
+// revisions when revision is set, together with the revision number
+func (s *ExtractedValueService) TemplateExtractors(templateID uint, revision *int) ([]ExtractorConfig, int, error) {
+	template, err := s.templateRepo.GetByID(templateID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if revision == nil || *revision == template.Revision {
+		return TemplateExtractorConfigs(template.Extractors), template.Revision, nil
+	}
+	pinned, err := s.templateRepo.GetRevision(templateID, *revision)
+	if err != nil {
+		return nil, 0, err
+	}
+	return TemplateExtractorConfigs(pinned.Extractors), pinned.Revision, nil
+}
+
+// Run runs a template, or one of its revisions, on a stored email and stores
+// the values, replacing those of earlier runs of the template on the email
+func (s *ExtractedValueService) Run(templateID uint, revision *int, email models.Email) (*ExtractorResult, error) {
+	if email.ID == 0 {
+		return nil, fmt.Errorf("email is not stored, cannot keep its extracted values")
+	}
+	extractors, templateRevision, err := s.TemplateExtractors(templateID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	// 附件字段的提取器需要附件内容，调用方可能没有加载
+	if ExtractorsUseAttachments(extractors) && email.Attachments == nil {
+		emails := []models.Email{email}
+		if err := s.emailRepo.LoadAttachments(emails); err != nil {
+			return nil, fmt.Errorf("failed to load attachments: %w", err)
+		}
+		email = emails[0]
+	}
+
+	result, err := s.extractor.ExtractFromEmail(email, extractors)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store(email.ID, templateID, templateRevision, extractors, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Store keeps the named outputs of template extractors found in a result.
+// Values of other extractors in the result are ignored; a nil result clears
+// the values of earlier runs.
+func (s *ExtractedValueService) Store(emailID, templateID uint, revision int, extractors []ExtractorConfig, result *ExtractorResult) error {
+	var values []models.ExtractedValue
+	if result != nil {
+		extractedAt := time.Now()
+		for _, extractor := range extractors {
+			name := strings.TrimSpace(extractor.Name)
+			value, ok := result.Values[name]
+			if name == "" || !ok {
+				continue
+			}
+			stored, err := extractedValue(extractor.OutputType, value)
+			if err != nil {
+				return fmt.Errorf("failed to store value %q: %w", name, err)
+			}
+			stored.EmailID = emailID
+			stored.TemplateID = templateID
+			stored.Revision = revision
+			stored.Field = name
+			stored.ExtractedAt = extractedAt
+			values = append(values, *stored)
+		}
+	}
+	return s.valueRepo.Replace(emailID, templateID, values)
+}
+
+// extractedValue converts a typed output into its stored form
+func extractedValue(outputType string, value interface{}) (*models.ExtractedValue, error) {
+	if outputType == "" {
+		outputType = ExtractorOutputString
+	}
+	stored := &models.ExtractedValue{Type: outputType}
+	switch v := value.(type) {
+	case float64:
+		stored.Number = &v
+		stored.Value = strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		stored.Date = &v
+		stored.Value = v.Format(time.RFC3339)
+	case []string:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		stored.Value = string(encoded)
+	case string:
+		stored.Value = v
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+	return stored, nil
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+)
+
+// ExtractionEvent 流水线从一封新邮件中提取到值时推送的事件
+type ExtractionEvent struct {
+	PipelineID  uint                   `json:"pipeline_id"`
+	Pipeline    string                 `json:"pipeline"`
+	TemplateID  uint                   `json:"template_id"`
+	EmailID     uint                   `json:"email_id"`
+	AccountID   uint                   `json:"account_id"`
+	MessageID   string                 `json:"message_id,omitempty"`
+	Subject     string                 `json:"subject"`
+	From        []string               `json:"from"`
+	Values      map[string]interface{} `json:"values"`
+	Errors      []ExtractionError      `json:"errors,omitempty"`
+	ExtractedAt time.Time              `json:"extracted_at"`
+}
+
+// pipelineMaxAttempts 一封邮件运行模板失败后最多尝试的次数，之后记录错误并越过它
+const pipelineMaxAttempts = 3
+
+// pipelineProgress 流水线进度之后的邮件：已处理完的在之后的运行中跳过，失败的记录尝试次数
+type pipelineProgress struct {
+	done     map[uint]bool
+	attempts map[uint]int
+}
+
+// ExtractionPipelineService 在新邮件入库后运行范围匹配的提取流水线
+type ExtractionPipelineService struct {
+	pipelineRepo *repository.ExtractionPipelineRepository
+	valueService *ExtractedValueService
+	emailRepo    *repository.EmailRepository
+	interval     time.Duration
+	batchSize    int
+	client       *http.Client
+
+	listenersMu sync.Mutex
+	listeners   map[chan ExtractionEvent]uint // 监听者及其关注的流水线，0 表示全部
+
+	runMu    sync.Mutex
+	progress map[uint]*pipelineProgress // 各流水线进度之后的处理情况，由 runMu 保护
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewExtractionPipelineService creates the extraction pipeline service
+func NewExtractionPipelineService(
+	pipelineRepo *repository.ExtractionPipelineRepository,
+	valueService *ExtractedValueService,
+	emailRepo *repository.EmailRepository,
+) *ExtractionPipelineService {
+	return &ExtractionPipelineService{
+		pipelineRepo: pipelineRepo,
+		valueService: valueService,
+		emailRepo:    emailRepo,
+		interval:     30 * time.Second,
+		batchSize:    100,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		listeners:    make(map[chan ExtractionEvent]uint),
+		progress:     make(map[uint]*pipelineProgress),
+		wakeCh:       make(chan struct{}, 1),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Start 启动后台任务，新邮件入库时通过 Wake 立即处理，另有定时兜底
+func (s *ExtractionPipelineService) Start() {
+	log.Printf("[ExtractionPipeline] Starting extraction pipelines, interval %v", s.interval)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Run(); err != nil {
+				log.Printf("[ExtractionPipeline] Pipeline run failed: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.wakeCh:
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台任务
+func (s *ExtractionPipelineService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+	log.Printf("[ExtractionPipeline] Extraction pipelines stopped")
+}
+
+// Wake 立即处理新邮件，不必等到下一个周期
+func (s *ExtractionPipelineService) Wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Run 让每个启用的流水线处理其进度之后的邮件，返回运行模板的邮件数
+func (s *ExtractionPipelineService) Run() (int, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	pipelines, err := s.pipelineRepo.ListEnabled()
+	if err != nil {
+		return 0, err
+	}
+
+	enabled := make(map[uint]bool, len(pipelines))
+	for i := range pipelines {
+		enabled[pipelines[i].ID] = true
+	}
+	for id := range s.progress {
+		if !enabled[id] {
+			delete(s.progress, id)
+		}
+	}
+
+	processed := 0
+	for i := range pipelines {
+		count, err := s.runPipeline(&pipelines[i])
+		processed += count
+		if err != nil {
+			log.Printf("[ExtractionPipeline] Pipeline %q failed: %v", pipelines[i].Name, err)
+		}
+	}
+	return processed, nil
+}
+
+// runPipeline processes the pending emails of one pipeline in batches. Like
+// the trigger cursor, the cursor only moves past emails stored longer ago than
+// repository.EmailVisibilityLag; newer emails are listed again on every run
+// and skipped once processed. An email whose extraction failed holds the
+// cursor and is retried up to pipelineMaxAttempts times, after which the error
+// is recorded on the pipeline and the email is passed.
+func (s *ExtractionPipelineService) runPipeline(pipeline *models.ExtractionPipeline) (int, error) {
+	filter, err := pipelineFilter(pipeline)
+	if err != nil {
+		s.pipelineRepo.Advance(pipeline.ID, pipeline.LastEmailID, 0, 0, "invalid query: "+err.Error())
+		return 0, err
+	}
+
+	now := time.Now()
+	latestEmailID, err := s.pipelineRepo.MaxEmailID()
+	if err != nil {
+		return 0, err
+	}
+	if pipeline.LastEmailID >= latestEmailID {
+		return 0, nil
+	}
+	settledEmailID, err := s.pipelineRepo.SettledEmailID(now)
+	if err != nil {
+		return 0, err
+	}
+	if settledEmailID > latestEmailID {
+		settledEmailID = latestEmailID
+	}
+
+	progress := s.progress[pipeline.ID]
+	if progress == nil {
+		progress = &pipelineProgress{done: make(map[uint]bool), attempts: make(map[uint]int)}
+		s.progress[pipeline.ID] = progress
+	}
+
+	// next 是进度可以推进到的位置：之前的邮件都已处理完，且不会再出现更小的 ID
+	next := pipeline.LastEmailID
+	after := pipeline.LastEmailID
+	blocked := false
+	var lastError string
+	processed := 0
+	for {
+		select {
+		case <-s.stopCh:
+			return processed, nil
+		default:
+		}
+
+		emails, err := s.pipelineRepo.PendingEmails(pipeline, after, latestEmailID, s.batchSize)
+		if err != nil {
+			return processed, err
+		}
+		if len(emails) == 0 {
+			break
+		}
+		// 搜索语句可能按附件筛选
+		if pipeline.Query != "" {
+			if err := s.emailRepo.LoadAttachments(emails); err != nil {
+				return processed, err
+			}
+		}
+
+		var matched, extracted int64
+		for i := range emails {
+			email := &emails[i]
+			if !progress.done[email.ID] && matchesPipelineScope(pipeline, filter, *email, now) {
+				result, err := s.valueService.Run(pipeline.TemplateID, nil, *email)
+				if err != nil {
+					progress.attempts[email.ID]++
+					lastError = fmt.Sprintf("email %d: %v", email.ID, err)
+					if progress.attempts[email.ID] < pipelineMaxAttempts {
+						// 下次运行重试，进度不越过这封邮件
+						blocked = true
+						continue
+					}
+					lastError = fmt.Sprintf("%s (gave up after %d attempts)", lastError, pipelineMaxAttempts)
+				} else if len(result.Values) > 0 {
+					extracted++
+					s.publish(pipeline, email, result)
+				}
+				matched++
+			}
+			progress.done[email.ID] = true
+			if !blocked && email.ID <= settledEmailID {
+				next = email.ID
+			}
+		}
+
+		after = emails[len(emails)-1].ID
+		if err := s.advance(pipeline, progress, next, matched, extracted, lastError); err != nil {
+			return processed, err
+		}
+		processed += int(matched)
+		if len(emails) < s.batchSize {
+			break
+		}
+	}
+
+	// 账户范围外的邮件也算已处理
+	if !blocked && settledEmailID > pipeline.LastEmailID {
+		if err := s.advance(pipeline, progress, settledEmailID, 0, 0, lastError); err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+// advance saves the cursor and statistics of a pipeline and forgets the
+// emails the cursor moved past
+func (s *ExtractionPipelineService) advance(pipeline *models.ExtractionPipeline, progress *pipelineProgress, lastEmailID uint, matched, extracted int64, lastError string) error {
+	if err := s.pipelineRepo.Advance(pipeline.ID, lastEmailID, matched, extracted, lastError); err != nil {
+		return err
+	}
+	pipeline.LastEmailID = lastEmailID
+	for id := range progress.done {
+		if id <= lastEmailID {
+			delete(progress.done, id)
+		}
+	}
+	for id := range progress.attempts {
+		if id <= lastEmailID {
+			delete(progress.attempts, id)
+		}
+	}
+	return nil
+}
+
+// pipelineFilter 把流水线的文件夹范围和搜索语句转换为邮件过滤器，与触发器和订阅按相同规则匹配
+func pipelineFilter(pipeline *models.ExtractionPipeline) (*EmailFilter, error) {
+	filter := &EmailFilter{
+		Folders: pipeline.Mailboxes,
+		Query:   pipeline.Query,
+	}
+	if err := filter.Compile(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// matchesPipelineScope 检查邮件是否落在流水线的作用范围内。账户范围在查询中应用；
+// 收件地址与触发器和订阅的别名规则相同（*@domain 匹配该域名的所有地址，其余精确匹配），
+// 发件人域名与搜索语句的 from:@domain 相同
+func matchesPipelineScope(pipeline *models.ExtractionPipeline, filter *EmailFilter, email models.Email, now time.Time) bool {
+	if !filter.Matches(email, now) {
+		return false
+	}
+
+	if len(pipeline.AliasPatterns) > 0 {
+		found := false
+		for _, alias := range pipeline.AliasPatterns {
+			if matchesAlias(email, alias) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(pipeline.SenderDomains) > 0 {
+		found := false
+		for _, domain := range pipeline.SenderDomains {
+			if models.AddressesMatch(email.From, "@"+strings.TrimPrefix(strings.TrimSpace(domain), "@")) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Listen 注册一个监听者，接收指定流水线（0 表示全部）的提取事件，
+// 处理不及时的事件会被丢弃。调用返回的函数取消监听。
+func (s *ExtractionPipelineService) Listen(pipelineID uint) (<-chan ExtractionEvent, func()) {
+	ch := make(chan ExtractionEvent, 32)
+	s.listenersMu.Lock()
+	s.listeners[ch] = pipelineID
+	s.listenersMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.listenersMu.Lock()
+			delete(s.listeners, ch)
+			s.listenersMu.Unlock()
+		})
+	}
+}
+
+// publish pushes an extraction event to the listeners and the webhook of the pipeline
+func (s *ExtractionPipelineService) publish(pipeline *models.ExtractionPipeline, email *models.Email, result *ExtractorResult) {
+	event := ExtractionEvent{
+		PipelineID:  pipeline.ID,
+		Pipeline:    pipeline.Name,
+		TemplateID:  pipeline.TemplateID,
+		EmailID:     email.ID,
+		AccountID:   email.AccountID,
+		MessageID:   email.MessageID,
+		Subject:     email.Subject,
+		From:        email.From,
+		Values:      result.Values,
+		Errors:      result.Errors,
+		ExtractedAt: time.Now(),
+	}
+
+	s.listenersMu.Lock()
+	for ch, pipelineID := range s.listeners {
+		if pipelineID != 0 && pipelineID != pipeline.ID {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	s.listenersMu.Unlock()
+
+	if pipeline.WebhookURL != "" {
+		go s.deliverWebhook(pipeline.WebhookURL, pipeline.WebhookSecret, event)
+	}
+}
+
+// deliverWebhook posts an event to a webhook, retrying failed deliveries a few times
+func (s *ExtractionPipelineService) deliverWebhook(url, secret string, event ExtractionEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[ExtractionPipeline] Failed to encode webhook payload: %v", err)
+		return
+	}
+
+	const attempts = 3
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = s.postWebhook(url, secret, body)
+		if err == nil {
+			return
+		}
+		if attempt < attempts {
+			time.Sleep(time.Duration(attempt) * 5 * time.Second)
+		}
+	}
+	log.Printf("[ExtractionPipeline] Failed to deliver webhook of pipeline %d for email %d: %v", event.PipelineID, event.EmailID, err)
+}
+
+func (s *ExtractionPipelineService) postWebhook(url, secret string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Mailman-Event", "extraction")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Mailman-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
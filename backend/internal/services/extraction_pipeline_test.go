@@ -0,0 +1,173 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+func newTestPipelineService(t *testing.T, templateID uint) (*ExtractionPipelineService, *gorm.DB, *models.ExtractionPipeline) {
+	t.Helper()
+	db := openServiceTestDB(t, &models.ExtractorTemplate{}, &models.ExtractorTemplateRevision{},
+		&models.ExtractedValue{}, &models.ExtractionPipeline{})
+
+	template := &models.ExtractorTemplate{
+		ID:   1,
+		Name: "codes",
+		Extractors: models.ExtractorTemplateConfigs{
+			{Field: "subject", Type: "regex", Extract: `\d{6}`, Name: "code"},
+		},
+		Revision: 1,
+	}
+	if err := db.Create(template).Error; err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+	pipeline := &models.ExtractionPipeline{
+		Name:          "codes",
+		TemplateID:    templateID,
+		Enabled:       true,
+		AliasPatterns: models.StringSlice{"*@example.com"},
+		SenderDomains: models.StringSlice{"example.com"},
+	}
+	if err := db.Create(pipeline).Error; err != nil {
+		t.Fatalf("failed to create pipeline: %v", err)
+	}
+
+	emailRepo := repository.NewEmailRepository(db)
+	valueService := NewExtractedValueService(
+		repository.NewExtractedValueRepository(db),
+		repository.NewExtractorTemplateRepository(db),
+		emailRepo,
+	)
+	service := NewExtractionPipelineService(repository.NewExtractionPipelineRepository(db), valueService, emailRepo)
+	return service, db, pipeline
+}
+
+// reloadPipeline reads the saved cursor and error of a pipeline
+func reloadPipeline(t *testing.T, db *gorm.DB, id uint) models.ExtractionPipeline {
+	t.Helper()
+	var pipeline models.ExtractionPipeline
+	if err := db.First(&pipeline, id).Error; err != nil {
+		t.Fatalf("failed to load pipeline: %v", err)
+	}
+	return pipeline
+}
+
+func assertExtracted(t *testing.T, db *gorm.DB, emailID uint) {
+	t.Helper()
+	var count int64
+	db.Model(&models.ExtractedValue{}).Where("email_id = ?", emailID).Count(&count)
+	if count == 0 {
+		t.Fatalf("expected values extracted from email %d", emailID)
+	}
+}
+
+func TestPipelineProcessesEmailCommittedLate(t *testing.T) {
+	service, db, pipeline := newTestPipelineService(t, 1)
+
+	// 两个同步事务分别分配了 ID 1 和 2，ID 2 的事务先提交
+	now := time.Now()
+	storeEmail(t, db, 2, now)
+	if _, err := service.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	assertExtracted(t, db, 2)
+	if cursor := reloadPipeline(t, db, pipeline.ID).LastEmailID; cursor != 0 {
+		t.Fatalf("expected the cursor to wait for recent emails, got %d", cursor)
+	}
+
+	storeEmail(t, db, 1, now)
+	processed, err := service.Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	assertExtracted(t, db, 1)
+	if processed != 1 {
+		t.Fatalf("expected only the late email to be processed, got %d", processed)
+	}
+
+	if err := db.Model(&models.Email{}).Where("id IN ?", []uint{1, 2}).
+		Update("created_at", now.Add(-2*repository.EmailVisibilityLag)).Error; err != nil {
+		t.Fatalf("failed to age emails: %v", err)
+	}
+	if _, err := service.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if cursor := reloadPipeline(t, db, pipeline.ID).LastEmailID; cursor != 2 {
+		t.Fatalf("expected the cursor at 2, got %d", cursor)
+	}
+}
+
+func TestPipelineRetriesFailedEmail(t *testing.T) {
+	// 模板不存在，每次运行都失败
+	service, db, pipeline := newTestPipelineService(t, 99)
+	storeEmail(t, db, 1, time.Now().Add(-2*repository.EmailVisibilityLag))
+
+	for attempt := 1; attempt < pipelineMaxAttempts; attempt++ {
+		if _, err := service.Run(); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		saved := reloadPipeline(t, db, pipeline.ID)
+		if saved.LastEmailID != 0 || saved.LastError == "" {
+			t.Fatalf("attempt %d: expected the cursor to stay before the failed email with an error, got %d, %q", attempt, saved.LastEmailID, saved.LastError)
+		}
+	}
+
+	if _, err := service.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	saved := reloadPipeline(t, db, pipeline.ID)
+	if saved.LastEmailID != 1 || !strings.Contains(saved.LastError, "gave up") {
+		t.Fatalf("expected the email to be passed after %d attempts, got %d, %q", pipelineMaxAttempts, saved.LastEmailID, saved.LastError)
+	}
+}
+
+func TestPipelineScopeUsesFilterRules(t *testing.T) {
+	email := models.Email{
+		From:        models.StringSlice{"GitHub <noreply@github.com>"},
+		To:          models.StringSlice{"Shop@Example.com"},
+		Cc:          models.StringSlice{"me@example.org"},
+		MailboxName: "INBOX",
+	}
+	tests := []struct {
+		name     string
+		pipeline models.ExtractionPipeline
+		want     bool
+	}{
+		{"empty scope", models.ExtractionPipeline{}, true},
+		{"domain alias", models.ExtractionPipeline{AliasPatterns: models.StringSlice{"*@example.com"}}, true},
+		{"domain alias of cc", models.ExtractionPipeline{AliasPatterns: models.StringSlice{"*@example.org"}}, true},
+		{"other domain alias", models.ExtractionPipeline{AliasPatterns: models.StringSlice{"*@example.net"}}, false},
+		{"exact alias", models.ExtractionPipeline{AliasPatterns: models.StringSlice{"shop@example.com"}}, true},
+		{"any of several aliases", models.ExtractionPipeline{AliasPatterns: models.StringSlice{"x@example.net", "*@example.com"}}, true},
+		{"sender domain", models.ExtractionPipeline{SenderDomains: models.StringSlice{"github.com"}}, true},
+		{"sender domain with @", models.ExtractionPipeline{SenderDomains: models.StringSlice{"@github.com"}}, true},
+		{"other sender domain", models.ExtractionPipeline{SenderDomains: models.StringSlice{"gitlab.com"}}, false},
+		{"mailbox", models.ExtractionPipeline{Mailboxes: models.StringSlice{"INBOX"}}, true},
+		{"other mailbox", models.ExtractionPipeline{Mailboxes: models.StringSlice{"Archive"}}, false},
+		{"query", models.ExtractionPipeline{Query: "from:github"}, true},
+		{"failing query", models.ExtractionPipeline{Query: "from:gitlab"}, false},
+		{"all scopes", models.ExtractionPipeline{
+			AliasPatterns: models.StringSlice{"*@example.com"},
+			SenderDomains: models.StringSlice{"github.com"},
+			Mailboxes:     models.StringSlice{"INBOX"},
+			Query:         "-in:spam",
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := pipelineFilter(&tt.pipeline)
+			if err != nil {
+				t.Fatalf("pipelineFilter failed: %v", err)
+			}
+			if got := matchesPipelineScope(&tt.pipeline, filter, email, time.Now()); got != tt.want {
+				t.Fatalf("matchesPipelineScope = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,12 +3,13 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"mailman/internal/attachtext"
 	"mailman/internal/models"
+	"mime"
+	"path"
 	"regexp"
 	"strings"
 	"text/template"
-
-	"github.com/robertkrimen/otto"
 )
 
 // ExtractorType defines the type of extraction to perform
@@ -18,8 +19,20 @@ const (
 	ExtractorTypeRegex      ExtractorType = "regex"
 	ExtractorTypeJS         ExtractorType = "js"
 	ExtractorTypeGoTemplate ExtractorType = "gotemplate"
+	ExtractorTypeHTML       ExtractorType = "html"     // CSS selector or XPath over HTML content
+	ExtractorTypeJSONPath   ExtractorType = "jsonpath" // JSONPath over JSON content
+	ExtractorTypeBuiltin    ExtractorType = "builtin"  // Builtin extractor selected by name, e.g. otp
 )
 
+// IsValidExtractorType reports whether t is a supported extractor type
+func IsValidExtractorType(t string) bool {
+	switch ExtractorType(t) {
+	case ExtractorTypeRegex, ExtractorTypeJS, ExtractorTypeGoTemplate, ExtractorTypeHTML, ExtractorTypeJSONPath, ExtractorTypeBuiltin:
+		return true
+	}
+	return false
+}
+
 // ExtractorField defines which field to extract from
 type ExtractorField string
 
@@ -32,14 +45,107 @@ const (
 	ExtractorFieldBody     ExtractorField = "body"
 	ExtractorFieldHTMLBody ExtractorField = "html_body"
 	ExtractorFieldHeaders  ExtractorField = "headers"
+
+	// ExtractorFieldAttachments is the text of all attachments, including the
+	// text layer of PDFs and the contents of CSV, DOCX and XLSX files
+	ExtractorFieldAttachments ExtractorField = "attachments"
 )
 
+// ExtractorFieldAttachmentPrefix selects the text of attachments whose file
+// name, or MIME type when the pattern contains a slash, matches a glob, e.g.
+// "attachment:*.json" or "attachment:application/json"
+const ExtractorFieldAttachmentPrefix = "attachment:"
+
+// IsValidExtractorField reports whether field is a supported extractor field
+func IsValidExtractorField(field string) bool {
+	switch ExtractorField(field) {
+	case ExtractorFieldAll, ExtractorFieldFrom, ExtractorFieldTo, ExtractorFieldCC,
+		ExtractorFieldSubject, ExtractorFieldBody, ExtractorFieldHTMLBody, ExtractorFieldHeaders,
+		ExtractorFieldAttachments:
+		return true
+	}
+	if pattern, ok := attachmentPattern(ExtractorField(field)); ok {
+		_, err := path.Match(pattern, "")
+		return pattern != "" && err == nil
+	}
+	return false
+}
+
+// ExtractorsUseAttachments reports whether any extractor reads attachments,
+// so that callers only load attachment contents when needed
+func ExtractorsUseAttachments(extractors []ExtractorConfig) bool {
+	for _, extractor := range extractors {
+		if _, ok := attachmentPattern(extractor.Field); ok || extractor.Field == ExtractorFieldAttachments {
+			return true
+		}
+	}
+	return false
+}
+
+func attachmentPattern(field ExtractorField) (string, bool) {
+	if !strings.HasPrefix(string(field), ExtractorFieldAttachmentPrefix) {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(string(field), ExtractorFieldAttachmentPrefix))), true
+}
+
+// attachmentText returns the text of an attachment: the raw content of text
+// files, otherwise the text extracted in the background. Attachments not
+// processed yet are extracted on the fly so that freshly received mail can be
+// matched right away.
+func attachmentText(attachment models.Attachment) string {
+	if attachtext.IsTextual(attachment.Filename, attachment.MIMEType) {
+		return string(attachment.Content)
+	}
+	if attachment.TextStatus == models.AttachmentTextPending && len(attachment.Content) > 0 {
+		if text, err := attachtext.Extract(attachment.Filename, attachment.MIMEType, attachment.Content); err == nil {
+			return text
+		}
+	}
+	return attachment.Text
+}
+
+// allAttachmentTexts returns the text of every attachment that has one
+func allAttachmentTexts(email models.Email) []string {
+	var texts []string
+	for _, attachment := range email.Attachments {
+		if text := attachmentText(attachment); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// attachmentContents returns the contents of the attachments matching a glob
+func attachmentContents(email models.Email, pattern string) []string {
+	var contents []string
+	for _, attachment := range email.Attachments {
+		target := strings.ToLower(attachment.Filename)
+		if strings.Contains(pattern, "/") {
+			target = strings.ToLower(attachment.MIMEType)
+			if mediaType, _, err := mime.ParseMediaType(attachment.MIMEType); err == nil {
+				target = mediaType
+			}
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			if text := attachmentText(attachment); text != "" {
+				contents = append(contents, text)
+			}
+		}
+	}
+	return contents
+}
+
 // ExtractorConfig defines the configuration for content extraction
 type ExtractorConfig struct {
 	Field   ExtractorField `json:"field"`
 	Type    ExtractorType  `json:"type"`
 	Match   *string        `json:"match,omitempty"` // Optional match configuration
 	Extract string         `json:"extract"`         // Extract configuration
+
+	Name       string `json:"name,omitempty"`        // Output name in ExtractorResult.Values
+	OutputType string `json:"output_type,omitempty"` // string (default), number, date, url or list
+	Required   bool   `json:"required,omitempty"`    // Report an error when the output has no value
 }
 
 // MatchResult represents the result of a match operation
@@ -50,8 +156,10 @@ type MatchResult struct {
 
 // ExtractorResult represents the result of an extraction operation
 type ExtractorResult struct {
-	Email   models.Email `json:"email"`
-	Matches []string     `json:"matches"`
+	Email   models.Email           `json:"email"`
+	Matches []string               `json:"matches"`          // 所有提取器的结果，按顺序拼接
+	Values  map[string]interface{} `json:"values,omitempty"` // 命名提取器的结果
+	Errors  []ExtractionError      `json:"errors,omitempty"` // 命名输出的校验错误
 }
 
 // ExtractorService handles email content extraction
@@ -66,8 +174,9 @@ func NewExtractorService() *ExtractorService {
 func (s *ExtractorService) ExtractFromEmail(email models.Email, extractors []ExtractorConfig) (*ExtractorResult, error) {
 	var allMatches []string
 	hasMatch := false
+	perExtractor := make([][]string, len(extractors))
 
-	for _, extractor := range extractors {
+	for i, extractor := range extractors {
 		// First check if we need to evaluate match condition
 		if extractor.Match != nil {
 			matchResult, err := s.evaluateMatch(email, extractor)
@@ -89,6 +198,7 @@ func (s *ExtractorService) ExtractFromEmail(email models.Email, extractors []Ext
 		if len(matches) > 0 {
 			hasMatch = true
 			allMatches = append(allMatches, matches...)
+			perExtractor[i] = matches
 		}
 	}
 
@@ -97,9 +207,12 @@ func (s *ExtractorService) ExtractFromEmail(email models.Email, extractors []Ext
 		return nil, nil
 	}
 
+	values, errors := collectOutputs(extractors, perExtractor)
 	return &ExtractorResult{
 		Email:   email,
 		Matches: allMatches,
+		Values:  values,
+		Errors:  errors,
 	}, nil
 }
 
@@ -120,6 +233,12 @@ func (s *ExtractorService) evaluateMatch(email models.Email, config ExtractorCon
 		return s.matchWithJS(email, fieldContent, *config.Match)
 	case ExtractorTypeGoTemplate:
 		return s.matchWithGoTemplate(email, *config.Match)
+	case ExtractorTypeHTML:
+		return s.matchWithHTML(fieldContent, *config.Match)
+	case ExtractorTypeJSONPath:
+		return s.matchWithJSONPath(fieldContent, *config.Match)
+	case ExtractorTypeBuiltin:
+		return s.matchWithBuiltin(email, fieldContent, *config.Match)
 	default:
 		return nil, fmt.Errorf("unsupported extractor type for match: %s", config.Type)
 	}
@@ -149,76 +268,7 @@ func (s *ExtractorService) matchWithRegex(content []string, pattern string) (*Ma
 
 // matchWithJS performs JavaScript-based matching
 func (s *ExtractorService) matchWithJS(email models.Email, content []string, script string) (*MatchResult, error) {
-	vm := otto.New()
-
-	// Set up the content variable in the JS context
-	contentJSON, err := json.Marshal(content)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal content: %w", err)
-	}
-
-	// Set the content variable
-	err = vm.Set("content", string(contentJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to set content variable: %w", err)
-	}
-
-	// Set the email object
-	emailJSON, err := json.Marshal(email)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal email: %w", err)
-	}
-	err = vm.Set("email", string(emailJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to set email variable: %w", err)
-	}
-
-	// Parse content and email as JSON in JS
-	_, err = vm.Run(`
-		var parsedContent = JSON.parse(content);
-		var parsedEmail = JSON.parse(email);
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse data in JS: %w", err)
-	}
-
-	// Wrap the script to ensure it returns a proper match result
-	wrappedScript := fmt.Sprintf(`
-		(function() {
-			try {
-				var result = (function() { %s })();
-				if (typeof result === 'boolean') {
-					return JSON.stringify({matched: result});
-				} else if (typeof result === 'object' && result !== null && 'matched' in result) {
-					return JSON.stringify(result);
-				} else {
-					return JSON.stringify({matched: false, reason: 'Invalid return value from match script'});
-				}
-			} catch (e) {
-				return JSON.stringify({matched: false, reason: e.toString()});
-			}
-		})()
-	`, script)
-
-	// Execute the wrapped script
-	result, err := vm.Run(wrappedScript)
-	if err != nil {
-		return nil, fmt.Errorf("JS execution failed: %w", err)
-	}
-
-	// Convert result to string
-	resultStr, err := result.ToString()
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert JS result to string: %w", err)
-	}
-
-	// Parse the result
-	var matchResult MatchResult
-	if err := json.Unmarshal([]byte(resultStr), &matchResult); err != nil {
-		return nil, fmt.Errorf("failed to parse match result: %w", err)
-	}
-
-	return &matchResult, nil
+	return GetScriptRuntime().Match(script, ScriptInput{Email: email, Content: content})
 }
 
 // matchWithGoTemplate performs Go template-based matching
@@ -289,6 +339,12 @@ func (s *ExtractorService) extractWithConfig(email models.Email, config Extracto
 		return s.extractWithJS(email, fieldContent, config.Extract)
 	case ExtractorTypeGoTemplate:
 		return s.extractWithGoTemplate(email, config.Extract)
+	case ExtractorTypeHTML:
+		return s.extractWithHTML(fieldContent, config.Extract)
+	case ExtractorTypeJSONPath:
+		return s.extractWithJSONPath(fieldContent, config.Extract)
+	case ExtractorTypeBuiltin:
+		return s.extractWithBuiltin(email, fieldContent, config.Extract)
 	default:
 		return nil, fmt.Errorf("unsupported extractor type: %s", config.Type)
 	}
@@ -313,6 +369,8 @@ func (s *ExtractorService) getFieldContent(email models.Email, field ExtractorFi
 		// For headers, we would need to add a Headers field to the Email model
 		// For now, return empty
 		return []string{}
+	case ExtractorFieldAttachments:
+		return allAttachmentTexts(email)
 	case ExtractorFieldAll:
 		// Combine all text fields
 		var all []string
@@ -324,6 +382,9 @@ func (s *ExtractorService) getFieldContent(email models.Email, field ExtractorFi
 		all = append(all, email.HTMLBody)
 		return all
 	default:
+		if pattern, ok := attachmentPattern(field); ok {
+			return attachmentContents(email, pattern)
+		}
 		return []string{}
 	}
 }
@@ -375,80 +436,7 @@ func (s *ExtractorService) extractWithRegex(content []string, pattern string) ([
 
 // extractWithJS performs JavaScript-based extraction
 func (s *ExtractorService) extractWithJS(email models.Email, content []string, script string) ([]string, error) {
-	vm := otto.New()
-
-	// Set up the content variable in the JS context
-	contentJSON, err := json.Marshal(content)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal content: %w", err)
-	}
-
-	// Set the content variable
-	err = vm.Set("content", string(contentJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to set content variable: %w", err)
-	}
-
-	// Set the email object
-	emailJSON, err := json.Marshal(email)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal email: %w", err)
-	}
-	err = vm.Set("email", string(emailJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to set email variable: %w", err)
-	}
-
-	// Parse content and email as JSON in JS
-	_, err = vm.Run(`
-		var parsedContent = JSON.parse(content);
-		var parsedEmail = JSON.parse(email);
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse data in JS: %w", err)
-	}
-
-	// Wrap the script to ensure it returns a proper result
-	wrappedScript := fmt.Sprintf(`
-		(function() {
-			try {
-				var result = (function() { %s })();
-				if (result === null || result === undefined) {
-					return JSON.stringify([]);
-				} else if (typeof result === 'string') {
-					return JSON.stringify([result]);
-				} else if (Array.isArray(result)) {
-					return JSON.stringify(result.filter(function(item) { 
-						return item !== null && item !== undefined && item !== ''; 
-					}));
-				} else {
-					return JSON.stringify([String(result)]);
-				}
-			} catch (e) {
-				return JSON.stringify([]);
-			}
-		})()
-	`, script)
-
-	// Execute the wrapped script
-	result, err := vm.Run(wrappedScript)
-	if err != nil {
-		return nil, fmt.Errorf("JS execution failed: %w", err)
-	}
-
-	// Convert result to string
-	resultStr, err := result.ToString()
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert JS result to string: %w", err)
-	}
-
-	// Parse as JSON array
-	var matches []string
-	if err := json.Unmarshal([]byte(resultStr), &matches); err != nil {
-		return nil, fmt.Errorf("failed to parse extraction result: %w", err)
-	}
-
-	return matches, nil
+	return GetScriptRuntime().Extract(script, ScriptInput{Email: email, Content: content})
 }
 
 // extractWithGoTemplate performs Go template-based extraction
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"mailman/internal/models"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// builtin 提取器的表达式格式：
+//
+//	[builtin:]name[@version][|||replacement]
+//
+// 例如 otp、builtin:verify_link@1、tracking_number|||单号 $0。不指定版本时使用最新版本，
+// 指定版本后规则升级也不会改变已有模板的行为。内置提取器作用于所选字段的内容，
+// 通常使用 ALL；HTML 内容会先转换为文本，链接类提取器会解析 <a> 标签。
+
+// BuiltinExtractorPrefix is the optional prefix of builtin extractor names
+const BuiltinExtractorPrefix = "builtin:"
+
+// BuiltinExtractor is a versioned, ready-made extraction rule
+type BuiltinExtractor struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	OutputType  string `json:"output_type"` // 建议的命名输出类型
+
+	extract func(email models.Email, content []string) []string
+}
+
+// builtinExtractors lists every version of every builtin extractor, when a
+// rule changes behaviour it gets a new version instead of being edited
+var builtinExtractors = []*BuiltinExtractor{
+	{Name: "otp", Version: 1, Description: "One-time passwords and verification codes", OutputType: ExtractorOutputString, extract: extractOTP},
+	{Name: "verify_link", Version: 1, Description: "Email verification and account confirmation links", OutputType: ExtractorOutputURL, extract: linkExtractor(verifyLinkRule)},
+	{Name: "magic_link", Version: 1, Description: "Passwordless sign-in links", OutputType: ExtractorOutputURL, extract: linkExtractor(magicLinkRule)},
+	{Name: "tracking_number", Version: 1, Description: "Parcel tracking numbers of common carriers", OutputType: ExtractorOutputList, extract: extractTrackingNumbers},
+	{Name: "amount", Version: 1, Description: "Total amount of orders, invoices and receipts", OutputType: ExtractorOutputNumber, extract: extractAmount},
+	{Name: "unsubscribe_link", Version: 1, Description: "Unsubscribe links from List-Unsubscribe or the body", OutputType: ExtractorOutputURL, extract: extractUnsubscribeLink},
+}
+
+// BuiltinExtractors returns the catalog of builtin extractors, latest version first
+func BuiltinExtractors() []BuiltinExtractor {
+	catalog := make([]BuiltinExtractor, 0, len(builtinExtractors))
+	for _, extractor := range builtinExtractors {
+		catalog = append(catalog, *extractor)
+	}
+	sort.SliceStable(catalog, func(i, j int) bool {
+		if catalog[i].Name != catalog[j].Name {
+			return catalog[i].Name < catalog[j].Name
+		}
+		return catalog[i].Version > catalog[j].Version
+	})
+	return catalog
+}
+
+// lookupBuiltinExtractor resolves "name", "builtin:name" or "name@version"
+func lookupBuiltinExtractor(reference string) (*BuiltinExtractor, error) {
+	reference = strings.TrimPrefix(strings.TrimSpace(reference), BuiltinExtractorPrefix)
+	name, version := reference, 0
+	if at := strings.LastIndex(reference, "@"); at >= 0 {
+		name = reference[:at]
+		parsed, err := strconv.Atoi(strings.TrimPrefix(reference[at+1:], "v"))
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid builtin extractor version %q", reference[at+1:])
+		}
+		version = parsed
+	}
+
+	var found *BuiltinExtractor
+	for _, extractor := range builtinExtractors {
+		if extractor.Name != name {
+			continue
+		}
+		if version == 0 && (found == nil || extractor.Version > found.Version) || extractor.Version == version {
+			found = extractor
+		}
+	}
+	if found == nil {
+		if version > 0 {
+			return nil, fmt.Errorf("unknown builtin extractor %s@%d", name, version)
+		}
+		return nil, fmt.Errorf("unknown builtin extractor %q", name)
+	}
+	return found, nil
+}
+
+// runBuiltin evaluates a builtin extractor expression
+func runBuiltin(email models.Email, content []string, expression string) ([]string, error) {
+	parts := strings.SplitN(expression, "|||", 2)
+	extractor, err := lookupBuiltinExtractor(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	values := extractor.extract(email, content)
+	if len(parts) > 1 {
+		for i, value := range values {
+			values[i] = strings.ReplaceAll(parts[1], "$0", value)
+		}
+	}
+	return values, nil
+}
+
+// matchWithBuiltin matches when the builtin extractor finds a value
+func (s *ExtractorService) matchWithBuiltin(email models.Email, content []string, expression string) (*MatchResult, error) {
+	values, err := runBuiltin(email, content, expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > 0 {
+		return &MatchResult{Matched: true}, nil
+	}
+	return &MatchResult{
+		Matched: false,
+		Reason:  "Builtin extractor found no value",
+	}, nil
+}
+
+// extractWithBuiltin performs extraction with a builtin extractor
+func (s *ExtractorService) extractWithBuiltin(email models.Email, content []string, expression string) ([]string, error) {
+	return runBuiltin(email, content, expression)
+}
+
+//go:embed builtin_fixtures/*.json
+var builtinFixtureFiles embed.FS
+
+// builtinFixture is one sample email of the fixture corpus and the values
+// the extractor is expected to return for it
+type builtinFixture struct {
+	Name       string   `json:"name"`
+	Field      string   `json:"field,omitempty"` // 默认 ALL
+	Subject    string   `json:"subject,omitempty"`
+	Body       string   `json:"body,omitempty"`
+	HTMLBody   string   `json:"html_body,omitempty"`
+	RawMessage string   `json:"raw_message,omitempty"`
+	Expect     []string `json:"expect"`
+}
+
+// BuiltinFixtureResult is the outcome of one fixture of the corpus
+type BuiltinFixtureResult struct {
+	Extractor string   `json:"extractor"`
+	Fixture   string   `json:"fixture"`
+	Expected  []string `json:"expected"`
+	Got       []string `json:"got"`
+	Passed    bool     `json:"passed"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// RunBuiltinExtractorFixtures runs the embedded fixture corpus, one file per
+// extractor version named like otp@1.json, against the builtin extractors
+func RunBuiltinExtractorFixtures() ([]BuiltinFixtureResult, error) {
+	files, err := builtinFixtureFiles.ReadDir("builtin_fixtures")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read builtin fixtures: %w", err)
+	}
+
+	service := NewExtractorService()
+	var results []BuiltinFixtureResult
+	for _, file := range files {
+		data, err := builtinFixtureFiles.ReadFile(path.Join("builtin_fixtures", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %w", file.Name(), err)
+		}
+		var fixtures []builtinFixture
+		if err := json.Unmarshal(data, &fixtures); err != nil {
+			return nil, fmt.Errorf("invalid fixture file %s: %w", file.Name(), err)
+		}
+
+		reference := strings.TrimSuffix(file.Name(), ".json")
+		for _, fixture := range fixtures {
+			field := fixture.Field
+			if field == "" {
+				field = string(ExtractorFieldAll)
+			}
+			email := models.Email{Subject: fixture.Subject, Body: fixture.Body, HTMLBody: fixture.HTMLBody, RawMessage: fixture.RawMessage}
+			result := BuiltinFixtureResult{Extractor: reference, Fixture: fixture.Name, Expected: fixture.Expect}
+
+			got, err := service.extractWithConfig(email, ExtractorConfig{
+				Field:   ExtractorField(field),
+				Type:    ExtractorTypeBuiltin,
+				Extract: reference,
+			})
+			if err != nil {
+				result.Error = err.Error()
+			}
+			result.Got = got
+			result.Passed = err == nil && (len(got) == 0 && len(fixture.Expect) == 0 || reflect.DeepEqual(got, fixture.Expect))
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,515 @@
+package services
+
+import (
+	"bufio"
+	"mailman/internal/models"
+	"mailman/internal/utils"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// 内置提取器的规则。关键词覆盖英文、中文、日文和俄文；候选值按上下文打分，
+// 只返回分数达到阈值的结果，宁可不提取也不返回电话号码、年份之类的误报。
+
+var htmlContentPattern = regexp.MustCompile(`(?i)<(html|body|div|p|a|table|td|br|span|img)[\s/>]`)
+
+// builtinTexts returns the plain text of each content, converting HTML
+func builtinTexts(content []string) []string {
+	texts := make([]string, 0, len(content))
+	for _, text := range content {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if htmlContentPattern.MatchString(text) {
+			text = utils.HTMLToText(text)
+		}
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+// contextBefore and contextAfter return up to n bytes around [start, end),
+// dropping runes cut in half at the edge
+func contextBefore(text string, start, n int) string {
+	from := start - n
+	if from < 0 {
+		from = 0
+	}
+	for from < start && !utf8.RuneStart(text[from]) {
+		from++
+	}
+	return text[from:start]
+}
+
+func contextAfter(text string, end, n int) string {
+	to := end + n
+	if to > len(text) {
+		to = len(text)
+	}
+	for to > end && to < len(text) && !utf8.RuneStart(text[to]) {
+		to--
+	}
+	return text[end:to]
+}
+
+// ---- otp ----
+
+var (
+	otpCandidatePattern = regexp.MustCompile(`\d{3}[- ]\d{3}|[0-9A-Za-z]{4,8}`)
+	otpKeywordPattern   = regexp.MustCompile(`(?i)\b(code|otp|passcode|pin|verification|one[- ]time|2fa|security|authentication|login)\b|验证码|驗證碼|校验码|动态码|确认码|认证码|認証コード|確認コード|認証番号|確認番号|ワンタイム|パスコード|コード|код|пароль|подтвержд`)
+	otpPhonePattern     = regexp.MustCompile(`(?i)\b(tel|phone|call|fax|mobile|hotline)\b|电话|手机|热线|電話|携帯|телефон|звоните`)
+	otpOrderPattern     = regexp.MustCompile(`(?i)\b(order|invoice|account|ref|reference|ticket|no)\b|订单|单号|账号|注文|番号|заказ|счёт|счет`)
+)
+
+type otpCandidate struct {
+	value string
+	score int
+}
+
+// extractOTP returns the single best scoring verification code
+func extractOTP(email models.Email, content []string) []string {
+	var best *otpCandidate
+	for _, text := range builtinTexts(content) {
+		for _, loc := range otpCandidatePattern.FindAllStringIndex(text, -1) {
+			candidate := scoreOTP(text, loc[0], loc[1])
+			if candidate != nil && (best == nil || candidate.score > best.score) {
+				best = candidate
+			}
+		}
+	}
+	if best == nil || best.score < 3 {
+		return nil
+	}
+	return []string{best.value}
+}
+
+func scoreOTP(text string, start, end int) *otpCandidate {
+	token := text[start:end]
+	value := strings.NewReplacer(" ", "", "-", "").Replace(token)
+
+	digits, letters := 0, 0
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r >= 'A' && r <= 'Z':
+			letters++
+		default:
+			return nil // 小写字母说明是普通单词
+		}
+	}
+	if digits == 0 || (letters > 0 && len(value) < 6) {
+		return nil
+	}
+
+	// 候选值必须是独立的词，不能是更长数字、日期、时间、小数、链接或邮箱地址的一部分
+	if start > 0 && isOTPNeighbour(text[start-1]) || end < len(text) && isOTPNeighbour(text[end]) {
+		return nil
+	}
+	if start > 1 && strings.IndexByte(".:/,", text[start-1]) >= 0 && isDigit(text[start-2]) {
+		return nil
+	}
+	if end+1 < len(text) && strings.IndexByte(".:/,", text[end]) >= 0 && isDigit(text[end+1]) {
+		return nil
+	}
+	wordStart := strings.LastIndexAny(text[:start], " \t\r\n") + 1
+	wordEnd := end + strings.IndexAny(text[end:]+" ", " \t\r\n")
+	if word := text[wordStart:wordEnd]; strings.Contains(word, "://") || strings.Contains(word, "@") || strings.HasPrefix(word, "www.") {
+		return nil
+	}
+
+	score := 0
+	before := contextBefore(text, start, 80)
+	after := contextAfter(text, end, 40)
+	keywordAt := -1
+	if locs := otpKeywordPattern.FindAllStringIndex(before, -1); len(locs) > 0 {
+		keywordAt = locs[len(locs)-1][1]
+		score += 4
+		if len(before)-keywordAt <= 25 {
+			score++
+		}
+	}
+	if otpKeywordPattern.MatchString(after) {
+		score += 3
+	}
+
+	near := contextBefore(text, start, 30)
+	if otpPhonePattern.MatchString(near) {
+		score -= 5
+	}
+	if locs := otpOrderPattern.FindAllStringIndex(before, -1); len(locs) > 0 && locs[len(locs)-1][1] > keywordAt {
+		score -= 3
+	}
+	if start > 0 && strings.IndexByte("+(#$€£¥", text[start-1]) >= 0 || strings.HasSuffix(strings.TrimSpace(before), "¥") || strings.HasSuffix(strings.TrimSpace(before), "$") {
+		score -= 5
+	}
+	if strings.HasPrefix(strings.TrimSpace(after), "%") || currencySuffixPattern.MatchString(after) {
+		score -= 5
+	}
+	if len(value) == 4 && letters == 0 && (strings.HasPrefix(value, "19") || strings.HasPrefix(value, "20")) {
+		score -= 2 // 年份
+	}
+	if len(value) == 6 {
+		score++
+	}
+	if letters > 0 {
+		score--
+	}
+	return &otpCandidate{value: value, score: score}
+}
+
+func isOTPNeighbour(b byte) bool {
+	return isDigit(b) || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b == '_'
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// ---- links ----
+
+// builtinLink is a link with the text describing it: the anchor text in
+// HTML, the preceding words in plain text
+type builtinLink struct {
+	URL  string
+	Text string
+}
+
+var plainURLPattern = regexp.MustCompile(`https?://[^\s<>"'）】]+`)
+
+// builtinLinks collects the http(s) links of the contents. Anchors are
+// resolved against <base href> and deduplicated by URL.
+func builtinLinks(content []string) []builtinLink {
+	var links []builtinLink
+	seen := make(map[string]int)
+	add := func(link builtinLink) {
+		link.Text = strings.Join(strings.Fields(link.Text), " ")
+		if i, ok := seen[link.URL]; ok {
+			if links[i].Text == "" {
+				links[i].Text = link.Text
+			}
+			return
+		}
+		seen[link.URL] = len(links)
+		links = append(links, link)
+	}
+
+	for _, text := range content {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if htmlContentPattern.MatchString(text) {
+			for _, link := range htmlLinks(text) {
+				add(link)
+			}
+			text = utils.HTMLToText(text)
+		}
+		for _, loc := range plainURLPattern.FindAllStringIndex(text, -1) {
+			raw := strings.TrimRight(text[loc[0]:loc[1]], ".,;:!?)]}>。，；！")
+			if parsed, err := url.Parse(raw); err == nil && parsed.Host != "" {
+				add(builtinLink{URL: parsed.String(), Text: contextBefore(text, loc[0], 80)})
+			}
+		}
+	}
+	return links
+}
+
+func htmlLinks(content string) []builtinLink {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var base *url.URL
+	var anchors []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "base":
+				if href := htmlAttr(n, "href"); href != "" && base == nil {
+					base, _ = url.Parse(href)
+				}
+			case "a", "area":
+				anchors = append(anchors, n)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var links []builtinLink
+	for _, anchor := range anchors {
+		href, err := url.Parse(strings.TrimSpace(htmlAttr(anchor, "href")))
+		if err != nil {
+			continue
+		}
+		if base != nil {
+			href = base.ResolveReference(href)
+		}
+		if (href.Scheme != "http" && href.Scheme != "https") || href.Host == "" {
+			continue
+		}
+		text := strings.TrimSpace(htmlNodeText(anchor) + " " + htmlAttr(anchor, "title") + " " + htmlAttr(anchor, "aria-label"))
+		for _, img := range findImages(anchor) {
+			text += " " + htmlAttr(img, "alt")
+		}
+		links = append(links, builtinLink{URL: href.String(), Text: text})
+	}
+	return links
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func htmlNodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func findImages(n *html.Node) []*html.Node {
+	var images []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "img" {
+			images = append(images, c)
+		}
+		images = append(images, findImages(c)...)
+	}
+	return images
+}
+
+// linkRule scores links by keywords in the link text and in the URL
+type linkRule struct {
+	text     *regexp.Regexp
+	url      *regexp.Regexp
+	negative *regexp.Regexp
+}
+
+var (
+	verifyLinkRule = linkRule{
+		text:     regexp.MustCompile(`(?i)verif|confirm|activat|validat|验证|驗證|确认|確認|激活|认证|認証|有効化|本登録|подтверд|активир`),
+		url:      regexp.MustCompile(`(?i)verif|confirm|activat|validat|token=|code=`),
+		negative: regexp.MustCompile(`(?i)unsubscribe|退订|取消订阅|配信停止|отпис|privacy|隐私|プライバシー|help|support|帮助`),
+	}
+	magicLinkRule = linkRule{
+		text:     regexp.MustCompile(`(?i)sign[- ]?in|log[- ]?in|magic|登录|登入|登錄|ログイン|サインイン|войти|вход`),
+		url:      regexp.MustCompile(`(?i)magic|login|signin|sign-in|sign_in|auth|token=|otp=`),
+		negative: regexp.MustCompile(`(?i)unsubscribe|退订|取消订阅|配信停止|отпис|reset|重置|forgot|忘记|privacy|help|support`),
+	}
+	unsubscribeLinkRule = linkRule{
+		text:     regexp.MustCompile(`(?i)unsubscribe|opt[- ]out|退订|取消订阅|退訂|配信停止|配信解除|登録解除|отпис`),
+		url:      regexp.MustCompile(`(?i)unsubscribe|opt-?out|unsub`),
+		negative: regexp.MustCompile(`(?i)^$`),
+	}
+)
+
+func (rule linkRule) score(link builtinLink) int {
+	score := 0
+	if rule.text.MatchString(link.Text) {
+		score += 3
+	}
+	if rule.url.MatchString(link.URL) {
+		score += 2
+	}
+	if rule.negative.MatchString(link.Text) || rule.negative.MatchString(link.URL) {
+		score -= 4
+	}
+	return score
+}
+
+// bestLink returns the highest scoring link, ties go to the first one
+func (rule linkRule) bestLink(content []string) string {
+	best, bestScore := "", 1
+	for _, link := range builtinLinks(content) {
+		if score := rule.score(link); score > bestScore {
+			best, bestScore = link.URL, score
+		}
+	}
+	return best
+}
+
+func linkExtractor(rule linkRule) func(models.Email, []string) []string {
+	return func(email models.Email, content []string) []string {
+		if link := rule.bestLink(content); link != "" {
+			return []string{link}
+		}
+		return nil
+	}
+}
+
+// extractUnsubscribeLink prefers the http(s) URL of the List-Unsubscribe header
+func extractUnsubscribeLink(email models.Email, content []string) []string {
+	if header := listUnsubscribeHeader(email.RawMessage); header != "" {
+		for _, part := range strings.Split(header, ",") {
+			part = strings.Trim(strings.TrimSpace(part), "<>")
+			if parsed, err := url.Parse(part); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+				return []string{parsed.String()}
+			}
+		}
+	}
+	if link := unsubscribeLinkRule.bestLink(content); link != "" {
+		return []string{link}
+	}
+	return nil
+}
+
+func listUnsubscribeHeader(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(raw)))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return ""
+	}
+	return header.Get("List-Unsubscribe")
+}
+
+// ---- tracking_number ----
+
+var trackingPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b1Z[0-9A-Z]{16}\b`),                    // UPS
+	regexp.MustCompile(`\b9[2-5]\d{20}\b`),                      // USPS
+	regexp.MustCompile(`\b[A-Z]{2}\d{9}[A-Z]{2}\b`),             // UPU S10，各国邮政
+	regexp.MustCompile(`\bSF\d{12,13}\b`),                       // 顺丰
+	regexp.MustCompile(`\bJD[A-Z0-9]{11,13}\b`),                 // 京东
+	regexp.MustCompile(`\bYT\d{13}\b`),                          // 圆通
+	regexp.MustCompile(`(?i:fedex)\D{0,40}\b(\d{12}|\d{15})\b`), // FedEx
+	regexp.MustCompile(`(?i:dhl)\D{0,40}\b(\d{10})\b`),          // DHL Express
+	regexp.MustCompile(`(?i:tracking\s*(?:number|no\.?|#|id|code)?|运单号|快递单号|物流单号|運單號|追跡番号|お問い合わせ番号|伝票番号|трек[- ]?номер|номер отслеживания|трек[- ]?код)[\s:：#是为は]*([A-Z0-9][A-Z0-9-]{7,29})\b`),
+}
+
+// extractTrackingNumbers returns every distinct tracking number in order of appearance
+func extractTrackingNumbers(email models.Email, content []string) []string {
+	var numbers []string
+	seen := make(map[string]bool)
+	for _, text := range builtinTexts(content) {
+		type found struct {
+			at     int
+			number string
+		}
+		var matches []found
+		for _, pattern := range trackingPatterns {
+			for _, loc := range pattern.FindAllStringSubmatchIndex(text, -1) {
+				start, end := loc[0], loc[1]
+				if len(loc) > 2 && loc[2] >= 0 {
+					start, end = loc[2], loc[3]
+				}
+				number := text[start:end]
+				if strings.IndexAny(number, "0123456789") < 0 {
+					continue
+				}
+				matches = append(matches, found{at: start, number: number})
+			}
+		}
+		for i := 1; i < len(matches); i++ {
+			for j := i; j > 0 && matches[j].at < matches[j-1].at; j-- {
+				matches[j], matches[j-1] = matches[j-1], matches[j]
+			}
+		}
+		for _, match := range matches {
+			if !seen[match.number] {
+				seen[match.number] = true
+				numbers = append(numbers, match.number)
+			}
+		}
+	}
+	return numbers
+}
+
+// ---- amount ----
+
+var (
+	currencyPrefixPattern = regexp.MustCompile(`(US\$|HK\$|C\$|A\$|\$|￥|¥|€|£|₽|RMB|CNY|USD|EUR|GBP|JPY|RUB|HKD)\s?(\d{1,3}(?:[, ]\d{3})+(?:[.,]\d{1,2})?|\d+(?:[.,]\d{1,2})?)`)
+	currencySuffixPattern = regexp.MustCompile(`^\s?(元|円|руб\.?|₽|€|USD|CNY|RMB|EUR|JPY|RUB)`)
+	amountSuffixPattern   = regexp.MustCompile(`(\d{1,3}(?:[, ]\d{3})+(?:[.,]\d{1,2})?|\d+(?:[.,]\d{1,2})?)\s?(元|円|руб\.?|₽|€|USD|CNY|RMB|EUR|JPY|RUB)`)
+	amountKeywordPattern  = regexp.MustCompile(`(?i)\b(total|amount|due|paid|charged|payment|balance)\b|合计|总计|总额|实付|应付|支付|金额|合計|総額|金額|お支払|ご請求|итого|сумма|к оплате|оплачено`)
+	amountTotalPattern    = regexp.MustCompile(`(?i)\b(total|grand total|amount due)\b|合计|总计|实付|合計|総額|итого|к оплате`)
+	kanaPattern           = regexp.MustCompile(`[\p{Hiragana}\p{Katakana}]`)
+)
+
+var currencyCodes = map[string]string{
+	"US$": "USD", "$": "USD", "HK$": "HKD", "C$": "CAD", "A$": "AUD",
+	"€": "EUR", "£": "GBP", "₽": "RUB", "руб": "RUB", "руб.": "RUB",
+	"元": "CNY", "RMB": "CNY", "円": "JPY",
+}
+
+// extractAmount returns the most likely total as "<number> <currency>",
+// e.g. "1234.50 CNY", ties go to the later amount since totals come last
+func extractAmount(email models.Email, content []string) []string {
+	best, bestScore := "", 0
+	for _, text := range builtinTexts(content) {
+		japanese := kanaPattern.MatchString(text)
+		consider := func(start int, number, currency string) {
+			code, ok := currencyCodes[currency]
+			if !ok {
+				code = currency
+			}
+			if code == "￥" || code == "¥" {
+				code = "CNY"
+				if japanese {
+					code = "JPY"
+				}
+			}
+
+			score := 1
+			before := contextBefore(text, start, 60)
+			if amountKeywordPattern.MatchString(before) {
+				score += 3
+			}
+			if amountTotalPattern.MatchString(before) {
+				score++
+			}
+			if score >= bestScore {
+				best, bestScore = normalizeAmount(number)+" "+code, score
+			}
+		}
+
+		for _, loc := range currencyPrefixPattern.FindAllStringSubmatchIndex(text, -1) {
+			consider(loc[0], text[loc[4]:loc[5]], text[loc[2]:loc[3]])
+		}
+		for _, loc := range amountSuffixPattern.FindAllStringSubmatchIndex(text, -1) {
+			if loc[0] > 0 && (isDigit(text[loc[0]-1]) || text[loc[0]-1] == '.') {
+				continue
+			}
+			consider(loc[0], text[loc[2]:loc[3]], text[loc[4]:loc[5]])
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return []string{best}
+}
+
+// normalizeAmount removes thousands separators and uses a decimal point
+func normalizeAmount(number string) string {
+	number = strings.ReplaceAll(number, " ", "")
+	if i := strings.LastIndexAny(number, ".,"); i >= 0 && len(number)-i-1 <= 2 {
+		return strings.NewReplacer(",", "", ".", "").Replace(number[:i]) + "." + number[i+1:]
+	}
+	return strings.NewReplacer(",", "", ".", "").Replace(number)
+}
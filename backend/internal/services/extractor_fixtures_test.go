@@ -0,0 +1,38 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestBuiltinExtractorFixtures runs the fixture corpus that
+// cmd/extractor-fixtures reports on, so that go test catches regressions of
+// the builtin rules
+func TestBuiltinExtractorFixtures(t *testing.T) {
+	results, err := RunBuiltinExtractorFixtures()
+	if err != nil {
+		t.Fatalf("failed to run fixtures: %v", err)
+	}
+
+	covered := make(map[string]int)
+	for _, result := range results {
+		covered[result.Extractor]++
+		result := result
+		t.Run(result.Extractor+"/"+result.Fixture, func(t *testing.T) {
+			if result.Error != "" {
+				t.Fatalf("extraction failed: %s", result.Error)
+			}
+			if !result.Passed {
+				t.Fatalf("expected %q, got %q", result.Expected, result.Got)
+			}
+		})
+	}
+
+	// 每个版本的内置提取器都需要样例
+	for _, extractor := range builtinExtractors {
+		reference := fmt.Sprintf("%s@%d", extractor.Name, extractor.Version)
+		if covered[reference] == 0 {
+			t.Errorf("builtin extractor %s has no fixtures in builtin_fixtures/%s.json", reference, reference)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// html 提取器的表达式格式：
+//
+//	[css:|xpath:]selector[@output][|||replacement]
+//
+// 以 / 或 ( 开头的选择器按 XPath 处理，其余按 CSS 选择器处理，也可以用前缀显式指定。
+// output 为 text（默认，元素的文本）、html（元素的内部 HTML）或属性名，例如
+// a.verify@href；XPath 也可以直接选择属性，例如 //a/@href。replacement 中的 $0
+// 替换为提取到的值，例如 a.verify@href|||链接：$0。
+
+// htmlOutputPattern matches the output suffix of an html extractor expression
+var htmlOutputPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_:.-]*$`)
+
+// htmlSelector is a compiled html extractor expression
+type htmlSelector struct {
+	css         cascadia.SelectorGroup
+	xpath       *xpath.Expr
+	output      string
+	replacement string
+}
+
+// parseHTMLSelector compiles an html extractor expression
+func parseHTMLSelector(expression string) (*htmlSelector, error) {
+	parts := strings.SplitN(expression, "|||", 2)
+	selector := &htmlSelector{output: "text"}
+	if len(parts) > 1 {
+		selector.replacement = parts[1]
+	}
+
+	expr := strings.TrimSpace(parts[0])
+	useXPath := strings.HasPrefix(expr, "/") || strings.HasPrefix(expr, "(")
+	switch {
+	case strings.HasPrefix(expr, "xpath:"):
+		expr, useXPath = strings.TrimSpace(strings.TrimPrefix(expr, "xpath:")), true
+	case strings.HasPrefix(expr, "css:"):
+		expr, useXPath = strings.TrimSpace(strings.TrimPrefix(expr, "css:")), false
+	}
+
+	expr, selector.output = splitHTMLOutput(expr, useXPath)
+	if expr == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	if useXPath {
+		compiled, err := xpath.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XPath %q: %w", expr, err)
+		}
+		selector.xpath = compiled
+	} else {
+		group, err := cascadia.ParseGroup(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSS selector %q: %w", expr, err)
+		}
+		selector.css = group
+	}
+	return selector, nil
+}
+
+// splitHTMLOutput separates the @output suffix from a selector. An @ inside
+// quotes or brackets belongs to the selector, and so does an XPath attribute
+// step such as /@href.
+func splitHTMLOutput(expr string, useXPath bool) (string, string) {
+	at := strings.LastIndex(expr, "@")
+	if at <= 0 || !htmlOutputPattern.MatchString(expr[at+1:]) {
+		return expr, "text"
+	}
+	before := expr[:at]
+	if strings.Count(before, `"`)%2 == 1 || strings.Count(before, "'")%2 == 1 ||
+		strings.Count(before, "[") > strings.Count(before, "]") {
+		return expr, "text"
+	}
+	if useXPath && (strings.HasSuffix(before, "/") || strings.HasSuffix(before, "::")) {
+		return expr, "text"
+	}
+	return strings.TrimSpace(before), strings.ToLower(expr[at+1:])
+}
+
+// find returns the nodes selected in an HTML document
+func (s *htmlSelector) find(content string) ([]*html.Node, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	if s.xpath != nil {
+		return htmlquery.QuerySelectorAll(doc, s.xpath), nil
+	}
+	return cascadia.QueryAll(doc, s.css), nil
+}
+
+// value returns the output of a selected node and whether it has one
+func (s *htmlSelector) value(node *html.Node) (string, bool) {
+	switch s.output {
+	case "text":
+		return strings.Join(strings.Fields(htmlquery.InnerText(node)), " "), true
+	case "html":
+		return strings.TrimSpace(htmlquery.OutputHTML(node, false)), true
+	default:
+		if !htmlquery.ExistsAttr(node, s.output) {
+			return "", false
+		}
+		return strings.TrimSpace(htmlquery.SelectAttr(node, s.output)), true
+	}
+}
+
+// matchWithHTML matches when the selector finds a node in any of the contents
+func (s *ExtractorService) matchWithHTML(content []string, expression string) (*MatchResult, error) {
+	selector, err := parseHTMLSelector(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, text := range content {
+		if text == "" {
+			continue
+		}
+		nodes, err := selector.find(text)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if _, ok := selector.value(node); ok {
+				return &MatchResult{Matched: true}, nil
+			}
+		}
+	}
+
+	return &MatchResult{
+		Matched: false,
+		Reason:  "Selector matched no element",
+	}, nil
+}
+
+// extractWithHTML performs CSS selector or XPath based extraction from HTML content
+func (s *ExtractorService) extractWithHTML(content []string, expression string) ([]string, error) {
+	selector, err := parseHTMLSelector(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, text := range content {
+		if text == "" {
+			continue
+		}
+		nodes, err := selector.find(text)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			value, ok := selector.value(node)
+			if !ok || value == "" {
+				continue
+			}
+			if selector.replacement != "" {
+				value = strings.ReplaceAll(selector.replacement, "$0", value)
+			}
+			matches = append(matches, value)
+		}
+	}
+
+	return matches, nil
+}
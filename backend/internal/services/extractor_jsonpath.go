@@ -0,0 +1,134 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ohler55/ojg/jp"
+	"github.com/ohler55/ojg/oj"
+)
+
+// jsonpath 提取器的表达式格式：
+//
+//	$.path.to.value[|||replacement]
+//
+// 标量返回其文本，对象和数组返回序列化后的 JSON；null 和不存在的路径不产生结果。
+// replacement 中的 $0 替换为提取到的值。内容不是 JSON 时跳过，不报错，这样同一模板
+// 可以用于只有部分邮件携带 JSON 的场景。
+
+// jsonPathExpr is a compiled jsonpath extractor expression
+type jsonPathExpr struct {
+	expr        jp.Expr
+	replacement string
+}
+
+func parseJSONPath(expression string) (*jsonPathExpr, error) {
+	parts := strings.SplitN(expression, "|||", 2)
+	source := strings.TrimSpace(parts[0])
+	if source == "" {
+		return nil, fmt.Errorf("empty JSONPath expression")
+	}
+
+	expr, err := jp.ParseString(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %w", source, err)
+	}
+	parsed := &jsonPathExpr{expr: expr}
+	if len(parts) > 1 {
+		parsed.replacement = parts[1]
+	}
+	return parsed, nil
+}
+
+// values evaluates the expression on a JSON document, nil when content is not JSON
+func (e *jsonPathExpr) values(content string) ([]string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" || (content[0] != '{' && content[0] != '[') {
+		return nil, nil
+	}
+	doc, err := oj.ParseString(content)
+	if err != nil {
+		return nil, nil
+	}
+
+	var values []string
+	for _, result := range e.expr.Get(doc) {
+		value, err := jsonPathValue(result)
+		if err != nil {
+			return nil, err
+		}
+		if value == "" {
+			continue
+		}
+		if e.replacement != "" {
+			value = strings.ReplaceAll(e.replacement, "$0", value)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// jsonPathValue formats a JSONPath result: scalars as text, sub-documents as JSON
+func jsonPathValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to serialize JSONPath result: %w", err)
+		}
+		return string(data), nil
+	}
+}
+
+// matchWithJSONPath matches when the expression yields a value in any of the contents
+func (s *ExtractorService) matchWithJSONPath(content []string, expression string) (*MatchResult, error) {
+	expr, err := parseJSONPath(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, text := range content {
+		values, err := expr.values(text)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			return &MatchResult{Matched: true}, nil
+		}
+	}
+
+	return &MatchResult{
+		Matched: false,
+		Reason:  "JSONPath matched no value",
+	}, nil
+}
+
+// extractWithJSONPath performs JSONPath based extraction from JSON content
+func (s *ExtractorService) extractWithJSONPath(content []string, expression string) ([]string, error) {
+	expr, err := parseJSONPath(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, text := range content {
+		values, err := expr.values(text)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, values...)
+	}
+	return matches, nil
+}
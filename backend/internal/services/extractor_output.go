@@ -0,0 +1,151 @@
+package services
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 命名输出：提取器设置 name 后，其结果按 output_type 转换后写入 ExtractorResult.Values，
+// 转换失败或缺少必需的值时记录到 ExtractorResult.Errors。未命名的提取器只出现在 matches 中。
+
+// Output types of named extractors
+const (
+	ExtractorOutputString = "string" // 第一个匹配，默认类型
+	ExtractorOutputNumber = "number" // 第一个匹配中的数字
+	ExtractorOutputDate   = "date"   // 第一个匹配解析为时间
+	ExtractorOutputURL    = "url"    // 第一个匹配，必须是 http(s) 链接
+	ExtractorOutputList   = "list"   // 全部匹配
+)
+
+// ExtractionError is a validation error of a named extractor output
+type ExtractionError struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// IsValidExtractorOutputType reports whether t is a supported output type, empty means string
+func IsValidExtractorOutputType(t string) bool {
+	switch t {
+	case "", ExtractorOutputString, ExtractorOutputNumber, ExtractorOutputDate, ExtractorOutputURL, ExtractorOutputList:
+		return true
+	}
+	return false
+}
+
+// ValidateExtractorOutputs checks the output settings of extractors: output
+// types must be supported, typed or required outputs need a name and names
+// must be unique
+func ValidateExtractorOutputs(extractors []ExtractorConfig) error {
+	names := make(map[string]int, len(extractors))
+	for i, extractor := range extractors {
+		if !IsValidExtractorOutputType(extractor.OutputType) {
+			return fmt.Errorf("invalid output_type '%s' in extractor %d", extractor.OutputType, i)
+		}
+		name := strings.TrimSpace(extractor.Name)
+		if name == "" {
+			if extractor.OutputType != "" || extractor.Required {
+				return fmt.Errorf("extractor %d sets output_type or required without a name", i)
+			}
+			continue
+		}
+		if previous, ok := names[name]; ok {
+			return fmt.Errorf("extractors %d and %d have the same name '%s'", previous, i, name)
+		}
+		names[name] = i
+	}
+	return nil
+}
+
+// collectOutputs converts the matches of named extractors into typed values
+func collectOutputs(extractors []ExtractorConfig, matches [][]string) (map[string]interface{}, []ExtractionError) {
+	values := make(map[string]interface{})
+	var errors []ExtractionError
+	for i, extractor := range extractors {
+		name := strings.TrimSpace(extractor.Name)
+		if name == "" {
+			continue
+		}
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if len(matches[i]) == 0 {
+			if extractor.Required {
+				errors = append(errors, ExtractionError{Name: name, Message: "required value is missing"})
+			}
+			continue
+		}
+
+		value, err := convertOutput(extractor.OutputType, matches[i])
+		if err != nil {
+			errors = append(errors, ExtractionError{Name: name, Message: err.Error()})
+			continue
+		}
+		values[name] = value
+	}
+	return values, errors
+}
+
+var numberPattern = regexp.MustCompile(`[-+]?\d[\d,]*(\.\d+)?|[-+]?\.\d+`)
+
+// outputDateLayouts are the date formats accepted by the date output type
+var outputDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"2006年1月2日 15:04",
+	"2006年1月2日",
+	"02.01.2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+func convertOutput(outputType string, matches []string) (interface{}, error) {
+	first := strings.TrimSpace(matches[0])
+	switch outputType {
+	case "", ExtractorOutputString:
+		return first, nil
+	case ExtractorOutputList:
+		return matches, nil
+	case ExtractorOutputNumber:
+		// 允许货币符号和千位分隔符，例如 "¥1,234.50"
+		found := numberPattern.FindString(first)
+		if found == "" {
+			return nil, fmt.Errorf("cannot convert %q to a number", first)
+		}
+		number, err := strconv.ParseFloat(strings.ReplaceAll(found, ",", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q to a number", first)
+		}
+		return number, nil
+	case ExtractorOutputDate:
+		for _, layout := range outputDateLayouts {
+			if parsed, err := time.Parse(layout, first); err == nil {
+				return parsed, nil
+			}
+		}
+		// 邮件头格式，例如 "Mon, 2 Jan 2006 15:04:05 -0700"
+		if parsed, err := mail.ParseDate(first); err == nil {
+			return parsed, nil
+		}
+		return nil, fmt.Errorf("cannot convert %q to a date", first)
+	case ExtractorOutputURL:
+		parsed, err := url.Parse(first)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("%q is not an http(s) URL", first)
+		}
+		return parsed.String(), nil
+	default:
+		return nil, fmt.Errorf("unsupported output type %q", outputType)
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+
+	"mailman/internal/models"
+)
+
+// Operations of a revision change
+const (
+	RevisionChangeAdded   = "added"
+	RevisionChangeRemoved = "removed"
+	RevisionChangeChanged = "changed"
+)
+
+// ExtractorRevisionChange is one difference between two extractor template revisions
+type ExtractorRevisionChange struct {
+	// Changed path, e.g. name, extractors[1] or extractors[1].extract
+	Path string      `json:"path" example:"extractors[0].extract"`
+	Op   string      `json:"op" example:"changed"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// DiffExtractorRevisions lists the changes from one revision to another.
+// Extractors are compared by position; from may be nil for the first revision.
+func DiffExtractorRevisions(from, to *models.ExtractorTemplateRevision) []ExtractorRevisionChange {
+	if from == nil {
+		from = &models.ExtractorTemplateRevision{}
+	}
+
+	changes := []ExtractorRevisionChange{}
+	changes = appendChange(changes, "name", from.Name, to.Name)
+	changes = appendChange(changes, "description", from.Description, to.Description)
+
+	for i := 0; i < len(from.Extractors) || i < len(to.Extractors); i++ {
+		path := fmt.Sprintf("extractors[%d]", i)
+		switch {
+		case i >= len(from.Extractors):
+			changes = append(changes, ExtractorRevisionChange{Path: path, Op: RevisionChangeAdded, New: to.Extractors[i]})
+		case i >= len(to.Extractors):
+			changes = append(changes, ExtractorRevisionChange{Path: path, Op: RevisionChangeRemoved, Old: from.Extractors[i]})
+		default:
+			before, after := from.Extractors[i], to.Extractors[i]
+			changes = appendChange(changes, path+".field", before.Field, after.Field)
+			changes = appendChange(changes, path+".type", before.Type, after.Type)
+			changes = appendChange(changes, path+".match", derefString(before.Match), derefString(after.Match))
+			changes = appendChange(changes, path+".extract", before.Extract, after.Extract)
+			changes = appendChange(changes, path+".name", before.Name, after.Name)
+			changes = appendChange(changes, path+".output_type", before.OutputType, after.OutputType)
+			if before.Required != after.Required {
+				changes = append(changes, ExtractorRevisionChange{Path: path + ".required", Op: RevisionChangeChanged, Old: before.Required, New: after.Required})
+			}
+		}
+	}
+	return changes
+}
+
+// appendChange records a string value that was added, removed or changed
+func appendChange(changes []ExtractorRevisionChange, path, before, after string) []ExtractorRevisionChange {
+	switch {
+	case before == after:
+		return changes
+	case before == "":
+		return append(changes, ExtractorRevisionChange{Path: path, Op: RevisionChangeAdded, New: after})
+	case after == "":
+		return append(changes, ExtractorRevisionChange{Path: path, Op: RevisionChangeRemoved, Old: before})
+	default:
+		return append(changes, ExtractorRevisionChange{Path: path, Op: RevisionChangeChanged, Old: before, New: after})
+	}
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
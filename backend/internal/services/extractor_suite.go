@@ -0,0 +1,351 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+)
+
+// ExtractorFixtureDiff is one difference between the expected and the actual output
+type ExtractorFixtureDiff struct {
+	// Differing path, e.g. matches, matches[0] or values.order_id
+	Path     string      `json:"path" example:"values.order_id"`
+	Expected interface{} `json:"expected,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+}
+
+// ExtractorFixtureResult is the outcome of running one fixture
+type ExtractorFixtureResult struct {
+	FixtureID uint                           `json:"fixture_id"`
+	Name      string                         `json:"name"`
+	Status    string                         `json:"status" example:"passed"`
+	Error     string                         `json:"error,omitempty"`
+	Expected  models.ExtractorFixtureOutput  `json:"expected"`
+	Actual    *models.ExtractorFixtureOutput `json:"actual,omitempty"`
+	Diffs     []ExtractorFixtureDiff         `json:"diffs,omitempty"`
+	// The fixture passes with the current extractors but not with the proposed ones
+	Regressed bool `json:"regressed,omitempty"`
+}
+
+// ExtractorSuiteResult is the outcome of running the fixtures of a template
+type ExtractorSuiteResult struct {
+	TemplateID  uint                     `json:"template_id"`
+	Total       int                      `json:"total"`
+	Passed      int                      `json:"passed"`
+	Failed      int                      `json:"failed"`
+	Regressions int                      `json:"regressions"`
+	Fixtures    []ExtractorFixtureResult `json:"fixtures"`
+	RunAt       time.Time                `json:"run_at"`
+}
+
+// ExtractorSuiteService runs the regression fixtures of extractor templates
+type ExtractorSuiteService struct {
+	fixtureRepo  *repository.ExtractorFixtureRepository
+	templateRepo *repository.ExtractorTemplateRepository
+	emailRepo    *repository.EmailRepository
+	extractor    *ExtractorService
+	parser       *ParserService
+}
+
+// NewExtractorSuiteService creates the extractor suite service
+func NewExtractorSuiteService(
+	fixtureRepo *repository.ExtractorFixtureRepository,
+	templateRepo *repository.ExtractorTemplateRepository,
+	emailRepo *repository.EmailRepository,
+) *ExtractorSuiteService {
+	return &ExtractorSuiteService{
+		fixtureRepo:  fixtureRepo,
+		templateRepo: templateRepo,
+		emailRepo:    emailRepo,
+		extractor:    NewExtractorService(),
+		parser:       NewParserService(),
+	}
+}
+
+// BuiltinSignature identifies the latest versions of the builtin extractors,
+// it changes whenever a release adds a version
+func BuiltinSignature() string {
+	latest := make(map[string]int)
+	for _, extractor := range builtinExtractors {
+		if extractor.Version > latest[extractor.Name] {
+			latest[extractor.Name] = extractor.Version
+		}
+	}
+	parts := make([]string, 0, len(latest))
+	for name, version := range latest {
+		parts = append(parts, fmt.Sprintf("%s@%d", name, version))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Output runs extractors against the email of a fixture
+func (s *ExtractorSuiteService) Output(fixture *models.ExtractorFixture, extractors []ExtractorConfig) (*models.ExtractorFixtureOutput, error) {
+	email, err := s.fixtureEmail(fixture)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.extractor.ExtractFromEmail(*email, extractors)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &models.ExtractorFixtureOutput{Matches: []string{}}
+	if result != nil {
+		output.Matches = result.Matches
+		if len(result.Values) > 0 {
+			output.Values = result.Values
+		}
+	}
+	// 统一为 JSON 表示，日期等类型与存储后的期望值一致
+	if err := normalizeOutput(output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// fixtureEmail loads the referenced email or parses the uploaded message
+func (s *ExtractorSuiteService) fixtureEmail(fixture *models.ExtractorFixture) (*models.Email, error) {
+	switch fixture.Source {
+	case models.ExtractorFixtureSourceEmail:
+		if fixture.EmailID == nil {
+			return nil, fmt.Errorf("fixture has no email")
+		}
+		return s.emailRepo.GetByID(*fixture.EmailID)
+	case models.ExtractorFixtureSourceEML:
+		email, err := s.parser.ParseEmail(fixture.RawMessage)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message: %w", err)
+		}
+		return email, nil
+	default:
+		return nil, fmt.Errorf("unknown fixture source %q", fixture.Source)
+	}
+}
+
+// Run runs all fixtures of a template against extractors
+func (s *ExtractorSuiteService) Run(templateID uint, extractors []ExtractorConfig) (*ExtractorSuiteResult, error) {
+	fixtures, err := s.fixtureRepo.ListByTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	suite := &ExtractorSuiteResult{
+		TemplateID: templateID,
+		Fixtures:   make([]ExtractorFixtureResult, 0, len(fixtures)),
+		RunAt:      time.Now(),
+	}
+	for i := range fixtures {
+		result := s.runFixture(&fixtures[i], extractors)
+		suite.Total++
+		if result.Status == models.ExtractorFixturePassed {
+			suite.Passed++
+		} else {
+			suite.Failed++
+		}
+		suite.Fixtures = append(suite.Fixtures, result)
+	}
+	return suite, nil
+}
+
+// Check runs the fixtures of a template against proposed extractors. Fixtures
+// failing with them are run against the current extractors as well; those
+// passing there are regressions.
+func (s *ExtractorSuiteService) Check(templateID uint, current, proposed []ExtractorConfig) (*ExtractorSuiteResult, error) {
+	suite, err := s.Run(templateID, proposed)
+	if err != nil {
+		return nil, err
+	}
+	if suite.Failed == 0 {
+		return suite, nil
+	}
+
+	fixtures, err := s.fixtureRepo.ListByTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*models.ExtractorFixture, len(fixtures))
+	for i := range fixtures {
+		byID[fixtures[i].ID] = &fixtures[i]
+	}
+	for i := range suite.Fixtures {
+		result := &suite.Fixtures[i]
+		fixture, ok := byID[result.FixtureID]
+		if result.Status == models.ExtractorFixturePassed || !ok {
+			continue
+		}
+		if before := s.runFixture(fixture, current); before.Status == models.ExtractorFixturePassed {
+			result.Regressed = true
+			suite.Regressions++
+		}
+	}
+	return suite, nil
+}
+
+// Record stores the results of a suite run on its fixtures
+func (s *ExtractorSuiteService) Record(suite *ExtractorSuiteResult) error {
+	builtins := BuiltinSignature()
+	for _, result := range suite.Fixtures {
+		if err := s.fixtureRepo.SaveResult(result.FixtureID, result.Status, builtins, suite.RunAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunAfterBuiltinUpgrade reruns the suites last run with other builtin
+// extractor versions, i.e. before an upgrade, and reports fixtures that
+// passed before and fail now
+func (s *ExtractorSuiteService) RunAfterBuiltinUpgrade() error {
+	templateIDs, err := s.fixtureRepo.TemplatesRunWithOtherBuiltins(BuiltinSignature())
+	if err != nil {
+		return err
+	}
+
+	for _, templateID := range templateIDs {
+		template, err := s.templateRepo.GetByID(templateID)
+		if err != nil {
+			continue // 模板已删除
+		}
+		fixtures, err := s.fixtureRepo.ListByTemplate(templateID)
+		if err != nil {
+			return err
+		}
+		previous := make(map[uint]string, len(fixtures))
+		for _, fixture := range fixtures {
+			previous[fixture.ID] = fixture.LastStatus
+		}
+
+		suite, err := s.Run(templateID, TemplateExtractorConfigs(template.Extractors))
+		if err != nil {
+			return err
+		}
+		if err := s.Record(suite); err != nil {
+			return err
+		}
+
+		var regressed []string
+		for _, result := range suite.Fixtures {
+			if result.Status != models.ExtractorFixturePassed && previous[result.FixtureID] == models.ExtractorFixturePassed {
+				regressed = append(regressed, result.Name)
+			}
+		}
+		if len(regressed) == 0 {
+			continue
+		}
+		log.Printf("[ExtractorSuite] Builtin extractor upgrade broke %d fixture(s) of template %q: %s", len(regressed), template.Name, strings.Join(regressed, ", "))
+		description := fmt.Sprintf("内置提取器升级后，模板「%s」的 %d 个测试用例未通过：%s", template.Name, len(regressed), strings.Join(regressed, ", "))
+		GetActivityLogger().LogFailedActivity(models.ActivityExtractorSuiteFailed, "提取模板回归测试失败", description, nil, suite)
+	}
+	return nil
+}
+
+// runFixture runs one fixture and compares the output with its expectation
+func (s *ExtractorSuiteService) runFixture(fixture *models.ExtractorFixture, extractors []ExtractorConfig) ExtractorFixtureResult {
+	result := ExtractorFixtureResult{
+		FixtureID: fixture.ID,
+		Name:      fixture.Name,
+		Expected:  fixture.Expected,
+	}
+	actual, err := s.Output(fixture, extractors)
+	if err != nil {
+		result.Status = models.ExtractorFixtureError
+		result.Error = err.Error()
+		return result
+	}
+
+	expected := fixture.Expected
+	if err := normalizeOutput(&expected); err != nil {
+		result.Status = models.ExtractorFixtureError
+		result.Error = err.Error()
+		return result
+	}
+	result.Actual = actual
+	result.Diffs = diffFixtureOutput(expected, *actual)
+	if len(result.Diffs) == 0 {
+		result.Status = models.ExtractorFixturePassed
+	} else {
+		result.Status = models.ExtractorFixtureFailed
+	}
+	return result
+}
+
+// TemplateExtractorConfigs converts stored template extractors for the extractor service
+func TemplateExtractorConfigs(configs models.ExtractorTemplateConfigs) []ExtractorConfig {
+	extractors := make([]ExtractorConfig, 0, len(configs))
+	for _, config := range configs {
+		extractors = append(extractors, ExtractorConfig{
+			Field:      ExtractorField(config.Field),
+			Type:       ExtractorType(config.Type),
+			Match:      config.Match,
+			Extract:    config.Extract,
+			Name:       config.Name,
+			OutputType: config.OutputType,
+			Required:   config.Required,
+		})
+	}
+	return extractors
+}
+
+// normalizeOutput replaces the values with their JSON representation
+func normalizeOutput(output *models.ExtractorFixtureOutput) error {
+	if output.Matches == nil {
+		output.Matches = []string{}
+	}
+	if len(output.Values) == 0 {
+		output.Values = nil
+		return nil
+	}
+	data, err := json.Marshal(output.Values)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	output.Values = values
+	return nil
+}
+
+// diffFixtureOutput compares normalized outputs
+func diffFixtureOutput(expected, actual models.ExtractorFixtureOutput) []ExtractorFixtureDiff {
+	var diffs []ExtractorFixtureDiff
+	if len(expected.Matches) != len(actual.Matches) {
+		diffs = append(diffs, ExtractorFixtureDiff{Path: "matches", Expected: expected.Matches, Actual: actual.Matches})
+	} else {
+		for i := range expected.Matches {
+			if expected.Matches[i] != actual.Matches[i] {
+				diffs = append(diffs, ExtractorFixtureDiff{Path: fmt.Sprintf("matches[%d]", i), Expected: expected.Matches[i], Actual: actual.Matches[i]})
+			}
+		}
+	}
+
+	names := make(map[string]bool)
+	for name := range expected.Values {
+		names[name] = true
+	}
+	for name := range actual.Values {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		want, hasWant := expected.Values[name]
+		got, hasGot := actual.Values[name]
+		if hasWant != hasGot || !reflect.DeepEqual(want, got) {
+			diffs = append(diffs, ExtractorFixtureDiff{Path: "values." + name, Expected: want, Actual: got})
+		}
+	}
+	return diffs
+}
@@ -548,6 +548,7 @@ func (s *FetcherService) fetchEmailsFromServer(account models.EmailAccount, opti
 		email.To = convertAddresses(msg.Envelope.To)
 		email.Cc = convertAddresses(msg.Envelope.Cc)
 		email.Bcc = convertAddresses(msg.Envelope.Bcc)
+		email.ReplyTo = convertAddresses(msg.Envelope.ReplyTo)
 
 		// Convert flags
 		for _, flag := range msg.Flags {
@@ -1966,6 +1967,8 @@ func (s *FetcherService) convertGmailMessage(gmailMsg *gmail.Message, accountID
 			email.Cc = models.StringSlice{header.Value}
 		case "Bcc":
 			email.Bcc = models.StringSlice{header.Value}
+		case "Reply-To":
+			email.ReplyTo = models.StringSlice{header.Value}
 		case "Date":
 			if parsedDate, err := time.Parse(time.RFC1123Z, header.Value); err == nil {
 				email.Date = parsedDate
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"mailman/internal/models"
 	"mailman/internal/repository"
+	"mailman/internal/secrets"
 )
 
 // OAuth2GlobalConfigService handles OAuth2 global configuration business logic
@@ -49,6 +50,9 @@ func (s *OAuth2GlobalConfigService) CreateOrUpdateConfig(config *models.OAuth2Gl
 
 	// 如果ID存在且大于0，执行更新操作
 	if config.ID > 0 {
+		if err := s.keepRedactedSecret(config); err != nil {
+			return err
+		}
 		return s.repo.Update(config)
 	}
 
@@ -94,10 +98,26 @@ func (s *OAuth2GlobalConfigService) UpdateConfig(config *models.OAuth2GlobalConf
 	if config.RedirectURI == "" {
 		return fmt.Errorf("redirect URI is required")
 	}
+	if err := s.keepRedactedSecret(config); err != nil {
+		return err
+	}
 
 	return s.repo.Update(config)
 }
 
+// keepRedactedSecret 客户端回传脱敏占位符时保留已保存的 client secret
+func (s *OAuth2GlobalConfigService) keepRedactedSecret(config *models.OAuth2GlobalConfig) error {
+	if !secrets.IsRedacted(config.ClientSecret) {
+		return nil
+	}
+	existing, err := s.repo.GetByID(config.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load existing config: %w", err)
+	}
+	config.ClientSecret = existing.ClientSecret
+	return nil
+}
+
 // GetAllConfigs retrieves all OAuth2 configurations
 func (s *OAuth2GlobalConfigService) GetAllConfigs() ([]models.OAuth2GlobalConfig, error) {
 	return s.repo.GetAll()
@@ -270,6 +270,19 @@ func (s *OpenAIService) ParseExtractorTemplate(content string) (models.Extractor
 		if err := json.Unmarshal([]byte(jsonContent), &configs); err != nil {
 			return nil, fmt.Errorf("failed to parse extractor configuration: %w", err)
 		}
+		outputs := make([]ExtractorConfig, 0, len(configs))
+		for i, config := range configs {
+			if !IsValidExtractorField(config.Field) {
+				return nil, fmt.Errorf("extractor %d has invalid field %q", i, config.Field)
+			}
+			if !IsValidExtractorType(config.Type) {
+				return nil, fmt.Errorf("extractor %d has invalid type %q", i, config.Type)
+			}
+			outputs = append(outputs, ExtractorConfig{Name: config.Name, OutputType: config.OutputType, Required: config.Required})
+		}
+		if err := ValidateExtractorOutputs(outputs); err != nil {
+			return nil, err
+		}
 		return configs, nil
 	}
 
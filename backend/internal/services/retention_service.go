@@ -0,0 +1,276 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+)
+
+// RetentionReportItem 单个策略在单个邮箱文件夹（或日志表）上的清理结果
+type RetentionReportItem struct {
+	PolicyID    uint                   `json:"policy_id"`
+	PolicyName  string                 `json:"policy_name"`
+	Target      models.RetentionTarget `json:"target"`
+	AccountID   uint                   `json:"account_id,omitempty"`
+	MailboxName string                 `json:"mailbox_name,omitempty"`
+	repository.RetentionCounts
+}
+
+// RetentionReport 一次保留策略执行（或预览）的结果
+type RetentionReport struct {
+	DryRun        bool                  `json:"dry_run"`
+	StartedAt     time.Time             `json:"started_at"`
+	FinishedAt    time.Time             `json:"finished_at"`
+	Items         []RetentionReportItem `json:"items"`
+	TotalDeleted  int64                 `json:"total_deleted"`
+	TotalStripped int64                 `json:"total_stripped"`
+}
+
+// RetentionService 按保留策略定期清理邮件和日志
+type RetentionService struct {
+	policyRepo     *repository.RetentionPolicyRepository
+	emailRepo      *repository.EmailRepository
+	triggerLogRepo *repository.TriggerExecutionLogRepository
+	activityRepo   *repository.ActivityLogRepository
+	interval       time.Duration
+
+	runMu  sync.Mutex // 同一时间只允许一次清理
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewRetentionService 创建保留策略服务
+func NewRetentionService(
+	policyRepo *repository.RetentionPolicyRepository,
+	emailRepo *repository.EmailRepository,
+	triggerLogRepo *repository.TriggerExecutionLogRepository,
+	interval time.Duration,
+) *RetentionService {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &RetentionService{
+		policyRepo:     policyRepo,
+		emailRepo:      emailRepo,
+		triggerLogRepo: triggerLogRepo,
+		activityRepo:   repository.NewActivityLogRepository(),
+		interval:       interval,
+		stopCh:         make(chan struct{}),
+	}
+}
+
+// Start 启动后台清理任务
+func (s *RetentionService) Start() {
+	log.Printf("[RetentionService] Starting retention job, interval %v", s.interval)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.Run(false); err != nil {
+					log.Printf("[RetentionService] Retention run failed: %v", err)
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清理任务
+func (s *RetentionService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+	log.Printf("[RetentionService] Retention job stopped")
+}
+
+// Preview 预览清理结果，不修改任何数据
+func (s *RetentionService) Preview() (*RetentionReport, error) {
+	return s.Run(true)
+}
+
+// Run 执行所有启用的保留策略；dryRun 为 true 时只统计
+func (s *RetentionService) Run(dryRun bool) (*RetentionReport, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	report := &RetentionReport{DryRun: dryRun, StartedAt: time.Now(), Items: []RetentionReportItem{}}
+
+	policies, err := s.policyRepo.GetEnabled()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load retention policies: %w", err)
+	}
+
+	var emailPolicies []models.RetentionPolicy
+	purged := make(map[uint]int64)
+	for i := range policies {
+		policy := &policies[i]
+		if policy.Target == models.RetentionTargetEmails {
+			emailPolicies = append(emailPolicies, *policy)
+			continue
+		}
+
+		item, err := s.applyLogPolicy(policy, report.StartedAt, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d: %w", policy.ID, err)
+		}
+		report.add(item)
+		purged[policy.ID] += item.Total()
+	}
+
+	if len(emailPolicies) > 0 {
+		keys, err := s.emailRepo.ListMailboxKeys()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list mailboxes: %w", err)
+		}
+
+		for _, key := range keys {
+			policy := resolveEmailPolicy(emailPolicies, key)
+			if policy == nil {
+				continue
+			}
+
+			counts, err := s.emailRepo.ApplyRetention(key, emailRetentionRules(policy, report.StartedAt), dryRun)
+			if err != nil {
+				return nil, fmt.Errorf("policy %d, account %d mailbox %q: %w", policy.ID, key.AccountID, key.MailboxName, err)
+			}
+			if counts.Total() == 0 {
+				continue
+			}
+
+			report.add(RetentionReportItem{
+				PolicyID:        policy.ID,
+				PolicyName:      policy.Name,
+				Target:          policy.Target,
+				AccountID:       key.AccountID,
+				MailboxName:     key.MailboxName,
+				RetentionCounts: counts,
+			})
+			purged[policy.ID] += counts.Total()
+		}
+
+		for _, policy := range emailPolicies {
+			if _, ok := purged[policy.ID]; !ok {
+				purged[policy.ID] = 0
+			}
+		}
+	}
+
+	report.FinishedAt = time.Now()
+
+	if !dryRun {
+		for policyID, count := range purged {
+			if err := s.policyRepo.UpdateRunStats(policyID, report.FinishedAt, count); err != nil {
+				log.Printf("[RetentionService] Failed to update stats of policy %d: %v", policyID, err)
+			}
+		}
+		s.logPurges(report)
+	}
+
+	return report, nil
+}
+
+// applyLogPolicy 对触发器执行日志或活动日志应用策略
+func (s *RetentionService) applyLogPolicy(policy *models.RetentionPolicy, now time.Time, dryRun bool) (RetentionReportItem, error) {
+	item := RetentionReportItem{PolicyID: policy.ID, PolicyName: policy.Name, Target: policy.Target}
+
+	deleteBefore := retentionCutoff(now, policy.DeleteAfterDays)
+	var err error
+	switch policy.Target {
+	case models.RetentionTargetTriggerLogs:
+		item.RetentionCounts, err = s.triggerLogRepo.ApplyRetention(deleteBefore, policy.MaxMessages, dryRun)
+	case models.RetentionTargetActivityLogs:
+		item.RetentionCounts, err = s.activityRepo.ApplyRetention(deleteBefore, policy.MaxMessages, dryRun)
+	default:
+		err = fmt.Errorf("unknown retention target %q", policy.Target)
+	}
+	return item, err
+}
+
+// logPurges 为每次实际清理记录活动日志
+func (s *RetentionService) logPurges(report *RetentionReport) {
+	logger := GetActivityLogger()
+	for _, item := range report.Items {
+		if item.Total() == 0 {
+			continue
+		}
+
+		location := string(item.Target)
+		if item.Target == models.RetentionTargetEmails {
+			location = fmt.Sprintf("账户 %d 的 %s", item.AccountID, item.MailboxName)
+		}
+		description := fmt.Sprintf("策略「%s」清理了%s：删除 %d 条，超出数量上限删除 %d 条，精简内容 %d 条",
+			item.PolicyName, location, item.Deleted, item.OverLimit, item.Stripped)
+
+		logger.LogActivity(models.ActivityRetentionPurged, "数据保留清理", description, nil, item)
+	}
+}
+
+// add 累加单项结果
+func (r *RetentionReport) add(item RetentionReportItem) {
+	r.Items = append(r.Items, item)
+	r.TotalDeleted += item.Deleted + item.OverLimit
+	r.TotalStripped += item.Stripped
+}
+
+// resolveEmailPolicy 为邮箱文件夹选择最具体的策略：mailbox > account > global
+func resolveEmailPolicy(policies []models.RetentionPolicy, key repository.MailboxKey) *models.RetentionPolicy {
+	var best *models.RetentionPolicy
+	bestRank := 0
+	for i := range policies {
+		policy := &policies[i]
+
+		rank := 0
+		switch policy.Scope {
+		case models.RetentionScopeGlobal:
+			rank = 1
+		case models.RetentionScopeAccount:
+			if policy.AccountID != nil && *policy.AccountID == key.AccountID {
+				rank = 2
+			}
+		case models.RetentionScopeMailbox:
+			if strings.EqualFold(policy.MailboxName, key.MailboxName) {
+				if policy.AccountID == nil {
+					rank = 3
+				} else if *policy.AccountID == key.AccountID {
+					rank = 4
+				}
+			}
+		}
+
+		// 同级别时ID较小（先创建）的策略优先
+		if rank > bestRank {
+			best, bestRank = policy, rank
+		}
+	}
+	return best
+}
+
+// emailRetentionRules 将策略转换为邮件清理规则
+func emailRetentionRules(policy *models.RetentionPolicy, now time.Time) repository.RetentionRules {
+	return repository.RetentionRules{
+		DeleteBefore: retentionCutoff(now, policy.DeleteAfterDays),
+		StripBefore:  retentionCutoff(now, policy.StripContentAfterDays),
+		MaxMessages:  policy.MaxMessages,
+	}
+}
+
+// retentionCutoff 返回 now 之前 days 天的时间点，days 为 0 表示不启用
+func retentionCutoff(now time.Time, days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+	t := now.AddDate(0, 0, -days)
+	return &t
+}
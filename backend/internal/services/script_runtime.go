@@ -0,0 +1,648 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"mailman/internal/models"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+)
+
+// Errors of scripts stopped by the runtime
+var (
+	ErrScriptTimeout        = errors.New("script exceeded its wall-clock time limit")
+	ErrScriptHeap           = errors.New("process heap exceeded the script heap ceiling while the script was running")
+	ErrScriptOutputTooLarge = errors.New("script output exceeds the size limit")
+)
+
+// ScriptLimits bounds the script runs. goja cannot account CPU time or
+// allocations to a single VM, so the limits are what can be measured: the
+// wall-clock time of a run and the heap of the whole process.
+type ScriptLimits struct {
+	// 单次运行的墙钟时间。脚本没有异步或 I/O 接口，但与其他 goroutine 共享 CPU，
+	// 机器繁忙时脚本实际得到的 CPU 时间会少于该值
+	WallTime time.Duration
+	// 进程堆的上限：脚本运行期间整个进程的堆超过该值时中断脚本。其他脚本和同步、
+	// 搜索等任务的分配也计算在内，因此这是进程级的保护，不是单个脚本的内存限额
+	HeapCeilingBytes uint64
+	// 返回值序列化为 JSON 后的大小上限
+	OutputBytes int
+}
+
+// DefaultScriptLimits are used until ConfigureScriptRuntime is called
+var DefaultScriptLimits = ScriptLimits{
+	WallTime:         2 * time.Second,
+	HeapCeilingBytes: 1 << 30,
+	OutputBytes:      256 << 10,
+}
+
+const (
+	scriptMaxCallStack    = 1024
+	scriptHeapInterval    = 10 * time.Millisecond
+	scriptProgramCacheMax = 256
+	scriptHeapMetric      = "/memory/classes/heap/objects:bytes"
+)
+
+// ScriptInput is what a script sees besides the globals
+type ScriptInput struct {
+	Email   models.Email
+	Content []string // 提取器字段的内容，触发条件为邮件的全部文本
+}
+
+// ScriptRuntime runs the JavaScript of extractors and trigger conditions in
+// pooled goja VMs. Every run is interrupted once it exceeds its limits, and
+// the global environment is frozen so that scripts cannot affect each other.
+type ScriptRuntime struct {
+	limits ScriptLimits
+	pool   chan *scriptVM
+
+	mu       sync.Mutex
+	programs map[string]*goja.Program
+}
+
+var (
+	scriptRuntimeMu       sync.Mutex
+	scriptRuntimeInstance *ScriptRuntime
+)
+
+// ConfigureScriptRuntime replaces the shared script runtime
+func ConfigureScriptRuntime(limits ScriptLimits, poolSize int) {
+	scriptRuntimeMu.Lock()
+	defer scriptRuntimeMu.Unlock()
+	scriptRuntimeInstance = NewScriptRuntime(limits, poolSize)
+}
+
+// GetScriptRuntime 获取共享的脚本运行时
+func GetScriptRuntime() *ScriptRuntime {
+	scriptRuntimeMu.Lock()
+	defer scriptRuntimeMu.Unlock()
+	if scriptRuntimeInstance == nil {
+		scriptRuntimeInstance = NewScriptRuntime(DefaultScriptLimits, 8)
+	}
+	return scriptRuntimeInstance
+}
+
+// NewScriptRuntime creates a script runtime keeping up to poolSize idle VMs
+func NewScriptRuntime(limits ScriptLimits, poolSize int) *ScriptRuntime {
+	if limits.WallTime <= 0 {
+		limits.WallTime = DefaultScriptLimits.WallTime
+	}
+	if limits.HeapCeilingBytes == 0 {
+		limits.HeapCeilingBytes = DefaultScriptLimits.HeapCeilingBytes
+	}
+	if limits.OutputBytes <= 0 {
+		limits.OutputBytes = DefaultScriptLimits.OutputBytes
+	}
+	if poolSize < 0 {
+		poolSize = 0
+	}
+	return &ScriptRuntime{
+		limits:   limits,
+		pool:     make(chan *scriptVM, poolSize),
+		programs: make(map[string]*goja.Program),
+	}
+}
+
+// Limits returns the limits of every run
+func (r *ScriptRuntime) Limits() ScriptLimits {
+	return r.limits
+}
+
+// 脚本作为函数体编译，可以使用下列参数。email 和 content 与旧版本相同，为 JSON 字符串，
+// parsedEmail 和 parsedContent 为解析后的值，mail 为结构化的邮件对象，text 为 content 以换行连接
+const scriptParams = "email, content, parsedEmail, parsedContent, mail, text"
+
+// 各调用方的包装函数，接收编译好的脚本函数和参数，把返回值转换为 JSON 字符串
+const matchScriptWrapper = `(function(script, ` + scriptParams + `) {
+	try {
+		const result = script(` + scriptParams + `);
+		if (typeof result === 'boolean') {
+			return JSON.stringify({matched: result});
+		} else if (typeof result === 'object' && result !== null && 'matched' in result) {
+			return JSON.stringify({matched: !!result.matched, reason: result.reason === undefined ? undefined : String(result.reason)});
+		}
+		return JSON.stringify({matched: false, reason: 'Invalid return value from match script'});
+	} catch (e) {
+		return JSON.stringify({matched: false, reason: String(e)});
+	}
+})`
+
+const extractScriptWrapper = `(function(script, ` + scriptParams + `) {
+	try {
+		const result = script(` + scriptParams + `);
+		if (result === null || result === undefined) {
+			return JSON.stringify([]);
+		} else if (typeof result === 'string') {
+			return JSON.stringify([result]);
+		} else if (Array.isArray(result)) {
+			return JSON.stringify(result
+				.filter(item => item !== null && item !== undefined && item !== '')
+				.map(item => typeof item === 'string' ? item : String(item)));
+		}
+		return JSON.stringify([String(result)]);
+	} catch (e) {
+		return JSON.stringify([]);
+	}
+})`
+
+const conditionScriptWrapper = `(function(script, ` + scriptParams + `) {
+	try {
+		return JSON.stringify(!!script(` + scriptParams + `));
+	} catch (e) {
+		return 'false';
+	}
+})`
+
+type scriptKind int
+
+const (
+	scriptMatch scriptKind = iota
+	scriptExtract
+	scriptCondition
+)
+
+var scriptWrapperPrograms = map[scriptKind]*goja.Program{
+	scriptMatch:     goja.MustCompile("match", matchScriptWrapper, false),
+	scriptExtract:   goja.MustCompile("extract", extractScriptWrapper, false),
+	scriptCondition: goja.MustCompile("condition", conditionScriptWrapper, false),
+}
+
+// Match runs a match script, which returns a boolean or {matched, reason}
+func (r *ScriptRuntime) Match(script string, input ScriptInput) (*MatchResult, error) {
+	output, err := r.run(scriptMatch, script, input)
+	if err != nil {
+		return nil, err
+	}
+	var result MatchResult
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse match result: %w", err)
+	}
+	return &result, nil
+}
+
+// Extract runs an extraction script, which returns a string, an array or null
+func (r *ScriptRuntime) Extract(script string, input ScriptInput) ([]string, error) {
+	output, err := r.run(scriptExtract, script, input)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	if err := json.Unmarshal([]byte(output), &matches); err != nil {
+		return nil, fmt.Errorf("failed to parse extraction result: %w", err)
+	}
+	return matches, nil
+}
+
+// Condition runs a trigger condition, whose return value is converted to a boolean
+func (r *ScriptRuntime) Condition(script string, input ScriptInput) (bool, error) {
+	output, err := r.run(scriptCondition, script, input)
+	if err != nil {
+		return false, err
+	}
+	return output == "true", nil
+}
+
+// run runs a script through the wrapper of its kind and returns the string
+// the wrapper produced. The limits apply from the moment the script's
+// function is created until the wrapper returns.
+func (r *ScriptRuntime) run(kind scriptKind, script string, input ScriptInput) (string, error) {
+	program, err := r.compile(script)
+	if err != nil {
+		return "", err
+	}
+
+	vm, err := r.acquire()
+	if err != nil {
+		return "", err
+	}
+	reusable := true
+	defer func() {
+		if reusable {
+			r.release(vm)
+		}
+	}()
+
+	args, err := vm.args(input)
+	if err != nil {
+		return "", err
+	}
+
+	done := make(chan struct{})
+	var watchers sync.WaitGroup
+	timer := time.AfterFunc(r.limits.WallTime, func() {
+		vm.runtime.Interrupt(ErrScriptTimeout)
+	})
+	watchers.Add(1)
+	go func() {
+		defer watchers.Done()
+		r.watchHeap(vm.runtime, done)
+	}()
+
+	result, err := vm.call(kind, program, args)
+
+	close(done)
+	watchers.Wait()
+	// 计时器可能在脚本结束后才触发，这时的虚拟机不再复用
+	if !timer.Stop() {
+		reusable = false
+	}
+	vm.runtime.ClearInterrupt()
+
+	if err != nil {
+		var interrupted *goja.InterruptedError
+		if errors.As(err, &interrupted) {
+			reusable = false
+			if cause, ok := interrupted.Value().(error); ok {
+				return "", cause
+			}
+			return "", ErrScriptTimeout
+		}
+		var overflow *goja.StackOverflowError
+		if errors.As(err, &overflow) {
+			reusable = false
+			return "", fmt.Errorf("script error: maximum call stack size exceeded")
+		}
+		return "", fmt.Errorf("script error: %w", err)
+	}
+
+	output := result.String()
+	if len(output) > r.limits.OutputBytes {
+		return "", ErrScriptOutputTooLarge
+	}
+	return output, nil
+}
+
+// watchHeap interrupts the VM when the process heap exceeds the ceiling
+// during a run. The heap is the process's, so allocations elsewhere only stop
+// the script once the process as a whole is above the ceiling.
+func (r *ScriptRuntime) watchHeap(vm *goja.Runtime, done <-chan struct{}) {
+	sample := []metrics.Sample{{Name: scriptHeapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return
+	}
+
+	ticker := time.NewTicker(scriptHeapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			metrics.Read(sample)
+			if sample[0].Value.Uint64() > r.limits.HeapCeilingBytes {
+				vm.Interrupt(ErrScriptHeap)
+				return
+			}
+		}
+	}
+}
+
+// compile compiles a script as the body of a function taking scriptParams,
+// caching the programs of recent scripts
+func (r *ScriptRuntime) compile(script string) (*goja.Program, error) {
+	r.mu.Lock()
+	program, ok := r.programs[script]
+	r.mu.Unlock()
+	if ok {
+		return program, nil
+	}
+
+	program, err := compileScriptFunction(script)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if len(r.programs) >= scriptProgramCacheMax {
+		r.programs = make(map[string]*goja.Program)
+	}
+	r.programs[script] = program
+	r.mu.Unlock()
+	return program, nil
+}
+
+// compileScriptFunction compiles a program whose only statement is the
+// function expression wrapping the script. A script that closes the function
+// early parses to something else and is rejected, so no code of the script
+// runs outside the function.
+func compileScriptFunction(script string) (*goja.Program, error) {
+	source := "(function(" + scriptParams + ") {\n" + script + "\n})"
+	parsed, err := goja.Parse("script", source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	if len(parsed.Body) != 1 {
+		return nil, fmt.Errorf("invalid script: the script must be a function body")
+	}
+	statement, ok := parsed.Body[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, fmt.Errorf("invalid script: the script must be a function body")
+	}
+	if _, ok := statement.Expression.(*ast.FunctionLiteral); !ok {
+		return nil, fmt.Errorf("invalid script: the script must be a function body")
+	}
+
+	program, err := goja.CompileAST(parsed, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	return program, nil
+}
+
+func (r *ScriptRuntime) acquire() (*scriptVM, error) {
+	select {
+	case vm := <-r.pool:
+		return vm, nil
+	default:
+		return newScriptVM()
+	}
+}
+
+func (r *ScriptRuntime) release(vm *scriptVM) {
+	if err := vm.reset(); err != nil {
+		return
+	}
+	select {
+	case r.pool <- vm:
+	default:
+	}
+}
+
+// scriptVM is a goja runtime with a frozen global environment
+type scriptVM struct {
+	runtime  *goja.Runtime
+	globals  map[string]bool // 冻结时已存在的全局变量
+	prepare  goja.Callable   // 解析 JSON 并深度冻结，不暴露给脚本
+	wrappers map[scriptKind]goja.Callable
+}
+
+// scriptEnvironment freezes the built-ins reachable from the global object,
+// so that a script cannot change the prototypes the next script sees
+const scriptEnvironment = `(function(global) {
+	const freeze = function(value) {
+		if (value === null || (typeof value !== 'object' && typeof value !== 'function') || Object.isFrozen(value)) {
+			return;
+		}
+		Object.freeze(value);
+		Object.getOwnPropertyNames(value).forEach(function(name) {
+			const descriptor = Object.getOwnPropertyDescriptor(value, name);
+			if (descriptor && 'value' in descriptor) {
+				freeze(descriptor.value);
+			}
+		});
+		freeze(Object.getPrototypeOf(value));
+	};
+	Object.getOwnPropertyNames(global).forEach(function(name) {
+		if (name === 'globalThis') {
+			return;
+		}
+		freeze(global[name]);
+		Object.defineProperty(global, name, {writable: false, configurable: false});
+	});
+	[function*() {}, async function() {}, [][Symbol.iterator](), new Map().entries(), ''[Symbol.iterator]()].forEach(freeze);
+	const deepFreeze = function(value) {
+		if (value !== null && typeof value === 'object') {
+			Object.values(value).forEach(deepFreeze);
+			Object.freeze(value);
+		}
+		return value;
+	};
+	return function(data) {
+		return deepFreeze(JSON.parse(data));
+	};
+})(this)`
+
+var scriptEnvironmentProgram = goja.MustCompile("environment", scriptEnvironment, false)
+
+func newScriptVM() (*scriptVM, error) {
+	runtime := goja.New()
+	runtime.SetMaxCallStackSize(scriptMaxCallStack)
+
+	value, err := runtime.RunProgram(scriptEnvironmentProgram)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare script environment: %w", err)
+	}
+	prepare, ok := goja.AssertFunction(value)
+	if !ok {
+		return nil, fmt.Errorf("failed to prepare script environment")
+	}
+
+	wrappers := make(map[scriptKind]goja.Callable, len(scriptWrapperPrograms))
+	for kind, program := range scriptWrapperPrograms {
+		value, err := runtime.RunProgram(program)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare script wrapper: %w", err)
+		}
+		wrapper, ok := goja.AssertFunction(value)
+		if !ok {
+			return nil, fmt.Errorf("failed to prepare script wrapper")
+		}
+		wrappers[kind] = wrapper
+	}
+
+	globals := make(map[string]bool)
+	for _, name := range runtime.GlobalObject().GetOwnPropertyNames() {
+		globals[name] = true
+	}
+	return &scriptVM{runtime: runtime, globals: globals, prepare: prepare, wrappers: wrappers}, nil
+}
+
+// call creates the script's function and passes it to the wrapper of its kind
+func (vm *scriptVM) call(kind scriptKind, program *goja.Program, args []goja.Value) (goja.Value, error) {
+	fn, err := vm.runtime.RunProgram(program)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	return vm.wrappers[kind](goja.Undefined(), append([]goja.Value{fn}, args...)...)
+}
+
+// reset removes the globals a script created by assigning undeclared variables
+func (vm *scriptVM) reset() error {
+	global := vm.runtime.GlobalObject()
+	for _, name := range global.GetOwnPropertyNames() {
+		if !vm.globals[name] {
+			if err := global.Delete(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// args builds the arguments of a run in the order of scriptParams. The
+// parsed values are frozen; email and content are the JSON strings scripts
+// received before the sandbox and still parse themselves.
+func (vm *scriptVM) args(input ScriptInput) ([]goja.Value, error) {
+	content := input.Content
+	if content == nil {
+		content = []string{}
+	}
+	emailJSON, err := json.Marshal(input.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal email: %w", err)
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal content: %w", err)
+	}
+
+	parsedEmail, err := vm.parse(string(emailJSON))
+	if err != nil {
+		return nil, err
+	}
+	parsedContent, err := vm.parse(string(contentJSON))
+	if err != nil {
+		return nil, err
+	}
+	mail, err := vm.value(scriptEmail(input.Email))
+	if err != nil {
+		return nil, err
+	}
+	return []goja.Value{
+		vm.runtime.ToValue(string(emailJSON)),
+		vm.runtime.ToValue(string(contentJSON)),
+		parsedEmail,
+		parsedContent,
+		mail,
+		vm.runtime.ToValue(strings.Join(content, "\n")),
+	}, nil
+}
+
+func (vm *scriptVM) parse(data string) (goja.Value, error) {
+	return vm.prepare(goja.Undefined(), vm.runtime.ToValue(data))
+}
+
+func (vm *scriptVM) value(data interface{}) (goja.Value, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal script input: %w", err)
+	}
+	return vm.parse(string(encoded))
+}
+
+// scriptAddress is a parsed address of the email object
+type scriptAddress struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// scriptAttachment is the metadata of an attachment of the email object
+type scriptAttachment struct {
+	ID       uint   `json:"id"`
+	Filename string `json:"filename"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// scriptEmailObject is the structured email object scripts see as mail
+type scriptEmailObject struct {
+	ID          uint               `json:"id"`
+	MessageID   string             `json:"message_id"`
+	AccountID   uint               `json:"account_id"`
+	Mailbox     string             `json:"mailbox"`
+	Subject     string             `json:"subject"`
+	Date        *time.Time         `json:"date"`
+	From        []scriptAddress    `json:"from"`
+	To          []scriptAddress    `json:"to"`
+	Cc          []scriptAddress    `json:"cc"`
+	Bcc         []scriptAddress    `json:"bcc"`
+	ReplyTo     []scriptAddress    `json:"reply_to"`
+	Body        string             `json:"body"`
+	HTMLBody    string             `json:"html_body"`
+	Headers     map[string]string  `json:"headers"`
+	Attachments []scriptAttachment `json:"attachments"`
+	Flags       []string           `json:"flags"`
+	Size        int64              `json:"size"`
+}
+
+func scriptEmail(email models.Email) scriptEmailObject {
+	object := scriptEmailObject{
+		ID:          email.ID,
+		MessageID:   email.MessageID,
+		AccountID:   email.AccountID,
+		Mailbox:     email.MailboxName,
+		Subject:     email.Subject,
+		From:        scriptAddresses(email.From),
+		To:          scriptAddresses(email.To),
+		Cc:          scriptAddresses(email.Cc),
+		Bcc:         scriptAddresses(email.Bcc),
+		ReplyTo:     scriptAddresses(email.ReplyTo),
+		Body:        email.Body,
+		HTMLBody:    email.HTMLBody,
+		Headers:     scriptHeaders(email.RawMessage),
+		Attachments: make([]scriptAttachment, 0, len(email.Attachments)),
+		Flags:       email.Flags,
+		Size:        email.Size,
+	}
+	if !email.Date.IsZero() {
+		object.Date = &email.Date
+	}
+	if object.Flags == nil {
+		object.Flags = []string{}
+	}
+	for _, attachment := range email.Attachments {
+		object.Attachments = append(object.Attachments, scriptAttachment{
+			ID:       attachment.ID,
+			Filename: attachment.Filename,
+			MIMEType: attachment.MIMEType,
+			Size:     attachment.Size,
+		})
+	}
+	return object
+}
+
+func scriptAddresses(values []string) []scriptAddress {
+	addresses := make([]scriptAddress, 0, len(values))
+	for _, value := range values {
+		if parsed, err := mail.ParseAddress(value); err == nil {
+			addresses = append(addresses, scriptAddress{Name: parsed.Name, Address: parsed.Address})
+		} else {
+			addresses = append(addresses, scriptAddress{Address: strings.TrimSpace(value)})
+		}
+	}
+	return addresses
+}
+
+// scriptHeaders parses the header of the raw message. Names are lower case,
+// RFC 2047 words are decoded and repeated headers are joined with ", ".
+func scriptHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	if raw == "" {
+		return headers
+	}
+	block := raw
+	if end := strings.Index(raw, "\r\n\r\n"); end >= 0 {
+		block = raw[:end+2]
+	} else if end := strings.Index(raw, "\n\n"); end >= 0 {
+		block = raw[:end+1]
+	}
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(block))).ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return headers
+	}
+
+	decoder := new(mime.WordDecoder)
+	for name, values := range header {
+		decoded := make([]string, 0, len(values))
+		for _, value := range values {
+			if text, err := decoder.DecodeHeader(value); err == nil {
+				value = text
+			}
+			decoded = append(decoded, value)
+		}
+		headers[strings.ToLower(name)] = strings.Join(decoded, ", ")
+	}
+	return headers
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"time"
+
+	"mailman/internal/models"
+)
+
+func newTestScriptRuntime() *ScriptRuntime {
+	return NewScriptRuntime(ScriptLimits{WallTime: 200 * time.Millisecond}, 2)
+}
+
+func testScriptInput() ScriptInput {
+	return ScriptInput{
+		Email: models.Email{
+			Subject: "Your code is 123456",
+			From:    models.StringSlice{"Alice <alice@example.com>"},
+			Body:    "Use 123456 to sign in",
+		},
+		Content: []string{"Your code is 123456", "Use 123456 to sign in"},
+	}
+}
+
+func TestScriptRuntimeTimeout(t *testing.T) {
+	runtime := newTestScriptRuntime()
+
+	start := time.Now()
+	_, err := runtime.Condition("while (true) {}", testScriptInput())
+	if !errors.Is(err, ErrScriptTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("script ran for %v after its limit", elapsed)
+	}
+
+	// 中断后的虚拟机不再复用，下一次运行正常
+	matched, err := runtime.Condition("return true", testScriptInput())
+	if err != nil || !matched {
+		t.Fatalf("expected the next run to succeed, got %v, %v", matched, err)
+	}
+}
+
+func TestScriptRuntimeRejectsWrapperEscape(t *testing.T) {
+	runtime := newTestScriptRuntime()
+	escapes := []string{
+		"return true; })()); } catch (e) { return 'false'; } }), (function(){ for(;;){} })(), (function() { try { return JSON.stringify(!!(function() {",
+		"}); for(;;){}; (function() {",
+		"})(); for(;;){} (function() {",
+		"}, function() { for(;;){}",
+	}
+
+	for _, script := range escapes {
+		done := make(chan error, 1)
+		go func() {
+			_, err := runtime.Condition(script, testScriptInput())
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil || !strings.Contains(err.Error(), "invalid script") {
+				t.Errorf("expected %q to be rejected, got %v", script, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("script %q escaped the time limit", script)
+		}
+	}
+}
+
+func TestScriptRuntimeLegacyScripts(t *testing.T) {
+	runtime := newTestScriptRuntime()
+	input := testScriptInput()
+
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"content string", "return JSON.parse(content)[0].match(/\\d{6}/)[0]", []string{"123456"}},
+		{"email string", "return JSON.parse(email).Subject", []string{"Your code is 123456"}},
+		{"parsed email", "const e = parsedEmail; return e.Subject", []string{"Your code is 123456"}},
+		{"parsed email by position", "return arguments[2].Body", []string{"Use 123456 to sign in"}},
+		{"parsed content", "return parsedContent.length", []string{"2"}},
+		{"mail object", "return mail.from[0].address", []string{"alice@example.com"}},
+		{"text", "return text.split('\\n')[1]", []string{"Use 123456 to sign in"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runtime.Extract(tt.script, input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	matched, err := runtime.Condition("return JSON.parse(email).Subject.indexOf('code') >= 0", input)
+	if err != nil || !matched {
+		t.Fatalf("legacy condition: got %v, %v", matched, err)
+	}
+	result, err := runtime.Match("var data = JSON.parse(content); return {matched: data.length === 2, reason: 'count'}", input)
+	if err != nil || !result.Matched {
+		t.Fatalf("legacy match: got %+v, %v", result, err)
+	}
+}
+
+func TestScriptRuntimeIsolation(t *testing.T) {
+	runtime := NewScriptRuntime(ScriptLimits{WallTime: 200 * time.Millisecond}, 1)
+
+	if _, err := runtime.Condition("leaked = 1; try { Array.prototype.push = null } catch (e) {} return true", testScriptInput()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := runtime.Extract("const a = []; a.push('ok'); return [typeof leaked, a[0]]", testScriptInput())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got, "|") != "undefined|ok" {
+		t.Fatalf("script saw state of the previous run: %v", got)
+	}
+}
+
+// processHeap reads the heap metric the runtime watches
+func processHeap(t *testing.T) uint64 {
+	t.Helper()
+	sample := []metrics.Sample{{Name: scriptHeapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		t.Skip("heap metric is not available")
+	}
+	return sample[0].Value.Uint64()
+}
+
+func TestScriptRuntimeIgnoresAllocationsElsewhere(t *testing.T) {
+	runtime := NewScriptRuntime(ScriptLimits{WallTime: 5 * time.Second, HeapCeilingBytes: processHeap(t) + 512<<20}, 1)
+
+	// 脚本运行期间另一个 goroutine 分配并持有 128MB，远超过脚本自身的用量
+	allocated := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		held := make([][]byte, 0, 4)
+		for i := 0; i < 4; i++ {
+			chunk := make([]byte, 32<<20)
+			for j := range chunk {
+				chunk[j] = byte(j)
+			}
+			held = append(held, chunk)
+		}
+		close(allocated)
+		<-release
+		_ = held
+	}()
+	defer close(release)
+
+	matched, err := runtime.Condition("const end = Date.now() + 300; let n = 0; while (Date.now() < end) { n++ } return n > 0", testScriptInput())
+	<-allocated
+	if err != nil || !matched {
+		t.Fatalf("expected the script to finish, got %v, %v", matched, err)
+	}
+}
+
+func TestScriptRuntimeHeapCeiling(t *testing.T) {
+	// 上限低于进程当前的堆，运行中的脚本被中断
+	runtime := NewScriptRuntime(ScriptLimits{WallTime: 5 * time.Second, HeapCeilingBytes: 1}, 1)
+	processHeap(t)
+
+	if _, err := runtime.Condition("while (true) {}", testScriptInput()); !errors.Is(err, ErrScriptHeap) {
+		t.Fatalf("expected the heap ceiling to stop the script, got %v", err)
+	}
+}
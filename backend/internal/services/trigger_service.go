@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"mailman/internal/models"
@@ -12,11 +13,9 @@ import (
 	"sync"
 	"text/template"
 	"time"
-
-	"github.com/robertkrimen/otto"
 )
 
-// TriggerWorker 触发器工作器
+// TriggerWorker 触发器工作器，按邮件 ID 顺序评估新入库的邮件
 type TriggerWorker struct {
 	ID            uint
 	TriggerID     uint
@@ -24,16 +23,49 @@ type TriggerWorker struct {
 	Context       context.Context
 	CancelFunc    context.CancelFunc
 	LastCheckTime time.Time
+	LastEmailID   uint // 进度：此前的邮件都已评估完，且不会再有更小的 ID 入库
 	IsRunning     bool
 	mu            sync.RWMutex
+
+	// 进度之后已评估完的邮件，只由 worker 自己的 goroutine 读写，进度越过时移除
+	evaluated map[uint]bool
+
+	wakeCh chan struct{}
+	doneCh chan struct{}
+}
+
+// triggerBatchSize 每次从数据库读取的待评估邮件数
+const triggerBatchSize = 100
+
+// TriggerResume 启用已停用的触发器时如何处理停用期间入库的邮件
+type TriggerResume string
+
+const (
+	TriggerResumeSkip     TriggerResume = "skip"     // 从当时最新的邮件之后开始，停用期间入库的邮件不再评估
+	TriggerResumeBackfill TriggerResume = "backfill" // 从停用时的进度继续，评估停用期间入库的邮件
+)
+
+// ParseTriggerResume 解析启用方式，未指定时为 skip
+func ParseTriggerResume(value string) (TriggerResume, error) {
+	switch resume := TriggerResume(strings.ToLower(strings.TrimSpace(value))); resume {
+	case "":
+		return TriggerResumeSkip, nil
+	case TriggerResumeSkip, TriggerResumeBackfill:
+		return resume, nil
+	default:
+		return "", fmt.Errorf("invalid resume mode %q, expected skip or backfill", value)
+	}
 }
 
 // TriggerService 触发器服务
 type TriggerService struct {
 	triggerRepo         *repository.TriggerRepository
 	logRepo             *repository.TriggerExecutionLogRepository
+	ledgerRepo          *repository.TriggerLedgerRepository
 	emailRepo           *repository.EmailRepository
+	tagRepo             *repository.TagRepository
 	extractorService    *ExtractorService
+	valueService        *ExtractedValueService
 	subscriptionManager *SubscriptionManager
 
 	// Worker管理
@@ -47,14 +79,20 @@ type TriggerService struct {
 func NewTriggerService(
 	triggerRepo *repository.TriggerRepository,
 	logRepo *repository.TriggerExecutionLogRepository,
+	ledgerRepo *repository.TriggerLedgerRepository,
 	emailRepo *repository.EmailRepository,
+	tagRepo *repository.TagRepository,
+	valueService *ExtractedValueService,
 	subscriptionManager *SubscriptionManager,
 ) *TriggerService {
 	return &TriggerService{
 		triggerRepo:         triggerRepo,
 		logRepo:             logRepo,
+		ledgerRepo:          ledgerRepo,
 		emailRepo:           emailRepo,
+		tagRepo:             tagRepo,
 		extractorService:    NewExtractorService(),
+		valueService:        valueService,
 		subscriptionManager: subscriptionManager,
 		workers:             make(map[uint]*TriggerWorker),
 		shutdownCh:          make(chan struct{}),
@@ -101,6 +139,19 @@ func (s *TriggerService) Stop() {
 	log.Printf("[TriggerService] Trigger service stopped")
 }
 
+// Wake 通知所有触发器有新邮件入库，由 repository.OnEmailsStored 在每条入库路径
+// （增量同步、定时拉取、手动拉取）之后调用。检查间隔只作为兜底轮询。
+func (s *TriggerService) Wake() {
+	s.workersMu.RLock()
+	defer s.workersMu.RUnlock()
+	for _, worker := range s.workers {
+		select {
+		case worker.wakeCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // CreateTrigger 创建触发器
 func (s *TriggerService) CreateTrigger(trigger *models.EmailTrigger) error {
 	if err := s.triggerRepo.Create(trigger); err != nil {
@@ -117,8 +168,8 @@ func (s *TriggerService) CreateTrigger(trigger *models.EmailTrigger) error {
 	return nil
 }
 
-// UpdateTrigger 更新触发器
-func (s *TriggerService) UpdateTrigger(trigger *models.EmailTrigger) error {
+// UpdateTrigger 更新触发器，触发器由停用变为启用时按 resume 处理停用期间入库的邮件
+func (s *TriggerService) UpdateTrigger(trigger *models.EmailTrigger, resume TriggerResume) error {
 	// 获取旧的触发器信息
 	oldTrigger, err := s.triggerRepo.GetByID(trigger.ID)
 	if err != nil {
@@ -136,6 +187,11 @@ func (s *TriggerService) UpdateTrigger(trigger *models.EmailTrigger) error {
 	s.workersMu.Unlock()
 
 	if trigger.Status == models.TriggerStatusEnabled {
+		if !exists && oldTrigger.Status != models.TriggerStatusEnabled {
+			if err := s.resumeCursor(trigger.ID, resume); err != nil {
+				return err
+			}
+		}
 		if exists {
 			// 如果worker已存在，检查是否需要重启（检查间隔变化）
 			if oldTrigger.CheckInterval != trigger.CheckInterval {
@@ -175,8 +231,31 @@ func (s *TriggerService) DeleteTrigger(id uint) error {
 	return s.triggerRepo.Delete(id)
 }
 
-// EnableTrigger 启用触发器
-func (s *TriggerService) EnableTrigger(id uint) error {
+// ReloadTrigger 重新读取触发器并按其状态重启或停止 worker，
+// 用于不经过 UpdateTrigger 写入的变更，例如导入配置包。新启用的触发器按 resume 处理停用期间入库的邮件
+func (s *TriggerService) ReloadTrigger(id uint, resume TriggerResume) error {
+	trigger, err := s.triggerRepo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	s.workersMu.RLock()
+	_, running := s.workers[id]
+	s.workersMu.RUnlock()
+
+	s.stopWorker(id)
+	if trigger.Status == models.TriggerStatusEnabled {
+		if !running {
+			if err := s.resumeCursor(id, resume); err != nil {
+				return err
+			}
+		}
+		return s.startWorker(trigger)
+	}
+	return nil
+}
+
+// EnableTrigger 启用触发器，已停用的触发器按 resume 处理停用期间入库的邮件
+func (s *TriggerService) EnableTrigger(id uint, resume TriggerResume) error {
 	trigger, err := s.triggerRepo.GetByID(id)
 	if err != nil {
 		return err
@@ -185,11 +264,28 @@ func (s *TriggerService) EnableTrigger(id uint) error {
 	if err := s.triggerRepo.UpdateStatus(id, models.TriggerStatusEnabled); err != nil {
 		return err
 	}
+	if trigger.Status != models.TriggerStatusEnabled {
+		if err := s.resumeCursor(id, resume); err != nil {
+			return err
+		}
+	}
 
 	trigger.Status = models.TriggerStatusEnabled
 	return s.startWorker(trigger)
 }
 
+// resumeCursor 设置重新启用的触发器的进度：skip 移到最新的邮件，backfill 保留停用时的进度
+func (s *TriggerService) resumeCursor(id uint, resume TriggerResume) error {
+	if resume == TriggerResumeBackfill {
+		return nil
+	}
+	latestEmailID, err := s.triggerRepo.LatestEmailID()
+	if err != nil {
+		return err
+	}
+	return s.triggerRepo.UpdateCursor(id, latestEmailID)
+}
+
 // DisableTrigger 禁用触发器
 func (s *TriggerService) DisableTrigger(id uint) error {
 	if err := s.triggerRepo.UpdateStatus(id, models.TriggerStatusDisabled); err != nil {
@@ -210,6 +306,12 @@ func (s *TriggerService) startWorker(trigger *models.EmailTrigger) error {
 		return fmt.Errorf("worker for trigger %d already exists", trigger.ID)
 	}
 
+	// 进度以数据库为准，传入的触发器可能来自请求体
+	lastEmailID, err := s.triggerRepo.GetCursor(trigger.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load cursor of trigger %d: %w", trigger.ID, err)
+	}
+
 	// 创建worker上下文
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -220,7 +322,11 @@ func (s *TriggerService) startWorker(trigger *models.EmailTrigger) error {
 		Context:       ctx,
 		CancelFunc:    cancel,
 		LastCheckTime: time.Now(),
+		LastEmailID:   lastEmailID,
 		IsRunning:     false,
+		evaluated:     make(map[uint]bool),
+		wakeCh:        make(chan struct{}, 1),
+		doneCh:        make(chan struct{}),
 	}
 
 	s.workers[trigger.ID] = worker
@@ -229,13 +335,14 @@ func (s *TriggerService) startWorker(trigger *models.EmailTrigger) error {
 	s.wg.Add(1)
 	go s.runWorker(worker)
 
-	log.Printf("[TriggerService] Started worker for trigger %d (%s) with interval %ds",
-		trigger.ID, trigger.Name, trigger.CheckInterval)
+	log.Printf("[TriggerService] Started worker for trigger %d (%s) after email %d, polling every %ds",
+		trigger.ID, trigger.Name, lastEmailID, trigger.CheckInterval)
 
 	return nil
 }
 
-// stopWorker 停止触发器worker
+// stopWorker 停止触发器worker，等待正在处理的邮件完成，
+// 以免新启动的worker从同一进度重复处理
 func (s *TriggerService) stopWorker(triggerID uint) {
 	s.workersMu.Lock()
 	worker, exists := s.workers[triggerID]
@@ -246,17 +353,23 @@ func (s *TriggerService) stopWorker(triggerID uint) {
 
 	if exists {
 		worker.CancelFunc()
+		<-worker.doneCh
 		log.Printf("[TriggerService] Stopped worker for trigger %d", triggerID)
 	}
 }
 
-// runWorker 运行触发器worker
+// runWorker 运行触发器worker：启动时先补上停机期间入库的邮件，
+// 之后在新邮件入库通知或兜底轮询时处理进度之后的邮件
 func (s *TriggerService) runWorker(worker *TriggerWorker) {
 	defer s.wg.Done()
+	defer close(worker.doneCh)
 
 	worker.mu.Lock()
 	interval := time.Duration(worker.Trigger.CheckInterval) * time.Second
 	worker.mu.Unlock()
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -265,6 +378,21 @@ func (s *TriggerService) runWorker(worker *TriggerWorker) {
 		worker.ID, worker.TriggerID, interval)
 
 	for {
+		worker.mu.Lock()
+		worker.IsRunning = true
+		trigger := worker.Trigger
+		worker.mu.Unlock()
+
+		// 执行触发器检查
+		if err := s.executeTrigger(worker, trigger); err != nil {
+			log.Printf("[TriggerService] Error executing trigger %d: %v", trigger.ID, err)
+		}
+
+		worker.mu.Lock()
+		worker.LastCheckTime = time.Now()
+		worker.IsRunning = false
+		worker.mu.Unlock()
+
 		select {
 		case <-worker.Context.Done():
 			log.Printf("[TriggerService] Worker %d for trigger %d stopped", worker.ID, worker.TriggerID)
@@ -275,67 +403,184 @@ func (s *TriggerService) runWorker(worker *TriggerWorker) {
 			return
 
 		case <-ticker.C:
-			worker.mu.Lock()
-			worker.IsRunning = true
-			trigger := worker.Trigger
-			lastCheckTime := worker.LastCheckTime
-			worker.mu.Unlock()
-
-			// 执行触发器检查
-			if err := s.executeTrigger(trigger, lastCheckTime); err != nil {
-				log.Printf("[TriggerService] Error executing trigger %d: %v", trigger.ID, err)
-			}
-
-			worker.mu.Lock()
-			worker.LastCheckTime = time.Now()
-			worker.IsRunning = false
-			worker.mu.Unlock()
+		case <-worker.wakeCh:
 		}
 	}
 }
 
-// executeTrigger 执行触发器
-func (s *TriggerService) executeTrigger(trigger *models.EmailTrigger, lastCheckTime time.Time) error {
+// executeTrigger 按 ID 顺序评估进度之后入库的所有邮件，不受 Date 头和每轮数量限制的影响。
+// 并发入库时较小的 ID 可能晚于较大的 ID 出现，因此进度只推进到入库超过
+// repository.EmailVisibilityLag 的邮件；之后的邮件每轮重新列出，已评估的在内存中跳过，
+// 重启后由处理台账去重。没有在台账中处理完的邮件会挡住进度，下一轮重试。
+func (s *TriggerService) executeTrigger(worker *TriggerWorker, trigger *models.EmailTrigger) error {
 	startTime := time.Now()
 
-	// 构建邮件搜索选项
-	searchOptions := repository.EmailSearchOptions{
-		StartDate:    &lastCheckTime,
-		EndDate:      &startTime,
-		FromQuery:    trigger.From,
-		ToQuery:      trigger.To,
-		SubjectQuery: trigger.Subject,
-		MailboxName:  "",
-		Limit:        100, // 限制每次检查的邮件数量
-		Offset:       0,
-		SortBy:       "date DESC",
+	// 本轮只处理到开始时最新的邮件，之后入库的留给下一轮
+	latestEmailID, err := s.triggerRepo.LatestEmailID()
+	if err != nil {
+		return fmt.Errorf("failed to read latest email: %w", err)
+	}
+	settledEmailID, err := s.triggerRepo.SettledEmailID(startTime)
+	if err != nil {
+		return fmt.Errorf("failed to read settled email: %w", err)
+	}
+	if settledEmailID > latestEmailID {
+		settledEmailID = latestEmailID
 	}
 
-	// 如果指定了邮箱地址，需要找到对应的账户
-	if trigger.EmailAddress != "" {
-		searchOptions.ToQuery = trigger.EmailAddress
+	worker.mu.RLock()
+	cursor := worker.LastEmailID
+	worker.mu.RUnlock()
+	if cursor >= latestEmailID {
+		return nil
 	}
 
-	// 搜索符合条件的邮件
-	emails, _, err := s.emailRepo.SearchEmails(searchOptions)
+	filter, err := triggerFilter(trigger)
+	if err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+	accountIDs, err := s.triggerRepo.ScopeAccountIDs(trigger)
 	if err != nil {
-		return fmt.Errorf("failed to search emails: %w", err)
+		return fmt.Errorf("failed to resolve account scope: %w", err)
+	}
+	if accountIDs != nil && len(accountIDs) == 0 {
+		// 范围内没有账户（例如还没有账户带有这些标签），这些邮件都不属于触发器
+		return s.advanceCursor(worker, settledEmailID)
 	}
 
-	log.Printf("[TriggerService] Trigger %d found %d emails to process", trigger.ID, len(emails))
+	// next 是进度可以推进到的位置：之前的邮件都已评估完，且不会再出现更小的 ID
+	next := cursor
+	blocked := false
+	processed := 0
+	after := cursor
+	for {
+		// 读取进度之后账户范围内的邮件，其余过滤条件与订阅使用同一匹配规则
+		emails, err := s.emailRepo.ListAfterID(after, latestEmailID, accountIDs, triggerBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list emails: %w", err)
+		}
 
-	// 处理每封邮件
-	for _, email := range emails {
-		if err := s.processEmailWithTrigger(trigger, email, startTime); err != nil {
-			log.Printf("[TriggerService] Error processing email %d with trigger %d: %v", email.ID, trigger.ID, err)
+		for _, email := range emails {
+			if worker.Context.Err() != nil {
+				// 停止时记录已评估到的邮件，其余的邮件下次继续
+				return s.advanceCursor(worker, next)
+			}
+			if !worker.evaluated[email.ID] {
+				if filter.Matches(email, startTime) {
+					if err := s.processEmailWithTrigger(trigger, email, startTime); err != nil {
+						log.Printf("[TriggerService] Email %d of trigger %d will be retried: %v", email.ID, trigger.ID, err)
+						blocked = true
+						continue
+					}
+					processed++
+				}
+				worker.evaluated[email.ID] = true
+			}
+			if !blocked && email.ID <= settledEmailID {
+				next = email.ID
+			}
+		}
+		if len(emails) == 0 {
+			break
+		}
+
+		// 每页只写一次进度；进程在页中途中断时整页重新评估，处理台账保证已处理的邮件不会重复执行动作
+		after = emails[len(emails)-1].ID
+		if err := s.advanceCursor(worker, next); err != nil {
+			return err
+		}
+		if len(emails) < triggerBatchSize {
+			break
 		}
 	}
 
+	// 账户范围外的邮件也算已评估
+	if !blocked {
+		if err := s.advanceCursor(worker, settledEmailID); err != nil {
+			return err
+		}
+	}
+	if processed > 0 {
+		log.Printf("[TriggerService] Trigger %d processed %d emails up to email %d", trigger.ID, processed, latestEmailID)
+	}
+	return nil
+}
+
+// triggerFilter 把触发器的过滤参数转换为邮件过滤器，触发器与订阅按相同规则匹配邮件
+func triggerFilter(trigger *models.EmailTrigger) (*EmailFilter, error) {
+	filter := &EmailFilter{
+		EmailAddress:  trigger.EmailAddress,
+		StartDate:     trigger.StartDate,
+		EndDate:       trigger.EndDate,
+		Subject:       trigger.Subject,
+		From:          trigger.From,
+		To:            trigger.To,
+		HasAttachment: trigger.HasAttachment,
+		Unread:        trigger.Unread,
+		Labels:        trigger.Labels,
+		Folders:       trigger.Folders,
+		CustomFilters: trigger.CustomFilters,
+		Query:         trigger.Query,
+	}
+	if err := filter.Compile(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// advanceCursor 记录触发器已评估到的邮件，进度不后退
+func (s *TriggerService) advanceCursor(worker *TriggerWorker, emailID uint) error {
+	worker.mu.RLock()
+	cursor := worker.LastEmailID
+	worker.mu.RUnlock()
+	if emailID <= cursor {
+		return nil
+	}
+
+	if err := s.triggerRepo.UpdateCursor(worker.TriggerID, emailID); err != nil {
+		return fmt.Errorf("failed to save cursor of trigger %d: %w", worker.TriggerID, err)
+	}
+	worker.mu.Lock()
+	worker.LastEmailID = emailID
+	worker.mu.Unlock()
+	for id := range worker.evaluated {
+		if id <= emailID {
+			delete(worker.evaluated, id)
+		}
+	}
 	return nil
 }
 
-// processEmailWithTrigger 使用触发器处理邮件
+// processEmailWithTrigger 使用触发器处理邮件。处理台账中当前修订已处理完的邮件直接跳过，
+// 上次中断的邮件只执行尚未成功的动作。条件或动作失败记在台账中；只有邮件没有在台账中
+// 处理完（正由其他一方处理，或读写台账失败）时返回错误，调用方稍后重试
 func (s *TriggerService) processEmailWithTrigger(trigger *models.EmailTrigger, email models.Email, startTime time.Time) error {
+	entry, claimed, err := s.ledgerRepo.Begin(trigger.ID, email.ID, trigger.Revision)
+	if err != nil {
+		return fmt.Errorf("failed to read trigger ledger: %w", err)
+	}
+	if !claimed {
+		if entry.State != models.TriggerLedgerStateDone {
+			return repository.ErrTriggerLedgerBusy
+		}
+		return nil
+	}
+	if err := s.processLedgerEntry(trigger, entry, email, startTime); err != nil {
+		log.Printf("[TriggerService] Error processing email %d with trigger %d: %v", email.ID, trigger.ID, err)
+	}
+	if entry.State != models.TriggerLedgerStateDone {
+		return fmt.Errorf("email %d is not recorded as processed in the ledger", email.ID)
+	}
+	return nil
+}
+
+// processLedgerEntry 执行已认领的台账记录
+func (s *TriggerService) processLedgerEntry(trigger *models.EmailTrigger, entry *models.TriggerLedgerEntry, email models.Email, startTime time.Time) error {
+	completed := make(map[int]bool, len(entry.CompletedActions))
+	for _, index := range entry.CompletedActions {
+		completed[index] = true
+	}
+
 	executionStartTime := time.Now()
 
 	// 创建执行日志
@@ -353,6 +598,10 @@ func (s *TriggerService) processEmailWithTrigger(trigger *models.EmailTrigger, e
 	executionLog.InputParams["email_id"] = fmt.Sprintf("%d", email.ID)
 	executionLog.InputParams["trigger_id"] = fmt.Sprintf("%d", trigger.ID)
 	executionLog.InputParams["check_time"] = startTime.Format(time.RFC3339)
+	executionLog.InputParams["revision"] = fmt.Sprintf("%d", trigger.Revision)
+	if entry.Attempts > 1 {
+		executionLog.InputParams["attempt"] = fmt.Sprintf("%d", entry.Attempts)
+	}
 
 	defer func() {
 		executionLog.EndTime = time.Now()
@@ -367,6 +616,10 @@ func (s *TriggerService) processEmailWithTrigger(trigger *models.EmailTrigger, e
 
 		// 更新触发器统计信息
 		s.updateTriggerStatistics(trigger, executionLog.Status == models.TriggerExecutionStatusSuccess, executionLog.ErrorMessage)
+
+		if err := s.ledgerRepo.Finish(entry, executionLog.Status, executionLog.ConditionResult, executionLog.ErrorMessage); err != nil {
+			log.Printf("[TriggerService] Failed to record email %d in the ledger of trigger %d: %v", email.ID, trigger.ID, err)
+		}
 	}()
 
 	// 1. 评估触发条件
@@ -390,16 +643,31 @@ func (s *TriggerService) processEmailWithTrigger(trigger *models.EmailTrigger, e
 	allActionsSucceeded := true
 	var actionResults []models.TriggerActionResult
 
-	// 按顺序执行动作
-	actions := trigger.Actions
-	sort.Slice(actions, func(i, j int) bool {
+	// 按顺序执行动作，台账按排序后的下标记录已成功的动作
+	actions := append(models.TriggerActions(nil), trigger.Actions...)
+	sort.SliceStable(actions, func(i, j int) bool {
 		return actions[i].Order < actions[j].Order
 	})
 
-	for _, action := range actions {
+	for index, action := range actions {
 		if !action.Enabled {
 			continue
 		}
+		if completed[index] {
+			// 内容修改没有副作用，重新应用后后续动作才能看到修改后的邮件
+			if action.Type == models.TriggerActionTypeModifyContent {
+				if outputEmail, err := s.executeAction(action, modifiedEmail); err == nil {
+					modifiedEmail = *outputEmail
+				}
+			}
+			actionResults = append(actionResults, models.TriggerActionResult{
+				ActionName: action.Name,
+				ActionType: string(action.Type),
+				Success:    true,
+				OutputData: map[string]interface{}{"skipped": "completed in an earlier attempt"},
+			})
+			continue
+		}
 
 		actionStartTime := time.Now()
 		result := models.TriggerActionResult{
@@ -426,6 +694,16 @@ func (s *TriggerService) processEmailWithTrigger(trigger *models.EmailTrigger, e
 					outputEmail.HTMLBody != modifiedEmail.HTMLBody,
 			}
 			modifiedEmail = *outputEmail
+			if err := s.ledgerRepo.CompleteAction(entry, index); err != nil {
+				log.Printf("[TriggerService] Failed to record action %s for email %d: %v", action.Name, email.ID, err)
+				if errors.Is(err, repository.ErrTriggerLedgerLeaseLost) {
+					// 租约已被其他一方接手，剩余的动作由它执行
+					actionResults = append(actionResults, result)
+					executionLog.ActionResults = actionResults
+					executionLog.ErrorMessage = err.Error()
+					return err
+				}
+			}
 		}
 
 		actionResults = append(actionResults, result)
@@ -453,6 +731,42 @@ func (s *TriggerService) processEmailWithTrigger(trigger *models.EmailTrigger, e
 	return nil
 }
 
+// RerunTrigger 对选定的邮件重新执行触发器的当前修订，不论处理台账中是否已处理过，
+// 也不检查触发器的过滤条件。正由其他一方处理的邮件返回 repository.ErrTriggerLedgerBusy。
+// 返回每封邮件新的台账记录
+func (s *TriggerService) RerunTrigger(id uint, emailIDs []uint) ([]models.TriggerLedgerEntry, error) {
+	trigger, err := s.triggerRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make([]*models.Email, 0, len(emailIDs))
+	for _, emailID := range emailIDs {
+		email, err := s.emailRepo.GetByID(emailID)
+		if err != nil {
+			return nil, fmt.Errorf("email %d: %w", emailID, err)
+		}
+		emails = append(emails, email)
+	}
+
+	entries := make([]models.TriggerLedgerEntry, 0, len(emails))
+	for _, email := range emails {
+		entry, err := s.ledgerRepo.Restart(trigger.ID, email.ID, trigger.Revision)
+		if err != nil {
+			return entries, fmt.Errorf("email %d: %w", email.ID, err)
+		}
+		if err := s.processLedgerEntry(trigger, entry, *email, time.Now()); err != nil {
+			log.Printf("[TriggerService] Error re-running trigger %d on email %d: %v", trigger.ID, email.ID, err)
+		}
+		entry, err = s.ledgerRepo.Get(trigger.ID, email.ID, trigger.Revision)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
 // evaluateCondition 评估触发条件
 func (s *TriggerService) evaluateCondition(condition models.TriggerConditionConfig, email models.Email) (bool, error) {
 	switch condition.Type {
@@ -460,76 +774,22 @@ func (s *TriggerService) evaluateCondition(condition models.TriggerConditionConf
 		return s.evaluateJSCondition(condition.Script, email)
 	case "gotemplate":
 		return s.evaluateGoTemplateCondition(condition.Script, email)
+	case "builtin":
+		// 内置提取器在邮件中找到值即满足条件，例如 otp 或 verify_link
+		values, err := s.extractorService.extractWithBuiltin(email, s.extractorService.getFieldContent(email, ExtractorFieldAll), condition.Script)
+		if err != nil {
+			return false, err
+		}
+		return len(values) > 0, nil
 	default:
 		return false, fmt.Errorf("unsupported condition type: %s", condition.Type)
 	}
 }
 
-// evaluateJSCondition 评估JavaScript条件
+// evaluateJSCondition 评估JavaScript条件，content 为邮件的全部文本
 func (s *TriggerService) evaluateJSCondition(script string, email models.Email) (bool, error) {
-	vm := otto.New()
-
-	// 设置超时
-	timeout := time.After(10 * time.Second)
-	done := make(chan bool, 1)
-
-	var result bool
-	var err error
-
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				err = fmt.Errorf("JS execution panic: %v", r)
-			}
-			done <- true
-		}()
-
-		// 设置邮件对象
-		emailJSON, jsonErr := json.Marshal(email)
-		if jsonErr != nil {
-			err = fmt.Errorf("failed to marshal email: %w", jsonErr)
-			return
-		}
-
-		if setErr := vm.Set("email", string(emailJSON)); setErr != nil {
-			err = fmt.Errorf("failed to set email variable: %w", setErr)
-			return
-		}
-
-		// 解析邮件对象
-		if _, runErr := vm.Run("var parsedEmail = JSON.parse(email);"); runErr != nil {
-			err = fmt.Errorf("failed to parse email in JS: %w", runErr)
-			return
-		}
-
-		// 包装脚本确保返回布尔值
-		wrappedScript := fmt.Sprintf(`
-			(function() {
-				try {
-					var result = (function() { %s })();
-					return !!result;
-				} catch (e) {
-					return false;
-				}
-			})()
-		`, script)
-
-		// 执行脚本
-		value, runErr := vm.Run(wrappedScript)
-		if runErr != nil {
-			err = fmt.Errorf("JS execution failed: %w", runErr)
-			return
-		}
-
-		result, err = value.ToBoolean()
-	}()
-
-	select {
-	case <-timeout:
-		return false, fmt.Errorf("JS condition evaluation timeout")
-	case <-done:
-		return result, err
-	}
+	content := s.extractorService.getFieldContent(email, ExtractorFieldAll)
+	return GetScriptRuntime().Condition(script, ScriptInput{Email: email, Content: content})
 }
 
 // evaluateGoTemplateCondition 评估Go模板条件
@@ -576,6 +836,10 @@ func (s *TriggerService) executeAction(action models.TriggerActionConfig, email
 	case models.TriggerActionTypeSMTP:
 		// 未来实现SMTP转发
 		return &email, fmt.Errorf("SMTP action not implemented yet")
+	case models.TriggerActionTypeAddTags, models.TriggerActionTypeRemoveTags:
+		return s.executeTagAction(action, email)
+	case models.TriggerActionTypeExtractValues:
+		return s.executeExtractValuesAction(action, email)
 	default:
 		return &email, fmt.Errorf("unsupported action type: %s", action.Type)
 	}
@@ -639,21 +903,123 @@ func (s *TriggerService) executeModifyContentAction(action models.TriggerActionC
 	return &modifiedEmail, nil
 }
 
-// updateTriggerStatistics 更新触发器统计信息
-func (s *TriggerService) updateTriggerStatistics(trigger *models.EmailTrigger, success bool, errorMsg string) {
-	now := time.Now()
-	totalExecutions := trigger.TotalExecutions + 1
-	successExecutions := trigger.SuccessExecutions
-	if success {
-		successExecutions++
+// ParseTagActionConfig 解析标签动作的配置，支持 {"tags": ["a", "b"]}、["a", "b"] 或 "a, b"
+func ParseTagActionConfig(config string) ([]string, error) {
+	config = strings.TrimSpace(config)
+
+	var names []string
+	switch {
+	case strings.HasPrefix(config, "{"):
+		var parsed struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+			return nil, fmt.Errorf("invalid tag action config: %w", err)
+		}
+		names = parsed.Tags
+	case strings.HasPrefix(config, "["):
+		if err := json.Unmarshal([]byte(config), &names); err != nil {
+			return nil, fmt.Errorf("invalid tag action config: %w", err)
+		}
+	default:
+		names = strings.Split(config, ",")
 	}
 
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			tags = append(tags, name)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("tag action requires at least one tag")
+	}
+	return tags, nil
+}
+
+// executeTagAction 执行添加/移除标签动作，标签直接写入数据库
+func (s *TriggerService) executeTagAction(action models.TriggerActionConfig, email models.Email) (*models.Email, error) {
+	names, err := ParseTagActionConfig(action.Config)
+	if err != nil {
+		return &email, err
+	}
+	if email.ID == 0 {
+		return &email, fmt.Errorf("email is not stored, cannot change its tags")
+	}
+
+	if action.Type == models.TriggerActionTypeAddTags {
+		// 不存在的标签自动创建
+		tags, err := s.tagRepo.FindOrCreate(names)
+		if err != nil {
+			return &email, fmt.Errorf("failed to resolve tags: %w", err)
+		}
+		if _, err := s.tagRepo.AddToEmails([]uint{email.ID}, tagIDs(tags)); err != nil {
+			return &email, fmt.Errorf("failed to add tags: %w", err)
+		}
+		return &email, nil
+	}
+
+	var tags []models.Tag
+	for _, name := range names {
+		if tag, err := s.tagRepo.GetByName(name); err == nil {
+			tags = append(tags, *tag)
+		}
+	}
+	if _, err := s.tagRepo.RemoveFromEmails([]uint{email.ID}, tagIDs(tags)); err != nil {
+		return &email, fmt.Errorf("failed to remove tags: %w", err)
+	}
+	return &email, nil
+}
+
+// ExtractValuesActionConfig 提取动作的配置，省略 revision 时使用模板的当前修订
+type ExtractValuesActionConfig struct {
+	TemplateID uint `json:"template_id"`
+	Revision   *int `json:"revision,omitempty"`
+}
+
+// ParseExtractValuesActionConfig 解析提取动作的配置，例如 {"template_id": 3}
+func ParseExtractValuesActionConfig(config string) (*ExtractValuesActionConfig, error) {
+	var parsed ExtractValuesActionConfig
+	if err := json.Unmarshal([]byte(strings.TrimSpace(config)), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid extract action config: %w", err)
+	}
+	if parsed.TemplateID == 0 {
+		return nil, fmt.Errorf("extract action requires template_id")
+	}
+	return &parsed, nil
+}
+
+// executeExtractValuesAction 执行提取动作，结果写入 extracted_values，重复处理同一封邮件时替换原有的值
+func (s *TriggerService) executeExtractValuesAction(action models.TriggerActionConfig, email models.Email) (*models.Email, error) {
+	config, err := ParseExtractValuesActionConfig(action.Config)
+	if err != nil {
+		return &email, err
+	}
+	if s.valueService == nil {
+		return &email, fmt.Errorf("extracted values are not available")
+	}
+	if _, err := s.valueService.Run(config.TemplateID, config.Revision, email); err != nil {
+		return &email, fmt.Errorf("failed to extract values: %w", err)
+	}
+	return &email, nil
+}
+
+func tagIDs(tags []models.Tag) []uint {
+	ids := make([]uint, len(tags))
+	for i, tag := range tags {
+		ids[i] = tag.ID
+	}
+	return ids
+}
+
+// updateTriggerStatistics 更新触发器统计信息
+func (s *TriggerService) updateTriggerStatistics(trigger *models.EmailTrigger, success bool, errorMsg string) {
 	lastError := ""
 	if !success {
 		lastError = errorMsg
 	}
 
-	if err := s.triggerRepo.UpdateStatistics(trigger.ID, totalExecutions, successExecutions, &now, lastError); err != nil {
+	if err := s.triggerRepo.RecordExecution(trigger.ID, success, time.Now(), lastError); err != nil {
 		log.Printf("[TriggerService] Failed to update trigger statistics: %v", err)
 	}
 }
@@ -672,6 +1038,7 @@ func (s *TriggerService) GetWorkerStatus() map[uint]map[string]interface{} {
 			"trigger_name":    worker.Trigger.Name,
 			"is_running":      worker.IsRunning,
 			"last_check_time": worker.LastCheckTime,
+			"last_email_id":   worker.LastEmailID,
 			"check_interval":  worker.Trigger.CheckInterval,
 		}
 		worker.mu.RUnlock()
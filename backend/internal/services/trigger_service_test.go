@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mailman/internal/models"
+	"mailman/internal/repository"
+	"mailman/internal/secrets"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openServiceTestDB creates the tables of the given models in a temporary
+// sqlite database, with a generated master key for encrypted columns
+func openServiceTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "services.db") + "?_busy_timeout=10000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.SetupJoinTable(&models.Email{}, "Tags", &models.EmailTag{}); err != nil {
+		t.Fatalf("failed to set up email tags join table: %v", err)
+	}
+	base := []interface{}{&models.EmailAccount{}, &models.Email{}, &models.Attachment{}, &models.Tag{}, &models.EmailTag{}}
+	if err := db.AutoMigrate(append(base, tables...)...); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyring, err := secrets.ParseKeyring(key)
+	if err != nil {
+		t.Fatalf("failed to parse key: %v", err)
+	}
+	previous := secrets.Default()
+	secrets.SetDefault(keyring)
+	t.Cleanup(func() { secrets.SetDefault(previous) })
+
+	if err := db.Create(&models.EmailAccount{ID: 1, EmailAddress: "me@example.com"}).Error; err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	return db
+}
+
+// storeEmail inserts an email with a fixed ID the way a sync transaction
+// commits it, storedAt is its creation time
+func storeEmail(t *testing.T, db *gorm.DB, id uint, storedAt time.Time) {
+	t.Helper()
+	email := &models.Email{
+		ID:        id,
+		AccountID: 1,
+		Subject:   "Your code is 123456",
+		From:      models.StringSlice{"Alice <alice@example.com>"},
+		To:        models.StringSlice{"shop@example.com"},
+		Date:      storedAt,
+		CreatedAt: storedAt,
+	}
+	if err := db.Create(email).Error; err != nil {
+		t.Fatalf("failed to store email %d: %v", id, err)
+	}
+}
+
+func newTestTriggerWorker(t *testing.T, db *gorm.DB) (*TriggerService, *TriggerWorker) {
+	t.Helper()
+	trigger := &models.EmailTrigger{
+		Name:      "test",
+		Status:    models.TriggerStatusEnabled,
+		Condition: models.TriggerConditionConfig{Type: "gotemplate", Script: "true"},
+		Revision:  1,
+	}
+	if err := db.Create(trigger).Error; err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	service := NewTriggerService(
+		repository.NewTriggerRepository(db),
+		repository.NewTriggerExecutionLogRepository(db),
+		repository.NewTriggerLedgerRepository(db),
+		repository.NewEmailRepository(db),
+		nil, nil, nil,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	worker := &TriggerWorker{
+		TriggerID:  trigger.ID,
+		Trigger:    trigger,
+		Context:    ctx,
+		CancelFunc: cancel,
+		evaluated:  make(map[uint]bool),
+	}
+	return service, worker
+}
+
+func assertLedgerDone(t *testing.T, ledger *repository.TriggerLedgerRepository, triggerID, emailID uint) {
+	t.Helper()
+	entry, err := ledger.Get(triggerID, emailID, 1)
+	if err != nil || entry.State != models.TriggerLedgerStateDone {
+		t.Fatalf("expected email %d to be processed, got %v", emailID, err)
+	}
+}
+
+func TestTriggerEvaluatesEmailCommittedLate(t *testing.T) {
+	db := openServiceTestDB(t, &models.EmailTrigger{}, &models.TriggerExecutionLog{}, &models.TriggerLedgerEntry{})
+	service, worker := newTestTriggerWorker(t, db)
+	ledger := repository.NewTriggerLedgerRepository(db)
+
+	// 两个同步事务分别分配了 ID 1 和 2，ID 2 的事务先提交
+	now := time.Now()
+	storeEmail(t, db, 2, now)
+	if err := service.executeTrigger(worker, worker.Trigger); err != nil {
+		t.Fatalf("executeTrigger failed: %v", err)
+	}
+	assertLedgerDone(t, ledger, worker.TriggerID, 2)
+	if worker.LastEmailID != 0 {
+		t.Fatalf("expected the cursor to wait for recent emails, got %d", worker.LastEmailID)
+	}
+
+	storeEmail(t, db, 1, now)
+	if err := service.executeTrigger(worker, worker.Trigger); err != nil {
+		t.Fatalf("executeTrigger failed: %v", err)
+	}
+	assertLedgerDone(t, ledger, worker.TriggerID, 1)
+
+	// 入库时间超过可见性延迟后进度越过两封邮件
+	if err := db.Model(&models.Email{}).Where("id IN ?", []uint{1, 2}).
+		Update("created_at", now.Add(-2*repository.EmailVisibilityLag)).Error; err != nil {
+		t.Fatalf("failed to age emails: %v", err)
+	}
+	if err := service.executeTrigger(worker, worker.Trigger); err != nil {
+		t.Fatalf("executeTrigger failed: %v", err)
+	}
+	if worker.LastEmailID != 2 || len(worker.evaluated) != 0 {
+		t.Fatalf("expected the cursor at 2 with nothing pending, got %d and %v", worker.LastEmailID, worker.evaluated)
+	}
+}
+
+func TestTriggerCursorWaitsForUnfinishedEmail(t *testing.T) {
+	db := openServiceTestDB(t, &models.EmailTrigger{}, &models.TriggerExecutionLog{}, &models.TriggerLedgerEntry{})
+	service, worker := newTestTriggerWorker(t, db)
+	ledger := repository.NewTriggerLedgerRepository(db)
+
+	old := time.Now().Add(-2 * repository.EmailVisibilityLag)
+	for id := uint(1); id <= 3; id++ {
+		storeEmail(t, db, id, old)
+	}
+
+	// 另一方正在处理邮件 2，它没有处理完之前进度不能越过它
+	held, claimed, err := ledger.Begin(worker.TriggerID, 2, 1)
+	if err != nil || !claimed {
+		t.Fatalf("failed to claim email 2: %v, %v", claimed, err)
+	}
+	if err := service.executeTrigger(worker, worker.Trigger); err != nil {
+		t.Fatalf("executeTrigger failed: %v", err)
+	}
+	assertLedgerDone(t, ledger, worker.TriggerID, 3)
+	if worker.LastEmailID != 1 {
+		t.Fatalf("expected the cursor to stop before email 2, got %d", worker.LastEmailID)
+	}
+
+	if err := ledger.Finish(held, models.TriggerExecutionStatusSuccess, true, ""); err != nil {
+		t.Fatalf("failed to finish email 2: %v", err)
+	}
+	if err := service.executeTrigger(worker, worker.Trigger); err != nil {
+		t.Fatalf("executeTrigger failed: %v", err)
+	}
+	if worker.LastEmailID != 3 {
+		t.Fatalf("expected the cursor at 3, got %d", worker.LastEmailID)
+	}
+}
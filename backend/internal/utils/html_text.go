@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// blockElements are HTML elements that start a new line in the plain-text rendering
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"div": true, "dl": true, "dt": true, "dd": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "tr": true, "ul": true,
+}
+
+// HTMLToText converts an HTML document into readable plain text.
+// Script, style and head content is dropped, block elements become line
+// breaks and runs of whitespace are collapsed.
+func HTMLToText(input string) string {
+	if strings.TrimSpace(input) == "" {
+		return ""
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(input))
+	var sb strings.Builder
+	skipDepth := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return collapseWhitespace(sb.String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if tag == "script" || tag == "style" || tag == "head" || tag == "title" {
+				if tokenType == html.StartTagToken {
+					skipDepth++
+				}
+				continue
+			}
+			if blockElements[tag] {
+				sb.WriteString("\n")
+			} else if tag == "td" || tag == "th" {
+				sb.WriteString(" ")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if tag == "script" || tag == "style" || tag == "head" || tag == "title" {
+				if skipDepth > 0 {
+					skipDepth--
+				}
+				continue
+			}
+			if blockElements[tag] {
+				sb.WriteString("\n")
+			}
+		case html.TextToken:
+			if skipDepth > 0 {
+				continue
+			}
+			sb.Write(tokenizer.Text())
+		}
+	}
+}
+
+// collapseWhitespace squeezes horizontal whitespace and blank lines
+func collapseWhitespace(text string) string {
+	lines := strings.Split(text, "\n")
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return strings.Join(result, "\n")
+}
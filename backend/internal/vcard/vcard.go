@@ -0,0 +1,295 @@
+// Package vcard reads and writes the contact fields of vCard 2.1, 3.0 and 4.0
+// files that mailman keeps: names, email addresses, phone numbers,
+// organization and note. Other properties are ignored.
+package vcard
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNoCards is returned when a file contains no vCard
+var ErrNoCards = errors.New("no vCard found")
+
+// Card is a contact read from or written to a vCard
+type Card struct {
+	Name         string   `json:"name"`
+	Emails       []string `json:"emails"`
+	Phones       []string `json:"phones,omitempty"`
+	Organization string   `json:"organization,omitempty"`
+	Note         string   `json:"note,omitempty"`
+}
+
+// IsVCard reports whether an attachment is a vCard, by MIME type or file extension
+func IsVCard(filename, mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	switch mimeType {
+	case "text/vcard", "text/x-vcard", "text/directory":
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".vcf", ".vcard":
+		return true
+	}
+	return false
+}
+
+// Parse reads all cards of a vCard file
+func Parse(r io.Reader) ([]Card, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	var card *Card
+	var structuredName string
+	for _, line := range unfold(data) {
+		name, params, value, ok := splitProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "BEGIN":
+			if strings.EqualFold(value, "VCARD") {
+				card = &Card{}
+				structuredName = ""
+			}
+			continue
+		case "END":
+			if card != nil && strings.EqualFold(value, "VCARD") {
+				if card.Name == "" {
+					card.Name = structuredName
+				}
+				cards = append(cards, *card)
+				card = nil
+			}
+			continue
+		}
+		if card == nil {
+			continue
+		}
+
+		value = decodeValue(params, value)
+		switch name {
+		case "FN":
+			card.Name = unescape(value)
+		case "N":
+			structuredName = joinComponents(splitComponents(value), []int{3, 1, 2, 0, 4}, " ")
+		case "EMAIL":
+			if email := strings.TrimSpace(unescape(value)); email != "" {
+				card.Emails = append(card.Emails, strings.TrimPrefix(email, "mailto:"))
+			}
+		case "TEL":
+			if phone := strings.TrimSpace(unescape(value)); phone != "" {
+				card.Phones = append(card.Phones, strings.TrimPrefix(phone, "tel:"))
+			}
+		case "ORG":
+			components := splitComponents(value)
+			card.Organization = joinComponents(components, nil, ", ")
+		case "NOTE":
+			card.Note = unescape(value)
+		}
+	}
+	// 缺少 END:VCARD 的最后一张名片同样保留
+	if card != nil {
+		if card.Name == "" {
+			card.Name = structuredName
+		}
+		cards = append(cards, *card)
+	}
+
+	if len(cards) == 0 {
+		return nil, ErrNoCards
+	}
+	return cards, nil
+}
+
+// Write writes cards as vCard 3.0
+func Write(w io.Writer, cards []Card) error {
+	buffered := bufio.NewWriter(w)
+	for _, card := range cards {
+		name := card.Name
+		if name == "" && len(card.Emails) > 0 {
+			name = card.Emails[0]
+		}
+
+		lines := []string{
+			"BEGIN:VCARD",
+			"VERSION:3.0",
+			"FN:" + escape(name),
+			"N:;" + escape(name) + ";;;",
+		}
+		for _, email := range card.Emails {
+			lines = append(lines, "EMAIL;TYPE=INTERNET:"+escape(email))
+		}
+		for _, phone := range card.Phones {
+			lines = append(lines, "TEL:"+escape(phone))
+		}
+		if card.Organization != "" {
+			lines = append(lines, "ORG:"+escape(card.Organization))
+		}
+		if card.Note != "" {
+			lines = append(lines, "NOTE:"+escape(card.Note))
+		}
+		lines = append(lines, "END:VCARD")
+
+		for _, line := range lines {
+			if _, err := buffered.WriteString(fold(line)); err != nil {
+				return err
+			}
+		}
+	}
+	return buffered.Flush()
+}
+
+// unfold joins folded lines (RFC 6350 3.2) and quoted-printable soft line breaks of vCard 2.1
+func unfold(data []byte) []string {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	raw := strings.Split(string(data), "\n")
+
+	var lines []string
+	for _, line := range raw {
+		if len(lines) > 0 {
+			last := lines[len(lines)-1]
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				lines[len(lines)-1] = last + line[1:]
+				continue
+			}
+			if strings.HasSuffix(last, "=") && isQuotedPrintable(last) {
+				lines[len(lines)-1] = last + "\n" + line
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func isQuotedPrintable(line string) bool {
+	head := strings.ToUpper(strings.SplitN(line, ":", 2)[0])
+	return strings.Contains(head, "QUOTED-PRINTABLE")
+}
+
+// splitProperty splits "group.NAME;PARAM=x:value"
+func splitProperty(line string) (name string, params []string, value string, ok bool) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	head := strings.Split(line[:colon], ";")
+	name = strings.ToUpper(strings.TrimSpace(head[0]))
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	return name, head[1:], line[colon+1:], true
+}
+
+// decodeValue applies the ENCODING parameter of vCard 2.1
+func decodeValue(params []string, value string) string {
+	for _, param := range params {
+		upper := strings.ToUpper(param)
+		if upper == "QUOTED-PRINTABLE" || upper == "ENCODING=QUOTED-PRINTABLE" {
+			// 软换行在 unfold 时保留为 "=\n"
+			decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(value)))
+			if err == nil && utf8.Valid(decoded) {
+				return string(decoded)
+			}
+		}
+	}
+	return value
+}
+
+// splitComponents splits a structured value at unescaped semicolons
+func splitComponents(value string) []string {
+	var components []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			current.WriteByte(value[i])
+			current.WriteByte(value[i+1])
+			i++
+		case value[i] == ';':
+			components = append(components, unescape(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(components, unescape(current.String()))
+}
+
+// joinComponents joins the non-empty components in the given order, all when order is nil
+func joinComponents(components []string, order []int, separator string) string {
+	if order == nil {
+		for i := range components {
+			order = append(order, i)
+		}
+	}
+	var parts []string
+	for _, i := range order {
+		if i < len(components) && strings.TrimSpace(components[i]) != "" {
+			parts = append(parts, strings.TrimSpace(components[i]))
+		}
+	}
+	return strings.Join(parts, separator)
+}
+
+func unescape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(value[i])
+			}
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+func escape(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "", ",", "\\,", ";", "\\;")
+	return replacer.Replace(value)
+}
+
+// fold splits a content line into lines of at most 75 octets without breaking UTF-8 sequences
+func fold(line string) string {
+	const limit = 75
+	var b strings.Builder
+	first := true
+	for len(line) > 0 {
+		max := limit
+		if !first {
+			max = limit - 1
+		}
+		if len(line) <= max {
+			max = len(line)
+		} else {
+			for max > 0 && !utf8.RuneStart(line[max]) {
+				max--
+			}
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		b.WriteString(line[:max])
+		b.WriteString("\r\n")
+		line = line[max:]
+		first = false
+	}
+	return b.String()
+}
@@ -6,8 +6,8 @@ import { emailService } from '@/services/email.service'
 
 interface ExtractorConfig {
     id: string
-    type: 'regex' | 'js' | 'gotemplate'
-    field: 'ALL' | 'from' | 'to' | 'cc' | 'subject' | 'body' | 'html_body' | 'headers'
+    type: 'regex' | 'js' | 'gotemplate' | 'html' | 'jsonpath' | 'builtin'
+    field: 'ALL' | 'from' | 'to' | 'cc' | 'subject' | 'body' | 'html_body' | 'headers' | 'attachments'
     config: string
 }
 
@@ -166,6 +166,9 @@ export default function EmailExtractPage() {
                                             <option value="regex">正则表达式</option>
                                             <option value="js">JavaScript</option>
                                             <option value="gotemplate">Go模板</option>
+                                            <option value="html">HTML选择器</option>
+                                            <option value="jsonpath">JSONPath</option>
+                                            <option value="builtin">内置提取器</option>
                                         </select>
                                     </div>
                                     <button
@@ -193,6 +196,7 @@ export default function EmailExtractPage() {
                                         <option value="body">正文</option>
                                         <option value="html_body">HTML正文</option>
                                         <option value="headers">邮件头</option>
+                                        <option value="attachments">附件文本</option>
                                     </select>
                                 </div>
 
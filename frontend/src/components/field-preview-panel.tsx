@@ -46,7 +46,8 @@ export function FieldPreviewPanel({
             'subject': '主题',
             'body': '正文',
             'html_body': 'HTML正文',
-            'headers': '邮件头'
+            'headers': '邮件头',
+            'attachments': '附件文本'
         }
         return fieldMap[fieldValue] || fieldValue
     }
@@ -86,7 +86,7 @@ export function AIExtractorAssistantModal({
                     configs = jsonData.map(item => {
                         const field = item.field || 'ALL'
                         // 确保 field 是有效的类型
-                        const validFields = ['ALL', 'from', 'to', 'cc', 'subject', 'body', 'html_body', 'headers']
+                        const validFields = ['ALL', 'from', 'to', 'cc', 'subject', 'body', 'html_body', 'headers', 'attachments']
                         const validField = validFields.includes(field) ? field : 'ALL'
 
                         return {
@@ -100,7 +100,7 @@ export function AIExtractorAssistantModal({
                     })
                 } else if (typeof jsonData === 'object') {
                     const field = jsonData.field || 'ALL'
-                    const validFields = ['ALL', 'from', 'to', 'cc', 'subject', 'body', 'html_body', 'headers']
+                    const validFields = ['ALL', 'from', 'to', 'cc', 'subject', 'body', 'html_body', 'headers', 'attachments']
                     const validField = validFields.includes(field) ? field : 'ALL'
 
                     configs = [{
@@ -1,7 +1,7 @@
 'use client'
 
 import { useState, useEffect, useRef } from 'react'
-import { X, Plus, Trash2, GripVertical, Sparkles, Hash, Code, Play, CheckCircle, XCircle, Loader2, Bug, HelpCircle, Copy, ChevronDown, ChevronUp } from 'lucide-react'
+import { X, Plus, Trash2, GripVertical, Sparkles, Hash, Code, Play, CheckCircle, XCircle, Loader2, Bug, HelpCircle, FileCode, Braces, Package, Copy, ChevronDown, ChevronUp } from 'lucide-react'
 import { cn } from '@/lib/utils'
 import type { ExtractorTemplate, ExtractorTemplateRequest, ExtractorConfig } from '@/types'
 import { extractorTemplateService, TestResult } from '@/services/extractor-template.service'
@@ -24,7 +24,10 @@ interface ExtractorTemplateModalProps {
 const extractorTypes = [
     { value: 'regex', label: '正则表达式', icon: Hash, color: 'text-blue-500' },
     { value: 'js', label: 'JavaScript', icon: Code, color: 'text-green-500' },
-    { value: 'gotemplate', label: 'Go模板', icon: Sparkles, color: 'text-purple-500' }
+    { value: 'gotemplate', label: 'Go模板', icon: Sparkles, color: 'text-purple-500' },
+    { value: 'html', label: 'HTML选择器', icon: FileCode, color: 'text-orange-500' },
+    { value: 'jsonpath', label: 'JSONPath', icon: Braces, color: 'text-teal-500' },
+    { value: 'builtin', label: '内置提取器', icon: Package, color: 'text-rose-500' }
 ] as const
 
 const fieldOptions = [
@@ -35,7 +38,8 @@ const fieldOptions = [
     { value: 'subject', label: '主题' },
     { value: 'body', label: '正文' },
     { value: 'html_body', label: 'HTML正文' },
-    { value: 'headers', label: '邮件头' }
+    { value: 'headers', label: '邮件头' },
+    { value: 'attachments', label: '附件文本' }
 ] as const
 
 // 提取器项组件
@@ -175,6 +179,12 @@ function ExtractorItem({
                                         ? '输入正则表达式，例如：订单号.*\\d{10}'
                                         : extractor.type === 'js'
                                             ? '输入JavaScript代码，返回布尔值'
+                                            : extractor.type === 'html'
+                                            ? '输入CSS选择器或XPath，找到元素即匹配，例如：a.verify'
+                                            : extractor.type === 'jsonpath'
+                                            ? '输入JSONPath，取到值即匹配，例如：$.order.id'
+                                            : extractor.type === 'builtin'
+                                            ? '输入内置提取器名称，提取到值即匹配，例如：otp'
                                             : '输入Go模板表达式，例如：{{ contains .Content "订单号" }}'
                                 }
                                 rows={2}
@@ -190,7 +200,7 @@ function ExtractorItem({
                                             <li>正则匹配成功返回 true，失败返回 false</li>
                                         )}
                                         {extractor.type === 'js' && (
-                                            <li>JavaScript 代码应返回布尔值</li>
+                                            <li>JavaScript 代码应返回布尔值，支持 ES2015+ 语法</li>
                                         )}
                                         {extractor.type === 'gotemplate' && (
                                             <li>模板表达式应返回布尔值</li>
@@ -228,7 +238,13 @@ function ExtractorItem({
                                 placeholder={
                                     extractor.type === 'regex'
                                         ? '输入正则表达式和捕获组模板，例如：\n订单号[：:]\\s*(\\d{10})\n$1'
-                                        : extractor.type === 'js'
+                                        : extractor.type === 'html'
+                                            ? '输入CSS选择器或XPath，例如：\na.verify@href\n//td[@id=\'code\']'
+                                            : extractor.type === 'jsonpath'
+                                            ? '输入JSONPath，例如：\n$.order.items[*].sku'
+                                            : extractor.type === 'builtin'
+                                            ? '输入内置提取器名称，例如：\notp、verify_link、magic_link、tracking_number、amount、unsubscribe_link'
+                                            : extractor.type === 'js'
                                             ? '输入JavaScript代码，例如：\nconst match = text.match(/订单号[：:]\\s*(\\d{10})/);\nreturn match ? match[1] : null;'
                                             : '输入Go模板，例如：\n{{ regexFind "订单号[：:]\\s*(\\d{10})" .Content 1 }}'
                                 }
@@ -272,8 +288,10 @@ function ExtractorItem({
                                             <div>
                                                 <p className="font-medium">可用变量：</p>
                                                 <ul className="list-disc list-inside text-gray-700 dark:text-gray-300">
-                                                    <li>text - 输入文本</li>
-                                                    <li>field - 当前字段名</li>
+                                                    <li>email / content - 邮件和字段内容的 JSON 字符串（与旧版本相同）</li>
+                                                    <li>parsedEmail / parsedContent - 解析后的邮件和字段内容数组</li>
+                                                    <li>mail - 邮件对象：subject、from/to（含 name 和 address）、headers、attachments 等</li>
+                                                    <li>text - 字段内容以换行连接</li>
                                                 </ul>
                                             </div>
                                         </div>
@@ -512,6 +530,7 @@ export function ExtractorTemplateModal({
             name: form.name,
             description: form.description || '',
             extractors: form.extractors,
+            revision: template?.revision || 0,
             created_at: template?.created_at || new Date().toISOString(),
             updated_at: new Date().toISOString()
         }
@@ -1,7 +1,7 @@
 'use client'
 
 import { useState, useEffect } from 'react'
-import { X, Play, Mail, User, Calendar, FileText, AlertCircle, CheckCircle, Loader2, Code, Eye, Settings, Save, Plus, Trash2, Hash, Sparkles, HelpCircle } from 'lucide-react'
+import { X, Play, Mail, User, Calendar, FileText, AlertCircle, CheckCircle, Loader2, Code, Eye, Settings, Save, Plus, Trash2, Hash, Sparkles, HelpCircle, FileCode, Braces, Package } from 'lucide-react'
 import { cn } from '@/lib/utils'
 import type { ExtractorTemplate, EmailAccount, Email, ExtractorConfig } from '@/types'
 import { emailAccountService } from '@/services/email-account.service'
@@ -36,7 +36,10 @@ type TabType = 'email' | 'config' | 'result'
 const extractorTypes = [
     { value: 'regex', label: '正则表达式', icon: Hash, color: 'text-blue-500' },
     { value: 'js', label: 'JavaScript', icon: Code, color: 'text-green-500' },
-    { value: 'gotemplate', label: 'Go模板', icon: Sparkles, color: 'text-purple-500' }
+    { value: 'gotemplate', label: 'Go模板', icon: Sparkles, color: 'text-purple-500' },
+    { value: 'html', label: 'HTML选择器', icon: FileCode, color: 'text-orange-500' },
+    { value: 'jsonpath', label: 'JSONPath', icon: Braces, color: 'text-teal-500' },
+    { value: 'builtin', label: '内置提取器', icon: Package, color: 'text-rose-500' }
 ] as const
 
 const fieldOptions = [
@@ -47,7 +50,8 @@ const fieldOptions = [
     { value: 'subject', label: '主题' },
     { value: 'body', label: '正文' },
     { value: 'html_body', label: 'HTML正文' },
-    { value: 'headers', label: '邮件头' }
+    { value: 'headers', label: '邮件头' },
+    { value: 'attachments', label: '附件文本' }
 ] as const
 
 export function ExtractorTemplateTestModal({
@@ -1132,6 +1136,21 @@ export function ExtractorTemplateTestModal({
                                                                     使用Go模板语法处理结构化数据
                                                                 </div>
                                                             )}
+                                                            {extractor.type === 'html' && (
+                                                                <div className="rounded-lg bg-orange-50 p-3 text-sm text-orange-700 dark:bg-orange-900/20 dark:text-orange-300">
+                                                                    使用CSS选择器或XPath（以 / 开头）解析HTML，a.verify@href 提取属性，@html 提取内部HTML，|||$0 设置返回模板
+                                                                </div>
+                                                            )}
+                                                            {extractor.type === 'jsonpath' && (
+                                                                <div className="rounded-lg bg-teal-50 p-3 text-sm text-teal-700 dark:bg-teal-900/20 dark:text-teal-300">
+                                                                    使用JSONPath解析JSON正文或附件（字段填写 attachment:*.json），例如 $.order.id，对象和数组返回JSON文本
+                                                                </div>
+                                                            )}
+                                                            {extractor.type === 'builtin' && (
+                                                                <div className="rounded-lg bg-rose-50 p-3 text-sm text-rose-700 dark:bg-rose-900/20 dark:text-rose-300">
+                                                                    内置提取器：otp、verify_link、magic_link、tracking_number、amount、unsubscribe_link，可用 @1 固定版本，字段通常填写 ALL
+                                                                </div>
+                                                            )}
                                                         </div>
                                                     </motion.div>
                                                 )
@@ -1498,6 +1498,9 @@ export default function MailPickupTab() {
                                                                         <option value="regex">正则表达式</option>
                                                                         <option value="js">JavaScript</option>
                                                                         <option value="gotemplate">Go模板</option>
+                                                                        <option value="html">HTML选择器</option>
+                                                                        <option value="jsonpath">JSONPath</option>
+                                                                        <option value="builtin">内置提取器</option>
                                                                     </select>
                                                                     <button
                                                                         onClick={() => removeExtractRule(email.id, index)}
@@ -41,7 +41,7 @@ export interface ExtractEmailsRequest {
 
 // 提取器配置
 export interface ExtractorConfig {
-    type: 'regex' | 'js' | 'gotemplate';
+    type: 'regex' | 'js' | 'gotemplate' | 'html' | 'jsonpath';
     field: 'ALL' | 'from' | 'to' | 'cc' | 'subject' | 'body' | 'html_body' | 'headers';
     config: string;
 }
@@ -0,0 +1,75 @@
+import { apiClient } from '@/lib/api-client'
+
+export interface ExtractedValue {
+    id: number
+    email_id: number
+    template_id: number
+    revision: number
+    field: string
+    type: 'string' | 'number' | 'date' | 'url' | 'list'
+    value: string | number | string[]
+    extracted_at: string
+}
+
+export interface ExtractedValueFilter {
+    template_id?: number
+    field?: string
+    email_id?: number
+    account_id?: number
+    value?: string
+    since?: string // RFC3339
+    until?: string // RFC3339
+}
+
+export interface PaginatedExtractedValuesResponse {
+    data: ExtractedValue[]
+    total: number
+    page: number
+    limit: number
+    total_pages: number
+}
+
+export interface ExtractedValueGroup {
+    key: string
+    count: number
+    emails: number
+    sum?: number
+    avg?: number
+    min?: number
+    max?: number
+}
+
+export interface ExtractedValueAggregateResponse {
+    group_by?: 'field' | 'value' | 'template' | 'day'
+    groups: ExtractedValueGroup[]
+}
+
+function toQuery(params: Record<string, string | number | undefined>): string {
+    const query = new URLSearchParams()
+    Object.entries(params).forEach(([key, value]) => {
+        if (value !== undefined && value !== '') query.set(key, String(value))
+    })
+    return query.toString()
+}
+
+export const extractedValueService = {
+    // 查询保存的提取结果（最近提取的在前）
+    async getValues(filter: ExtractedValueFilter = {}, page: number = 1, limit: number = 50): Promise<PaginatedExtractedValuesResponse> {
+        const response = await apiClient.get<PaginatedExtractedValuesResponse>(
+            `/extracted-values?${toQuery({ ...filter, page, limit })}`
+        )
+        return response
+    },
+
+    // 统计提取结果，可按字段、值、模板或日期分组
+    async aggregate(
+        filter: ExtractedValueFilter = {},
+        groupBy?: 'field' | 'value' | 'template' | 'day',
+        limit?: number
+    ): Promise<ExtractedValueAggregateResponse> {
+        const response = await apiClient.get<ExtractedValueAggregateResponse>(
+            `/extracted-values/aggregate?${toQuery({ ...filter, group_by: groupBy, limit })}`
+        )
+        return response
+    }
+}
@@ -0,0 +1,93 @@
+import { apiClient } from '@/lib/api-client'
+
+export interface ExtractionPipeline {
+    id: number
+    name: string
+    description?: string
+    template_id: number
+    enabled: boolean
+    // 作用范围：各项之间为“与”，同一项的多个值之间为“或”，全部为空时匹配所有新邮件
+    account_ids?: number[]
+    alias_patterns?: string[] // 收件地址，完整地址或 *@example.com，与触发器的别名相同
+    sender_domains?: string[] // 包含子域名
+    mailboxes?: string[]
+    query?: string // Gmail风格搜索语句
+    webhook_url?: string
+    webhook_secret?: string
+    last_email_id: number
+    processed_count: number
+    extracted_count: number
+    last_run_at?: string
+    last_error?: string
+    created_at: string
+    updated_at: string
+}
+
+export interface ExtractionPipelineRequest {
+    name: string
+    description?: string
+    template_id: number
+    enabled?: boolean
+    account_ids?: number[]
+    alias_patterns?: string[]
+    sender_domains?: string[]
+    mailboxes?: string[]
+    query?: string
+    webhook_url?: string
+    webhook_secret?: string // 更新时省略则保留原密钥
+}
+
+export interface ExtractionEvent {
+    pipeline_id: number
+    pipeline: string
+    template_id: number
+    email_id: number
+    account_id: number
+    message_id?: string
+    subject: string
+    from: string[]
+    values: Record<string, string | number | string[]>
+    errors?: { name: string; message: string }[]
+    extracted_at: string
+}
+
+export const extractionPipelineService = {
+    async getPipelines(templateId?: number): Promise<ExtractionPipeline[]> {
+        const query = templateId ? `?template_id=${templateId}` : ''
+        return apiClient.get<ExtractionPipeline[]>(`/extraction-pipelines${query}`)
+    },
+
+    async getPipeline(id: number): Promise<ExtractionPipeline> {
+        return apiClient.get<ExtractionPipeline>(`/extraction-pipelines/${id}`)
+    },
+
+    async createPipeline(data: ExtractionPipelineRequest): Promise<ExtractionPipeline> {
+        return apiClient.post<ExtractionPipeline>('/extraction-pipelines', data)
+    },
+
+    async updatePipeline(id: number, data: ExtractionPipelineRequest): Promise<ExtractionPipeline> {
+        return apiClient.put<ExtractionPipeline>(`/extraction-pipelines/${id}`, data)
+    },
+
+    async deletePipeline(id: number): Promise<void> {
+        await apiClient.delete(`/extraction-pipelines/${id}`)
+    },
+
+    // 订阅流水线的提取结果，pipelineId 为空时接收所有流水线；返回关闭连接的函数
+    watch(onEvent: (event: ExtractionEvent) => void, pipelineId?: number): () => void {
+        const query = pipelineId ? `?pipeline_id=${pipelineId}` : ''
+        const wsUrl = `${window.location.protocol === 'https:' ? 'wss:' : 'ws:'}//${window.location.hostname}:8080/api/ws/extractions${query}`
+        const ws = new WebSocket(wsUrl)
+        ws.onmessage = (message) => {
+            try {
+                const data = JSON.parse(message.data)
+                if (data.type === 'extraction') {
+                    onEvent(data.data as ExtractionEvent)
+                }
+            } catch (error) {
+                console.error('Error parsing extraction event:', error)
+            }
+        }
+        return () => ws.close()
+    }
+}
@@ -1,7 +1,12 @@
 import { apiClient } from '@/lib/api-client'
 import type {
+    ExtractorFixture,
+    ExtractorFixtureOutput,
+    ExtractorSuiteResult,
     ExtractorTemplate,
+    ExtractorTemplateDiff,
     ExtractorTemplateRequest,
+    ExtractorTemplateRevision,
     PaginatedExtractorTemplatesResponse
 } from '@/types'
 
@@ -50,9 +55,12 @@ export const extractorTemplateService = {
         return response
     },
 
-    // 更新取件模板
-    async updateTemplate(id: number, data: ExtractorTemplateRequest): Promise<ExtractorTemplate> {
-        const response = await apiClient.put<ExtractorTemplate>(`/extractor-templates/${id}`, data)
+    // 更新取件模板，测试用例回归时返回 409，force 为 true 时仍然保存
+    async updateTemplate(id: number, data: ExtractorTemplateRequest, force: boolean = false): Promise<ExtractorTemplate> {
+        const response = await apiClient.put<ExtractorTemplate>(
+            `/extractor-templates/${id}${force ? '?force=true' : ''}`,
+            data
+        )
         return response
     },
 
@@ -65,5 +73,69 @@ export const extractorTemplateService = {
     async testTemplate(id: number, data: TestTemplateRequest): Promise<TestResult[]> {
         const response = await apiClient.post<TestResult[]>(`/extractor-templates/${id}/test`, data)
         return response
+    },
+
+    // 获取模板的修订历史（最新的在前）
+    async getRevisions(id: number): Promise<ExtractorTemplateRevision[]> {
+        const response = await apiClient.get<ExtractorTemplateRevision[]>(`/extractor-templates/${id}/revisions`)
+        return response
+    },
+
+    // 比较两个修订，省略时 to 为当前修订，from 为 to 的上一个修订
+    async diffRevisions(id: number, from?: number, to?: number): Promise<ExtractorTemplateDiff> {
+        const params = new URLSearchParams()
+        if (from !== undefined) params.set('from', String(from))
+        if (to !== undefined) params.set('to', String(to))
+        const query = params.toString()
+        const response = await apiClient.get<ExtractorTemplateDiff>(
+            `/extractor-templates/${id}/revisions/diff${query ? `?${query}` : ''}`
+        )
+        return response
+    },
+
+    // 恢复到某个修订，恢复本身会保存为新的修订
+    async restoreRevision(id: number, revision: number, force: boolean = false): Promise<ExtractorTemplate> {
+        const response = await apiClient.post<ExtractorTemplate>(
+            `/extractor-templates/${id}/revisions/${revision}/restore${force ? '?force=true' : ''}`
+        )
+        return response
+    },
+
+    // 获取模板的测试用例
+    async getFixtures(id: number): Promise<ExtractorFixture[]> {
+        const response = await apiClient.get<ExtractorFixture[]>(`/extractor-templates/${id}/fixtures`)
+        return response
+    },
+
+    // 将已存储的邮件添加为测试用例，省略 expected 时以当前提取结果作为期望值
+    async createFixture(id: number, data: { name?: string; email_id: number; expected?: ExtractorFixtureOutput }): Promise<ExtractorFixture> {
+        const response = await apiClient.post<ExtractorFixture>(`/extractor-templates/${id}/fixtures`, data)
+        return response
+    },
+
+    // 上传 .eml 文件作为测试用例
+    async uploadFixture(id: number, file: File, name?: string): Promise<ExtractorFixture> {
+        const query = name ? `?name=${encodeURIComponent(name)}` : ''
+        const response = await apiClient.post<ExtractorFixture>(`/extractor-templates/${id}/fixtures/eml${query}`, file, {
+            headers: { 'Content-Type': 'message/rfc822' }
+        })
+        return response
+    },
+
+    // 更新测试用例，record 为 true 时以当前提取结果重新记录期望值
+    async updateFixture(id: number, fixtureId: number, data: { name?: string; expected?: ExtractorFixtureOutput; record?: boolean }): Promise<ExtractorFixture> {
+        const response = await apiClient.put<ExtractorFixture>(`/extractor-templates/${id}/fixtures/${fixtureId}`, data)
+        return response
+    },
+
+    // 删除测试用例
+    async deleteFixture(id: number, fixtureId: number): Promise<void> {
+        await apiClient.delete(`/extractor-templates/${id}/fixtures/${fixtureId}`)
+    },
+
+    // 运行模板的全部测试用例
+    async runFixtures(id: number): Promise<ExtractorSuiteResult> {
+        const response = await apiClient.post<ExtractorSuiteResult>(`/extractor-templates/${id}/fixtures/run`)
+        return response
     }
 }
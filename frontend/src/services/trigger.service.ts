@@ -6,6 +6,8 @@ import {
     PaginatedTriggersResponse,
     TriggerExecutionLog,
     PaginatedTriggerLogsResponse,
+    TriggerLedgerEntry,
+    PaginatedTriggerLedgerResponse,
     TriggerStatistics,
     PaginationParams,
     ApiResponse
@@ -60,9 +62,9 @@ export class TriggerService {
         await apiClient.delete(`${this.baseUrl}/${id}`)
     }
 
-    // 启用触发器
-    async enableTrigger(id: number): Promise<EmailTrigger> {
-        const response = await apiClient.post<ApiResponse<EmailTrigger>>(`${this.baseUrl}/${id}/enable`)
+    // 启用触发器，resume 决定是否评估停用期间入库的邮件（默认 skip）
+    async enableTrigger(id: number, resume: 'skip' | 'backfill' = 'skip'): Promise<EmailTrigger> {
+        const response = await apiClient.post<ApiResponse<EmailTrigger>>(`${this.baseUrl}/${id}/enable?resume=${resume}`)
         return response.data
     }
 
@@ -95,6 +97,26 @@ export class TriggerService {
         return response.data
     }
 
+    // 对选定的邮件重新执行触发器
+    async rerunTrigger(id: number, emailIds: number[]): Promise<TriggerLedgerEntry[]> {
+        return apiClient.post<TriggerLedgerEntry[]>(`${this.baseUrl}/${id}/rerun`, { email_ids: emailIds })
+    }
+
+    // 获取触发器处理台账
+    async getTriggerLedger(
+        id: number,
+        params?: PaginationParams & { email_id?: number }
+    ): Promise<PaginatedTriggerLedgerResponse> {
+        const queryParams = new URLSearchParams()
+
+        if (params?.email_id) queryParams.append('email_id', params.email_id.toString())
+        if (params?.page) queryParams.append('page', params.page.toString())
+        if (params?.limit) queryParams.append('limit', params.limit.toString())
+
+        const query = queryParams.toString() ? `?${queryParams}` : ''
+        return apiClient.get<PaginatedTriggerLedgerResponse>(`${this.baseUrl}/${id}/ledger${query}`)
+    }
+
     // 获取触发器统计信息
     async getTriggerStatistics(
         triggerId: number,
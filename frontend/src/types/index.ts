@@ -32,6 +32,7 @@ export interface EmailAccount {
     isDomainMail: boolean;
     domain?: string;
     customSettings?: Record<string, any>;
+    tags?: string[]; // 账户标签，触发器可以按标签选择账户
     isVerified?: boolean;
     verifiedAt?: string;
     createdAt: string;
@@ -249,12 +250,15 @@ export function convertToDisplayAccount(account: EmailAccount): EmailAccountDisp
 
 // 取件模板相关类型
 export interface ExtractorConfig {
-    field: 'ALL' | 'from' | 'to' | 'cc' | 'subject' | 'body' | 'html_body' | 'headers'
-    type: 'regex' | 'js' | 'gotemplate'
+    field: 'ALL' | 'from' | 'to' | 'cc' | 'subject' | 'body' | 'html_body' | 'headers' | 'attachments' | `attachment:${string}`
+    type: 'regex' | 'js' | 'gotemplate' | 'html' | 'jsonpath' | 'builtin'
     match?: string  // 可选的匹配条件
     extract: string // 提取规则（替换原来的config字段）
     config?: string // 保留用于向后兼容
     replacement?: string // 正则表达式的替换模板（如 $0, $1 等）
+    name?: string // 输出名称，结果写入 values
+    output_type?: 'string' | 'number' | 'date' | 'url' | 'list'
+    required?: boolean // 缺少该值时报告校验错误
 }
 
 export interface ExtractResult {
@@ -268,10 +272,85 @@ export interface ExtractorTemplate {
     name: string
     description?: string
     extractors: ExtractorConfig[]
+    revision: number
+    suite?: ExtractorSuiteResult // 更新后测试用例的运行结果
     created_at: string
     updated_at: string
 }
 
+export interface ExtractorRevisionChange {
+    path: string
+    op: 'added' | 'removed' | 'changed'
+    old?: unknown
+    new?: unknown
+}
+
+export interface ExtractorTemplateRevision {
+    template_id: number
+    revision: number
+    name: string
+    description?: string
+    extractors: ExtractorConfig[]
+    author_id?: number
+    author?: string
+    message?: string
+    created_at: string
+    current: boolean
+    changes: ExtractorRevisionChange[]
+}
+
+export interface ExtractorTemplateDiff {
+    template_id: number
+    from: number
+    to: number
+    changes: ExtractorRevisionChange[]
+}
+
+export interface ExtractorFixtureOutput {
+    matches: string[]
+    values?: Record<string, unknown>
+}
+
+export interface ExtractorFixture {
+    id: number
+    template_id: number
+    name: string
+    source: 'email' | 'eml'
+    email_id?: number
+    expected: ExtractorFixtureOutput
+    last_status?: 'passed' | 'failed' | 'error'
+    last_run_at?: string
+    created_at: string
+    updated_at: string
+}
+
+export interface ExtractorFixtureDiff {
+    path: string
+    expected?: unknown
+    actual?: unknown
+}
+
+export interface ExtractorFixtureResult {
+    fixture_id: number
+    name: string
+    status: 'passed' | 'failed' | 'error'
+    error?: string
+    expected: ExtractorFixtureOutput
+    actual?: ExtractorFixtureOutput
+    diffs?: ExtractorFixtureDiff[]
+    regressed?: boolean
+}
+
+export interface ExtractorSuiteResult {
+    template_id: number
+    total: number
+    passed: number
+    failed: number
+    regressions: number
+    fixtures: ExtractorFixtureResult[]
+    run_at: string
+}
+
 export interface ExtractorTemplateRequest {
     name: string
     description?: string
@@ -288,11 +367,11 @@ export interface PaginatedExtractorTemplatesResponse {
 
 // 触发器相关类型
 export type TriggerStatus = 'enabled' | 'disabled'
-export type TriggerActionType = 'modify_content' | 'smtp'
+export type TriggerActionType = 'modify_content' | 'smtp' | 'add_tags' | 'remove_tags' | 'extract_values'
 export type TriggerExecutionStatus = 'success' | 'failed' | 'partial'
 
 export interface TriggerConditionConfig {
-    type: string // js, gotemplate
+    type: string // js, gotemplate, builtin
     script: string // 脚本内容
     timeout?: number // 超时时间（秒）
 }
@@ -313,10 +392,14 @@ export interface EmailTrigger {
     status: TriggerStatus // 触发器状态
 
     // 检查配置
-    check_interval: number // 检查间隔（秒）
+    check_interval: number // 兜底轮询间隔（秒），新邮件入库时立即评估
+
+    // 账户范围：这些账户及带有这些标签的账户，都为空时评估所有账户
+    account_ids?: number[]
+    account_tags?: string[]
 
     // 过滤参数（复用EmailFilter结构）
-    email_address?: string // 邮箱地址过滤
+    email_address?: string // 收件地址或别名，支持 user+tag@gmail.com 和 *@domain.com
     start_date?: string // 开始日期
     end_date?: string // 结束日期
     subject?: string // 主题过滤
@@ -326,7 +409,8 @@ export interface EmailTrigger {
     unread?: boolean // 是否未读
     labels?: string[] // 标签过滤
     folders?: string[] // 文件夹列表
-    custom_filters?: Record<string, string> // 自定义过滤器
+    custom_filters?: Record<string, string> // 自定义过滤器，键为搜索运算符，如 { larger: '1M' }
+    query?: string // Gmail风格搜索语句
 
     // 触发条件和动作
     condition: TriggerConditionConfig // 触发条件
@@ -340,6 +424,8 @@ export interface EmailTrigger {
     success_executions: number // 成功执行次数
     last_executed_at?: string // 最后执行时间
     last_error?: string // 最后错误信息
+    last_email_id: number // 已评估到的邮件ID
+    revision: number // 修订号，每次修改配置加一
 
     // 时间戳
     created_at: string
@@ -351,6 +437,8 @@ export interface CreateTriggerRequest {
     name: string
     description?: string
     check_interval: number
+    account_ids?: number[]
+    account_tags?: string[]
     email_address?: string
     subject?: string
     from?: string
@@ -360,6 +448,7 @@ export interface CreateTriggerRequest {
     labels?: string[]
     folders?: string[]
     custom_filters?: Record<string, string>
+    query?: string
     condition: TriggerConditionConfig
     actions: TriggerActionConfig[]
     enable_logging: boolean
@@ -426,6 +515,30 @@ export interface PaginatedTriggerLogsResponse {
     total_pages: number
 }
 
+// 处理台账：触发器的某个修订对一封邮件的处理记录
+export interface TriggerLedgerEntry {
+    id: number
+    trigger_id: number
+    email_id: number
+    revision: number
+    state: 'running' | 'done'
+    outcome?: 'success' | 'failed' | 'partial'
+    condition_result: boolean
+    completed_actions?: number[] // 已成功的动作下标
+    attempts: number
+    error?: string
+    created_at: string
+    updated_at: string
+}
+
+export interface PaginatedTriggerLedgerResponse {
+    data: TriggerLedgerEntry[]
+    total: number
+    page: number
+    limit: number
+    total_pages: number
+}
+
 export interface TriggerStatistics {
     total_executions: number
     success_executions: number